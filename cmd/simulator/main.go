@@ -1,23 +1,41 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/jasonKoogler/cpu-sim/internal/area"
 	"github.com/jasonKoogler/cpu-sim/internal/config"
 	"github.com/jasonKoogler/cpu-sim/internal/pipeline"
 	"github.com/jasonKoogler/cpu-sim/internal/simulator"
 )
 
 func main() {
-	configPath := flag.String("config", "configs/default.yaml", "Path to the configuration file")
+	configPath := flag.String("config", "configs/default.yaml", "Path to the configuration file (.yaml or .toml)")
 	verbose := flag.Bool("v", false, "Enable verbose output")
 	numCycles := flag.Int64("cycles", 1000, "Number of cycles to simulate")
 	showPipeline := flag.Bool("show-pipeline", false, "Show the pipeline structure")
+	timeout := flag.Duration("timeout", 0, "Abort the simulation after this much wall-clock time (0 disables)")
+	statsJSON := flag.String("stats-json", "", "Write the final statistics as JSON to this path")
+	csvPath := flag.String("csv", "", "Write per-interval metrics as CSV to this path")
+	csvInterval := flag.Int64("csv-interval", 100, "Cycles between CSV samples")
+	validate := flag.Bool("validate", false, "Load the configuration and build the simulator without running it")
+	progressInterval := flag.Int64("progress", 0, "Report progress on stderr every this many cycles (0 disables)")
+	tracePath := flag.String("trace", "", "Write a cycle-by-cycle pipeline trace to this path (needs syncMode)")
+	recordPath := flag.String("record", "", "Record every retired instruction to this path")
+	replayPath := flag.String("replay", "", "Fetch the instructions of a recording made with -record instead of the workload")
+	genConfig := flag.String("gen-config", "", "Write the default configuration as commented YAML to this path and exit")
+	force := flag.Bool("force", false, "Let -gen-config overwrite an existing file")
 	flag.Parse()
 
 	logger := log.New(os.Stdout, "", log.LstdFlags)
@@ -26,6 +44,14 @@ func main() {
 		logger.SetFlags(log.LstdFlags | log.Lmicroseconds | log.Lshortfile)
 	}
 
+	if *genConfig != "" {
+		if err := generateConfig(*genConfig, *force); err != nil {
+			logger.Fatalf("Failed to generate configuration: %v", err)
+		}
+		logger.Printf("Default configuration written to %s", *genConfig)
+		return
+	}
+
 	if *numCycles <= 0 {
 		logger.Fatalf("Invalid cycle count: %d", *numCycles)
 	}
@@ -39,37 +65,125 @@ func main() {
 
 	fmt.Println("\nConfiguration Summary:")
 	fmt.Printf("	Cores: %d @ %d MHz\n", cfg.NumCores, cfg.ClockFrequency)
+	if len(cfg.CoreTypes) > 0 {
+		for i := 0; i < cfg.NumCores; i++ {
+			coreCfg := cfg.ForCore(i)
+			fmt.Printf("	  Core %d: %s (%s, %d stages, %d-wide, %d MHz)\n",
+				i, cfg.CoreTypeName(i), coreCfg.ISA, coreCfg.PipelineDepth, coreCfg.IssueWidth, coreCfg.ClockFrequency)
+		}
+	}
 	fmt.Printf("	ISA: %s\n", cfg.ISA)
-	fmt.Printf("	Pipeline Depth: %d stages\n", cfg.PipelineDepth)
+	fmt.Printf("	Pipeline Depth: %d stages, %d-wide\n", cfg.PipelineDepth, cfg.IssueWidth)
+	if cfg.FetchQueueSize > 0 {
+		fmt.Printf("	Fetch Queue: %d instructions\n", cfg.FetchQueueSize)
+	}
+	if cfg.FlushPenalty {
+		fmt.Println("	Flush Penalty: front-end refill on every flush")
+	}
+	if cfg.FlushOnInvalidate {
+		fmt.Println("	Coherence Flushes: on invalidation of a line a load in flight has read")
+	}
+	if cfg.OutOfOrder {
+		fmt.Printf("	Issue: out-of-order, %d-entry reorder buffer, %d reservation stations\n", cfg.ROBSize, cfg.ReservationStations)
+	}
+	if cfg.Threads() > 1 {
+		fmt.Printf("	Hardware Threads: %d per core (round-robin fetch)\n", cfg.Threads())
+	}
+	switch {
+	case cfg.Engine == "event":
+		fmt.Println("	Cycle Model: lockstep, event-driven")
+	case cfg.SyncMode:
+		fmt.Println("	Cycle Model: lockstep")
+	default:
+		fmt.Println("	Cycle Model: async")
+	}
+	fmt.Printf("	Execution Units: %d ALU, %d FPU, %d LoadStore, %d Branch\n",
+		cfg.NumALUs, cfg.NumFPUs, cfg.NumLoadStore, cfg.NumBranch)
 	fmt.Printf("	Cache Coherence: %s\n", cfg.CoherenceProtocol)
+	if cfg.FalseSharingLines > 0 && cfg.CoherenceProtocol != "None" {
+		fmt.Printf("	False Sharing Detection: top %d lines\n", cfg.FalseSharingLines)
+	}
 	fmt.Printf("	Interconnect: %s, %d GB/s\n", cfg.InterconnectType, cfg.InterconnectBandwidth)
+	if cfg.InterconnectType == "bus" {
+		fmt.Printf("	Bus Arbitration: %s\n", cfg.BusArbitrationPolicy)
+	}
 	fmt.Printf("	Memory Latency: %d cycles\n", cfg.MemoryLatency)
-	fmt.Printf("	Workload: %s\n", cfg.WorkloadPath)
+	if cfg.MemoryPorts > 0 {
+		fmt.Printf("	Memory Ports: %d\n", cfg.MemoryPorts)
+		if cfg.HitUnderMissLatency > 0 {
+			fmt.Printf("	Hit-Under-Miss Latency: %d cycles\n", cfg.HitUnderMissLatency)
+		}
+	}
+	if cfg.MemorySize > 0 {
+		fmt.Printf("	Memory Size: %d bytes\n", cfg.MemorySize)
+	}
+	if cfg.StoreBufferEntries > 0 {
+		fmt.Printf("	Store Buffer: %d entries per core\n", cfg.StoreBufferEntries)
+	}
+	if cfg.WriteCombiningEntries > 0 {
+		fmt.Printf("	Write Combining: %d lines per core, %s flush\n", cfg.WriteCombiningEntries, cfg.WriteCombiningFlushPolicy)
+	}
+	if cfg.NUMANodes > 1 {
+		fmt.Printf("	NUMA: %d nodes, %d cycle remote penalty\n", cfg.NUMANodes, cfg.NUMARemotePenalty)
+	}
+	if cfg.DRAMBanks > 0 {
+		fmt.Printf("	DRAM: %d banks of %d-byte rows, %d cycle activate, %d cycle precharge\n", cfg.DRAMBanks,
+			1<<cfg.DRAMBankShift, cfg.DRAMActivateLatency, cfg.DRAMPrechargeLatency)
+	}
+	switch {
+	case *replayPath != "":
+		fmt.Printf("	Workload: replay of %s\n", *replayPath)
+	case cfg.WorkloadPath != "":
+		fmt.Printf("	Workload: %s\n", cfg.WorkloadPath)
+	default:
+		fmt.Println("	Workload: synthetic")
+	}
 
 	fmt.Println("\nMemory Hierarchy:")
-	fmt.Printf("	L1 Cache: %d KB, %d-way, %d cycles\n", cfg.L1Size, cfg.L1Associativity, cfg.L1Latency)
-	fmt.Printf("	L2 Cache: %d KB, %d-way, %d cycles\n", cfg.L2Size, cfg.L2Associativity, cfg.L2Latency)
-	fmt.Printf("	L3 Cache: %d KB, %d-way, %d cycles\n", cfg.L3Size, cfg.L3Associativity, cfg.L3Latency)
+	fmt.Printf("	L1 Cache: %d KB, %s, %d cycles\n", cfg.L1Size, ways(cfg.L1Associativity), cfg.L1Latency)
+	fmt.Printf("	L2 Cache: %d KB, %s, %d cycles\n", cfg.L2Size, ways(cfg.L2Associativity), cfg.L2Latency)
+	fmt.Printf("	L3 Cache: %d KB, %s, %d cycles\n", cfg.L3Size, ways(cfg.L3Associativity), cfg.L3Latency)
+	if cfg.ReplacementPolicy != "" && cfg.ReplacementPolicy != "lru" {
+		fmt.Printf("	Cache Replacement: %s\n", cfg.ReplacementPolicy)
+	}
+	if cfg.CacheInclusionPolicy != "" && cfg.CacheInclusionPolicy != "NINE" {
+		fmt.Printf("	Cache Inclusion: %s\n", cfg.CacheInclusionPolicy)
+	}
 
-	// Show pipeline structure if requested
-	if *showPipeline {
-		pipe, err := pipeline.NewPipeline(cfg.PipelineDepth, cfg.ISA)
-		if err != nil {
-			logger.Fatalf("Failed to create pipeline: %v", err)
-		}
+	est := area.EstimateArea(cfg)
+	fmt.Println("\nEstimated Area:")
+	fmt.Printf("	Cores: %.2f mm²\n", est.Cores)
+	fmt.Printf("	Caches: %.2f mm² (L1 %.2f, L2 %.2f, L3 %.2f)\n", est.L1+est.L2+est.L3, est.L1, est.L2, est.L3)
+	fmt.Printf("	Interconnect: %.2f mm²\n", est.Interconnect)
+	fmt.Printf("	Total: %.2f mm²\n", est.Total)
 
+	// Show pipeline structure if requested; validation always shows it. Each
+	// core type gets its own, built from the settings its cores resolve to.
+	if *showPipeline || *validate {
 		fmt.Println("\nPipeline Structure:")
-		fmt.Printf("  Total Stages: %d\n", len(pipe.GetStages()))
-
-		fmt.Print("  Pipeline Flow: ")
-		stages := pipe.GetStages()
-		for i, stage := range stages {
-			fmt.Printf("%s", stage.Name)
-			if i < len(stages)-1 {
-				fmt.Print(" → ")
+		if len(cfg.CoreTypes) == 0 {
+			if err := printPipeline(cfg, "  "); err != nil {
+				logger.Fatalf("Failed to create pipeline: %v", err)
+			}
+		}
+
+		var names []string
+		first := make(map[string]int)
+		cores := make(map[string][]string)
+		for id := 0; id < cfg.NumCores && len(cfg.CoreTypes) > 0; id++ {
+			name := cfg.CoreTypeName(id)
+			if cores[name] == nil {
+				names = append(names, name)
+				first[name] = id
+			}
+			cores[name] = append(cores[name], strconv.Itoa(id))
+		}
+		for _, name := range names {
+			fmt.Printf("  Core type %s (cores %s):\n", name, strings.Join(cores[name], ", "))
+			if err := printPipeline(cfg.ForCore(first[name]), "    "); err != nil {
+				logger.Fatalf("Failed to create pipeline for core type %s: %v", name, err)
 			}
 		}
-		fmt.Println()
 	}
 
 	sim, err := simulator.New(cfg)
@@ -77,36 +191,381 @@ func main() {
 		logger.Fatalf("Failed to initialize simulator: %v", err)
 	}
 
+	if *validate {
+		logger.Println("Configuration is valid")
+		return
+	}
+
+	var csvFile *os.File
+	if *csvPath != "" {
+		csvFile, err = os.Create(*csvPath)
+		if err != nil {
+			logger.Fatalf("Failed to create CSV file: %v", err)
+		}
+
+		if err := sim.SetSampler(csvFile, *csvInterval); err != nil {
+			logger.Fatalf("Failed to enable sampling: %v", err)
+		}
+	}
+
+	var traceFile *os.File
+	if *tracePath != "" {
+		traceFile, err = os.Create(*tracePath)
+		if err != nil {
+			logger.Fatalf("Failed to create trace file: %v", err)
+		}
+
+		if err := sim.SetTrace(traceFile); err != nil {
+			logger.Fatalf("Failed to enable tracing: %v", err)
+		}
+	}
+
+	if *replayPath != "" {
+		if err := replay(sim, *replayPath); err != nil {
+			logger.Fatalf("Failed to load recording: %v", err)
+		}
+	}
+
+	var recordFile *os.File
+	if *recordPath != "" {
+		recordFile, err = os.Create(*recordPath)
+		if err != nil {
+			logger.Fatalf("Failed to create recording file: %v", err)
+		}
+
+		if err := sim.SetRecorder(recordFile); err != nil {
+			logger.Fatalf("Failed to enable recording: %v", err)
+		}
+	}
+
+	if *progressInterval > 0 {
+		report := func(cycle, total int64) {
+			fmt.Fprintf(os.Stderr, "\rProgress: %d/%d cycles (%.0f%%)", cycle, total, float64(cycle)*100/float64(total))
+			if cycle == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+
+		if err := sim.SetProgress(report, *progressInterval); err != nil {
+			logger.Fatalf("Failed to enable progress reporting: %v", err)
+		}
+	}
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, snapshotSignals...)...)
 
 	go func() {
 		logger.Printf("Starting simulation for %d cycles...", *numCycles)
 
-		if err := sim.Run(*numCycles); err != nil {
-			logger.Fatalf("Simulation failed: %v", err)
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		result, err := sim.RunContext(ctx, *numCycles)
+		if csvFile != nil {
+			csvFile.Close()
+		}
+		if traceFile != nil {
+			traceFile.Close()
+		}
+		if recordFile != nil {
+			recordFile.Close()
+		}
+
+		if err != nil {
+			// A run stopped early reports the statistics it gathered
+			if result == nil || !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) &&
+				!errors.Is(err, simulator.ErrInstructionBudgetExceeded) {
+				logger.Fatalf("Simulation failed: %v", err)
+			}
+			logger.Printf("Simulation aborted: %v", err)
 		}
 
-		stats := sim.GetStatistics()
+		for _, warning := range result.Warnings {
+			logger.Printf("Warning: %s", warning)
+		}
+
+		if *statsJSON != "" {
+			if err := writeStatsJSON(sim, *statsJSON); err != nil {
+				logger.Fatalf("Failed to write statistics: %v", err)
+			}
+		}
+
+		stats := result.Statistics
+		fmt.Printf("Simulated %d cycles in %v (%.2f cycles/second)\n",
+			stats.TotalCycles, stats.WallClockDuration, stats.SimulatedCyclesPerSecond)
+
 		fmt.Println("\nSimulation Statistics:")
 		fmt.Printf("	Total Cycles: %d\n", stats.TotalCycles)
 		fmt.Printf("	Instructions Executed: %d\n", stats.InstructionsExecuted)
 		fmt.Printf("	IPC: %.2f\n", stats.IPC)
 		fmt.Printf("	Cache Hit Rate: %.2f%%\n", stats.CacheHitRate*100)
+		if cfg.TLBEntries > 0 {
+			fmt.Printf("	TLB Hit Rate: %.2f%%\n", stats.TLBHitRate*100)
+		}
+		fmt.Printf("	Dirty Evictions: %d\n", stats.DirtyEvictions)
+		if cfg.CacheInclusionPolicy == "inclusive" {
+			fmt.Printf("	Back-Invalidations: %d\n", stats.BackInvalidations)
+		}
+		if cfg.PrefetchPolicy != "" && cfg.PrefetchPolicy != "none" {
+			fmt.Printf("	Prefetches (%s): %d, %.2f%% useful, +%.2f%% L1 hit rate\n", cfg.PrefetchPolicy,
+				stats.Prefetches, stats.PrefetchAccuracy*100, stats.PrefetchHitRateGain*100)
+		}
 		fmt.Printf("	Core Utilization: %.2f%%\n", stats.CoreUtilization[0]*100)
 		fmt.Printf("	Memory Access Latency: %.2f cycles\n", stats.MemoryAccessLatency)
 		fmt.Printf("	Interconnect Utilization: %.2f%%\n", stats.InterconnectUtilization*100)
+		fmt.Printf("	Average Message Latency: %.2f cycles over %.2f hops\n", stats.AverageMessageLatency, stats.AverageHopCount)
+		fmt.Printf("	Hazard Stall Cycles: %d\n", stats.HazardStallCycles)
+		fmt.Printf("	Forwarded Hazards: %d\n", stats.ForwardedHazards)
+		fmt.Printf("	WAW/WAR Stall Cycles: %d/%d\n", stats.WAWStallCycles, stats.WARStallCycles)
+		fmt.Printf("	Structural Stall Cycles: %d\n", stats.StructuralStallCycles)
+		if cfg.MemoryPorts > 0 {
+			fmt.Printf("	Memory Port Stalls: %d\n", stats.MemoryPortStalls)
+			fmt.Printf("	Hits Under Miss: %d (%d cycles added by port contention)\n",
+				stats.HitsUnderMiss, stats.HitUnderMissCycles)
+		}
+		if cfg.StoreBufferEntries > 0 {
+			fmt.Printf("	Store Buffer: %d full stalls, %d forwarded loads\n", stats.StoreBufferStalls, stats.StoreForwards)
+		}
+		if cfg.WriteCombiningEntries > 0 {
+			fmt.Printf("	Write Combining: %d combined stores, %d full line writes, %d partial line writes\n",
+				stats.CombinedStores, stats.FullLineWrites, stats.PartialLineWrites)
+		}
+		if cfg.MemorySize > 0 {
+			fmt.Printf("	Memory Faults: %d\n", stats.MemoryFaults)
+		}
+		if cfg.NUMANodes > 1 {
+			fmt.Printf("	NUMA Accesses: %.2f%% local (%d local, %d remote)\n",
+				stats.NUMALocalRatio*100, stats.NUMALocalAccesses, stats.NUMARemoteAccesses)
+		}
+		if cfg.DRAMBanks > 0 {
+			fmt.Printf("	DRAM Row Buffer Hit Rate: %.2f%% (%d hits, %d misses, %d conflicts)\n",
+				stats.DRAMRowHitRate*100, stats.DRAMRowHits, stats.DRAMRowMisses, stats.DRAMRowConflicts)
+		}
+		fmt.Printf("	Branch Prediction (%s): %.2f%% of %d branches, %d mispredict cycles\n",
+			cfg.BranchPredictor, stats.BranchAccuracy*100, stats.BranchStats.Predictions, stats.MispredictCycles)
+		fmt.Printf("	Taken Branches: %d, %d fetch redirects\n", stats.TakenBranches, stats.FetchRedirects)
+		if cfg.PredicationDistance > 0 {
+			fmt.Printf("	Predication: %d instructions, %d flushes avoided\n", stats.PredicatedInstructions, stats.AvoidedFlushes)
+		}
+		fmt.Printf("	Pipeline Flushes: %d mispredict, %d exception, %d coherence (%d refill cycles)\n",
+			stats.Flushes["mispredict"], stats.Flushes["exception"], stats.Flushes["coherence"], stats.FlushCycles)
+		if cfg.FetchQueueSize > 0 {
+			fmt.Printf("	Fetch Queue Stalls: %d\n", stats.FetchQueueStalls)
+		}
+		fmt.Printf("	Coherence: %d bus transactions, %d invalidations\n",
+			stats.CoherenceStats.BusTransactions, stats.CoherenceStats.Invalidations)
+		if cfg.CacheToCacheFetch {
+			fmt.Printf("	Cache-to-Cache Instruction Fetches: %d\n", stats.PeerFetches)
+		}
+		if stats.CoherenceStats.Atomics > 0 {
+			fmt.Printf("	Atomics: %d (%d contention cycles)\n",
+				stats.CoherenceStats.Atomics, stats.CoherenceStats.AtomicContention)
+		}
+		if cfg.InterruptInterval > 0 {
+			fmt.Printf("	Interrupts: %d (%d handler cycles, %d handler instructions)\n",
+				stats.Interrupts, stats.InterruptCycles, stats.HandlerInstructions)
+		}
+		fmt.Printf("	Energy: %.2f µJ, %.2f mW average\n", stats.TotalEnergy/1000, stats.AveragePower)
 
 		fmt.Println("\nCore Utilization:")
 		for i, util := range stats.CoreUtilization {
-			fmt.Printf("	Core %d: %.2f%%\n", i, util*100)
+			fmt.Printf("	Core %d: %.2f%% (%d stall cycles, %d bubble cycles)\n",
+				i, util*100, stats.CoreStallCycles[i], stats.CoreBubbleCycles[i])
+		}
+
+		if stats.CoreBusWaitCycles != nil {
+			fmt.Println("\nBus Arbitration Wait Cycles:")
+			for i, wait := range stats.CoreBusWaitCycles {
+				fmt.Printf("	Core %d: %d\n", i, wait)
+			}
+		}
+
+		if len(cfg.CoreTypes) > 0 {
+			fmt.Printf("\nEffective IPC (per %d MHz cycle):\n", cfg.ClockFrequency)
+			for i, ipc := range stats.CoreEffectiveIPC {
+				fmt.Printf("	Core %d @ %d MHz: %.2f\n", i, stats.CoreClockFrequencies[i], ipc)
+			}
+		}
+
+		if cfg.Threads() > 1 {
+			fmt.Println("\nPer-Thread IPC:")
+			for i, perThread := range stats.ThreadIPC {
+				for t, ipc := range perThread {
+					fmt.Printf("	Core %d Thread %d: %.2f\n", i, t, ipc)
+				}
+			}
+		}
+
+		fmt.Println("\nPipeline Stage Occupancy:")
+		for _, stage := range stats.StageStats {
+			total := stage.BusyCycles + stage.StallCycles + stage.EmptyCycles
+			stalled := 0.0
+			if total > 0 {
+				stalled = float64(stage.StallCycles) / float64(total)
+			}
+			fmt.Printf("	%s: %.2f%% occupied, %.2f%% stalled", stage.Name, stage.Occupancy()*100, stalled*100)
+			if cfg.PowerGateIdleThreshold > 0 {
+				fmt.Printf(", %d gated cycles, %d wakeups", stage.GatedCycles, stage.Wakeups)
+			}
+			fmt.Println()
+		}
+
+		if len(stats.MemoryLatencyHistogram) > 0 {
+			fmt.Println("\nMemory Latency Histogram:")
+			for _, bucket := range stats.MemoryLatencyHistogram {
+				if bucket.Count == 0 {
+					continue
+				}
+				switch {
+				case bucket.Max == 0:
+					fmt.Printf("	%d+ cycles: %d\n", bucket.Min, bucket.Count)
+				case bucket.Min == bucket.Max:
+					fmt.Printf("	%d cycles: %d\n", bucket.Min, bucket.Count)
+				default:
+					fmt.Printf("	%d-%d cycles: %d\n", bucket.Min, bucket.Max, bucket.Count)
+				}
+			}
+		}
+
+		if len(stats.FalseSharingLines) > 0 {
+			fmt.Println("\nFalse Sharing:")
+			for _, line := range stats.FalseSharingLines {
+				fmt.Printf("	Line %#x: %d invalidations\n", line.Address, line.Invalidations)
+			}
+		}
+
+		fmt.Println("\nRetired Instructions:")
+		for _, instType := range []string{"Integer", "Float", "Memory", "Branch", "System"} {
+			retired := stats.RetiredByType[instType]
+			share := 0.0
+			if stats.InstructionsExecuted > 0 {
+				share = float64(retired) / float64(stats.InstructionsExecuted)
+			}
+			fmt.Printf("	%s: %d (%.2f%%)\n", instType, retired, share*100)
+		}
+
+		fmt.Println("\nExecution Unit Utilization:")
+		for _, unitType := range []string{"ALU", "FPU", "LoadStore", "Branch"} {
+			fmt.Printf("	%s: %.2f%%\n", unitType, stats.UnitUtilization[unitType]*100)
+		}
+
+		if cfg.ProfileHotspots {
+			fmt.Println("\nHot Instructions:")
+			for _, hot := range sim.HotInstructions(10) {
+				fmt.Printf("	0x%x: %d retired\n", hot.Address, hot.Count)
+			}
 		}
 
 		os.Exit(0)
 	}()
 
-	<-sigChan
+	// A snapshot signal prints the statistics so far and the run carries on;
+	// any other shuts it down
+	for sig := range sigChan {
+		if !slices.Contains(snapshotSignals, sig) {
+			break
+		}
+		printSnapshot(sim.GetStatistics())
+	}
+
 	logger.Println("Received termination signal. Shutting down...")
 	sim.Shutdown()
 	logger.Println("Simulation terminated successfully")
 }
+
+// printPipeline prints the stages of the pipeline cfg builds, each line
+// starting with indent
+func printPipeline(cfg *config.Config, indent string) error {
+	pipe, err := pipeline.NewPipeline(cfg.PipelineDepth, cfg.ISA)
+	if err != nil {
+		return err
+	}
+
+	stages := pipe.GetStages()
+	fmt.Printf("%sISA: %s\n", indent, cfg.ISA)
+	fmt.Printf("%sTotal Stages: %d\n", indent, len(stages))
+
+	fmt.Printf("%sPipeline Flow: ", indent)
+	for i, stage := range stages {
+		fmt.Printf("%s", stage.Name)
+		if i < len(stages)-1 {
+			fmt.Print(" → ")
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// ways describes a cache's associativity
+func ways(associativity int) string {
+	if associativity == config.FullyAssociative {
+		return "fully associative"
+	}
+	return fmt.Sprintf("%d-way", associativity)
+}
+
+// printSnapshot prints the headline statistics of a run in progress
+func printSnapshot(stats simulator.Statistics) {
+	fmt.Printf("\nStatistics after %d cycles (%v):\n", stats.TotalCycles, stats.WallClockDuration)
+	fmt.Printf("	Instructions Executed: %d\n", stats.InstructionsExecuted)
+	fmt.Printf("	IPC: %.2f\n", stats.IPC)
+	fmt.Printf("	Cache Hit Rate: %.2f%%\n", stats.CacheHitRate*100)
+	fmt.Printf("	Branch Accuracy: %.2f%%\n", stats.BranchAccuracy*100)
+	for i, util := range stats.CoreUtilization {
+		fmt.Printf("	Core %d Utilization: %.2f%%\n", i, util*100)
+	}
+}
+
+// writeStatsJSON writes the simulator's statistics to a JSON file at path
+func writeStatsJSON(sim simulator.Simulator, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if err := sim.WriteStatsJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// generateConfig writes the default configuration to path, refusing to
+// replace an existing file unless force is set
+func generateConfig(path string, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if err := config.WriteDefault(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// replay makes sim fetch the instructions recorded at path
+func replay(sim simulator.Simulator, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return sim.Replay(f)
+}
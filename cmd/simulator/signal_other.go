@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// snapshotSignals print the statistics so far without stopping the run;
+// there is no SIGUSR1 to send outside Unix
+var snapshotSignals []os.Signal
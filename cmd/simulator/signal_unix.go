@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// snapshotSignals print the statistics so far without stopping the run
+var snapshotSignals = []os.Signal{syscall.SIGUSR1}
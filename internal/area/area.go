@@ -0,0 +1,115 @@
+package area
+
+import (
+	"math"
+
+	"github.com/jasonKoogler/cpu-sim/internal/config"
+)
+
+// Coefficients are the per-component area costs used by the model, in mm²
+type Coefficients struct {
+	CoreBase        float64            // fixed area of a core outside its pipeline and units
+	PerStage        float64            // area per pipeline stage
+	PerUnit         map[string]float64 // area per execution unit, keyed by unit type
+	CachePerKB      float64            // SRAM area per KB of cache
+	AssocOverhead   float64            // extra tag/comparator area per doubling of associativity
+	Interconnect    map[string]float64 // area per core, keyed by interconnect type
+	CrossbarPerPort float64            // crossbar area grows with the square of the port count
+}
+
+// DefaultCoefficients returns rough coefficients for a modern process node
+func DefaultCoefficients() Coefficients {
+	return Coefficients{
+		CoreBase: 1.0,
+		PerStage: 0.1,
+		PerUnit: map[string]float64{
+			"ALU":       0.05,
+			"FPU":       0.2,
+			"LoadStore": 0.1,
+			"Branch":    0.03,
+		},
+		CachePerKB:    0.002,
+		AssocOverhead: 0.05,
+		Interconnect: map[string]float64{
+			"bus":   0.1,
+			"ring":  0.2,
+			"mesh":  0.3,
+			"torus": 0.4,
+		},
+		CrossbarPerPort: 0.05,
+	}
+}
+
+// AreaResult is the estimated area of each component, in mm²
+type AreaResult struct {
+	Cores        float64 // all cores, excluding caches
+	L1           float64 // all L1 caches
+	L2           float64 // all L2 caches
+	L3           float64 // all L3 caches
+	Interconnect float64
+	Total        float64
+}
+
+// EstimateArea estimates the silicon area of the configured design using
+// the default coefficients
+func EstimateArea(cfg *config.Config) AreaResult {
+	return EstimateAreaWith(cfg, DefaultCoefficients())
+}
+
+// EstimateAreaWith estimates the silicon area of the configured design
+func EstimateAreaWith(cfg *config.Config, coeffs Coefficients) AreaResult {
+	cores := float64(cfg.NumCores)
+
+	coreArea := 0.0
+	for i := 0; i < cfg.NumCores; i++ {
+		coreArea += singleCoreArea(cfg.ForCore(i), coeffs)
+	}
+
+	result := AreaResult{
+		Cores: coreArea,
+		// Every core has a private L1/L2/L3 hierarchy
+		L1: cacheArea(coeffs, cfg.L1Size, cfg.Ways(cfg.L1Size, cfg.L1Associativity)) * cores,
+		L2: cacheArea(coeffs, cfg.L2Size, cfg.Ways(cfg.L2Size, cfg.L2Associativity)) * cores,
+		L3: cacheArea(coeffs, cfg.L3Size, cfg.Ways(cfg.L3Size, cfg.L3Associativity)) * cores,
+	}
+
+	if cfg.InterconnectType == "crossbar" {
+		result.Interconnect = coeffs.CrossbarPerPort * cores * cores
+	} else {
+		result.Interconnect = coeffs.Interconnect[cfg.InterconnectType] * cores
+	}
+
+	result.Total = result.Cores + result.L1 + result.L2 + result.L3 + result.Interconnect
+
+	return result
+}
+
+// singleCoreArea estimates one core's area, excluding its caches
+func singleCoreArea(cfg *config.Config, coeffs Coefficients) float64 {
+	unitCounts := map[string]int{
+		"ALU":       cfg.NumALUs,
+		"FPU":       cfg.NumFPUs,
+		"LoadStore": cfg.NumLoadStore,
+		"Branch":    cfg.NumBranch,
+	}
+
+	area := coeffs.CoreBase + coeffs.PerStage*float64(cfg.PipelineDepth)
+	for unit, count := range unitCounts {
+		area += coeffs.PerUnit[unit] * float64(count)
+	}
+	return area
+}
+
+// cacheArea estimates a single cache's area from its size and associativity
+func cacheArea(coeffs Coefficients, sizeKB, associativity int) float64 {
+	if sizeKB <= 0 {
+		return 0.0
+	}
+
+	overhead := 1.0
+	if associativity > 1 {
+		overhead += coeffs.AssocOverhead * math.Log2(float64(associativity))
+	}
+
+	return coeffs.CachePerKB * float64(sizeKB) * overhead
+}
@@ -0,0 +1,87 @@
+package area
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jasonKoogler/cpu-sim/internal/config"
+)
+
+func TestEstimateArea(t *testing.T) {
+	cfg := config.DefaultConfig()
+	result := EstimateArea(cfg)
+
+	if result.Cores <= 0 || result.L1 <= 0 || result.L2 <= 0 || result.L3 <= 0 || result.Interconnect <= 0 {
+		t.Errorf("EstimateArea() has a non-positive component: %+v", result)
+	}
+
+	sum := result.Cores + result.L1 + result.L2 + result.L3 + result.Interconnect
+	if math.Abs(result.Total-sum) > 1e-9 {
+		t.Errorf("EstimateArea() Total = %f, want sum of components %f", result.Total, sum)
+	}
+}
+
+func TestEstimateArea_LargerCache(t *testing.T) {
+	base := config.DefaultConfig()
+	larger := config.DefaultConfig()
+	larger.L2Size = base.L2Size * 4
+
+	baseArea := EstimateArea(base)
+	largerArea := EstimateArea(larger)
+
+	if largerArea.L2 <= baseArea.L2 {
+		t.Errorf("L2 area with %d KB = %f, want more than %f with %d KB",
+			larger.L2Size, largerArea.L2, baseArea.L2, base.L2Size)
+	}
+
+	if largerArea.Total <= baseArea.Total {
+		t.Errorf("Total area with larger L2 = %f, want more than %f", largerArea.Total, baseArea.Total)
+	}
+
+	if largerArea.Cores != baseArea.Cores {
+		t.Errorf("Core area changed with cache size: %f vs %f", largerArea.Cores, baseArea.Cores)
+	}
+}
+
+func TestEstimateArea_Scaling(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *config.Config)
+		field  func(r AreaResult) float64
+	}{
+		{
+			name:   "Deeper pipeline",
+			modify: func(cfg *config.Config) { cfg.PipelineDepth = 14 },
+			field:  func(r AreaResult) float64 { return r.Cores },
+		},
+		{
+			name:   "More ALUs",
+			modify: func(cfg *config.Config) { cfg.NumALUs = 4 },
+			field:  func(r AreaResult) float64 { return r.Cores },
+		},
+		{
+			name:   "Higher associativity",
+			modify: func(cfg *config.Config) { cfg.L1Associativity = 16 },
+			field:  func(r AreaResult) float64 { return r.L1 },
+		},
+		{
+			name:   "Crossbar interconnect",
+			modify: func(cfg *config.Config) { cfg.InterconnectType = "crossbar"; cfg.NumCores = 16 },
+			field:  func(r AreaResult) float64 { return r.Interconnect / 16 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := config.DefaultConfig()
+			modified := config.DefaultConfig()
+			tt.modify(modified)
+
+			before := tt.field(EstimateArea(base)) / float64(base.NumCores)
+			after := tt.field(EstimateArea(modified)) / float64(modified.NumCores)
+			if after <= before {
+				t.Errorf("Area after change = %f, want more than %f", after, before)
+			}
+		})
+	}
+}
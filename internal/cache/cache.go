@@ -0,0 +1,620 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jasonKoogler/cpu-sim/internal/config"
+)
+
+// DefaultLineSize is the cache line size in bytes
+const DefaultLineSize = 64
+
+// WritePolicy controls when stores reach the next level
+type WritePolicy string
+
+const (
+	// WriteBack marks stored lines dirty and writes them down on eviction
+	WriteBack WritePolicy = "write-back"
+	// WriteThrough forwards every store to the next level immediately
+	WriteThrough WritePolicy = "write-through"
+)
+
+// ReplacementPolicy chooses which valid line a miss evicts from a full set
+type ReplacementPolicy string
+
+const (
+	// LRU evicts the least recently used line
+	LRU ReplacementPolicy = "lru"
+	// FIFO evicts the line filled longest ago, however recently it was used
+	FIFO ReplacementPolicy = "fifo"
+	// Random evicts a line chosen by the cache's seeded random source
+	Random ReplacementPolicy = "random"
+	// PLRU evicts the line a binary tree of recency bits points at, needing
+	// a power-of-two associativity
+	PLRU ReplacementPolicy = "plru"
+)
+
+// InclusionPolicy controls whether a level keeps copies of the lines held
+// by the levels above it
+type InclusionPolicy string
+
+const (
+	// Inclusive keeps every line of a level in the levels below it, evicting
+	// a line from the levels above when a lower level evicts it
+	Inclusive InclusionPolicy = "inclusive"
+	// Exclusive keeps each line in at most one level: hits in a lower level
+	// move the line to L1 and lines evicted from a level move to the next
+	Exclusive InclusionPolicy = "exclusive"
+	// NINE (non-inclusive, non-exclusive) fills every level a miss passes
+	// through and never forces lines out of another level
+	NINE InclusionPolicy = "NINE"
+)
+
+// eviction is the line a fill displaced, if any
+type eviction struct {
+	addr  uint64
+	valid bool // a line was displaced
+	dirty bool // it held data the next level lacks
+}
+
+// Stats contains hit/miss counters for a cache
+type Stats struct {
+	Hits             int64
+	Misses           int64
+	DirtyEvictions   int64 // dirty lines written to the next level on eviction
+	Prefetches       int64 // lines filled by the prefetcher
+	UsefulPrefetches int64 // prefetched lines later hit by a demand access
+}
+
+// HitRate returns hits / accesses, or 0 if the cache was never accessed
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0.0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// line is a single cache line (tag and state only, no data)
+type line struct {
+	tag        uint64
+	valid      bool
+	dirty      bool
+	prefetched bool   // filled by the prefetcher and not yet demanded
+	lastUsed   uint64 // access counter value at the last touch, for LRU
+	filled     uint64 // access counter value when the line was filled, for FIFO
+}
+
+// Cache is a set-associative cache, with LRU replacement unless set
+// otherwise
+type Cache struct {
+	Name          string
+	sets          [][]line
+	numSets       int
+	associativity int
+	lineSize      int
+	latency       int
+	writePolicy   WritePolicy
+	replacement   ReplacementPolicy
+	plru          []uint64 // per set tree bits, PLRU only; a set bit points the victim right
+	seed          uint64   // starting state of rng
+	rng           uint64   // xorshift state choosing Random victims
+	accessCount   uint64   // monotonically increasing access counter
+	stats         Stats
+	mutex         sync.Mutex
+}
+
+// FullyAssociative is the associativity of a cache that holds all its
+// lines in a single set, any line able to go anywhere
+const FullyAssociative = config.FullyAssociative
+
+// NewCache creates a cache of sizeKB kilobytes. A size that is not a whole
+// number of lines (or sets) is rounded down to the largest size that is.
+func NewCache(name string, sizeKB, associativity, latency, lineSize int) (*Cache, error) {
+	if sizeKB <= 0 {
+		return nil, fmt.Errorf("%s size must be positive", name)
+	}
+
+	if associativity <= 0 && associativity != FullyAssociative {
+		return nil, fmt.Errorf("%s associativity must be positive", name)
+	}
+
+	if lineSize <= 0 {
+		return nil, fmt.Errorf("%s line size must be positive", name)
+	}
+
+	numLines := sizeKB * 1024 / lineSize
+	if associativity == FullyAssociative {
+		associativity = max(numLines, 1)
+	}
+	numSets := numLines / associativity
+	if numSets == 0 {
+		return nil, fmt.Errorf("%s of %d KB cannot hold %d ways of %d-byte lines",
+			name, sizeKB, associativity, lineSize)
+	}
+
+	c := &Cache{
+		Name:          name,
+		sets:          make([][]line, numSets),
+		numSets:       numSets,
+		associativity: associativity,
+		lineSize:      lineSize,
+		latency:       latency,
+		writePolicy:   WriteBack,
+		replacement:   LRU,
+	}
+	for i := range c.sets {
+		c.sets[i] = make([]line, associativity)
+	}
+
+	return c, nil
+}
+
+// SetWritePolicy sets how stores are handled. Caches start out write-back.
+func (c *Cache) SetWritePolicy(policy WritePolicy) error {
+	if policy != WriteBack && policy != WriteThrough {
+		return fmt.Errorf("unsupported write policy: %s", policy)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writePolicy = policy
+	return nil
+}
+
+// WritePolicy returns how the cache handles stores
+func (c *Cache) WritePolicy() WritePolicy {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.writePolicy
+}
+
+// SetReplacementPolicy sets how the cache picks a line to evict. Caches
+// start out LRU. seed drives the choice of Random victims.
+func (c *Cache) SetReplacementPolicy(policy ReplacementPolicy, seed uint64) error {
+	switch policy {
+	case LRU, FIFO, Random:
+	case PLRU:
+		if c.associativity&(c.associativity-1) != 0 || c.associativity > 64 {
+			return fmt.Errorf("%s pseudo-LRU needs a power-of-two associativity of at most 64, got %d", c.Name, c.associativity)
+		}
+	default:
+		return fmt.Errorf("unsupported replacement policy: %s", policy)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.replacement = policy
+	c.seed = seed | 1 // xorshift sticks at 0
+	c.rng = c.seed
+	c.plru = nil
+	if policy == PLRU {
+		c.plru = make([]uint64, c.numSets)
+	}
+	return nil
+}
+
+// ReplacementPolicy returns how the cache picks a line to evict
+func (c *Cache) ReplacementPolicy() ReplacementPolicy {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.replacement
+}
+
+// Access looks up addr, allocating the line on a miss. It returns whether
+// the access hit and the latency of this cache level.
+func (c *Cache) Access(addr uint64, isWrite bool) (hit bool, latency int) {
+	hit, _ = c.access(addr, isWrite)
+	return hit, c.latency
+}
+
+// access looks up addr, allocating the line on a miss, and returns the line
+// the allocation evicted
+func (c *Cache) access(addr uint64, isWrite bool) (hit bool, evicted eviction) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Write-through lines never hold data the next level lacks
+	dirty := isWrite && c.writePolicy == WriteBack
+
+	c.accessCount++
+	set, tag := c.index(addr)
+	ways := c.sets[set]
+
+	for i := range ways {
+		if ways[i].valid && ways[i].tag == tag {
+			c.touch(set, i)
+			if dirty {
+				ways[i].dirty = true
+			}
+			if ways[i].prefetched {
+				ways[i].prefetched = false
+				c.stats.UsefulPrefetches++
+			}
+			c.stats.Hits++
+			return true, eviction{}
+		}
+	}
+
+	c.stats.Misses++
+
+	victim := c.victim(set)
+	evicted = c.evict(set, victim)
+	ways[victim] = line{
+		tag:    tag,
+		valid:  true,
+		dirty:  dirty,
+		filled: c.accessCount,
+	}
+	c.touch(set, victim)
+
+	return false, evicted
+}
+
+// fill allocates the line containing addr on behalf of the prefetcher,
+// without counting a hit or miss. Unless marked is false, the line counts as
+// prefetched until its first demand hit. It returns false if the line was
+// already cached, and the line the allocation evicted.
+func (c *Cache) fill(addr uint64, marked bool) (filled bool, evicted eviction) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	set, tag := c.index(addr)
+	ways := c.sets[set]
+	for i := range ways {
+		if ways[i].valid && ways[i].tag == tag {
+			return false, eviction{}
+		}
+	}
+
+	c.accessCount++
+	victim := c.victim(set)
+	evicted = c.evict(set, victim)
+	ways[victim] = line{
+		tag:        tag,
+		valid:      true,
+		prefetched: marked,
+		filled:     c.accessCount,
+	}
+	c.touch(set, victim)
+	if marked {
+		c.stats.Prefetches++
+	}
+
+	return true, evicted
+}
+
+// insert places the line containing addr, moved here from another level,
+// without counting a hit or miss, and returns the line it evicted. A line
+// already cached is only marked dirty if dirty is set.
+func (c *Cache) insert(addr uint64, dirty bool) eviction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Write-through lines never hold data the next level lacks
+	dirty = dirty && c.writePolicy == WriteBack
+
+	c.accessCount++
+	set, tag := c.index(addr)
+	ways := c.sets[set]
+	for i := range ways {
+		if ways[i].valid && ways[i].tag == tag {
+			ways[i].dirty = ways[i].dirty || dirty
+			return eviction{}
+		}
+	}
+
+	victim := c.victim(set)
+	evicted := c.evict(set, victim)
+	ways[victim] = line{
+		tag:    tag,
+		valid:  true,
+		dirty:  dirty,
+		filled: c.accessCount,
+	}
+	c.touch(set, victim)
+
+	return evicted
+}
+
+// take looks up addr like access, but removes the line on a hit rather than
+// allocating it on a miss, to move it to another level. It returns whether
+// the line was dirty.
+func (c *Cache) take(addr uint64) (hit, dirty bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	set, tag := c.index(addr)
+	ways := c.sets[set]
+	for i := range ways {
+		if ways[i].valid && ways[i].tag == tag {
+			dirty = ways[i].dirty
+			ways[i] = line{}
+			c.stats.Hits++
+			return true, dirty
+		}
+	}
+
+	c.stats.Misses++
+	return false, false
+}
+
+// remove removes the line containing addr without counting a hit or miss,
+// reporting whether it was present and dirty
+func (c *Cache) remove(addr uint64) (present, dirty bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	set, tag := c.index(addr)
+	ways := c.sets[set]
+	for i := range ways {
+		if ways[i].valid && ways[i].tag == tag {
+			dirty = ways[i].dirty
+			ways[i] = line{}
+			return true, dirty
+		}
+	}
+	return false, false
+}
+
+// evict reports the line in way of set that a fill is about to replace,
+// counting it if dirty
+func (c *Cache) evict(set, way int) eviction {
+	old := c.sets[set][way]
+	if !old.valid {
+		return eviction{}
+	}
+	if old.dirty {
+		c.stats.DirtyEvictions++
+	}
+	return eviction{addr: c.lineAddress(set, old.tag), valid: true, dirty: old.dirty}
+}
+
+// index splits an address into its set index and tag
+func (c *Cache) index(addr uint64) (set int, tag uint64) {
+	lineAddr := addr / uint64(c.lineSize)
+	return int(lineAddr % uint64(c.numSets)), lineAddr / uint64(c.numSets)
+}
+
+// lineAddress returns the address of the line with tag in set
+func (c *Cache) lineAddress(set int, tag uint64) uint64 {
+	return (tag*uint64(c.numSets) + uint64(set)) * uint64(c.lineSize)
+}
+
+// touch records a use of way in set for the replacement policy
+func (c *Cache) touch(set, way int) {
+	c.sets[set][way].lastUsed = c.accessCount
+	if c.replacement != PLRU {
+		return
+	}
+
+	// Walk from the root to the way, pointing each node away from it
+	node := 1
+	for half := c.associativity / 2; half > 0; half /= 2 {
+		bit := uint64(1) << node
+		if way&half == 0 {
+			c.plru[set] |= bit
+			node = 2 * node
+		} else {
+			c.plru[set] &^= bit
+			node = 2*node + 1
+		}
+	}
+}
+
+// victim picks the way of set to replace: the first invalid way, else the
+// one the replacement policy chooses
+func (c *Cache) victim(set int) int {
+	ways := c.sets[set]
+	for i := range ways {
+		if !ways[i].valid {
+			return i
+		}
+	}
+
+	switch c.replacement {
+	case FIFO:
+		oldest := 0
+		for i := range ways {
+			if ways[i].filled < ways[oldest].filled {
+				oldest = i
+			}
+		}
+		return oldest
+	case Random:
+		c.rng ^= c.rng << 13
+		c.rng ^= c.rng >> 7
+		c.rng ^= c.rng << 17
+		return int(c.rng % uint64(len(ways)))
+	case PLRU:
+		node, way := 1, 0
+		for half := c.associativity / 2; half > 0; half /= 2 {
+			if c.plru[set]&(uint64(1)<<node) == 0 {
+				node = 2 * node
+			} else {
+				way += half
+				node = 2*node + 1
+			}
+		}
+		return way
+	}
+
+	lru := 0
+	for i := range ways {
+		if ways[i].lastUsed < ways[lru].lastUsed {
+			lru = i
+		}
+	}
+	return lru
+}
+
+// Contains reports whether addr is currently cached, without updating
+// replacement state or statistics
+func (c *Cache) Contains(addr uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	set, tag := c.index(addr)
+	for _, l := range c.sets[set] {
+		if l.valid && l.tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrefetched reports whether addr is cached in a prefetched line no demand
+// access has hit yet
+func (c *Cache) isPrefetched(addr uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	set, tag := c.index(addr)
+	for _, l := range c.sets[set] {
+		if l.valid && l.tag == tag {
+			return l.prefetched
+		}
+	}
+	return false
+}
+
+// Invalidate removes the line containing addr, reporting whether it was present
+func (c *Cache) Invalidate(addr uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	set, tag := c.index(addr)
+	ways := c.sets[set]
+	for i := range ways {
+		if ways[i].valid && ways[i].tag == tag {
+			ways[i] = line{}
+			return true
+		}
+	}
+	return false
+}
+
+// NumSets returns the number of sets in the cache
+func (c *Cache) NumSets() int {
+	return c.numSets
+}
+
+// Latency returns the access latency of the cache in cycles
+func (c *Cache) Latency() int {
+	return c.latency
+}
+
+// GetStats returns a copy of the cache's counters
+func (c *Cache) GetStats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.stats
+}
+
+// Reset invalidates every line and zeroes the counters
+func (c *Cache) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, ways := range c.sets {
+		for i := range ways {
+			ways[i] = line{}
+		}
+	}
+	clear(c.plru)
+	c.rng = c.seed
+	c.accessCount = 0
+	c.stats = Stats{}
+}
+
+// ResetStats zeroes the counters, keeping the cached lines
+func (c *Cache) ResetStats() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stats = Stats{}
+}
+
+// Snapshot is a copy of a cache's valid lines and counters, for
+// checkpointing
+type Snapshot struct {
+	Lines       []LineSnapshot
+	PLRU        []uint64 // tree bits per set, nil unless the cache is PLRU
+	RNG         uint64
+	AccessCount uint64
+	Stats       Stats
+}
+
+// LineSnapshot is a valid line and its position in the cache
+type LineSnapshot struct {
+	Set        int
+	Way        int
+	Tag        uint64
+	Dirty      bool
+	Prefetched bool
+	LastUsed   uint64
+	Filled     uint64
+}
+
+// Snapshot returns a copy of the cache's state
+func (c *Cache) Snapshot() Snapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	snap := Snapshot{RNG: c.rng, AccessCount: c.accessCount, Stats: c.stats}
+	if c.plru != nil {
+		snap.PLRU = append([]uint64(nil), c.plru...)
+	}
+	for set, ways := range c.sets {
+		for way, l := range ways {
+			if l.valid {
+				snap.Lines = append(snap.Lines, LineSnapshot{
+					Set: set, Way: way, Tag: l.tag, Dirty: l.dirty, Prefetched: l.prefetched,
+					LastUsed: l.lastUsed, Filled: l.filled,
+				})
+			}
+		}
+	}
+	return snap
+}
+
+// Restore replaces the cache's state with snap, which must come from a cache
+// of the same geometry
+func (c *Cache) Restore(snap Snapshot) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, l := range snap.Lines {
+		if l.Set < 0 || l.Set >= c.numSets || l.Way < 0 || l.Way >= c.associativity {
+			return fmt.Errorf("%s snapshot line at set %d way %d is outside the cache", c.Name, l.Set, l.Way)
+		}
+	}
+
+	if len(snap.PLRU) != len(c.plru) {
+		return fmt.Errorf("%s snapshot and cache disagree on pseudo-LRU replacement", c.Name)
+	}
+
+	for _, ways := range c.sets {
+		for i := range ways {
+			ways[i] = line{}
+		}
+	}
+
+	for _, l := range snap.Lines {
+		c.sets[l.Set][l.Way] = line{
+			tag: l.Tag, valid: true, dirty: l.Dirty, prefetched: l.Prefetched, lastUsed: l.LastUsed, filled: l.Filled,
+		}
+	}
+	copy(c.plru, snap.PLRU)
+	c.rng = snap.RNG
+	c.accessCount = snap.AccessCount
+	c.stats = snap.Stats
+
+	return nil
+}
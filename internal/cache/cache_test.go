@@ -0,0 +1,773 @@
+package cache
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/jasonKoogler/cpu-sim/internal/config"
+)
+
+func TestNewCache(t *testing.T) {
+	tests := []struct {
+		name          string
+		sizeKB        int
+		associativity int
+		lineSize      int
+		wantErr       bool
+		wantSets      int
+	}{
+		{name: "32KB 8-way", sizeKB: 32, associativity: 8, lineSize: 64, wantErr: false, wantSets: 64},
+		{name: "Direct-mapped", sizeKB: 1, associativity: 1, lineSize: 64, wantErr: false, wantSets: 16},
+		{name: "Size not a multiple of the line size", sizeKB: 1, associativity: 1, lineSize: 96, wantErr: false, wantSets: 10},
+		{name: "Lines not a multiple of the ways", sizeKB: 1, associativity: 3, lineSize: 64, wantErr: false, wantSets: 5},
+		{name: "Zero size", sizeKB: 0, associativity: 8, lineSize: 64, wantErr: true},
+		{name: "Zero associativity", sizeKB: 32, associativity: 0, lineSize: 64, wantErr: true},
+		{name: "Too small for one set", sizeKB: 1, associativity: 32, lineSize: 64, wantErr: true},
+		{name: "Fully associative", sizeKB: 1, associativity: FullyAssociative, lineSize: 64, wantErr: false, wantSets: 1},
+		{name: "Negative associativity", sizeKB: 1, associativity: -2, lineSize: 64, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCache("L1", tt.sizeKB, tt.associativity, 3, tt.lineSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCache() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if c.NumSets() != tt.wantSets {
+				t.Errorf("NewCache() sets = %d, want %d", c.NumSets(), tt.wantSets)
+			}
+		})
+	}
+}
+
+func TestCacheAssociativity(t *testing.T) {
+	// Lines 1 KB apart all map to set 0 of a 1 KB cache of 64-byte lines,
+	// whether it has 16 direct-mapped sets or 4 sets of 4 ways
+	conflicting := func(lines int) []uint64 {
+		var trace []uint64
+		for pass := 0; pass < 3; pass++ {
+			for i := 0; i < lines; i++ {
+				trace = append(trace, uint64(i)*0x400)
+			}
+		}
+		return trace
+	}
+
+	tests := []struct {
+		name          string
+		trace         []uint64
+		associativity int
+		wantHits      int64
+	}{
+		// Four lines fit a set of 4 ways but keep evicting each other from
+		// a single direct-mapped way
+		{name: "4 lines direct-mapped", trace: conflicting(4), associativity: 1, wantHits: 0},
+		{name: "4 lines 4-way", trace: conflicting(4), associativity: 4, wantHits: 8},
+		{name: "4 lines fully associative", trace: conflicting(4), associativity: FullyAssociative, wantHits: 8},
+
+		// Eight lines overflow a 4-way set, only a single set of every line
+		// holds them all
+		{name: "8 lines direct-mapped", trace: conflicting(8), associativity: 1, wantHits: 0},
+		{name: "8 lines 4-way", trace: conflicting(8), associativity: 4, wantHits: 0},
+		{name: "8 lines fully associative", trace: conflicting(8), associativity: FullyAssociative, wantHits: 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCache("L1", 1, tt.associativity, 3, 64)
+			if err != nil {
+				t.Fatalf("NewCache() error = %v", err)
+			}
+
+			for _, addr := range tt.trace {
+				c.Access(addr, false)
+			}
+
+			stats := c.GetStats()
+			if stats.Hits != tt.wantHits || stats.Hits+stats.Misses != int64(len(tt.trace)) {
+				t.Errorf("%d hits and %d misses, want %d hits of %d accesses",
+					stats.Hits, stats.Misses, tt.wantHits, len(tt.trace))
+			}
+		})
+	}
+}
+
+func TestCacheAccess(t *testing.T) {
+	c, _ := NewCache("L1", 1, 2, 3, 64)
+
+	hit, latency := c.Access(0x1000, false)
+	if hit {
+		t.Errorf("First access hit, want miss")
+	}
+
+	if latency != 3 {
+		t.Errorf("Access() latency = %d, want 3", latency)
+	}
+
+	// Any address in the same line hits
+	if hit, _ := c.Access(0x1000+63, false); !hit {
+		t.Errorf("Access within the same line missed, want hit")
+	}
+
+	// The next line is a separate miss
+	if hit, _ := c.Access(0x1000+64, false); hit {
+		t.Errorf("Access to the next line hit, want miss")
+	}
+
+	stats := c.GetStats()
+	if stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("Stats = %+v, want 1 hit and 2 misses", stats)
+	}
+}
+
+func TestCacheLRUReplacement(t *testing.T) {
+	// 1 KB, 2-way, 64-byte lines: 8 sets, addresses 512 bytes apart share a set
+	c, _ := NewCache("L1", 1, 2, 3, 64)
+	stride := uint64(c.NumSets() * 64)
+
+	a, b, d := uint64(0), stride, 2*stride
+
+	c.Access(a, false)
+	c.Access(b, false)
+	c.Access(a, false) // b is now least recently used
+	c.Access(d, false) // evicts b
+
+	if !c.Contains(a) {
+		t.Errorf("Most recently used line was evicted")
+	}
+
+	if c.Contains(b) {
+		t.Errorf("Least recently used line was not evicted")
+	}
+
+	if !c.Contains(d) {
+		t.Errorf("Newly allocated line is missing")
+	}
+}
+
+func TestCacheReplacementPolicy(t *testing.T) {
+	// 1 KB, 4-way, 64-byte lines: 4 sets, addresses 256 bytes apart share a set
+	newCache := func(policy ReplacementPolicy, seed uint64) *Cache {
+		c, _ := NewCache("L1", 1, 4, 3, 64)
+		if err := c.SetReplacementPolicy(policy, seed); err != nil {
+			t.Fatalf("SetReplacementPolicy(%s) error = %v", policy, err)
+		}
+		return c
+	}
+	stride := uint64(4 * 64)
+	lines := []uint64{0, stride, 2 * stride, 3 * stride} // A, B, C, D in ways 0-3
+
+	// Fill the set, reuse B, A and C, then miss: D was used longest ago, A
+	// filled first, and the tree last pointed away from B's half last
+	tests := []struct {
+		policy  ReplacementPolicy
+		evicted uint64
+	}{
+		{policy: LRU, evicted: lines[3]},
+		{policy: FIFO, evicted: lines[0]},
+		{policy: PLRU, evicted: lines[1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			c := newCache(tt.policy, 1)
+			for _, addr := range append(lines, lines[1], lines[0], lines[2]) {
+				c.Access(addr, false)
+			}
+			c.Access(4*stride, false)
+
+			for _, addr := range lines {
+				if got, want := c.Contains(addr), addr != tt.evicted; got != want {
+					t.Errorf("Contains(%#x) = %v, want %v", addr, got, want)
+				}
+			}
+		})
+	}
+
+	// The same seed picks the same random victims
+	evictions := func(seed uint64) []bool {
+		c := newCache(Random, seed)
+		var present []bool
+		for i := uint64(0); i < 64; i++ {
+			c.Access(i%9*stride, false)
+			for _, addr := range lines {
+				present = append(present, c.Contains(addr))
+			}
+		}
+		return present
+	}
+	if !reflect.DeepEqual(evictions(7), evictions(7)) {
+		t.Error("Random replacement with the same seed evicted different lines")
+	}
+
+	// Pseudo-LRU tree bits survive a checkpoint, and need a PLRU cache
+	plru := newCache(PLRU, 1)
+	for _, addr := range lines[:3] {
+		plru.Access(addr, false)
+	}
+	restored := newCache(PLRU, 1)
+	if err := restored.Restore(plru.Snapshot()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !reflect.DeepEqual(restored.Snapshot(), plru.Snapshot()) {
+		t.Errorf("Restored PLRU cache snapshot differs from the original")
+	}
+	if err := newCache(LRU, 1).Restore(plru.Snapshot()); err == nil {
+		t.Error("Restore() of a PLRU snapshot into an LRU cache should return error")
+	}
+
+	c, _ := NewCache("L1", 3, 3, 3, 64)
+	if err := c.SetReplacementPolicy(PLRU, 1); err == nil {
+		t.Error("SetReplacementPolicy(plru) on a 3-way cache should return error")
+	}
+
+	if err := c.SetReplacementPolicy("mru", 1); err == nil {
+		t.Error("SetReplacementPolicy() with an unknown policy should return error")
+	}
+}
+
+func TestCacheReset(t *testing.T) {
+	c, _ := NewCache("L1", 1, 2, 3, 64)
+	c.Access(0x1000, false)
+	c.Reset()
+
+	if c.Contains(0x1000) {
+		t.Errorf("Line still present after Reset()")
+	}
+
+	if stats := c.GetStats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Stats = %+v after Reset(), want zero", stats)
+	}
+}
+
+func TestCacheResetStats(t *testing.T) {
+	c, _ := NewCache("L1", 1, 2, 3, 64)
+	c.Access(0x1000, false)
+	c.ResetStats()
+
+	if stats := c.GetStats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Stats = %+v after ResetStats(), want zero", stats)
+	}
+
+	// The line stays cached, so the next access hits
+	if hit, _ := c.Access(0x1000, false); !hit {
+		t.Errorf("Access() after ResetStats() missed, want a hit")
+	}
+}
+
+func TestHierarchyAccess(t *testing.T) {
+	cfg := config.DefaultConfig()
+	h, err := NewHierarchy(cfg)
+	if err != nil {
+		t.Fatalf("NewHierarchy() error = %v", err)
+	}
+
+	if len(h.Levels) != 3 {
+		t.Fatalf("NewHierarchy() levels = %d, want 3", len(h.Levels))
+	}
+
+	// Cold miss goes all the way to memory
+	latency, level := h.Access(0x4000, false)
+	if level != len(h.Levels) || latency != cfg.MemoryLatency {
+		t.Errorf("Cold access served by level %d in %d cycles, want memory in %d",
+			level, latency, cfg.MemoryLatency)
+	}
+
+	// The fill leaves the line in every level, so the next access hits L1
+	latency, level = h.Access(0x4000, false)
+	if level != 0 || latency != cfg.L1Latency {
+		t.Errorf("Warm access served by level %d in %d cycles, want L1 in %d",
+			level, latency, cfg.L1Latency)
+	}
+
+	if h.Accesses() != 2 || h.CacheHits() != 1 {
+		t.Errorf("Accesses = %d, CacheHits = %d, want 2 and 1", h.Accesses(), h.CacheHits())
+	}
+
+	if h.HitRate() != 0.5 {
+		t.Errorf("HitRate() = %f, want 0.5", h.HitRate())
+	}
+}
+
+func TestHierarchySharedL3(t *testing.T) {
+	cfg := config.DefaultConfig()
+	l3, _ := NewCache("L3", cfg.L3Size, cfg.L3Associativity, cfg.L3Latency, cfg.LineSize())
+
+	a, _ := NewHierarchy(cfg)
+	b, _ := NewHierarchy(cfg)
+	for _, h := range []*Hierarchy{a, b} {
+		if err := h.SetSharedL3(l3); err != nil {
+			t.Fatalf("SetSharedL3() error = %v", err)
+		}
+	}
+
+	// A line one core fetched from memory is an L3 hit for the other
+	a.Access(0x4000, false)
+	if latency, level := b.Access(0x4000, false); level != 2 || latency != cfg.L3Latency {
+		t.Errorf("Other core's access served by level %d in %d cycles, want L3 in %d", level, latency, cfg.L3Latency)
+	}
+
+	// Holds only reports a line in one of the core's own levels
+	if latency, ok := a.Holds(0x4000); !ok || latency != cfg.L1Latency {
+		t.Errorf("Holds() = %d, %v, want L1 latency %d, true", latency, ok, cfg.L1Latency)
+	}
+	b.Invalidate(0x4000)
+	if _, ok := b.Holds(0x4000); ok {
+		t.Errorf("Holds() of a line only in the shared L3 = true, want false")
+	}
+
+	// Invalidating and resetting one core's caches leaves the shared copy
+	a.Invalidate(0x4000)
+	a.Reset()
+	if !l3.Contains(0x4000) {
+		t.Errorf("Shared L3 lost the line after one core's Invalidate() and Reset()")
+	}
+	if latency, level := a.Access(0x4000, false); level != 2 || latency != cfg.L3Latency {
+		t.Errorf("Access after Reset() served by level %d in %d cycles, want L3 in %d", level, latency, cfg.L3Latency)
+	}
+
+	// The shared level is left out of each core's snapshot
+	if snap := a.Snapshot(); len(snap.Levels[2].Lines) != 0 {
+		t.Errorf("Snapshot() holds %d shared L3 lines, want 0", len(snap.Levels[2].Lines))
+	}
+
+	other, _ := NewCache("L3", cfg.L3Size, cfg.L3Associativity, cfg.L3Latency, 128)
+	if err := a.SetSharedL3(other); err == nil {
+		t.Errorf("SetSharedL3() with a different line size error = nil, want error")
+	}
+	if err := a.SetSharedL3(nil); err == nil {
+		t.Errorf("SetSharedL3(nil) error = nil, want error")
+	}
+}
+
+func TestHierarchyL2Hit(t *testing.T) {
+	cfg := config.DefaultConfig()
+	h, _ := NewHierarchy(cfg)
+
+	h.Access(0x4000, false)
+
+	// Evict the line from L1 only by filling its set with conflicting lines
+	l1 := h.Levels[0]
+	stride := uint64(l1.NumSets() * DefaultLineSize)
+	for i := 1; i <= cfg.L1Associativity; i++ {
+		h.Access(0x4000+uint64(i)*stride, false)
+	}
+
+	latency, level := h.Access(0x4000, false)
+	if level != 1 || latency != cfg.L2Latency {
+		t.Errorf("Access after L1 eviction served by level %d in %d cycles, want L2 in %d",
+			level, latency, cfg.L2Latency)
+	}
+}
+
+func TestHierarchyLineSize(t *testing.T) {
+	// A direct-mapped 1 KB L1, so larger lines mean fewer sets
+	tests := []struct {
+		name     string
+		lineSize int
+		addrs    []uint64
+		wantHits []bool // L1 hit for each access
+	}{
+		{
+			name:     "32-byte lines, within and across a boundary",
+			lineSize: 32,
+			addrs:    []uint64{0, 16, 31, 32, 63, 64},
+			wantHits: []bool{false, true, true, false, true, false},
+		},
+		{
+			name:     "128-byte lines, within and across a boundary",
+			lineSize: 128,
+			addrs:    []uint64{0, 32, 64, 127, 128, 255},
+			wantHits: []bool{false, true, true, true, false, true},
+		},
+		{
+			name:     "32-byte lines keep 0x0 and 0x440 in different sets",
+			lineSize: 32,
+			addrs:    []uint64{0, 0x440, 0},
+			wantHits: []bool{false, false, true},
+		},
+		{
+			name:     "128-byte lines map 0x0 and 0x440 to the same set",
+			lineSize: 128,
+			addrs:    []uint64{0, 0x440, 0},
+			wantHits: []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.CacheLineSize = tt.lineSize
+			cfg.L1Size = 1
+			cfg.L1Associativity = 1
+			h, err := NewHierarchy(cfg)
+			if err != nil {
+				t.Fatalf("NewHierarchy() error = %v", err)
+			}
+
+			if h.LineSize() != tt.lineSize {
+				t.Errorf("LineSize() = %d, want %d", h.LineSize(), tt.lineSize)
+			}
+
+			for i, addr := range tt.addrs {
+				_, level := h.Access(addr, false)
+				if hit := level == 0; hit != tt.wantHits[i] {
+					t.Errorf("access %d to %#x: L1 hit = %v, want %v", i, addr, hit, tt.wantHits[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	c, _ := NewCache("L1", 1, 2, 3, 64)
+	for _, addr := range []uint64{0x0, 0x400, 0x800, 0x40} {
+		c.Access(addr, addr == 0x400)
+	}
+
+	restored, _ := NewCache("L1", 1, 2, 3, 64)
+	if err := restored.Restore(c.Snapshot()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	if restored.GetStats() != c.GetStats() {
+		t.Errorf("Restored stats = %+v, want %+v", restored.GetStats(), c.GetStats())
+	}
+
+	// LRU order survives, so both evict the same line next
+	c.Access(0xC00, false)
+	restored.Access(0xC00, false)
+	for _, addr := range []uint64{0x0, 0x400, 0x800, 0xC00, 0x40} {
+		if restored.Contains(addr) != c.Contains(addr) {
+			t.Errorf("Contains(%#x) = %v after restoring, want %v", addr, restored.Contains(addr), c.Contains(addr))
+		}
+	}
+
+	smaller, _ := NewCache("L1", 1, 1, 3, 64)
+	if err := smaller.Restore(c.Snapshot()); err == nil {
+		t.Errorf("Restore() into a cache with fewer ways should return error")
+	}
+}
+
+func TestCacheImage(t *testing.T) {
+	warm, _ := NewCache("L2", 1, 2, 10, 64)
+	working := []uint64{0x0, 0x400, 0x40, 0x840}
+	for _, addr := range working {
+		warm.Access(addr, false)
+	}
+
+	var buf bytes.Buffer
+	if err := warm.SaveImage(&buf); err != nil {
+		t.Fatalf("SaveImage() error = %v", err)
+	}
+	saved := buf.Bytes()
+
+	// The working set hits in a fresh cache loaded with the image, which
+	// counts only the accesses it has served itself
+	fresh, _ := NewCache("L2", 1, 2, 10, 64)
+	if err := fresh.LoadImage(bytes.NewReader(saved)); err != nil {
+		t.Fatalf("LoadImage() error = %v", err)
+	}
+	if got := fresh.GetStats(); got != (Stats{}) {
+		t.Errorf("Stats after LoadImage() = %+v, want zero", got)
+	}
+	for _, addr := range working {
+		if hit, _ := fresh.Access(addr, false); !hit {
+			t.Errorf("Access(%#x) missed after LoadImage(), want a hit", addr)
+		}
+	}
+
+	// Recency comes along too, so both evict the same line next
+	warm.Access(0xC00, false)
+	fresh.Access(0xC00, false)
+	for _, addr := range append(working, 0xC00) {
+		if fresh.Contains(addr) != warm.Contains(addr) {
+			t.Errorf("Contains(%#x) = %v after loading the image, want %v", addr, fresh.Contains(addr), warm.Contains(addr))
+		}
+	}
+
+	tests := []struct {
+		name  string
+		cache func() *Cache
+	}{
+		{name: "Fewer ways", cache: func() *Cache { c, _ := NewCache("L2", 1, 1, 10, 64); return c }},
+		{name: "Longer lines", cache: func() *Cache { c, _ := NewCache("L2", 1, 2, 10, 128); return c }},
+		{name: "More sets", cache: func() *Cache { c, _ := NewCache("L2", 2, 2, 10, 64); return c }},
+	}
+	for _, tt := range tests {
+		if err := tt.cache().LoadImage(bytes.NewReader(saved)); err == nil {
+			t.Errorf("%s: LoadImage() should return error", tt.name)
+		}
+	}
+
+	if err := fresh.LoadImage(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Errorf("LoadImage() of garbage should return error")
+	}
+}
+
+func TestCacheWritePolicy(t *testing.T) {
+	// 1 KB direct-mapped: addresses 1 KB apart share a set
+	for _, policy := range []WritePolicy{WriteBack, WriteThrough} {
+		c, _ := NewCache("L1", 1, 1, 3, 64)
+		if err := c.SetWritePolicy(policy); err != nil {
+			t.Fatalf("SetWritePolicy(%s) error = %v", policy, err)
+		}
+
+		c.Access(0x1040, true)
+		_, evicted := c.access(0x1040+1024, false)
+		victim, dirty := evicted.addr, evicted.dirty
+
+		wantEvictions := int64(0)
+		if policy == WriteBack {
+			wantEvictions = 1
+			if !dirty || victim != 0x1040 {
+				t.Errorf("%s: evicted line %#x dirty %v, want 0x1040 dirty", policy, victim, dirty)
+			}
+		} else if dirty {
+			t.Errorf("%s: evicted a dirty line", policy)
+		}
+
+		if got := c.GetStats().DirtyEvictions; got != wantEvictions {
+			t.Errorf("%s: DirtyEvictions = %d, want %d", policy, got, wantEvictions)
+		}
+	}
+
+	c, _ := NewCache("L1", 1, 1, 3, 64)
+	if err := c.SetWritePolicy("write-around"); err == nil {
+		t.Errorf("SetWritePolicy() with an unknown policy should return error")
+	}
+}
+
+func TestHierarchyWritePolicy(t *testing.T) {
+	tests := []struct {
+		name             string
+		l1, l2           string
+		store            bool
+		wantEvictions    int64
+		wantMemoryWrites int64
+	}{
+		{name: "Loads only", l1: "write-back", l2: "write-back", store: false},
+		{name: "Write-back", l1: "write-back", l2: "write-back", store: true, wantEvictions: 3, wantMemoryWrites: 1},
+		{name: "Write-through L1", l1: "write-through", l2: "write-back", store: true, wantEvictions: 2, wantMemoryWrites: 1},
+		{name: "Write-through L1 and L2", l1: "write-through", l2: "write-through", store: true, wantEvictions: 1, wantMemoryWrites: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Direct-mapped levels of 1, 2 and 4 KB: addresses 4 KB apart
+			// conflict at every level
+			cfg := config.DefaultConfig()
+			cfg.L1Size, cfg.L1Associativity, cfg.L1WritePolicy = 1, 1, tt.l1
+			cfg.L2Size, cfg.L2Associativity, cfg.L2WritePolicy = 2, 1, tt.l2
+			cfg.L3Size, cfg.L3Associativity = 4, 1
+
+			h, err := NewHierarchy(cfg)
+			if err != nil {
+				t.Fatalf("NewHierarchy() error = %v", err)
+			}
+
+			// A second store hits L1 and must not change the outcome
+			h.Access(0x1000, tt.store)
+			h.Access(0x1000, tt.store)
+			h.Access(0x1000+4096, false)
+
+			if got := h.DirtyEvictions(); got != tt.wantEvictions {
+				t.Errorf("DirtyEvictions() = %d, want %d", got, tt.wantEvictions)
+			}
+
+			if got := h.MemoryWrites(); got != tt.wantMemoryWrites {
+				t.Errorf("MemoryWrites() = %d, want %d", got, tt.wantMemoryWrites)
+			}
+		})
+	}
+
+	// Write-through levels never hold dirty lines
+	cfg := config.DefaultConfig()
+	cfg.L1WritePolicy = "write-through"
+	h, _ := NewHierarchy(cfg)
+	h.Access(0x2000, true)
+	h.Access(0x2000, true)
+
+	if snap := h.Levels[0].Snapshot(); len(snap.Lines) != 1 || snap.Lines[0].Dirty {
+		t.Errorf("Write-through L1 lines = %+v, want one clean line", snap.Lines)
+	}
+	if snap := h.Levels[1].Snapshot(); len(snap.Lines) != 1 || !snap.Lines[0].Dirty {
+		t.Errorf("L2 lines = %+v, want one dirty line", snap.Lines)
+	}
+}
+
+func TestHierarchyPrefetch(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         PrefetchPolicy
+		lines          []uint64 // line numbers accessed in order
+		wantPrefetches int64
+		wantUseful     int64
+		wantL1Hits     int64
+	}{
+		{name: "None", policy: PrefetchNone, lines: []uint64{0, 1, 2, 3}},
+		// Each miss or hit on a prefetched line fetches the next line
+		{name: "Next-line", policy: PrefetchNextLine, lines: []uint64{0, 1, 2, 3}, wantPrefetches: 4, wantUseful: 3, wantL1Hits: 3},
+		// Misses on 0, 2 and 4 establish the stride; from then on every
+		// access hits a prefetched line and runs one stride ahead
+		{name: "Stride", policy: PrefetchStride, lines: []uint64{0, 2, 4, 6, 8, 10}, wantPrefetches: 4, wantUseful: 3, wantL1Hits: 3},
+		{name: "Stride without a pattern", policy: PrefetchStride, lines: []uint64{0, 3, 4, 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.PrefetchPolicy = string(tt.policy)
+			h, err := NewHierarchy(cfg)
+			if err != nil {
+				t.Fatalf("NewHierarchy() error = %v", err)
+			}
+
+			for _, line := range tt.lines {
+				h.Access(line*DefaultLineSize, false)
+			}
+
+			issued, useful := h.Prefetches()
+			if issued != tt.wantPrefetches || useful != tt.wantUseful {
+				t.Errorf("Prefetches() = %d, %d useful, want %d, %d useful", issued, useful, tt.wantPrefetches, tt.wantUseful)
+			}
+
+			if got := h.Levels[0].GetStats().Hits; got != tt.wantL1Hits {
+				t.Errorf("L1 hits = %d, want %d", got, tt.wantL1Hits)
+			}
+
+			// Every prefetched line was cold, so each came from memory
+			if got := h.PrefetchFills(); got != tt.wantPrefetches {
+				t.Errorf("PrefetchFills() = %d, want %d", got, tt.wantPrefetches)
+			}
+
+			h.Reset()
+			if issued, _ := h.Prefetches(); issued != 0 || h.PrefetchFills() != 0 {
+				t.Errorf("Reset() did not clear the prefetch counters")
+			}
+		})
+	}
+
+	// A line already in L2 is prefetched from there, not from memory
+	cfg := config.DefaultConfig()
+	cfg.PrefetchPolicy = "next-line"
+	h, _ := NewHierarchy(cfg)
+	h.Levels[1].Access(DefaultLineSize, false)
+	h.Access(0, false)
+	if issued, _ := h.Prefetches(); issued != 1 || h.PrefetchFills() != 0 {
+		t.Errorf("Prefetch from L2: %d prefetches, %d memory fills, want 1 and 0", issued, h.PrefetchFills())
+	}
+
+	if err := h.SetPrefetchPolicy("previous-line"); err == nil {
+		t.Errorf("SetPrefetchPolicy() with an unsupported policy should return error")
+	}
+}
+
+func TestHierarchyInclusion(t *testing.T) {
+	// Fully associative LRU levels of 16, 32 and 64 lines
+	newHierarchy := func(policy InclusionPolicy) *Hierarchy {
+		cfg := config.DefaultConfig()
+		cfg.L1Size, cfg.L1Associativity = 1, FullyAssociative
+		cfg.L2Size, cfg.L2Associativity = 2, FullyAssociative
+		cfg.L3Size, cfg.L3Associativity = 4, FullyAssociative
+		cfg.CacheInclusionPolicy = string(policy)
+
+		h, err := NewHierarchy(cfg)
+		if err != nil {
+			t.Fatalf("NewHierarchy() error = %v", err)
+		}
+		return h
+	}
+
+	// Looping over 96 lines overflows the 64-line L3, so only the exclusive
+	// hierarchy, holding 112 distinct lines, keeps the loop cached. A hot
+	// line hits in L1 throughout, ageing out of an inclusive L3 that never
+	// sees it used.
+	hitRates := make(map[InclusionPolicy]float64)
+	backInvalidations := make(map[InclusionPolicy]int64)
+	for _, policy := range []InclusionPolicy{Inclusive, Exclusive, NINE} {
+		h := newHierarchy(policy)
+		for pass := 0; pass < 10; pass++ {
+			for line := uint64(0); line < 96; line++ {
+				h.Access(line*DefaultLineSize, false)
+				h.Access(1000*DefaultLineSize, false)
+			}
+		}
+		hitRates[policy] = h.HitRate()
+		backInvalidations[policy] = h.BackInvalidations()
+	}
+
+	if hitRates[Exclusive] <= hitRates[Inclusive] || hitRates[Exclusive] <= hitRates[NINE] {
+		t.Errorf("Hit rates = %v, want exclusive highest", hitRates)
+	}
+	if backInvalidations[Inclusive] == 0 || backInvalidations[Exclusive] != 0 || backInvalidations[NINE] != 0 {
+		t.Errorf("BackInvalidations() = %v, want some for inclusive only", backInvalidations)
+	}
+
+	lines := func(c *Cache) map[uint64]bool {
+		addrs := make(map[uint64]bool)
+		for _, l := range c.Snapshot().Lines {
+			addrs[c.lineAddress(l.Set, l.Tag)] = true
+		}
+		return addrs
+	}
+
+	// Loads and stores scattered over 200 lines, prefetching as they go
+	for _, policy := range []InclusionPolicy{Inclusive, Exclusive} {
+		h := newHierarchy(policy)
+		if err := h.SetPrefetchPolicy(PrefetchNextLine); err != nil {
+			t.Fatalf("SetPrefetchPolicy() error = %v", err)
+		}
+		seed := uint64(1)
+		for i := 0; i < 5000; i++ {
+			seed = seed*6364136223846793005 + 1442695040888963407
+			h.Access((seed>>33)%200*DefaultLineSize, seed&1 == 0)
+		}
+
+		l1, l2, l3 := lines(h.Levels[0]), lines(h.Levels[1]), lines(h.Levels[2])
+		for addr := range l1 {
+			if policy == Inclusive && (!l2[addr] || !l3[addr]) {
+				t.Errorf("Inclusive L1 line %#x missing from a lower level", addr)
+			}
+			if policy == Exclusive && (l2[addr] || l3[addr]) {
+				t.Errorf("Exclusive L1 line %#x also in a lower level", addr)
+			}
+		}
+		for addr := range l2 {
+			if policy == Inclusive && !l3[addr] {
+				t.Errorf("Inclusive L2 line %#x missing from L3", addr)
+			}
+			if policy == Exclusive && l3[addr] {
+				t.Errorf("Exclusive L2 line %#x also in L3", addr)
+			}
+		}
+	}
+
+	// A dirty line keeps its data as it moves down an exclusive hierarchy
+	// and back up, reaching memory only when it leaves L3
+	h := newHierarchy(Exclusive)
+	h.Access(0, true)
+	for line := uint64(1); line <= 100; line++ {
+		h.Access(line*DefaultLineSize, false)
+	}
+	if latency, level := h.Access(0, false); level != 2 || latency != h.Levels[2].Latency() {
+		t.Errorf("Access() of a demoted line served by level %d, want L3", level)
+	}
+	if snap := h.Levels[0].Snapshot(); !slices.ContainsFunc(snap.Lines, func(l LineSnapshot) bool { return l.Tag == 0 && l.Dirty }) {
+		t.Errorf("Line moved back to L1 lost its dirty data")
+	}
+	if got := h.MemoryWrites(); got != 0 {
+		t.Errorf("MemoryWrites() = %d, want 0", got)
+	}
+
+	if err := h.SetInclusionPolicy("non-inclusive"); err == nil {
+		t.Errorf("SetInclusionPolicy() with an unsupported policy should return error")
+	}
+}
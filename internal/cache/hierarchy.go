@@ -0,0 +1,501 @@
+package cache
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jasonKoogler/cpu-sim/internal/config"
+)
+
+// Hierarchy is a chain of cache levels backed by main memory
+type Hierarchy struct {
+	Levels        []*Cache // L1 first
+	memoryLatency int
+	lineSize      int // bytes, shared by every level
+	accesses      int64
+	memoryHits    int64       // accesses that missed every level
+	memoryWrites  int64       // dirty evictions and write-through stores that reached memory
+	prefetcher    *prefetcher // nil if prefetching is disabled
+	prefetchFills int64       // prefetched lines fetched from memory
+	shared        *Cache      // last level when other cores' hierarchies share it, nil if private
+	inclusion     InclusionPolicy
+	backInvals    int64 // lines removed from upper levels to keep them inclusive
+}
+
+// NewHierarchy builds an L1 -> L2 -> L3 -> memory hierarchy from the config
+func NewHierarchy(cfg *config.Config) (*Hierarchy, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("nil configuration provided")
+	}
+
+	levels := []struct {
+		name                 string
+		size, assoc, latency int
+		policy               string
+	}{
+		{"L1", cfg.L1Size, cfg.L1Associativity, cfg.L1Latency, cfg.L1WritePolicy},
+		{"L2", cfg.L2Size, cfg.L2Associativity, cfg.L2Latency, cfg.L2WritePolicy},
+		{"L3", cfg.L3Size, cfg.L3Associativity, cfg.L3Latency, ""},
+	}
+
+	h := &Hierarchy{
+		Levels:        make([]*Cache, 0, len(levels)),
+		memoryLatency: cfg.MemoryLatency,
+		lineSize:      cfg.LineSize(),
+		inclusion:     NINE,
+	}
+
+	for i, l := range levels {
+		c, err := NewCache(l.name, l.size, l.assoc, l.latency, h.lineSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s cache: %w", l.name, err)
+		}
+		if l.policy != "" {
+			if err := c.SetWritePolicy(WritePolicy(l.policy)); err != nil {
+				return nil, fmt.Errorf("failed to create %s cache: %w", l.name, err)
+			}
+		}
+		if cfg.ReplacementPolicy != "" {
+			if err := c.SetReplacementPolicy(ReplacementPolicy(cfg.ReplacementPolicy), uint64(cfg.RandSeed)+uint64(i)); err != nil {
+				return nil, fmt.Errorf("failed to create %s cache: %w", l.name, err)
+			}
+		}
+		h.Levels = append(h.Levels, c)
+	}
+
+	if cfg.CacheInclusionPolicy != "" {
+		if err := h.SetInclusionPolicy(InclusionPolicy(cfg.CacheInclusionPolicy)); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.PrefetchPolicy != "" {
+		if err := h.SetPrefetchPolicy(PrefetchPolicy(cfg.PrefetchPolicy)); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// SetSharedL3 replaces the private L3 with l3, which other cores'
+// hierarchies share. The owner of l3 resets, snapshots and counts it once
+// for all of them; this hierarchy's Reset, Snapshot and DirtyEvictions cover
+// only its private levels.
+func (h *Hierarchy) SetSharedL3(l3 *Cache) error {
+	if l3 == nil {
+		return fmt.Errorf("nil shared L3 cache")
+	}
+
+	if l3.lineSize != h.lineSize {
+		return fmt.Errorf("shared L3 line size %d does not match the hierarchy's %d", l3.lineSize, h.lineSize)
+	}
+
+	h.Levels[len(h.Levels)-1] = l3
+	h.shared = l3
+	return nil
+}
+
+// private reports whether c belongs to this hierarchy alone
+func (h *Hierarchy) private(c *Cache) bool {
+	return c != h.shared
+}
+
+// LineSize returns the line size of every level in bytes
+func (h *Hierarchy) LineSize() int {
+	return h.lineSize
+}
+
+// SetPrefetchPolicy sets what is prefetched into L1 after an L1 miss or the
+// first demand hit on a prefetched line. Hierarchies start out with
+// prefetching disabled.
+func (h *Hierarchy) SetPrefetchPolicy(policy PrefetchPolicy) error {
+	pf, err := newPrefetcher(policy, h.lineSize)
+	if err != nil {
+		return err
+	}
+
+	h.prefetcher = nil
+	if policy != PrefetchNone {
+		h.prefetcher = pf
+	}
+	return nil
+}
+
+// SetInclusionPolicy sets whether the levels keep copies of the lines above
+// them. Hierarchies start out NINE. Under the inclusive policy a shared L3
+// evicting a line removes it only from this hierarchy's levels, not from the
+// other cores sharing it.
+func (h *Hierarchy) SetInclusionPolicy(policy InclusionPolicy) error {
+	switch policy {
+	case Inclusive, Exclusive, NINE:
+	default:
+		return fmt.Errorf("unsupported cache inclusion policy: %s", policy)
+	}
+
+	h.inclusion = policy
+	return nil
+}
+
+// InclusionPolicy returns whether the levels keep copies of the lines above
+// them
+func (h *Hierarchy) InclusionPolicy() InclusionPolicy {
+	return h.inclusion
+}
+
+// Access looks addr up level by level. It returns the latency of the level
+// that served the access (the memory latency if every level missed) and that
+// level's index, where len(h.Levels) means main memory.
+//
+// Unless the hierarchy is exclusive, every level that missed is filled. A
+// store dirties the first write-back level it reaches; write-through levels
+// pass it on to the level below. Dirty lines evicted by a fill are written
+// to the next level down, and under the inclusive policy any line a level
+// evicts is removed from the levels above it.
+//
+// An exclusive hierarchy fills only L1, moving the line there from the
+// level that hit, and moves each line a level evicts to the next level
+// down. Stores to a write-through L1 go straight to memory.
+//
+// After an L1 miss, or the first hit on a prefetched line, the prefetcher
+// may bring another line into L1.
+func (h *Hierarchy) Access(addr uint64, isWrite bool) (latency int, level int) {
+	atomic.AddInt64(&h.accesses, 1)
+
+	prefetched := h.prefetcher != nil && h.Levels[0].isPrefetched(addr)
+
+	if h.inclusion == Exclusive {
+		level = h.accessExclusive(addr, isWrite)
+	} else {
+		level = h.accessFill(addr, isWrite)
+	}
+
+	if h.prefetcher != nil && (level > 0 || prefetched) {
+		if target, ok := h.prefetcher.trigger(addr); ok {
+			h.prefetch(target)
+		}
+	}
+
+	if level == len(h.Levels) {
+		atomic.AddInt64(&h.memoryHits, 1)
+		return h.memoryLatency, level
+	}
+	return h.Levels[level].Latency(), level
+}
+
+// accessFill looks addr up level by level, filling every level that missed,
+// and returns the index of the level that hit
+func (h *Hierarchy) accessFill(addr uint64, isWrite bool) (level int) {
+	level = len(h.Levels)
+	write := isWrite
+	for i, c := range h.Levels {
+		hit, evicted := c.access(addr, write)
+		h.evict(i, evicted)
+		write = write && c.WritePolicy() == WriteThrough
+		if hit {
+			level = i
+			break
+		}
+	}
+
+	// The store went through every level it touched and continues below
+	if write {
+		h.writeDown(min(level+1, len(h.Levels)), addr)
+	}
+
+	return level
+}
+
+// accessExclusive looks addr up in L1, then takes it from the first lower
+// level holding it, and returns the index of the level that hit
+func (h *Hierarchy) accessExclusive(addr uint64, isWrite bool) (level int) {
+	l1 := h.Levels[0]
+	hit, evicted := l1.access(addr, isWrite)
+	if isWrite && l1.WritePolicy() == WriteThrough {
+		atomic.AddInt64(&h.memoryWrites, 1)
+	}
+	if hit {
+		return 0
+	}
+
+	level = len(h.Levels)
+	for i := 1; i < len(h.Levels); i++ {
+		if hit, dirty := h.Levels[i].take(addr); hit {
+			if dirty {
+				h.demote(0, eviction{addr: addr, valid: true, dirty: true})
+			}
+			level = i
+			break
+		}
+	}
+
+	h.demote(1, evicted)
+	return level
+}
+
+// evict disposes of the line a fill at level i displaced. Under the
+// inclusive policy the line is first removed from the levels above, taking
+// any dirty data they held with it. A dirty line is written to the next
+// level down.
+func (h *Hierarchy) evict(i int, evicted eviction) {
+	if !evicted.valid {
+		return
+	}
+
+	if h.inclusion == Inclusive {
+		for _, c := range h.Levels[:i] {
+			if present, dirty := c.remove(evicted.addr); present {
+				atomic.AddInt64(&h.backInvals, 1)
+				evicted.dirty = evicted.dirty || dirty
+			}
+		}
+	}
+
+	if evicted.dirty {
+		h.writeDown(i+1, evicted.addr)
+	}
+}
+
+// demote moves a line evicted from the level above from into that level,
+// and each line that evicts on down the exclusive hierarchy. Dirty lines
+// reaching a write-through level or leaving the last level are written to
+// memory.
+func (h *Hierarchy) demote(from int, evicted eviction) {
+	for i := from; evicted.valid && i < len(h.Levels); i++ {
+		c := h.Levels[i]
+		if evicted.dirty && c.WritePolicy() == WriteThrough {
+			atomic.AddInt64(&h.memoryWrites, 1)
+		}
+		evicted = c.insert(evicted.addr, evicted.dirty)
+	}
+
+	if evicted.valid && evicted.dirty {
+		atomic.AddInt64(&h.memoryWrites, 1)
+	}
+}
+
+// writeDown writes the line at addr into the level at index from, carrying
+// on through write-through levels. Writes that pass the last level reach
+// memory.
+func (h *Hierarchy) writeDown(from int, addr uint64) {
+	for i := from; i < len(h.Levels); i++ {
+		c := h.Levels[i]
+		_, evicted := c.access(addr, true)
+		h.evict(i, evicted)
+		if c.WritePolicy() != WriteThrough {
+			return
+		}
+	}
+
+	atomic.AddInt64(&h.memoryWrites, 1)
+}
+
+// prefetch brings the line at addr into L1 from the nearest level holding
+// it, filling the levels in between, or moving it from that level if the
+// hierarchy is exclusive. A line no level holds comes from memory.
+func (h *Hierarchy) prefetch(addr uint64) {
+	source := len(h.Levels)
+	for i, c := range h.Levels {
+		if c.Contains(addr) {
+			source = i
+			break
+		}
+	}
+
+	if source == 0 {
+		return
+	}
+	if source == len(h.Levels) {
+		atomic.AddInt64(&h.prefetchFills, 1)
+	}
+
+	if h.inclusion == Exclusive {
+		dirty := false
+		if source < len(h.Levels) {
+			_, dirty = h.Levels[source].remove(addr)
+		}
+		_, evicted := h.Levels[0].fill(addr, true)
+		if dirty {
+			h.demote(0, eviction{addr: addr, valid: true, dirty: true})
+		}
+		h.demote(1, evicted)
+		return
+	}
+
+	for i := source - 1; i >= 0; i-- {
+		_, evicted := h.Levels[i].fill(addr, i == 0)
+		h.evict(i, evicted)
+	}
+}
+
+// Invalidate removes the line containing addr from every private level. A
+// shared L3 keeps it to serve the other cores.
+func (h *Hierarchy) Invalidate(addr uint64) {
+	for _, c := range h.Levels {
+		if h.private(c) {
+			c.Invalidate(addr)
+		}
+	}
+}
+
+// Holds returns the latency of the first private level holding addr,
+// without updating replacement state or statistics, and false if none does
+func (h *Hierarchy) Holds(addr uint64) (int, bool) {
+	for _, c := range h.Levels {
+		if h.private(c) && c.Contains(addr) {
+			return c.Latency(), true
+		}
+	}
+	return 0, false
+}
+
+// Accesses returns the number of accesses made to the hierarchy
+func (h *Hierarchy) Accesses() int64 {
+	return atomic.LoadInt64(&h.accesses)
+}
+
+// CacheHits returns the number of accesses served by some cache level
+func (h *Hierarchy) CacheHits() int64 {
+	return atomic.LoadInt64(&h.accesses) - atomic.LoadInt64(&h.memoryHits)
+}
+
+// DirtyEvictions returns the number of dirty lines evicted across all private levels
+func (h *Hierarchy) DirtyEvictions() int64 {
+	total := int64(0)
+	for _, c := range h.Levels {
+		if h.private(c) {
+			total += c.GetStats().DirtyEvictions
+		}
+	}
+	return total
+}
+
+// MemoryWrites returns the number of lines written back to main memory
+func (h *Hierarchy) MemoryWrites() int64 {
+	return atomic.LoadInt64(&h.memoryWrites)
+}
+
+// BackInvalidations returns the number of lines removed from upper levels
+// because a lower level evicted them, under the inclusive policy
+func (h *Hierarchy) BackInvalidations() int64 {
+	return atomic.LoadInt64(&h.backInvals)
+}
+
+// Prefetches returns the number of lines prefetched into L1 and how many of
+// them a demand access went on to hit
+func (h *Hierarchy) Prefetches() (issued, useful int64) {
+	stats := h.Levels[0].GetStats()
+	return stats.Prefetches, stats.UsefulPrefetches
+}
+
+// PrefetchFills returns the number of prefetched lines fetched from memory
+func (h *Hierarchy) PrefetchFills() int64 {
+	return atomic.LoadInt64(&h.prefetchFills)
+}
+
+// HitRate returns the fraction of accesses served without going to memory
+func (h *Hierarchy) HitRate() float64 {
+	accesses := atomic.LoadInt64(&h.accesses)
+	if accesses == 0 {
+		return 0.0
+	}
+	return float64(h.CacheHits()) / float64(accesses)
+}
+
+// Reset invalidates every private level and zeroes the counters
+func (h *Hierarchy) Reset() {
+	for _, c := range h.Levels {
+		if h.private(c) {
+			c.Reset()
+		}
+	}
+	atomic.StoreInt64(&h.accesses, 0)
+	atomic.StoreInt64(&h.memoryHits, 0)
+	atomic.StoreInt64(&h.memoryWrites, 0)
+	atomic.StoreInt64(&h.prefetchFills, 0)
+	atomic.StoreInt64(&h.backInvals, 0)
+	if h.prefetcher != nil {
+		h.prefetcher.reset()
+	}
+}
+
+// ResetStats zeroes the counters of the hierarchy and every private level,
+// keeping the cached lines and the prefetcher's training
+func (h *Hierarchy) ResetStats() {
+	for _, c := range h.Levels {
+		if h.private(c) {
+			c.ResetStats()
+		}
+	}
+	atomic.StoreInt64(&h.accesses, 0)
+	atomic.StoreInt64(&h.memoryHits, 0)
+	atomic.StoreInt64(&h.memoryWrites, 0)
+	atomic.StoreInt64(&h.prefetchFills, 0)
+	atomic.StoreInt64(&h.backInvals, 0)
+}
+
+// HierarchySnapshot is a copy of every private level's state and the
+// hierarchy's counters, for checkpointing
+type HierarchySnapshot struct {
+	Levels       []Snapshot // L1 first; empty for a shared L3
+	Accesses     int64
+	MemoryHits   int64
+	MemoryWrites int64
+
+	BackInvalidations int64
+
+	PrefetchFills  int64
+	PrefetchLast   uint64
+	PrefetchStride int64
+	PrefetchPrimed bool
+}
+
+// Snapshot returns a copy of the hierarchy's state
+func (h *Hierarchy) Snapshot() HierarchySnapshot {
+	snap := HierarchySnapshot{
+		Levels:       make([]Snapshot, len(h.Levels)),
+		Accesses:     atomic.LoadInt64(&h.accesses),
+		MemoryHits:   atomic.LoadInt64(&h.memoryHits),
+		MemoryWrites: atomic.LoadInt64(&h.memoryWrites),
+
+		BackInvalidations: atomic.LoadInt64(&h.backInvals),
+
+		PrefetchFills: atomic.LoadInt64(&h.prefetchFills),
+	}
+	if pf := h.prefetcher; pf != nil {
+		snap.PrefetchLast, snap.PrefetchStride, snap.PrefetchPrimed = pf.last, pf.stride, pf.primed
+	}
+	for i, c := range h.Levels {
+		if h.private(c) {
+			snap.Levels[i] = c.Snapshot()
+		}
+	}
+	return snap
+}
+
+// Restore replaces the hierarchy's state with snap, which must come from a
+// hierarchy with the same levels
+func (h *Hierarchy) Restore(snap HierarchySnapshot) error {
+	if len(snap.Levels) != len(h.Levels) {
+		return fmt.Errorf("snapshot has %d cache levels, hierarchy has %d", len(snap.Levels), len(h.Levels))
+	}
+
+	for i, c := range h.Levels {
+		if !h.private(c) {
+			continue
+		}
+		if err := c.Restore(snap.Levels[i]); err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt64(&h.accesses, snap.Accesses)
+	atomic.StoreInt64(&h.memoryHits, snap.MemoryHits)
+	atomic.StoreInt64(&h.memoryWrites, snap.MemoryWrites)
+	atomic.StoreInt64(&h.prefetchFills, snap.PrefetchFills)
+	atomic.StoreInt64(&h.backInvals, snap.BackInvalidations)
+	if pf := h.prefetcher; pf != nil {
+		pf.last, pf.stride, pf.primed = snap.PrefetchLast, snap.PrefetchStride, snap.PrefetchPrimed
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// imageVersion is bumped whenever the cache image layout changes
+const imageVersion = 1
+
+// image is what SaveImage writes: a cache's geometry and the lines it holds,
+// without the counters of the run that filled it
+type image struct {
+	Version     int
+	Sets        int
+	Ways        int
+	LineSize    int
+	Lines       []LineSnapshot
+	PLRU        []uint64 // nil unless the cache was PLRU
+	AccessCount uint64   // recency clock the lines' LastUsed and Filled count from
+}
+
+// SaveImage writes the lines the cache holds to w, so that LoadImage can
+// warm another cache of the same geometry with the same working set
+func (c *Cache) SaveImage(w io.Writer) error {
+	snap := c.Snapshot()
+	img := image{
+		Version:     imageVersion,
+		Sets:        c.numSets,
+		Ways:        c.associativity,
+		LineSize:    c.lineSize,
+		Lines:       snap.Lines,
+		PLRU:        snap.PLRU,
+		AccessCount: snap.AccessCount,
+	}
+
+	if err := gob.NewEncoder(w).Encode(img); err != nil {
+		return fmt.Errorf("failed to write %s image: %w", c.Name, err)
+	}
+	return nil
+}
+
+// LoadImage replaces the lines the cache holds with an image written by
+// SaveImage from a cache of the same geometry, leaving the counters alone.
+// The replacement state comes along where both caches use pseudo-LRU.
+func (c *Cache) LoadImage(r io.Reader) error {
+	var img image
+	if err := gob.NewDecoder(r).Decode(&img); err != nil {
+		return fmt.Errorf("failed to read %s image: %w", c.Name, err)
+	}
+
+	if img.Version != imageVersion {
+		return fmt.Errorf("%s image version %d, want %d", c.Name, img.Version, imageVersion)
+	}
+
+	if img.Sets != c.numSets || img.Ways != c.associativity || img.LineSize != c.lineSize {
+		return fmt.Errorf("%s image has %d sets of %d %d-byte lines, cache has %d sets of %d %d-byte lines",
+			c.Name, img.Sets, img.Ways, img.LineSize, c.numSets, c.associativity, c.lineSize)
+	}
+
+	snap := c.Snapshot()
+	snap.Lines, snap.AccessCount = img.Lines, img.AccessCount
+	if len(img.PLRU) == len(snap.PLRU) {
+		snap.PLRU = img.PLRU
+	}
+	return c.Restore(snap)
+}
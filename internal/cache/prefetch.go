@@ -0,0 +1,63 @@
+package cache
+
+import "fmt"
+
+// PrefetchPolicy selects which line, if any, is prefetched after an L1 miss
+// or the first demand hit on a prefetched line
+type PrefetchPolicy string
+
+const (
+	// PrefetchNone never prefetches
+	PrefetchNone PrefetchPolicy = "none"
+	// PrefetchNextLine prefetches the line after the one accessed
+	PrefetchNextLine PrefetchPolicy = "next-line"
+	// PrefetchStride prefetches one stride ahead once two consecutive
+	// triggering accesses are the same number of lines apart
+	PrefetchStride PrefetchPolicy = "stride"
+)
+
+// prefetcher watches the accesses that trigger prefetches and picks the
+// line to prefetch after each
+type prefetcher struct {
+	policy   PrefetchPolicy
+	lineSize uint64
+	last     uint64 // line number of the previous trigger
+	stride   int64  // lines between the previous two triggers
+	primed   bool   // last is valid
+}
+
+func newPrefetcher(policy PrefetchPolicy, lineSize int) (*prefetcher, error) {
+	switch policy {
+	case PrefetchNone, PrefetchNextLine, PrefetchStride:
+	default:
+		return nil, fmt.Errorf("unsupported prefetch policy: %s", policy)
+	}
+
+	return &prefetcher{policy: policy, lineSize: uint64(lineSize)}, nil
+}
+
+// trigger records a triggering access to addr and returns the address to
+// prefetch, if any
+func (p *prefetcher) trigger(addr uint64) (uint64, bool) {
+	line := addr / p.lineSize
+
+	switch p.policy {
+	case PrefetchNextLine:
+		return (line + 1) * p.lineSize, true
+
+	case PrefetchStride:
+		stride := int64(line - p.last)
+		confirmed := p.primed && stride != 0 && stride == p.stride
+		p.last, p.stride, p.primed = line, stride, true
+		if confirmed {
+			return uint64(int64(line)+stride) * p.lineSize, true
+		}
+	}
+
+	return 0, false
+}
+
+// reset forgets the trigger history
+func (p *prefetcher) reset() {
+	p.last, p.stride, p.primed = 0, 0, false
+}
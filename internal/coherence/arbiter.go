@@ -0,0 +1,262 @@
+package coherence
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Bus arbitration policies
+const (
+	ArbitrateRoundRobin = "round-robin" // rotate priority past the last winner
+	ArbitratePriority   = "priority"    // highest configured priority wins, ties to the lowest core
+	ArbitrateFixed      = "fixed"       // lowest core ID always wins
+)
+
+// BusArbiter decides which core drives the shared bus when several issue a
+// coherence transaction in the same cycle
+type BusArbiter struct {
+	policy     string
+	numCores   int
+	priorities []int
+	next       int     // round-robin: first core considered in the next arbitration
+	granted    bool    // the bus carries a transaction this cycle
+	waitCycles []int64 // per core cycles spent waiting for the bus
+	grants     []int64 // per core bus grants
+	mutex      sync.Mutex
+}
+
+// NewBusArbiter creates an arbiter for numCores cores. priorities is only
+// used by the priority policy and may be nil, giving every core equal
+// priority; otherwise it must have one entry per core.
+func NewBusArbiter(policy string, numCores int, priorities []int) (*BusArbiter, error) {
+	if numCores <= 0 {
+		return nil, fmt.Errorf("number of cores must be positive")
+	}
+
+	switch policy {
+	case ArbitrateRoundRobin, ArbitratePriority, ArbitrateFixed:
+	default:
+		return nil, fmt.Errorf("unsupported bus arbitration policy: %s", policy)
+	}
+
+	if priorities != nil && len(priorities) != numCores {
+		return nil, fmt.Errorf("bus priorities has %d entries, want %d", len(priorities), numCores)
+	}
+
+	a := &BusArbiter{
+		policy:     policy,
+		numCores:   numCores,
+		priorities: make([]int, numCores),
+		waitCycles: make([]int64, numCores),
+		grants:     make([]int64, numCores),
+	}
+	copy(a.priorities, priorities)
+
+	return a, nil
+}
+
+// Arbitrate grants the bus to one of the requesting cores for this cycle and
+// charges every other requester a wait cycle. It returns the winning core,
+// or -1 if there were no requests.
+func (a *BusArbiter) Arbitrate(requests []int) int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.arbitrate(requests)
+}
+
+func (a *BusArbiter) arbitrate(requests []int) int {
+	if len(requests) == 0 {
+		return -1
+	}
+
+	winner := requests[0]
+	for _, core := range requests[1:] {
+		if a.beats(core, winner) {
+			winner = core
+		}
+	}
+
+	a.grants[winner]++
+	for _, core := range requests {
+		if core != winner {
+			a.waitCycles[core]++
+		}
+	}
+
+	if a.policy == ArbitrateRoundRobin {
+		a.next = (winner + 1) % a.numCores
+	}
+
+	return winner
+}
+
+// beats reports whether core a should win the bus over core b
+func (a *BusArbiter) beats(x, y int) bool {
+	switch a.policy {
+	case ArbitrateRoundRobin:
+		// Distance past the round-robin pointer; closer wins
+		dx := (x - a.next + a.numCores) % a.numCores
+		dy := (y - a.next + a.numCores) % a.numCores
+		return dx < dy
+	case ArbitratePriority:
+		if a.priorities[x] != a.priorities[y] {
+			return a.priorities[x] > a.priorities[y]
+		}
+		return x < y
+	default:
+		return x < y
+	}
+}
+
+// BeginCycle frees the bus for a new cycle
+func (a *BusArbiter) BeginCycle() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.granted = false
+}
+
+// Request grants core the bus for this cycle if no other core holds it,
+// returning true. Otherwise it charges core a wait cycle and returns false,
+// and core asks again next cycle. Cores requesting in the same cycle must
+// ask in Order, so that the policy decides which of them proceeds.
+func (a *BusArbiter) Request(core int) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.granted {
+		a.waitCycles[core]++
+		return false
+	}
+
+	a.granted = true
+	a.grants[core]++
+	if a.policy == ArbitrateRoundRobin {
+		a.next = (core + 1) % a.numCores
+	}
+	return true
+}
+
+// Order returns every core in the order the bus would be granted if all of
+// them requested it this cycle, leaving the arbiter unchanged
+func (a *BusArbiter) Order() []int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	order := make([]int, a.numCores)
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(x, y int) int {
+		switch {
+		case a.beats(x, y):
+			return -1
+		case a.beats(y, x):
+			return 1
+		default:
+			return 0
+		}
+	})
+	return order
+}
+
+// Schedule arbitrates a set of simultaneous requests cycle by cycle until
+// every requester has been granted the bus, returning the grant order
+func (a *BusArbiter) Schedule(requests []int) []int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	pending := append([]int(nil), requests...)
+	order := make([]int, 0, len(pending))
+	for len(pending) > 0 {
+		winner := a.arbitrate(pending)
+		order = append(order, winner)
+
+		for i, core := range pending {
+			if core == winner {
+				pending = append(pending[:i], pending[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return order
+}
+
+// WaitCycles returns a copy of the per-core arbitration wait cycles
+func (a *BusArbiter) WaitCycles() []int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	waits := make([]int64, len(a.waitCycles))
+	copy(waits, a.waitCycles)
+	return waits
+}
+
+// Grants returns a copy of the per-core bus grant counts
+func (a *BusArbiter) Grants() []int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	grants := make([]int64, len(a.grants))
+	copy(grants, a.grants)
+	return grants
+}
+
+// Reset zeroes the counters and the round-robin pointer
+func (a *BusArbiter) Reset() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.next, a.granted = 0, false
+	for i := range a.waitCycles {
+		a.waitCycles[i] = 0
+		a.grants[i] = 0
+	}
+}
+
+// ResetStats zeroes the counters, leaving the round-robin pointer in place
+func (a *BusArbiter) ResetStats() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	clear(a.waitCycles)
+	clear(a.grants)
+}
+
+// ArbiterSnapshot is a copy of a bus arbiter's state, for checkpointing
+type ArbiterSnapshot struct {
+	Next       int
+	WaitCycles []int64
+	Grants     []int64
+}
+
+// Snapshot returns a copy of the arbiter's state
+func (a *BusArbiter) Snapshot() ArbiterSnapshot {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return ArbiterSnapshot{
+		Next:       a.next,
+		WaitCycles: append([]int64(nil), a.waitCycles...),
+		Grants:     append([]int64(nil), a.grants...),
+	}
+}
+
+// Restore replaces the arbiter's state with snap, which must come from an
+// arbiter for the same number of cores
+func (a *BusArbiter) Restore(snap ArbiterSnapshot) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(snap.WaitCycles) != a.numCores || len(snap.Grants) != a.numCores {
+		return fmt.Errorf("snapshot arbitrates %d cores, arbiter has %d", len(snap.WaitCycles), a.numCores)
+	}
+
+	a.next = snap.Next
+	copy(a.waitCycles, snap.WaitCycles)
+	copy(a.grants, snap.Grants)
+	return nil
+}
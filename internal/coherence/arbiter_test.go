@@ -0,0 +1,173 @@
+package coherence
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestNewBusArbiter(t *testing.T) {
+	if _, err := NewBusArbiter("Invalid", 2, nil); err == nil {
+		t.Errorf("NewBusArbiter() with invalid policy should return error")
+	}
+
+	if _, err := NewBusArbiter(ArbitratePriority, 2, []int{1}); err == nil {
+		t.Errorf("NewBusArbiter() with too few priorities should return error")
+	}
+
+	if _, err := NewBusArbiter(ArbitrateFixed, 0, nil); err == nil {
+		t.Errorf("NewBusArbiter() with zero cores should return error")
+	}
+}
+
+func TestBusArbitrationOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		priorities []int
+		rounds     [][]int // simultaneous requests in successive rounds
+		want       [][]int // grant order for each round
+	}{
+		{
+			name:   "Fixed always favors the lowest core",
+			policy: ArbitrateFixed,
+			rounds: [][]int{{1, 0}, {1, 0}},
+			want:   [][]int{{0, 1}, {0, 1}},
+		},
+		{
+			name:   "Round-robin rotates past the last winner",
+			policy: ArbitrateRoundRobin,
+			rounds: [][]int{{0}, {0, 1}},
+			want:   [][]int{{0}, {1, 0}},
+		},
+		{
+			name:       "Priority favors the higher priority core",
+			policy:     ArbitratePriority,
+			priorities: []int{1, 5},
+			rounds:     [][]int{{0, 1}, {0, 1}},
+			want:       [][]int{{1, 0}, {1, 0}},
+		},
+		{
+			name:   "Priority ties go to the lowest core",
+			policy: ArbitratePriority,
+			rounds: [][]int{{1, 0}},
+			want:   [][]int{{0, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arb, err := NewBusArbiter(tt.policy, 2, tt.priorities)
+			if err != nil {
+				t.Fatalf("NewBusArbiter() error = %v", err)
+			}
+
+			for i, requests := range tt.rounds {
+				// Order predicts the grants to any subset of the cores
+				var predicted []int
+				for _, core := range arb.Order() {
+					if slices.Contains(requests, core) {
+						predicted = append(predicted, core)
+					}
+				}
+
+				got := arb.Schedule(requests)
+				if !reflect.DeepEqual(predicted, got) {
+					t.Errorf("Round %d Order() predicted %v, Schedule(%v) = %v", i, predicted, requests, got)
+				}
+				if !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("Round %d Schedule(%v) = %v, want %v", i, requests, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBusArbitrationRoundRobinFairness(t *testing.T) {
+	arb, _ := NewBusArbiter(ArbitrateRoundRobin, 2, nil)
+
+	// Both cores request every cycle; grants alternate
+	var winners []int
+	for i := 0; i < 4; i++ {
+		winners = append(winners, arb.Arbitrate([]int{0, 1}))
+	}
+
+	if want := []int{0, 1, 0, 1}; !reflect.DeepEqual(winners, want) {
+		t.Errorf("Round-robin winners = %v, want %v", winners, want)
+	}
+
+	if waits := arb.WaitCycles(); waits[0] != 2 || waits[1] != 2 {
+		t.Errorf("WaitCycles() = %v, want [2 2]", waits)
+	}
+}
+
+func TestBusArbitrationRequest(t *testing.T) {
+	arb, _ := NewBusArbiter(ArbitrateRoundRobin, 3, nil)
+
+	// The first core to ask in a cycle gets the bus; later ones wait
+	arb.BeginCycle()
+	for core, want := range []bool{true, false, false} {
+		if got := arb.Request(core); got != want {
+			t.Errorf("Request(%d) = %v, want %v", core, got, want)
+		}
+	}
+
+	// Round-robin moves past the core just granted
+	if got := arb.Order(); !reflect.DeepEqual(got, []int{1, 2, 0}) {
+		t.Errorf("Order() after granting core 0 = %v, want [1 2 0]", got)
+	}
+
+	arb.BeginCycle()
+	if !arb.Request(1) {
+		t.Errorf("Request(1) in a new cycle = false, want true")
+	}
+
+	if want := []int64{0, 1, 1}; !reflect.DeepEqual(arb.WaitCycles(), want) {
+		t.Errorf("WaitCycles() = %v, want %v", arb.WaitCycles(), want)
+	}
+	if want := []int64{1, 1, 0}; !reflect.DeepEqual(arb.Grants(), want) {
+		t.Errorf("Grants() = %v, want %v", arb.Grants(), want)
+	}
+
+	arb.Reset()
+	if !arb.Request(2) {
+		t.Errorf("Request(2) after Reset() = false, want true")
+	}
+}
+
+func TestBusArbitrationWaitCycles(t *testing.T) {
+	arb, _ := NewBusArbiter(ArbitrateFixed, 3, nil)
+
+	// Core 2 waits behind cores 0 and 1
+	arb.Schedule([]int{2, 1, 0})
+
+	if want := []int64{0, 1, 2}; !reflect.DeepEqual(arb.WaitCycles(), want) {
+		t.Errorf("WaitCycles() = %v, want %v", arb.WaitCycles(), want)
+	}
+
+	if want := []int64{1, 1, 1}; !reflect.DeepEqual(arb.Grants(), want) {
+		t.Errorf("Grants() = %v, want %v", arb.Grants(), want)
+	}
+
+	restored, _ := NewBusArbiter(ArbitrateFixed, 3, nil)
+	if err := restored.Restore(arb.Snapshot()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !reflect.DeepEqual(restored.Snapshot(), arb.Snapshot()) {
+		t.Errorf("Snapshot() after Restore() = %+v, want %+v", restored.Snapshot(), arb.Snapshot())
+	}
+	smaller, _ := NewBusArbiter(ArbitrateFixed, 2, nil)
+	if err := smaller.Restore(arb.Snapshot()); err == nil {
+		t.Error("Restore() into an arbiter for fewer cores should return error")
+	}
+
+	arb.ResetStats()
+	if want := []int64{0, 0, 0}; !reflect.DeepEqual(arb.Grants(), want) {
+		t.Errorf("Grants() after ResetStats() = %v, want %v", arb.Grants(), want)
+	}
+
+	arb.Reset()
+	if want := []int64{0, 0, 0}; !reflect.DeepEqual(arb.WaitCycles(), want) {
+		t.Errorf("WaitCycles() after Reset() = %v, want %v", arb.WaitCycles(), want)
+	}
+}
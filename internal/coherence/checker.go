@@ -0,0 +1,116 @@
+package coherence
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CheckCoherenceInvariants replays a recorded coherence trace and returns an
+// error describing the first invariant violation, or nil if none occur.
+//
+// Each non-empty line of the trace records one state change:
+//
+//	<core> <address> <state>
+//
+// where state is one of M, O, E, S, I, F and the address may be decimal or
+// 0x-prefixed hex. Lines starting with '#' are comments. After every change
+// the checker verifies that a line held Modified or Exclusive is not valid in
+// any other core, and that at most one core holds it Owned or Forward.
+func CheckCoherenceInvariants(trace io.Reader) error {
+	// address -> core -> state, Invalid entries are removed
+	lines := make(map[uint64]map[int]State)
+
+	scanner := bufio.NewScanner(trace)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return fmt.Errorf("line %d: expected \"<core> <address> <state>\", got %q", lineNum, text)
+		}
+
+		coreID, err := strconv.Atoi(fields[0])
+		if err != nil || coreID < 0 {
+			return fmt.Errorf("line %d: invalid core %q", lineNum, fields[0])
+		}
+
+		addr, err := strconv.ParseUint(fields[1], 0, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid address %q", lineNum, fields[1])
+		}
+
+		state, err := ParseState(fields[2])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		holders := lines[addr]
+		if holders == nil {
+			holders = make(map[int]State)
+			lines[addr] = holders
+		}
+
+		if state == Invalid {
+			delete(holders, coreID)
+		} else {
+			holders[coreID] = state
+		}
+
+		if err := checkLine(holders); err != nil {
+			return fmt.Errorf("line %d: address %#x: %w", lineNum, addr, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read coherence trace: %w", err)
+	}
+
+	return nil
+}
+
+// checkLine validates the states every core holds for a single cache line
+func checkLine(holders map[int]State) error {
+	// Visit cores in order so the reported violation is deterministic
+	cores := make([]int, 0, len(holders))
+	for c := range holders {
+		cores = append(cores, c)
+	}
+	sort.Ints(cores)
+
+	owner, forwarder := -1, -1
+	for _, c := range cores {
+		switch state := holders[c]; state {
+		case Modified, Exclusive:
+			if len(holders) > 1 {
+				other := cores[0]
+				if other == c {
+					other = cores[1]
+				}
+				return fmt.Errorf("core %d holds the line %s while core %d holds it %s",
+					c, state, other, holders[other])
+			}
+		case Owned:
+			if owner >= 0 {
+				return fmt.Errorf("cores %d and %d both hold the line Owned", owner, c)
+			}
+			owner = c
+		case Forward:
+			if forwarder >= 0 {
+				return fmt.Errorf("cores %d and %d both hold the line Forward", forwarder, c)
+			}
+			forwarder = c
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package coherence
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCoherenceInvariants(t *testing.T) {
+	tests := []struct {
+		name    string
+		trace   string
+		wantErr string
+	}{
+		{
+			name: "Valid MESI sequence",
+			trace: `
+# core 0 reads, core 1 reads, core 1 writes
+0 0x40 E
+0 0x40 S
+1 0x40 S
+0 0x40 I
+1 0x40 M
+`,
+		},
+		{
+			name: "Valid MOESI sharing with owner",
+			trace: `
+0 0x80 M
+0 0x80 O
+1 0x80 S
+2 0x80 S
+`,
+		},
+		{
+			name: "Two writers",
+			trace: `
+0 0x40 M
+1 0x40 M
+`,
+			wantErr: "line 3",
+		},
+		{
+			name: "Modified with sharer",
+			trace: `
+0 0x40 S
+1 0x40 S
+1 0x40 M
+`,
+			wantErr: "core 1 holds the line Modified while core 0 holds it Shared",
+		},
+		{
+			name: "Two owners",
+			trace: `
+0 0x40 O
+1 0x40 O
+`,
+			wantErr: "both hold the line Owned",
+		},
+		{
+			name: "Different lines do not interact",
+			trace: `
+0 0x40 M
+1 0x80 M
+`,
+		},
+		{
+			name:    "Malformed line",
+			trace:   "0 0x40\n",
+			wantErr: "line 1",
+		},
+		{
+			name:    "Unknown state",
+			trace:   "0 0x40 X\n",
+			wantErr: "unknown coherence state",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCoherenceInvariants(strings.NewReader(tt.trace))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckCoherenceInvariants() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("CheckCoherenceInvariants() error = nil, want error containing %q", tt.wantErr)
+			}
+
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckCoherenceInvariants() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
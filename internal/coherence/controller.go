@@ -0,0 +1,399 @@
+package coherence
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Stats contains coherence traffic counters
+type Stats struct {
+	Reads            int64 `json:"reads"`            // loads checked against the protocol
+	Writes           int64 `json:"writes"`           // stores checked against the protocol
+	BusTransactions  int64 `json:"busTransactions"`  // loads and stores that needed the bus
+	Invalidations    int64 `json:"invalidations"`    // remote copies invalidated by a store
+	WriteBacks       int64 `json:"writeBacks"`       // dirty lines written back due to snooping
+	Atomics          int64 `json:"atomics"`          // atomic read-modify-writes, each holding its line until done
+	AtomicContention int64 `json:"atomicContention"` // cycles cores waited for a line another core's atomic held
+}
+
+// Controller tracks per-core line states and applies a protocol's
+// transitions as cores load and store
+type Controller struct {
+	protocol     Protocol
+	numCores     int
+	lineSize     uint64
+	lines        map[uint64][]State // line address -> per-core state
+	held         map[uint64]int     // line address -> core whose atomic holds it
+	onInvalidate []func(addr uint64)
+	sharing      *sharingTracker // nil unless false sharing detection is on
+	stats        Stats
+	mutex        sync.Mutex
+}
+
+// NewController creates a controller for numCores cores using the named protocol
+func NewController(protocol string, numCores, lineSize int) (*Controller, error) {
+	if numCores <= 0 {
+		return nil, fmt.Errorf("number of cores must be positive")
+	}
+
+	if lineSize <= 0 {
+		return nil, fmt.Errorf("line size must be positive")
+	}
+
+	proto, err := NewProtocol(protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Controller{
+		protocol:     proto,
+		numCores:     numCores,
+		lineSize:     uint64(lineSize),
+		lines:        make(map[uint64][]State),
+		held:         make(map[uint64]int),
+		onInvalidate: make([]func(addr uint64), numCores),
+	}, nil
+}
+
+// SetInvalidateHandler registers a function called when core's copy of a
+// line is invalidated by another core's store
+func (c *Controller) SetInvalidateHandler(core int, handler func(addr uint64)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.onInvalidate[core] = handler
+}
+
+// SetFalseSharingDetection turns on or off tracking of the byte offsets
+// each core touches in a line, to count invalidations that false sharing
+// causes. Turning it off discards what was tracked.
+func (c *Controller) SetFalseSharingDetection(enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.sharing = nil
+	if enabled {
+		c.sharing = newSharingTracker(c.lineSize)
+	}
+}
+
+// FalseSharing returns up to n lines with the most invalidations caused by
+// false sharing, most first, or nil without false sharing detection
+func (c *Controller) FalseSharing(n int) []FalseSharingLine {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.sharing == nil {
+		return nil
+	}
+	return c.sharing.hottest(n)
+}
+
+// Read applies a load by core to the line containing addr. It returns true
+// if the load needed a bus transaction.
+func (c *Controller) Read(core int, addr uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stats.Reads++
+	lineAddr, states := c.line(addr)
+	if c.sharing != nil {
+		c.sharing.touch(core, c.numCores, lineAddr, addr-lineAddr)
+	}
+
+	othersValid := false
+	for i, st := range states {
+		if i != core && st != Invalid {
+			othersValid = true
+			break
+		}
+	}
+
+	next, busTx := c.protocol.Read(states[core], othersValid)
+	states[core] = next
+	if !busTx {
+		return false
+	}
+
+	c.stats.BusTransactions++
+	for i, st := range states {
+		if i == core || st == Invalid {
+			continue
+		}
+		remote, writeBack := c.protocol.SnoopRead(st)
+		states[i] = remote
+		if writeBack {
+			c.stats.WriteBacks++
+		}
+	}
+
+	return true
+}
+
+// Write applies a store by core to the line containing addr. It returns
+// true if the store needed a bus transaction.
+func (c *Controller) Write(core int, addr uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stats.Writes++
+	lineAddr, states := c.line(addr)
+	if c.sharing != nil {
+		c.sharing.touch(core, c.numCores, lineAddr, addr-lineAddr)
+	}
+
+	next, busTx := c.protocol.Write(states[core])
+	states[core] = next
+	if !busTx {
+		return false
+	}
+
+	c.stats.BusTransactions++
+	for i, st := range states {
+		if i == core || st == Invalid {
+			continue
+		}
+		remote, writeBack := c.protocol.SnoopWrite(st)
+		states[i] = remote
+		if writeBack {
+			c.stats.WriteBacks++
+		}
+		if remote == Invalid {
+			c.stats.Invalidations++
+			if c.sharing != nil {
+				c.sharing.invalidate(i, lineAddr, addr-lineAddr)
+			}
+			if handler := c.onInvalidate[i]; handler != nil {
+				handler(lineAddr)
+			}
+		}
+	}
+
+	return true
+}
+
+// line returns the line address for addr and its per-core states,
+// creating an all-Invalid entry on first use
+func (c *Controller) line(addr uint64) (uint64, []State) {
+	lineAddr := addr - addr%c.lineSize
+	states, ok := c.lines[lineAddr]
+	if !ok {
+		states = make([]State, c.numCores)
+		c.lines[lineAddr] = states
+	}
+	return lineAddr, states
+}
+
+// State returns core's coherence state for the line containing addr
+func (c *Controller) State(core int, addr uint64) State {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	states, ok := c.lines[addr-addr%c.lineSize]
+	if !ok {
+		return Invalid
+	}
+	return states[core]
+}
+
+// Sharers returns the cores other than core holding a valid copy of the
+// line containing addr, the ones a bus transaction by core would snoop
+func (c *Controller) Sharers(core int, addr uint64) []int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var sharers []int
+	for i, st := range c.lines[addr-addr%c.lineSize] {
+		if i != core && st != Invalid {
+			sharers = append(sharers, i)
+		}
+	}
+	return sharers
+}
+
+// NeedsBus reports whether a load or store by core to the line containing
+// addr would need a bus transaction, leaving every state unchanged
+func (c *Controller) NeedsBus(core int, addr uint64, isWrite bool) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	states, ok := c.lines[addr-addr%c.lineSize]
+	if !ok {
+		states = make([]State, c.numCores)
+	}
+
+	if isWrite {
+		_, busTx := c.protocol.Write(states[core])
+		return busTx
+	}
+
+	othersValid := false
+	for i, st := range states {
+		if i != core && st != Invalid {
+			othersValid = true
+			break
+		}
+	}
+	_, busTx := c.protocol.Read(states[core], othersValid)
+	return busTx
+}
+
+// Blocked reports whether an atomic read-modify-write by another core holds
+// the line containing addr, so that core must wait to access it. Each wait
+// counts as contention.
+func (c *Controller) Blocked(core int, addr uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	owner, ok := c.held[addr-addr%c.lineSize]
+	if !ok || owner == core {
+		return false
+	}
+	c.stats.AtomicContention++
+	return true
+}
+
+// Lock holds the line containing addr for an atomic read-modify-write by
+// core, which must not be Blocked, until core calls Unlock. The atomic's
+// store then takes the line in Modified as usual.
+func (c *Controller) Lock(core int, addr uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.held[addr-addr%c.lineSize] = core
+	c.stats.Atomics++
+}
+
+// Unlock releases the line containing addr if core's atomic holds it
+func (c *Controller) Unlock(core int, addr uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	lineAddr := addr - addr%c.lineSize
+	if owner, ok := c.held[lineAddr]; ok && owner == core {
+		delete(c.held, lineAddr)
+	}
+}
+
+// Protocol returns the name of the protocol in use
+func (c *Controller) Protocol() string {
+	return c.protocol.Name()
+}
+
+// GetStats returns a copy of the controller's counters
+func (c *Controller) GetStats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.stats
+}
+
+// Reset forgets every line state and held line and zeroes the counters
+func (c *Controller) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lines = make(map[uint64][]State)
+	c.held = make(map[uint64]int)
+	c.stats = Stats{}
+	if c.sharing != nil {
+		c.sharing = newSharingTracker(c.lineSize)
+	}
+}
+
+// ResetStats zeroes the counters, keeping the line states and the offsets
+// cores have touched
+func (c *Controller) ResetStats() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stats = Stats{}
+	if c.sharing != nil {
+		c.sharing.counts = make(map[uint64]int64)
+	}
+}
+
+// Snapshot is a copy of the controller's line states and counters, for
+// checkpointing
+type Snapshot struct {
+	Lines        map[uint64][]State // line address -> per-core state
+	Held         map[uint64]int     // line address -> core whose atomic holds it
+	Stats        Stats
+	Touched      map[uint64][][]uint64 // line address -> per-core offsets touched, nil without false sharing detection
+	FalseSharing map[uint64]int64      // line address -> false sharing invalidations
+}
+
+// Snapshot returns a copy of the controller's state
+func (c *Controller) Snapshot() Snapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	lines := make(map[uint64][]State, len(c.lines))
+	for addr, states := range c.lines {
+		lines[addr] = append([]State(nil), states...)
+	}
+	snap := Snapshot{Lines: lines, Held: maps.Clone(c.held), Stats: c.stats}
+	if c.sharing != nil {
+		snap.Touched = make(map[uint64][][]uint64, len(c.sharing.touched))
+		for addr, cores := range c.sharing.touched {
+			touched := make([][]uint64, len(cores))
+			for i, offsets := range cores {
+				touched[i] = slices.Clone(offsets)
+			}
+			snap.Touched[addr] = touched
+		}
+		snap.FalseSharing = maps.Clone(c.sharing.counts)
+	}
+	return snap
+}
+
+// Restore replaces the controller's state with snap, which must come from a
+// controller for the same number of cores
+func (c *Controller) Restore(snap Snapshot) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	lines := make(map[uint64][]State, len(snap.Lines))
+	for addr, states := range snap.Lines {
+		if len(states) != c.numCores {
+			return fmt.Errorf("snapshot line %#x has %d core states, want %d", addr, len(states), c.numCores)
+		}
+		lines[addr] = append([]State(nil), states...)
+	}
+
+	held := make(map[uint64]int, len(snap.Held))
+	for addr, core := range snap.Held {
+		if core < 0 || core >= c.numCores {
+			return fmt.Errorf("snapshot line %#x is held by core %d of %d", addr, core, c.numCores)
+		}
+		held[addr] = core
+	}
+
+	if c.sharing != nil {
+		sharing := newSharingTracker(c.lineSize)
+		for addr, cores := range snap.Touched {
+			if len(cores) != c.numCores {
+				return fmt.Errorf("snapshot line %#x has %d cores' touched offsets, want %d", addr, len(cores), c.numCores)
+			}
+			touched := make([][]uint64, len(cores))
+			for i, offsets := range cores {
+				if offsets != nil && len(offsets) != int((c.lineSize+63)/64) {
+					return fmt.Errorf("snapshot line %#x has touched offsets for a %d-word line, want %d", addr, len(offsets), (c.lineSize+63)/64)
+				}
+				touched[i] = slices.Clone(offsets)
+			}
+			sharing.touched[addr] = touched
+		}
+		for addr, count := range snap.FalseSharing {
+			sharing.counts[addr] = count
+		}
+		c.sharing = sharing
+	}
+
+	c.lines = lines
+	c.held = held
+	c.stats = snap.Stats
+	return nil
+}
@@ -0,0 +1,329 @@
+package coherence
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewController(t *testing.T) {
+	if _, err := NewController("MESI", 4, 64); err != nil {
+		t.Errorf("NewController(MESI) error = %v", err)
+	}
+
+	for _, protocol := range []string{"MOESI", "MSI"} {
+		ctrl, err := NewController(protocol, 4, 64)
+		if err != nil {
+			t.Errorf("NewController(%s) error = %v", protocol, err)
+			continue
+		}
+		if ctrl.Protocol() != protocol {
+			t.Errorf("Protocol() = %s, want %s", ctrl.Protocol(), protocol)
+		}
+	}
+
+	if _, err := NewController("Invalid", 4, 64); err == nil {
+		t.Errorf("NewController(Invalid) should return error")
+	}
+
+	// Accepted by the configuration but not implemented yet
+	if _, err := NewController("MESIF", 4, 64); err == nil {
+		t.Errorf("NewController(MESIF) should return error")
+	}
+
+	if _, err := NewController("MESI", 0, 64); err == nil {
+		t.Errorf("NewController() with zero cores should return error")
+	}
+}
+
+func TestMESIReadStates(t *testing.T) {
+	ctrl, _ := NewController("MESI", 2, 64)
+
+	// A lone reader gets the line Exclusive
+	ctrl.Read(0, 0x1000)
+	if got := ctrl.State(0, 0x1000); got != Exclusive {
+		t.Errorf("After first read, core 0 state = %s, want Exclusive", got)
+	}
+
+	// A second reader demotes both copies to Shared
+	ctrl.Read(1, 0x1004)
+	if got := ctrl.State(0, 0x1000); got != Shared {
+		t.Errorf("After second read, core 0 state = %s, want Shared", got)
+	}
+	if got := ctrl.State(1, 0x1000); got != Shared {
+		t.Errorf("After second read, core 1 state = %s, want Shared", got)
+	}
+
+	// Hits on a valid line need no bus transaction
+	before := ctrl.GetStats().BusTransactions
+	if ctrl.Read(1, 0x1000) {
+		t.Errorf("Read() hit reported a bus transaction")
+	}
+	if ctrl.GetStats().BusTransactions != before {
+		t.Errorf("Read hit generated a bus transaction")
+	}
+}
+
+func TestMESIWriteInvalidatesSharers(t *testing.T) {
+	ctrl, _ := NewController("MESI", 3, 64)
+
+	var invalidated []uint64
+	ctrl.SetInvalidateHandler(1, func(addr uint64) {
+		invalidated = append(invalidated, addr)
+	})
+
+	ctrl.Read(0, 0x2000)
+	ctrl.Read(1, 0x2000)
+	ctrl.Write(0, 0x2010)
+
+	if got := ctrl.State(0, 0x2000); got != Modified {
+		t.Errorf("Writer state = %s, want Modified", got)
+	}
+
+	if got := ctrl.State(1, 0x2000); got != Invalid {
+		t.Errorf("Sharer state after remote write = %s, want Invalid", got)
+	}
+
+	stats := ctrl.GetStats()
+	if stats.Invalidations != 1 {
+		t.Errorf("Invalidations = %d, want 1", stats.Invalidations)
+	}
+
+	if len(invalidated) != 1 || invalidated[0] != 0x2000 {
+		t.Errorf("Invalidate handler called with %v, want [0x2000]", invalidated)
+	}
+
+	// A read of a Modified line forces a write-back and shares it
+	ctrl.Read(2, 0x2000)
+	if got := ctrl.State(0, 0x2000); got != Shared {
+		t.Errorf("Former writer state after remote read = %s, want Shared", got)
+	}
+
+	if ctrl.GetStats().WriteBacks != 1 {
+		t.Errorf("WriteBacks = %d, want 1", ctrl.GetStats().WriteBacks)
+	}
+}
+
+func TestSharers(t *testing.T) {
+	ctrl, _ := NewController("MESI", 3, 64)
+
+	if got := ctrl.Sharers(0, 0x3000); len(got) != 0 {
+		t.Errorf("Sharers() of an untouched line = %v, want none", got)
+	}
+
+	ctrl.Read(1, 0x3000)
+	ctrl.Read(2, 0x3008)
+	if got := ctrl.Sharers(0, 0x3010); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("Sharers(0) = %v, want [1 2]", got)
+	}
+
+	// The asking core is left out
+	if got := ctrl.Sharers(1, 0x3000); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("Sharers(1) = %v, want [2]", got)
+	}
+}
+
+func TestNeedsBus(t *testing.T) {
+	ctrl, _ := NewController("MESI", 2, 64)
+
+	if !ctrl.NeedsBus(0, 0x3000, false) {
+		t.Errorf("NeedsBus() for a read of an untouched line = false, want true")
+	}
+
+	ctrl.Read(0, 0x3000)
+	before := ctrl.GetStats()
+
+	tests := []struct {
+		name    string
+		core    int
+		isWrite bool
+		want    bool
+	}{
+		{"Exclusive read hit", 0, false, false},
+		{"Exclusive silent upgrade", 0, true, false},
+		{"Read of a line another core holds", 1, false, true},
+		{"Write of a line another core holds", 1, true, true},
+	}
+
+	for _, tt := range tests {
+		if got := ctrl.NeedsBus(tt.core, 0x3008, tt.isWrite); got != tt.want {
+			t.Errorf("%s: NeedsBus() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Asking changes nothing
+	if got := ctrl.State(0, 0x3000); got != Exclusive {
+		t.Errorf("State after NeedsBus() = %s, want Exclusive", got)
+	}
+	if ctrl.GetStats() != before {
+		t.Errorf("GetStats() after NeedsBus() = %+v, want %+v", ctrl.GetStats(), before)
+	}
+}
+
+func TestAtomicLock(t *testing.T) {
+	ctrl, _ := NewController("MESI", 3, 64)
+
+	ctrl.Lock(1, 0x3008)
+
+	tests := []struct {
+		core int
+		want bool
+	}{
+		{0, true},
+		{1, false}, // the holder itself
+		{2, true},
+	}
+	for _, tt := range tests {
+		if got := ctrl.Blocked(tt.core, 0x3030); got != tt.want {
+			t.Errorf("Blocked(%d) on a line core 1 holds = %v, want %v", tt.core, got, tt.want)
+		}
+	}
+	if ctrl.Blocked(0, 0x3040) {
+		t.Errorf("Blocked() on another line = true, want false")
+	}
+
+	if stats := ctrl.GetStats(); stats.Atomics != 1 || stats.AtomicContention != 2 {
+		t.Errorf("Atomics = %d, AtomicContention = %d, want 1 and 2", stats.Atomics, stats.AtomicContention)
+	}
+
+	restored, _ := NewController("MESI", 3, 64)
+	if err := restored.Restore(ctrl.Snapshot()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !restored.Blocked(0, 0x3000) {
+		t.Errorf("Blocked() after Restore() = false, want the line still held")
+	}
+
+	// Only the holder releases the line
+	ctrl.Unlock(0, 0x3000)
+	if !ctrl.Blocked(0, 0x3000) {
+		t.Errorf("Blocked() after another core's Unlock() = false, want true")
+	}
+	ctrl.Unlock(1, 0x3000)
+	if ctrl.Blocked(0, 0x3000) {
+		t.Errorf("Blocked() after Unlock() = true, want false")
+	}
+
+	ctrl.Lock(2, 0x3000)
+	ctrl.Reset()
+	if ctrl.Blocked(0, 0x3000) {
+		t.Errorf("Blocked() after Reset() = true, want false")
+	}
+}
+
+func TestMESISilentUpgrade(t *testing.T) {
+	ctrl, _ := NewController("MESI", 2, 64)
+
+	ctrl.Read(0, 0x3000)
+	before := ctrl.GetStats().BusTransactions
+
+	// Exclusive -> Modified needs no bus transaction
+	ctrl.Write(0, 0x3000)
+	if ctrl.GetStats().BusTransactions != before {
+		t.Errorf("Write to an Exclusive line generated a bus transaction")
+	}
+
+	if got := ctrl.State(0, 0x3000); got != Modified {
+		t.Errorf("State after write = %s, want Modified", got)
+	}
+}
+
+func TestMOESIOwnedState(t *testing.T) {
+	ctrl, _ := NewController("MOESI", 3, 64)
+
+	// A read of a Modified line leaves it dirty in its owner
+	ctrl.Write(0, 0x5000)
+	ctrl.Read(1, 0x5000)
+	if got := ctrl.State(0, 0x5000); got != Owned {
+		t.Errorf("Former writer state after remote read = %s, want Owned", got)
+	}
+	if got := ctrl.State(1, 0x5000); got != Shared {
+		t.Errorf("Reader state = %s, want Shared", got)
+	}
+	if ctrl.GetStats().WriteBacks != 0 {
+		t.Errorf("WriteBacks = %d after a read of a Modified line, want 0", ctrl.GetStats().WriteBacks)
+	}
+
+	// Further readers share the line with the owner in place
+	ctrl.Read(2, 0x5000)
+	if got := ctrl.State(0, 0x5000); got != Owned {
+		t.Errorf("Owner state after a second remote read = %s, want Owned", got)
+	}
+
+	// A store by a sharer invalidates the owner, which writes its data back
+	ctrl.Write(1, 0x5000)
+	if got := ctrl.State(0, 0x5000); got != Invalid {
+		t.Errorf("Owner state after remote write = %s, want Invalid", got)
+	}
+	if stats := ctrl.GetStats(); stats.WriteBacks != 1 || stats.Invalidations != 2 {
+		t.Errorf("WriteBacks = %d, Invalidations = %d, want 1 and 2", stats.WriteBacks, stats.Invalidations)
+	}
+}
+
+func TestMSINoExclusive(t *testing.T) {
+	ctrl, _ := NewController("MSI", 2, 64)
+
+	// A lone reader still gets the line Shared
+	ctrl.Read(0, 0x6000)
+	if got := ctrl.State(0, 0x6000); got != Shared {
+		t.Errorf("After first read, core 0 state = %s, want Shared", got)
+	}
+
+	// So its first write needs the bus
+	before := ctrl.GetStats().BusTransactions
+	if !ctrl.Write(0, 0x6000) {
+		t.Errorf("Write() to a Shared line reported no bus transaction")
+	}
+	if ctrl.GetStats().BusTransactions != before+1 {
+		t.Errorf("Write to a Shared line generated no bus transaction")
+	}
+
+	// Later writes hit in Modified
+	if ctrl.Write(0, 0x6000) {
+		t.Errorf("Write() to a Modified line reported a bus transaction")
+	}
+
+	ctrl.Read(1, 0x6000)
+	if got := ctrl.State(0, 0x6000); got != Shared {
+		t.Errorf("Former writer state after remote read = %s, want Shared", got)
+	}
+	if ctrl.GetStats().WriteBacks != 1 {
+		t.Errorf("WriteBacks = %d, want 1", ctrl.GetStats().WriteBacks)
+	}
+}
+
+func TestMOESIFewerWriteBacks(t *testing.T) {
+	// Two cores take turns reading and then modifying a shared counter
+	run := func(protocol string) Stats {
+		ctrl, err := NewController(protocol, 2, 64)
+		if err != nil {
+			t.Fatalf("NewController(%s) error = %v", protocol, err)
+		}
+
+		for i := 0; i < 10; i++ {
+			core := i % 2
+			ctrl.Read(core, 0x7000)
+			ctrl.Write(core, 0x7000)
+			ctrl.Read(1-core, 0x7000)
+		}
+		return ctrl.GetStats()
+	}
+
+	mesi, moesi := run("MESI"), run("MOESI")
+	if moesi.WriteBacks >= mesi.WriteBacks {
+		t.Errorf("MOESI WriteBacks = %d, want fewer than MESI's %d", moesi.WriteBacks, mesi.WriteBacks)
+	}
+}
+
+func TestControllerReset(t *testing.T) {
+	ctrl, _ := NewController("MESI", 2, 64)
+	ctrl.Write(0, 0x4000)
+	ctrl.Reset()
+
+	if got := ctrl.State(0, 0x4000); got != Invalid {
+		t.Errorf("State after Reset() = %s, want Invalid", got)
+	}
+
+	if stats := ctrl.GetStats(); stats != (Stats{}) {
+		t.Errorf("Stats after Reset() = %+v, want zero", stats)
+	}
+}
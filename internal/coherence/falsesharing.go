@@ -0,0 +1,75 @@
+package coherence
+
+import (
+	"cmp"
+	"slices"
+)
+
+// FalseSharingLine counts the invalidations of a line that took it from a
+// core which had touched none of the bytes the invalidating store wrote
+type FalseSharingLine struct {
+	Address       uint64 `json:"address"`
+	Invalidations int64  `json:"invalidations"`
+}
+
+// sharingTracker records the byte offsets each core touches in a line
+// while it holds a copy, to tell false sharing from true sharing
+type sharingTracker struct {
+	lineSize uint64
+	touched  map[uint64][][]uint64 // line address -> per-core bitset of offsets touched
+	counts   map[uint64]int64      // line address -> false sharing invalidations
+}
+
+func newSharingTracker(lineSize uint64) *sharingTracker {
+	return &sharingTracker{
+		lineSize: lineSize,
+		touched:  make(map[uint64][][]uint64),
+		counts:   make(map[uint64]int64),
+	}
+}
+
+// touch records that core accessed the byte at offset in the line at
+// lineAddr
+func (t *sharingTracker) touch(core, numCores int, lineAddr, offset uint64) {
+	cores, ok := t.touched[lineAddr]
+	if !ok {
+		cores = make([][]uint64, numCores)
+		t.touched[lineAddr] = cores
+	}
+	if cores[core] == nil {
+		cores[core] = make([]uint64, (t.lineSize+63)/64)
+	}
+	cores[core][offset/64] |= 1 << (offset % 64)
+}
+
+// invalidate counts a false sharing invalidation if victim never touched
+// the offset a store by another core wrote, and forgets what victim
+// touched now that it has lost its copy
+func (t *sharingTracker) invalidate(victim int, lineAddr, offset uint64) {
+	cores := t.touched[lineAddr]
+	if cores == nil || cores[victim] == nil {
+		return
+	}
+
+	if cores[victim][offset/64]&(1<<(offset%64)) == 0 {
+		t.counts[lineAddr]++
+	}
+	cores[victim] = nil
+}
+
+// hottest returns up to n lines with the most false sharing
+// invalidations, most first
+func (t *sharingTracker) hottest(n int) []FalseSharingLine {
+	lines := make([]FalseSharingLine, 0, len(t.counts))
+	for addr, count := range t.counts {
+		lines = append(lines, FalseSharingLine{Address: addr, Invalidations: count})
+	}
+
+	slices.SortFunc(lines, func(a, b FalseSharingLine) int {
+		if c := cmp.Compare(b.Invalidations, a.Invalidations); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Address, b.Address)
+	})
+	return lines[:min(n, len(lines))]
+}
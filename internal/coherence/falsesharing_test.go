@@ -0,0 +1,73 @@
+package coherence
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFalseSharing(t *testing.T) {
+	ctrl, _ := NewController("MESI", 2, 64)
+	if got := ctrl.FalseSharing(5); got != nil {
+		t.Errorf("FalseSharing() without detection = %v, want nil", got)
+	}
+	ctrl.SetFalseSharingDetection(true)
+
+	// The cores ping-pong 0x1000 storing to different words of it, and
+	// 0x2000 storing to the same word
+	for i := 0; i < 4; i++ {
+		ctrl.Write(0, 0x1000)
+		ctrl.Write(1, 0x1008)
+		ctrl.Write(0, 0x2010)
+		ctrl.Write(1, 0x2010)
+	}
+
+	// Core 1 reads a word of 0x3000 that core 0 then stores to
+	ctrl.Read(1, 0x3020)
+	ctrl.Write(0, 0x3020)
+
+	// Core 1 reads another word of 0x4000 than core 0 stores to
+	ctrl.Read(1, 0x4000)
+	ctrl.Write(0, 0x403f)
+
+	want := []FalseSharingLine{
+		{Address: 0x1000, Invalidations: 7},
+		{Address: 0x4000, Invalidations: 1},
+	}
+	if got := ctrl.FalseSharing(5); !reflect.DeepEqual(got, want) {
+		t.Errorf("FalseSharing(5) = %v, want %v", got, want)
+	}
+	if got := ctrl.FalseSharing(1); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("FalseSharing(1) = %v, want %v", got, want[:1])
+	}
+
+	// Invalidations by true sharing still count as invalidations
+	if got := ctrl.GetStats().Invalidations; got != 16 {
+		t.Errorf("Invalidations = %d, want 16", got)
+	}
+
+	snap := ctrl.Snapshot()
+	restored, _ := NewController("MESI", 2, 64)
+	restored.SetFalseSharingDetection(true)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got := restored.FalseSharing(5); !reflect.DeepEqual(got, want) {
+		t.Errorf("FalseSharing(5) after Restore() = %v, want %v", got, want)
+	}
+
+	// Core 1 still holds what it last touched of 0x1000 after the restore
+	restored.Write(0, 0x1000)
+	if got := restored.FalseSharing(1); got[0].Invalidations != 8 {
+		t.Errorf("FalseSharing(1) after another store = %v, want 8 invalidations", got)
+	}
+
+	ctrl.ResetStats()
+	if got := ctrl.FalseSharing(5); len(got) != 0 {
+		t.Errorf("FalseSharing() after ResetStats() = %v, want none", got)
+	}
+
+	ctrl.SetFalseSharingDetection(false)
+	if got := ctrl.FalseSharing(5); got != nil {
+		t.Errorf("FalseSharing() after disabling detection = %v, want nil", got)
+	}
+}
@@ -0,0 +1,160 @@
+package coherence
+
+import "fmt"
+
+// Protocol defines the state transitions of a snooping coherence protocol
+type Protocol interface {
+	// Name returns the protocol name as used in the configuration
+	Name() string
+
+	// Read returns the requester's new state after a load given its current
+	// state and whether any other core holds a valid copy, and whether the
+	// load needs a bus transaction
+	Read(local State, othersValid bool) (next State, busTx bool)
+
+	// SnoopRead returns a remote holder's new state when another core reads
+	// the line, and whether the holder must write dirty data back
+	SnoopRead(remote State) (next State, writeBack bool)
+
+	// Write returns the requester's new state after a store given its
+	// current state, and whether the store needs a bus transaction
+	Write(local State) (next State, busTx bool)
+
+	// SnoopWrite returns a remote holder's new state when another core
+	// writes the line, and whether the holder must write dirty data back
+	SnoopWrite(remote State) (next State, writeBack bool)
+}
+
+// NewProtocol returns the protocol implementation for the given name
+func NewProtocol(name string) (Protocol, error) {
+	switch name {
+	case "MESI":
+		return MESI{}, nil
+	case "MOESI":
+		return MOESI{}, nil
+	case "MSI":
+		return MSI{}, nil
+	default:
+		return nil, fmt.Errorf("coherence protocol %s is not implemented", name)
+	}
+}
+
+// MESI implements the Modified/Exclusive/Shared/Invalid protocol
+type MESI struct{}
+
+// Name returns "MESI"
+func (MESI) Name() string {
+	return "MESI"
+}
+
+// Read fills an invalid line Exclusive when no other core has it, else Shared
+func (MESI) Read(local State, othersValid bool) (State, bool) {
+	if local != Invalid {
+		return local, false
+	}
+
+	if othersValid {
+		return Shared, true
+	}
+	return Exclusive, true
+}
+
+// SnoopRead demotes Modified and Exclusive copies to Shared
+func (MESI) SnoopRead(remote State) (State, bool) {
+	switch remote {
+	case Modified:
+		return Shared, true
+	case Exclusive:
+		return Shared, false
+	default:
+		return remote, false
+	}
+}
+
+// Write upgrades to Modified, silently from Exclusive
+func (MESI) Write(local State) (State, bool) {
+	switch local {
+	case Modified, Exclusive:
+		return Modified, false
+	default:
+		return Modified, true
+	}
+}
+
+// SnoopWrite invalidates every other copy
+func (MESI) SnoopWrite(remote State) (State, bool) {
+	return Invalid, remote == Modified
+}
+
+// MOESI extends MESI with an Owned state: a Modified line read by another
+// core stays dirty in its owner, which supplies the data, instead of being
+// written back
+type MOESI struct{}
+
+// Name returns "MOESI"
+func (MOESI) Name() string {
+	return "MOESI"
+}
+
+// Read fills an invalid line Exclusive when no other core has it, else Shared
+func (MOESI) Read(local State, othersValid bool) (State, bool) {
+	return MESI{}.Read(local, othersValid)
+}
+
+// SnoopRead demotes Modified to Owned without a write-back, and Exclusive to
+// Shared; an Owned copy stays Owned
+func (MOESI) SnoopRead(remote State) (State, bool) {
+	switch remote {
+	case Modified:
+		return Owned, false
+	case Exclusive:
+		return Shared, false
+	default:
+		return remote, false
+	}
+}
+
+// Write upgrades to Modified, silently from Exclusive
+func (MOESI) Write(local State) (State, bool) {
+	return MESI{}.Write(local)
+}
+
+// SnoopWrite invalidates every other copy, writing back dirty ones
+func (MOESI) SnoopWrite(remote State) (State, bool) {
+	return Invalid, remote == Modified || remote == Owned
+}
+
+// MSI implements the Modified/Shared/Invalid protocol. Without an Exclusive
+// state every first write to a line needs the bus.
+type MSI struct{}
+
+// Name returns "MSI"
+func (MSI) Name() string {
+	return "MSI"
+}
+
+// Read fills an invalid line Shared
+func (MSI) Read(local State, othersValid bool) (State, bool) {
+	if local != Invalid {
+		return local, false
+	}
+	return Shared, true
+}
+
+// SnoopRead demotes a Modified copy to Shared, writing it back
+func (MSI) SnoopRead(remote State) (State, bool) {
+	if remote == Modified {
+		return Shared, true
+	}
+	return remote, false
+}
+
+// Write upgrades to Modified, on the bus unless already Modified
+func (MSI) Write(local State) (State, bool) {
+	return Modified, local != Modified
+}
+
+// SnoopWrite invalidates every other copy
+func (MSI) SnoopWrite(remote State) (State, bool) {
+	return Invalid, remote == Modified
+}
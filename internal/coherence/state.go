@@ -0,0 +1,55 @@
+package coherence
+
+import "fmt"
+
+// State is the coherence state of a cache line in one core's cache
+type State int
+
+const (
+	Invalid State = iota
+	Shared
+	Exclusive
+	Modified
+	Owned   // MOESI: dirty, possibly shared, this core supplies the data
+	Forward // MESIF: clean, shared, this core answers requests
+)
+
+// String returns the full name of the state
+func (s State) String() string {
+	switch s {
+	case Invalid:
+		return "Invalid"
+	case Shared:
+		return "Shared"
+	case Exclusive:
+		return "Exclusive"
+	case Modified:
+		return "Modified"
+	case Owned:
+		return "Owned"
+	case Forward:
+		return "Forward"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// ParseState converts a single-letter state abbreviation (M, O, E, S, I, F)
+func ParseState(s string) (State, error) {
+	switch s {
+	case "I":
+		return Invalid, nil
+	case "S":
+		return Shared, nil
+	case "E":
+		return Exclusive, nil
+	case "M":
+		return Modified, nil
+	case "O":
+		return Owned, nil
+	case "F":
+		return Forward, nil
+	default:
+		return Invalid, fmt.Errorf("unknown coherence state: %s", s)
+	}
+}
@@ -2,62 +2,433 @@ package config
 
 import (
 	"fmt"
+	"maps"
+	"math"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// FullyAssociative is the associativity of a cache or TLB that keeps all
+// its lines or entries in a single set
+const FullyAssociative = -1
+
 // Config represents the simulator configuration
 type Config struct {
 	// Core configuration
-	NumCores       int    `yaml:"numCores"`
-	ClockFrequency int    `yaml:"clockFrequency"` // MHz
-	ISA            string `yaml:"isa"`            // Instruction Set Architecture
-	PipelineDepth  int    `yaml:"pipelineDepth"`
+	NumCores          int    `yaml:"numCores"`
+	ClockFrequency    int    `yaml:"clockFrequency"` // MHz
+	ISA               string `yaml:"isa"`            // Instruction Set Architecture
+	PipelineDepth     int    `yaml:"pipelineDepth"`
+	IssueWidth        int    `yaml:"issueWidth"`        // instructions fetched and advanced per stage each cycle
+	FetchInterval     int    `yaml:"fetchInterval"`     // cycles between fetch attempts; 0 means 1
+	FetchQueueSize    int    `yaml:"fetchQueueSize"`    // instructions fetched ahead of the pipeline per core; 0 fetches straight into its first stage
+	FlushPenalty      bool   `yaml:"flushPenalty"`      // full pipeline flushes for exceptions and coherence stall fetch for the front-end stages, as mispredicts always do
+	FlushOnInvalidate bool   `yaml:"flushOnInvalidate"` // flush the pipeline when another core invalidates a line a load in flight has read
+	SyncMode          bool   `yaml:"syncMode"`          // advance all cores in lockstep, one cycle at a time
+	Engine            string `yaml:"engine"`            // "cycle" steps every cycle, "event" jumps over cycles where no core has work; empty means cycle
+	WarmupCycles      int    `yaml:"warmupCycles"`      // cycles run before the first measured run and left out of the statistics; 0 disables
+	MaxInstructions   int64  `yaml:"maxInstructions"`   // instructions retired across all cores that stop a run early; 0 is unlimited
+	DeadlockCycles    int    `yaml:"deadlockCycles"`    // cycles with instructions in flight but none retired that abort a run as deadlocked; 0 disables, needs syncMode
+	ThreadsPerCore    int    `yaml:"threadsPerCore"`    // hardware threads sharing each core's pipeline; 0 means 1
+
+	// Execution units per core
+	NumALUs      int `yaml:"numALUs"`
+	NumFPUs      int `yaml:"numFPUs"`
+	NumLoadStore int `yaml:"numLoadStore"`
+	NumBranch    int `yaml:"numBranch"`
+
+	// Heterogeneous cores. Each core is built from the settings above with
+	// its core type's non-zero fields overriding them.
+	CoreTypes      []CoreType `yaml:"coreTypes"`      // empty builds every core alike
+	CoreAssignment []string   `yaml:"coreAssignment"` // core type name per core; empty assigns the types round-robin
+
+	// Forward results to dependent instructions ahead of Writeback
+	ForwardingEnabled bool `yaml:"forwardingEnabled"`
+
+	// Cycles spent in pipeline stages, by stage name, overriding the built-in
+	// latencies; stages left out keep theirs
+	StageLatencies map[string]int `yaml:"stageLatencies"`
+
+	// Out-of-order issue from a reorder buffer; in-order when disabled
+	OutOfOrder          bool `yaml:"outOfOrder"`
+	ROBSize             int  `yaml:"robSize"`             // reorder buffer entries
+	ReservationStations int  `yaml:"reservationStations"` // instructions waiting to issue
+
+	// Branch prediction
+	BranchPredictor     string `yaml:"branchPredictor"`     // static, bimodal, gshare; empty uses static
+	PredicationDistance int    `yaml:"predicationDistance"` // forward branches skipping at most this many instructions run predicated, as on ARM; 0 disables
+
+	// Pipeline stage power-gating
+	PowerGateIdleThreshold int `yaml:"powerGateIdleThreshold"` // idle cycles before gating, 0 disables
+	PowerGateWakeLatency   int `yaml:"powerGateWakeLatency"`   // cycles
+
+	// Periodic external interrupts
+	InterruptInterval            int    `yaml:"interruptInterval"`            // cycles, 0 disables
+	InterruptHandlerAddress      uint64 `yaml:"interruptHandlerAddress"`      // handler entry point
+	InterruptHandlerInstructions int    `yaml:"interruptHandlerInstructions"` // instructions the handler retires before returning
+	InterruptEntryCycles         int    `yaml:"interruptEntryCycles"`         // cycles
+	InterruptExitCycles          int    `yaml:"interruptExitCycles"`          // cycles
 
 	// Memory hierarchy
-	L1Size          int `yaml:"l1Size"` // KB
-	L1Associativity int `yaml:"l1Associativity"`
-	L1Latency       int `yaml:"l1Latency"` // cycles
+	CacheLineSize     int    `yaml:"cacheLineSize"`     // bytes, a power of two; 0 is 64
+	ReplacementPolicy string `yaml:"replacementPolicy"` // lru, fifo, random, plru; used by every level, empty means lru
+
+	L1Size          int    `yaml:"l1Size"`          // KB
+	L1Associativity int    `yaml:"l1Associativity"` // ways per set, at most the number of lines; -1 is fully associative
+	L1Latency       int    `yaml:"l1Latency"`       // cycles
+	L1WritePolicy   string `yaml:"l1WritePolicy"`   // write-back, write-through
+
+	L2Size          int    `yaml:"l2Size"`          // KB
+	L2Associativity int    `yaml:"l2Associativity"` // ways per set, at most the number of lines; -1 is fully associative
+	L2Latency       int    `yaml:"l2Latency"`       // cycles
+	L2WritePolicy   string `yaml:"l2WritePolicy"`   // write-back, write-through
 
-	L2Size          int `yaml:"l2Size"` // KB
-	L2Associativity int `yaml:"l2Associativity"`
-	L2Latency       int `yaml:"l2Latency"` // cycles
+	L3Size          int  `yaml:"l3Size"`          // KB
+	L3Associativity int  `yaml:"l3Associativity"` // ways per set, at most the number of lines; -1 is fully associative
+	L3Latency       int  `yaml:"l3Latency"`       // cycles
+	L3Shared        bool `yaml:"l3Shared"`        // one L3 of L3Size shared by every core instead of one per core
 
-	L3Size          int `yaml:"l3Size"` // KB
-	L3Associativity int `yaml:"l3Associativity"`
-	L3Latency       int `yaml:"l3Latency"` // cycles
+	CacheInclusionPolicy string `yaml:"cacheInclusionPolicy"` // inclusive, exclusive, NINE; whether lower levels keep copies of upper levels' lines, empty means NINE
+
+	PrefetchPolicy string `yaml:"prefetchPolicy"` // none, next-line, stride; prefetches into L1
 
 	MemoryLatency int `yaml:"memoryLatency"` // cycles
+	MemoryPorts   int `yaml:"memoryPorts"`   // data accesses all cores can start per cycle, 0 is unlimited; needs syncMode
+
+	HitUnderMissLatency int `yaml:"hitUnderMissLatency"` // extra cycles an L1 data hit takes while the core has a miss outstanding and other cores contend for the memory ports
+
+	MemorySize        uint64 `yaml:"memorySize"`        // bytes of physical memory; accesses at or past it fault. 0 is unlimited
+	HaltOnMemoryFault bool   `yaml:"haltOnMemoryFault"` // stop a core at its first memory fault instead of counting and carrying on
+
+	StoreBufferEntries int `yaml:"storeBufferEntries"` // stores buffered per core on their way to the cache, 0 writes the cache directly
+
+	LatencyBuckets []int `yaml:"latencyBuckets"` // ascending upper bounds in cycles of the memory latency histogram buckets, slower accesses fall in a last open-ended bucket; empty disables the histogram
+
+	// NUMA memory, interleaved across nodes page by page
+	NUMANodes         int   `yaml:"numaNodes"`         // memory nodes, 0 or 1 is uniform memory
+	NUMACoreNodes     []int `yaml:"numaCoreNodes"`     // node of each core; empty splits the cores evenly in ID order
+	NUMARemotePenalty int   `yaml:"numaRemotePenalty"` // extra cycles to reach memory homed on another node
+
+	// DRAM banks, each with a row buffer; memoryLatency is then the latency of an access to the open row
+	DRAMBanks            int `yaml:"dramBanks"`            // banks, a power of two; 0 disables the bank and row model
+	DRAMBankShift        int `yaml:"dramBankShift"`        // lowest address bit of the bank index; the bits below pick a column of the row
+	DRAMRowShift         int `yaml:"dramRowShift"`         // lowest address bit of the row index, above the bank bits
+	DRAMActivateLatency  int `yaml:"dramActivateLatency"`  // extra cycles to open a row in a bank with none open
+	DRAMPrechargeLatency int `yaml:"dramPrechargeLatency"` // further cycles to close the bank's open row first
+
+	// Address translation, through a TLB per core in front of the caches
+	TLBEntries       int `yaml:"tlbEntries"`       // translations cached per core, 0 disables translation
+	TLBAssociativity int `yaml:"tlbAssociativity"` // entries per set, replaced at random; 0 or 1 is direct-mapped, -1 fully associative
+	PageSize         int `yaml:"pageSize"`         // bytes, a power of two
+	PageWalkLatency  int `yaml:"pageWalkLatency"`  // cycles added to an access that misses in the TLB
+
+	// Write-combining buffer for streaming stores, one per core shared by
+	// its hardware threads; drained by interrupts, full flushes and the end
+	// of a run whatever the policy
+	WriteCombiningEntries     int    `yaml:"writeCombiningEntries"`     // lines buffered per core, 0 disables
+	WriteCombiningFlushPolicy string `yaml:"writeCombiningFlushPolicy"` // full-line, fence, eviction
 
 	// Cache coherence protocol
 	CoherenceProtocol string `yaml:"coherenceProtocol"` // MESI, MOESI, etc.
+	FalseSharingLines int    `yaml:"falseSharingLines"` // lines with the most false sharing invalidations to report, 0 disables detection
+	CacheToCacheFetch bool   `yaml:"cacheToCacheFetch"` // instruction fetches missing every cache are served by another core's cache holding the line
 
 	// Interconnect
-	InterconnectType      string `yaml:"interconnectType"`      // bus, ring, mesh, etc.
-	InterconnectBandwidth int    `yaml:"interconnectBandwidth"` // GB/s
+	InterconnectType      string  `yaml:"interconnectType"`      // bus, ring, mesh, etc.
+	InterconnectBandwidth int     `yaml:"interconnectBandwidth"` // GB/s
+	PerHopLatency         int     `yaml:"perHopLatency"`         // cycles a ring, mesh or torus message spends on each link it crosses
+	MeshAspectRatio       float64 `yaml:"meshAspectRatio"`       // columns per row of the mesh or torus grid; 0 picks the squarest
+
+	// Bus arbitration, used when InterconnectType is "bus" and the cores run
+	// in lockstep, with syncMode or the event engine
+	BusArbitrationPolicy string `yaml:"busArbitrationPolicy"` // round-robin, priority, fixed
+	BusPriorities        []int  `yaml:"busPriorities"`        // per-core priority for the priority policy, higher wins
+
+	// Energy model. Dynamic energy is charged per retired instruction and per
+	// access to each cache level and to memory; leakage is charged per core
+	// for the simulated time, except for the share of pipeline stages while
+	// they are power-gated.
+	EnergyInteger float64 `yaml:"energyInteger"` // picojoules per retired integer instruction
+	EnergyFloat   float64 `yaml:"energyFloat"`   // picojoules per retired floating-point instruction
+	EnergyMemory  float64 `yaml:"energyMemory"`  // picojoules per retired load or store, excluding the caches
+	EnergyBranch  float64 `yaml:"energyBranch"`  // picojoules per retired branch
+	EnergyL1      float64 `yaml:"energyL1"`      // picojoules per L1 access
+	EnergyL2      float64 `yaml:"energyL2"`      // picojoules per L2 access
+	EnergyL3      float64 `yaml:"energyL3"`      // picojoules per L3 access
+	EnergyDRAM    float64 `yaml:"energyDRAM"`    // picojoules per line read from or written to memory
+	LeakagePower  float64 `yaml:"leakagePower"`  // milliwatts of static power per core
 
 	// Workload
-	WorkloadPath string `yaml:"workloadPath"`
+	WorkloadPath    string `yaml:"workloadPath"`    // empty uses the synthetic generator
+	ProfileHotspots bool   `yaml:"profileHotspots"` // count retirements per instruction address, at a cost in memory per address
+
+	// Synthetic instruction mix, in percent; must sum to 100, or all be zero
+	// for integer ADDs only
+	MixInteger int `yaml:"mixInteger"`
+	MixFloat   int `yaml:"mixFloat"`
+	MixMemory  int `yaml:"mixMemory"`
+	MixBranch  int `yaml:"mixBranch"`
+
+	RandSeed int64 `yaml:"randSeed"` // seeds every randomized decision, so runs are reproducible
+}
+
+// CoreType describes one kind of core, such as the big or little cores of a
+// big.LITTLE design. Zero fields inherit the top-level setting.
+type CoreType struct {
+	Name           string `yaml:"name"`
+	ISA            string `yaml:"isa"`
+	PipelineDepth  int    `yaml:"pipelineDepth"`
+	IssueWidth     int    `yaml:"issueWidth"`
+	NumALUs        int    `yaml:"numALUs"`
+	NumFPUs        int    `yaml:"numFPUs"`
+	NumLoadStore   int    `yaml:"numLoadStore"`
+	NumBranch      int    `yaml:"numBranch"`
+	ClockFrequency int    `yaml:"clockFrequency"` // MHz; a clock other than the top-level one needs syncMode
+}
+
+// CoreTypeName returns the name of the core type core id is built from, or
+// "" if every core is built alike
+func (c *Config) CoreTypeName(id int) string {
+	if len(c.CoreTypes) == 0 {
+		return ""
+	}
+
+	if len(c.CoreAssignment) > 0 {
+		return c.CoreAssignment[id]
+	}
+	return c.CoreTypes[id%len(c.CoreTypes)].Name
+}
+
+// NUMANode returns the NUMA node core id belongs to
+func (c *Config) NUMANode(id int) int {
+	if c.NUMANodes <= 1 {
+		return 0
+	}
+
+	if len(c.NUMACoreNodes) > 0 {
+		return c.NUMACoreNodes[id]
+	}
+	return id * c.NUMANodes / c.NumCores
+}
+
+// LineSize returns the cache line size in bytes, 64 if unset
+func (c *Config) LineSize() int {
+	if c.CacheLineSize <= 0 {
+		return 64
+	}
+	return c.CacheLineSize
+}
+
+// Ways returns the lines per set of a sizeKB cache with the given
+// associativity, every line it holds if it is FullyAssociative
+func (c *Config) Ways(sizeKB, associativity int) int {
+	if associativity == FullyAssociative {
+		return sizeKB * 1024 / c.LineSize()
+	}
+	return associativity
+}
+
+// GridDimensions returns the rows and columns of the grid a mesh or torus
+// lays the cores out on: the squarest grid NumCores fill, or with
+// MeshAspectRatio set, the one with that many columns per row. ok is false
+// if NumCores cannot form such a grid.
+func (c *Config) GridDimensions() (rows, cols int, ok bool) {
+	if c.MeshAspectRatio == 0 {
+		for rows = int(math.Sqrt(float64(c.NumCores))); rows >= 1; rows-- {
+			if c.NumCores%rows == 0 {
+				return rows, c.NumCores / rows, true
+			}
+		}
+		return 0, 0, false
+	}
+
+	for rows = 1; rows <= c.NumCores; rows++ {
+		cols = c.NumCores / rows
+		if rows*cols == c.NumCores && math.Abs(float64(cols)/float64(rows)-c.MeshAspectRatio) < 1e-9 {
+			return rows, cols, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Threads returns the number of hardware threads per core, at least 1
+func (c *Config) Threads() int {
+	if c.ThreadsPerCore < 1 {
+		return 1
+	}
+	return c.ThreadsPerCore
+}
+
+// ForCore returns the configuration core id is built from: a copy with its
+// core type's settings applied, or c itself if every core is built alike
+func (c *Config) ForCore(id int) *Config {
+	name := c.CoreTypeName(id)
+	if name == "" {
+		return c
+	}
+
+	coreCfg := *c
+	for _, ct := range c.CoreTypes {
+		if ct.Name != name {
+			continue
+		}
+
+		if ct.ISA != "" {
+			coreCfg.ISA = ct.ISA
+		}
+		if ct.PipelineDepth != 0 {
+			coreCfg.PipelineDepth = ct.PipelineDepth
+		}
+		if ct.IssueWidth != 0 {
+			coreCfg.IssueWidth = ct.IssueWidth
+		}
+		if ct.NumALUs != 0 {
+			coreCfg.NumALUs = ct.NumALUs
+		}
+		if ct.NumFPUs != 0 {
+			coreCfg.NumFPUs = ct.NumFPUs
+		}
+		if ct.NumLoadStore != 0 {
+			coreCfg.NumLoadStore = ct.NumLoadStore
+		}
+		if ct.NumBranch != 0 {
+			coreCfg.NumBranch = ct.NumBranch
+		}
+		if ct.ClockFrequency != 0 {
+			coreCfg.ClockFrequency = ct.ClockFrequency
+		}
+		break
+	}
+	return &coreCfg
 }
 
-// LoadConfig loads configuration from a YAML file
+// Clone returns a deep copy of c, so changes to either leave the other alone
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.CoreTypes = append([]CoreType(nil), c.CoreTypes...)
+	clone.CoreAssignment = append([]string(nil), c.CoreAssignment...)
+	clone.NUMACoreNodes = append([]int(nil), c.NUMACoreNodes...)
+	clone.BusPriorities = append([]int(nil), c.BusPriorities...)
+	clone.LatencyBuckets = append([]int(nil), c.LatencyBuckets...)
+	clone.StageLatencies = maps.Clone(c.StageLatencies)
+	return &clone
+}
+
+// LoadConfig loads configuration from a YAML file, or a TOML file if the
+// path ends in .toml. Both formats use the same key names, and fields the
+// file leaves out take their DefaultConfig values.
+//
+// A file may name a base config with an include key, for example
+//
+//	include: base.yaml
+//	numCores: 8
+//
+// The base is loaded first and the including file's fields overlay it. A
+// relative include resolves against the including file's directory, and
+// includes may nest but not loop back on themselves.
 func LoadConfig(path string) (*Config, error) {
+	return loadConfig(path, strings.EqualFold(filepath.Ext(path), ".toml"))
+}
+
+// LoadConfigTOML loads configuration from a TOML file, with fields it leaves
+// out taking their DefaultConfig values
+func LoadConfigTOML(path string) (*Config, error) {
+	return loadConfig(path, true)
+}
+
+func loadConfig(path string, isTOML bool) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := overlayConfig(cfg, path, isTOML, nil); err != nil {
+		return nil, err
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// overlayConfig decodes the YAML or TOML file at path onto cfg after the
+// config it includes, if any. including lists the files whose includes led
+// here, outermost first, to catch cycles.
+func overlayConfig(cfg *Config, path string, isTOML bool, including []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	if i := slices.Index(including, abs); i >= 0 {
+		return fmt.Errorf("circular include: %s", strings.Join(slices.Concat(including[i:], []string{abs}), " -> "))
+	}
+
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	if isTOML {
+		doc, err := parseTOML(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse config: %w", err)
+		}
+
+		// Round-trip through YAML so both formats share the struct tags
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("failed to convert config: %w", err)
+		}
 	}
 
-	if err := validateConfig(&cfg); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+	var header struct {
+		Include string `yaml:"include"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if header.Include != "" {
+		base := header.Include
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(path), base)
+		}
+		isTOML := strings.EqualFold(filepath.Ext(base), ".toml")
+		if err := overlayConfig(cfg, base, isTOML, append(including, abs)); err != nil {
+			return fmt.Errorf("include %s: %w", header.Include, err)
+		}
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
 	}
+	return nil
+}
 
-	return &cfg, nil
+// pipelineStages are the named stages pipelines are built from
+var pipelineStages = map[string]bool{
+	"Fetch": true, "Fetch1": true, "Fetch2": true,
+	"Decode": true, "Decode1": true, "Decode2": true, "Decode3": true,
+	"Issue": true, "Rename": true, "Schedule": true, "Dispatch": true,
+	"Execute": true, "Memory": true, "Writeback": true,
+}
+
+// pipelineStage reports whether some pipeline has a stage called name,
+// including the numbered StageN and ExtraStageN fillers of deep pipelines
+func pipelineStage(name string) bool {
+	if pipelineStages[name] {
+		return true
+	}
+
+	for _, prefix := range []string{"Stage", "ExtraStage"} {
+		if n, ok := strings.CutPrefix(name, prefix); ok {
+			i, err := strconv.Atoi(n)
+			return err == nil && i > 0 && strconv.Itoa(i) == n
+		}
+	}
+	return false
 }
 
 // validateConfig checks if the configuration is valid
@@ -74,54 +445,610 @@ func validateConfig(cfg *Config) error {
 		return fmt.Errorf("pipeline depth must be positive")
 	}
 
+	if cfg.IssueWidth < 1 {
+		return fmt.Errorf("issue width must be at least 1")
+	}
+
+	if cfg.FetchInterval < 0 {
+		return fmt.Errorf("fetch interval must not be negative")
+	}
+
+	if cfg.FetchQueueSize < 0 {
+		return fmt.Errorf("fetch queue size must not be negative")
+	}
+
+	if cfg.WarmupCycles < 0 {
+		return fmt.Errorf("warmup cycles must not be negative")
+	}
+
+	if cfg.MaxInstructions < 0 {
+		return fmt.Errorf("instruction budget must not be negative")
+	}
+
+	if cfg.ThreadsPerCore < 0 {
+		return fmt.Errorf("threads per core must not be negative")
+	}
+
+	if cfg.DeadlockCycles < 0 {
+		return fmt.Errorf("deadlock cycles must not be negative")
+	}
+
+	if cfg.DeadlockCycles > 0 && !cfg.SyncMode {
+		return fmt.Errorf("deadlock detection requires sync mode")
+	}
+
+	if cfg.OutOfOrder {
+		if cfg.ROBSize < 1 {
+			return fmt.Errorf("out-of-order issue needs a positive reorder buffer size")
+		}
+		if cfg.ReservationStations < 1 || cfg.ReservationStations > cfg.ROBSize {
+			return fmt.Errorf("reservation stations must be between 1 and the reorder buffer size")
+		}
+	}
+
+	if cfg.NumALUs < 1 || cfg.NumFPUs < 1 || cfg.NumLoadStore < 1 || cfg.NumBranch < 1 {
+		return fmt.Errorf("each execution unit type needs at least one unit")
+	}
+
+	if cfg.PowerGateIdleThreshold < 0 || cfg.PowerGateWakeLatency < 0 {
+		return fmt.Errorf("power-gating threshold and wake latency must not be negative")
+	}
+
+	if cfg.InterruptInterval < 0 {
+		return fmt.Errorf("interrupt interval must not be negative")
+	}
+
+	if cfg.InterruptEntryCycles < 0 || cfg.InterruptExitCycles < 0 {
+		return fmt.Errorf("interrupt entry and exit cycles must not be negative")
+	}
+
+	if cfg.InterruptHandlerInstructions < 0 {
+		return fmt.Errorf("interrupt handler instructions must not be negative")
+	}
+
+	if cfg.MixInteger < 0 || cfg.MixFloat < 0 || cfg.MixMemory < 0 || cfg.MixBranch < 0 {
+		return fmt.Errorf("instruction mix percentages must not be negative")
+	}
+
+	if total := cfg.MixInteger + cfg.MixFloat + cfg.MixMemory + cfg.MixBranch; total != 0 && total != 100 {
+		return fmt.Errorf("instruction mix sums to %d%%, want 100%%", total)
+	}
+
+	if cfg.MemoryPorts < 0 {
+		return fmt.Errorf("memory ports must not be negative")
+	}
+
+	if cfg.MemoryPorts > 0 && !cfg.SyncMode {
+		return fmt.Errorf("limiting memory ports requires sync mode")
+	}
+
+	if cfg.HitUnderMissLatency < 0 {
+		return fmt.Errorf("hit-under-miss latency must not be negative")
+	}
+
+	if cfg.HitUnderMissLatency > 0 && cfg.MemoryPorts == 0 {
+		return fmt.Errorf("hit-under-miss latency needs memory ports to contend for")
+	}
+
+	if cfg.StoreBufferEntries < 0 {
+		return fmt.Errorf("store buffer entries must not be negative")
+	}
+
+	for i, bound := range cfg.LatencyBuckets {
+		if bound <= 0 {
+			return fmt.Errorf("latency bucket bounds must be positive")
+		}
+		if i > 0 && bound <= cfg.LatencyBuckets[i-1] {
+			return fmt.Errorf("latency bucket bounds must be strictly ascending")
+		}
+	}
+
+	switch cfg.Engine {
+	case "", "cycle":
+	case "event":
+		if !cfg.SyncMode {
+			return fmt.Errorf("the event engine requires sync mode")
+		}
+	default:
+		return fmt.Errorf("unsupported simulation engine: %s", cfg.Engine)
+	}
+
+	if err := validateNUMA(cfg); err != nil {
+		return err
+	}
+
+	if err := validateDRAM(cfg); err != nil {
+		return err
+	}
+
+	if err := validateEnergy(cfg); err != nil {
+		return err
+	}
+
 	// Validate ISA
 	validISAs := map[string]bool{"RISC-V": true, "x86": true, "ARM": true, "MIPS": true, "Custom": true}
 	if !validISAs[cfg.ISA] {
 		return fmt.Errorf("unsupported ISA: %s", cfg.ISA)
 	}
 
+	if err := validateCoreTypes(cfg, validISAs); err != nil {
+		return err
+	}
+
+	// Validate stage latencies
+	for name, latency := range cfg.StageLatencies {
+		if !pipelineStage(name) {
+			return fmt.Errorf("unknown pipeline stage %q in stage latencies", name)
+		}
+		if latency < 1 {
+			return fmt.Errorf("latency of pipeline stage %s must be at least 1", name)
+		}
+	}
+
+	// Validate branch predictor
+	validPredictors := map[string]bool{"": true, "static": true, "bimodal": true, "gshare": true}
+	if !validPredictors[cfg.BranchPredictor] {
+		return fmt.Errorf("unsupported branch predictor: %s", cfg.BranchPredictor)
+	}
+
+	if cfg.PredicationDistance < 0 {
+		return fmt.Errorf("predication distance must not be negative")
+	}
+
+	// Validate write-combining buffer
+	if cfg.WriteCombiningEntries < 0 {
+		return fmt.Errorf("write-combining entries must not be negative")
+	}
+
+	if cfg.WriteCombiningEntries > 0 {
+		validFlushPolicies := map[string]bool{"full-line": true, "fence": true, "eviction": true}
+		if !validFlushPolicies[cfg.WriteCombiningFlushPolicy] {
+			return fmt.Errorf("unsupported write-combining flush policy: %s", cfg.WriteCombiningFlushPolicy)
+		}
+	}
+
+	// Validate cache write policies
+	validWritePolicies := map[string]bool{"": true, "write-back": true, "write-through": true}
+	if !validWritePolicies[cfg.L1WritePolicy] {
+		return fmt.Errorf("unsupported L1 write policy: %s", cfg.L1WritePolicy)
+	}
+	if !validWritePolicies[cfg.L2WritePolicy] {
+		return fmt.Errorf("unsupported L2 write policy: %s", cfg.L2WritePolicy)
+	}
+
+	validReplacementPolicies := map[string]bool{"": true, "lru": true, "fifo": true, "random": true, "plru": true}
+	if !validReplacementPolicies[cfg.ReplacementPolicy] {
+		return fmt.Errorf("unsupported replacement policy: %s", cfg.ReplacementPolicy)
+	}
+
+	validInclusionPolicies := map[string]bool{"": true, "inclusive": true, "exclusive": true, "NINE": true}
+	if !validInclusionPolicies[cfg.CacheInclusionPolicy] {
+		return fmt.Errorf("unsupported cache inclusion policy: %s", cfg.CacheInclusionPolicy)
+	}
+
+	validPrefetchPolicies := map[string]bool{"": true, "none": true, "next-line": true, "stride": true}
+	if !validPrefetchPolicies[cfg.PrefetchPolicy] {
+		return fmt.Errorf("unsupported prefetch policy: %s", cfg.PrefetchPolicy)
+	}
+
+	if err := validateCaches(cfg); err != nil {
+		return err
+	}
+
+	if err := validateTLB(cfg); err != nil {
+		return err
+	}
+
 	// Validate coherence protocol
 	validProtocols := map[string]bool{"MESI": true, "MOESI": true, "MSI": true, "MESIF": true, "None": true}
 	if !validProtocols[cfg.CoherenceProtocol] {
 		return fmt.Errorf("unsupported coherence protocol: %s", cfg.CoherenceProtocol)
 	}
 
+	if cfg.FalseSharingLines < 0 {
+		return fmt.Errorf("false sharing lines must not be negative")
+	}
+
+	if cfg.CacheToCacheFetch && cfg.CoherenceProtocol == "None" {
+		return fmt.Errorf("cache-to-cache fetch needs a coherence protocol to find the cores holding a line")
+	}
+
 	// Validate interconnect type
 	validInterconnects := map[string]bool{"bus": true, "ring": true, "mesh": true, "crossbar": true, "torus": true}
 	if !validInterconnects[cfg.InterconnectType] {
 		return fmt.Errorf("unsupported interconnect type: %s", cfg.InterconnectType)
 	}
 
+	if cfg.PerHopLatency < 0 {
+		return fmt.Errorf("per-hop latency must not be negative")
+	}
+
+	if cfg.MeshAspectRatio < 0 {
+		return fmt.Errorf("mesh aspect ratio must not be negative")
+	}
+
+	if cfg.InterconnectType == "mesh" || cfg.InterconnectType == "torus" {
+		if _, _, ok := cfg.GridDimensions(); !ok {
+			return fmt.Errorf("%d cores cannot form a %s grid with %g columns per row", cfg.NumCores, cfg.InterconnectType, cfg.MeshAspectRatio)
+		}
+	}
+
+	// Validate bus arbitration
+	if cfg.InterconnectType == "bus" {
+		validArbitration := map[string]bool{"round-robin": true, "priority": true, "fixed": true}
+		if !validArbitration[cfg.BusArbitrationPolicy] {
+			return fmt.Errorf("unsupported bus arbitration policy: %s", cfg.BusArbitrationPolicy)
+		}
+
+		if len(cfg.BusPriorities) != 0 && len(cfg.BusPriorities) != cfg.NumCores {
+			return fmt.Errorf("bus priorities has %d entries, want one per core (%d)", len(cfg.BusPriorities), cfg.NumCores)
+		}
+	}
+
+	return nil
+}
+
+// validateTLB checks the TLB geometry when translation is enabled
+func validateTLB(cfg *Config) error {
+	if cfg.TLBEntries < 0 {
+		return fmt.Errorf("TLB entries must not be negative")
+	}
+
+	if cfg.TLBEntries == 0 {
+		return nil
+	}
+
+	ways := cfg.TLBAssociativity
+	if ways == FullyAssociative {
+		ways = cfg.TLBEntries
+	}
+	if ways < 0 || cfg.TLBEntries%max(ways, 1) != 0 {
+		return fmt.Errorf("TLB associativity %d does not divide its %d entries", cfg.TLBAssociativity, cfg.TLBEntries)
+	}
+
+	if cfg.PageSize <= 0 || cfg.PageSize&(cfg.PageSize-1) != 0 {
+		return fmt.Errorf("page size must be a power of two, got %d", cfg.PageSize)
+	}
+
+	if cfg.PageWalkLatency < 0 {
+		return fmt.Errorf("page walk latency must not be negative")
+	}
+
+	return nil
+}
+
+// validateCaches checks that the cache hierarchy grows in size and latency
+// from L1 to L3
+func validateCaches(cfg *Config) error {
+	if cfg.CacheLineSize < 0 || cfg.CacheLineSize&(cfg.CacheLineSize-1) != 0 {
+		return fmt.Errorf("cacheLineSize must be a power of two, got %d", cfg.CacheLineSize)
+	}
+	lineSize := cfg.LineSize()
+
+	levels := []struct {
+		name                     string
+		size, associativity, lat int
+	}{
+		{"L1", cfg.L1Size, cfg.L1Associativity, cfg.L1Latency},
+		{"L2", cfg.L2Size, cfg.L2Associativity, cfg.L2Latency},
+		{"L3", cfg.L3Size, cfg.L3Associativity, cfg.L3Latency},
+	}
+
+	for i, l := range levels {
+		if l.size <= 0 {
+			return fmt.Errorf("%sSize must be positive, got %d", l.name, l.size)
+		}
+
+		if l.associativity <= 0 && l.associativity != FullyAssociative {
+			return fmt.Errorf("%sAssociativity must be positive, or %d for fully associative, got %d",
+				l.name, FullyAssociative, l.associativity)
+		}
+
+		if l.lat < 0 {
+			return fmt.Errorf("%sLatency must not be negative, got %d", l.name, l.lat)
+		}
+
+		if l.size*1024%lineSize != 0 {
+			return fmt.Errorf("%sSize (%d KB) is not a whole number of %d-byte lines", l.name, l.size, lineSize)
+		}
+
+		// At least one set, and a fully associative cache is a single one
+		lines, ways := l.size*1024/lineSize, cfg.Ways(l.size, l.associativity)
+		if ways > lines {
+			return fmt.Errorf("%sAssociativity %d exceeds the %d lines of a %d KB cache", l.name, ways, lines, l.size)
+		}
+
+		if cfg.ReplacementPolicy == "plru" && (ways&(ways-1) != 0 || ways > 64) {
+			return fmt.Errorf("pseudo-LRU replacement needs %sAssociativity to be a power of two of at most 64, got %d",
+				l.name, ways)
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		prev := levels[i-1]
+		if prev.size > l.size {
+			return fmt.Errorf("%sSize (%d KB) must not exceed %sSize (%d KB)", prev.name, prev.size, l.name, l.size)
+		}
+
+		if prev.lat > l.lat {
+			return fmt.Errorf("%sLatency (%d) must not exceed %sLatency (%d)", prev.name, prev.lat, l.name, l.lat)
+		}
+	}
+
+	return nil
+}
+
+// validateCoreTypes checks the core types and the assignment of cores to them
+func validateCoreTypes(cfg *Config, validISAs map[string]bool) error {
+	if len(cfg.CoreTypes) == 0 {
+		if len(cfg.CoreAssignment) > 0 {
+			return fmt.Errorf("core assignment given without any core types")
+		}
+		return nil
+	}
+
+	types := make(map[string]bool, len(cfg.CoreTypes))
+	for _, ct := range cfg.CoreTypes {
+		if ct.Name == "" {
+			return fmt.Errorf("core type needs a name")
+		}
+
+		if types[ct.Name] {
+			return fmt.Errorf("duplicate core type: %s", ct.Name)
+		}
+		types[ct.Name] = true
+
+		if ct.ISA != "" && !validISAs[ct.ISA] {
+			return fmt.Errorf("core type %s: unsupported ISA: %s", ct.Name, ct.ISA)
+		}
+
+		if ct.PipelineDepth < 0 || ct.IssueWidth < 0 ||
+			ct.NumALUs < 0 || ct.NumFPUs < 0 || ct.NumLoadStore < 0 || ct.NumBranch < 0 {
+			return fmt.Errorf("core type %s: depth, width and unit counts must not be negative", ct.Name)
+		}
+
+		if ct.ClockFrequency < 0 {
+			return fmt.Errorf("core type %s: clock frequency must not be negative", ct.Name)
+		}
+
+		// Cores only keep their own clocks when stepped in lockstep
+		if ct.ClockFrequency != 0 && ct.ClockFrequency != cfg.ClockFrequency && !cfg.SyncMode {
+			return fmt.Errorf("core type %s: its own clock frequency requires sync mode", ct.Name)
+		}
+	}
+
+	if len(cfg.CoreAssignment) == 0 {
+		return nil
+	}
+
+	if len(cfg.CoreAssignment) != cfg.NumCores {
+		return fmt.Errorf("core assignment has %d entries, want one per core (%d)", len(cfg.CoreAssignment), cfg.NumCores)
+	}
+
+	for i, name := range cfg.CoreAssignment {
+		if !types[name] {
+			return fmt.Errorf("core %d assigned unknown core type: %s", i, name)
+		}
+	}
+
+	return nil
+}
+
+// validateNUMA checks the node count and core-to-node mapping
+func validateNUMA(cfg *Config) error {
+	if cfg.NUMANodes < 0 {
+		return fmt.Errorf("NUMA nodes must not be negative")
+	}
+
+	if cfg.NUMARemotePenalty < 0 {
+		return fmt.Errorf("NUMA remote penalty must not be negative")
+	}
+
+	if len(cfg.NUMACoreNodes) == 0 {
+		return nil
+	}
+
+	if cfg.NUMANodes <= 1 {
+		return fmt.Errorf("NUMA core nodes need more than one NUMA node")
+	}
+
+	if len(cfg.NUMACoreNodes) != cfg.NumCores {
+		return fmt.Errorf("NUMA core nodes has %d entries, want one per core (%d)", len(cfg.NUMACoreNodes), cfg.NumCores)
+	}
+
+	for i, node := range cfg.NUMACoreNodes {
+		if node < 0 || node >= cfg.NUMANodes {
+			return fmt.Errorf("core %d assigned to NUMA node %d, want 0 to %d", i, node, cfg.NUMANodes-1)
+		}
+	}
+
+	return nil
+}
+
+// validateDRAM checks the bank count and the address bit fields that map
+// addresses to banks and rows
+func validateDRAM(cfg *Config) error {
+	if cfg.DRAMBanks < 0 {
+		return fmt.Errorf("DRAM banks must not be negative")
+	}
+
+	if cfg.DRAMBanks == 0 {
+		return nil
+	}
+
+	if cfg.DRAMBanks&(cfg.DRAMBanks-1) != 0 {
+		return fmt.Errorf("DRAM banks must be a power of two, got %d", cfg.DRAMBanks)
+	}
+
+	if cfg.DRAMBankShift < 0 {
+		return fmt.Errorf("DRAM bank shift must not be negative")
+	}
+
+	bankBits := 0
+	for banks := cfg.DRAMBanks; banks > 1; banks >>= 1 {
+		bankBits++
+	}
+	if cfg.DRAMRowShift < cfg.DRAMBankShift+bankBits || cfg.DRAMRowShift > 63 {
+		return fmt.Errorf("DRAM row shift %d must be above the %d bank bits from bit %d, and at most 63",
+			cfg.DRAMRowShift, bankBits, cfg.DRAMBankShift)
+	}
+
+	if cfg.DRAMActivateLatency < 0 || cfg.DRAMPrechargeLatency < 0 {
+		return fmt.Errorf("DRAM activate and precharge latencies must not be negative")
+	}
+
+	return nil
+}
+
+// validateEnergy checks that no energy coefficient is negative
+func validateEnergy(cfg *Config) error {
+	coefficients := []struct {
+		name  string
+		value float64
+	}{
+		{"energyInteger", cfg.EnergyInteger},
+		{"energyFloat", cfg.EnergyFloat},
+		{"energyMemory", cfg.EnergyMemory},
+		{"energyBranch", cfg.EnergyBranch},
+		{"energyL1", cfg.EnergyL1},
+		{"energyL2", cfg.EnergyL2},
+		{"energyL3", cfg.EnergyL3},
+		{"energyDRAM", cfg.EnergyDRAM},
+		{"leakagePower", cfg.LeakagePower},
+	}
+
+	for _, c := range coefficients {
+		if c.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %g", c.name, c.value)
+		}
+	}
+
 	return nil
 }
 
 // DefaultConfig returns a default configuration
 func DefaultConfig() *Config {
 	return &Config{
-		NumCores:       4,
-		ClockFrequency: 3000, // 3 GHz
-		ISA:            "RISC-V",
-		PipelineDepth:  5, // 5-stage pipeline
+		NumCores:          4,
+		ClockFrequency:    3000, // 3 GHz
+		ISA:               "RISC-V",
+		PipelineDepth:     5, // 5-stage pipeline
+		IssueWidth:        1, // scalar
+		FetchInterval:     1, // fetch every cycle
+		FetchQueueSize:    0, // fetch straight into the pipeline
+		FlushPenalty:      false,
+		FlushOnInvalidate: false,
+		SyncMode:          false,
+		Engine:            "cycle",
+		WarmupCycles:      0, // measure from a cold start
+		MaxInstructions:   0, // no instruction budget
+		DeadlockCycles:    0, // no deadlock detection
+		ThreadsPerCore:    1, // no SMT
+
+		NumALUs:      2,
+		NumFPUs:      1,
+		NumLoadStore: 1,
+		NumBranch:    1,
+
+		ForwardingEnabled: true,
+
+		OutOfOrder:          false,
+		ROBSize:             64,
+		ReservationStations: 16,
+
+		BranchPredictor:     "bimodal",
+		PredicationDistance: 0, // disabled
+
+		PowerGateIdleThreshold: 0, // disabled
+		PowerGateWakeLatency:   2,
+
+		InterruptInterval:            0, // disabled
+		InterruptHandlerAddress:      0x8000,
+		InterruptHandlerInstructions: 16,
+		InterruptEntryCycles:         20,
+		InterruptExitCycles:          20,
+
+		CacheLineSize:     64, // 64 bytes
+		ReplacementPolicy: "lru",
 
 		L1Size:          32, // 32 KB
 		L1Associativity: 8,
 		L1Latency:       3, // 3 cycles
+		L1WritePolicy:   "write-back",
 
 		L2Size:          256, // 256 KB
 		L2Associativity: 8,
 		L2Latency:       12, // 12 cycles
+		L2WritePolicy:   "write-back",
 
 		L3Size:          8192, // 8 MB
 		L3Associativity: 16,
 		L3Latency:       40, // 40 cycles
+		L3Shared:        false,
+
+		CacheInclusionPolicy: "NINE",
+
+		PrefetchPolicy: "none",
 
 		MemoryLatency: 200, // 200 cycles
+		MemoryPorts:   0,   // unlimited
+
+		HitUnderMissLatency: 0, // hits under a miss take no longer than clean hits
+
+		MemorySize:        0, // unlimited
+		HaltOnMemoryFault: false,
+
+		StoreBufferEntries: 0, // stores write the cache directly
+
+		LatencyBuckets: []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}, // powers of two cycles
+
+		NUMANodes:         0, // uniform memory
+		NUMARemotePenalty: 100,
+
+		DRAMBanks:            0,  // flat memory latency
+		DRAMBankShift:        13, // 8 KB rows
+		DRAMRowShift:         16, // above 8 banks
+		DRAMActivateLatency:  40,
+		DRAMPrechargeLatency: 40,
+
+		TLBEntries:       0, // no translation
+		TLBAssociativity: 1,
+		PageSize:         4096,
+		PageWalkLatency:  30,
+
+		WriteCombiningEntries:     0, // disabled
+		WriteCombiningFlushPolicy: "full-line",
 
 		CoherenceProtocol: "MESI",
+		FalseSharingLines: 0, // disabled
+		CacheToCacheFetch: false,
 
 		InterconnectType:      "ring",
 		InterconnectBandwidth: 256, // 256 GB/s
+		PerHopLatency:         1,
+
+		BusArbitrationPolicy: "round-robin",
+
+		EnergyInteger: 5,    // 5 pJ
+		EnergyFloat:   15,   // 15 pJ
+		EnergyMemory:  8,    // 8 pJ
+		EnergyBranch:  4,    // 4 pJ
+		EnergyL1:      10,   // 10 pJ
+		EnergyL2:      40,   // 40 pJ
+		EnergyL3:      150,  // 150 pJ
+		EnergyDRAM:    2000, // 2 nJ
+		LeakagePower:  100,  // 100 mW per core
+
+		WorkloadPath:    "", // synthetic workload
+		ProfileHotspots: false,
+
+		MixInteger: 100, // integer ADDs only
+		MixFloat:   0,
+		MixMemory:  0,
+		MixBranch:  0,
 
-		WorkloadPath: "workloads/default.bin",
+		RandSeed: 1,
 	}
 }
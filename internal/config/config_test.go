@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -12,6 +15,11 @@ numCores: 8
 clockFrequency: 4000
 isa: "x86"
 pipelineDepth: 14
+issueWidth: 4
+numALUs: 4
+numFPUs: 2
+numLoadStore: 2
+numBranch: 1
 l1Size: 64
 l1Associativity: 8
 l1Latency: 2
@@ -64,6 +72,149 @@ workloadPath: "workloads/test.bin"
 	}
 }
 
+func TestLoadConfig_Defaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{name: "Minimal YAML", file: "minimal.yaml", content: "numCores: 2\nisa: \"x86\"\n"},
+		{name: "Minimal TOML", file: "minimal.toml", content: "numCores = 2\nisa = \"x86\"\n"},
+		{name: "Explicit zero L1 size", file: "zero.yaml", content: "numCores: 2\nl1Size: 0\n", wantErr: true},
+		{name: "Explicit zero cores", file: "zero.toml", content: "numCores = 0\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			cfg, err := LoadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Everything the file leaves out comes from the defaults
+			want := DefaultConfig()
+			want.NumCores, want.ISA = 2, "x86"
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("LoadConfig() = %+v, want the defaults with the file's fields set", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create config directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	write("base.yaml", "numCores: 8\nisa: \"x86\"\nl1Size: 64\n")
+	write("experiments/wide.yaml", "include: ../base.yaml\nissueWidth: 4\nl1Size: 128\n")
+	write("abs.yaml", "include: "+filepath.Join(dir, "base.yaml")+"\nnumCores: 2\n")
+	write("experiments/wide.toml", "include = \"wide.yaml\"\nnumCores = 16\n")
+
+	tests := []struct {
+		name string
+		file string
+		want func(*Config)
+	}{
+		{
+			name: "Relative include",
+			file: "experiments/wide.yaml",
+			want: func(c *Config) { c.NumCores, c.ISA, c.IssueWidth, c.L1Size = 8, "x86", 4, 128 },
+		},
+		{
+			name: "Nested TOML include",
+			file: "experiments/wide.toml",
+			want: func(c *Config) { c.NumCores, c.ISA, c.IssueWidth, c.L1Size = 16, "x86", 4, 128 },
+		},
+		{
+			name: "Absolute include",
+			file: "abs.yaml",
+			want: func(c *Config) { c.NumCores, c.ISA, c.L1Size = 2, "x86", 64 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(filepath.Join(dir, tt.file))
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			// The including file overlays its base, which overlays the defaults
+			want := DefaultConfig()
+			tt.want(want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("LoadConfig() = %+v, want %+v", cfg, want)
+			}
+		})
+	}
+
+	errTests := []struct {
+		name    string
+		files   map[string]string
+		load    string
+		wantErr string
+	}{
+		{
+			name:    "Self include",
+			files:   map[string]string{"self.yaml": "include: self.yaml\n"},
+			load:    "self.yaml",
+			wantErr: "circular include",
+		},
+		{
+			name: "Include cycle",
+			files: map[string]string{
+				"a.yaml":      "include: loop/b.yaml\n",
+				"loop/b.yaml": "include: ../a.yaml\n",
+			},
+			load:    "a.yaml",
+			wantErr: "circular include",
+		},
+		{
+			name:    "Missing include",
+			files:   map[string]string{"missing.yaml": "include: nowhere.yaml\n"},
+			load:    "missing.yaml",
+			wantErr: "include nowhere.yaml: failed to read config file",
+		},
+		{
+			name:    "Invalid merged config",
+			files:   map[string]string{"zero.yaml": "include: base.yaml\nnumCores: 0\n"},
+			load:    "zero.yaml",
+			wantErr: "invalid configuration",
+		},
+	}
+
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, content := range tt.files {
+				write(name, content)
+			}
+
+			_, err := LoadConfig(filepath.Join(dir, tt.load))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateConfig(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -77,6 +228,20 @@ func TestValidateConfig(t *testing.T) {
 				ClockFrequency:    3000,
 				ISA:               "RISC-V",
 				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				L1Size:            32,
+				L1Associativity:   8,
+				L1Latency:         3,
+				L2Size:            256,
+				L2Associativity:   8,
+				L2Latency:         12,
+				L3Size:            8192,
+				L3Associativity:   16,
+				L3Latency:         40,
 				CoherenceProtocol: "MESI",
 				InterconnectType:  "ring",
 			},
@@ -89,6 +254,11 @@ func TestValidateConfig(t *testing.T) {
 				ClockFrequency:    3000,
 				ISA:               "RISC-V",
 				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
 				CoherenceProtocol: "MESI",
 				InterconnectType:  "ring",
 			},
@@ -101,6 +271,11 @@ func TestValidateConfig(t *testing.T) {
 				ClockFrequency:    3000,
 				ISA:               "Invalid",
 				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
 				CoherenceProtocol: "MESI",
 				InterconnectType:  "ring",
 			},
@@ -113,11 +288,335 @@ func TestValidateConfig(t *testing.T) {
 				ClockFrequency:    3000,
 				ISA:               "RISC-V",
 				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
 				CoherenceProtocol: "Invalid",
 				InterconnectType:  "ring",
 			},
 			wantErr: true,
 		},
+		{
+			name: "Zero issue width",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        0,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative fetch queue size",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				FetchQueueSize:    -1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative false sharing lines",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				FalseSharingLines: -1,
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Descending latency buckets",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				LatencyBuckets:    []int{1, 4, 2},
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Zero latency bucket",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				LatencyBuckets:    []int{0, 4},
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative fetch interval",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				FetchInterval:     -1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative warmup",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				WarmupCycles:      -1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative per-hop latency",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+				PerHopLatency:     -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative instruction budget",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				MaxInstructions:   -1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "No ALUs",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           0,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid branch predictor",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				BranchPredictor:   "Invalid",
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Instruction mix not summing to 100",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				MixInteger:        60,
+				MixMemory:         30,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Memory ports without sync mode",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				MemoryPorts:       2,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Hit-under-miss latency without memory ports",
+			cfg: Config{
+				NumCores:            4,
+				ClockFrequency:      3000,
+				ISA:                 "RISC-V",
+				PipelineDepth:       5,
+				IssueWidth:          1,
+				NumALUs:             2,
+				NumFPUs:             1,
+				NumLoadStore:        1,
+				NumBranch:           1,
+				HitUnderMissLatency: 5,
+				CoherenceProtocol:   "MESI",
+				InterconnectType:    "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Event engine without sync mode",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				Engine:            "event",
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Deadlock detection without sync mode",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				DeadlockCycles:    1000,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown engine",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
+				Engine:            "discrete",
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid write-combining policy",
+			cfg: Config{
+				NumCores:                  4,
+				ClockFrequency:            3000,
+				ISA:                       "RISC-V",
+				PipelineDepth:             5,
+				WriteCombiningEntries:     4,
+				WriteCombiningFlushPolicy: "Invalid",
+				CoherenceProtocol:         "MESI",
+				InterconnectType:          "ring",
+			},
+			wantErr: true,
+		},
 		{
 			name: "Invalid interconnect",
 			cfg: Config{
@@ -125,11 +624,138 @@ func TestValidateConfig(t *testing.T) {
 				ClockFrequency:    3000,
 				ISA:               "RISC-V",
 				PipelineDepth:     5,
+				IssueWidth:        1,
+				NumALUs:           2,
+				NumFPUs:           1,
+				NumLoadStore:      1,
+				NumBranch:         1,
 				CoherenceProtocol: "MESI",
 				InterconnectType:  "Invalid",
 			},
 			wantErr: true,
 		},
+		{
+			name: "Invalid bus arbitration",
+			cfg: Config{
+				NumCores:             4,
+				ClockFrequency:       3000,
+				ISA:                  "RISC-V",
+				PipelineDepth:        5,
+				CoherenceProtocol:    "MESI",
+				InterconnectType:     "bus",
+				BusArbitrationPolicy: "Invalid",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bus priorities per core",
+			cfg: Config{
+				NumCores:             2,
+				ClockFrequency:       3000,
+				ISA:                  "RISC-V",
+				PipelineDepth:        5,
+				CoherenceProtocol:    "MESI",
+				InterconnectType:     "bus",
+				BusArbitrationPolicy: "priority",
+				BusPriorities:        []int{1, 2, 3},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid L2 write policy",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				L2WritePolicy:     "write-around",
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Out-of-order without a reorder buffer",
+			cfg: Config{
+				NumCores:            4,
+				ClockFrequency:      3000,
+				ISA:                 "RISC-V",
+				PipelineDepth:       5,
+				OutOfOrder:          true,
+				ReservationStations: 4,
+				CoherenceProtocol:   "MESI",
+				InterconnectType:    "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "More reservation stations than reorder buffer entries",
+			cfg: Config{
+				NumCores:            4,
+				ClockFrequency:      3000,
+				ISA:                 "RISC-V",
+				PipelineDepth:       5,
+				OutOfOrder:          true,
+				ROBSize:             8,
+				ReservationStations: 16,
+				CoherenceProtocol:   "MESI",
+				InterconnectType:    "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative threads per core",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				ThreadsPerCore:    -1,
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid prefetch policy",
+			cfg: Config{
+				NumCores:          4,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				PrefetchPolicy:    "markov",
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "NUMA core nodes without NUMA",
+			cfg: Config{
+				NumCores:          2,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				NUMACoreNodes:     []int{0, 0},
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
+		{
+			name: "NUMA core node out of range",
+			cfg: Config{
+				NumCores:          2,
+				ClockFrequency:    3000,
+				ISA:               "RISC-V",
+				PipelineDepth:     5,
+				NUMANodes:         2,
+				NUMACoreNodes:     []int{0, 2},
+				CoherenceProtocol: "MESI",
+				InterconnectType:  "ring",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -141,6 +767,110 @@ func TestValidateConfig(t *testing.T) {
 	}
 }
 
+func TestValidateCaches(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr string
+	}{
+		{name: "Valid hierarchy", modify: func(cfg *Config) {}},
+		{name: "Equal sizes and latencies", modify: func(cfg *Config) {
+			cfg.L2Size, cfg.L3Size = cfg.L1Size, cfg.L1Size
+			cfg.L2Latency, cfg.L3Latency = cfg.L1Latency, cfg.L1Latency
+		}},
+		{name: "Zero L1 size", modify: func(cfg *Config) { cfg.L1Size = 0 }, wantErr: "L1Size"},
+		{name: "Negative L3 size", modify: func(cfg *Config) { cfg.L3Size = -1 }, wantErr: "L3Size"},
+		{name: "L1 larger than L2", modify: func(cfg *Config) { cfg.L1Size = 512 }, wantErr: "L1Size"},
+		{name: "L2 larger than L3", modify: func(cfg *Config) { cfg.L2Size = 16384 }, wantErr: "L2Size"},
+		{name: "Zero L1 associativity", modify: func(cfg *Config) { cfg.L1Associativity = 0 }, wantErr: "L1Associativity"},
+		{name: "Zero L2 associativity", modify: func(cfg *Config) { cfg.L2Associativity = 0 }, wantErr: "L2Associativity"},
+		{name: "Negative L3 associativity", modify: func(cfg *Config) { cfg.L3Associativity = -4 }, wantErr: "L3Associativity"},
+		{name: "Fully associative L1", modify: func(cfg *Config) { cfg.L1Associativity = FullyAssociative }},
+		{name: "L1 associativity of every line", modify: func(cfg *Config) { cfg.L1Associativity = cfg.L1Size * 1024 / 64 }},
+		{name: "L1 associativity over its lines", modify: func(cfg *Config) { cfg.L1Associativity = cfg.L1Size*1024/64 + 1 }, wantErr: "L1Associativity"},
+		{name: "Fully associative with pseudo-LRU", modify: func(cfg *Config) {
+			cfg.ReplacementPolicy = "plru"
+			cfg.L1Associativity = FullyAssociative
+		}, wantErr: "pseudo-LRU"},
+		{name: "Negative L1 latency", modify: func(cfg *Config) { cfg.L1Latency = -1 }, wantErr: "L1Latency"},
+		{name: "L1 slower than L2", modify: func(cfg *Config) { cfg.L1Latency = 20 }, wantErr: "L1Latency"},
+		{name: "L2 slower than L3", modify: func(cfg *Config) { cfg.L2Latency = 50 }, wantErr: "L2Latency"},
+		{name: "Unset line size", modify: func(cfg *Config) { cfg.CacheLineSize = 0 }},
+		{name: "128-byte lines", modify: func(cfg *Config) { cfg.CacheLineSize = 128 }},
+		{name: "Line size not a power of two", modify: func(cfg *Config) { cfg.CacheLineSize = 96 }, wantErr: "cacheLineSize"},
+		{name: "Negative line size", modify: func(cfg *Config) { cfg.CacheLineSize = -64 }, wantErr: "cacheLineSize"},
+		{name: "Pseudo-LRU", modify: func(cfg *Config) { cfg.ReplacementPolicy = "plru" }},
+		{name: "Pseudo-LRU with 12 ways", modify: func(cfg *Config) {
+			cfg.ReplacementPolicy = "plru"
+			cfg.L3Associativity = 12
+		}, wantErr: "pseudo-LRU"},
+		{name: "Unknown replacement policy", modify: func(cfg *Config) { cfg.ReplacementPolicy = "mru" }, wantErr: "unsupported replacement policy"},
+		{name: "Exclusive caches", modify: func(cfg *Config) { cfg.CacheInclusionPolicy = "exclusive" }},
+		{name: "Unknown inclusion policy", modify: func(cfg *Config) { cfg.CacheInclusionPolicy = "non-inclusive" }, wantErr: "unsupported cache inclusion policy"},
+		{name: "Line larger than L1", modify: func(cfg *Config) {
+			cfg.L1Size = 1
+			cfg.CacheLineSize = 2048
+		}, wantErr: "L1Size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(cfg)
+
+			err := validateConfig(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateConfig() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("validateConfig() error = %v, want one naming %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEnergy(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.EnergyInteger, cfg.LeakagePower = 0, 0
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig() with zero coefficients error = %v", err)
+	}
+
+	cfg.EnergyL2 = -1
+	if err := validateConfig(cfg); err == nil || !strings.HasPrefix(err.Error(), "energyL2") {
+		t.Errorf("validateConfig() error = %v, want one naming energyL2", err)
+	}
+}
+
+func TestValidateStageLatencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies map[string]int
+		wantErr   bool
+	}{
+		{name: "None", latencies: nil},
+		{name: "Named stages", latencies: map[string]int{"Decode": 2, "Execute": 3}},
+		{name: "Deep pipeline fillers", latencies: map[string]int{"Decode1": 2, "Stage3": 2, "ExtraStage1": 2}},
+		{name: "Unknown stage", latencies: map[string]int{"Decod": 2}, wantErr: true},
+		{name: "Malformed filler", latencies: map[string]int{"Stage": 2}, wantErr: true},
+		{name: "Zero latency", latencies: map[string]int{"Execute": 0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.StageLatencies = tt.latencies
+			if err := validateConfig(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestDefaultConfig(t *testing.T) {
 	cfg := DefaultConfig()
 
@@ -163,4 +893,291 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.CoherenceProtocol != "MESI" {
 		t.Errorf("Expected default CoherenceProtocol = MESI, got %s", cfg.CoherenceProtocol)
 	}
+
+	if cfg.Threads() != 1 {
+		t.Errorf("Expected default Threads() = 1, got %d", cfg.Threads())
+	}
+
+	// A config that leaves threadsPerCore out runs one thread per core
+	cfg.ThreadsPerCore = 0
+	if cfg.Threads() != 1 {
+		t.Errorf("Threads() with ThreadsPerCore = 0 = %d, want 1", cfg.Threads())
+	}
+}
+
+func TestValidateTLB(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       int
+		associativity int
+		pageSize      int
+		walkLatency   int
+		wantErr       bool
+	}{
+		{name: "Disabled ignores the geometry", entries: 0, associativity: 3, pageSize: 3000, walkLatency: -1, wantErr: false},
+		{name: "Direct-mapped", entries: 64, associativity: 0, pageSize: 4096, walkLatency: 30, wantErr: false},
+		{name: "Set-associative", entries: 64, associativity: 4, pageSize: 2 << 20, walkLatency: 30, wantErr: false},
+		{name: "Fully associative", entries: 48, associativity: FullyAssociative, pageSize: 4096, walkLatency: 30, wantErr: false},
+		{name: "Negative associativity", entries: 64, associativity: -2, pageSize: 4096, walkLatency: 30, wantErr: true},
+		{name: "More ways than entries", entries: 64, associativity: 128, pageSize: 4096, walkLatency: 30, wantErr: true},
+		{name: "Negative entries", entries: -1, associativity: 1, pageSize: 4096, walkLatency: 30, wantErr: true},
+		{name: "Uneven sets", entries: 64, associativity: 3, pageSize: 4096, walkLatency: 30, wantErr: true},
+		{name: "Page size not a power of two", entries: 64, associativity: 1, pageSize: 3000, walkLatency: 30, wantErr: true},
+		{name: "Negative walk latency", entries: 64, associativity: 1, pageSize: 4096, walkLatency: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.TLBEntries, cfg.TLBAssociativity = tt.entries, tt.associativity
+			cfg.PageSize, cfg.PageWalkLatency = tt.pageSize, tt.walkLatency
+			if err := validateConfig(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDRAM(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr bool
+	}{
+		{name: "Disabled ignores the geometry", modify: func(cfg *Config) { cfg.DRAMBankShift, cfg.DRAMRowShift = -1, 70 }},
+		{name: "8 banks", modify: func(cfg *Config) { cfg.DRAMBanks = 8 }},
+		{name: "Row bits above a gap", modify: func(cfg *Config) { cfg.DRAMBanks, cfg.DRAMBankShift, cfg.DRAMRowShift = 16, 6, 20 }},
+		{name: "Negative banks", modify: func(cfg *Config) { cfg.DRAMBanks = -8 }, wantErr: true},
+		{name: "Banks not a power of two", modify: func(cfg *Config) { cfg.DRAMBanks = 12 }, wantErr: true},
+		{name: "Negative bank shift", modify: func(cfg *Config) { cfg.DRAMBanks, cfg.DRAMBankShift = 8, -1 }, wantErr: true},
+		{name: "Row bits overlap bank bits", modify: func(cfg *Config) { cfg.DRAMBanks = 16 }, wantErr: true},
+		{name: "Row shift past the address", modify: func(cfg *Config) { cfg.DRAMBanks, cfg.DRAMRowShift = 8, 64 }, wantErr: true},
+		{name: "Negative activate latency", modify: func(cfg *Config) { cfg.DRAMBanks, cfg.DRAMActivateLatency = 8, -1 }, wantErr: true},
+		{name: "Negative precharge latency", modify: func(cfg *Config) { cfg.DRAMBanks, cfg.DRAMPrechargeLatency = 8, -1 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(cfg)
+			if err := validateConfig(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGridDimensions(t *testing.T) {
+	tests := []struct {
+		name     string
+		numCores int
+		aspect   float64
+		wantRows int
+		wantCols int
+		wantOK   bool
+	}{
+		{name: "Square", numCores: 16, wantRows: 4, wantCols: 4, wantOK: true},
+		{name: "Squarest rectangle", numCores: 6, wantRows: 2, wantCols: 3, wantOK: true},
+		{name: "Prime count forms a row", numCores: 7, wantRows: 1, wantCols: 7, wantOK: true},
+		{name: "Wide", numCores: 8, aspect: 2, wantRows: 2, wantCols: 4, wantOK: true},
+		{name: "Tall", numCores: 8, aspect: 0.5, wantRows: 4, wantCols: 2, wantOK: true},
+		{name: "Fractional", numCores: 6, aspect: 1.5, wantRows: 2, wantCols: 3, wantOK: true},
+		{name: "Unreachable ratio", numCores: 6, aspect: 2, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.NumCores, cfg.MeshAspectRatio = tt.numCores, tt.aspect
+
+			rows, cols, ok := cfg.GridDimensions()
+			if rows != tt.wantRows || cols != tt.wantCols || ok != tt.wantOK {
+				t.Errorf("GridDimensions() = %d, %d, %v, want %d, %d, %v", rows, cols, ok, tt.wantRows, tt.wantCols, tt.wantOK)
+			}
+
+			// Only a mesh or torus needs the grid to exist
+			for _, topology := range []string{"mesh", "torus", "ring"} {
+				cfg.InterconnectType = topology
+				if err := validateConfig(cfg); (err == nil) != (tt.wantOK || topology == "ring") {
+					t.Errorf("validateConfig() on a %s error = %v", topology, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CoreTypes = []CoreType{{Name: "big", PipelineDepth: 8}, {Name: "little"}}
+	cfg.CoreAssignment = []string{"big", "little", "little", "little"}
+	cfg.NUMANodes = 2
+	cfg.NUMACoreNodes = []int{0, 0, 1, 1}
+	cfg.BusPriorities = []int{4, 3, 2, 1}
+	cfg.StageLatencies = map[string]int{"Decode": 2}
+
+	// Every slice and map must be populated so the aliasing checks below
+	// cover fields added later
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		switch f := v.Field(i); f.Kind() {
+		case reflect.Slice, reflect.Map:
+			if f.Len() == 0 {
+				t.Fatalf("%s is empty, populate it in this test", v.Type().Field(i).Name)
+			}
+		}
+	}
+
+	clone := cfg.Clone()
+	if !reflect.DeepEqual(clone, cfg) {
+		t.Fatalf("Clone() = %+v, want %+v", clone, cfg)
+	}
+
+	cv := reflect.ValueOf(clone).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		switch f := v.Field(i); f.Kind() {
+		case reflect.Slice, reflect.Map:
+			if f.Pointer() == cv.Field(i).Pointer() {
+				t.Errorf("Clone() shares %s with the original", v.Type().Field(i).Name)
+			}
+		}
+	}
+
+	clone.NumCores = 8
+	clone.CoreTypes[0].PipelineDepth = 20
+	clone.CoreAssignment[0] = "little"
+	clone.NUMACoreNodes[0] = 1
+	clone.BusPriorities[0] = 0
+	if cfg.NumCores != 4 || cfg.CoreTypes[0].PipelineDepth != 8 || cfg.CoreAssignment[0] != "big" ||
+		cfg.NUMACoreNodes[0] != 0 || cfg.BusPriorities[0] != 4 {
+		t.Errorf("mutating the clone changed the original: %+v", cfg)
+	}
+}
+
+func TestNUMANode(t *testing.T) {
+	cfg := DefaultConfig()
+	if got := []int{cfg.NUMANode(0), cfg.NUMANode(3)}; !reflect.DeepEqual(got, []int{0, 0}) {
+		t.Errorf("NUMANode() with uniform memory = %v, want [0 0]", got)
+	}
+
+	// Cores are split evenly in ID order unless mapped explicitly
+	cfg.NUMANodes = 2
+	got := make([]int, cfg.NumCores)
+	for i := range got {
+		got[i] = cfg.NUMANode(i)
+	}
+	if want := []int{0, 0, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NUMANode() = %v, want %v", got, want)
+	}
+
+	cfg.NUMACoreNodes = []int{1, 0, 1, 0}
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig() error = %v", err)
+	}
+	if cfg.NUMANode(0) != 1 || cfg.NUMANode(1) != 0 {
+		t.Errorf("NUMANode() ignored NUMACoreNodes")
+	}
+}
+
+func TestCoreTypes(t *testing.T) {
+	bigLittle := func(assignment ...string) *Config {
+		cfg := DefaultConfig()
+		cfg.CoreTypes = []CoreType{
+			{Name: "big", ISA: "x86", PipelineDepth: 11, IssueWidth: 4, NumALUs: 4},
+			{Name: "little"},
+		}
+		cfg.CoreAssignment = assignment
+		return cfg
+	}
+
+	tests := []struct {
+		name     string
+		cfg      *Config
+		wantErr  bool
+		wantType []string // per core
+	}{
+		{name: "Round-robin", cfg: bigLittle(), wantType: []string{"big", "little", "big", "little"}},
+		{name: "Explicit assignment", cfg: bigLittle("big", "big", "little", "little"), wantType: []string{"big", "big", "little", "little"}},
+		{name: "Unknown core type", cfg: bigLittle("big", "big", "medium", "little"), wantErr: true},
+		{name: "Assignment not covering every core", cfg: bigLittle("big", "little"), wantErr: true},
+		{
+			name: "Duplicate core type",
+			cfg: func() *Config {
+				cfg := bigLittle()
+				cfg.CoreTypes = append(cfg.CoreTypes, CoreType{Name: "big"})
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Assignment without core types",
+			cfg: func() *Config {
+				cfg := DefaultConfig()
+				cfg.CoreAssignment = []string{"big", "big", "big", "big"}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Own clock in sync mode",
+			cfg: func() *Config {
+				cfg := bigLittle()
+				cfg.CoreTypes[1].ClockFrequency = 1500
+				cfg.SyncMode = true
+				return cfg
+			}(),
+			wantType: []string{"big", "little", "big", "little"},
+		},
+		{
+			name: "Own clock without sync mode",
+			cfg: func() *Config {
+				cfg := bigLittle()
+				cfg.CoreTypes[1].ClockFrequency = 1500
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Negative clock",
+			cfg: func() *Config {
+				cfg := bigLittle()
+				cfg.CoreTypes[1].ClockFrequency = -1
+				cfg.SyncMode = true
+				return cfg
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for i, want := range tt.wantType {
+				if got := tt.cfg.CoreTypeName(i); got != want {
+					t.Errorf("CoreTypeName(%d) = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+
+	// Core type fields override the top level; zero fields inherit it
+	cfg := bigLittle()
+	big, little := cfg.ForCore(0), cfg.ForCore(1)
+	if big.ISA != "x86" || big.PipelineDepth != 11 || big.IssueWidth != 4 || big.NumALUs != 4 || big.NumFPUs != cfg.NumFPUs {
+		t.Errorf("ForCore(0) = %s %d stages %d-wide %d ALUs %d FPUs, want the big core with inherited FPUs",
+			big.ISA, big.PipelineDepth, big.IssueWidth, big.NumALUs, big.NumFPUs)
+	}
+
+	if little.ISA != cfg.ISA || little.PipelineDepth != cfg.PipelineDepth {
+		t.Errorf("ForCore(1) = %s %d stages, want the top-level %s %d stages",
+			little.ISA, little.PipelineDepth, cfg.ISA, cfg.PipelineDepth)
+	}
+
+	// Homogeneous designs share the top-level config
+	if homogeneous := DefaultConfig(); homogeneous.ForCore(2) != homogeneous {
+		t.Errorf("ForCore() without core types should return the config itself")
+	}
 }
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configSections head the groups of fields in a generated config, keyed by
+// the group's first field
+var configSections = map[string]string{
+	"numCores":               "Core configuration",
+	"numALUs":                "Execution units per core",
+	"coreTypes":              "Heterogeneous cores (big.LITTLE style). Each type overrides the settings\nabove with its non-zero fields, for example\n  coreTypes:\n    - {name: big, pipelineDepth: 11, isa: x86, issueWidth: 4, numALUs: 4}\n    - {name: little, pipelineDepth: 5, clockFrequency: 1500}\n  coreAssignment: [big, big, little, little]",
+	"forwardingEnabled":      "Pipeline",
+	"powerGateIdleThreshold": "Pipeline stage power-gating",
+	"interruptInterval":      "Periodic external interrupts",
+	"cacheLineSize":          "Memory hierarchy",
+	"numaNodes":              "NUMA memory, interleaved across nodes page by page",
+	"dramBanks":              "DRAM banks with a row buffer each; memoryLatency becomes the latency of an access to the open row",
+	"tlbEntries":             "Address translation through a TLB per core",
+	"writeCombiningEntries":  "Write-combining buffer for streaming stores, one per core shared by its hardware threads.\nInterrupts, full pipeline flushes and the end of a run drain it whatever the policy",
+	"coherenceProtocol":      "Cache coherence",
+	"interconnectType":       "Interconnect",
+	"busArbitrationPolicy":   "Bus arbitration, used when interconnectType is bus and the cores run in lockstep",
+	"energyInteger":          "Energy model",
+	"workloadPath":           "Workload",
+	"mixInteger":             "Synthetic instruction mix, in percent; must sum to 100, or all be 0 for integer ADDs only",
+}
+
+// configFieldDocs describe each config field in a generated config with its
+// unit and valid range, keyed by YAML name
+var configFieldDocs = map[string]string{
+	"numCores":          "cores, at least 1",
+	"clockFrequency":    "MHz, at least 1",
+	"isa":               "RISC-V, x86, ARM, MIPS or Custom",
+	"pipelineDepth":     "stages, at least 1; x86 needs a decode stage",
+	"issueWidth":        "instructions fetched and advanced per stage each cycle, at least 1",
+	"fetchInterval":     "cycles between fetch attempts, 0 or more; 0 means 1",
+	"fetchQueueSize":    "instructions fetched ahead of the pipeline per core, 0 or more; 0 fetches straight into it",
+	"flushPenalty":      "true makes flushes for exceptions and coherence refill the front-end stages, as mispredicts do",
+	"flushOnInvalidate": "true flushes the pipeline when another core invalidates a line a load in flight has read",
+	"syncMode":          "true advances all cores in lockstep for deterministic runs",
+	"engine":            "cycle, or event to jump over cycles where every core is idle (needs syncMode)",
+	"warmupCycles":      "cycles run before measuring and left out of the statistics, 0 or more",
+	"maxInstructions":   "instructions retired across all cores that stop a run early, 0 or more; 0 is unlimited",
+	"deadlockCycles":    "cycles without a retirement that abort a run as deadlocked, 0 or more; 0 disables (needs syncMode)",
+	"threadsPerCore":    "hardware threads sharing each core's pipeline, 0 or more; 0 means 1",
+
+	"numALUs":      "integer units, at least 1",
+	"numFPUs":      "floating-point units, at least 1",
+	"numLoadStore": "load/store units, at least 1",
+	"numBranch":    "branch units, at least 1",
+
+	"coreTypes":      "core types, empty builds every core alike",
+	"coreAssignment": "core type name per core, empty assigns the types round-robin",
+
+	"forwardingEnabled":   "true bypasses results to dependent instructions ahead of Writeback",
+	"stageLatencies":      "cycles, at least 1, by pipeline stage name, overriding the built-in latencies",
+	"outOfOrder":          "true issues from a reorder buffer as operands become ready",
+	"robSize":             "reorder buffer entries, at least 1 with outOfOrder",
+	"reservationStations": "instructions waiting to issue, 1 to robSize with outOfOrder",
+	"branchPredictor":     "static, bimodal or gshare",
+	"predicationDistance": "instructions a forward branch may skip and still run predicated, both paths flowing through without a mispredict flush, 0 or more; 0 disables",
+
+	"powerGateIdleThreshold": "idle cycles before a stage is gated, 0 or more; 0 disables",
+	"powerGateWakeLatency":   "cycles to wake a gated stage, 0 or more",
+
+	"interruptInterval":            "cycles between interrupts, 0 or more; 0 disables",
+	"interruptHandlerAddress":      "address of the handler's first instruction",
+	"interruptHandlerInstructions": "instructions the handler fetches and retires on thread 0 before returning, 0 or more; it returns early if fetch finds nothing",
+	"interruptEntryCycles":         "cycles to enter the handler, 0 or more",
+	"interruptExitCycles":          "cycles to return from the handler, 0 or more",
+
+	"cacheLineSize":        "bytes, a power of two; 0 is 64",
+	"replacementPolicy":    "lru, fifo, random or plru (power-of-two associativity of at most 64); every level",
+	"l1Size":               "KB, at least one line, at most l2Size",
+	"l1Associativity":      "ways per set, 1 to the number of lines; -1 is fully associative",
+	"l1Latency":            "cycles, 0 or more, at most l2Latency",
+	"l1WritePolicy":        "write-back or write-through",
+	"l2Size":               "KB, at least one line, at most l3Size",
+	"l2Associativity":      "ways per set, 1 to the number of lines; -1 is fully associative",
+	"l2Latency":            "cycles, 0 or more, at most l3Latency",
+	"l2WritePolicy":        "write-back or write-through",
+	"l3Size":               "KB, at least one line",
+	"l3Associativity":      "ways per set, 1 to the number of lines; -1 is fully associative",
+	"l3Latency":            "cycles, 0 or more",
+	"l3Shared":             "true shares one L3 between all cores; L1 and L2 stay private",
+	"cacheInclusionPolicy": "inclusive, exclusive or NINE (neither); whether lower levels keep copies of the lines above them",
+	"prefetchPolicy":       "none, next-line or stride; prefetches into L1",
+	"memoryLatency":        "cycles",
+	"memoryPorts":          "data accesses all cores can start per cycle, 0 or more; 0 is unlimited (needs syncMode otherwise)",
+	"hitUnderMissLatency":  "extra cycles an L1 data hit takes while a miss is outstanding and other cores contend for the memory ports, 0 or more (needs memoryPorts otherwise)",
+	"memorySize":           "bytes of physical memory, accesses at or past it fault; 0 is unlimited",
+	"haltOnMemoryFault":    "true stops a core at its first memory fault rather than counting it and carrying on",
+	"storeBufferEntries":   "stores buffered per core on their way to the cache, 0 or more; 0 writes the cache directly",
+	"latencyBuckets":       "cycles, positive and ascending upper bounds of the memory latency histogram; empty disables it",
+
+	"numaNodes":         "memory nodes, 0 or more; 0 or 1 is uniform memory",
+	"numaCoreNodes":     "node of each core, one per core; empty splits the cores evenly in ID order",
+	"numaRemotePenalty": "extra cycles to reach memory homed on another node, 0 or more",
+
+	"dramBanks":            "banks, 0 or a power of two; 0 disables the bank and row model",
+	"dramBankShift":        "lowest address bit of the bank index, 0 or more; the bits below pick a column of the row",
+	"dramRowShift":         "lowest address bit of the row index, above the bank bits and at most 63",
+	"dramActivateLatency":  "extra cycles to open a row in a bank with none open, 0 or more",
+	"dramPrechargeLatency": "further cycles to close the bank's open row first, 0 or more",
+
+	"tlbEntries":       "translations per core, 0 or more; 0 disables translation",
+	"tlbAssociativity": "entries per set dividing tlbEntries; 0 or 1 is direct-mapped, -1 fully associative",
+	"pageSize":         "bytes, a power of two",
+	"pageWalkLatency":  "cycles added to an access that misses in the TLB, 0 or more",
+
+	"writeCombiningEntries":     "lines buffered per core, 0 or more; 0 disables",
+	"writeCombiningFlushPolicy": "full-line, fence (only drains and overflows write lines out) or eviction",
+
+	"coherenceProtocol": "MESI, MOESI, MSI, MESIF or None",
+	"falseSharingLines": "hottest false sharing lines to report, 0 or more; 0 disables detection",
+	"cacheToCacheFetch": "true serves instruction fetches that miss every cache from another core's private caches over the interconnect; needs a coherence protocol",
+
+	"interconnectType":      "bus, ring, mesh, crossbar or torus",
+	"interconnectBandwidth": "GB/s",
+	"perHopLatency":         "cycles a ring, mesh or torus message spends on each link, 0 or more",
+	"meshAspectRatio":       "columns per row of a mesh or torus grid, 0 or more; 0 picks the squarest",
+
+	"busArbitrationPolicy": "round-robin, priority or fixed",
+	"busPriorities":        "priority of each core for the priority policy, one per core; higher wins",
+
+	"energyInteger": "picojoules per retired integer instruction, 0 or more",
+	"energyFloat":   "picojoules per retired floating-point instruction, 0 or more",
+	"energyMemory":  "picojoules per retired load or store excluding the caches, 0 or more",
+	"energyBranch":  "picojoules per retired branch, 0 or more",
+	"energyL1":      "picojoules per L1 access, 0 or more",
+	"energyL2":      "picojoules per L2 access, 0 or more",
+	"energyL3":      "picojoules per L3 access, 0 or more",
+	"energyDRAM":    "picojoules per line read from or written to memory, 0 or more",
+	"leakagePower":  "milliwatts of static power per core, 0 or more",
+
+	"workloadPath":    "binary, assembly (.s) or RISC-V ELF file; empty uses the synthetic generator",
+	"profileHotspots": "true counts retirements per instruction address to find the hottest code",
+
+	"mixInteger": "percent, 0 to 100",
+	"mixFloat":   "percent, 0 to 100",
+	"mixMemory":  "percent, 0 to 100",
+	"mixBranch":  "percent, 0 to 100",
+	"randSeed":   "seeds every randomized decision; same seed, same run",
+}
+
+// WriteDefault writes DefaultConfig to w as YAML, each field commented with
+// its unit and valid range, as a starting point for a new config
+func WriteDefault(w io.Writer) error {
+	var doc yaml.Node
+	if err := doc.Encode(DefaultConfig()); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	fields := doc.Content
+	for i := 0; i+1 < len(fields); i += 2 {
+		key, value := fields[i], fields[i+1]
+		if section, ok := configSections[key.Value]; ok {
+			key.HeadComment = section
+		}
+		value.LineComment = configFieldDocs[key.Value]
+
+		// Empty lists and maps read better inline
+		if value.Kind == yaml.SequenceNode || value.Kind == yaml.MappingNode {
+			value.Style = yaml.FlowStyle
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	// Set each section apart with a blank line before its heading
+	lines := strings.SplitAfter(buf.String(), "\n")
+	var out strings.Builder
+	out.WriteString("# Simulator configuration, generated from the defaults\n\n")
+	for i, line := range lines {
+		if i > 0 && strings.HasPrefix(line, "# ") && !strings.HasPrefix(lines[i-1], "#") {
+			out.WriteString("\n")
+		}
+		out.WriteString(line)
+	}
+
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWriteDefault(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDefault(&buf); err != nil {
+		t.Fatalf("WriteDefault() error = %v", err)
+	}
+
+	// Every field is there with its documentation, and nothing else is
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("Generated config does not parse: %v", err)
+	}
+	fields := doc.Content[0].Content
+	keys := make(map[string]bool)
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fields[i], fields[i+1]
+		keys[key.Value] = true
+		if !strings.HasPrefix(value.LineComment, "# ") {
+			t.Errorf("Field %s has no comment", key.Value)
+		}
+	}
+
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		name := configType.Field(i).Tag.Get("yaml")
+		if !keys[name] {
+			t.Errorf("Generated config lacks field %s", name)
+		}
+	}
+	for name := range configFieldDocs {
+		if !keys[name] {
+			t.Errorf("Documentation for unknown field %s", name)
+		}
+	}
+	for name := range configSections {
+		if !keys[name] {
+			t.Errorf("Section heading on unknown field %s", name)
+		}
+	}
+
+	// Loading the generated file gives back the defaults
+	path := filepath.Join(t.TempDir(), "generated.yaml")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() of the generated config error = %v", err)
+	}
+
+	// Compared as YAML, since empty lists and maps load empty rather than nil
+	got, _ := yaml.Marshal(cfg)
+	want, _ := yaml.Marshal(DefaultConfig())
+	if !bytes.Equal(got, want) {
+		t.Errorf("Generated config loads as\n%s\nwant the defaults\n%s", got, want)
+	}
+}
@@ -0,0 +1,486 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML decodes a TOML document into nested maps, ready to be mapped
+// onto Config through its yaml tags. It supports the parts of TOML a
+// configuration file needs: tables, arrays of tables, dotted keys, basic and
+// literal strings, integers, floats, booleans, arrays and inline tables.
+// Multi-line strings and date-times are rejected.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{
+		src:         string(data),
+		line:        1,
+		headers:     make(map[uintptr]bool),
+		tableArrays: make(map[tomlSlot]bool),
+	}
+	root := make(map[string]interface{})
+	current := root
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return root, nil
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(p.rest(), "[["):
+			p.pos += 2
+			current, err = p.arrayTableHeader(root)
+		case p.peek() == '[':
+			p.pos++
+			current, err = p.tableHeader(root)
+		default:
+			err = p.keyValue(current)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+
+		if err := p.endOfLine(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+	}
+}
+
+// tomlParser walks a TOML document byte by byte
+type tomlParser struct {
+	src         string
+	pos         int
+	line        int
+	headers     map[uintptr]bool  // tables a [header] has defined
+	tableArrays map[tomlSlot]bool // keys a [[header]] made an array of tables
+}
+
+// tomlSlot is a key of a particular table
+type tomlSlot struct {
+	table uintptr
+	key   string
+}
+
+func slot(table map[string]interface{}, key string) tomlSlot {
+	return tomlSlot{reflect.ValueOf(table).Pointer(), key}
+}
+
+func (p *tomlParser) eof() bool    { return p.pos >= len(p.src) }
+func (p *tomlParser) rest() string { return p.src[p.pos:] }
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// skipSpace skips spaces and tabs
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.pos++
+		case '\n':
+			p.pos++
+			p.line++
+		case '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine consumes trailing space and an optional comment up to the newline
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+
+	if p.peek() == '\r' {
+		p.pos++
+	}
+
+	if !p.eof() && p.peek() != '\n' {
+		return fmt.Errorf("unexpected %q after value", p.peek())
+	}
+	return nil
+}
+
+// tableHeader parses "name]" and returns the table it names
+func (p *tomlParser) tableHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek() != ']' {
+		return nil, fmt.Errorf("expected ] to close table header")
+	}
+	p.pos++
+
+	parent, err := p.descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := keys[len(keys)-1]
+	switch existing := parent[last].(type) {
+	case nil:
+		table := make(map[string]interface{})
+		parent[last] = table
+		p.headers[reflect.ValueOf(table).Pointer()] = true
+		return table, nil
+	case map[string]interface{}:
+		if p.headers[reflect.ValueOf(existing).Pointer()] {
+			return nil, fmt.Errorf("table %s is defined twice", strings.Join(keys, "."))
+		}
+		p.headers[reflect.ValueOf(existing).Pointer()] = true
+		return existing, nil
+	default:
+		return nil, fmt.Errorf("key %s is not a table", last)
+	}
+}
+
+// arrayTableHeader parses "name]]" and returns a new table appended to the
+// array it names
+func (p *tomlParser) arrayTableHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(p.rest(), "]]") {
+		return nil, fmt.Errorf("expected ]] to close array of tables header")
+	}
+	p.pos += 2
+
+	parent, err := p.descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := keys[len(keys)-1]
+	var tables []interface{}
+	switch existing := parent[last].(type) {
+	case nil:
+		p.tableArrays[slot(parent, last)] = true
+	case []interface{}:
+		if !p.tableArrays[slot(parent, last)] {
+			return nil, fmt.Errorf("key %s is an array of values, not of tables", last)
+		}
+		tables = existing
+	default:
+		return nil, fmt.Errorf("key %s is already defined", last)
+	}
+
+	table := make(map[string]interface{})
+	parent[last] = append(tables, table)
+	return table, nil
+}
+
+// descend returns the table at keys below root, creating missing tables.
+// A key naming an array of tables refers to its last element.
+func (p *tomlParser) descend(root map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	table := root
+	for _, k := range keys {
+		switch next := table[k].(type) {
+		case nil:
+			created := make(map[string]interface{})
+			table[k] = created
+			table = created
+		case map[string]interface{}:
+			table = next
+		case []interface{}:
+			if !p.tableArrays[slot(table, k)] || len(next) == 0 {
+				return nil, fmt.Errorf("key %s is not a table", k)
+			}
+			table = next[len(next)-1].(map[string]interface{})
+		default:
+			return nil, fmt.Errorf("key %s is not a table", k)
+		}
+	}
+	return table, nil
+}
+
+// keyValue parses "key = value" into table
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+
+	if p.peek() != '=' {
+		return fmt.Errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace()
+
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	parent, err := p.descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return fmt.Errorf("key %s is defined twice", last)
+	}
+	parent[last] = value
+	return nil
+}
+
+// key parses a possibly dotted key, returning its parts
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+
+		var k string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			k = s
+		case c == '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			k = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected a key, found %q", p.peek())
+			}
+			k = p.src[start:p.pos]
+		}
+		keys = append(keys, k)
+
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// value parses a single value
+func (p *tomlParser) value() (interface{}, error) {
+	switch c := p.peek(); {
+	case strings.HasPrefix(p.rest(), `"""`) || strings.HasPrefix(p.rest(), "'''"):
+		return nil, fmt.Errorf("multi-line strings are not supported")
+	case c == '"':
+		return p.basicString()
+	case c == '\'':
+		return p.literalString()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	case strings.HasPrefix(p.rest(), "true"):
+		p.pos += len("true")
+		return true, nil
+	case strings.HasPrefix(p.rest(), "false"):
+		p.pos += len("false")
+		return false, nil
+	default:
+		return p.number()
+	}
+}
+
+// basicString parses a double-quoted string with escapes
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++ // opening quote
+	var sb strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+
+		c := p.peek()
+		p.pos++
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", fmt.Errorf("unterminated string")
+			}
+			esc := p.peek()
+			p.pos++
+			switch esc {
+			case '"', '\\':
+				sb.WriteByte(esc)
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'u', 'U':
+				n := 4
+				if esc == 'U' {
+					n = 8
+				}
+				if p.pos+n > len(p.src) {
+					return "", fmt.Errorf("short unicode escape")
+				}
+				code, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(code)) {
+					return "", fmt.Errorf("invalid unicode escape %q", p.src[p.pos:p.pos+n])
+				}
+				sb.WriteRune(rune(code))
+				p.pos += n
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", esc)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// literalString parses a single-quoted string, taken verbatim
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++ // opening quote
+	end := strings.IndexAny(p.rest(), "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// array parses "[v, v, ...]", which may span lines
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++ // [
+	values := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.pos++
+			return values, nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+// inlineTable parses "{k = v, ...}" on a single line
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++ // {
+	table := make(map[string]interface{})
+
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		return table, nil
+	}
+
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, fmt.Errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// number parses an integer or float
+func (p *tomlParser) number() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && strings.IndexByte("+-0123456789abcdefABCDEFxob_.", p.peek()) >= 0 {
+		p.pos++
+	}
+
+	text := p.src[start:p.pos]
+	if text == "" {
+		return nil, fmt.Errorf("expected a value, found %q", p.peek())
+	}
+
+	if c := p.peek(); c == ':' || c == 'T' {
+		return nil, fmt.Errorf("date-time values are not supported")
+	}
+
+	clean := strings.ReplaceAll(text, "_", "")
+	switch {
+	case tomlInteger.MatchString(text):
+		if i, err := strconv.ParseInt(clean, 10, 64); err == nil {
+			return i, nil
+		}
+	case tomlPrefixedInteger.MatchString(text):
+		if i, err := strconv.ParseInt(clean, 0, 64); err == nil {
+			return i, nil
+		}
+	case tomlFloat.MatchString(text):
+		if f, err := strconv.ParseFloat(clean, 64); err == nil {
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid number %q", text)
+}
+
+// TOML number syntax: no leading zeros, underscores only between digits,
+// and unsigned lowercase 0x, 0o and 0b prefixes
+var (
+	tomlInteger         = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlPrefixedInteger = regexp.MustCompile(`^(0x[0-9a-fA-F](_?[0-9a-fA-F])*|0o[0-7](_?[0-7])*|0b[01](_?[01])*)$`)
+	tomlFloat           = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+)
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigTOML(t *testing.T) {
+	yamlContent := `
+numCores: 4
+clockFrequency: 4000
+isa: "x86"
+pipelineDepth: 14
+issueWidth: 4
+syncMode: true
+numALUs: 4
+numFPUs: 2
+numLoadStore: 2
+numBranch: 1
+forwardingEnabled: true
+branchPredictor: "gshare"
+interruptHandlerAddress: 0x8000
+l1Size: 64
+l1Associativity: 8
+l1Latency: 2
+l2Size: 1024
+l2Associativity: 16
+l2Latency: 10
+l3Size: 16384
+l3Associativity: 16
+l3Latency: 35
+memoryLatency: 150
+coherenceProtocol: "MOESI"
+interconnectType: "bus"
+interconnectBandwidth: 512
+busArbitrationPolicy: "priority"
+busPriorities: [3, 2, 1, 0]
+workloadPath: "workloads/test.bin"
+mixInteger: 70
+mixMemory: 30
+randSeed: 7
+coreTypes:
+  - name: big
+    pipelineDepth: 14
+  - name: little
+    isa: "RISC-V"
+    pipelineDepth: 5
+coreAssignment: ["big", "big", "little", "little"]
+`
+
+	tomlContent := `
+# Core configuration
+numCores = 4
+clockFrequency = 4_000 # MHz
+isa = "x86"
+pipelineDepth = 14
+issueWidth = 4
+syncMode = true
+numALUs = 4
+numFPUs = 2
+numLoadStore = 2
+numBranch = 1
+forwardingEnabled = true
+branchPredictor = 'gshare'
+interruptHandlerAddress = 0x8000
+l1Size = 64
+l1Associativity = 8
+l1Latency = 2
+l2Size = 1024
+l2Associativity = 16
+l2Latency = 10
+l3Size = 16384
+l3Associativity = 16
+l3Latency = 35
+memoryLatency = 150
+coherenceProtocol = "MOESI"
+interconnectType = "bus"
+interconnectBandwidth = 512
+busArbitrationPolicy = "priority"
+busPriorities = [
+  3, 2,
+  1, 0, # one per core
+]
+workloadPath = "workloads/test.bin"
+mixInteger = 70
+mixMemory = 30
+randSeed = 7
+coreAssignment = ["big", "big", "little", "little"]
+
+[[coreTypes]]
+name = "big"
+pipelineDepth = 14
+
+[[coreTypes]]
+name = "little"
+isa = "RISC-V"
+pipelineDepth = 5
+`
+
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	tomlPath := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(yamlPath, []byte(yamlContent), 0o644); err != nil {
+		t.Fatalf("Failed to write YAML config: %v", err)
+	}
+	if err := os.WriteFile(tomlPath, []byte(tomlContent), 0o644); err != nil {
+		t.Fatalf("Failed to write TOML config: %v", err)
+	}
+
+	fromYAML, err := LoadConfig(yamlPath)
+	if err != nil {
+		t.Fatalf("LoadConfig(yaml) error = %v", err)
+	}
+
+	// LoadConfig picks the TOML loader from the extension
+	fromTOML, err := LoadConfig(tomlPath)
+	if err != nil {
+		t.Fatalf("LoadConfig(toml) error = %v", err)
+	}
+
+	if !reflect.DeepEqual(fromYAML, fromTOML) {
+		t.Errorf("TOML config differs from YAML:\n%+v\n%+v", fromTOML, fromYAML)
+	}
+
+	// Validation is shared with the YAML path
+	invalid := filepath.Join(dir, "invalid.toml")
+	if err := os.WriteFile(invalid, []byte("numCores = 0\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write TOML config: %v", err)
+	}
+	if _, err := LoadConfigTOML(invalid); err == nil {
+		t.Errorf("LoadConfigTOML() with zero cores should return error")
+	}
+
+	// Malformed input is an error, not a crash
+	malformed := filepath.Join(dir, "malformed.toml")
+	if err := os.WriteFile(malformed, []byte("coreTypes = []\n[[coreTypes.big]]\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write TOML config: %v", err)
+	}
+	if _, err := LoadConfig(malformed); err == nil {
+		t.Errorf("LoadConfig() with a table below an empty array should return error")
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:  "Scalars",
+			input: "a = 1\nb = -2.5\nc = true\nd = \"x\\ty\"\ne = 'C:\\path'\nf = 0b101\n",
+			want: map[string]interface{}{
+				"a": int64(1), "b": -2.5, "c": true, "d": "x\ty", "e": `C:\path`, "f": int64(5),
+			},
+		},
+		{
+			name:  "Tables and dotted keys",
+			input: "[outer]\ninner.value = 1\n[outer.next]\nx = 2\n",
+			want: map[string]interface{}{
+				"outer": map[string]interface{}{
+					"inner": map[string]interface{}{"value": int64(1)},
+					"next":  map[string]interface{}{"x": int64(2)},
+				},
+			},
+		},
+		{
+			name:  "Inline table",
+			input: "point = { x = 1, y = 2 }\n",
+			want: map[string]interface{}{
+				"point": map[string]interface{}{"x": int64(1), "y": int64(2)},
+			},
+		},
+		{
+			name:  "Numbers",
+			input: "a = 1_000\nb = 0o17\nc = 0xff\nd = 1e3\ne = -0\nf = +1.5e-1\n",
+			want: map[string]interface{}{
+				"a": int64(1000), "b": int64(15), "c": int64(255), "d": 1000.0, "e": int64(0), "f": 0.15,
+			},
+		},
+		{
+			name:  "Arrays",
+			input: "a = [1, [2, 3], \"s\"]\nb = []\nc = [{ x = 1 }]\n",
+			want: map[string]interface{}{
+				"a": []interface{}{int64(1), []interface{}{int64(2), int64(3)}, "s"},
+				"b": []interface{}{},
+				"c": []interface{}{map[string]interface{}{"x": int64(1)}},
+			},
+		},
+		{
+			name:  "Arrays of tables",
+			input: "[[a]]\nx = 1\n[a.b]\ny = 2\n[[a.c]]\nz = 3\n[[a]]\nx = 4\n",
+			want: map[string]interface{}{
+				"a": []interface{}{
+					map[string]interface{}{
+						"x": int64(1),
+						"b": map[string]interface{}{"y": int64(2)},
+						"c": []interface{}{map[string]interface{}{"z": int64(3)}},
+					},
+					map[string]interface{}{"x": int64(4)},
+				},
+			},
+		},
+		{name: "Duplicate key", input: "a = 1\na = 2\n", wantErr: true},
+		{name: "Table defined twice", input: "[a]\nx = 1\n[a]\ny = 2\n", wantErr: true},
+		{name: "Table below a value", input: "a = 1\n[a.b]\n", wantErr: true},
+		{name: "Table below an empty array", input: "x = []\n[x.y]\n", wantErr: true},
+		{name: "Array of tables below an empty array", input: "x = []\n[[x.y]]\n", wantErr: true},
+		{name: "Dotted key below an empty array", input: "x = []\nx.y = 1\n", wantErr: true},
+		{name: "Table below an array of values", input: "x = [{ a = 1 }]\n[x.y]\n", wantErr: true},
+		{name: "Array of tables extending an array of values", input: "x = [1]\n[[x]]\n", wantErr: true},
+		{name: "Table redefining an array of tables", input: "[[a]]\n[a]\n", wantErr: true},
+		{name: "Array of tables redefining a table", input: "[a]\n[[a]]\n", wantErr: true},
+		{name: "Empty table header", input: "[]\n", wantErr: true},
+		{name: "Unclosed table header", input: "[a\n", wantErr: true},
+		{name: "Unclosed array of tables header", input: "[[a]\n", wantErr: true},
+		{name: "Key without value", input: "a\n", wantErr: true},
+		{name: "Unclosed array", input: "a = [1, 2\n", wantErr: true},
+		{name: "Array without commas", input: "a = [1 2]\n", wantErr: true},
+		{name: "Unclosed inline table", input: "a = { x = 1\n", wantErr: true},
+		{name: "Invalid escape", input: "a = \"\\q\"\n", wantErr: true},
+		{name: "Surrogate escape", input: "a = \"\\uD800\"\n", wantErr: true},
+		{name: "Leading zero", input: "a = 010\n", wantErr: true},
+		{name: "Doubled underscore", input: "a = 1__0\n", wantErr: true},
+		{name: "Leading underscore", input: "a = _1\n", wantErr: true},
+		{name: "Uppercase prefix", input: "a = 0X10\n", wantErr: true},
+		{name: "Signed hex", input: "a = -0x10\n", wantErr: true},
+		{name: "Trailing dot", input: "a = 1.\n", wantErr: true},
+		{name: "Leading dot", input: "a = .5\n", wantErr: true},
+		{name: "Missing value", input: "a =\n", wantErr: true},
+		{name: "Unterminated string", input: "a = \"open\n", wantErr: true},
+		{name: "Trailing garbage", input: "a = 1 2\n", wantErr: true},
+		{name: "Multi-line string", input: "a = \"\"\"x\"\"\"\n", wantErr: true},
+		{name: "Date-time", input: "a = 1979-05-27T07:32:00Z\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTOML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
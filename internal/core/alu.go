@@ -0,0 +1,71 @@
+package core
+
+// Opcode is an instruction's operation. Integer operations occupy
+// 0x00-0x3F and read two source registers.
+type Opcode uint8
+
+// Integer ALU opcodes
+const (
+	OpNOP Opcode = 0x00
+	OpADD Opcode = 0x01 // rd = rs1 + rs2
+	OpSUB Opcode = 0x02 // rd = rs1 - rs2
+	OpAND Opcode = 0x03 // rd = rs1 & rs2
+	OpOR  Opcode = 0x04 // rd = rs1 | rs2
+	OpXOR Opcode = 0x05 // rd = rs1 ^ rs2
+	OpSLL Opcode = 0x06 // rd = rs1 << rs2, shift amount modulo 64
+	OpSRL Opcode = 0x07 // rd = rs1 >> rs2, logical
+	OpSRA Opcode = 0x08 // rd = rs1 >> rs2, arithmetic
+)
+
+// String returns the opcode's mnemonic
+func (op Opcode) String() string {
+	switch op {
+	case OpNOP:
+		return "NOP"
+	case OpADD:
+		return "ADD"
+	case OpSUB:
+		return "SUB"
+	case OpAND:
+		return "AND"
+	case OpOR:
+		return "OR"
+	case OpXOR:
+		return "XOR"
+	case OpSLL:
+		return "SLL"
+	case OpSRL:
+		return "SRL"
+	case OpSRA:
+		return "SRA"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// executeALU applies an integer operation to its source values. It returns
+// false for opcodes that produce no result, leaving the destination as is.
+func executeALU(op Opcode, a, b uint64) (uint64, bool) {
+	shift := b & 63
+
+	switch op {
+	case OpADD:
+		return a + b, true
+	case OpSUB:
+		return a - b, true
+	case OpAND:
+		return a & b, true
+	case OpOR:
+		return a | b, true
+	case OpXOR:
+		return a ^ b, true
+	case OpSLL:
+		return a << shift, true
+	case OpSRL:
+		return a >> shift, true
+	case OpSRA:
+		return uint64(int64(a) >> shift), true
+	default:
+		return 0, false
+	}
+}
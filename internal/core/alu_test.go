@@ -0,0 +1,41 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestExecuteALU(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     Opcode
+		a, b   uint64
+		want   uint64
+		wantOK bool
+	}{
+		{name: "ADD", op: OpADD, a: 5, b: 7, want: 12, wantOK: true},
+		{name: "ADD wraps", op: OpADD, a: ^uint64(0), b: 2, want: 1, wantOK: true},
+		{name: "SUB", op: OpSUB, a: 7, b: 5, want: 2, wantOK: true},
+		{name: "AND", op: OpAND, a: 0b1100, b: 0b1010, want: 0b1000, wantOK: true},
+		{name: "OR", op: OpOR, a: 0b1100, b: 0b1010, want: 0b1110, wantOK: true},
+		{name: "XOR", op: OpXOR, a: 0b1100, b: 0b1010, want: 0b0110, wantOK: true},
+		{name: "SLL", op: OpSLL, a: 1, b: 4, want: 16, wantOK: true},
+		{name: "SLL shift modulo 64", op: OpSLL, a: 1, b: 65, want: 2, wantOK: true},
+		{name: "SRL", op: OpSRL, a: 1 << 63, b: 62, want: 2, wantOK: true},
+		{name: "SRA keeps the sign", op: OpSRA, a: 1 << 63, b: 62, want: ^uint64(1), wantOK: true},
+		{name: "NOP has no result", op: OpNOP, a: 1, b: 2, wantOK: false},
+		{name: "Unassigned opcode", op: 0x3F, a: 1, b: 2, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := executeALU(tt.op, tt.a, tt.b)
+			if ok != tt.wantOK {
+				t.Fatalf("executeALU(%s) ok = %v, want %v", tt.op, ok, tt.wantOK)
+			}
+
+			if ok && got != tt.want {
+				t.Errorf("executeALU(%s, %#x, %#x) = %#x, want %#x", tt.op, tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
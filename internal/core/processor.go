@@ -2,34 +2,147 @@ package core
 
 import (
 	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 
+	"github.com/jasonKoogler/cpu-sim/internal/cache"
+	"github.com/jasonKoogler/cpu-sim/internal/coherence"
 	"github.com/jasonKoogler/cpu-sim/internal/config"
+	"github.com/jasonKoogler/cpu-sim/internal/interconnect"
+	"github.com/jasonKoogler/cpu-sim/internal/memory"
 	"github.com/jasonKoogler/cpu-sim/internal/pipeline"
+	"github.com/jasonKoogler/cpu-sim/internal/predictor"
+	"github.com/jasonKoogler/cpu-sim/internal/workload"
 )
 
 type ExecutionUnit struct {
-	Type     string // "ALU", "FPU", "LoadStore", "Branch"
-	Busy     bool   // true if the unit is currently executing an instruction
-	Pipeline int    // number of stages in this unit
+	Type       string // "ALU", "FPU", "LoadStore", "Branch"
+	Busy       bool   // true if the unit is currently executing an instruction
+	Pipeline   int    // number of stages in this unit
+	cyclesLeft int    // cycles until the unit can accept another instruction
+	busyCycles int64  // cycles spent executing
 }
 
 type Processor struct {
 	ID                   int
 	config               *config.Config
 	pipeline             *pipeline.Pipeline
-	instructionQueue     []Instruction
+	caches               *cache.Hierarchy
+	coherence            *coherence.Controller        // shared with the other cores, nil if disabled
+	memoryPorts          *memory.MemoryPorts          // shared with the other cores, nil if unlimited
+	numa                 *memory.NUMA                 // shared with the other cores, nil for uniform memory
+	dram                 *memory.DRAM                 // shared with the other cores, nil for a flat memory latency
+	interconnect         *interconnect.Interconnect   // shared with the other cores, nil if not modelled
+	busArbiter           *coherence.BusArbiter        // shared with the other cores, nil unless they run in lockstep on a bus
+	peerCaches           []*cache.Hierarchy           // every core's caches by core ID, nil unless fetches may come from them
+	tlb                  *memory.TLB                  // nil when addresses are not translated
+	storeBuffer          *memory.StoreBuffer          // nil when stores write the cache directly
+	writeCombining       *memory.WriteCombiningBuffer // shared by the core's threads, nil when stores write the cache directly
+	instructionQueue     []*pipeline.Instruction      // fetched instructions waiting for the first stage, oldest first
+	source               InstructionSource            // where fetch gets instructions
+	retireHook           func(Instruction)            // called with each retired instruction, nil when unset
+	invalidated          []uint64                     // lines other cores invalidated since the last cycle
+	invalidatedMutex     sync.Mutex                   // guards invalidated, appended to from other cores' cycles
+	atomicHolds          map[uint64]int               // line -> cycles until the atomic holding it completes
+	entryPC              uint64                       // where threads start fetching
+	rng                  *rand.Rand                   // drives the synthetic instruction mix
+	rngSource            *countingSource              // rng's source, counted for checkpoints
 	executionUnits       map[string][]*ExecutionUnit
-	registersInt         []uint64
-	registersFloat       []float64
-	pc                   uint64 // program counter
-	executedInstructions int64
+	threads              []*hwThread // hardware threads sharing the pipeline
+	nextThread           int         // thread offered the next fetch slot
 	cycleCount           int64
-	busyCycles           int64
+	busyCycles           int64 // cycles an instruction was fetched, changed stage or retired, or an interrupt handler ran
+	stallCycles          int64 // cycles instructions were in flight but none changed stage
+	bubbleCycles         int64 // cycles the pipeline sat empty with nothing fetched
+	interrupts           int64
+	interruptCycles      int64
+	handlerInstructions  int64        // instructions interrupt handlers retired
+	handler              handlerPhase // how far the core is through taking an interrupt
+	handlerCyclesLeft    int          // cycles remaining in the handler's entry or exit
+	handlerRetired       int          // instructions the running handler has retired
+	predictor            predictor.BranchPredictor
+	branchPredictions    int64
+	branchMispredictions int64
+	mispredictCycles     int64            // fetch cycles lost refilling after mispredicts
+	flushCycles          int64            // fetch cycles lost refilling after flushes of any kind
+	takenBranches        int64            // resolved branches that were taken
+	fetchRedirects       int64            // times fetch was steered away from the next sequential address
+	predicated           int64            // instructions retired or skipped in the shadow of a predicated branch
+	avoidedFlushes       int64            // predicated branches the predictor would have mispredicted
+	fetchQueueStalls     int64            // fetch cycles a full instruction queue held fetch back
+	memoryFaults         int64            // fetches and data accesses outside physical memory
+	halted               bool             // stopped by a memory fault until Reset
+	dataAccesses         int64            // loads and stores performed by Memory instructions
+	peerFetches          int64            // instruction fetches served from another core's caches
+	missDone             int64            // cycle the latest outstanding L1 data miss completes
+	hitsUnderMiss        int64            // L1 data hits served while a miss was outstanding
+	hitUnderMissCycles   int64            // cycles port contention added to those hits
+	dataAccessCycles     int64            // total latency of those accesses
+	latencyHistogram     []int64          // memory accesses per config.LatencyBuckets bucket, nil without buckets
+	retiredByType        map[string]int64 // retired instructions by type
+	retiredByAddress     map[uint64]int64 // retired instructions by address, nil unless profiling hot spots
 	mutex                sync.RWMutex
 }
 
+// hwThread is the architectural state of one hardware thread. With SMT
+// several threads share the core's pipeline, execution units and caches.
+type hwThread struct {
+	registersInt     []uint64
+	registersFloat   []float64
+	pc               uint64               // program counter
+	returnPC         uint64               // pc to resume at when an interrupt handler exits
+	fetchStallCycles int                  // cycles remaining before fetch resumes after a flush
+	stallReason      pipeline.FlushReason // flush that caused the fetch stall
+	retired          int64                // instructions retired by this thread
+	drained          bool                 // the last fetch found nothing at drainedPC
+	drainedPC        uint64
+	shadowStart      uint64 // shadow of the latest predicated branch, fetched without steering
+	shadowEnd        uint64 // its target; shadowStart == shadowEnd without a shadow
+	shadowSkipped    bool   // the branch was taken, so instructions fetched in the shadow are nullified
+}
+
+// handlerPhase is how far a core is through taking an interrupt
+type handlerPhase int
+
+const (
+	handlerNone  handlerPhase = iota
+	handlerEntry              // paying the entry cost
+	handlerBody               // thread 0 fetching and retiring the handler
+	handlerExit               // paying the exit cost
+)
+
+// inShadow reports whether addr lies between the thread's latest predicated
+// branch and its target
+func (t *hwThread) inShadow(addr uint64) bool {
+	return addr >= t.shadowStart && addr < t.shadowEnd
+}
+
+// canFetch reports whether fetch might find an instruction at the thread's
+// pc; sources always give the same answer for the same pc
+func (t *hwThread) canFetch() bool {
+	return !t.drained || t.drainedPC != t.pc
+}
+
+// reset clears the thread's registers, pc and counters
+func (t *hwThread) reset() {
+	for i := range t.registersInt {
+		t.registersInt[i] = 0
+	}
+
+	for i := range t.registersFloat {
+		t.registersFloat[i] = 0.0
+	}
+
+	t.pc, t.returnPC, t.fetchStallCycles, t.retired = 0, 0, 0, 0
+	t.stallReason = pipeline.FlushMispredict
+	t.drained = false
+	t.shadowStart, t.shadowEnd, t.shadowSkipped = 0, 0, false
+}
+
 type Instruction struct {
 	Address    uint64
 	Opcode     uint8
@@ -37,6 +150,77 @@ type Instruction struct {
 	Type       string // "Integer", "Float", "Memory", "Branch", "System"
 	Stage      string // Current pipeline stage
 	CyclesLeft int    // Number of cycles left in the current stage
+	Thread     int    // hardware thread that fetched the instruction
+	Target     uint64 // branch target address
+	Length     int    // encoding size in bytes
+	DecodeCost int    // extra cycles spent in the first decode stage
+}
+
+// syntheticBranchOffset is how far ahead generated branches jump when taken
+const syntheticBranchOffset = 64
+
+// x86LengthWeights is the relative frequency, in percent, of each x86
+// encoding length from 1 to 15 bytes in the synthetic generator
+var x86LengthWeights = [...]int{1: 5, 2: 16, 3: 20, 4: 14, 5: 14, 6: 10, 7: 8, 8: 4, 9: 2, 10: 2, 11: 1, 12: 1, 13: 1, 14: 1, 15: 1}
+
+// x86DecodeBytesPerCycle is how many bytes of an x86 encoding the decoder
+// handles in a cycle; longer encodings spend extra cycles in decode
+const x86DecodeBytesPerCycle = 4
+
+// x86DecodeCost returns the extra decode cycles of an x86 instruction of
+// length bytes
+func x86DecodeCost(length int) int {
+	return (length - 1) / x86DecodeBytesPerCycle
+}
+
+// unitForType returns the execution unit type that runs instructions of the
+// given type
+func unitForType(instType string) string {
+	switch instType {
+	case "Float":
+		return "FPU"
+	case "Memory":
+		return "LoadStore"
+	case "Branch":
+		return "Branch"
+	default:
+		return "ALU" // Integer and System
+	}
+}
+
+// toPipeline converts a fetched instruction into its pipeline form, decoding
+// the destination and source registers from the operands
+func (inst *Instruction) toPipeline() *pipeline.Instruction {
+	pipelineInst := &pipeline.Instruction{
+		Address:    inst.Address,
+		Opcode:     inst.Opcode,
+		Operands:   inst.Operands,
+		Type:       inst.Type,
+		CyclesLeft: 1,
+		DestReg:    pipeline.NoReg,
+		Thread:     inst.Thread,
+		Target:     inst.Target,
+		Length:     inst.Length,
+		DecodeCost: inst.DecodeCost,
+	}
+
+	// Operands are laid out as destination, then sources
+	if len(inst.Operands) > 0 {
+		for _, src := range inst.Operands[1:] {
+			pipelineInst.SrcRegs = append(pipelineInst.SrcRegs, int(src))
+		}
+
+		// A branch's first operand is its offset. Only jal writes a
+		// register, linking the return address unless it discards it in x0.
+		if inst.Type != "Branch" {
+			pipelineInst.DestReg = int(inst.Operands[0])
+		} else if inst.Opcode == workload.OpcodeJAL && len(inst.Operands) > 1 && inst.Operands[1] != 0 {
+			pipelineInst.DestReg = int(inst.Operands[1])
+			pipelineInst.Result, pipelineInst.HasResult = inst.Address+workload.InstructionSize, true
+		}
+	}
+
+	return pipelineInst
 }
 
 func NewProcessor(id int, cfg *config.Config) (*Processor, error) {
@@ -48,6 +232,53 @@ func NewProcessor(id int, cfg *config.Config) (*Processor, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pipeline: %w", err)
 	}
+	pipe.SetPowerGating(cfg.PowerGateIdleThreshold, cfg.PowerGateWakeLatency)
+	pipe.SetForwarding(cfg.ForwardingEnabled)
+	pipe.SetIssueWidth(cfg.IssueWidth)
+	pipe.SetStageLatencies(cfg.StageLatencies)
+	if cfg.OutOfOrder {
+		if err := pipe.SetOutOfOrder(cfg.ROBSize, cfg.ReservationStations); err != nil {
+			return nil, fmt.Errorf("failed to create pipeline: %w", err)
+		}
+	}
+
+	bp, err := predictor.New(cfg.BranchPredictor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create branch predictor: %w", err)
+	}
+
+	caches, err := cache.NewHierarchy(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache hierarchy: %w", err)
+	}
+
+	var tlb *memory.TLB
+	if cfg.TLBEntries > 0 {
+		ways := max(cfg.TLBAssociativity, 1)
+		if cfg.TLBAssociativity == config.FullyAssociative {
+			ways = cfg.TLBEntries
+		}
+		tlb, err = memory.NewTLB(cfg.TLBEntries, ways, cfg.PageSize, cfg.PageWalkLatency, uint64(cfg.RandSeed+int64(id)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TLB: %w", err)
+		}
+	}
+
+	var storeBuffer *memory.StoreBuffer
+	if cfg.StoreBufferEntries > 0 {
+		storeBuffer, err = memory.NewStoreBuffer(cfg.StoreBufferEntries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create store buffer: %w", err)
+		}
+	}
+
+	var writeCombining *memory.WriteCombiningBuffer
+	if cfg.WriteCombiningEntries > 0 {
+		writeCombining, err = memory.NewWriteCombiningBuffer(cfg.WriteCombiningEntries, caches.LineSize(), cfg.WriteCombiningFlushPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create write-combining buffer: %w", err)
+		}
+	}
 
 	var numIntRegs, numFloatRegs int
 	switch cfg.ISA {
@@ -69,64 +300,131 @@ func NewProcessor(id int, cfg *config.Config) (*Processor, error) {
 	}
 
 	proc := &Processor{
-		ID:               id,
-		config:           cfg,
-		pipeline:         pipe,
-		instructionQueue: make([]Instruction, 0, 32), // Default queue size
-		registersInt:     make([]uint64, numIntRegs),
-		registersFloat:   make([]float64, numFloatRegs),
-		pc:               0,
-		executionUnits:   make(map[string][]*ExecutionUnit),
+		ID:             id,
+		config:         cfg,
+		pipeline:       pipe,
+		caches:         caches,
+		tlb:            tlb,
+		storeBuffer:    storeBuffer,
+		writeCombining: writeCombining,
+		predictor:      bp,
+		threads:        make([]*hwThread, cfg.Threads()),
+		executionUnits: make(map[string][]*ExecutionUnit),
+		retiredByType:  make(map[string]int64),
 	}
+	if cfg.ProfileHotspots {
+		proc.retiredByAddress = make(map[uint64]int64)
+	}
+	if len(cfg.LatencyBuckets) > 0 {
+		proc.latencyHistogram = make([]int64, len(cfg.LatencyBuckets)+1)
+	}
+	proc.seed(cfg.RandSeed + int64(id))
+	proc.source = NewSyntheticSource(cfg, proc.rng)
 
-	// Initialize execution units
-	// TODO: Make this configurable
-
-	// ALUs (Arithmetic Logic Units)
-	numALUs := 2
-	proc.executionUnits["ALU"] = make([]*ExecutionUnit, numALUs)
-	for i := 0; i < numALUs; i++ {
-		proc.executionUnits["ALU"][i] = &ExecutionUnit{
-			Type:     "ALU",
-			Busy:     false,
-			Pipeline: 1, // Simple ALU has one stage
+	for t := range proc.threads {
+		proc.threads[t] = &hwThread{
+			registersInt:   make([]uint64, numIntRegs),
+			registersFloat: make([]float64, numFloatRegs),
 		}
 	}
 
-	// FPUs (Floating Point Units)
-	numFPUs := 1
-	proc.executionUnits["FPU"] = make([]*ExecutionUnit, numFPUs)
-	for i := 0; i < numFPUs; i++ {
-		proc.executionUnits["FPU"][i] = &ExecutionUnit{
-			Type:     "FPU",
-			Busy:     false,
-			Pipeline: 3, // FPU has 3 stages
+	// Initialize execution units
+	proc.addUnits("ALU", cfg.NumALUs, 1)            // Simple ALU has one stage
+	proc.addUnits("FPU", cfg.NumFPUs, 3)            // FPU has 3 stages
+	proc.addUnits("LoadStore", cfg.NumLoadStore, 1) // LoadStore has 1 stage
+	proc.addUnits("Branch", cfg.NumBranch, 1)       // Branch has 1 stage
+
+	pipe.SetDispatcher(proc.dispatch)
+	pipe.SetUnitLatency(proc.unitLatency)
+	pipe.SetMemoryAccess(proc.dataAccess)
+	pipe.SetExecutor(proc.execute)
+	pipe.SetWriteback(proc.writeback)
+
+	return proc, nil
+}
+
+// Validate checks that the core can run instructions of the given types: its
+// pipeline needs to fetch first and have Execute and Writeback stages, x86
+// cores need a decode stage for their variable-length encodings, and each
+// type needs an execution unit
+func (p *Processor) Validate(types []string) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	stages := p.pipeline.GetStages()
+	hasExecute, hasWriteback, hasDecode := false, false, false
+	for _, stage := range stages {
+		hasExecute = hasExecute || stage.Name == "Execute"
+		hasWriteback = hasWriteback || stage.Name == "Writeback"
+		hasDecode = hasDecode || strings.HasPrefix(stage.Name, "Decode")
+	}
+
+	if !strings.HasPrefix(stages[0].Name, "Fetch") || !hasExecute || !hasWriteback {
+		return fmt.Errorf("a %d-stage %s pipeline lacks Fetch, Execute or Writeback", len(stages), p.config.ISA)
+	}
+
+	if p.config.ISA == "x86" && !hasDecode {
+		return fmt.Errorf("a %d-stage x86 pipeline has no decode stage for variable-length instructions", len(stages))
+	}
+
+	for _, instType := range types {
+		if unit := unitForType(instType); len(p.executionUnits[unit]) == 0 {
+			return fmt.Errorf("no %s unit to execute %s instructions", unit, instType)
 		}
 	}
+	return nil
+}
 
-	// LoadStore unit
-	numLSUs := 1
-	proc.executionUnits["LoadStore"] = make([]*ExecutionUnit, numLSUs)
-	for i := 0; i < numLSUs; i++ {
-		proc.executionUnits["LoadStore"][i] = &ExecutionUnit{
-			Type:     "LoadStore",
+// addUnits creates count execution units of the given type
+func (p *Processor) addUnits(unitType string, count, stages int) {
+	p.executionUnits[unitType] = make([]*ExecutionUnit, count)
+	for i := 0; i < count; i++ {
+		p.executionUnits[unitType][i] = &ExecutionUnit{
+			Type:     unitType,
 			Busy:     false,
-			Pipeline: 1, // LoadStore has 1 stage
+			Pipeline: stages,
 		}
 	}
+}
 
-	// Branch unit
-	numBranches := 1
-	proc.executionUnits["Branch"] = make([]*ExecutionUnit, numBranches)
-	for i := 0; i < numBranches; i++ {
-		proc.executionUnits["Branch"][i] = &ExecutionUnit{
-			Type:     "Branch",
-			Busy:     false,
-			Pipeline: 1, // Branch has 1 stage
+// dispatch claims a free execution unit of the type inst needs and returns
+// its latency, or false if all of them are busy
+func (p *Processor) dispatch(inst *pipeline.Instruction) (int, bool) {
+	for _, unit := range p.executionUnits[unitForType(inst.Type)] {
+		if !unit.Busy {
+			unit.Busy = true
+			unit.cyclesLeft = unit.Pipeline
+			return unit.Pipeline, true
 		}
 	}
+	return 0, false
+}
 
-	return proc, nil
+// unitLatency returns the latency of the execution units that would take
+// inst, all of which have the same depth
+func (p *Processor) unitLatency(inst *pipeline.Instruction) int {
+	if units := p.executionUnits[unitForType(inst.Type)]; len(units) > 0 {
+		return units[0].Pipeline
+	}
+	return 0
+}
+
+// releaseUnits advances every busy execution unit by a cycle, freeing those
+// that have finished
+func (p *Processor) releaseUnits() {
+	for _, units := range p.executionUnits {
+		for _, unit := range units {
+			if !unit.Busy {
+				continue
+			}
+
+			unit.busyCycles++
+			unit.cyclesLeft--
+			if unit.cyclesLeft <= 0 {
+				unit.Busy = false
+			}
+		}
+	}
 }
 
 // Cycle executes a single processor cycle
@@ -135,114 +433,2152 @@ func (p *Processor) Cycle() {
 	defer p.mutex.Unlock()
 
 	atomic.AddInt64(&p.cycleCount, 1)
+	p.releaseAtomics(1)
+	p.checkInvalidations()
+
+	// A core halted by a memory fault sits idle until Reset
+	if p.halted {
+		atomic.AddInt64(&p.bubbleCycles, 1)
+		return
+	}
 
-	// Check if any work is being done in this cycle
-	workDone := false
+	p.releaseUnits()
+
+	// Buffered stores drain to the cache whatever the pipeline is doing
+	if p.storeBuffer != nil {
+		p.storeBuffer.Drain(p.drainStore)
+	}
+
+	// Take a periodic interrupt unless a handler is already running
+	if interval := int64(p.config.InterruptInterval); interval > 0 &&
+		p.cycleCount%interval == 0 && p.handler == handlerNone {
+		p.enterInterrupt()
+	}
+
+	if p.handler != handlerNone {
+		atomic.AddInt64(&p.interruptCycles, 1)
+	}
+
+	// Entering and leaving the handler occupy the core until their cost is
+	// paid
+	if p.handlerCyclesLeft > 0 {
+		p.handlerCyclesLeft--
+		atomic.AddInt64(&p.busyCycles, 1)
+		if p.handlerCyclesLeft == 0 {
+			p.nextHandlerPhase()
+		}
+		return
+	}
 
 	// Process pipeline stages
-	if p.pipeline.AdvanceStages() {
-		workDone = true
-	}
-
-	// Fetch new instruction if pipeline can accept it
-	if !p.pipeline.IsFull() && p.cycleCount%5 == 0 { // Fetch every 5 cycles (synthetic workload)
-		inst := p.fetchNextInstruction()
-		if inst != nil {
-			pipelineInst := &pipeline.Instruction{
-				Address:    inst.Address,
-				Opcode:     inst.Opcode,
-				Operands:   inst.Operands,
-				Type:       inst.Type,
-				CyclesLeft: 1,
-			}
+	occupied := p.pipeline.AdvanceStages()
+	progressed := p.pipeline.Progressed()
+
+	// Branches are resolved as they enter Execute; a mispredict squashes
+	// any younger branches of its thread resolving alongside it
+	var squashed map[int]bool
+	for _, branch := range p.pipeline.ResolvingBranches() {
+		if squashed[branch.Thread] {
+			continue
+		}
 
-			if p.pipeline.InsertInstruction(pipelineInst) {
-				workDone = true
+		if p.resolveBranch(branch) {
+			if squashed == nil {
+				squashed = make(map[int]bool)
 			}
+			squashed[branch.Thread] = true
 		}
 	}
 
-	// Count a completed instruction if one reached the end of the pipeline
-	stages := p.pipeline.GetStages()
-	if len(stages) > 0 && !stages[len(stages)-1].Busy && p.cycleCount%5 == 0 {
-		atomic.AddInt64(&p.executedInstructions, 1)
+	// Threads refilling after a flush sit out this cycle's fetch
+	stalled := make([]bool, len(p.threads))
+	for i, t := range p.threads {
+		if t.fetchStallCycles > 0 {
+			t.fetchStallCycles--
+			stalled[i] = true
+			p.countFlushCycles(t, 1)
+		}
+	}
+
+	// Only thread 0 runs the interrupt handler
+	if p.handler == handlerBody {
+		for i := 1; i < len(stalled); i++ {
+			stalled[i] = true
+		}
+	}
+
+	// Fetch up to a full group of new instructions if pipeline can accept
+	// them, or with an instruction queue, if the queue has room for them
+	fetchCycle := p.cycleCount%int64(max(p.config.FetchInterval, 1)) == 0
+	if p.config.FetchQueueSize > 0 {
+		if p.fetchQueued(fetchCycle, stalled) {
+			progressed = true
+		}
+	} else if !p.pipeline.IsFull() && fetchCycle {
+		if p.pipeline.InsertInstructions(p.fetchGroup(stalled)) > 0 {
+			progressed = true
+		}
+	}
+
+	if p.handler == handlerBody && p.handlerDone() {
+		p.nextHandlerPhase()
 	}
 
-	// If any work was done, count as a busy cycle
-	if workDone {
+	// A fault that halts the core discards everything in flight
+	if p.halted {
+		p.flushPipeline(pipeline.FlushException)
+	}
+
+	// A cycle with nothing in flight is a front-end bubble; one where
+	// nothing in flight changed stage is a back-end stall
+	switch {
+	case progressed:
 		atomic.AddInt64(&p.busyCycles, 1)
+	case occupied:
+		atomic.AddInt64(&p.stallCycles, 1)
+	default:
+		atomic.AddInt64(&p.bubbleCycles, 1)
 	}
 }
 
-// fetchNextInstruction creates a synthetic instruction for simulation
-func (p *Processor) fetchNextInstruction() *Instruction {
-	// This is a simplified synthetic instruction generator
-	// In a real simulator, this would fetch from memory
+// fetchQueued fetches a group into the instruction queue on fetch cycles,
+// then moves as many queued instructions as the first pipeline stage can
+// take into it. A full queue holds fetch back, so a pipeline that stops
+// taking instructions eventually stalls fetch too. It returns true if any
+// instruction entered the pipeline.
+func (p *Processor) fetchQueued(fetchCycle bool, stalled []bool) bool {
+	if fetchCycle {
+		if len(p.instructionQueue) >= p.config.FetchQueueSize {
+			atomic.AddInt64(&p.fetchQueueStalls, 1)
+		} else {
+			p.instructionQueue = append(p.instructionQueue, p.fetchGroup(stalled)...)
+		}
+	}
+
+	n := p.pipeline.InsertInstructions(p.instructionQueue)
+	p.instructionQueue = slices.Delete(p.instructionQueue, 0, n)
+	return n > 0
+}
 
-	// Create a simple ALU instruction
-	inst := &Instruction{
-		Address:    p.pc,
-		Opcode:     0x01,             // ADD
-		Operands:   []uint8{1, 2, 3}, // r1 = r2 + r3
-		Type:       "Integer",
-		Stage:      "Fetch",
-		CyclesLeft: 1,
+// fetchSlots returns how many instructions the next fetch group may hold:
+// as many as the first stage has room for, or with an instruction queue, a
+// full group or the space left in the queue if that is less
+func (p *Processor) fetchSlots() int {
+	if p.config.FetchQueueSize > 0 {
+		return min(max(p.config.IssueWidth, 1), p.config.FetchQueueSize-len(p.instructionQueue))
 	}
+	return p.pipeline.FetchSlots()
+}
 
-	// Increment PC
-	p.pc += 4 // Assuming 4-byte instructions
+// IdleCycles returns how many of the next limit cycles the core is certain
+// to spend idle: nothing in flight, no interrupt taken and nothing fetched
+func (p *Processor) IdleCycles(limit int64) int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
 
-	return inst
+	if p.halted {
+		return limit
+	}
+
+	if p.handler != handlerNone || !p.pipeline.IsEmpty() || len(p.instructionQueue) > 0 {
+		return 0
+	}
+
+	if p.storeBuffer != nil && p.storeBuffer.Occupancy() > 0 {
+		return 0
+	}
+
+	for _, units := range p.executionUnits {
+		for _, unit := range units {
+			if unit.Busy {
+				return 0
+			}
+		}
+	}
+
+	// Count the cycles before the next interrupt, and before the first
+	// fetch cycle at which a thread with something to fetch is not stalled
+	idle := limit
+	if interval := int64(p.config.InterruptInterval); interval > 0 {
+		next := (p.cycleCount/interval + 1) * interval
+		idle = min(idle, next-p.cycleCount-1)
+	}
+
+	fetchInterval := int64(max(p.config.FetchInterval, 1))
+	for _, t := range p.threads {
+		if !t.canFetch() {
+			continue
+		}
+
+		first := p.cycleCount + int64(t.fetchStallCycles) + 1
+		next := (first + fetchInterval - 1) / fetchInterval * fetchInterval
+		idle = min(idle, next-p.cycleCount-1)
+	}
+	return max(idle, 0)
 }
 
-// GetExecutedInstructions returns the number of instructions executed by this core
-func (p *Processor) GetExecutedInstructions() int64 {
-	return atomic.LoadInt64(&p.executedInstructions)
+// SkipIdle accounts for n cycles as if Cycle had run for each of them. n
+// must not exceed what IdleCycles returned.
+func (p *Processor) SkipIdle(n int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if n <= 0 {
+		return
+	}
+
+	atomic.AddInt64(&p.cycleCount, n)
+	p.releaseAtomics(n)
+	p.pipeline.SkipIdle(n)
+	for _, t := range p.threads {
+		stalled := min(int64(t.fetchStallCycles), n)
+		t.fetchStallCycles -= int(stalled)
+		p.countFlushCycles(t, stalled)
+	}
+	atomic.AddInt64(&p.bubbleCycles, n)
 }
 
-// GetUtilization returns the core utilization (busy cycles / total cycles)
-func (p *Processor) GetUtilization() float64 {
-	cycles := atomic.LoadInt64(&p.cycleCount)
-	if cycles == 0 {
-		return 0.0
+// fetchGroup fetches up to a full group of instructions from one thread.
+// Threads take turns round-robin; a stalled thread, or one with nothing left
+// to fetch, passes its turn to the next.
+func (p *Processor) fetchGroup(stalled []bool) []*pipeline.Instruction {
+	for n := 0; n < len(p.threads); n++ {
+		id := (p.nextThread + n) % len(p.threads)
+		if stalled[id] {
+			continue
+		}
+
+		slots := p.fetchSlots()
+		if p.handler == handlerBody {
+			slots = min(slots, p.handlerSlots())
+		}
+
+		t := p.threads[id]
+		var group []*pipeline.Instruction
+		for len(group) < slots {
+			inst := p.fetchNextInstruction(id)
+			if inst == nil {
+				break
+			}
+
+			pipelineInst := inst.toPipeline()
+			shadowed := t.inShadow(inst.Address)
+			if shadowed {
+				pipelineInst.Guarded, pipelineInst.Nullified = true, t.shadowSkipped
+			} else {
+				t.shadowStart, t.shadowEnd, t.shadowSkipped = 0, 0, false
+			}
+
+			// Branches in a predicated branch's shadow never steer fetch
+			if inst.Type == "Branch" && !shadowed {
+				pipelineInst.Predicted = inst.Opcode == workload.OpcodeJAL || p.predictor.Predict(inst.Address)
+				if p.predicates(inst) {
+					pipelineInst.Predicated = true
+					t.shadowStart, t.shadowEnd = inst.Address+uint64(inst.Length), inst.Target
+				}
+			}
+			group = append(group, pipelineInst)
+
+			// A branch predicted taken steers fetch to its target and ends
+			// the group, unless it is predicated
+			if pipelineInst.Predicted && !pipelineInst.Predicated {
+				p.threads[id].pc = inst.Target
+				atomic.AddInt64(&p.fetchRedirects, 1)
+				break
+			}
+		}
+
+		if len(group) > 0 {
+			p.nextThread = (id + 1) % len(p.threads)
+			return group
+		}
 	}
+	return nil
+}
 
-	busyCycles := atomic.LoadInt64(&p.busyCycles)
-	return float64(busyCycles) / float64(cycles)
+// predicates reports whether a branch runs predicated: with
+// PredicationDistance set, a conditional branch jumping forward over at
+// most that many instructions
+func (p *Processor) predicates(inst *Instruction) bool {
+	if p.config.PredicationDistance <= 0 || inst.Opcode == workload.OpcodeJAL {
+		return false
+	}
+
+	start := inst.Address + uint64(inst.Length)
+	return inst.Target > start &&
+		inst.Target-start <= uint64(p.config.PredicationDistance)*workload.InstructionSize
 }
 
-func (p *Processor) GetID() int {
-	return p.ID
+// branchTaken computes the direction of a branch from the registers it
+// compares: even opcodes branch if equal, odd opcodes if not equal
+func branchTaken(inst *pipeline.Instruction, read func(reg uint8) uint64) bool {
+	if len(inst.Operands) < 3 {
+		return false
+	}
+
+	equal := read(inst.Operands[1]) == read(inst.Operands[2])
+	if inst.Opcode%2 == 0 {
+		return equal
+	}
+	return !equal
 }
 
-// GetPipelineState returns a copy of the current pipeline state
-func (p *Processor) GetPipelineState() []*pipeline.Stage {
-	return p.pipeline.GetStages()
+// execute computes an integer instruction's result, or a branch's
+// direction, from its source registers, taking values still in flight from
+// the forwarding network
+func (p *Processor) execute(inst *pipeline.Instruction, forwarded func(reg int) (uint64, bool)) {
+	read := func(reg uint8) uint64 {
+		if v, ok := forwarded(int(reg)); ok {
+			return v
+		}
+		return p.readIntReg(inst.Thread, reg)
+	}
+
+	if inst.Nullified {
+		return
+	}
+
+	switch {
+	case inst.Type == "Branch":
+		inst.Taken = branchTaken(inst, read)
+	case inst.Type == "Integer" && len(inst.Operands) >= 3:
+		inst.Result, inst.HasResult = executeALU(Opcode(inst.Opcode), read(inst.Operands[1]), read(inst.Operands[2]))
+	}
 }
 
-func (p *Processor) Reset() {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+// writeback commits a retiring instruction's result to its thread's
+// register file and counts it by type, and by address when profiling. An
+// instruction a predicated branch skipped commits nothing.
+func (p *Processor) writeback(inst *pipeline.Instruction) {
+	if inst.Guarded {
+		atomic.AddInt64(&p.predicated, 1)
+	}
+	if inst.Nullified {
+		return
+	}
 
-	p.pc = 0
-	p.instructionQueue = make([]Instruction, 0, 32)
-	atomic.StoreInt64(&p.executedInstructions, 0)
-	atomic.StoreInt64(&p.cycleCount, 0)
-	atomic.StoreInt64(&p.busyCycles, 0)
+	p.retiredByType[inst.Type]++
+	if p.retiredByAddress != nil {
+		p.retiredByAddress[inst.Address]++
+	}
 
-	p.pipeline.Flush()
+	if p.retireHook != nil {
+		p.retireHook(Instruction{
+			Address:  inst.Address,
+			Opcode:   inst.Opcode,
+			Operands: inst.Operands,
+			Type:     inst.Type,
+			Thread:   inst.Thread,
+			Target:   inst.Target,
+			Length:   inst.Length,
+		})
+	}
 
-	for i := range p.registersInt {
-		p.registersInt[i] = 0
+	if p.handler == handlerBody && inst.Thread == 0 {
+		p.handlerRetired++
+		atomic.AddInt64(&p.handlerInstructions, 1)
 	}
 
-	for i := range p.registersFloat {
-		p.registersFloat[i] = 0.0
+	t := p.threads[inst.Thread]
+	t.retired++
+	if inst.HasResult && inst.DestReg >= 0 && inst.DestReg < len(t.registersInt) {
+		t.registersInt[inst.DestReg] = inst.Result
 	}
+}
 
-	for _, units := range p.executionUnits {
-		for _, unit := range units {
-			unit.Busy = false
+// readIntReg returns one of thread's integer registers, treating registers
+// the ISA does not have as zero
+func (p *Processor) readIntReg(thread int, reg uint8) uint64 {
+	regs := p.threads[thread].registersInt
+	if int(reg) >= len(regs) {
+		return 0
+	}
+	return regs[reg]
+}
+
+// resolveBranch checks a branch's prediction and trains the predictor,
+// returning true on a mispredict. The instructions fetched behind a
+// mispredicted branch are flushed, fetch restarts at the branch target if
+// it was taken or after the branch if not, and stalls for one cycle per
+// flushed stage. jal is always taken and never consults the predictor. A
+// predicated branch never mispredicts: taken, it nullifies its shadow.
+func (p *Processor) resolveBranch(inst *pipeline.Instruction) bool {
+	if inst.Nullified {
+		return false
+	}
+
+	taken := inst.Taken
+	if taken {
+		atomic.AddInt64(&p.takenBranches, 1)
+	}
+
+	if inst.Opcode == workload.OpcodeJAL {
+		return false
+	}
+
+	p.predictor.Update(inst.Address, taken)
+
+	if inst.Predicated {
+		if taken != inst.Predicted {
+			atomic.AddInt64(&p.avoidedFlushes, 1)
+		}
+		if taken {
+			p.skipShadow(inst)
+		}
+		t := p.threads[inst.Thread]
+		if t.shadowStart == inst.Address+uint64(inst.Length) && t.shadowEnd == inst.Target {
+			t.shadowSkipped = taken
+		}
+		return false
+	}
+
+	atomic.AddInt64(&p.branchPredictions, 1)
+
+	if taken == inst.Predicted {
+		return false
+	}
+
+	atomic.AddInt64(&p.branchMispredictions, 1)
+	t := p.threads[inst.Thread]
+	t.fetchStallCycles, t.stallReason = p.pipeline.FlushAfter(inst), pipeline.FlushMispredict
+	p.instructionQueue = slices.DeleteFunc(p.instructionQueue, func(queued *pipeline.Instruction) bool {
+		return queued.Thread == inst.Thread
+	})
+	t.pc = inst.Address + uint64(inst.Length)
+	if taken {
+		t.pc = inst.Target
+	}
+	atomic.AddInt64(&p.fetchRedirects, 1)
+	return true
+}
+
+// skipShadow nullifies the instructions a taken predicated branch jumps
+// over that are already in flight or queued
+func (p *Processor) skipShadow(branch *pipeline.Instruction) {
+	if !p.pipeline.Nullify(branch, branch.Target) {
+		return
+	}
+
+	for _, queued := range p.instructionQueue {
+		if queued.Thread != branch.Thread {
+			continue
+		}
+		if !queued.Guarded || queued.Address >= branch.Target {
+			return
+		}
+		queued.Nullified = true
+	}
+}
+
+// branchTarget returns the address a workload branch at addr jumps to when
+// taken; its offset is a signed word count
+func branchTarget(addr uint64, offset uint8) uint64 {
+	return addr + uint64(int64(int8(offset))*workload.InstructionSize)
+}
+
+// enterInterrupt drains the pipeline and redirects the core to the interrupt
+// handler, which runs on thread 0 once the entry cost is paid. Flushed
+// instructions are re-fetched once the handler returns.
+func (p *Processor) enterInterrupt() {
+	for _, t := range p.threads {
+		t.returnPC = t.pc
+	}
+
+	for i, pc := range p.restartPCs() {
+		p.threads[i].returnPC = pc
+	}
+
+	p.flushPipeline(pipeline.FlushException)
+	p.threads[0].pc = p.config.InterruptHandlerAddress
+	p.handler, p.handlerCyclesLeft = handlerEntry, p.config.InterruptEntryCycles
+	atomic.AddInt64(&p.interrupts, 1)
+
+	if p.handlerCyclesLeft == 0 {
+		p.nextHandlerPhase()
+	}
+}
+
+// nextHandlerPhase moves the interrupt handler on from the phase it has
+// finished, passing through phases that cost nothing
+func (p *Processor) nextHandlerPhase() {
+	switch p.handler {
+	case handlerEntry:
+		p.handler, p.handlerRetired = handlerBody, 0
+		if p.handlerDone() {
+			p.nextHandlerPhase()
+		}
+	case handlerBody:
+		p.handler, p.handlerCyclesLeft = handlerExit, p.config.InterruptExitCycles
+		if p.handlerCyclesLeft == 0 {
+			p.nextHandlerPhase()
+		}
+	case handlerExit:
+		p.handler = handlerNone
+		p.resumeThreads()
+	}
+}
+
+// handlerInFlight counts thread 0's instructions in the pipeline and the
+// instruction queue, which while the handler runs are all the handler's
+func (p *Processor) handlerInFlight() int {
+	n := 0
+	for _, inst := range append(p.pipeline.InFlight(), p.instructionQueue...) {
+		if inst.Thread == 0 {
+			n++
 		}
 	}
+	return n
+}
+
+// handlerSlots returns how many more handler instructions fetch may take:
+// those the handler has yet to retire, less those already in flight
+func (p *Processor) handlerSlots() int {
+	return max(p.config.InterruptHandlerInstructions-p.handlerRetired-p.handlerInFlight(), 0)
+}
+
+// handlerDone reports whether the handler has nothing left in flight and
+// has either retired all its instructions or found nothing more to fetch
+func (p *Processor) handlerDone() bool {
+	if p.handlerInFlight() > 0 {
+		return false
+	}
+	return p.handlerRetired >= p.config.InterruptHandlerInstructions || !p.threads[0].canFetch()
+}
+
+// restartPCs returns where each thread resumes after a full flush: at its
+// oldest instruction in flight, queued ones being younger than any in the
+// pipeline, or at its pc if it has none. Instructions a predicated branch
+// skipped are passed over, as is the rest of its shadow.
+func (p *Processor) restartPCs() []uint64 {
+	pcs := make([]uint64, len(p.threads))
+	seen := make([]bool, len(p.threads))
+	for i, t := range p.threads {
+		pcs[i] = t.pc
+	}
+	for _, inst := range append(p.pipeline.InFlight(), p.instructionQueue...) {
+		if !seen[inst.Thread] && !inst.Nullified {
+			seen[inst.Thread] = true
+			pcs[inst.Thread] = inst.Address
+		}
+	}
+	for i, t := range p.threads {
+		if t.shadowSkipped && t.inShadow(pcs[i]) {
+			pcs[i] = t.shadowEnd
+		}
+	}
+	return pcs
+}
+
+// flushPipeline discards everything in flight and queued, counting the
+// flush under reason, and writes out the write-combining buffer. With
+// FlushPenalty every thread then waits for the front-end stages to refill
+// before fetching again, as after a mispredict.
+func (p *Processor) flushPipeline(reason pipeline.FlushReason) {
+	p.pipeline.Flush(reason)
+	p.instructionQueue = nil
+	p.fenceWriteCombining()
+
+	if !p.config.FlushPenalty {
+		return
+	}
+	penalty := p.pipeline.FrontEndStages()
+	for _, t := range p.threads {
+		if penalty > t.fetchStallCycles {
+			t.fetchStallCycles, t.stallReason = penalty, reason
+		}
+	}
+}
+
+// countFlushCycles charges n cycles of t's fetch stall to the flush that
+// caused it
+func (p *Processor) countFlushCycles(t *hwThread, n int64) {
+	atomic.AddInt64(&p.flushCycles, n)
+	if t.stallReason == pipeline.FlushMispredict {
+		atomic.AddInt64(&p.mispredictCycles, n)
+	}
+}
+
+// invalidate drops a line another core's store invalidated from the caches
+// and, with FlushOnInvalidate, notes it for the next cycle's
+// checkInvalidations. It runs on the storing core's goroutine, so it leaves
+// the pipeline alone.
+func (p *Processor) invalidate(addr uint64) {
+	p.caches.Invalidate(addr)
+
+	if !p.config.FlushOnInvalidate {
+		return
+	}
+
+	p.invalidatedMutex.Lock()
+	p.invalidated = append(p.invalidated, addr/uint64(p.caches.LineSize()))
+	p.invalidatedMutex.Unlock()
+}
+
+// checkInvalidations flushes the pipeline when another core invalidated a
+// line that a load still in flight has already read, since the value it
+// read is stale. Every thread restarts at its oldest instruction in flight.
+func (p *Processor) checkInvalidations() {
+	p.invalidatedMutex.Lock()
+	lines := p.invalidated
+	p.invalidated = nil
+	p.invalidatedMutex.Unlock()
+
+	if len(lines) == 0 {
+		return
+	}
+
+	lineSize := uint64(p.caches.LineSize())
+	stale := false
+	for _, inst := range p.pipeline.InFlight() {
+		if inst.Loaded && slices.Contains(lines, inst.LoadAddr/lineSize) {
+			stale = true
+			break
+		}
+	}
+	if !stale {
+		return
+	}
+
+	for i, pc := range p.restartPCs() {
+		p.threads[i].pc = pc
+	}
+	p.flushPipeline(pipeline.FlushCoherence)
+}
+
+// resumeThreads returns every thread to where it was interrupted
+func (p *Processor) resumeThreads() {
+	for _, t := range p.threads {
+		t.pc = t.returnPC
+	}
+}
+
+// countingSource is a seeded random source that counts its draws, so a
+// checkpoint can restore it by replaying them
+type countingSource struct {
+	src   rand.Source64
+	seed  int64
+	draws uint64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64), seed: seed}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.seed, s.draws = seed, 0
+}
+
+// seed restarts the core's random source from seed. The synthetic source
+// keeps drawing from the same rng.
+func (p *Processor) seed(seed int64) {
+	if p.rng == nil {
+		p.rngSource = newCountingSource(seed)
+		p.rng = rand.New(p.rngSource)
+		return
+	}
+	p.rng.Seed(seed)
+}
+
+// SetSeed reseeds the source of the core's randomized decisions. Cores seed
+// their own from RandSeed and their ID until a seed is injected.
+func (p *Processor) SetSeed(seed int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.seed(seed)
+}
+
+// SetInstructionSource replaces where the core fetches its instructions
+// from. nil restores the synthetic generator.
+func (p *Processor) SetInstructionSource(src InstructionSource) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if src == nil {
+		src = NewSyntheticSource(p.config, p.rng)
+	}
+	p.source = src
+
+	for _, t := range p.threads {
+		t.drained = false
+	}
+}
+
+// SetRetireHook calls fn with each instruction the core retires, in program
+// order, from the goroutine running the core. The Operands are only valid
+// for the duration of the call. nil removes the hook.
+func (p *Processor) SetRetireHook(fn func(Instruction)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.retireHook = fn
+}
+
+// LoadWorkload replaces the instruction source with a loaded program,
+// fetched sequentially from address 0
+func (p *Processor) LoadWorkload(program []workload.Instruction) {
+	p.LoadProgram(&workload.Program{Instructions: program})
+}
+
+// LoadProgram replaces the instruction source with prog and points every
+// thread at its entry point, where they also restart after a Reset
+func (p *Processor) LoadProgram(prog *workload.Program) {
+	p.SetInstructionSource(NewProgramSource(prog))
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.entryPC = prog.Entry
+	for _, t := range p.threads {
+		t.pc = prog.Entry
+	}
+}
+
+// fetchNextInstruction returns the instruction at thread's pc and advances
+// it. It returns nil when the source has nothing there, such as past the end
+// of a loaded workload, or the pc lies outside physical memory.
+func (p *Processor) fetchNextInstruction(thread int) *Instruction {
+	t := p.threads[thread]
+	if !t.canFetch() {
+		return nil
+	}
+
+	inst, ok := p.source.Next(t.pc)
+	if !ok {
+		t.drained, t.drainedPC = true, t.pc
+		return nil
+	}
+
+	inst.Address = t.pc
+	inst.Stage = "Fetch"
+	inst.CyclesLeft = 1
+	inst.Thread = thread
+	if inst.Length <= 0 {
+		inst.Length = workload.InstructionSize
+	}
+	if p.config.ISA == "x86" {
+		inst.DecodeCost = x86DecodeCost(inst.Length)
+	}
+
+	// The fetch goes through the memory system, reading the next line too
+	// when the encoding straddles a line boundary. Fetch stops at a pc
+	// outside memory until a redirect moves it.
+	inBounds := p.fetchMemory(t.pc)
+	lineSize := uint64(p.caches.LineSize())
+	if end := t.pc + uint64(inst.Length) - 1; inBounds && end/lineSize != t.pc/lineSize {
+		inBounds = p.fetchMemory(end)
+	}
+
+	if !inBounds {
+		t.drained, t.drainedPC = true, t.pc
+		return nil
+	}
+
+	t.pc += uint64(inst.Length)
+
+	return inst
+}
+
+// ResourceBoundCycles returns a lower bound on the cycles this core needs to
+// execute workload, considering only structural limits: the front end's
+// issue width and the throughput of each execution unit type. Dependencies
+// and memory latency are ignored.
+func (p *Processor) ResourceBoundCycles(workload []Instruction) int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	perUnit := make(map[string]int64)
+	for _, inst := range workload {
+		perUnit[unitForType(inst.Type)]++
+	}
+
+	// Up to IssueWidth instructions issue per cycle
+	width := int64(max(p.config.IssueWidth, 1))
+	bound := (int64(len(workload)) + width - 1) / width
+
+	for unitType, count := range perUnit {
+		units := p.executionUnits[unitType]
+		if len(units) == 0 {
+			continue
+		}
+
+		// Each unit accepts a new instruction once its pipeline drains
+		occupancy := int64(units[0].Pipeline)
+		n := int64(len(units))
+		cycles := (count*occupancy + n - 1) / n
+		if cycles > bound {
+			bound = cycles
+		}
+	}
+
+	return bound
+}
+
+// GetExecutedInstructions returns the number of instructions retired by this core
+func (p *Processor) GetExecutedInstructions() int64 {
+	return p.pipeline.GetCompletedInstructions()
+}
+
+// GetRetiredByType returns the number of instructions retired by this core,
+// keyed by instruction type
+func (p *Processor) GetRetiredByType() map[string]int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	retired := make(map[string]int64, len(p.retiredByType))
+	for instType, n := range p.retiredByType {
+		retired[instType] = n
+	}
+	return retired
+}
+
+// GetRetiredByAddress returns the number of instructions retired by this
+// core, keyed by address, or nil unless profiling hot spots
+func (p *Processor) GetRetiredByAddress() map[uint64]int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.retiredByAddress == nil {
+		return nil
+	}
+
+	retired := make(map[uint64]int64, len(p.retiredByAddress))
+	for addr, n := range p.retiredByAddress {
+		retired[addr] = n
+	}
+	return retired
+}
+
+// GetHazardStalls returns the number of cycles lost to RAW data hazards
+func (p *Processor) GetHazardStalls() int64 {
+	return p.pipeline.GetHazardStalls()
+}
+
+// GetScoreboardStalls returns the number of cycles instructions waited to
+// issue behind WAW and WAR hazards
+func (p *Processor) GetScoreboardStalls() (waw, war int64) {
+	return p.pipeline.GetScoreboardStalls()
+}
+
+// GetForwardedHazards returns the number of RAW hazards resolved by forwarding
+func (p *Processor) GetForwardedHazards() int64 {
+	return p.pipeline.GetForwardedHazards()
+}
+
+// GetStructuralStalls returns the number of cycles instructions waited for
+// a free execution unit
+func (p *Processor) GetStructuralStalls() int64 {
+	return p.pipeline.GetStructuralStalls()
+}
+
+// GetStageStats returns the busy, stall and empty cycle counts of each of
+// this core's pipeline stages
+func (p *Processor) GetStageStats() []pipeline.StageStat {
+	return p.pipeline.StageStats()
+}
+
+// GetBranchStats returns the branch prediction counts for this core
+func (p *Processor) GetBranchStats() predictor.Stats {
+	return predictor.Stats{
+		Predictions:    atomic.LoadInt64(&p.branchPredictions),
+		Mispredictions: atomic.LoadInt64(&p.branchMispredictions),
+	}
+}
+
+// GetMispredictCycles returns the fetch cycles lost to branch mispredicts
+func (p *Processor) GetMispredictCycles() int64 {
+	return atomic.LoadInt64(&p.mispredictCycles)
+}
+
+// GetFlushCycles returns the fetch cycles lost refilling the pipeline after
+// flushes of any kind, mispredicts included
+func (p *Processor) GetFlushCycles() int64 {
+	return atomic.LoadInt64(&p.flushCycles)
+}
+
+// GetFlushes returns the number of pipeline flushes by reason
+func (p *Processor) GetFlushes() map[string]int64 {
+	flushes := make(map[string]int64, len(pipeline.FlushReasons))
+	for _, reason := range pipeline.FlushReasons {
+		flushes[reason.String()] = p.pipeline.Flushes(reason)
+	}
+	return flushes
+}
+
+// GetFetchQueueStalls returns the number of fetch cycles a full instruction
+// queue held fetch back
+func (p *Processor) GetFetchQueueStalls() int64 {
+	return atomic.LoadInt64(&p.fetchQueueStalls)
+}
+
+// GetMemoryFaults returns the number of fetches and data accesses that fell
+// outside physical memory
+func (p *Processor) GetMemoryFaults() int64 {
+	return atomic.LoadInt64(&p.memoryFaults)
+}
+
+// IsHalted reports whether a memory fault has stopped the core
+func (p *Processor) IsHalted() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.halted
+}
+
+// GetTakenBranches returns the number of resolved branches that were taken
+func (p *Processor) GetTakenBranches() int64 {
+	return atomic.LoadInt64(&p.takenBranches)
+}
+
+// GetFetchRedirects returns the number of times fetch was steered away from
+// the next sequential address, by a branch predicted taken or a mispredict
+func (p *Processor) GetFetchRedirects() int64 {
+	return atomic.LoadInt64(&p.fetchRedirects)
+}
+
+// GetPeerFetches returns the number of instruction fetches served from
+// another core's caches
+func (p *Processor) GetPeerFetches() int64 {
+	return atomic.LoadInt64(&p.peerFetches)
+}
+
+// GetHitUnderMiss returns the L1 data hits served while a miss was
+// outstanding, and the cycles memory port contention added to them
+func (p *Processor) GetHitUnderMiss() (hits, cycles int64) {
+	return atomic.LoadInt64(&p.hitsUnderMiss), atomic.LoadInt64(&p.hitUnderMissCycles)
+}
+
+// GetPredication returns the instructions retired or skipped in the shadow
+// of predicated branches, and the mispredict flushes predication avoided:
+// predicated branches the predictor would have got wrong
+func (p *Processor) GetPredication() (instructions, avoidedFlushes int64) {
+	return atomic.LoadInt64(&p.predicated), atomic.LoadInt64(&p.avoidedFlushes)
+}
+
+// IsBusy reports whether the core has instructions in flight or queued, or
+// is running an interrupt handler
+func (p *Processor) IsBusy() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.handler != handlerNone || !p.pipeline.IsEmpty() || len(p.instructionQueue) > 0
+}
+
+// StallReport describes what the core is waiting on: where its oldest
+// instruction is held, how many stores have yet to drain and whether an
+// interrupt handler is running
+func (p *Processor) StallReport() string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.halted {
+		return "halted by a memory fault"
+	}
+
+	report := "no instructions in flight"
+	if inst, where, ok := p.pipeline.Oldest(); ok {
+		report = fmt.Sprintf("oldest instruction %#x (%s, opcode %#02x) held in %s",
+			inst.Address, inst.Type, inst.Opcode, where)
+	}
+
+	if n := len(p.instructionQueue); n > 0 {
+		report += fmt.Sprintf(", %d fetched instructions queued", n)
+	}
+
+	if p.storeBuffer != nil {
+		if n := p.storeBuffer.Occupancy(); n > 0 {
+			report += fmt.Sprintf(", %d stores waiting to drain", n)
+		}
+	}
+
+	switch p.handler {
+	case handlerEntry:
+		report += fmt.Sprintf(", entering interrupt handler for %d more cycles", p.handlerCyclesLeft)
+	case handlerBody:
+		report += fmt.Sprintf(", interrupt handler has retired %d of %d instructions",
+			p.handlerRetired, p.config.InterruptHandlerInstructions)
+	case handlerExit:
+		report += fmt.Sprintf(", returning from interrupt handler for %d more cycles", p.handlerCyclesLeft)
+	}
+	return report
+}
+
+// GetCycleCount returns the number of cycles this core has simulated
+func (p *Processor) GetCycleCount() int64 {
+	return atomic.LoadInt64(&p.cycleCount)
+}
+
+// GetUtilization returns the core utilization (busy cycles / total cycles)
+func (p *Processor) GetUtilization() float64 {
+	cycles := atomic.LoadInt64(&p.cycleCount)
+	if cycles == 0 {
+		return 0.0
+	}
+
+	busyCycles := atomic.LoadInt64(&p.busyCycles)
+	return float64(busyCycles) / float64(cycles)
+}
+
+// GetStallCycles returns the number of cycles instructions were in flight
+// but none changed stage, held up by hazards, busy units or memory
+func (p *Processor) GetStallCycles() int64 {
+	return atomic.LoadInt64(&p.stallCycles)
+}
+
+// GetBubbleCycles returns the number of cycles the pipeline was empty and
+// fetch supplied nothing
+func (p *Processor) GetBubbleCycles() int64 {
+	return atomic.LoadInt64(&p.bubbleCycles)
+}
+
+// GetUnitUtilization returns the fraction of cycles each execution unit
+// spent busy, keyed by unit type and indexed by unit
+func (p *Processor) GetUnitUtilization() map[string][]float64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	cycles := atomic.LoadInt64(&p.cycleCount)
+	utilization := make(map[string][]float64, len(p.executionUnits))
+	for unitType, units := range p.executionUnits {
+		utilization[unitType] = make([]float64, len(units))
+		if cycles == 0 {
+			continue
+		}
+
+		for i, unit := range units {
+			utilization[unitType][i] = float64(unit.busyCycles) / float64(cycles)
+		}
+	}
+
+	return utilization
+}
+
+// dataAccess performs a Memory instruction's load or store and returns its
+// latency. The address is the base register (first source) plus the second
+// source operand as a byte offset; opcodes with bit 3 set are stores. With a
+// store buffer, stores go into it and loads of a buffered address are
+// forwarded from it, both in a cycle. With a write-combining buffer, stores
+// leaving the core go into it rather than the cache. Atomics (bits 2 and 3
+// set) bypass both buffers and hold their line until they complete. An
+// access outside physical memory faults in a cycle without reaching the
+// caches, and one a predicated branch skipped takes a cycle and does
+// nothing. It returns false if no memory port is free this cycle, the store
+// buffer is full, another core's atomic holds the line, or the access needs
+// the bus and another core holds it.
+func (p *Processor) dataAccess(inst *pipeline.Instruction) (int, bool) {
+	if len(inst.Operands) < 3 {
+		return 0, true
+	}
+
+	// An access a predicated branch skipped never reaches memory
+	if inst.Nullified {
+		return 1, true
+	}
+
+	addr := p.readIntReg(inst.Thread, inst.Operands[1]) + uint64(inst.Operands[2])
+	isStore := inst.Opcode&0x08 != 0
+	isAtomic := inst.Opcode&0x0C == 0x0C
+
+	if p.storeBuffer != nil && !isAtomic {
+		buffered := false
+		if isStore {
+			if !p.storeBuffer.Store(addr) {
+				return 0, false
+			}
+			buffered = true
+		} else {
+			buffered = p.storeBuffer.Forward(addr)
+		}
+
+		if buffered {
+			atomic.AddInt64(&p.dataAccesses, 1)
+			atomic.AddInt64(&p.dataAccessCycles, 1)
+			p.countLatency(1)
+			return 1, true
+		}
+	}
+
+	if p.memoryPorts != nil && !p.memoryPorts.Acquire(p.ID) {
+		return 0, false
+	}
+	combine := isStore && !isAtomic && p.writeCombining != nil
+	if !combine && !p.canAccess(addr, isStore) {
+		return 0, false
+	}
+
+	var latency int
+	var physical uint64
+	var inBounds bool
+	if combine {
+		latency, inBounds = p.combineStore(addr)
+	} else {
+		latency, physical, inBounds = p.accessMemory(addr, isStore)
+	}
+	if !inBounds {
+		return 1, true
+	}
+	if isAtomic {
+		p.holdLine(physical, latency)
+	}
+	if !isStore || isAtomic {
+		inst.LoadAddr, inst.Loaded = physical, true
+	}
+	atomic.AddInt64(&p.dataAccesses, 1)
+	atomic.AddInt64(&p.dataAccessCycles, int64(latency))
+
+	return latency, true
+}
+
+// drainStore writes a buffered store to the cache once a memory port and,
+// if it needs one, the bus are free, returning the cycles the write takes.
+// A store outside physical memory faults as it drains and is dropped.
+func (p *Processor) drainStore(addr uint64) (int, bool) {
+	if p.memoryPorts != nil && !p.memoryPorts.Acquire(p.ID) {
+		return 0, false
+	}
+	if p.writeCombining == nil && !p.canAccess(addr, true) {
+		return 0, false
+	}
+
+	if p.writeCombining != nil {
+		latency, inBounds := p.combineStore(addr)
+		if !inBounds {
+			return 1, true
+		}
+		return latency, true
+	}
+
+	latency, _, inBounds := p.accessMemory(addr, true)
+	if !inBounds {
+		return 1, true
+	}
+	return latency, true
+}
+
+// canAccess reports whether a load or store of addr may go ahead this
+// cycle. It waits while another core's atomic holds the line and, on an
+// arbitrated bus, until it wins the bus if it needs a coherence
+// transaction; a core that must wait asks again next cycle.
+func (p *Processor) canAccess(addr uint64, isWrite bool) bool {
+	if p.coherence == nil {
+		return true
+	}
+
+	if p.tlb != nil {
+		addr = p.tlb.Physical(addr)
+	}
+	if p.coherence.Blocked(p.ID, addr) {
+		return false
+	}
+	if p.busArbiter == nil || !p.coherence.NeedsBus(p.ID, addr, isWrite) {
+		return true
+	}
+	return p.busArbiter.Request(p.ID)
+}
+
+// holdLine holds the line containing the physical address addr for an
+// atomic taking latency cycles, so that other cores wait for it to complete
+func (p *Processor) holdLine(addr uint64, latency int) {
+	if p.coherence == nil {
+		return
+	}
+
+	p.coherence.Lock(p.ID, addr)
+	if p.atomicHolds == nil {
+		p.atomicHolds = make(map[uint64]int)
+	}
+	line := addr - addr%uint64(p.caches.LineSize())
+	p.atomicHolds[line] = max(p.atomicHolds[line], latency)
+}
+
+// releaseAtomics counts n cycles off the core's atomics, releasing the
+// lines of those that have completed
+func (p *Processor) releaseAtomics(n int64) {
+	for line, left := range p.atomicHolds {
+		if int64(left) <= n {
+			p.coherence.Unlock(p.ID, line)
+			delete(p.atomicHolds, line)
+		} else {
+			p.atomicHolds[line] = left - int(n)
+		}
+	}
+}
+
+// storeSize is the number of bytes a store writes
+const storeSize = 8
+
+// combineStore puts a store in the write-combining buffer, taking a cycle
+// plus any time spent translating its address. Partly written lines the
+// buffer pushes out go through the caches, the store waiting for them; full
+// lines bypass the caches, written to memory without waiting. A physical
+// address outside memorySize faults instead, returning false.
+func (p *Processor) combineStore(addr uint64) (int, bool) {
+	addr, translation, inBounds := p.translate(addr)
+	if !inBounds {
+		return translation, false
+	}
+
+	latency := 1 + translation + p.writeLines(p.writeCombining.Store(addr, storeSize))
+	p.countLatency(latency)
+	return latency, true
+}
+
+// writeLines writes out the lines the write-combining buffer pushed out,
+// returning the cycles spent writing the partly written ones through the
+// caches
+func (p *Processor) writeLines(lines []memory.LineWrite) int {
+	latency := 0
+	for _, line := range lines {
+		if line.Full {
+			p.writeLine(line.LineAddr)
+		} else {
+			lineLatency, _ := p.accessCaches(line.LineAddr, true, false)
+			latency += lineLatency
+		}
+	}
+	return latency
+}
+
+// fenceWriteCombining writes out every line in the write-combining buffer,
+// as a serializing event does
+func (p *Processor) fenceWriteCombining() {
+	if p.writeCombining != nil {
+		p.writeLines(p.writeCombining.Fence())
+	}
+}
+
+// DrainWriteCombining writes out every line in the core's write-combining
+// buffer, as at the end of a run
+func (p *Processor) DrainWriteCombining() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.fenceWriteCombining()
+}
+
+// writeLine writes a full line to memory around the caches. The core's
+// private caches drop their stale copy, and the other cores' copies are
+// invalidated. The write is buffered, so nothing waits for it.
+func (p *Processor) writeLine(addr uint64) {
+	p.caches.Invalidate(addr)
+
+	busTx := false
+	var sharers []int
+	if p.coherence != nil {
+		sharers = p.coherence.Sharers(p.ID, addr)
+		busTx = p.coherence.Write(p.ID, addr)
+	}
+
+	if p.interconnect == nil {
+		return
+	}
+
+	cycle := atomic.LoadInt64(&p.cycleCount)
+	if busTx {
+		p.interconnect.Snoop(p.ID, sharers, cycle)
+	}
+	p.interconnect.Transfer(p.ID, p.interconnect.MemoryNode(), p.caches.LineSize(), cycle)
+}
+
+// GetWriteCombiningStats returns the counters of the core's write-combining
+// buffer, all 0 without one
+func (p *Processor) GetWriteCombiningStats() memory.WriteCombiningStats {
+	if p.writeCombining == nil {
+		return memory.WriteCombiningStats{}
+	}
+	return p.writeCombining.GetStats()
+}
+
+// GetStoreBufferStats returns the counters of the core's store buffer, all
+// 0 without one
+func (p *Processor) GetStoreBufferStats() memory.StoreBufferStats {
+	if p.storeBuffer == nil {
+		return memory.StoreBufferStats{}
+	}
+	return p.storeBuffer.GetStats()
+}
+
+// GetTLBLookups returns the address translations that hit and missed in
+// the core's TLB, both 0 when addresses are not translated
+func (p *Processor) GetTLBLookups() (hits, misses int64) {
+	if p.tlb == nil {
+		return 0, 0
+	}
+	return p.tlb.Lookups()
+}
+
+// GetDataAccesses returns the number of loads and stores performed and
+// their total latency in cycles
+func (p *Processor) GetDataAccesses() (accesses, cycles int64) {
+	return atomic.LoadInt64(&p.dataAccesses), atomic.LoadInt64(&p.dataAccessCycles)
+}
+
+// accessMemory performs a load or store through the cache hierarchy,
+// keeping the line coherent with the other cores. It returns the latency of
+// the level that served the access plus any time spent translating the
+// address and crossing the interconnect for coherence requests and fills
+// from memory. Coherence requests go to the cores holding the line, or to
+// memory if none do, along with the physical address accessed. A physical
+// address outside memorySize faults instead, returning false.
+func (p *Processor) accessMemory(addr uint64, isWrite bool) (int, uint64, bool) {
+	addr, translation, inBounds := p.translate(addr)
+	if !inBounds {
+		return translation, addr, false
+	}
+
+	latency, level := p.accessCaches(addr, isWrite, false)
+	latency += translation
+	latency += p.hitUnderMiss(level, latency)
+	p.countLatency(latency)
+	return latency, addr, true
+}
+
+// fetchMemory reads an instruction through the cache hierarchy as
+// accessMemory does, except that with CacheToCacheFetch a line missing
+// every cache comes from another core's caches when they hold it. It
+// returns false if the physical address is outside memorySize.
+func (p *Processor) fetchMemory(addr uint64) bool {
+	addr, translation, inBounds := p.translate(addr)
+	if !inBounds {
+		return false
+	}
+
+	latency, _ := p.accessCaches(addr, false, true)
+	p.countLatency(translation + latency)
+	return true
+}
+
+// translate returns the physical address of addr and the cycles taken to
+// translate it, counting a memory fault and returning false if the physical
+// address is outside memorySize
+func (p *Processor) translate(addr uint64) (uint64, int, bool) {
+	translation := 0
+	if p.tlb != nil {
+		addr, translation = p.tlb.Translate(addr)
+	}
+
+	if size := p.config.MemorySize; size > 0 && addr >= size {
+		atomic.AddInt64(&p.memoryFaults, 1)
+		if p.config.HaltOnMemoryFault {
+			p.halted = true
+		}
+		return addr, translation, false
+	}
+	return addr, translation, true
+}
+
+// accessCaches performs a load or store of a physical address, returning
+// the latency of the level that served it plus the interconnect time, and
+// that level as Hierarchy.Access numbers it. An instruction fetch missing
+// every cache may be served by a peer's cache rather than memory.
+func (p *Processor) accessCaches(addr uint64, isWrite, isFetch bool) (int, int) {
+	busTx := false
+	var sharers []int
+	if p.coherence != nil {
+		sharers = p.coherence.Sharers(p.ID, addr)
+		if isWrite {
+			busTx = p.coherence.Write(p.ID, addr)
+		} else {
+			busTx = p.coherence.Read(p.ID, addr)
+		}
+	}
+
+	writes, prefetches := p.caches.MemoryWrites(), p.caches.PrefetchFills()
+	latency, level := p.caches.Access(addr, isWrite)
+	fromMemory := level == len(p.caches.Levels)
+	peer := -1
+	if fromMemory && isFetch {
+		if core, peerLatency, ok := p.peerHolding(addr, sharers); ok {
+			peer, latency, fromMemory = core, peerLatency, false
+		}
+	}
+	if fromMemory && p.numa != nil {
+		latency += p.numa.Access(p.ID, addr)
+	}
+	if fromMemory && p.dram != nil {
+		latency += p.dram.Access(addr)
+	}
+
+	if p.interconnect == nil {
+		return latency, level
+	}
+
+	cycle := atomic.LoadInt64(&p.cycleCount)
+	memNode := p.interconnect.MemoryNode()
+	if busTx {
+		latency += p.interconnect.Snoop(p.ID, sharers, cycle)
+	}
+
+	switch {
+	case fromMemory:
+		latency += p.interconnect.Transfer(memNode, p.ID, p.caches.LineSize(), cycle)
+	case peer >= 0:
+		latency += p.interconnect.Transfer(peer, p.ID, p.caches.LineSize(), cycle)
+	}
+
+	// Lines written back to memory occupy the interconnect but are buffered,
+	// so the access does not wait for them
+	for n := p.caches.MemoryWrites() - writes; n > 0; n-- {
+		p.interconnect.Transfer(p.ID, memNode, p.caches.LineSize(), cycle)
+	}
+
+	// Neither does it wait for lines the prefetcher requested from memory
+	for n := p.caches.PrefetchFills() - prefetches; n > 0; n-- {
+		p.interconnect.Transfer(memNode, p.ID, p.caches.LineSize(), cycle)
+	}
+
+	return latency, level
+}
+
+// hitUnderMiss models the L1 data cache as non-blocking: a data access
+// served at level missing L1 is outstanding for its latency, and an L1 hit
+// while one is counts as a hit under miss. Such a hit contends with the
+// miss for the cache's ports, so it takes HitUnderMissLatency extra cycles,
+// which it returns, when other cores are also pressing on the memory ports.
+func (p *Processor) hitUnderMiss(level, latency int) int {
+	cycle := atomic.LoadInt64(&p.cycleCount)
+	if level > 0 {
+		p.missDone = max(p.missDone, cycle+int64(latency))
+		return 0
+	}
+
+	if cycle >= p.missDone {
+		return 0
+	}
+	atomic.AddInt64(&p.hitsUnderMiss, 1)
+
+	extra := p.config.HitUnderMissLatency
+	if extra == 0 || p.memoryPorts == nil || !p.memoryPorts.Contended(p.ID) {
+		return 0
+	}
+	atomic.AddInt64(&p.hitUnderMissCycles, int64(extra))
+	return extra
+}
+
+// peerHolding returns the first of sharers, the cores coherence says hold
+// the line at addr, whose private caches still do, and the latency of its
+// level holding it. It counts a cache-to-cache fetch if it finds one.
+func (p *Processor) peerHolding(addr uint64, sharers []int) (int, int, bool) {
+	if p.peerCaches == nil {
+		return 0, 0, false
+	}
+
+	for _, core := range sharers {
+		if latency, ok := p.peerCaches[core].Holds(addr); ok {
+			atomic.AddInt64(&p.peerFetches, 1)
+			return core, latency, true
+		}
+	}
+	return 0, 0, false
+}
+
+// countLatency adds a memory access taking latency cycles to the latency
+// histogram, in the first bucket whose bound is at least latency
+func (p *Processor) countLatency(latency int) {
+	if p.latencyHistogram == nil {
+		return
+	}
+	bucket, _ := slices.BinarySearch(p.config.LatencyBuckets, latency)
+	atomic.AddInt64(&p.latencyHistogram[bucket], 1)
+}
+
+// GetLatencyHistogram returns the number of fetches, loads and stores whose
+// latency fell in each bucket bounded by config.LatencyBuckets, with the
+// accesses slower than the last bound at the end; nil without buckets
+func (p *Processor) GetLatencyHistogram() []int64 {
+	if p.latencyHistogram == nil {
+		return nil
+	}
+	counts := make([]int64, len(p.latencyHistogram))
+	for i := range counts {
+		counts[i] = atomic.LoadInt64(&p.latencyHistogram[i])
+	}
+	return counts
+}
+
+// SetCoherenceController attaches the coherence controller shared by all
+// cores. Lines other cores invalidate are dropped from this core's caches,
+// and with FlushOnInvalidate, flush the pipeline if a load in flight has
+// read them.
+func (p *Processor) SetCoherenceController(ctrl *coherence.Controller) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.coherence = ctrl
+	if ctrl != nil {
+		ctrl.SetInvalidateHandler(p.ID, p.invalidate)
+	}
+}
+
+// SetMemoryPorts attaches the memory ports shared by all cores. Data
+// accesses wait for a free port; nil removes the limit.
+func (p *Processor) SetMemoryPorts(ports *memory.MemoryPorts) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.memoryPorts = ports
+}
+
+// SetNUMA attaches the NUMA memory shared by all cores. Accesses that
+// reach memory homed on another node pay its remote penalty; nil makes
+// memory uniform.
+func (p *Processor) SetNUMA(numa *memory.NUMA) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.numa = numa
+}
+
+// SetDRAM attaches the DRAM banks shared by all cores. Accesses that reach
+// memory pay to open their row unless it is already open in its bank; nil
+// gives every access the flat memory latency.
+func (p *Processor) SetDRAM(dram *memory.DRAM) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.dram = dram
+}
+
+// SetInterconnect attaches the interconnect shared by all cores, which
+// carries their coherence requests and fills from memory
+func (p *Processor) SetInterconnect(ic *interconnect.Interconnect) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.interconnect = ic
+}
+
+// SetBusArbiter attaches the arbiter of the bus shared by all cores. A load
+// or store needing a coherence transaction then waits until it is granted
+// the bus.
+func (p *Processor) SetBusArbiter(arbiter *coherence.BusArbiter) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.busArbiter = arbiter
+}
+
+// SetPeerCaches gives the core every core's caches, indexed by core ID, so
+// that an instruction fetch missing its own caches can be served by another
+// core's caches over the interconnect
+func (p *Processor) SetPeerCaches(peers []*cache.Hierarchy) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.peerCaches = peers
+}
+
+// SetSharedL3 replaces the core's private L3 with l3, which all cores
+// share. Coherence invalidations then leave the shared copy in place.
+func (p *Processor) SetSharedL3(l3 *cache.Cache) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.caches.SetSharedL3(l3)
+}
+
+// GetCacheHierarchy returns the core's cache hierarchy
+func (p *Processor) GetCacheHierarchy() *cache.Hierarchy {
+	return p.caches
+}
+
+// GetInterrupts returns the number of interrupts this core has taken
+func (p *Processor) GetInterrupts() int64 {
+	return atomic.LoadInt64(&p.interrupts)
+}
+
+// GetInterruptCycles returns the number of cycles spent in interrupt handlers
+func (p *Processor) GetInterruptCycles() int64 {
+	return atomic.LoadInt64(&p.interruptCycles)
+}
+
+// GetHandlerInstructions returns the number of instructions interrupt
+// handlers have retired
+func (p *Processor) GetHandlerInstructions() int64 {
+	return atomic.LoadInt64(&p.handlerInstructions)
+}
+
+func (p *Processor) GetID() int {
+	return p.ID
+}
+
+// PipelineDepth returns the number of pipeline stages the core was
+// configured with
+func (p *Processor) PipelineDepth() int {
+	return p.config.PipelineDepth
+}
+
+// ISA returns the instruction set the core executes
+func (p *Processor) ISA() string {
+	return p.config.ISA
+}
+
+// ExecutionUnitCounts returns the number of execution units of each type,
+// keyed ALU, FPU, LoadStore and Branch
+func (p *Processor) ExecutionUnitCounts() map[string]int {
+	counts := make(map[string]int, len(p.executionUnits))
+	for unitType, units := range p.executionUnits {
+		counts[unitType] = len(units)
+	}
+	return counts
+}
+
+// GetIntRegister returns thread 0's integer register n
+func (p *Processor) GetIntRegister(n int) (uint64, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	regs := p.threads[0].registersInt
+	if n < 0 || n >= len(regs) {
+		return 0, fmt.Errorf("integer register %d out of range, %s has %d", n, p.config.ISA, len(regs))
+	}
+	return regs[n], nil
+}
+
+// GetFloatRegister returns thread 0's floating-point register n
+func (p *Processor) GetFloatRegister(n int) (float64, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	regs := p.threads[0].registersFloat
+	if n < 0 || n >= len(regs) {
+		return 0, fmt.Errorf("float register %d out of range, %s has %d", n, p.config.ISA, len(regs))
+	}
+	return regs[n], nil
+}
+
+// DumpRegisters returns copies of thread 0's integer and floating-point
+// register files
+func (p *Processor) DumpRegisters() ([]uint64, []float64) {
+	intRegs, floatRegs, _ := p.DumpThreadRegisters(0)
+	return intRegs, floatRegs
+}
+
+// DumpThreadRegisters returns copies of a hardware thread's integer and
+// floating-point register files
+func (p *Processor) DumpThreadRegisters(thread int) ([]uint64, []float64, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if thread < 0 || thread >= len(p.threads) {
+		return nil, nil, fmt.Errorf("thread %d out of range, core has %d", thread, len(p.threads))
+	}
+
+	t := p.threads[thread]
+	intRegs := make([]uint64, len(t.registersInt))
+	copy(intRegs, t.registersInt)
+
+	floatRegs := make([]float64, len(t.registersFloat))
+	copy(floatRegs, t.registersFloat)
+
+	return intRegs, floatRegs, nil
+}
+
+// NumThreads returns the number of hardware threads on the core
+func (p *Processor) NumThreads() int {
+	return len(p.threads)
+}
+
+// GetThreadInstructions returns the number of instructions each hardware
+// thread has retired
+func (p *Processor) GetThreadInstructions() []int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	retired := make([]int64, len(p.threads))
+	for i, t := range p.threads {
+		retired[i] = t.retired
+	}
+	return retired
+}
+
+// GetPipelineState returns a copy of the current pipeline state
+func (p *Processor) GetPipelineState() []*pipeline.Stage {
+	return p.pipeline.GetStages()
+}
+
+// PipelineSnapshot returns a copy of the instructions in flight in each
+// stage and the reorder buffer
+func (p *Processor) PipelineSnapshot() pipeline.Snapshot {
+	return p.pipeline.Snapshot()
+}
+
+func (p *Processor) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.nextThread = 0
+	p.instructionQueue = nil
+	p.halted = false
+	p.invalidatedMutex.Lock()
+	p.invalidated = nil
+	p.invalidatedMutex.Unlock()
+	for line := range p.atomicHolds {
+		p.coherence.Unlock(p.ID, line)
+	}
+	p.atomicHolds = nil
+	atomic.StoreInt64(&p.cycleCount, 0)
+	atomic.StoreInt64(&p.busyCycles, 0)
+	atomic.StoreInt64(&p.stallCycles, 0)
+	atomic.StoreInt64(&p.bubbleCycles, 0)
+	atomic.StoreInt64(&p.interrupts, 0)
+	atomic.StoreInt64(&p.interruptCycles, 0)
+	atomic.StoreInt64(&p.handlerInstructions, 0)
+	p.handler, p.handlerCyclesLeft, p.handlerRetired = handlerNone, 0, 0
+	atomic.StoreInt64(&p.branchPredictions, 0)
+	atomic.StoreInt64(&p.branchMispredictions, 0)
+	atomic.StoreInt64(&p.mispredictCycles, 0)
+	atomic.StoreInt64(&p.flushCycles, 0)
+	atomic.StoreInt64(&p.takenBranches, 0)
+	atomic.StoreInt64(&p.fetchRedirects, 0)
+	atomic.StoreInt64(&p.predicated, 0)
+	atomic.StoreInt64(&p.avoidedFlushes, 0)
+	atomic.StoreInt64(&p.fetchQueueStalls, 0)
+	atomic.StoreInt64(&p.memoryFaults, 0)
+	atomic.StoreInt64(&p.dataAccesses, 0)
+	atomic.StoreInt64(&p.peerFetches, 0)
+	p.missDone = 0
+	atomic.StoreInt64(&p.hitsUnderMiss, 0)
+	atomic.StoreInt64(&p.hitUnderMissCycles, 0)
+	atomic.StoreInt64(&p.dataAccessCycles, 0)
+	for i := range p.latencyHistogram {
+		atomic.StoreInt64(&p.latencyHistogram[i], 0)
+	}
+	p.retiredByType = make(map[string]int64)
+	clear(p.retiredByAddress)
+	p.predictor.Reset()
+
+	p.pipeline.Reset()
+	p.caches.Reset()
+	if p.tlb != nil {
+		p.tlb.Reset()
+	}
+
+	if p.storeBuffer != nil {
+		p.storeBuffer.Reset()
+	}
+
+	if p.writeCombining != nil {
+		p.writeCombining.Reset()
+	}
+
+	for _, t := range p.threads {
+		t.reset()
+		t.pc = p.entryPC
+	}
+
+	for _, units := range p.executionUnits {
+		for _, unit := range units {
+			unit.Busy = false
+			unit.cyclesLeft = 0
+			unit.busyCycles = 0
+		}
+	}
+}
+
+// ResetStats zeroes the counters and restarts the cycle count, keeping the
+// registers, in-flight instructions, predictor tables and cached lines
+func (p *Processor) ResetStats() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	atomic.StoreInt64(&p.cycleCount, 0)
+	atomic.StoreInt64(&p.busyCycles, 0)
+	atomic.StoreInt64(&p.stallCycles, 0)
+	atomic.StoreInt64(&p.bubbleCycles, 0)
+	atomic.StoreInt64(&p.interrupts, 0)
+	atomic.StoreInt64(&p.interruptCycles, 0)
+	atomic.StoreInt64(&p.handlerInstructions, 0)
+	atomic.StoreInt64(&p.branchPredictions, 0)
+	atomic.StoreInt64(&p.branchMispredictions, 0)
+	atomic.StoreInt64(&p.mispredictCycles, 0)
+	atomic.StoreInt64(&p.flushCycles, 0)
+	atomic.StoreInt64(&p.takenBranches, 0)
+	atomic.StoreInt64(&p.fetchRedirects, 0)
+	atomic.StoreInt64(&p.predicated, 0)
+	atomic.StoreInt64(&p.avoidedFlushes, 0)
+	atomic.StoreInt64(&p.fetchQueueStalls, 0)
+	atomic.StoreInt64(&p.memoryFaults, 0)
+	atomic.StoreInt64(&p.dataAccesses, 0)
+	atomic.StoreInt64(&p.peerFetches, 0)
+	p.missDone = 0
+	atomic.StoreInt64(&p.hitsUnderMiss, 0)
+	atomic.StoreInt64(&p.hitUnderMissCycles, 0)
+	atomic.StoreInt64(&p.dataAccessCycles, 0)
+	for i := range p.latencyHistogram {
+		atomic.StoreInt64(&p.latencyHistogram[i], 0)
+	}
+	p.retiredByType = make(map[string]int64)
+	clear(p.retiredByAddress)
+
+	p.pipeline.ResetStats()
+	p.caches.ResetStats()
+	if p.tlb != nil {
+		p.tlb.ResetStats()
+	}
+
+	if p.storeBuffer != nil {
+		p.storeBuffer.ResetStats()
+	}
+
+	if p.writeCombining != nil {
+		p.writeCombining.ResetStats()
+	}
+
+	for _, t := range p.threads {
+		t.retired = 0
+	}
+
+	for _, units := range p.executionUnits {
+		for _, unit := range units {
+			unit.busyCycles = 0
+		}
+	}
+}
+
+// Snapshot is a copy of everything a core needs to resume a run: its
+// architectural registers, in-flight instructions, caches, predictor,
+// random source and counters
+type Snapshot struct {
+	Threads              []ThreadSnapshot
+	NextThread           int
+	CycleCount           int64
+	BusyCycles           int64
+	StallCycles          int64
+	BubbleCycles         int64
+	Interrupts           int64
+	InterruptCycles      int64
+	HandlerInstructions  int64
+	Handler              int // handlerPhase
+	HandlerCyclesLeft    int
+	HandlerRetired       int
+	BranchPredictions    int64
+	BranchMispredictions int64
+	MispredictCycles     int64
+	FlushCycles          int64
+	Invalidated          []uint64       // lines invalidated by other cores, not yet checked
+	AtomicHolds          map[uint64]int // line -> cycles until the atomic holding it completes
+	TakenBranches        int64
+	FetchRedirects       int64
+	Predicated           int64
+	AvoidedFlushes       int64
+	FetchQueueStalls     int64
+	FetchQueue           []pipeline.Instruction // oldest first
+	MemoryFaults         int64
+	Halted               bool
+	DataAccesses         int64
+	PeerFetches          int64
+	MissDone             int64
+	HitsUnderMiss        int64
+	HitUnderMissCycles   int64
+	DataAccessCycles     int64
+	LatencyHistogram     []int64
+	RetiredByType        map[string]int64
+	RetiredByAddress     map[uint64]int64 // nil unless profiling hot spots
+	Units                map[string][]UnitSnapshot
+	RandSeed             int64
+	RandDraws            uint64
+	Pipeline             pipeline.Snapshot
+	Caches               cache.HierarchySnapshot
+	TLB                  *memory.TLBSnapshot            // nil when addresses are not translated
+	StoreBuffer          *memory.StoreBufferSnapshot    // nil when stores write the cache directly
+	WriteCombining       *memory.WriteCombiningSnapshot // nil when stores write the cache directly
+	Predictor            predictor.Snapshot
+}
+
+// ThreadSnapshot is a copy of a hardware thread's state
+type ThreadSnapshot struct {
+	RegistersInt     []uint64
+	RegistersFloat   []float64
+	PC               uint64
+	ReturnPC         uint64
+	FetchStallCycles int
+	StallReason      pipeline.FlushReason
+	Retired          int64
+	ShadowStart      uint64
+	ShadowEnd        uint64
+	ShadowSkipped    bool
+}
+
+// UnitSnapshot is a copy of an execution unit's state
+type UnitSnapshot struct {
+	Busy       bool
+	CyclesLeft int
+	BusyCycles int64
+}
+
+// Snapshot returns a copy of the core's state
+func (p *Processor) Snapshot() Snapshot {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	snap := Snapshot{
+		Threads:              make([]ThreadSnapshot, len(p.threads)),
+		NextThread:           p.nextThread,
+		CycleCount:           atomic.LoadInt64(&p.cycleCount),
+		BusyCycles:           atomic.LoadInt64(&p.busyCycles),
+		StallCycles:          atomic.LoadInt64(&p.stallCycles),
+		BubbleCycles:         atomic.LoadInt64(&p.bubbleCycles),
+		Interrupts:           atomic.LoadInt64(&p.interrupts),
+		InterruptCycles:      atomic.LoadInt64(&p.interruptCycles),
+		HandlerInstructions:  atomic.LoadInt64(&p.handlerInstructions),
+		Handler:              int(p.handler),
+		HandlerCyclesLeft:    p.handlerCyclesLeft,
+		HandlerRetired:       p.handlerRetired,
+		BranchPredictions:    atomic.LoadInt64(&p.branchPredictions),
+		BranchMispredictions: atomic.LoadInt64(&p.branchMispredictions),
+		MispredictCycles:     atomic.LoadInt64(&p.mispredictCycles),
+		FlushCycles:          atomic.LoadInt64(&p.flushCycles),
+		TakenBranches:        atomic.LoadInt64(&p.takenBranches),
+		FetchRedirects:       atomic.LoadInt64(&p.fetchRedirects),
+		Predicated:           atomic.LoadInt64(&p.predicated),
+		AvoidedFlushes:       atomic.LoadInt64(&p.avoidedFlushes),
+		FetchQueueStalls:     atomic.LoadInt64(&p.fetchQueueStalls),
+		MemoryFaults:         atomic.LoadInt64(&p.memoryFaults),
+		Halted:               p.halted,
+		DataAccesses:         atomic.LoadInt64(&p.dataAccesses),
+		PeerFetches:          atomic.LoadInt64(&p.peerFetches),
+		MissDone:             p.missDone,
+		HitsUnderMiss:        atomic.LoadInt64(&p.hitsUnderMiss),
+		HitUnderMissCycles:   atomic.LoadInt64(&p.hitUnderMissCycles),
+		DataAccessCycles:     atomic.LoadInt64(&p.dataAccessCycles),
+		LatencyHistogram:     p.GetLatencyHistogram(),
+		RetiredByType:        make(map[string]int64, len(p.retiredByType)),
+		Units:                make(map[string][]UnitSnapshot, len(p.executionUnits)),
+		RandSeed:             p.rngSource.seed,
+		RandDraws:            p.rngSource.draws,
+		Pipeline:             p.pipeline.Snapshot(),
+		Caches:               p.caches.Snapshot(),
+		Predictor:            p.predictor.Snapshot(),
+	}
+
+	if p.tlb != nil {
+		tlb := p.tlb.Snapshot()
+		snap.TLB = &tlb
+	}
+
+	if p.storeBuffer != nil {
+		sb := p.storeBuffer.Snapshot()
+		snap.StoreBuffer = &sb
+	}
+
+	if p.writeCombining != nil {
+		wc := p.writeCombining.Snapshot()
+		snap.WriteCombining = &wc
+	}
+
+	for i, t := range p.threads {
+		snap.Threads[i] = ThreadSnapshot{
+			RegistersInt:     append([]uint64(nil), t.registersInt...),
+			RegistersFloat:   append([]float64(nil), t.registersFloat...),
+			PC:               t.pc,
+			ReturnPC:         t.returnPC,
+			FetchStallCycles: t.fetchStallCycles,
+			StallReason:      t.stallReason,
+			Retired:          t.retired,
+			ShadowStart:      t.shadowStart,
+			ShadowEnd:        t.shadowEnd,
+			ShadowSkipped:    t.shadowSkipped,
+		}
+	}
+
+	for _, inst := range p.instructionQueue {
+		snap.FetchQueue = append(snap.FetchQueue, copyInstruction(inst))
+	}
+
+	p.invalidatedMutex.Lock()
+	snap.Invalidated = append([]uint64(nil), p.invalidated...)
+	p.invalidatedMutex.Unlock()
+	snap.AtomicHolds = maps.Clone(p.atomicHolds)
+
+	for instType, n := range p.retiredByType {
+		snap.RetiredByType[instType] = n
+	}
+
+	if p.retiredByAddress != nil {
+		snap.RetiredByAddress = make(map[uint64]int64, len(p.retiredByAddress))
+		for addr, n := range p.retiredByAddress {
+			snap.RetiredByAddress[addr] = n
+		}
+	}
+
+	for unitType, units := range p.executionUnits {
+		saved := make([]UnitSnapshot, len(units))
+		for i, unit := range units {
+			saved[i] = UnitSnapshot{Busy: unit.Busy, CyclesLeft: unit.cyclesLeft, BusyCycles: unit.busyCycles}
+		}
+		snap.Units[unitType] = saved
+	}
+
+	return snap
+}
+
+// copyInstruction returns a copy of a pipeline instruction that shares no
+// slices with it
+func copyInstruction(inst *pipeline.Instruction) pipeline.Instruction {
+	c := *inst
+	c.Operands = append([]uint8(nil), inst.Operands...)
+	c.SrcRegs = append([]int(nil), inst.SrcRegs...)
+	return c
+}
+
+// Restore replaces the core's state with snap, which must come from a core
+// built from the same configuration
+func (p *Processor) Restore(snap Snapshot) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(snap.Threads) != len(p.threads) {
+		return fmt.Errorf("snapshot has %d threads, core has %d", len(snap.Threads), len(p.threads))
+	}
+
+	for i, t := range p.threads {
+		saved := snap.Threads[i]
+		if len(saved.RegistersInt) != len(t.registersInt) || len(saved.RegistersFloat) != len(t.registersFloat) {
+			return fmt.Errorf("snapshot thread %d has %d integer and %d float registers, core has %d and %d",
+				i, len(saved.RegistersInt), len(saved.RegistersFloat), len(t.registersInt), len(t.registersFloat))
+		}
+	}
+
+	for unitType, units := range p.executionUnits {
+		if len(snap.Units[unitType]) != len(units) {
+			return fmt.Errorf("snapshot has %d %s units, core has %d", len(snap.Units[unitType]), unitType, len(units))
+		}
+	}
+
+	if len(snap.FetchQueue) > max(p.config.FetchQueueSize, 0) {
+		return fmt.Errorf("snapshot queues %d fetched instructions, core queues at most %d", len(snap.FetchQueue), p.config.FetchQueueSize)
+	}
+
+	if len(snap.LatencyHistogram) != len(p.latencyHistogram) {
+		return fmt.Errorf("snapshot has %d latency buckets, core has %d", len(snap.LatencyHistogram), len(p.latencyHistogram))
+	}
+
+	if (snap.TLB == nil) != (p.tlb == nil) {
+		return fmt.Errorf("snapshot and core disagree on address translation")
+	}
+
+	if (snap.StoreBuffer == nil) != (p.storeBuffer == nil) {
+		return fmt.Errorf("snapshot and core disagree on buffering stores")
+	}
+
+	if (snap.WriteCombining == nil) != (p.writeCombining == nil) {
+		return fmt.Errorf("snapshot and core disagree on combining stores")
+	}
+
+	if err := p.pipeline.Restore(snap.Pipeline); err != nil {
+		return fmt.Errorf("failed to restore pipeline: %w", err)
+	}
+
+	if err := p.caches.Restore(snap.Caches); err != nil {
+		return fmt.Errorf("failed to restore caches: %w", err)
+	}
+
+	if p.tlb != nil {
+		if err := p.tlb.Restore(*snap.TLB); err != nil {
+			return fmt.Errorf("failed to restore TLB: %w", err)
+		}
+	}
+
+	if p.storeBuffer != nil {
+		if err := p.storeBuffer.Restore(*snap.StoreBuffer); err != nil {
+			return fmt.Errorf("failed to restore store buffer: %w", err)
+		}
+	}
+
+	if p.writeCombining != nil {
+		if err := p.writeCombining.Restore(*snap.WriteCombining); err != nil {
+			return fmt.Errorf("failed to restore write-combining buffer: %w", err)
+		}
+	}
+
+	if err := p.predictor.Restore(snap.Predictor); err != nil {
+		return fmt.Errorf("failed to restore branch predictor: %w", err)
+	}
+
+	p.nextThread = snap.NextThread % len(p.threads)
+	atomic.StoreInt64(&p.cycleCount, snap.CycleCount)
+	atomic.StoreInt64(&p.busyCycles, snap.BusyCycles)
+	atomic.StoreInt64(&p.stallCycles, snap.StallCycles)
+	atomic.StoreInt64(&p.bubbleCycles, snap.BubbleCycles)
+	atomic.StoreInt64(&p.interrupts, snap.Interrupts)
+	atomic.StoreInt64(&p.interruptCycles, snap.InterruptCycles)
+	atomic.StoreInt64(&p.handlerInstructions, snap.HandlerInstructions)
+	p.handler, p.handlerCyclesLeft, p.handlerRetired = handlerPhase(snap.Handler), snap.HandlerCyclesLeft, snap.HandlerRetired
+	atomic.StoreInt64(&p.branchPredictions, snap.BranchPredictions)
+	atomic.StoreInt64(&p.branchMispredictions, snap.BranchMispredictions)
+	atomic.StoreInt64(&p.mispredictCycles, snap.MispredictCycles)
+	atomic.StoreInt64(&p.flushCycles, snap.FlushCycles)
+	p.invalidatedMutex.Lock()
+	p.invalidated = append([]uint64(nil), snap.Invalidated...)
+	p.invalidatedMutex.Unlock()
+	p.atomicHolds = maps.Clone(snap.AtomicHolds)
+	atomic.StoreInt64(&p.takenBranches, snap.TakenBranches)
+	atomic.StoreInt64(&p.fetchRedirects, snap.FetchRedirects)
+	atomic.StoreInt64(&p.predicated, snap.Predicated)
+	atomic.StoreInt64(&p.avoidedFlushes, snap.AvoidedFlushes)
+	atomic.StoreInt64(&p.fetchQueueStalls, snap.FetchQueueStalls)
+	atomic.StoreInt64(&p.memoryFaults, snap.MemoryFaults)
+	p.halted = snap.Halted
+	p.instructionQueue = nil
+	for i := range snap.FetchQueue {
+		inst := copyInstruction(&snap.FetchQueue[i])
+		p.instructionQueue = append(p.instructionQueue, &inst)
+	}
+	atomic.StoreInt64(&p.dataAccesses, snap.DataAccesses)
+	atomic.StoreInt64(&p.peerFetches, snap.PeerFetches)
+	p.missDone = snap.MissDone
+	atomic.StoreInt64(&p.hitsUnderMiss, snap.HitsUnderMiss)
+	atomic.StoreInt64(&p.hitUnderMissCycles, snap.HitUnderMissCycles)
+	atomic.StoreInt64(&p.dataAccessCycles, snap.DataAccessCycles)
+	for i, n := range snap.LatencyHistogram {
+		atomic.StoreInt64(&p.latencyHistogram[i], n)
+	}
+	p.retiredByType = make(map[string]int64, len(snap.RetiredByType))
+	for instType, n := range snap.RetiredByType {
+		p.retiredByType[instType] = n
+	}
+
+	if p.retiredByAddress != nil {
+		clear(p.retiredByAddress)
+		for addr, n := range snap.RetiredByAddress {
+			p.retiredByAddress[addr] = n
+		}
+	}
+
+	for i, t := range p.threads {
+		saved := snap.Threads[i]
+		copy(t.registersInt, saved.RegistersInt)
+		copy(t.registersFloat, saved.RegistersFloat)
+		t.pc, t.returnPC = saved.PC, saved.ReturnPC
+		t.fetchStallCycles, t.stallReason, t.retired = saved.FetchStallCycles, saved.StallReason, saved.Retired
+		t.shadowStart, t.shadowEnd, t.shadowSkipped = saved.ShadowStart, saved.ShadowEnd, saved.ShadowSkipped
+		t.drained = false
+	}
+
+	for unitType, units := range p.executionUnits {
+		for i, unit := range units {
+			saved := snap.Units[unitType][i]
+			unit.Busy, unit.cyclesLeft, unit.busyCycles = saved.Busy, saved.CyclesLeft, saved.BusyCycles
+		}
+	}
+
+	// Replay the draws already taken so the sequence continues where it left off
+	p.seed(snap.RandSeed)
+	for i := uint64(0); i < snap.RandDraws; i++ {
+		p.rngSource.Uint64()
+	}
+
+	return nil
 }
@@ -1,9 +1,21 @@
 package core
 
 import (
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
+	"github.com/jasonKoogler/cpu-sim/internal/cache"
+	"github.com/jasonKoogler/cpu-sim/internal/coherence"
 	"github.com/jasonKoogler/cpu-sim/internal/config"
+	"github.com/jasonKoogler/cpu-sim/internal/interconnect"
+	"github.com/jasonKoogler/cpu-sim/internal/memory"
+	"github.com/jasonKoogler/cpu-sim/internal/pipeline"
+	"github.com/jasonKoogler/cpu-sim/internal/predictor"
+	"github.com/jasonKoogler/cpu-sim/internal/workload"
 )
 
 func TestNewProcessor(t *testing.T) {
@@ -27,12 +39,12 @@ func TestNewProcessor(t *testing.T) {
 	}
 
 	// Check registers
-	if len(proc.registersInt) != 32 {
-		t.Errorf("NewProcessor() registersInt length = %d, want 32", len(proc.registersInt))
+	if len(proc.threads[0].registersInt) != 32 {
+		t.Errorf("NewProcessor() registersInt length = %d, want 32", len(proc.threads[0].registersInt))
 	}
 
-	if len(proc.registersFloat) != 32 {
-		t.Errorf("NewProcessor() registersFloat length = %d, want 32", len(proc.registersFloat))
+	if len(proc.threads[0].registersFloat) != 32 {
+		t.Errorf("NewProcessor() registersFloat length = %d, want 32", len(proc.threads[0].registersFloat))
 	}
 
 	// Check execution units
@@ -70,6 +82,73 @@ func TestNewProcessor_NilConfig(t *testing.T) {
 	}
 }
 
+func TestProcessorStructure(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ISA, cfg.PipelineDepth = "x86", 14
+	cfg.NumALUs, cfg.NumFPUs, cfg.NumLoadStore, cfg.NumBranch = 4, 2, 3, 1
+
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	if got := proc.PipelineDepth(); got != 14 {
+		t.Errorf("PipelineDepth() = %d, want 14", got)
+	}
+	if got := proc.ISA(); got != "x86" {
+		t.Errorf("ISA() = %q, want x86", got)
+	}
+
+	want := map[string]int{"ALU": 4, "FPU": 2, "LoadStore": 3, "Branch": 1}
+	counts := proc.ExecutionUnitCounts()
+	if !maps.Equal(counts, want) {
+		t.Errorf("ExecutionUnitCounts() = %v, want %v", counts, want)
+	}
+
+	// The counts are a copy
+	counts["ALU"] = 0
+	if got := proc.ExecutionUnitCounts()["ALU"]; got != 4 {
+		t.Errorf("ExecutionUnitCounts()[ALU] = %d after modifying a returned map, want 4", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *config.Config)
+		types   []string
+		wantErr bool
+	}{
+		{name: "Default", types: []string{"Integer", "Float", "Memory", "Branch", "System"}},
+		{name: "Three stages", modify: func(cfg *config.Config) { cfg.PipelineDepth = 3 }, types: []string{"Integer"}},
+		{name: "No Execute stage", modify: func(cfg *config.Config) { cfg.PipelineDepth = 2 }, types: []string{"Integer"}, wantErr: true},
+		{name: "x86 without decode", modify: func(cfg *config.Config) {
+			cfg.ISA, cfg.PipelineDepth = "x86", 3
+		}, types: []string{"Integer"}, wantErr: true},
+		{name: "Unused missing unit", modify: func(cfg *config.Config) { cfg.NumFPUs = 0 }, types: []string{"Integer", "Memory"}},
+		{name: "Missing FPU", modify: func(cfg *config.Config) { cfg.NumFPUs = 0 }, types: []string{"Integer", "Float"}, wantErr: true},
+		{name: "System needs an ALU", modify: func(cfg *config.Config) { cfg.NumALUs = 0 }, types: []string{"System"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			if tt.modify != nil {
+				tt.modify(cfg)
+			}
+
+			proc, err := NewProcessor(0, cfg)
+			if err != nil {
+				t.Fatalf("NewProcessor() error = %v", err)
+			}
+
+			if err := proc.Validate(tt.types); (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%v) error = %v, wantErr %v", tt.types, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestNewProcessor_DifferentISAs(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -128,45 +207,55 @@ func TestNewProcessor_DifferentISAs(t *testing.T) {
 				return
 			}
 
-			if len(proc.registersInt) != tt.wantIntRegs {
+			if len(proc.threads[0].registersInt) != tt.wantIntRegs {
 				t.Errorf("NewProcessor() registersInt length = %d, want %d",
-					len(proc.registersInt), tt.wantIntRegs)
+					len(proc.threads[0].registersInt), tt.wantIntRegs)
 			}
 
-			if len(proc.registersFloat) != tt.wantFloatRegs {
+			if len(proc.threads[0].registersFloat) != tt.wantFloatRegs {
 				t.Errorf("NewProcessor() registersFloat length = %d, want %d",
-					len(proc.registersFloat), tt.wantFloatRegs)
+					len(proc.threads[0].registersFloat), tt.wantFloatRegs)
 			}
 		})
 	}
 }
 
 func TestCycle(t *testing.T) {
-	cfg := config.DefaultConfig()
-	proc, _ := NewProcessor(0, cfg)
-
-	// Run 100 cycles
-	for i := 0; i < 100; i++ {
-		proc.Cycle()
+	tests := []struct {
+		name             string
+		fetchInterval    int
+		minExec, maxExec int64
+	}{
+		// One independent ADD retires per cycle once the pipeline fills
+		{name: "Fetch every cycle", fetchInterval: 1, minExec: 90, maxExec: 100},
+		{name: "Unset interval fetches every cycle", fetchInterval: 0, minExec: 90, maxExec: 100},
+		{name: "Fetch every fifth cycle", fetchInterval: 5, minExec: 15, maxExec: 20},
 	}
 
-	// Check cycle count
-	if proc.cycleCount != 100 {
-		t.Errorf("After 100 cycles, cycleCount = %d, want 100", proc.cycleCount)
-	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.FetchInterval = tt.fetchInterval
+			proc, _ := NewProcessor(0, cfg)
 
-	// Check executed instructions (should be about 20 with the synthetic pipeline workload)
-	executedInstructions := proc.GetExecutedInstructions()
-	if executedInstructions < 10 || executedInstructions > 30 {
-		t.Errorf("After 100 cycles, executedInstructions = %d, want between 10 and 30",
-			executedInstructions)
-	}
+			for i := 0; i < 100; i++ {
+				proc.Cycle()
+			}
+
+			if proc.cycleCount != 100 {
+				t.Errorf("After 100 cycles, cycleCount = %d, want 100", proc.cycleCount)
+			}
 
-	// Check utilization
-	utilization := proc.GetUtilization()
-	if utilization < 0.1 || utilization > 1.0 {
-		t.Errorf("After 100 cycles, utilization = %f, should be between 0.1 and 1.0",
-			utilization)
+			executed := proc.GetExecutedInstructions()
+			if executed < tt.minExec || executed > tt.maxExec {
+				t.Errorf("After 100 cycles, executedInstructions = %d, want between %d and %d",
+					executed, tt.minExec, tt.maxExec)
+			}
+
+			if util := proc.GetUtilization(); util < 0.1 || util > 1.0 {
+				t.Errorf("After 100 cycles, utilization = %f, should be between 0.1 and 1.0", util)
+			}
+		})
 	}
 }
 
@@ -208,8 +297,8 @@ func TestReset(t *testing.T) {
 	}
 
 	// Modify some registers
-	proc.registersInt[1] = 42
-	proc.registersFloat[2] = 3.14
+	proc.threads[0].registersInt[1] = 42
+	proc.threads[0].registersFloat[2] = 3.14
 
 	// Reset the processor
 	proc.Reset()
@@ -223,16 +312,16 @@ func TestReset(t *testing.T) {
 		t.Errorf("After Reset(), executedInstructions = %d, want 0", proc.GetExecutedInstructions())
 	}
 
-	if proc.registersInt[1] != 0 {
-		t.Errorf("After Reset(), registersInt[1] = %d, want 0", proc.registersInt[1])
+	if proc.threads[0].registersInt[1] != 0 {
+		t.Errorf("After Reset(), registersInt[1] = %d, want 0", proc.threads[0].registersInt[1])
 	}
 
-	if proc.registersFloat[2] != 0.0 {
-		t.Errorf("After Reset(), registersFloat[2] = %f, want 0.0", proc.registersFloat[2])
+	if proc.threads[0].registersFloat[2] != 0.0 {
+		t.Errorf("After Reset(), registersFloat[2] = %f, want 0.0", proc.threads[0].registersFloat[2])
 	}
 
-	if proc.pc != 0 {
-		t.Errorf("After Reset(), pc = %d, want 0", proc.pc)
+	if proc.threads[0].pc != 0 {
+		t.Errorf("After Reset(), pc = %d, want 0", proc.threads[0].pc)
 	}
 
 	// Check that pipeline is empty
@@ -295,3 +384,1730 @@ func TestGetPipelineState(t *testing.T) {
 		t.Errorf("After 20 cycles, at least one pipeline stage should be busy")
 	}
 }
+
+func TestPeriodicInterrupts(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.InterruptInterval = 100
+	cfg.InterruptHandlerAddress = 0x8000
+	cfg.InterruptHandlerInstructions = 4
+	cfg.InterruptEntryCycles = 3
+	cfg.InterruptExitCycles = 2
+
+	proc, _ := NewProcessor(0, cfg)
+
+	var retired []uint64
+	proc.SetRetireHook(func(inst Instruction) {
+		retired = append(retired, inst.Address)
+	})
+
+	// The first interrupt arrives on cycle 100 and redirects the pc
+	for i := 0; i < 100; i++ {
+		proc.Cycle()
+	}
+
+	if proc.GetInterrupts() != 1 {
+		t.Fatalf("After 100 cycles, interrupts = %d, want 1", proc.GetInterrupts())
+	}
+
+	if proc.threads[0].pc != cfg.InterruptHandlerAddress {
+		t.Errorf("During handler, pc = %#x, want %#x", proc.threads[0].pc, cfg.InterruptHandlerAddress)
+	}
+
+	// The handler fetches and retires its instructions from the handler
+	// address, then the core resumes after the last instruction it retired
+	interrupted := len(retired)
+	resumeAt := retired[interrupted-1] + workload.InstructionSize
+	for i := 0; i < 100 && proc.handler != handlerNone; i++ {
+		proc.Cycle()
+	}
+	if proc.handler != handlerNone {
+		t.Fatalf("Handler still running 100 cycles after the interrupt")
+	}
+
+	want := []uint64{0x8000, 0x8004, 0x8008, 0x800c}
+	if got := retired[interrupted:]; !slices.Equal(got, want) {
+		t.Errorf("Handler retired %#x, want %#x", got, want)
+	}
+	if proc.threads[0].pc != resumeAt {
+		t.Errorf("After handler exit, pc = %#x, want %#x", proc.threads[0].pc, resumeAt)
+	}
+
+	for proc.GetCycleCount() < 1050 {
+		proc.Cycle()
+	}
+
+	if proc.GetInterrupts() != 10 {
+		t.Errorf("After 1050 cycles, interrupts = %d, want 10", proc.GetInterrupts())
+	}
+
+	if got := proc.GetHandlerInstructions(); got != 40 {
+		t.Errorf("After 1050 cycles, handler instructions = %d, want 40", got)
+	}
+
+	// Each handler pays its entry and exit cost on top of running its body
+	if got := proc.GetInterruptCycles(); got <= 10*(3+4+2) {
+		t.Errorf("After 1050 cycles, interrupt cycles = %d, want more than %d", got, 10*(3+4+2))
+	}
+
+	if proc.GetExecutedInstructions() <= 40 {
+		t.Errorf("Core should still execute instructions between interrupts")
+	}
+
+	// A handler address with nothing to fetch returns without retiring any
+	// handler instructions
+	program := make([]workload.Instruction, 64)
+	for i := range program {
+		program[i] = workload.Instruction{Opcode: workload.OpcodeADD, Dest: 1, Src1: 2, Src2: 3}
+	}
+	proc, _ = NewProcessor(0, cfg)
+	proc.LoadWorkload(program)
+	for i := 0; i < 200; i++ {
+		proc.Cycle()
+	}
+
+	if proc.GetInterrupts() != 2 || proc.GetHandlerInstructions() != 0 {
+		t.Errorf("Empty handler: interrupts = %d, handler instructions = %d, want 2 and 0",
+			proc.GetInterrupts(), proc.GetHandlerInstructions())
+	}
+	if proc.GetExecutedInstructions() != int64(len(program)) {
+		t.Errorf("Empty handler: executed %d instructions, want the whole program of %d",
+			proc.GetExecutedInstructions(), len(program))
+	}
+}
+
+func TestResourceBoundCycles(t *testing.T) {
+	workload := func(counts map[string]int) []Instruction {
+		var insts []Instruction
+		for instType, n := range counts {
+			for i := 0; i < n; i++ {
+				insts = append(insts, Instruction{Type: instType})
+			}
+		}
+		return insts
+	}
+
+	tests := []struct {
+		name       string
+		issueWidth int // 0 for the default
+		alus       int // 0 for the default
+		counts     map[string]int
+		want       int64
+	}{
+		{
+			name:   "Empty workload",
+			counts: map[string]int{},
+			want:   0,
+		},
+		{
+			name:   "Integer only is issue bound",
+			counts: map[string]int{"Integer": 10},
+			want:   10,
+		},
+		{
+			name:   "Float dominated by the single 3-cycle FPU",
+			counts: map[string]int{"Float": 10, "Integer": 5},
+			want:   30,
+		},
+		{
+			name:   "Memory dominated by the single LoadStore unit",
+			counts: map[string]int{"Memory": 8, "Integer": 2},
+			want:   10,
+		},
+		{
+			name:       "Wide issue with an ALU per slot",
+			issueWidth: 4,
+			alus:       4,
+			counts:     map[string]int{"Integer": 400},
+			want:       100,
+		},
+		{
+			name:       "Wide issue bound by the ALUs",
+			issueWidth: 4,
+			counts:     map[string]int{"Integer": 400},
+			want:       200,
+		},
+		{
+			name:       "Wide issue rounds up",
+			issueWidth: 4,
+			alus:       4,
+			counts:     map[string]int{"Integer": 10},
+			want:       3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			if tt.issueWidth != 0 {
+				cfg.IssueWidth = tt.issueWidth
+			}
+			if tt.alus != 0 {
+				cfg.NumALUs = tt.alus
+			}
+			proc, _ := NewProcessor(0, cfg)
+
+			got := proc.ResourceBoundCycles(workload(tt.counts))
+			if got != tt.want {
+				t.Errorf("ResourceBoundCycles() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadWorkload(t *testing.T) {
+	cfg := config.DefaultConfig()
+	proc, _ := NewProcessor(0, cfg)
+
+	program := []workload.Instruction{
+		{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 1},
+		{Opcode: 0x40, Src1: 4, Src2: 5, Dest: 6},
+		{Opcode: 0x60, Src1: 7, Src2: 0, Dest: 8},
+	}
+	proc.LoadWorkload(program)
+
+	// Instructions are fetched in order with their decoded fields
+	for i, w := range program {
+		inst := proc.fetchNextInstruction(0)
+		if inst == nil {
+			t.Fatalf("fetchNextInstruction() %d returned nil", i)
+		}
+
+		if inst.Address != uint64(i*workload.InstructionSize) {
+			t.Errorf("Instruction %d address = %#x, want %#x", i, inst.Address, i*workload.InstructionSize)
+		}
+
+		if inst.Opcode != w.Opcode || inst.Type != w.Type() {
+			t.Errorf("Instruction %d = opcode %#x type %s, want opcode %#x type %s",
+				i, inst.Opcode, inst.Type, w.Opcode, w.Type())
+		}
+
+		wantOperands := []uint8{w.Dest, w.Src1, w.Src2}
+		if !reflect.DeepEqual(inst.Operands, wantOperands) {
+			t.Errorf("Instruction %d operands = %v, want %v", i, inst.Operands, wantOperands)
+		}
+	}
+
+	// Past the end of the workload nothing more is fetched
+	if inst := proc.fetchNextInstruction(0); inst != nil {
+		t.Errorf("fetchNextInstruction() past the end = %+v, want nil", inst)
+	}
+}
+
+func TestLoadWorkload_GoesIdle(t *testing.T) {
+	cfg := config.DefaultConfig()
+	proc, _ := NewProcessor(0, cfg)
+	proc.LoadWorkload([]workload.Instruction{
+		{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 1},
+		{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 4},
+	})
+
+	for i := 0; i < 200; i++ {
+		proc.Cycle()
+	}
+
+	if !proc.pipeline.IsEmpty() {
+		t.Errorf("Pipeline should drain once the workload is exhausted")
+	}
+
+	if proc.threads[0].pc != 2*workload.InstructionSize {
+		t.Errorf("pc = %d after the workload ended, want %d", proc.threads[0].pc, 2*workload.InstructionSize)
+	}
+
+	if got := proc.GetExecutedInstructions(); got > 2 {
+		t.Errorf("Executed %d instructions from a 2-instruction workload", got)
+	}
+}
+
+func TestLoadProgram(t *testing.T) {
+	cfg := config.DefaultConfig()
+	proc, _ := NewProcessor(0, cfg)
+
+	// Execution starts at the second of three instructions
+	proc.LoadProgram(&workload.Program{
+		Instructions: []workload.Instruction{
+			{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 1},
+			{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 4},
+			{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 5},
+		},
+		TextAddr: 0x1000,
+		Entry:    0x1004,
+	})
+
+	for run := 0; run < 2; run++ {
+		for i := 0; i < 200; i++ {
+			proc.Cycle()
+		}
+
+		if got := proc.GetExecutedInstructions(); got != 2 {
+			t.Errorf("Run %d executed %d instructions from the entry point, want 2", run, got)
+		}
+
+		if proc.threads[0].pc != 0x100C {
+			t.Errorf("Run %d pc = %#x after the program ended, want 0x100c", run, proc.threads[0].pc)
+		}
+
+		// Reset restarts at the entry point
+		proc.Reset()
+	}
+}
+
+func TestToPipelineRegisters(t *testing.T) {
+	alu := (&Instruction{Operands: []uint8{1, 2, 3}, Type: "Integer"}).toPipeline()
+	if alu.DestReg != 1 || !reflect.DeepEqual(alu.SrcRegs, []int{2, 3}) {
+		t.Errorf("Integer instruction decoded as dest %d, srcs %v, want dest 1, srcs [2 3]",
+			alu.DestReg, alu.SrcRegs)
+	}
+
+	branch := (&Instruction{Operands: []uint8{0, 4, 5}, Type: "Branch"}).toPipeline()
+	if branch.DestReg != pipeline.NoReg || !reflect.DeepEqual(branch.SrcRegs, []int{4, 5}) {
+		t.Errorf("Branch instruction decoded as dest %d, srcs %v, want NoReg, srcs [4 5]",
+			branch.DestReg, branch.SrcRegs)
+	}
+
+	jal := (&Instruction{Address: 8, Opcode: workload.OpcodeJAL, Operands: []uint8{2, 1, 1}, Type: "Branch"}).toPipeline()
+	if jal.DestReg != 1 || !jal.HasResult || jal.Result != 12 {
+		t.Errorf("jal decoded as dest %d, result %d, want dest 1, result 12", jal.DestReg, jal.Result)
+	}
+}
+
+func TestBranchPrediction(t *testing.T) {
+	// Registers are all zero, so BEQ (even opcode) is always taken and BNE
+	// (odd opcode) never is. Either way execution falls through to the next
+	// instruction.
+	branches := func(opcode uint8) []workload.Instruction {
+		program := make([]workload.Instruction, 4)
+		for i := range program {
+			program[i] = workload.Instruction{Opcode: opcode, Src1: 1, Src2: 2, Dest: 1}
+		}
+		return program
+	}
+
+	tests := []struct {
+		name               string
+		predictor          string
+		opcode             uint8
+		wantMispredictions int64
+	}{
+		{name: "Static predicts not-taken correctly", predictor: "static", opcode: 0x71, wantMispredictions: 0},
+		{name: "Static mispredicts taken branches", predictor: "static", opcode: 0x70, wantMispredictions: 4},
+		{name: "Bimodal mispredicts unseen taken branches", predictor: "bimodal", opcode: 0x70, wantMispredictions: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.BranchPredictor = tt.predictor
+			proc, err := NewProcessor(0, cfg)
+			if err != nil {
+				t.Fatalf("NewProcessor() error = %v", err)
+			}
+			proc.LoadWorkload(branches(tt.opcode))
+
+			for i := 0; i < 100; i++ {
+				proc.Cycle()
+			}
+
+			stats := proc.GetBranchStats()
+			if stats.Predictions != 4 {
+				t.Errorf("Predictions = %d, want 4", stats.Predictions)
+			}
+
+			if stats.Mispredictions != tt.wantMispredictions {
+				t.Errorf("Mispredictions = %d, want %d", stats.Mispredictions, tt.wantMispredictions)
+			}
+
+			// Each mispredict flushes the two stages ahead of Execute
+			if got, want := proc.GetMispredictCycles(), 2*tt.wantMispredictions; got != want {
+				t.Errorf("GetMispredictCycles() = %d, want %d", got, want)
+			}
+
+			proc.Reset()
+			if proc.GetBranchStats() != (predictor.Stats{}) || proc.GetMispredictCycles() != 0 {
+				t.Errorf("Reset() did not clear branch statistics")
+			}
+		})
+	}
+}
+
+func TestBranchMispredict_Flush(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.BranchPredictor = "static"
+	proc, _ := NewProcessor(0, cfg)
+
+	// A taken branch followed by an instruction fetched down the wrong path
+	proc.LoadWorkload([]workload.Instruction{
+		{Opcode: 0x70, Src1: 1, Src2: 2},
+		{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 4},
+	})
+
+	branch := &pipeline.Instruction{Address: 0, Opcode: 0x70, Operands: []uint8{3, 1, 2}, Type: "Branch", Target: 12, Taken: true}
+	proc.pipeline.InsertInstruction(&pipeline.Instruction{Address: 4, Type: "Integer", DestReg: 4})
+	proc.threads[0].pc = 8
+
+	proc.resolveBranch(branch)
+
+	for i, stage := range proc.pipeline.GetStages()[:2] {
+		if stage.Busy {
+			t.Errorf("Stage %d (%s) still holds a wrong-path instruction", i, stage.Name)
+		}
+	}
+
+	if proc.threads[0].pc != branch.Target {
+		t.Errorf("pc = %d after mispredict, want fetch to restart at the target %d", proc.threads[0].pc, branch.Target)
+	}
+
+	if proc.threads[0].fetchStallCycles != 2 {
+		t.Errorf("fetchStallCycles = %d, want 2", proc.threads[0].fetchStallCycles)
+	}
+
+	if got := proc.GetFlushes()["mispredict"]; got != 1 {
+		t.Errorf("Mispredict flushes = %d, want 1", got)
+	}
+}
+
+func TestFlushPenalty(t *testing.T) {
+	for _, penalty := range []bool{false, true} {
+		cfg := config.DefaultConfig()
+		cfg.InterruptInterval = 100
+		cfg.InterruptEntryCycles = 3
+		cfg.FlushPenalty = penalty
+		proc, _ := NewProcessor(0, cfg)
+
+		for i := 0; i < 1050; i++ {
+			proc.Cycle()
+		}
+
+		flushes := proc.GetFlushes()
+		if flushes["exception"] != 10 {
+			t.Errorf("FlushPenalty=%v: exception flushes = %d, want one per interrupt (10)", penalty, flushes["exception"])
+		}
+		if flushes["mispredict"] != 0 || flushes["coherence"] != 0 {
+			t.Errorf("FlushPenalty=%v: flushes = %v, want exceptions only", penalty, flushes)
+		}
+
+		want := int64(0)
+		if penalty {
+			want = 10 * int64(proc.pipeline.FrontEndStages())
+		}
+		if got := proc.GetFlushCycles(); got != want {
+			t.Errorf("FlushPenalty=%v: flush cycles = %d, want %d", penalty, got, want)
+		}
+		if got := proc.GetMispredictCycles(); got != 0 {
+			t.Errorf("FlushPenalty=%v: mispredict cycles = %d, want 0", penalty, got)
+		}
+	}
+}
+
+func TestCoherenceFlush(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.FlushOnInvalidate = true
+	proc, _ := NewProcessor(0, cfg)
+
+	load := &pipeline.Instruction{Address: 0x40, Opcode: 0x60, Type: "Memory", DestReg: 4, LoadAddr: 0x1000, Loaded: true}
+	proc.pipeline.InsertInstruction(load)
+	proc.threads[0].pc = 0x44
+
+	// Another line going stale leaves the load alone
+	proc.invalidate(0x2000)
+	proc.checkInvalidations()
+	if got := proc.GetFlushes()["coherence"]; got != 0 {
+		t.Fatalf("Coherence flushes after an unrelated invalidation = %d, want 0", got)
+	}
+
+	// The load's line going stale replays it
+	proc.invalidate(0x1008)
+	proc.checkInvalidations()
+	if got := proc.GetFlushes()["coherence"]; got != 1 {
+		t.Errorf("Coherence flushes = %d, want 1", got)
+	}
+	if !proc.pipeline.IsEmpty() {
+		t.Errorf("Pipeline should be empty after a coherence flush")
+	}
+	if proc.threads[0].pc != load.Address {
+		t.Errorf("pc = %#x after a coherence flush, want the stale load at %#x", proc.threads[0].pc, load.Address)
+	}
+
+	cfg.FlushOnInvalidate = false
+	proc, _ = NewProcessor(0, cfg)
+	proc.pipeline.InsertInstruction(load)
+	proc.invalidate(0x1000)
+	proc.checkInvalidations()
+	if got := proc.GetFlushes()["coherence"]; got != 0 {
+		t.Errorf("Coherence flushes without flushOnInvalidate = %d, want 0", got)
+	}
+}
+
+func TestBusArbitration(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 2
+
+	// finish runs a load to its own line on each core, the cores sharing a
+	// bus under policy, and returns the cycle each load retired on
+	finish := func(policy string, priorities []int, cores int) ([]int, *coherence.BusArbiter) {
+		ctrl, _ := coherence.NewController("MESI", cfg.NumCores, cfg.LineSize())
+		arb, err := coherence.NewBusArbiter(policy, cfg.NumCores, priorities)
+		if err != nil {
+			t.Fatalf("NewBusArbiter() error = %v", err)
+		}
+
+		retired := make([]int, cores)
+		procs := make([]*Processor, cores)
+		cycle := 0
+		for i := range procs {
+			procs[i], _ = NewProcessor(i, cfg)
+			procs[i].SetCoherenceController(ctrl)
+			procs[i].SetBusArbiter(arb)
+			procs[i].SetRetireHook(func(Instruction) { retired[i] = cycle })
+			procs[i].LoadWorkload([]workload.Instruction{{Opcode: 0x60, Dest: 3, Src1: 0, Src2: uint8(0x40 * (i + 1))}})
+		}
+
+		for cycle = 1; cycle <= 1000; cycle++ {
+			arb.BeginCycle()
+			for _, i := range arb.Order() {
+				if i < cores {
+					procs[i].Cycle()
+				}
+			}
+		}
+		return retired, arb
+	}
+
+	alone, _ := finish(coherence.ArbitrateFixed, nil, 1)
+
+	tests := []struct {
+		name       string
+		policy     string
+		priorities []int
+		loser      int
+	}{
+		{"fixed", coherence.ArbitrateFixed, nil, 1},
+		{"favoring core 1", coherence.ArbitratePriority, []int{0, 1}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retired, arb := finish(tt.policy, tt.priorities, 2)
+
+			// Both loads miss in the same cycle; the loser waits a cycle
+			// for the bus, its load finishing that much later
+			winner := 1 - tt.loser
+			if retired[winner] != alone[0] {
+				t.Errorf("Winner's load retired on cycle %d, want %d as with the bus to itself", retired[winner], alone[0])
+			}
+			if retired[tt.loser] != alone[0]+1 {
+				t.Errorf("Loser's load retired on cycle %d, want %d after waiting a cycle", retired[tt.loser], alone[0]+1)
+			}
+
+			waits := make([]int64, 2)
+			waits[tt.loser] = 1
+			if got := arb.WaitCycles(); !reflect.DeepEqual(got, waits) {
+				t.Errorf("WaitCycles() = %v, want %v", got, waits)
+			}
+		})
+	}
+}
+
+func TestAtomicContention(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 4
+
+	// run has each of cores perform an atomic on the same line, the cores
+	// sharing a ring, and returns them with the cycle each atomic retired on
+	run := func(cores ...int) ([]*Processor, map[int]int, *coherence.Controller) {
+		ctrl, _ := coherence.NewController("MESI", cfg.NumCores, cfg.LineSize())
+		ring, _ := interconnect.New(interconnect.Ring, cfg.NumCores, cfg.InterconnectBandwidth, cfg.ClockFrequency)
+		ring.SetHopLatency(10)
+
+		retired := make(map[int]int)
+		procs := make([]*Processor, len(cores))
+		cycle := 0
+		for i, id := range cores {
+			procs[i], _ = NewProcessor(id, cfg)
+			procs[i].SetCoherenceController(ctrl)
+			procs[i].SetInterconnect(ring)
+			procs[i].SetRetireHook(func(Instruction) { retired[id] = cycle })
+			procs[i].LoadWorkload([]workload.Instruction{{Opcode: workload.OpcodeAMO, Dest: 3, Src1: 0, Src2: 0x40}})
+		}
+
+		for cycle = 1; cycle <= 2000; cycle++ {
+			for _, proc := range procs {
+				proc.Cycle()
+			}
+		}
+		return procs, retired, ctrl
+	}
+
+	// Core 3 alone fetches the line from memory, one hop away
+	solo, _, _ := run(3)
+	_, soloLatency := solo[0].GetDataAccesses()
+
+	procs, retired, ctrl := run(0, 3)
+	_, first := procs[0].GetDataAccesses()
+	_, second := procs[1].GetDataAccesses()
+
+	// Both reach the line in the same cycle; core 0 wins and holds it, and
+	// core 3 waits for core 0's atomic to complete before starting its own
+	if retired[3]-retired[0] != int(second) {
+		t.Errorf("Core 3's atomic retired %d cycles after core 0's, want its own %d-cycle access", retired[3]-retired[0], second)
+	}
+
+	stats := ctrl.GetStats()
+	if stats.Atomics != 2 {
+		t.Errorf("Atomics = %d, want 2", stats.Atomics)
+	}
+	if stats.AtomicContention != first {
+		t.Errorf("AtomicContention = %d, want core 3 to wait out core 0's %d-cycle access", stats.AtomicContention, first)
+	}
+
+	// Taking ownership from core 0, two hops away, costs another hop
+	if second != soloLatency+10 {
+		t.Errorf("Core 3's contended atomic took %d cycles, want %d: its uncontended %d plus a hop to core 0", second, soloLatency+10, soloLatency)
+	}
+	if got := ctrl.State(0, 0x40); got != coherence.Invalid {
+		t.Errorf("Core 0's state after losing the line = %s, want Invalid", got)
+	}
+	if got := ctrl.State(3, 0x40); got != coherence.Modified {
+		t.Errorf("Core 3's state after its atomic = %s, want Modified", got)
+	}
+
+	// Both atomics have let the line go
+	if ctrl.Blocked(0, 0x40) || ctrl.Blocked(3, 0x40) {
+		t.Errorf("Blocked() after both atomics completed = true, want the line released")
+	}
+}
+
+func TestCacheToCacheFetch(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 2
+
+	// 32 adds fill two 64-byte lines of code
+	program := make([]workload.Instruction, 32)
+	for i := range program {
+		program[i] = workload.Instruction{Opcode: workload.OpcodeADD, Dest: 1, Src1: 2, Src2: 3}
+	}
+
+	for _, shared := range []bool{false, true} {
+		ctrl, _ := coherence.NewController("MESI", cfg.NumCores, cfg.LineSize())
+		ring, _ := interconnect.New(interconnect.Ring, cfg.NumCores, cfg.InterconnectBandwidth, cfg.ClockFrequency)
+
+		procs := make([]*Processor, cfg.NumCores)
+		peers := make([]*cache.Hierarchy, cfg.NumCores)
+		for i := range procs {
+			procs[i], _ = NewProcessor(i, cfg)
+			procs[i].SetCoherenceController(ctrl)
+			procs[i].SetInterconnect(ring)
+			procs[i].LoadWorkload(program)
+			peers[i] = procs[i].GetCacheHierarchy()
+		}
+		if shared {
+			for _, proc := range procs {
+				proc.SetPeerCaches(peers)
+			}
+		}
+
+		// Core 0 runs the code first, bringing it into its caches from
+		// memory; core 1 then runs the same code
+		for _, proc := range procs {
+			for i := 0; i < 1000; i++ {
+				proc.Cycle()
+			}
+		}
+
+		if got := procs[0].GetPeerFetches(); got != 0 {
+			t.Errorf("Core 0 fetches served by a peer = %d, want 0 with cold caches", got)
+		}
+
+		want := int64(0)
+		if shared {
+			want = 2
+		}
+		if got := procs[1].GetPeerFetches(); got != want {
+			t.Errorf("Core 1 fetches served by core 0 with peer caches %v = %d, want one per line, %d", shared, got, want)
+		}
+
+		if got := procs[1].GetExecutedInstructions(); got != int64(len(program)) {
+			t.Errorf("Core 1 retired %d instructions, want %d", got, len(program))
+		}
+	}
+}
+
+func TestBranchRedirect(t *testing.T) {
+	// Count x3 up to x4 in a loop, then link over a skipped instruction
+	program, err := workload.ParseAssembly(strings.NewReader(`
+add x3, x3, x2   # x3 += 1
+beq x3, x4, 8    # leave the loop at x3 == 5
+jal x0, -8       # back to the add
+jal x5, 8        # x5 = 16, skip the next add
+add x6, x2, x2   # never runs
+add x7, x2, x2   # x7 = 2
+`))
+	if err != nil {
+		t.Fatalf("ParseAssembly() error = %v", err)
+	}
+
+	for _, predictorType := range []string{"static", "bimodal"} {
+		t.Run(predictorType, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.BranchPredictor = predictorType
+			proc, err := NewProcessor(0, cfg)
+			if err != nil {
+				t.Fatalf("NewProcessor() error = %v", err)
+			}
+			proc.threads[0].registersInt[2], proc.threads[0].registersInt[4] = 1, 5
+			proc.LoadWorkload(program)
+
+			for i := 0; i < 500; i++ {
+				proc.Cycle()
+			}
+
+			for reg, want := range map[int]uint64{0: 0, 3: 5, 5: 16, 6: 0, 7: 2} {
+				if got, _ := proc.GetIntRegister(reg); got != want {
+					t.Errorf("x%d = %d, want %d", reg, got, want)
+				}
+			}
+
+			// beq is taken once, on the last iteration; the backward jal four
+			// times and the forward one once. Only beq uses the predictor.
+			if got := proc.GetTakenBranches(); got != 6 {
+				t.Errorf("GetTakenBranches() = %d, want 6", got)
+			}
+
+			stats := proc.GetBranchStats()
+			if stats.Predictions != 5 {
+				t.Errorf("Predictions = %d, want 5", stats.Predictions)
+			}
+
+			// Every jal redirects at fetch, including the backward one fetched
+			// down the wrong path behind the final beq, and every mispredict
+			// redirects at resolution
+			if got, want := proc.GetFetchRedirects(), 6+stats.Mispredictions; got != want {
+				t.Errorf("GetFetchRedirects() = %d, want %d", got, want)
+			}
+
+			proc.Reset()
+			if proc.GetTakenBranches() != 0 || proc.GetFetchRedirects() != 0 {
+				t.Errorf("Reset() did not clear the branch redirect counts")
+			}
+		})
+	}
+}
+
+func TestPredication(t *testing.T) {
+	// A short forward branch over two adds, and an add reading one of them
+	program, err := workload.ParseAssembly(strings.NewReader(`
+beq x3, x4, 12   # skip the adds when x3 == x4
+add x5, x2, x2   # x5 = 2
+add x6, x2, x2   # x6 = 2
+add x7, x5, x2   # x7 = x5 + 1
+`))
+	if err != nil {
+		t.Fatalf("ParseAssembly() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		distance    int
+		x4          uint64 // x3 is 0, so the branch is taken if x4 is 0
+		regs        map[int]uint64
+		mispredicts int64
+		predicated  int64
+		avoided     int64
+	}{
+		{name: "Predicated and taken", distance: 2, x4: 0, regs: map[int]uint64{5: 0, 6: 0, 7: 1}, predicated: 2, avoided: 1},
+		{name: "Predicated and not taken", distance: 2, x4: 1, regs: map[int]uint64{5: 2, 6: 2, 7: 3}, predicated: 2},
+		{name: "Predicted", distance: 0, x4: 0, regs: map[int]uint64{5: 0, 6: 0, 7: 1}, mispredicts: 1},
+		{name: "Too far to predicate", distance: 1, x4: 0, regs: map[int]uint64{5: 0, 6: 0, 7: 1}, mispredicts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.PredicationDistance = tt.distance
+			proc, err := NewProcessor(0, cfg)
+			if err != nil {
+				t.Fatalf("NewProcessor() error = %v", err)
+			}
+			proc.threads[0].registersInt[2], proc.threads[0].registersInt[4] = 1, tt.x4
+			proc.LoadWorkload(program)
+
+			var retired []uint64
+			proc.SetRetireHook(func(inst Instruction) {
+				retired = append(retired, inst.Address)
+			})
+
+			for i := 0; i < 500; i++ {
+				proc.Cycle()
+			}
+
+			// Skipped adds flow through but neither commit nor forward
+			for reg, want := range tt.regs {
+				if got, _ := proc.GetIntRegister(reg); got != want {
+					t.Errorf("x%d = %d, want %d", reg, got, want)
+				}
+			}
+			want := []uint64{0, 12}
+			if tt.regs[5] != 0 {
+				want = []uint64{0, 4, 8, 12}
+			}
+			if !slices.Equal(retired, want) {
+				t.Errorf("Retired %#x, want %#x", retired, want)
+			}
+
+			if got := proc.GetFlushes()["mispredict"]; got != tt.mispredicts {
+				t.Errorf("Mispredict flushes = %d, want %d", got, tt.mispredicts)
+			}
+			predicated, avoided := proc.GetPredication()
+			if predicated != tt.predicated || avoided != tt.avoided {
+				t.Errorf("GetPredication() = %d instructions, %d avoided flushes, want %d and %d",
+					predicated, avoided, tt.predicated, tt.avoided)
+			}
+
+			proc.Reset()
+			if predicated, avoided := proc.GetPredication(); predicated != 0 || avoided != 0 {
+				t.Errorf("GetPredication() after Reset() = %d, %d, want 0, 0", predicated, avoided)
+			}
+		})
+	}
+}
+
+func TestCycleAccounting(t *testing.T) {
+	tests := []struct {
+		name          string
+		program       []workload.Instruction // nil runs the synthetic generator
+		fetchInterval int
+		wantStalls    bool
+		wantBubbles   bool
+	}{
+		{name: "Synthetic", program: nil, wantStalls: false, wantBubbles: false},
+		// Fetching every fifth cycle leaves gaps between groups
+		{name: "Synthetic, slow fetch", program: nil, fetchInterval: 5, wantStalls: false, wantBubbles: true},
+		{name: "Empty workload", program: []workload.Instruction{}, wantStalls: false, wantBubbles: true},
+		// The add waits for a load that misses to memory
+		{name: "Load-use", program: []workload.Instruction{
+			{Opcode: workload.OpcodeLW, Src1: 0, Src2: 0, Dest: 1},
+			{Opcode: uint8(OpADD), Src1: 1, Src2: 1, Dest: 2},
+		}, wantStalls: true, wantBubbles: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.FetchInterval = tt.fetchInterval
+			proc, err := NewProcessor(0, cfg)
+			if err != nil {
+				t.Fatalf("NewProcessor() error = %v", err)
+			}
+			if tt.program != nil {
+				proc.LoadWorkload(tt.program)
+			}
+
+			const cycles = 500
+			for i := 0; i < cycles; i++ {
+				proc.Cycle()
+			}
+
+			// Every cycle is exactly one of busy, stalled or a bubble
+			busy, stalls, bubbles := proc.busyCycles, proc.GetStallCycles(), proc.GetBubbleCycles()
+			if busy+stalls+bubbles != cycles {
+				t.Errorf("%d busy + %d stall + %d bubble cycles, want %d in total", busy, stalls, bubbles, cycles)
+			}
+
+			if (stalls > 0) != tt.wantStalls {
+				t.Errorf("GetStallCycles() = %d, want stalls %v", stalls, tt.wantStalls)
+			}
+
+			if (bubbles > 0) != tt.wantBubbles {
+				t.Errorf("GetBubbleCycles() = %d, want bubbles %v", bubbles, tt.wantBubbles)
+			}
+
+			if tt.program != nil && len(tt.program) == 0 && bubbles != cycles {
+				t.Errorf("GetBubbleCycles() = %d with nothing to fetch, want %d", bubbles, cycles)
+			}
+
+			proc.Reset()
+			if proc.GetStallCycles() != 0 || proc.GetBubbleCycles() != 0 {
+				t.Errorf("Reset() did not clear the stall and bubble counts")
+			}
+		})
+	}
+}
+
+func TestExecutionUnitCounts(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumALUs = 3
+	cfg.NumFPUs = 2
+	proc, _ := NewProcessor(0, cfg)
+
+	want := map[string]int{"ALU": 3, "FPU": 2, "LoadStore": 1, "Branch": 1}
+	for unitType, count := range want {
+		if got := len(proc.executionUnits[unitType]); got != count {
+			t.Errorf("%d %s units, want %d", got, unitType, count)
+		}
+	}
+}
+
+func TestDispatch_StructuralHazard(t *testing.T) {
+	// Issues count integer instructions to Execute in the same cycle and
+	// returns how many found no free ALU
+	stalls := func(numALUs, count int) int {
+		cfg := config.DefaultConfig()
+		cfg.NumALUs = numALUs
+		proc, _ := NewProcessor(0, cfg)
+
+		stalled := 0
+		for i := 0; i < count; i++ {
+			if _, ok := proc.dispatch(&pipeline.Instruction{Type: "Integer"}); !ok {
+				stalled++
+			}
+		}
+		return stalled
+	}
+
+	one, two := stalls(1, 4), stalls(2, 4)
+	if one != 3 || two != 2 {
+		t.Errorf("Integer stalls = %d with 1 ALU, %d with 2, want 3 and 2", one, two)
+	}
+
+	// A busy FPU stays claimed for its three stages
+	proc, _ := NewProcessor(0, config.DefaultConfig())
+	fp := &pipeline.Instruction{Type: "Float"}
+	if latency, ok := proc.dispatch(fp); !ok || latency != 3 {
+		t.Fatalf("dispatch() to an idle FPU = %d, %v, want 3, true", latency, ok)
+	}
+
+	for cycle := 1; cycle < 3; cycle++ {
+		proc.releaseUnits()
+		if _, ok := proc.dispatch(fp); ok {
+			t.Errorf("FPU accepted an instruction %d cycles into a 3-cycle operation", cycle)
+		}
+	}
+
+	proc.releaseUnits()
+	if _, ok := proc.dispatch(fp); !ok {
+		t.Errorf("FPU still busy after 3 cycles")
+	}
+}
+
+func TestUnitUtilization(t *testing.T) {
+	cfg := config.DefaultConfig()
+	proc, _ := NewProcessor(0, cfg)
+	proc.LoadWorkload([]workload.Instruction{
+		{Opcode: 0x40, Src1: 2, Src2: 3, Dest: 1}, // Float
+		{Opcode: 0x41, Src1: 2, Src2: 3, Dest: 4}, // Float
+	})
+
+	for i := 0; i < 100; i++ {
+		proc.Cycle()
+	}
+
+	util := proc.GetUnitUtilization()
+
+	// Two 3-cycle FPU operations over 100 cycles
+	if got := util["FPU"][0]; got != 0.06 {
+		t.Errorf("FPU utilization = %v, want 0.06", got)
+	}
+
+	for i, got := range util["ALU"] {
+		if got != 0.0 {
+			t.Errorf("ALU %d utilization = %v with no integer instructions, want 0", i, got)
+		}
+	}
+
+	proc.Reset()
+	if got := proc.GetUnitUtilization()["FPU"][0]; got != 0.0 {
+		t.Errorf("FPU utilization after Reset() = %v, want 0", got)
+	}
+}
+
+func TestIssueWidth(t *testing.T) {
+	retired := func(width int) int64 {
+		cfg := config.DefaultConfig()
+		cfg.IssueWidth = width
+		proc, _ := NewProcessor(0, cfg)
+
+		for i := 0; i < 100; i++ {
+			proc.Cycle()
+		}
+		return proc.GetExecutedInstructions()
+	}
+
+	scalar, wide := retired(1), retired(2)
+	if wide <= scalar {
+		t.Errorf("2-wide core retired %d instructions, want more than scalar's %d", wide, scalar)
+	}
+}
+
+func TestDataAccessLatency(t *testing.T) {
+	cfg := config.DefaultConfig()
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	// Two loads from the same address: the first misses to memory, the
+	// second hits in L1
+	load := workload.Instruction{Opcode: 0x60, Dest: 3, Src1: 0, Src2: 0x40}
+	proc.LoadWorkload([]workload.Instruction{load, load})
+
+	for i := 0; i < 1000; i++ {
+		proc.Cycle()
+	}
+
+	accesses, cycles := proc.GetDataAccesses()
+	if accesses != 2 {
+		t.Fatalf("GetDataAccesses() accesses = %d, want 2", accesses)
+	}
+
+	if want := int64(cfg.MemoryLatency + cfg.L1Latency); cycles < want {
+		t.Errorf("GetDataAccesses() cycles = %d, want at least %d", cycles, want)
+	}
+
+	proc.Reset()
+	if accesses, cycles := proc.GetDataAccesses(); accesses != 0 || cycles != 0 {
+		t.Errorf("Reset() left data accesses = %d, cycles = %d", accesses, cycles)
+	}
+}
+
+func TestHitUnderMiss(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.IssueWidth = 2
+	cfg.SyncMode = true
+	cfg.MemoryPorts = 3
+	cfg.HitUnderMissLatency = 5
+
+	miss := workload.Instruction{Opcode: 0x60, Dest: 3, Src1: 0, Src2: 0x40}
+	hit := workload.Instruction{Opcode: 0x60, Dest: 4, Src1: 0, Src2: 0x80}
+
+	// run executes program two-wide, so its loads reach the cache in the
+	// same cycle, with the line hit reads already in L1. When contended,
+	// another core claims a memory port every cycle.
+	run := func(program []workload.Instruction, contended bool) (hits, added, cycles int64) {
+		proc, err := NewProcessor(0, cfg)
+		if err != nil {
+			t.Fatalf("NewProcessor() error = %v", err)
+		}
+		ports, _ := memory.NewMemoryPorts(cfg.MemoryPorts, 2)
+		proc.SetMemoryPorts(ports)
+		proc.GetCacheHierarchy().Access(0x80, false)
+		proc.LoadWorkload(program)
+
+		for i := 0; i < 1000; i++ {
+			ports.BeginCycle()
+			if contended {
+				ports.Acquire(1)
+			}
+			proc.Cycle()
+		}
+
+		hits, added = proc.GetHitUnderMiss()
+		_, cycles = proc.GetDataAccesses()
+		return hits, added, cycles
+	}
+
+	_, _, missCycles := run([]workload.Instruction{miss}, true)
+
+	tests := []struct {
+		name           string
+		program        []workload.Instruction
+		contended      bool
+		wantHits       int64
+		wantAdded      int64
+		wantHitLatency int64
+	}{
+		{"Hit with no miss outstanding", []workload.Instruction{hit}, true, 0, 0, int64(cfg.L1Latency)},
+		{"Hit under miss, ports free", []workload.Instruction{miss, hit}, false, 1, 0, int64(cfg.L1Latency)},
+		{"Hit under miss, ports contended", []workload.Instruction{miss, hit}, true, 1, 5, int64(cfg.L1Latency + 5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, added, cycles := run(tt.program, tt.contended)
+			if hits != tt.wantHits || added != tt.wantAdded {
+				t.Errorf("GetHitUnderMiss() = %d, %d, want %d, %d", hits, added, tt.wantHits, tt.wantAdded)
+			}
+
+			hitLatency := cycles
+			if len(tt.program) == 2 {
+				hitLatency -= missCycles
+			}
+			if hitLatency != tt.wantHitLatency {
+				t.Errorf("Hit latency = %d, want %d", hitLatency, tt.wantHitLatency)
+			}
+		})
+	}
+}
+
+func TestStoreBuffer(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.StoreBufferEntries = 1
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	// The second store waits for the first to drain to memory; the load
+	// then finds its value still in the buffer
+	proc.LoadWorkload([]workload.Instruction{
+		{Opcode: 0x68, Dest: 3, Src1: 0, Src2: 0x40},
+		{Opcode: 0x68, Dest: 3, Src1: 0, Src2: 0x48},
+		{Opcode: 0x60, Dest: 4, Src1: 0, Src2: 0x48},
+	})
+	for i := 0; i < 1000; i++ {
+		proc.Cycle()
+	}
+
+	stats := proc.GetStoreBufferStats()
+	if stats.Stores != 2 || stats.Drains != 2 || stats.Forwards != 1 {
+		t.Errorf("GetStoreBufferStats() = %+v, want 2 stores drained and 1 forwarded load", stats)
+	}
+
+	if stats.FullStalls == 0 {
+		t.Error("The second store should have waited for the full buffer")
+	}
+
+	if got := proc.GetExecutedInstructions(); got != 3 {
+		t.Errorf("GetExecutedInstructions() = %d, want 3", got)
+	}
+
+	restored, _ := NewProcessor(0, cfg)
+	if err := restored.Restore(proc.Snapshot()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got := restored.GetStoreBufferStats(); got != stats {
+		t.Errorf("GetStoreBufferStats() after Restore() = %+v, want %+v", got, stats)
+	}
+
+	unbuffered, _ := NewProcessor(0, config.DefaultConfig())
+	if err := unbuffered.Restore(proc.Snapshot()); err == nil {
+		t.Error("Restore() of a core with a store buffer into one without should return error")
+	}
+
+	proc.Reset()
+	if got := proc.GetStoreBufferStats(); got != (memory.StoreBufferStats{}) {
+		t.Errorf("Reset() left store buffer stats %+v", got)
+	}
+}
+
+func TestWriteCombining(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.WriteCombiningEntries = 2
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	// A load brings the line at 0x40 into L1, then eight stores fill it and
+	// write it to memory around the caches. The last store starts a line
+	// still buffered at the end.
+	program := []workload.Instruction{{Opcode: 0x60, Dest: 3, Src1: 0, Src2: 0x40}}
+	for off := uint8(0x40); off <= 0x80; off += 8 {
+		program = append(program, workload.Instruction{Opcode: 0x68, Dest: 3, Src1: 0, Src2: off})
+	}
+	proc.LoadWorkload(program)
+	for i := 0; i < 1000; i++ {
+		proc.Cycle()
+	}
+
+	want := memory.WriteCombiningStats{Stores: 9, CombinedWrites: 7, MemoryWrites: 1, FullLineFlushes: 1}
+	if got := proc.GetWriteCombiningStats(); got != want {
+		t.Errorf("GetWriteCombiningStats() = %+v, want %+v", got, want)
+	}
+
+	if proc.caches.Levels[0].Contains(0x40) {
+		t.Error("L1 still holds the line written to memory around it")
+	}
+
+	restored, _ := NewProcessor(0, cfg)
+	if err := restored.Restore(proc.Snapshot()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got := restored.GetWriteCombiningStats(); got != want {
+		t.Errorf("GetWriteCombiningStats() after Restore() = %+v, want %+v", got, want)
+	}
+	if got := restored.writeCombining.Occupancy(); got != 1 {
+		t.Errorf("Restored buffer holds %d lines, want 1", got)
+	}
+
+	uncombined, _ := NewProcessor(0, config.DefaultConfig())
+	if err := uncombined.Restore(proc.Snapshot()); err == nil {
+		t.Error("Restore() of a core with a write-combining buffer into one without should return error")
+	}
+
+	// A full flush serializes the core, writing out the line still
+	// buffered, as does the end of a run
+	drained := want
+	drained.MemoryWrites, drained.PartialFlushes = 2, 1
+	restored.flushPipeline(pipeline.FlushException)
+	if got := restored.GetWriteCombiningStats(); got != drained || restored.writeCombining.Occupancy() != 0 {
+		t.Errorf("GetWriteCombiningStats() after a flush = %+v with %d lines buffered, want %+v and none",
+			got, restored.writeCombining.Occupancy(), drained)
+	}
+	proc.DrainWriteCombining()
+	if got := proc.GetWriteCombiningStats(); got != drained || proc.writeCombining.Occupancy() != 0 {
+		t.Errorf("GetWriteCombiningStats() after DrainWriteCombining() = %+v with %d lines buffered, want %+v and none",
+			got, proc.writeCombining.Occupancy(), drained)
+	}
+
+	proc.Reset()
+	if got := proc.GetWriteCombiningStats(); got != (memory.WriteCombiningStats{}) || proc.writeCombining.Occupancy() != 0 {
+		t.Errorf("Reset() left write-combining stats %+v", got)
+	}
+}
+
+func TestFetchQueue(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.FetchQueueSize = 4
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	// The load misses to memory and its consumer holds up the pipeline, so
+	// fetch runs ahead into the queue until it fills
+	program := []workload.Instruction{
+		{Opcode: 0x60, Dest: 3, Src1: 0, Src2: 0x40},
+		{Opcode: uint8(OpADD), Dest: 4, Src1: 3, Src2: 3},
+	}
+	for i := 0; i < 10; i++ {
+		program = append(program, workload.Instruction{Opcode: uint8(OpADD), Dest: 5, Src1: 6, Src2: 6})
+	}
+	proc.LoadWorkload(program)
+
+	var snap Snapshot
+	for i := 0; i < 1000; i++ {
+		proc.Cycle()
+		if n := len(proc.instructionQueue); n > cfg.FetchQueueSize {
+			t.Fatalf("Cycle %d: %d instructions queued, want at most %d", i+1, n, cfg.FetchQueueSize)
+		}
+		if len(proc.instructionQueue) == cfg.FetchQueueSize && snap.FetchQueue == nil {
+			snap = proc.Snapshot()
+		}
+	}
+
+	if got := proc.GetExecutedInstructions(); got != int64(len(program)) {
+		t.Errorf("GetExecutedInstructions() = %d, want %d", got, len(program))
+	}
+
+	if proc.GetFetchQueueStalls() == 0 {
+		t.Error("GetFetchQueueStalls() = 0, want fetch held back by the full queue")
+	}
+
+	if len(snap.FetchQueue) != cfg.FetchQueueSize {
+		t.Fatalf("The queue never filled")
+	}
+
+	restored, _ := NewProcessor(0, cfg)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got := len(restored.instructionQueue); got != cfg.FetchQueueSize {
+		t.Errorf("Restore() queued %d instructions, want %d", got, cfg.FetchQueueSize)
+	}
+
+	unqueued, _ := NewProcessor(0, config.DefaultConfig())
+	if err := unqueued.Restore(snap); err == nil {
+		t.Error("Restore() of a full queue into a core without one should return error")
+	}
+
+	proc.Reset()
+	if proc.GetFetchQueueStalls() != 0 || len(proc.instructionQueue) != 0 {
+		t.Error("Reset() should empty the queue and zero its stalls")
+	}
+
+	// Without a queue fetch waits for the pipeline instead
+	direct, _ := NewProcessor(0, config.DefaultConfig())
+	direct.LoadWorkload(program)
+	for i := 0; i < 1000; i++ {
+		direct.Cycle()
+	}
+	if got := direct.GetFetchQueueStalls(); got != 0 {
+		t.Errorf("GetFetchQueueStalls() without a queue = %d, want 0", got)
+	}
+}
+
+func TestMemoryFaults(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MemorySize = 0x1000
+
+	// A load past the end of memory faults; the core carries on
+	run := func(cfg *config.Config) *Processor {
+		proc, err := NewProcessor(0, cfg)
+		if err != nil {
+			t.Fatalf("NewProcessor() error = %v", err)
+		}
+		proc.threads[0].registersInt[5] = 0x2000
+		proc.LoadWorkload([]workload.Instruction{
+			{Opcode: 0x60, Dest: 3, Src1: 5, Src2: 0},
+			{Opcode: uint8(OpADD), Dest: 4, Src1: 6, Src2: 6},
+		})
+		for i := 0; i < 100; i++ {
+			proc.Cycle()
+		}
+		return proc
+	}
+
+	proc := run(cfg)
+	if got := proc.GetMemoryFaults(); got != 1 {
+		t.Errorf("GetMemoryFaults() = %d, want 1", got)
+	}
+	if got := proc.GetExecutedInstructions(); got != 2 || proc.IsHalted() {
+		t.Errorf("GetExecutedInstructions() = %d, halted %v, want 2 retired and running", got, proc.IsHalted())
+	}
+	if accesses, _ := proc.GetDataAccesses(); accesses != 0 {
+		t.Errorf("GetDataAccesses() = %d, want the faulting load not to reach memory", accesses)
+	}
+
+	halting := *cfg
+	halting.HaltOnMemoryFault = true
+	proc = run(&halting)
+	if !proc.IsHalted() || proc.IsBusy() {
+		t.Errorf("IsHalted() = %v, IsBusy() = %v, want halted with nothing in flight", proc.IsHalted(), proc.IsBusy())
+	}
+	if got := proc.GetExecutedInstructions(); got != 0 {
+		t.Errorf("GetExecutedInstructions() = %d after halting, want 0", got)
+	}
+	if got := proc.StallReport(); !strings.Contains(got, "memory fault") {
+		t.Errorf("StallReport() = %q, want the fault named", got)
+	}
+
+	proc.Reset()
+	if proc.IsHalted() || proc.GetMemoryFaults() != 0 {
+		t.Error("Reset() should restart a halted core and zero its faults")
+	}
+
+	// A runaway pc faults once at the end of memory and fetch stops there
+	cfg = config.DefaultConfig()
+	cfg.MemorySize = 64
+	proc, _ = NewProcessor(0, cfg)
+	for i := 0; i < 200; i++ {
+		proc.Cycle()
+	}
+	if got := proc.GetMemoryFaults(); got != 1 {
+		t.Errorf("GetMemoryFaults() for a runaway pc = %d, want 1", got)
+	}
+	if got, want := proc.GetExecutedInstructions(), int64(64/workload.InstructionSize); got != want {
+		t.Errorf("GetExecutedInstructions() = %d, want the %d instructions that fit in memory", got, want)
+	}
+}
+
+func TestFullyAssociativeTLB(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.TLBEntries, cfg.TLBAssociativity = 12, config.FullyAssociative
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	if sets := proc.tlb.Snapshot().Sets; len(sets) != 1 || len(sets[0]) != 12 {
+		t.Errorf("Fully associative TLB has %d sets, want a single set of all 12 entries", len(sets))
+	}
+}
+
+func TestDataAccessTranslation(t *testing.T) {
+	run := func(tlbEntries int) (*Processor, int64) {
+		cfg := config.DefaultConfig()
+		cfg.TLBEntries, cfg.PageSize, cfg.PageWalkLatency = tlbEntries, 64, 25
+		proc, err := NewProcessor(0, cfg)
+		if err != nil {
+			t.Fatalf("NewProcessor() error = %v", err)
+		}
+
+		// With 64-byte pages the loads touch a page the fetches did not
+		load := workload.Instruction{Opcode: 0x60, Dest: 3, Src1: 0, Src2: 0x40}
+		proc.LoadWorkload([]workload.Instruction{load, load})
+		for i := 0; i < 1000; i++ {
+			proc.Cycle()
+		}
+
+		_, cycles := proc.GetDataAccesses()
+		return proc, cycles
+	}
+
+	_, physical := run(0)
+	proc, translated := run(16)
+
+	// Only the first load walks the page table
+	if translated-physical != 25 {
+		t.Errorf("Translation added %d cycles to the loads, want one 25-cycle page walk", translated-physical)
+	}
+
+	// Each page misses once: the fetches' and the loads'
+	if hits, misses := proc.GetTLBLookups(); hits != 2 || misses != 2 {
+		t.Errorf("GetTLBLookups() = %d hits, %d misses, want 2 and 2", hits, misses)
+	}
+
+	restored, _ := NewProcessor(0, proc.config)
+	if err := restored.Restore(proc.Snapshot()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if hits, misses := restored.GetTLBLookups(); hits != 2 || misses != 2 {
+		t.Errorf("GetTLBLookups() after Restore() = %d hits, %d misses, want 2 and 2", hits, misses)
+	}
+
+	untranslated, _ := NewProcessor(0, config.DefaultConfig())
+	if err := untranslated.Restore(proc.Snapshot()); err == nil {
+		t.Error("Restore() of a translating core into one without a TLB should return error")
+	}
+
+	proc.Reset()
+	if hits, misses := proc.GetTLBLookups(); hits != 0 || misses != 0 {
+		t.Errorf("Reset() left TLB lookups = %d hits, %d misses", hits, misses)
+	}
+}
+
+func TestInstructionMix(t *testing.T) {
+	const n = 10000
+	cfg := config.DefaultConfig()
+	cfg.MixInteger, cfg.MixFloat, cfg.MixMemory, cfg.MixBranch = 40, 20, 30, 10
+
+	generate := func() []*Instruction {
+		proc, err := NewProcessor(0, cfg)
+		if err != nil {
+			t.Fatalf("NewProcessor() error = %v", err)
+		}
+
+		stream := make([]*Instruction, n)
+		for i := range stream {
+			stream[i] = proc.fetchNextInstruction(0)
+		}
+		return stream
+	}
+
+	stream := generate()
+	counts := make(map[string]int)
+	for _, inst := range stream {
+		counts[inst.Type]++
+	}
+
+	want := map[string]int{"Integer": 40, "Float": 20, "Memory": 30, "Branch": 10}
+	for instType, percent := range want {
+		got := float64(counts[instType]) * 100 / n
+		if math.Abs(got-float64(percent)) > 2 {
+			t.Errorf("%s = %.1f%% of the stream, want %d%% ± 2", instType, got, percent)
+		}
+	}
+
+	// The same seed generates the same stream
+	for i, inst := range generate() {
+		if inst.Opcode != stream[i].Opcode || inst.Operands[2] != stream[i].Operands[2] {
+			t.Fatalf("instruction %d differs between runs with the same seed", i)
+		}
+	}
+}
+
+func TestX86InstructionLength(t *testing.T) {
+	const n = 10000
+	cfg := config.DefaultConfig()
+	cfg.ISA = "x86"
+	cfg.PipelineDepth = 6
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	counts := make(map[int]int)
+	next := uint64(0)
+	for i := 0; i < n; i++ {
+		inst := proc.fetchNextInstruction(0)
+		if inst.Length < 1 || inst.Length > 15 {
+			t.Fatalf("instruction %d is %d bytes, want 1 to 15", i, inst.Length)
+		}
+
+		// The pc advances by the real length of each encoding
+		if inst.Address != next {
+			t.Fatalf("instruction %d at %#x, want %#x", i, inst.Address, next)
+		}
+		next += uint64(inst.Length)
+
+		if want := (inst.Length - 1) / 4; inst.DecodeCost != want {
+			t.Errorf("%d-byte instruction DecodeCost = %d, want %d", inst.Length, inst.DecodeCost, want)
+		}
+		counts[inst.Length]++
+	}
+
+	for length, percent := range x86LengthWeights {
+		got := float64(counts[length]) * 100 / n
+		if math.Abs(got-float64(percent)) > 2 {
+			t.Errorf("%d-byte instructions = %.1f%% of the stream, want %d%% ± 2", length, got, percent)
+		}
+	}
+
+	// Other ISAs keep fixed 4-byte encodings with no decode penalty
+	riscv, _ := NewProcessor(0, config.DefaultConfig())
+	if inst := riscv.fetchNextInstruction(0); inst.Length != 4 || inst.DecodeCost != 0 {
+		t.Errorf("RISC-V instruction Length = %d, DecodeCost = %d, want 4 and 0", inst.Length, inst.DecodeCost)
+	}
+}
+
+func TestX86DecodeCost(t *testing.T) {
+	run := func() int64 {
+		cfg := config.DefaultConfig()
+		cfg.ISA = "x86"
+		cfg.PipelineDepth = 6
+		proc, err := NewProcessor(0, cfg)
+		if err != nil {
+			t.Fatalf("NewProcessor() error = %v", err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			proc.Cycle()
+		}
+		return proc.GetExecutedInstructions()
+	}
+
+	mixed := run()
+
+	// Long encodings hold up decode, so fewer instructions retire than when
+	// every encoding fits the decoder in one cycle
+	saved := x86LengthWeights
+	defer func() { x86LengthWeights = saved }()
+	x86LengthWeights = [len(saved)]int{4: 100}
+
+	if short := run(); mixed >= short {
+		t.Errorf("Retired %d instructions with mixed lengths, want fewer than %d with 4-byte encodings", mixed, short)
+	}
+}
+
+func TestRetiredByType(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MixInteger, cfg.MixFloat, cfg.MixMemory, cfg.MixBranch = 40, 20, 30, 10
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	for i := 0; i < 20000; i++ {
+		proc.Cycle()
+	}
+
+	retired := proc.GetRetiredByType()
+	total := int64(0)
+	for _, n := range retired {
+		total += n
+	}
+
+	if total == 0 || total != proc.GetExecutedInstructions() {
+		t.Fatalf("Retired %d instructions by type, %d in total", total, proc.GetExecutedInstructions())
+	}
+
+	for _, instType := range []string{"Integer", "Float", "Memory", "Branch"} {
+		if retired[instType] == 0 {
+			t.Errorf("No %s instructions retired: %v", instType, retired)
+		}
+	}
+
+	proc.Reset()
+	if retired := proc.GetRetiredByType(); len(retired) != 0 {
+		t.Errorf("Reset() left retired counts %v", retired)
+	}
+}
+
+func TestRegisterAccessors(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ISA = "x86" // 16 integer, 8 float registers
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+	proc.threads[0].registersInt[5] = 42
+	proc.threads[0].registersFloat[7] = 1.5
+
+	tests := []struct {
+		name    string
+		get     func() (float64, error)
+		want    float64
+		wantErr bool
+	}{
+		{name: "Integer register", get: intReg(proc, 5), want: 42},
+		{name: "Last integer register", get: intReg(proc, 15), want: 0},
+		{name: "Integer register past the ISA", get: intReg(proc, 16), wantErr: true},
+		{name: "Negative integer register", get: intReg(proc, -1), wantErr: true},
+		{name: "Float register", get: func() (float64, error) { return proc.GetFloatRegister(7) }, want: 1.5},
+		{name: "Float register past the ISA", get: func() (float64, error) { return proc.GetFloatRegister(8) }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The dump is a copy
+	intRegs, floatRegs := proc.DumpRegisters()
+	if len(intRegs) != 16 || len(floatRegs) != 8 {
+		t.Fatalf("DumpRegisters() lengths = %d, %d, want 16, 8", len(intRegs), len(floatRegs))
+	}
+
+	intRegs[5], floatRegs[7] = 0, 0
+	if proc.threads[0].registersInt[5] != 42 || proc.threads[0].registersFloat[7] != 1.5 {
+		t.Errorf("Modifying the DumpRegisters() result changed the register file")
+	}
+}
+
+// intReg adapts GetIntRegister to the table in TestRegisterAccessors
+func intReg(proc *Processor, n int) func() (float64, error) {
+	return func() (float64, error) {
+		v, err := proc.GetIntRegister(n)
+		return float64(v), err
+	}
+}
+
+func TestExecuteIntegerOps(t *testing.T) {
+	for _, forwarding := range []bool{true, false} {
+		cfg := config.DefaultConfig()
+		cfg.ForwardingEnabled = forwarding
+		proc, err := NewProcessor(0, cfg)
+		if err != nil {
+			t.Fatalf("NewProcessor() error = %v", err)
+		}
+		proc.threads[0].registersInt[2], proc.threads[0].registersInt[3] = 5, 7
+
+		// r1 = r2 + r3, then r4 = r1 - r2 depends on the new r1
+		proc.LoadWorkload([]workload.Instruction{
+			{Opcode: uint8(OpADD), Src1: 2, Src2: 3, Dest: 1},
+			{Opcode: uint8(OpSUB), Src1: 1, Src2: 2, Dest: 4},
+		})
+
+		for i := 0; i < 100; i++ {
+			proc.Cycle()
+		}
+
+		if got, _ := proc.GetIntRegister(1); got != 12 {
+			t.Errorf("forwarding %v: r1 = %d, want 12", forwarding, got)
+		}
+
+		if got, _ := proc.GetIntRegister(4); got != 7 {
+			t.Errorf("forwarding %v: r4 = %d, want 7", forwarding, got)
+		}
+	}
+}
+
+func TestExecuteAssembly(t *testing.T) {
+	program, err := workload.ParseAssembly(strings.NewReader(`
+add x3, x1, x2   # x3 = 5 + 7
+sub x4, x3, x1   # x4 = 12 - 5
+add x5, x4, x4   # x5 = 7 + 7
+`))
+	if err != nil {
+		t.Fatalf("ParseAssembly() error = %v", err)
+	}
+
+	proc, err := NewProcessor(0, config.DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+	proc.threads[0].registersInt[1], proc.threads[0].registersInt[2] = 5, 7
+	proc.LoadWorkload(program)
+
+	for i := 0; i < 100; i++ {
+		proc.Cycle()
+	}
+
+	for reg, want := range map[int]uint64{3: 12, 4: 7, 5: 14} {
+		if got, _ := proc.GetIntRegister(reg); got != want {
+			t.Errorf("x%d = %d, want %d", reg, got, want)
+		}
+	}
+}
+
+func TestSMT(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ThreadsPerCore = 2
+	proc, err := NewProcessor(0, cfg)
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	if proc.NumThreads() != 2 {
+		t.Fatalf("NumThreads() = %d, want 2", proc.NumThreads())
+	}
+
+	// Both threads run the same program against their own registers
+	proc.threads[0].registersInt[2], proc.threads[0].registersInt[3] = 5, 7
+	proc.threads[1].registersInt[2], proc.threads[1].registersInt[3] = 10, 20
+	proc.LoadWorkload([]workload.Instruction{
+		{Opcode: uint8(OpADD), Src1: 2, Src2: 3, Dest: 1},
+		{Opcode: uint8(OpSUB), Src1: 1, Src2: 2, Dest: 4},
+	})
+
+	// Fetch alternates between threads and skips stalled ones
+	if group := proc.fetchGroup([]bool{false, false}); len(group) == 0 || group[0].Thread != 0 {
+		t.Fatalf("First fetch group should come from thread 0")
+	}
+	if group := proc.fetchGroup([]bool{true, false}); len(group) == 0 || group[0].Thread != 1 {
+		t.Fatalf("Fetch should skip stalled thread 0")
+	}
+
+	proc.Reset()
+	proc.threads[0].registersInt[2], proc.threads[0].registersInt[3] = 5, 7
+	proc.threads[1].registersInt[2], proc.threads[1].registersInt[3] = 10, 20
+
+	for i := 0; i < 200; i++ {
+		proc.Cycle()
+	}
+
+	want := map[int][2]uint64{0: {12, 7}, 1: {30, 20}}
+	for thread, regs := range want {
+		intRegs, _, err := proc.DumpThreadRegisters(thread)
+		if err != nil {
+			t.Fatalf("DumpThreadRegisters(%d) error = %v", thread, err)
+		}
+		if intRegs[1] != regs[0] || intRegs[4] != regs[1] {
+			t.Errorf("Thread %d r1, r4 = %d, %d, want %d, %d", thread, intRegs[1], intRegs[4], regs[0], regs[1])
+		}
+	}
+
+	if got := proc.GetThreadInstructions(); !reflect.DeepEqual(got, []int64{2, 2}) {
+		t.Errorf("GetThreadInstructions() = %v, want [2 2]", got)
+	}
+
+	if _, _, err := proc.DumpThreadRegisters(2); err == nil {
+		t.Errorf("DumpThreadRegisters(2) should return error")
+	}
+}
+
+func TestOutOfOrderIPC(t *testing.T) {
+	// Each iteration loads from a new line, uses the load straight away and
+	// then does independent work the in-order core cannot reach until the
+	// miss is served
+	var src strings.Builder
+	for i := 0; i < 40; i++ {
+		src.WriteString("add x5, x5, x6\nlw x1, 0(x5)\nadd x2, x1, x1\n")
+		src.WriteString("add x7, x8, x9\nadd x10, x8, x9\nadd x11, x8, x9\n")
+	}
+	program, err := workload.ParseAssembly(strings.NewReader(src.String()))
+	if err != nil {
+		t.Fatalf("ParseAssembly() error = %v", err)
+	}
+
+	ipc := func(outOfOrder bool) float64 {
+		cfg := config.DefaultConfig()
+		cfg.IssueWidth = 4
+		cfg.OutOfOrder = outOfOrder
+		proc, err := NewProcessor(0, cfg)
+		if err != nil {
+			t.Fatalf("NewProcessor() error = %v", err)
+		}
+		proc.threads[0].registersInt[6] = 64
+		proc.LoadWorkload(program)
+
+		for proc.GetExecutedInstructions() < int64(len(program)) && proc.GetCycleCount() < 100000 {
+			proc.Cycle()
+		}
+		return float64(proc.GetExecutedInstructions()) / float64(proc.GetCycleCount())
+	}
+
+	inOrder, outOfOrder := ipc(false), ipc(true)
+	t.Logf("IPC in-order %.3f, out-of-order %.3f (%.1fx)", inOrder, outOfOrder, outOfOrder/inOrder)
+
+	if outOfOrder < 2*inOrder {
+		t.Errorf("Out-of-order IPC %.3f is not at least twice in-order IPC %.3f", outOfOrder, inOrder)
+	}
+}
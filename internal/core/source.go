@@ -0,0 +1,156 @@
+package core
+
+import (
+	"math/rand"
+
+	"github.com/jasonKoogler/cpu-sim/internal/config"
+	"github.com/jasonKoogler/cpu-sim/internal/workload"
+)
+
+// InstructionSource supplies the instructions a core fetches. Next returns
+// the instruction at pc, with its Opcode, Operands, Type, Length and, for
+// branches, Target filled in, or false if there is nothing to fetch there.
+// A Length of 0 means the fixed workload.InstructionSize. The core sets the
+// remaining fields and owns the returned instruction.
+type InstructionSource interface {
+	Next(pc uint64) (*Instruction, bool)
+}
+
+// syntheticSource generates instructions from the configured mix, drawing
+// from the core's random source
+type syntheticSource struct {
+	cfg *config.Config
+	rng *rand.Rand
+}
+
+// NewSyntheticSource returns a source that generates an endless stream of
+// instructions from cfg's instruction mix, drawing from rng. Cores use one
+// seeded from RandSeed unless given another source.
+func NewSyntheticSource(cfg *config.Config, rng *rand.Rand) InstructionSource {
+	return &syntheticSource{cfg: cfg, rng: rng}
+}
+
+// Next generates an instruction; every pc has one
+func (s *syntheticSource) Next(pc uint64) (*Instruction, bool) {
+	inst := s.instruction()
+	if s.cfg.ISA == "x86" {
+		inst.Length = s.x86Length()
+	}
+	if inst.Type == "Branch" {
+		inst.Target = pc + syntheticBranchOffset
+	}
+	return inst, true
+}
+
+// x86Length draws the length of a generated x86 instruction
+func (s *syntheticSource) x86Length() int {
+	n := s.rng.Intn(100)
+	for length, weight := range x86LengthWeights {
+		if n < weight {
+			return length
+		}
+		n -= weight
+	}
+	return len(x86LengthWeights) - 1
+}
+
+// instruction draws the next generated instruction's type from the
+// configured mix. An all-zero mix generates integer ADDs only.
+func (s *syntheticSource) instruction() *Instruction {
+	cfg := s.cfg
+	total := cfg.MixInteger + cfg.MixFloat + cfg.MixMemory + cfg.MixBranch
+	if total == 0 {
+		return &Instruction{Opcode: uint8(OpADD), Operands: []uint8{1, 2, 3}, Type: "Integer"}
+	}
+
+	n := s.rng.Intn(total)
+	switch {
+	case n < cfg.MixInteger:
+		return &Instruction{Opcode: uint8(OpADD), Operands: []uint8{1, 2, 3}, Type: "Integer"} // ADD r1 = r2 + r3
+	case n < cfg.MixInteger+cfg.MixFloat:
+		return &Instruction{Opcode: 0x40, Operands: []uint8{1, 2, 3}, Type: "Float"} // FADD f1 = f2 + f3
+	case n < cfg.MixInteger+cfg.MixFloat+cfg.MixMemory:
+		// Loads and stores in equal measure, to a 256-byte window off r0
+		opcode := uint8(0x60)
+		if s.rng.Intn(2) == 1 {
+			opcode = 0x68
+		}
+		offset := uint8(s.rng.Intn(32) * 8)
+		return &Instruction{Opcode: opcode, Operands: []uint8{4, 0, offset}, Type: "Memory"}
+	default:
+		// BEQ or BNE r2, r3 at random, so half the branches are taken
+		opcode := 0x70 | uint8(s.rng.Intn(2))
+		return &Instruction{Opcode: opcode, Operands: []uint8{0, 2, 3}, Type: "Branch"}
+	}
+}
+
+// workloadSource serves a loaded program laid out from its base address
+type workloadSource struct {
+	program []workload.Instruction
+	base    uint64
+}
+
+// NewWorkloadSource returns a source serving program, one fixed-size
+// instruction after another from address 0. Fetching past the end finds
+// nothing, so the thread goes idle.
+func NewWorkloadSource(program []workload.Instruction) InstructionSource {
+	return &workloadSource{program: program}
+}
+
+// NewProgramSource returns a source serving prog's instructions from its
+// text address. Fetching outside them finds nothing.
+func NewProgramSource(prog *workload.Program) InstructionSource {
+	return &workloadSource{program: prog.Instructions, base: prog.TextAddr}
+}
+
+// Next returns the program's instruction at pc
+func (s *workloadSource) Next(pc uint64) (*Instruction, bool) {
+	if pc < s.base {
+		return nil, false
+	}
+	idx := (pc - s.base) / workload.InstructionSize
+	if idx >= uint64(len(s.program)) {
+		return nil, false
+	}
+
+	w := s.program[idx]
+	inst := &Instruction{
+		Opcode:   w.Opcode,
+		Operands: []uint8{w.Dest, w.Src1, w.Src2},
+		Type:     w.Type(),
+		Length:   workload.InstructionSize,
+	}
+	if inst.Type == "Branch" {
+		inst.Target = branchTarget(pc, w.Dest)
+	}
+	return inst, true
+}
+
+// traceSource replays recorded instructions by address
+type traceSource struct {
+	byAddress map[uint64]Instruction
+}
+
+// NewTraceSource returns a source replaying trace, a recorded or
+// hand-written stream of instructions with their Address set. Fetching an
+// address the trace does not hold finds nothing; where the trace holds an
+// address more than once, the first instruction is replayed.
+func NewTraceSource(trace []Instruction) InstructionSource {
+	s := &traceSource{byAddress: make(map[uint64]Instruction, len(trace))}
+	for _, inst := range trace {
+		if _, ok := s.byAddress[inst.Address]; !ok {
+			s.byAddress[inst.Address] = inst
+		}
+	}
+	return s
+}
+
+// Next returns a copy of the trace's instruction at pc
+func (s *traceSource) Next(pc uint64) (*Instruction, bool) {
+	inst, ok := s.byAddress[pc]
+	if !ok {
+		return nil, false
+	}
+	inst.Operands = append([]uint8(nil), inst.Operands...)
+	return &inst, true
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/jasonKoogler/cpu-sim/internal/config"
+	"github.com/jasonKoogler/cpu-sim/internal/workload"
+)
+
+// recordingSource serves ADDs of a fixed length and records the pcs asked for
+type recordingSource struct {
+	length int
+	limit  int // instructions served before running dry
+	pcs    []uint64
+}
+
+func (s *recordingSource) Next(pc uint64) (*Instruction, bool) {
+	if len(s.pcs) == s.limit {
+		return nil, false
+	}
+	s.pcs = append(s.pcs, pc)
+	return &Instruction{Opcode: uint8(OpADD), Operands: []uint8{1, 2, 3}, Type: "Integer", Length: s.length}, true
+}
+
+func TestSetInstructionSource(t *testing.T) {
+	proc, _ := NewProcessor(0, config.DefaultConfig())
+	src := &recordingSource{length: 8, limit: 5}
+	proc.SetInstructionSource(src)
+
+	for i := 0; i < 100; i++ {
+		proc.Cycle()
+	}
+
+	// Fetch walks the pc by each instruction's length until the source runs dry
+	if want := []uint64{0, 8, 16, 24, 32}; !reflect.DeepEqual(src.pcs, want) {
+		t.Errorf("Source asked for pcs %v, want %v", src.pcs, want)
+	}
+	if got := proc.GetExecutedInstructions(); got != 5 {
+		t.Errorf("Executed %d instructions, want 5", got)
+	}
+
+	// nil brings back the synthetic generator, which never runs dry
+	proc.SetInstructionSource(nil)
+	for i := 0; i < 100; i++ {
+		proc.Cycle()
+	}
+	if got := proc.GetExecutedInstructions(); got <= 5 {
+		t.Errorf("Executed %d instructions after restoring the synthetic source, want more than 5", got)
+	}
+}
+
+func TestTraceSource(t *testing.T) {
+	trace := []Instruction{
+		{Address: 0x0, Opcode: uint8(OpADD), Operands: []uint8{1, 2, 3}, Type: "Integer"},
+		{Address: 0x4, Opcode: 0x70, Operands: []uint8{0, 2, 3}, Type: "Branch", Target: 0x40},
+		{Address: 0x8, Opcode: 0x40, Operands: []uint8{1, 2, 3}, Type: "Float", Length: 6},
+		{Address: 0x0, Opcode: 0x60, Operands: []uint8{4, 0, 8}, Type: "Memory"}, // shadowed by the first
+	}
+	src := NewTraceSource(trace)
+
+	for _, want := range trace[:3] {
+		got, ok := src.Next(want.Address)
+		if !ok {
+			t.Fatalf("Next(%#x) found nothing", want.Address)
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("Next(%#x) = %+v, want %+v", want.Address, *got, want)
+		}
+	}
+
+	// Callers may change what they are given without changing the trace
+	inst, _ := src.Next(0x0)
+	inst.Operands[0] = 9
+	if again, _ := src.Next(0x0); again.Operands[0] != 1 {
+		t.Errorf("Next() after changing an earlier result = %v, want the recorded operands", again.Operands)
+	}
+
+	if inst, ok := src.Next(0x20); ok {
+		t.Errorf("Next() at an address missing from the trace = %+v, want nothing", inst)
+	}
+}
+
+func TestWorkloadSource(t *testing.T) {
+	src := NewWorkloadSource([]workload.Instruction{
+		{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 1},
+		{Opcode: 0x70, Src1: 2, Src2: 3, Dest: 0xFF}, // BEQ back one instruction
+	})
+
+	inst, ok := src.Next(workload.InstructionSize)
+	if !ok || inst.Type != "Branch" || inst.Target != 0 {
+		t.Errorf("Next() of a backward branch = %+v, %v, want a branch to 0", inst, ok)
+	}
+
+	if inst, ok := src.Next(2 * workload.InstructionSize); ok {
+		t.Errorf("Next() past the end = %+v, want nothing", inst)
+	}
+}
+
+func TestSyntheticSource(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MixInteger, cfg.MixBranch = 50, 50
+
+	// The same seed generates the same stream
+	a := NewSyntheticSource(cfg, rand.New(rand.NewSource(1)))
+	b := NewSyntheticSource(cfg, rand.New(rand.NewSource(1)))
+	for pc := uint64(0); pc < 400; pc += 4 {
+		x, _ := a.Next(pc)
+		y, _ := b.Next(pc)
+		if !reflect.DeepEqual(x, y) {
+			t.Fatalf("Next(%#x) = %+v and %+v from the same seed", pc, x, y)
+		}
+		if x.Type == "Branch" && x.Target != pc+syntheticBranchOffset {
+			t.Errorf("Branch at %#x targets %#x, want %#x", pc, x.Target, pc+syntheticBranchOffset)
+		}
+	}
+}
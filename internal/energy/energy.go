@@ -0,0 +1,64 @@
+package energy
+
+import "github.com/jasonKoogler/cpu-sim/internal/config"
+
+// Counters are the activity counts of a run the energy is estimated from
+type Counters struct {
+	Cycles         int64            // cycles simulated
+	RetiredByType  map[string]int64 // retired instructions by type across all cores
+	CacheAccesses  [3]int64         // accesses to L1, L2 and L3 across all cores
+	MemoryAccesses int64            // lines read from or written to memory across all cores
+	StageCycles    int64            // cycles counted for each pipeline stage, summed over every stage of every core
+	GatedCycles    int64            // those of StageCycles the stage spent power-gated
+}
+
+// EnergyResult is the estimated energy of a run, in nanojoules, and the
+// average power it implies, in milliwatts
+type EnergyResult struct {
+	Instructions float64 // dynamic energy of the retired instructions
+	Caches       float64 // dynamic energy of the cache accesses
+	Memory       float64 // dynamic energy of the memory accesses
+	Leakage      float64 // static energy of every core over the simulated time, less that saved by power-gating
+	Total        float64
+	AveragePower float64 // Total over the simulated time
+}
+
+// Estimate applies the configured energy coefficients to the counters. Types
+// other than Float, Memory and Branch are charged as integer instructions.
+// A core's leakage is spread evenly over its pipeline stages, and a stage
+// leaks nothing while power-gated.
+func Estimate(cfg *config.Config, c Counters) EnergyResult {
+	perType := map[string]float64{
+		"Float":  cfg.EnergyFloat,
+		"Memory": cfg.EnergyMemory,
+		"Branch": cfg.EnergyBranch,
+	}
+
+	var result EnergyResult
+	for instType, n := range c.RetiredByType {
+		perInst, ok := perType[instType]
+		if !ok {
+			perInst = cfg.EnergyInteger
+		}
+		result.Instructions += perInst * float64(n) / 1000
+	}
+
+	for i, perAccess := range []float64{cfg.EnergyL1, cfg.EnergyL2, cfg.EnergyL3} {
+		result.Caches += perAccess * float64(c.CacheAccesses[i]) / 1000
+	}
+	result.Memory = cfg.EnergyDRAM * float64(c.MemoryAccesses) / 1000
+
+	// mW for cycles/MHz microseconds is nJ
+	micros := float64(c.Cycles) / float64(cfg.ClockFrequency)
+	result.Leakage = cfg.LeakagePower * float64(cfg.NumCores) * micros
+	if c.StageCycles > 0 {
+		result.Leakage *= 1 - float64(c.GatedCycles)/float64(c.StageCycles)
+	}
+
+	result.Total = result.Instructions + result.Caches + result.Memory + result.Leakage
+	if micros > 0 {
+		result.AveragePower = result.Total / micros
+	}
+
+	return result
+}
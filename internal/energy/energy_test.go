@@ -0,0 +1,88 @@
+package energy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jasonKoogler/cpu-sim/internal/config"
+)
+
+func TestEstimate(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 2
+	cfg.ClockFrequency = 1000 // 1000 cycles per microsecond
+
+	counters := Counters{
+		Cycles: 1000,
+		RetiredByType: map[string]int64{
+			"Integer": 100,
+			"Float":   10,
+			"Memory":  20,
+			"Branch":  5,
+			"Other":   10, // charged as integer
+		},
+		CacheAccesses:  [3]int64{100, 10, 2},
+		MemoryAccesses: 1,
+	}
+
+	got := Estimate(cfg, counters)
+	want := EnergyResult{
+		Instructions: (110*5 + 10*15 + 20*8 + 5*4) / 1000.0,
+		Caches:       (100*10 + 10*40 + 2*150) / 1000.0,
+		Memory:       2000 / 1000.0,
+		Leakage:      100 * 2 * 1.0,
+	}
+	want.Total = want.Instructions + want.Caches + want.Memory + want.Leakage
+	want.AveragePower = want.Total / 1.0
+
+	checks := []struct {
+		name      string
+		got, want float64
+	}{
+		{"Instructions", got.Instructions, want.Instructions},
+		{"Caches", got.Caches, want.Caches},
+		{"Memory", got.Memory, want.Memory},
+		{"Leakage", got.Leakage, want.Leakage},
+		{"Total", got.Total, want.Total},
+		{"AveragePower", got.AveragePower, want.AveragePower},
+	}
+	for _, c := range checks {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("Estimate() %s = %f, want %f", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestEstimate_Scaling(t *testing.T) {
+	cfg := config.DefaultConfig()
+	counters := Counters{Cycles: 10000}
+	base := Estimate(cfg, counters)
+
+	// Leakage grows with the core count and shrinks with a faster clock
+	more := cfg.Clone()
+	more.NumCores = cfg.NumCores * 2
+	if got := Estimate(more, counters).Leakage; math.Abs(got-2*base.Leakage) > 1e-9 {
+		t.Errorf("Leakage with %d cores = %f, want %f", more.NumCores, got, 2*base.Leakage)
+	}
+
+	faster := cfg.Clone()
+	faster.ClockFrequency = cfg.ClockFrequency * 2
+	if got := Estimate(faster, counters).Leakage; math.Abs(got-base.Leakage/2) > 1e-9 {
+		t.Errorf("Leakage at %d MHz = %f, want %f", faster.ClockFrequency, got, base.Leakage/2)
+	}
+
+	// Static power does not depend on how long the run was
+	if got := Estimate(cfg, Counters{Cycles: 20000}).AveragePower; math.Abs(got-base.AveragePower) > 1e-9 {
+		t.Errorf("AveragePower over twice the cycles = %f, want %f", got, base.AveragePower)
+	}
+
+	// Stages gated for a quarter of their cycles save a quarter of it
+	gated := Estimate(cfg, Counters{Cycles: 10000, StageCycles: 200000, GatedCycles: 50000})
+	if math.Abs(gated.Leakage-0.75*base.Leakage) > 1e-9 {
+		t.Errorf("Leakage with a quarter of stage cycles gated = %f, want %f", gated.Leakage, 0.75*base.Leakage)
+	}
+
+	if got := Estimate(cfg, Counters{}); got.Total != 0 || got.AveragePower != 0 {
+		t.Errorf("Estimate() with no activity = %+v, want zero", got)
+	}
+}
@@ -0,0 +1,477 @@
+package interconnect
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Interconnect topologies
+const (
+	Bus      = "bus"      // one link shared by every node, transfers serialize
+	Ring     = "ring"     // a link each way between neighbours, shortest direction wins
+	Crossbar = "crossbar" // a port per node each way, transfers between distinct pairs overlap
+	Mesh     = "mesh"     // cores on a 2D grid with links each way between neighbours, routed X then Y
+	Torus    = "torus"    // a mesh whose rows and columns wrap around
+)
+
+// Switch stands for the far end of a link that does not join two nodes:
+// the shared bus, or the switch behind a crossbar port
+const Switch = -1
+
+// ControlSize is the size in bytes of a coherence request or invalidation
+const ControlSize = 8
+
+// link is a single point-to-point or shared connection
+type link struct {
+	from, to   int   // nodes the link carries transfers between, or Switch
+	freeAt     int64 // first cycle the link can start a new transfer
+	busyCycles int64 // cycles spent carrying transfers
+}
+
+// Interconnect carries cache fills and coherence traffic between the cores
+// and memory. Nodes 0..numCores-1 are the cores and MemoryNode is memory. A
+// transfer holds every link on its route for as many cycles as its bytes
+// take at the configured bandwidth, waiting first for all of them to free up.
+//
+// On a ring, mesh or torus a transfer also pays a fixed latency for each
+// link it crosses, so the distance between nodes matters. Mesh and torus
+// cores are laid out row by row, and memory hangs off core 0's corner by a
+// link of its own each way.
+//
+// Transfers are timed by the caller's cycle, so contention is only exact
+// when cores advance in lockstep.
+type Interconnect struct {
+	topology      string
+	numNodes      int
+	bytesPerCycle float64
+	hopLatency    int // cycles per link crossed on multi-hop topologies
+	cols          int // grid width of a mesh or torus
+	rows          int
+	links         []link
+	gridLinks     map[[2]int]int // mesh or torus link index by the nodes it joins
+	transfers     int64
+	bytes         int64
+	hops          int64 // links crossed by all transfers, a switch counting as one
+	latency       int64 // cycles from sending each transfer to its arrival
+	mutex         sync.Mutex
+}
+
+// New creates an interconnect of the given topology joining numCores cores
+// and memory. bandwidth is per link in GB/s and clockFrequency in MHz. A
+// mesh or torus lays the cores out on the squarest grid they fill; use
+// NewGrid for another shape.
+func New(topology string, numCores, bandwidth, clockFrequency int) (*Interconnect, error) {
+	if numCores <= 0 {
+		return nil, fmt.Errorf("number of cores must be positive")
+	}
+
+	rows := int(math.Sqrt(float64(numCores)))
+	for numCores%rows != 0 {
+		rows--
+	}
+	return NewGrid(topology, rows, numCores/rows, bandwidth, clockFrequency)
+}
+
+// NewGrid creates an interconnect of the given topology joining rows*cols
+// cores and memory. Only a mesh or torus lays the cores out as a grid.
+func NewGrid(topology string, rows, cols, bandwidth, clockFrequency int) (*Interconnect, error) {
+	if rows <= 0 || cols <= 0 {
+		return nil, fmt.Errorf("number of cores must be positive")
+	}
+
+	if bandwidth <= 0 {
+		return nil, fmt.Errorf("interconnect bandwidth must be positive")
+	}
+
+	if clockFrequency <= 0 {
+		return nil, fmt.Errorf("clock frequency must be positive")
+	}
+
+	ic := &Interconnect{
+		topology:      topology,
+		numNodes:      rows*cols + 1,
+		bytesPerCycle: float64(bandwidth) * 1000 / float64(clockFrequency), // GB/s over MHz
+		rows:          rows,
+		cols:          cols,
+	}
+
+	n := ic.numNodes
+	switch topology {
+	case Bus:
+		ic.links = []link{{from: Switch, to: Switch}}
+	case Ring:
+		// Link i runs clockwise from node i, link n+i counter-clockwise into it
+		ic.links = make([]link, 2*n)
+		for i := 0; i < n; i++ {
+			ic.links[i] = link{from: i, to: (i + 1) % n}
+			ic.links[n+i] = link{from: (i + 1) % n, to: i}
+		}
+	case Crossbar:
+		// Link i is node i's output port, link n+i its input port
+		ic.links = make([]link, 2*n)
+		for i := 0; i < n; i++ {
+			ic.links[i] = link{from: i, to: Switch}
+			ic.links[n+i] = link{from: Switch, to: i}
+		}
+	case Mesh, Torus:
+		ic.buildGrid()
+	default:
+		return nil, fmt.Errorf("unsupported interconnect topology: %s", topology)
+	}
+
+	return ic, nil
+}
+
+// buildGrid adds a link each way between neighbouring grid cores, across
+// the edges too on a torus, and between core 0 and memory
+func (ic *Interconnect) buildGrid() {
+	ic.gridLinks = make(map[[2]int]int)
+	add := func(from, to int) {
+		if _, ok := ic.gridLinks[[2]int{from, to}]; ok || from == to {
+			return // narrow tori wrap back to the same neighbour
+		}
+		ic.gridLinks[[2]int{from, to}] = len(ic.links)
+		ic.links = append(ic.links, link{from: from, to: to})
+	}
+
+	for node := 0; node < ic.rows*ic.cols; node++ {
+		row, col := node/ic.cols, node%ic.cols
+		if col+1 < ic.cols || ic.topology == Torus {
+			east := row*ic.cols + (col+1)%ic.cols
+			add(node, east)
+			add(east, node)
+		}
+		if row+1 < ic.rows || ic.topology == Torus {
+			south := (row+1)%ic.rows*ic.cols + col
+			add(node, south)
+			add(south, node)
+		}
+	}
+
+	add(0, ic.MemoryNode())
+	add(ic.MemoryNode(), 0)
+}
+
+// MemoryNode returns the node number of main memory
+func (ic *Interconnect) MemoryNode() int {
+	return ic.numNodes - 1
+}
+
+// SetHopLatency sets the cycles a ring, mesh or torus transfer spends on
+// each link it crosses, on top of the time its bytes take; 0 charges only
+// the latter. Bus and crossbar transfers are a single hop and pay none.
+func (ic *Interconnect) SetHopLatency(cycles int) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	ic.hopLatency = cycles
+}
+
+// Transfer sends size bytes from node src to node dst, starting no earlier
+// than cycle, and returns the cycles until it arrives
+func (ic *Interconnect) Transfer(src, dst, size int, cycle int64) int {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	return ic.transfer(src, dst, size, cycle)
+}
+
+// Snoop sends a coherence request of ControlSize bytes from node src to
+// each node in dsts, the cores holding a copy of the line, or to memory if
+// there are none, and returns the cycles until the last one arrives. A bus
+// broadcasts the request once, reaching every node together.
+func (ic *Interconnect) Snoop(src int, dsts []int, cycle int64) int {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	if len(dsts) == 0 || ic.topology == Bus {
+		return ic.transfer(src, ic.numNodes-1, ControlSize, cycle)
+	}
+
+	latency := 0
+	for _, dst := range dsts {
+		latency = max(latency, ic.transfer(src, dst, ControlSize, cycle))
+	}
+	return latency
+}
+
+// transfer is Transfer with the mutex held
+func (ic *Interconnect) transfer(src, dst, size int, cycle int64) int {
+	if src == dst || size <= 0 {
+		return 0
+	}
+
+	route := ic.route(src, dst)
+	start := cycle
+	for _, l := range route {
+		if ic.links[l].freeAt > start {
+			start = ic.links[l].freeAt
+		}
+	}
+
+	occupancy := int64(math.Ceil(float64(size) / ic.bytesPerCycle))
+	for _, l := range route {
+		ic.links[l].freeAt = start + occupancy
+		ic.links[l].busyCycles += occupancy
+	}
+
+	// Links are held while the bytes go onto the wire; hops add flight time
+	arrival := start + occupancy
+	hops := 1
+	if ic.topology != Bus && ic.topology != Crossbar {
+		hops = len(route)
+		arrival += int64(hops * ic.hopLatency)
+	}
+
+	ic.transfers++
+	ic.bytes += int64(size)
+	ic.hops += int64(hops)
+	ic.latency += arrival - cycle
+
+	return int(arrival - cycle)
+}
+
+// route returns the links a transfer from src to dst occupies
+func (ic *Interconnect) route(src, dst int) []int {
+	n := ic.numNodes
+	switch ic.topology {
+	case Ring:
+		clockwise := (dst - src + n) % n
+		if clockwise <= n-clockwise {
+			route := make([]int, 0, clockwise)
+			for node := src; node != dst; node = (node + 1) % n {
+				route = append(route, node)
+			}
+			return route
+		}
+
+		route := make([]int, 0, n-clockwise)
+		for node := src; node != dst; node = (node - 1 + n) % n {
+			route = append(route, n+(node-1+n)%n)
+		}
+		return route
+	case Crossbar:
+		return []int{src, n + dst}
+	case Mesh, Torus:
+		return ic.gridRoute(src, dst)
+	default:
+		return []int{0}
+	}
+}
+
+// gridRoute returns the links from src to dst on a mesh or torus, going
+// along the row first and then the column, the short way round on a torus.
+// Memory traffic enters and leaves the grid at core 0.
+func (ic *Interconnect) gridRoute(src, dst int) []int {
+	var route []int
+	mem := ic.MemoryNode()
+	from, to := src, dst
+	if src == mem {
+		route = append(route, ic.gridLinks[[2]int{mem, 0}])
+		from = 0
+	}
+	if dst == mem {
+		to = 0
+	}
+
+	row, col := from/ic.cols, from%ic.cols
+	for col != to%ic.cols {
+		next := ic.gridStep(col, to%ic.cols, ic.cols)
+		route = append(route, ic.gridLinks[[2]int{row*ic.cols + col, row*ic.cols + next}])
+		col = next
+	}
+	for row != to/ic.cols {
+		next := ic.gridStep(row, to/ic.cols, ic.rows)
+		route = append(route, ic.gridLinks[[2]int{row*ic.cols + col, next*ic.cols + col}])
+		row = next
+	}
+
+	if dst == mem {
+		route = append(route, ic.gridLinks[[2]int{0, mem}])
+	}
+	return route
+}
+
+// gridStep returns the next position from pos towards target along a grid
+// dimension of the given size
+func (ic *Interconnect) gridStep(pos, target, size int) int {
+	if ic.topology == Torus {
+		if forward := (target - pos + size) % size; forward <= size-forward {
+			return (pos + 1) % size
+		}
+		return (pos - 1 + size) % size
+	}
+
+	if target > pos {
+		return pos + 1
+	}
+	return pos - 1
+}
+
+// Utilization returns the fraction of link cycles spent carrying transfers
+// over a run of cycles, averaged over every link
+func (ic *Interconnect) Utilization(cycles int64) float64 {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	if cycles <= 0 {
+		return 0
+	}
+
+	busy := int64(0)
+	for _, l := range ic.links {
+		busy += min(l.busyCycles, cycles)
+	}
+	return float64(busy) / float64(cycles*int64(len(ic.links)))
+}
+
+// Backlog returns how many links are still carrying transfers at cycle and
+// the cycle the last of them frees up
+func (ic *Interconnect) Backlog(cycle int64) (links int, freeAt int64) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	for _, l := range ic.links {
+		if l.freeAt > cycle {
+			links++
+			freeAt = max(freeAt, l.freeAt)
+		}
+	}
+	return links, freeAt
+}
+
+// Transfers returns the number of transfers carried and their total size in bytes
+func (ic *Interconnect) Transfers() (transfers, bytes int64) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	return ic.transfers, ic.bytes
+}
+
+// LinkStat is one link's share of the cycles spent carrying transfers
+type LinkStat struct {
+	From        int     `json:"from"` // node, or Switch
+	To          int     `json:"to"`   // node, or Switch
+	Utilization float64 `json:"utilization"`
+}
+
+// LinkUtilization returns the fraction of a run of cycles each link spent
+// carrying transfers
+func (ic *Interconnect) LinkUtilization(cycles int64) []LinkStat {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	stats := make([]LinkStat, len(ic.links))
+	for i, l := range ic.links {
+		stats[i] = LinkStat{From: l.from, To: l.to}
+		if cycles > 0 {
+			stats[i].Utilization = float64(min(l.busyCycles, cycles)) / float64(cycles)
+		}
+	}
+	return stats
+}
+
+// AverageHops returns the mean number of links transfers crossed, counting
+// a bus or a crossbar's switch as one
+func (ic *Interconnect) AverageHops() float64 {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	if ic.transfers == 0 {
+		return 0
+	}
+	return float64(ic.hops) / float64(ic.transfers)
+}
+
+// AverageLatency returns the mean cycles from sending a transfer to its
+// arrival, including time spent waiting for busy links
+func (ic *Interconnect) AverageLatency() float64 {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	if ic.transfers == 0 {
+		return 0
+	}
+	return float64(ic.latency) / float64(ic.transfers)
+}
+
+// Reset frees every link and zeroes the counters
+func (ic *Interconnect) Reset() {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	for i := range ic.links {
+		ic.links[i].freeAt, ic.links[i].busyCycles = 0, 0
+	}
+	ic.transfers = 0
+	ic.bytes = 0
+	ic.hops = 0
+	ic.latency = 0
+}
+
+// ResetStats zeroes the counters for cores whose cycle counts restart from
+// zero after elapsed cycles. Links stay busy with transfers in flight.
+func (ic *Interconnect) ResetStats(elapsed int64) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	for i := range ic.links {
+		ic.links[i].freeAt = max(ic.links[i].freeAt-elapsed, 0)
+		ic.links[i].busyCycles = 0
+	}
+	ic.transfers = 0
+	ic.bytes = 0
+	ic.hops = 0
+	ic.latency = 0
+}
+
+// Snapshot is a copy of the link occupancy and counters, for checkpointing
+type Snapshot struct {
+	LinkFreeAt     []int64
+	LinkBusyCycles []int64
+	Transfers      int64
+	Bytes          int64
+	Hops           int64
+	Latency        int64
+}
+
+// Snapshot returns a copy of the interconnect's state
+func (ic *Interconnect) Snapshot() Snapshot {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	snap := Snapshot{
+		LinkFreeAt:     make([]int64, len(ic.links)),
+		LinkBusyCycles: make([]int64, len(ic.links)),
+		Transfers:      ic.transfers,
+		Bytes:          ic.bytes,
+		Hops:           ic.hops,
+		Latency:        ic.latency,
+	}
+	for i, l := range ic.links {
+		snap.LinkFreeAt[i] = l.freeAt
+		snap.LinkBusyCycles[i] = l.busyCycles
+	}
+	return snap
+}
+
+// Restore replaces the interconnect's state with snap, which must come from
+// an interconnect of the same topology and size
+func (ic *Interconnect) Restore(snap Snapshot) error {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	if len(snap.LinkFreeAt) != len(ic.links) || len(snap.LinkBusyCycles) != len(ic.links) {
+		return fmt.Errorf("snapshot has %d links, interconnect has %d", len(snap.LinkFreeAt), len(ic.links))
+	}
+
+	for i := range ic.links {
+		ic.links[i].freeAt, ic.links[i].busyCycles = snap.LinkFreeAt[i], snap.LinkBusyCycles[i]
+	}
+	ic.transfers = snap.Transfers
+	ic.bytes = snap.Bytes
+	ic.hops = snap.Hops
+	ic.latency = snap.Latency
+	return nil
+}
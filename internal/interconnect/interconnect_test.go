@@ -0,0 +1,302 @@
+package interconnect
+
+import (
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		topology  string
+		numCores  int
+		bandwidth int
+		wantErr   bool
+	}{
+		{name: "Bus", topology: Bus, numCores: 4, bandwidth: 64, wantErr: false},
+		{name: "Ring", topology: Ring, numCores: 4, bandwidth: 64, wantErr: false},
+		{name: "Crossbar", topology: Crossbar, numCores: 4, bandwidth: 64, wantErr: false},
+		{name: "Mesh", topology: Mesh, numCores: 6, bandwidth: 64, wantErr: false},
+		{name: "Torus", topology: Torus, numCores: 7, bandwidth: 64, wantErr: false},
+		{name: "Unsupported topology", topology: "hypercube", numCores: 4, bandwidth: 64, wantErr: true},
+		{name: "Zero cores", topology: Bus, numCores: 0, bandwidth: 64, wantErr: true},
+		{name: "Zero bandwidth", topology: Bus, numCores: 4, bandwidth: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.topology, tt.numCores, tt.bandwidth, 1000)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTransferContention(t *testing.T) {
+	// 64 GB/s at 1 GHz moves a 64-byte line in one cycle. With four cores,
+	// memory is node 4.
+	type transfer struct{ src, dst int }
+
+	tests := []struct {
+		name        string
+		topology    string
+		first       transfer
+		second      transfer
+		wantLatency int // of the second transfer, issued in the same cycle
+	}{
+		{name: "Bus serializes unrelated transfers", topology: Bus, first: transfer{0, 1}, second: transfer{2, 3}, wantLatency: 2},
+		{name: "Crossbar overlaps distinct pairs", topology: Crossbar, first: transfer{0, 1}, second: transfer{2, 3}, wantLatency: 1},
+		{name: "Crossbar serializes a shared destination", topology: Crossbar, first: transfer{0, 4}, second: transfer{1, 4}, wantLatency: 2},
+		{name: "Ring overlaps disjoint routes", topology: Ring, first: transfer{0, 1}, second: transfer{2, 3}, wantLatency: 1},
+		{name: "Ring serializes a shared link", topology: Ring, first: transfer{0, 1}, second: transfer{0, 2}, wantLatency: 2},
+		{name: "Ring uses both directions", topology: Ring, first: transfer{0, 4}, second: transfer{0, 1}, wantLatency: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic, err := New(tt.topology, 4, 64, 1000)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if got := ic.Transfer(tt.first.src, tt.first.dst, 64, 0); got != 1 {
+				t.Errorf("First transfer latency = %d, want 1", got)
+			}
+
+			if got := ic.Transfer(tt.second.src, tt.second.dst, 64, 0); got != tt.wantLatency {
+				t.Errorf("Second transfer latency = %d, want %d", got, tt.wantLatency)
+			}
+		})
+	}
+}
+
+func TestUtilization(t *testing.T) {
+	ic, err := New(Bus, 2, 64, 1000)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// A 128-byte transfer holds the bus for two cycles
+	if got := ic.Transfer(ic.MemoryNode(), 0, 128, 0); got != 2 {
+		t.Errorf("Transfer() latency = %d, want 2", got)
+	}
+
+	if got := ic.Utilization(4); got != 0.5 {
+		t.Errorf("Utilization(4) = %.2f, want 0.50", got)
+	}
+
+	if transfers, bytes := ic.Transfers(); transfers != 1 || bytes != 128 {
+		t.Errorf("Transfers() = %d, %d bytes, want 1, 128 bytes", transfers, bytes)
+	}
+
+	ic.Reset()
+	if got := ic.Utilization(4); got != 0 {
+		t.Errorf("Utilization() after Reset() = %.2f, want 0", got)
+	}
+
+	// The bus is free again straight after Reset
+	if got := ic.Transfer(0, 1, 64, 0); got != 1 {
+		t.Errorf("Transfer() latency after Reset() = %d, want 1", got)
+	}
+}
+
+func TestResetStats(t *testing.T) {
+	ic, err := New(Bus, 2, 64, 1000)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Busy from cycle 100 to 104, then the cycle count restarts after 102
+	ic.Transfer(ic.MemoryNode(), 0, 256, 100)
+	ic.ResetStats(102)
+
+	if transfers, bytes := ic.Transfers(); transfers != 0 || bytes != 0 {
+		t.Errorf("Transfers() after ResetStats() = %d, %d bytes, want 0, 0 bytes", transfers, bytes)
+	}
+	if got := ic.Utilization(4); got != 0 {
+		t.Errorf("Utilization() after ResetStats() = %.2f, want 0", got)
+	}
+
+	// The transfer in flight still holds the bus for two more cycles
+	if got := ic.Transfer(0, 1, 64, 0); got != 3 {
+		t.Errorf("Transfer() latency after ResetStats() = %d, want 3", got)
+	}
+}
+
+func TestHopLatency(t *testing.T) {
+	// With four cores the ring has five nodes, memory being node 4
+	tests := []struct {
+		name        string
+		topology    string
+		src, dst    int
+		wantLatency int
+	}{
+		{name: "Ring neighbours", topology: Ring, src: 0, dst: 1, wantLatency: 1 + 2},
+		{name: "Ring two hops clockwise", topology: Ring, src: 0, dst: 2, wantLatency: 1 + 4},
+		{name: "Ring two hops counter-clockwise", topology: Ring, src: 0, dst: 3, wantLatency: 1 + 4},
+		{name: "Ring wraps to memory", topology: Ring, src: 0, dst: 4, wantLatency: 1 + 2},
+		{name: "Bus is a single hop", topology: Bus, src: 0, dst: 2, wantLatency: 1},
+		{name: "Crossbar is a single hop", topology: Crossbar, src: 0, dst: 2, wantLatency: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic, err := New(tt.topology, 4, 64, 1000)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			ic.SetHopLatency(2)
+
+			if got := ic.Transfer(tt.src, tt.dst, 64, 0); got != tt.wantLatency {
+				t.Errorf("Transfer() latency = %d, want %d", got, tt.wantLatency)
+			}
+		})
+	}
+}
+
+func TestSnoop(t *testing.T) {
+	tests := []struct {
+		name          string
+		topology      string
+		dsts          []int
+		wantLatency   int
+		wantTransfers int64
+	}{
+		{name: "Ring asks memory when no core holds the line", topology: Ring, dsts: nil, wantLatency: 1 + 1, wantTransfers: 1},
+		{name: "Ring waits for the farthest sharer", topology: Ring, dsts: []int{1, 3}, wantLatency: 1 + 2, wantTransfers: 2},
+		{name: "Bus broadcasts once", topology: Bus, dsts: []int{1, 2, 3}, wantLatency: 1, wantTransfers: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic, err := New(tt.topology, 4, 64, 1000)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			ic.SetHopLatency(1)
+
+			if got := ic.Snoop(0, tt.dsts, 0); got != tt.wantLatency {
+				t.Errorf("Snoop() latency = %d, want %d", got, tt.wantLatency)
+			}
+			if transfers, _ := ic.Transfers(); transfers != tt.wantTransfers {
+				t.Errorf("Snoop() sent %d transfers, want %d", transfers, tt.wantTransfers)
+			}
+		})
+	}
+}
+
+func TestAverageLatency(t *testing.T) {
+	ic, err := New(Ring, 4, 64, 1000)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ic.SetHopLatency(1)
+
+	if got := ic.AverageLatency(); got != 0 {
+		t.Errorf("AverageLatency() before any transfer = %.2f, want 0", got)
+	}
+
+	// One hop takes 2 cycles and two hops 3
+	ic.Transfer(0, 1, 64, 0)
+	ic.Transfer(2, 4, 64, 0)
+	if got := ic.AverageLatency(); got != 2.5 {
+		t.Errorf("AverageLatency() = %.2f, want 2.50", got)
+	}
+
+	snap := ic.Snapshot()
+	ic.ResetStats(0)
+	if got := ic.AverageLatency(); got != 0 {
+		t.Errorf("AverageLatency() after ResetStats() = %.2f, want 0", got)
+	}
+
+	if err := ic.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got := ic.AverageLatency(); got != 2.5 {
+		t.Errorf("AverageLatency() after Restore() = %.2f, want 2.50", got)
+	}
+}
+
+func TestGridRouting(t *testing.T) {
+	// A 3x3 grid of cores numbered row by row, memory being node 9 off core 0
+	tests := []struct {
+		name     string
+		topology string
+		src, dst int
+		wantHops int
+	}{
+		{name: "Mesh neighbours", topology: Mesh, src: 0, dst: 1, wantHops: 1},
+		{name: "Mesh across the grid", topology: Mesh, src: 0, dst: 8, wantHops: 4},
+		{name: "Mesh to memory", topology: Mesh, src: 8, dst: 9, wantHops: 5},
+		{name: "Mesh from memory", topology: Mesh, src: 9, dst: 4, wantHops: 3},
+		{name: "Torus wraps the row", topology: Torus, src: 0, dst: 2, wantHops: 1},
+		{name: "Torus across the grid", topology: Torus, src: 0, dst: 8, wantHops: 2},
+		{name: "Torus to memory", topology: Torus, src: 8, dst: 9, wantHops: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic, err := NewGrid(tt.topology, 3, 3, 64, 1000)
+			if err != nil {
+				t.Fatalf("NewGrid() error = %v", err)
+			}
+			ic.SetHopLatency(1)
+
+			if got := ic.Transfer(tt.src, tt.dst, 64, 0); got != 1+tt.wantHops {
+				t.Errorf("Transfer() latency = %d, want %d", got, 1+tt.wantHops)
+			}
+			if got := ic.AverageHops(); got != float64(tt.wantHops) {
+				t.Errorf("AverageHops() = %.2f, want %d", got, tt.wantHops)
+			}
+		})
+	}
+}
+
+func TestLinkUtilization(t *testing.T) {
+	tests := []struct {
+		name      string
+		topology  string
+		rows      int
+		cols      int
+		wantLinks int
+	}{
+		{name: "Bus", topology: Bus, rows: 1, cols: 4, wantLinks: 1},
+		{name: "Ring", topology: Ring, rows: 1, cols: 4, wantLinks: 10},
+		{name: "Mesh", topology: Mesh, rows: 2, cols: 3, wantLinks: 14 + 2},
+		{name: "Torus", topology: Torus, rows: 3, cols: 3, wantLinks: 36 + 2},
+		{name: "Narrow torus wraps to the same neighbours", topology: Torus, rows: 2, cols: 2, wantLinks: 8 + 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic, err := NewGrid(tt.topology, tt.rows, tt.cols, 64, 1000)
+			if err != nil {
+				t.Fatalf("NewGrid() error = %v", err)
+			}
+
+			// Memory to core 0 is a single link on every topology but the crossbar
+			ic.Transfer(ic.MemoryNode(), 0, 128, 0)
+			stats := ic.LinkUtilization(4)
+			if len(stats) != tt.wantLinks {
+				t.Fatalf("LinkUtilization() has %d links, want %d", len(stats), tt.wantLinks)
+			}
+
+			busy := 0
+			for _, link := range stats {
+				if link.Utilization == 0 {
+					continue
+				}
+				busy++
+				if link.Utilization != 0.5 {
+					t.Errorf("Link %d->%d utilization = %.2f, want 0.50", link.From, link.To, link.Utilization)
+				}
+				if tt.topology != Bus && (link.From != ic.MemoryNode() || link.To != 0) {
+					t.Errorf("Link %d->%d busy, want only %d->0", link.From, link.To, ic.MemoryNode())
+				}
+			}
+			if busy != 1 {
+				t.Errorf("%d links busy, want 1", busy)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+)
+
+// DRAMStats counts how the accesses reaching DRAM found their bank's row
+// buffer
+type DRAMStats struct {
+	RowHits      int64 // accesses to the row already open
+	RowMisses    int64 // accesses to a bank with no row open
+	RowConflicts int64 // accesses that closed another row to open theirs
+}
+
+// RowHitRate returns the fraction of accesses served from an open row, or
+// 0 if DRAM was never accessed
+func (s DRAMStats) RowHitRate() float64 {
+	total := s.RowHits + s.RowMisses + s.RowConflicts
+	if total == 0 {
+		return 0.0
+	}
+	return float64(s.RowHits) / float64(total)
+}
+
+// DRAM models the banks of main memory, each with a row buffer holding the
+// row last opened in it. An access to the open row is served from the
+// buffer; any other activates its row, precharging the bank first to close
+// the row open before. An address selects its bank with the bits from
+// bankShift up and its row with the bits from rowShift up; the bits below
+// bankShift select a column of the row.
+type DRAM struct {
+	bankShift        uint
+	bankMask         uint64
+	rowShift         uint
+	activateLatency  int
+	prechargeLatency int
+	openRows         []uint64 // row open in each bank, valid where open is set
+	open             []bool
+	stats            DRAMStats
+	mutex            sync.Mutex
+}
+
+// NewDRAM creates banks banks, a power of two, each with its row buffer
+// closed
+func NewDRAM(banks, bankShift, rowShift, activateLatency, prechargeLatency int) (*DRAM, error) {
+	if banks <= 0 || banks&(banks-1) != 0 {
+		return nil, fmt.Errorf("number of DRAM banks must be a positive power of two, got %d", banks)
+	}
+
+	if bankShift < 0 {
+		return nil, fmt.Errorf("DRAM bank shift must not be negative")
+	}
+
+	bankBits := bits.TrailingZeros(uint(banks))
+	if rowShift < bankShift+bankBits || rowShift > 63 {
+		return nil, fmt.Errorf("DRAM row shift %d must be above the %d bank bits from bit %d, and at most 63",
+			rowShift, bankBits, bankShift)
+	}
+
+	if activateLatency < 0 || prechargeLatency < 0 {
+		return nil, fmt.Errorf("DRAM activate and precharge latencies must not be negative")
+	}
+
+	return &DRAM{
+		bankShift:        uint(bankShift),
+		bankMask:         uint64(banks - 1),
+		rowShift:         uint(rowShift),
+		activateLatency:  activateLatency,
+		prechargeLatency: prechargeLatency,
+		openRows:         make([]uint64, banks),
+		open:             make([]bool, banks),
+	}, nil
+}
+
+// Locate returns the bank and row addr maps to
+func (d *DRAM) Locate(addr uint64) (bank int, row uint64) {
+	return int(addr >> d.bankShift & d.bankMask), addr >> d.rowShift
+}
+
+// Access opens the row holding addr in its bank, leaving it open, and
+// returns the cycles the access pays beyond a row buffer hit
+func (d *DRAM) Access(addr uint64) int {
+	bank, row := d.Locate(addr)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	switch {
+	case d.open[bank] && d.openRows[bank] == row:
+		d.stats.RowHits++
+		return 0
+	case d.open[bank]:
+		d.stats.RowConflicts++
+		d.openRows[bank] = row
+		return d.prechargeLatency + d.activateLatency
+	default:
+		d.stats.RowMisses++
+		d.openRows[bank], d.open[bank] = row, true
+		return d.activateLatency
+	}
+}
+
+// Stats returns the row buffer counters
+func (d *DRAM) Stats() DRAMStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.stats
+}
+
+// Reset closes every row and zeroes the counters
+func (d *DRAM) Reset() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	clear(d.openRows)
+	clear(d.open)
+	d.stats = DRAMStats{}
+}
+
+// ResetStats zeroes the counters, leaving the open rows open
+func (d *DRAM) ResetStats() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.stats = DRAMStats{}
+}
+
+// DRAMSnapshot is a copy of the open rows and counters, for checkpointing
+type DRAMSnapshot struct {
+	OpenRows []uint64
+	Open     []bool
+	Stats    DRAMStats
+}
+
+// Snapshot returns a copy of the DRAM state
+func (d *DRAM) Snapshot() DRAMSnapshot {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return DRAMSnapshot{
+		OpenRows: append([]uint64(nil), d.openRows...),
+		Open:     append([]bool(nil), d.open...),
+		Stats:    d.stats,
+	}
+}
+
+// Restore replaces the DRAM state with snap, which must come from DRAM with
+// the same number of banks
+func (d *DRAM) Restore(snap DRAMSnapshot) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(snap.OpenRows) != len(d.openRows) || len(snap.Open) != len(d.open) {
+		return fmt.Errorf("snapshot has %d DRAM banks, memory has %d", len(snap.OpenRows), len(d.openRows))
+	}
+
+	copy(d.openRows, snap.OpenRows)
+	copy(d.open, snap.Open)
+	d.stats = snap.Stats
+	return nil
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewDRAM(t *testing.T) {
+	tests := []struct {
+		name                string
+		banks               int
+		bankShift, rowShift int
+		activate, precharge int
+		wantErr             bool
+	}{
+		{name: "Valid", banks: 8, bankShift: 13, rowShift: 16, activate: 15, precharge: 15, wantErr: false},
+		{name: "Row bits above a gap", banks: 8, bankShift: 6, rowShift: 20, activate: 15, precharge: 15, wantErr: false},
+		{name: "One bank", banks: 1, bankShift: 13, rowShift: 13, activate: 15, precharge: 15, wantErr: false},
+		{name: "Zero banks", banks: 0, bankShift: 13, rowShift: 16, activate: 15, precharge: 15, wantErr: true},
+		{name: "Banks not a power of two", banks: 6, bankShift: 13, rowShift: 16, activate: 15, precharge: 15, wantErr: true},
+		{name: "Negative bank shift", banks: 8, bankShift: -1, rowShift: 16, activate: 15, precharge: 15, wantErr: true},
+		{name: "Row bits overlap bank bits", banks: 8, bankShift: 13, rowShift: 15, activate: 15, precharge: 15, wantErr: true},
+		{name: "Row shift past the address", banks: 8, bankShift: 13, rowShift: 64, activate: 15, precharge: 15, wantErr: true},
+		{name: "Negative activate latency", banks: 8, bankShift: 13, rowShift: 16, activate: -1, precharge: 15, wantErr: true},
+		{name: "Negative precharge latency", banks: 8, bankShift: 13, rowShift: 16, activate: 15, precharge: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDRAM(tt.banks, tt.bankShift, tt.rowShift, tt.activate, tt.precharge)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDRAM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDRAMAccess(t *testing.T) {
+	// 4 banks of 8 KB rows: bits 13-14 pick the bank, bits 15 up the row
+	dram, err := NewDRAM(4, 13, 15, 10, 20)
+	if err != nil {
+		t.Fatalf("NewDRAM() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		addr      uint64
+		wantExtra int
+		wantBank  int
+		wantRow   uint64
+	}{
+		{name: "Closed bank", addr: 0x0000, wantExtra: 10, wantBank: 0, wantRow: 0},
+		{name: "Open row", addr: 0x1fc0, wantExtra: 0, wantBank: 0, wantRow: 0},
+		{name: "Another bank", addr: 0x2000, wantExtra: 10, wantBank: 1, wantRow: 0},
+		{name: "Another row of bank 0", addr: 0x8000, wantExtra: 30, wantBank: 0, wantRow: 1},
+		{name: "Bank 1 row still open", addr: 0x2040, wantExtra: 0, wantBank: 1, wantRow: 0},
+		{name: "Bank 0 row closed again", addr: 0x0040, wantExtra: 30, wantBank: 0, wantRow: 0},
+	}
+
+	for _, tt := range tests {
+		bank, row := dram.Locate(tt.addr)
+		if bank != tt.wantBank || row != tt.wantRow {
+			t.Errorf("%s: Locate(%#x) = bank %d row %d, want bank %d row %d", tt.name, tt.addr, bank, row, tt.wantBank, tt.wantRow)
+		}
+		if got := dram.Access(tt.addr); got != tt.wantExtra {
+			t.Errorf("%s: Access(%#x) = %d, want %d", tt.name, tt.addr, got, tt.wantExtra)
+		}
+	}
+
+	want := DRAMStats{RowHits: 2, RowMisses: 2, RowConflicts: 2}
+	if got := dram.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got := dram.Stats().RowHitRate(); got != 2.0/6.0 {
+		t.Errorf("RowHitRate() = %v, want %v", got, 2.0/6.0)
+	}
+
+	snap := dram.Snapshot()
+	restored, _ := NewDRAM(4, 13, 15, 10, 20)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !reflect.DeepEqual(restored.Snapshot(), snap) {
+		t.Errorf("Snapshot() after Restore() = %+v, want %+v", restored.Snapshot(), snap)
+	}
+	smaller, _ := NewDRAM(2, 13, 15, 10, 20)
+	if err := smaller.Restore(snap); err == nil {
+		t.Errorf("Restore() into DRAM with fewer banks should return error")
+	}
+
+	// Statistics reset keeps the rows open; a full reset closes them
+	dram.ResetStats()
+	if got := dram.Access(0x0000); got != 0 || dram.Stats() != (DRAMStats{RowHits: 1}) {
+		t.Errorf("Access() after ResetStats() = %d with %+v, want an open row hit", got, dram.Stats())
+	}
+	dram.Reset()
+	if got := dram.Access(0x0000); got != 10 || dram.Stats() != (DRAMStats{RowMisses: 1}) {
+		t.Errorf("Access() after Reset() = %d with %+v, want a closed bank", got, dram.Stats())
+	}
+}
+
+func TestDRAMLocality(t *testing.T) {
+	stream, _ := NewDRAM(8, 13, 16, 15, 15)
+	scattered, _ := NewDRAM(8, 13, 16, 15, 15)
+
+	// A line at a time through 1 MB, against lines 1 MB + 64 bytes apart
+	streamCycles, scatteredCycles := 0, 0
+	for i := uint64(0); i < 16384; i++ {
+		streamCycles += stream.Access(i * 64)
+		scatteredCycles += scattered.Access(i * (1<<20 + 64))
+	}
+
+	if s, r := stream.Stats().RowHitRate(), scattered.Stats().RowHitRate(); s <= 0.9 || r != 0 {
+		t.Errorf("Row hit rate streaming = %v, scattered = %v, want above 0.9 and 0", s, r)
+	}
+	if streamCycles >= scatteredCycles {
+		t.Errorf("Streaming cost %d extra cycles, scattered %d, want streaming cheaper", streamCycles, scatteredCycles)
+	}
+}
@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// NUMAPageSize is the granularity at which memory is interleaved across
+// NUMA nodes
+const NUMAPageSize = 4096
+
+// NUMA partitions main memory into nodes. Pages are homed on the nodes in
+// turn; a core reaching memory homed on another node pays a remote penalty.
+type NUMA struct {
+	nodes         int
+	coreNodes     []int   // node of each core
+	remotePenalty int     // extra cycles for a remote access
+	local         []int64 // per core accesses to its own node
+	remote        []int64 // per core accesses to other nodes
+}
+
+// NewNUMA creates nodes memory nodes. coreNodes gives the node of each core.
+func NewNUMA(nodes, remotePenalty int, coreNodes []int) (*NUMA, error) {
+	if nodes <= 0 {
+		return nil, fmt.Errorf("number of NUMA nodes must be positive")
+	}
+
+	if remotePenalty < 0 {
+		return nil, fmt.Errorf("NUMA remote penalty must not be negative")
+	}
+
+	if len(coreNodes) == 0 {
+		return nil, fmt.Errorf("number of cores must be positive")
+	}
+
+	for core, node := range coreNodes {
+		if node < 0 || node >= nodes {
+			return nil, fmt.Errorf("core %d assigned to NUMA node %d, want 0 to %d", core, node, nodes-1)
+		}
+	}
+
+	return &NUMA{
+		nodes:         nodes,
+		coreNodes:     append([]int(nil), coreNodes...),
+		remotePenalty: remotePenalty,
+		local:         make([]int64, len(coreNodes)),
+		remote:        make([]int64, len(coreNodes)),
+	}, nil
+}
+
+// HomeNode returns the node addr is homed on
+func (n *NUMA) HomeNode(addr uint64) int {
+	return int(addr / NUMAPageSize % uint64(n.nodes))
+}
+
+// Access records core reaching memory at addr and returns the cycles it pays
+// beyond the local memory latency
+func (n *NUMA) Access(core int, addr uint64) int {
+	if n.HomeNode(addr) == n.coreNodes[core] {
+		atomic.AddInt64(&n.local[core], 1)
+		return 0
+	}
+
+	atomic.AddInt64(&n.remote[core], 1)
+	return n.remotePenalty
+}
+
+// Accesses returns the memory accesses made to local and remote nodes
+// across all cores
+func (n *NUMA) Accesses() (local, remote int64) {
+	for core := range n.local {
+		local += atomic.LoadInt64(&n.local[core])
+		remote += atomic.LoadInt64(&n.remote[core])
+	}
+	return local, remote
+}
+
+// Reset zeroes the counters
+func (n *NUMA) Reset() {
+	for core := range n.local {
+		atomic.StoreInt64(&n.local[core], 0)
+		atomic.StoreInt64(&n.remote[core], 0)
+	}
+}
+
+// NUMASnapshot is a copy of the NUMA counters, for checkpointing
+type NUMASnapshot struct {
+	Local  []int64
+	Remote []int64
+}
+
+// Snapshot returns a copy of the counters
+func (n *NUMA) Snapshot() NUMASnapshot {
+	snap := NUMASnapshot{
+		Local:  make([]int64, len(n.local)),
+		Remote: make([]int64, len(n.remote)),
+	}
+	for core := range n.local {
+		snap.Local[core] = atomic.LoadInt64(&n.local[core])
+		snap.Remote[core] = atomic.LoadInt64(&n.remote[core])
+	}
+	return snap
+}
+
+// Restore replaces the counters with snap, which must come from memory
+// shared by the same number of cores
+func (n *NUMA) Restore(snap NUMASnapshot) error {
+	if len(snap.Local) != len(n.local) || len(snap.Remote) != len(n.remote) {
+		return fmt.Errorf("snapshot is for %d cores, NUMA memory is shared by %d", len(snap.Local), len(n.local))
+	}
+
+	for core := range n.local {
+		atomic.StoreInt64(&n.local[core], snap.Local[core])
+		atomic.StoreInt64(&n.remote[core], snap.Remote[core])
+	}
+	return nil
+}
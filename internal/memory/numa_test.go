@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewNUMA(t *testing.T) {
+	tests := []struct {
+		name          string
+		nodes         int
+		remotePenalty int
+		coreNodes     []int
+		wantErr       bool
+	}{
+		{name: "Valid", nodes: 2, remotePenalty: 100, coreNodes: []int{0, 1}, wantErr: false},
+		{name: "Zero nodes", nodes: 0, remotePenalty: 100, coreNodes: []int{0}, wantErr: true},
+		{name: "Negative penalty", nodes: 2, remotePenalty: -1, coreNodes: []int{0, 1}, wantErr: true},
+		{name: "No cores", nodes: 2, remotePenalty: 100, coreNodes: nil, wantErr: true},
+		{name: "Core on missing node", nodes: 2, remotePenalty: 100, coreNodes: []int{0, 2}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewNUMA(tt.nodes, tt.remotePenalty, tt.coreNodes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewNUMA() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNUMAAccess(t *testing.T) {
+	numa, err := NewNUMA(2, 50, []int{0, 1})
+	if err != nil {
+		t.Fatalf("NewNUMA() error = %v", err)
+	}
+
+	// Pages alternate between the nodes
+	tests := []struct {
+		core        int
+		addr        uint64
+		wantPenalty int
+	}{
+		{core: 0, addr: 0, wantPenalty: 0},
+		{core: 0, addr: NUMAPageSize - 1, wantPenalty: 0},
+		{core: 0, addr: NUMAPageSize, wantPenalty: 50},
+		{core: 1, addr: NUMAPageSize, wantPenalty: 0},
+		{core: 1, addr: 2 * NUMAPageSize, wantPenalty: 50},
+	}
+
+	for _, tt := range tests {
+		if got := numa.Access(tt.core, tt.addr); got != tt.wantPenalty {
+			t.Errorf("Access(%d, %#x) = %d, want %d", tt.core, tt.addr, got, tt.wantPenalty)
+		}
+	}
+
+	if local, remote := numa.Accesses(); local != 3 || remote != 2 {
+		t.Errorf("Accesses() = %d local, %d remote, want 3 and 2", local, remote)
+	}
+
+	snap := numa.Snapshot()
+	numa.Reset()
+	if local, remote := numa.Accesses(); local != 0 || remote != 0 {
+		t.Errorf("Reset() left %d local, %d remote accesses", local, remote)
+	}
+
+	if err := numa.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !reflect.DeepEqual(numa.Snapshot(), snap) {
+		t.Errorf("Restore() did not restore the counters")
+	}
+
+	if err := numa.Restore(NUMASnapshot{Local: []int64{1}, Remote: []int64{1}}); err == nil {
+		t.Errorf("Restore() of a snapshot for another core count should return error")
+	}
+}
@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MemoryPorts limits how many data accesses all cores together can start in
+// one cycle. Cores that have been refused for longer get first claim on the
+// ports, so no core starves.
+type MemoryPorts struct {
+	ports    int
+	inUse    int     // ports claimed this cycle
+	waits    []int   // per core consecutive cycles refused, up to last cycle
+	refused  []bool  // per core: refused this cycle
+	acquired []bool  // per core: claimed a port this cycle
+	stalls   []int64 // per core accesses refused for want of a port
+	mutex    sync.Mutex
+}
+
+// NewMemoryPorts creates ports memory ports shared by numCores cores
+func NewMemoryPorts(ports, numCores int) (*MemoryPorts, error) {
+	if ports <= 0 {
+		return nil, fmt.Errorf("number of memory ports must be positive")
+	}
+
+	if numCores <= 0 {
+		return nil, fmt.Errorf("number of cores must be positive")
+	}
+
+	return &MemoryPorts{
+		ports:    ports,
+		waits:    make([]int, numCores),
+		refused:  make([]bool, numCores),
+		acquired: make([]bool, numCores),
+		stalls:   make([]int64, numCores),
+	}, nil
+}
+
+// BeginCycle frees every port for a new cycle. It must be called once per
+// cycle before any core calls Acquire.
+func (m *MemoryPorts) BeginCycle() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.inUse = 0
+	for core := range m.waits {
+		if m.refused[core] {
+			m.waits[core]++
+		} else {
+			m.waits[core] = 0
+		}
+		m.refused[core] = false
+		m.acquired[core] = false
+	}
+}
+
+// Acquire claims a port for one of core's accesses this cycle. It returns
+// false, charging the core a stall, if every free port is taken or held for
+// a core that has waited longer. Ties go to the lower core ID.
+func (m *MemoryPorts) Acquire(core int) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	free := m.ports - m.inUse
+	for other, wait := range m.waits {
+		if other == core || m.acquired[other] || wait == 0 {
+			continue
+		}
+
+		if wait > m.waits[core] || (wait == m.waits[core] && other < core) {
+			free-- // held for a core refused before this one
+		}
+	}
+
+	if free <= 0 {
+		m.refused[core] = true
+		m.stalls[core]++
+		return false
+	}
+
+	m.inUse++
+	m.acquired[core] = true
+	return true
+}
+
+// Contended reports whether other cores are pressing on the ports this
+// cycle: one of them has claimed a port, or is waiting for one
+func (m *MemoryPorts) Contended(core int) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for other := range m.waits {
+		if other != core && (m.acquired[other] || m.refused[other] || m.waits[other] > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stalls returns a copy of the per-core count of refused accesses
+func (m *MemoryPorts) Stalls() []int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stalls := make([]int64, len(m.stalls))
+	copy(stalls, m.stalls)
+	return stalls
+}
+
+// Reset frees every port and zeroes the counters
+func (m *MemoryPorts) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.inUse = 0
+	for core := range m.stalls {
+		m.waits[core] = 0
+		m.refused[core] = false
+		m.acquired[core] = false
+		m.stalls[core] = 0
+	}
+}
+
+// ResetStats zeroes the stall counters, keeping the arbitration state
+func (m *MemoryPorts) ResetStats() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for core := range m.stalls {
+		m.stalls[core] = 0
+	}
+}
+
+// PortsSnapshot is a copy of the ports' arbitration state and counters, for
+// checkpointing
+type PortsSnapshot struct {
+	InUse    int
+	Waits    []int
+	Refused  []bool
+	Acquired []bool
+	Stalls   []int64
+}
+
+// Snapshot returns a copy of the ports' state
+func (m *MemoryPorts) Snapshot() PortsSnapshot {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return PortsSnapshot{
+		InUse:    m.inUse,
+		Waits:    append([]int(nil), m.waits...),
+		Refused:  append([]bool(nil), m.refused...),
+		Acquired: append([]bool(nil), m.acquired...),
+		Stalls:   append([]int64(nil), m.stalls...),
+	}
+}
+
+// Restore replaces the ports' state with snap, which must come from ports
+// shared by the same number of cores
+func (m *MemoryPorts) Restore(snap PortsSnapshot) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	n := len(m.stalls)
+	if len(snap.Waits) != n || len(snap.Refused) != n || len(snap.Acquired) != n || len(snap.Stalls) != n {
+		return fmt.Errorf("snapshot is for %d cores, ports are shared by %d", len(snap.Stalls), n)
+	}
+
+	m.inUse = snap.InUse
+	copy(m.waits, snap.Waits)
+	copy(m.refused, snap.Refused)
+	copy(m.acquired, snap.Acquired)
+	copy(m.stalls, snap.Stalls)
+	return nil
+}
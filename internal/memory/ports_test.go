@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewMemoryPorts(t *testing.T) {
+	tests := []struct {
+		name     string
+		ports    int
+		numCores int
+		wantErr  bool
+	}{
+		{name: "Valid", ports: 2, numCores: 4, wantErr: false},
+		{name: "Zero ports", ports: 0, numCores: 4, wantErr: true},
+		{name: "Zero cores", ports: 2, numCores: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMemoryPorts(tt.ports, tt.numCores)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewMemoryPorts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemoryPortsContention(t *testing.T) {
+	ports, err := NewMemoryPorts(1, 3)
+	if err != nil {
+		t.Fatalf("NewMemoryPorts() error = %v", err)
+	}
+
+	// All three cores want the single port every cycle, asking in ID order
+	var order []int
+	for cycle := 0; cycle < 3; cycle++ {
+		ports.BeginCycle()
+		for core := 0; core < 3; core++ {
+			if ports.Acquire(core) {
+				order = append(order, core)
+			}
+		}
+	}
+
+	// The longest-waiting core wins, so each core gets the port in turn
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Port grant order = %v, want %v", order, want)
+	}
+
+	if got, want := ports.Stalls(), []int64{2, 2, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Stalls() = %v, want %v", got, want)
+	}
+
+	ports.Reset()
+	if got := ports.Stalls(); !reflect.DeepEqual(got, []int64{0, 0, 0}) {
+		t.Errorf("Stalls() after Reset() = %v, want all zero", got)
+	}
+}
+
+func TestMemoryPortsContended(t *testing.T) {
+	ports, _ := NewMemoryPorts(2, 2)
+
+	// A core alone on the ports is not contended, even using both
+	ports.BeginCycle()
+	ports.Acquire(0)
+	ports.Acquire(0)
+	if ports.Contended(0) {
+		t.Error("Contended() with only this core on the ports = true, want false")
+	}
+	if !ports.Contended(1) {
+		t.Error("Contended() with another core holding the ports = false, want true")
+	}
+
+	// A core refused last cycle still presses on the ports this cycle
+	ports.Acquire(1)
+	ports.BeginCycle()
+	if !ports.Contended(0) {
+		t.Error("Contended() with another core waiting for a port = false, want true")
+	}
+
+	ports.BeginCycle()
+	if ports.Contended(0) {
+		t.Error("Contended() on idle ports = true, want false")
+	}
+}
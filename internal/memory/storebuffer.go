@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+)
+
+// StoreBufferStats contains counters for a store buffer
+type StoreBufferStats struct {
+	Stores     int64 // stores accepted by the buffer
+	FullStalls int64 // cycles stores waited for a free entry
+	Forwards   int64 // loads served from a buffered store
+	Drains     int64 // stores written to the cache
+}
+
+// StoreBuffer holds a core's stores until they drain to the cache, oldest
+// first, one at a time. Loads of a buffered address are forwarded the
+// stored value instead of reading the cache.
+type StoreBuffer struct {
+	addrs     []uint64 // buffered store addresses, oldest first
+	capacity  int
+	draining  bool // the oldest store is being written to the cache
+	drainLeft int  // cycles until it has been written
+	stats     StoreBufferStats
+	mutex     sync.Mutex
+}
+
+// NewStoreBuffer creates a buffer holding up to capacity stores
+func NewStoreBuffer(capacity int) (*StoreBuffer, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("store buffer capacity must be positive")
+	}
+
+	return &StoreBuffer{
+		addrs:    make([]uint64, 0, capacity),
+		capacity: capacity,
+	}, nil
+}
+
+// Store buffers a store to addr. It returns false, counting a stall, if
+// every entry is taken.
+func (b *StoreBuffer) Store(addr uint64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.addrs) == b.capacity {
+		b.stats.FullStalls++
+		return false
+	}
+
+	b.addrs = append(b.addrs, addr)
+	b.stats.Stores++
+	return true
+}
+
+// Forward reports whether a load of addr can take its value from a
+// buffered store
+func (b *StoreBuffer) Forward(addr uint64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, a := range b.addrs {
+		if a == addr {
+			b.stats.Forwards++
+			return true
+		}
+	}
+	return false
+}
+
+// Drain advances the buffer by a cycle. Once the oldest store has been
+// written it leaves the buffer, and write starts writing the next one,
+// returning the cycles it takes, or false if the cache cannot take it this
+// cycle.
+func (b *StoreBuffer) Drain(write func(addr uint64) (int, bool)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.draining {
+		if b.drainLeft--; b.drainLeft > 0 {
+			return
+		}
+		b.addrs = b.addrs[1:]
+		b.draining = false
+		b.stats.Drains++
+	}
+
+	if len(b.addrs) == 0 {
+		return
+	}
+
+	if latency, ok := write(b.addrs[0]); ok {
+		b.draining = true
+		b.drainLeft = max(latency, 1)
+	}
+}
+
+// Occupancy returns the number of stores in the buffer
+func (b *StoreBuffer) Occupancy() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.addrs)
+}
+
+// GetStats returns the buffer's counters
+func (b *StoreBuffer) GetStats() StoreBufferStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stats
+}
+
+// Reset empties the buffer and zeroes the counters
+func (b *StoreBuffer) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.addrs = b.addrs[:0]
+	b.draining, b.drainLeft = false, 0
+	b.stats = StoreBufferStats{}
+}
+
+// ResetStats zeroes the counters, keeping the buffered stores
+func (b *StoreBuffer) ResetStats() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stats = StoreBufferStats{}
+}
+
+// StoreBufferSnapshot is a copy of a store buffer's contents and counters,
+// for checkpointing
+type StoreBufferSnapshot struct {
+	Addrs     []uint64
+	Draining  bool
+	DrainLeft int
+	Stats     StoreBufferStats
+}
+
+// Snapshot returns a copy of the buffer's state
+func (b *StoreBuffer) Snapshot() StoreBufferSnapshot {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return StoreBufferSnapshot{
+		Addrs:     append([]uint64(nil), b.addrs...),
+		Draining:  b.draining,
+		DrainLeft: b.drainLeft,
+		Stats:     b.stats,
+	}
+}
+
+// Restore replaces the buffer's state with snap
+func (b *StoreBuffer) Restore(snap StoreBufferSnapshot) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(snap.Addrs) > b.capacity {
+		return fmt.Errorf("snapshot holds %d stores, buffer has %d entries", len(snap.Addrs), b.capacity)
+	}
+
+	b.addrs = append(b.addrs[:0], snap.Addrs...)
+	b.draining, b.drainLeft = snap.Draining, snap.DrainLeft
+	b.stats = snap.Stats
+	return nil
+}
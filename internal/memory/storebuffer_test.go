@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewStoreBuffer(t *testing.T) {
+	if _, err := NewStoreBuffer(4); err != nil {
+		t.Errorf("NewStoreBuffer(4) error = %v", err)
+	}
+
+	if _, err := NewStoreBuffer(0); err == nil {
+		t.Error("NewStoreBuffer(0) should return error")
+	}
+}
+
+func TestStoreBufferForwarding(t *testing.T) {
+	b, err := NewStoreBuffer(2)
+	if err != nil {
+		t.Fatalf("NewStoreBuffer() error = %v", err)
+	}
+
+	if !b.Store(0x100) || !b.Store(0x108) {
+		t.Fatal("Store() into a buffer with free entries should succeed")
+	}
+
+	if b.Store(0x110) {
+		t.Error("Store() into a full buffer should fail")
+	}
+
+	if !b.Forward(0x108) {
+		t.Error("Forward() of a buffered address should hit")
+	}
+
+	if b.Forward(0x110) {
+		t.Error("Forward() of an address never stored should miss")
+	}
+
+	want := StoreBufferStats{Stores: 2, FullStalls: 1, Forwards: 1}
+	if got := b.GetStats(); got != want {
+		t.Errorf("GetStats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestStoreBufferDrain(t *testing.T) {
+	b, err := NewStoreBuffer(4)
+	if err != nil {
+		t.Fatalf("NewStoreBuffer() error = %v", err)
+	}
+	b.Store(0x100)
+	b.Store(0x200)
+
+	// The cache refuses the first attempt, then takes 3 cycles per store
+	var written []uint64
+	refuse := true
+	write := func(addr uint64) (int, bool) {
+		if refuse {
+			refuse = false
+			return 0, false
+		}
+		written = append(written, addr)
+		return 3, true
+	}
+
+	var occupancy []int
+	for cycle := 0; cycle < 9; cycle++ {
+		b.Drain(write)
+		occupancy = append(occupancy, b.Occupancy())
+	}
+
+	if want := []uint64{0x100, 0x200}; !reflect.DeepEqual(written, want) {
+		t.Errorf("Drained %#x, want %#x", written, want)
+	}
+
+	// Each store stays forwardable until its write completes
+	if want := []int{2, 2, 2, 2, 1, 1, 1, 0, 0}; !reflect.DeepEqual(occupancy, want) {
+		t.Errorf("Occupancy by cycle = %v, want %v", occupancy, want)
+	}
+
+	if got := b.GetStats().Drains; got != 2 {
+		t.Errorf("Drains = %d, want 2", got)
+	}
+}
+
+func TestStoreBufferSnapshot(t *testing.T) {
+	b, _ := NewStoreBuffer(2)
+	b.Store(0x40)
+	b.Drain(func(uint64) (int, bool) { return 5, true })
+	snap := b.Snapshot()
+
+	restored, _ := NewStoreBuffer(2)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	if got := restored.Snapshot(); !reflect.DeepEqual(got, snap) {
+		t.Errorf("Restored snapshot = %+v, want %+v", got, snap)
+	}
+
+	small, _ := NewStoreBuffer(1)
+	b.Store(0x80)
+	if err := small.Restore(b.Snapshot()); err == nil {
+		t.Error("Restore() of more stores than entries should return error")
+	}
+
+	b.Reset()
+	if b.Occupancy() != 0 || b.GetStats() != (StoreBufferStats{}) {
+		t.Errorf("Reset() left %d stores, stats %+v", b.Occupancy(), b.GetStats())
+	}
+}
@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+)
+
+// frameMultiplier scatters virtual pages over physical frames. Being odd,
+// multiplying by it modulo a power of two never maps two pages to one frame.
+const frameMultiplier = 0x9E3779B97F4A7C15
+
+// TLBEntry is the cached translation of one virtual page
+type TLBEntry struct {
+	VPN   uint64 // virtual page number
+	Frame uint64 // physical frame number
+	Valid bool
+}
+
+// TLB caches a core's virtual-to-physical page translations. Every core
+// sees the same page table, which scatters pages over physical memory, so
+// cores still share the lines they have in common. A miss pays the page
+// walk latency and replaces a random way of its set.
+type TLB struct {
+	sets        [][]TLBEntry
+	pageShift   uint
+	frameMask   uint64 // frame numbers that fit in a 64-bit address
+	walkLatency int
+	state       uint64 // xorshift state choosing victims
+	hits        int64
+	misses      int64
+	mutex       sync.Mutex
+}
+
+// NewTLB creates a TLB of entries translations, associativity to a set, for
+// pages of pageSize bytes. seed drives the choice of victims.
+func NewTLB(entries, associativity, pageSize, walkLatency int, seed uint64) (*TLB, error) {
+	if entries <= 0 {
+		return nil, fmt.Errorf("TLB entries must be positive")
+	}
+
+	if associativity <= 0 || entries%associativity != 0 {
+		return nil, fmt.Errorf("TLB associativity %d does not divide its %d entries", associativity, entries)
+	}
+
+	if pageSize <= 0 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("page size must be a power of two, got %d", pageSize)
+	}
+
+	if walkLatency < 0 {
+		return nil, fmt.Errorf("page walk latency must not be negative")
+	}
+
+	sets := make([][]TLBEntry, entries/associativity)
+	for i := range sets {
+		sets[i] = make([]TLBEntry, associativity)
+	}
+
+	shift := uint(bits.TrailingZeros(uint(pageSize)))
+	return &TLB{
+		sets:        sets,
+		pageShift:   shift,
+		frameMask:   1<<(64-shift) - 1,
+		walkLatency: walkLatency,
+		state:       seed | 1, // xorshift sticks at 0
+	}, nil
+}
+
+// Translate returns the physical address of vaddr and the cycles spent
+// translating it: nothing on a hit, the page walk on a miss
+func (t *TLB) Translate(vaddr uint64) (uint64, int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	vpn := vaddr >> t.pageShift
+	offset := vaddr & (1<<t.pageShift - 1)
+	set := t.sets[vpn%uint64(len(t.sets))]
+
+	for _, e := range set {
+		if e.Valid && e.VPN == vpn {
+			t.hits++
+			return e.Frame<<t.pageShift | offset, 0
+		}
+	}
+
+	t.misses++
+	frame := vpn * frameMultiplier & t.frameMask
+	set[t.victim(set)] = TLBEntry{VPN: vpn, Frame: frame, Valid: true}
+	return frame<<t.pageShift | offset, t.walkLatency
+}
+
+// Physical returns the physical address vaddr maps to without looking it
+// up, leaving the TLB and its counters unchanged
+func (t *TLB) Physical(vaddr uint64) uint64 {
+	vpn := vaddr >> t.pageShift
+	offset := vaddr & (1<<t.pageShift - 1)
+	return (vpn*frameMultiplier&t.frameMask)<<t.pageShift | offset
+}
+
+// victim returns the way of set to fill: the first empty one, or else one
+// chosen at random
+func (t *TLB) victim(set []TLBEntry) int {
+	for way, e := range set {
+		if !e.Valid {
+			return way
+		}
+	}
+
+	t.state ^= t.state << 13
+	t.state ^= t.state >> 7
+	t.state ^= t.state << 17
+	return int(t.state % uint64(len(set)))
+}
+
+// Lookups returns the translations that hit and missed in the TLB
+func (t *TLB) Lookups() (hits, misses int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.hits, t.misses
+}
+
+// HitRate returns the fraction of translations that hit
+func (t *TLB) HitRate() float64 {
+	hits, misses := t.Lookups()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// Reset drops every translation and zeroes the counters
+func (t *TLB) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, set := range t.sets {
+		clear(set)
+	}
+	t.hits, t.misses = 0, 0
+}
+
+// ResetStats zeroes the counters, keeping the translations
+func (t *TLB) ResetStats() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.hits, t.misses = 0, 0
+}
+
+// TLBSnapshot is a copy of a TLB's translations, replacement state and
+// counters, for checkpointing
+type TLBSnapshot struct {
+	Sets   [][]TLBEntry
+	State  uint64
+	Hits   int64
+	Misses int64
+}
+
+// Snapshot returns a copy of the TLB's state
+func (t *TLB) Snapshot() TLBSnapshot {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	snap := TLBSnapshot{
+		Sets:   make([][]TLBEntry, len(t.sets)),
+		State:  t.state,
+		Hits:   t.hits,
+		Misses: t.misses,
+	}
+	for i, set := range t.sets {
+		snap.Sets[i] = append([]TLBEntry(nil), set...)
+	}
+	return snap
+}
+
+// Restore replaces the TLB's state with snap, which must come from a TLB of
+// the same geometry
+func (t *TLB) Restore(snap TLBSnapshot) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(snap.Sets) != len(t.sets) {
+		return fmt.Errorf("snapshot has %d TLB sets, TLB has %d", len(snap.Sets), len(t.sets))
+	}
+	for i, set := range snap.Sets {
+		if len(set) != len(t.sets[i]) {
+			return fmt.Errorf("snapshot has %d-way TLB sets, TLB has %d", len(set), len(t.sets[i]))
+		}
+	}
+
+	for i, set := range snap.Sets {
+		copy(t.sets[i], set)
+	}
+	t.state = snap.State
+	t.hits, t.misses = snap.Hits, snap.Misses
+	return nil
+}
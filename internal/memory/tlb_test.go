@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewTLB(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       int
+		associativity int
+		pageSize      int
+		walkLatency   int
+		wantErr       bool
+	}{
+		{name: "Direct-mapped", entries: 64, associativity: 1, pageSize: 4096, walkLatency: 30, wantErr: false},
+		{name: "Fully associative", entries: 16, associativity: 16, pageSize: 4096, walkLatency: 30, wantErr: false},
+		{name: "Zero entries", entries: 0, associativity: 1, pageSize: 4096, walkLatency: 30, wantErr: true},
+		{name: "Uneven sets", entries: 64, associativity: 3, pageSize: 4096, walkLatency: 30, wantErr: true},
+		{name: "Page size not a power of two", entries: 64, associativity: 1, pageSize: 3000, walkLatency: 30, wantErr: true},
+		{name: "Negative walk latency", entries: 64, associativity: 1, pageSize: 4096, walkLatency: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTLB(tt.entries, tt.associativity, tt.pageSize, tt.walkLatency, 1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewTLB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLBTranslate(t *testing.T) {
+	tlb, err := NewTLB(4, 1, 4096, 30, 1)
+	if err != nil {
+		t.Fatalf("NewTLB() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		vaddr       uint64
+		wantLatency int
+	}{
+		{name: "First touch walks the page table", vaddr: 0x1010, wantLatency: 30},
+		{name: "Same page hits", vaddr: 0x1ff8, wantLatency: 0},
+		{name: "Another set", vaddr: 0x2000, wantLatency: 30},
+		{name: "Conflicting page evicts the first", vaddr: 0x5000, wantLatency: 30},
+		{name: "Evicted page walks again", vaddr: 0x1000, wantLatency: 30},
+	}
+
+	for _, tt := range tests {
+		paddr, latency := tlb.Translate(tt.vaddr)
+		if latency != tt.wantLatency {
+			t.Errorf("%s: Translate(%#x) latency = %d, want %d", tt.name, tt.vaddr, latency, tt.wantLatency)
+		}
+		if paddr%4096 != tt.vaddr%4096 {
+			t.Errorf("%s: Translate(%#x) = %#x, want the page offset kept", tt.name, tt.vaddr, paddr)
+		}
+	}
+
+	if hits, misses := tlb.Lookups(); hits != 1 || misses != 4 {
+		t.Errorf("Lookups() = %d hits, %d misses, want 1 and 4", hits, misses)
+	}
+	if got := tlb.HitRate(); got != 0.2 {
+		t.Errorf("HitRate() = %.2f, want 0.20", got)
+	}
+
+	// Every TLB shares one page table, and distinct pages get distinct frames
+	other, _ := NewTLB(16, 4, 4096, 30, 7)
+	frames := make(map[uint64]uint64)
+	for vpn := uint64(0); vpn < 64; vpn++ {
+		paddr, _ := tlb.Translate(vpn * 4096)
+		if again, _ := other.Translate(vpn * 4096); again != paddr {
+			t.Errorf("Page %d maps to %#x in one TLB and %#x in another", vpn, paddr, again)
+		}
+		if got := other.Physical(vpn*4096 + 8); got != paddr+8 {
+			t.Errorf("Physical(%#x) = %#x, want %#x as translated", vpn*4096+8, got, paddr+8)
+		}
+		if prev, ok := frames[paddr]; ok {
+			t.Errorf("Pages %d and %d both map to %#x", prev, vpn, paddr)
+		}
+		frames[paddr] = vpn
+	}
+
+	tlb.ResetStats()
+	if _, latency := tlb.Translate(63 * 4096); latency != 0 {
+		t.Errorf("Translate() after ResetStats() latency = %d, want a hit", latency)
+	}
+
+	tlb.Reset()
+	if _, latency := tlb.Translate(63 * 4096); latency != 30 {
+		t.Errorf("Translate() after Reset() latency = %d, want a miss", latency)
+	}
+	if hits, misses := tlb.Lookups(); hits != 0 || misses != 1 {
+		t.Errorf("Lookups() after Reset() = %d hits, %d misses, want 0 and 1", hits, misses)
+	}
+
+	// Physical leaves the TLB untouched
+	tlb.Physical(0x9000)
+	if hits, misses := tlb.Lookups(); hits != 0 || misses != 1 {
+		t.Errorf("Lookups() after Physical() = %d hits, %d misses, want 0 and 1", hits, misses)
+	}
+}
+
+func TestTLBRandomReplacement(t *testing.T) {
+	// Three pages cycling through a 2-way set always miss under LRU; random
+	// replacement keeps one of them often enough to hit
+	run := func(seed uint64) (hits int64, victims []uint64) {
+		tlb, _ := NewTLB(2, 2, 4096, 30, seed)
+		for i := 0; i < 300; i++ {
+			tlb.Translate(uint64(i%3) * 4096)
+		}
+		hits, _ = tlb.Lookups()
+		for _, e := range tlb.Snapshot().Sets[0] {
+			victims = append(victims, e.VPN)
+		}
+		return hits, victims
+	}
+
+	hits, victims := run(5)
+	if hits == 0 {
+		t.Error("Random replacement never hit on three pages in two ways")
+	}
+
+	// The same seed replaces the same ways
+	if again, againVictims := run(5); again != hits || !reflect.DeepEqual(againVictims, victims) {
+		t.Errorf("Seed 5 gave %d hits leaving %v, then %d leaving %v", hits, victims, again, againVictims)
+	}
+}
+
+func TestTLBSnapshot(t *testing.T) {
+	tlb, _ := NewTLB(8, 2, 4096, 30, 3)
+	for page := uint64(0); page < 20; page++ {
+		tlb.Translate(page * 4096)
+	}
+	snap := tlb.Snapshot()
+
+	restored, _ := NewTLB(8, 2, 4096, 30, 9)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	// The restored TLB carries on exactly like the original
+	for page := uint64(0); page < 40; page++ {
+		_, want := tlb.Translate(page * 4096 % (24 * 4096))
+		if _, got := restored.Translate(page * 4096 % (24 * 4096)); got != want {
+			t.Fatalf("Translate() of page %d after Restore() latency = %d, want %d", page, got, want)
+		}
+	}
+
+	smaller, _ := NewTLB(4, 2, 4096, 30, 3)
+	if err := smaller.Restore(snap); err == nil {
+		t.Error("Restore() into a TLB with fewer sets should return error")
+	}
+}
@@ -0,0 +1,269 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Write-combining buffer flush policies
+const (
+	FlushOnFullLine = "full-line" // write a line out as soon as every byte is filled
+	FlushOnFence    = "fence"     // hold lines until a fence (or the buffer overflows), see Fence
+	FlushOnEviction = "eviction"  // hold lines until evicted to make room for a new one
+)
+
+// WriteCombiningStats contains counters for a write-combining buffer
+type WriteCombiningStats struct {
+	Stores          int64 // stores accepted by the buffer
+	CombinedWrites  int64 // stores merged into an already-buffered line
+	MemoryWrites    int64 // line writes issued to memory
+	FullLineFlushes int64 // memory writes covering a complete line
+	PartialFlushes  int64 // memory writes covering only part of a line
+}
+
+// LineWrite is a buffered line written to memory
+type LineWrite struct {
+	LineAddr uint64
+	Full     bool // every byte of the line was stored to
+}
+
+// wcEntry is a single line being combined
+type wcEntry struct {
+	lineAddr uint64
+	written  []bool // bytes of the line that have been stored to
+	filled   int    // number of true entries in written
+}
+
+// WriteCombiningBuffer merges streaming stores to the same line into
+// full-line memory writes that bypass the cache
+type WriteCombiningBuffer struct {
+	entries  []*wcEntry // oldest first
+	capacity int
+	lineSize int
+	policy   string
+	flushed  []LineWrite // lines written by the current Store or Fence
+	stats    WriteCombiningStats
+	mutex    sync.Mutex
+}
+
+// NewWriteCombiningBuffer creates a buffer holding up to capacity lines
+func NewWriteCombiningBuffer(capacity, lineSize int, policy string) (*WriteCombiningBuffer, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("write-combining buffer capacity must be positive")
+	}
+
+	if lineSize <= 0 {
+		return nil, fmt.Errorf("line size must be positive")
+	}
+
+	switch policy {
+	case FlushOnFullLine, FlushOnFence, FlushOnEviction:
+	default:
+		return nil, fmt.Errorf("unsupported write-combining flush policy: %s", policy)
+	}
+
+	return &WriteCombiningBuffer{
+		entries:  make([]*wcEntry, 0, capacity),
+		capacity: capacity,
+		lineSize: lineSize,
+		policy:   policy,
+	}, nil
+}
+
+// Store buffers a write of size bytes starting at addr and returns the lines
+// it caused to be written to memory, oldest first. Writes that cross a line
+// boundary are split across the lines they touch.
+func (b *WriteCombiningBuffer) Store(addr uint64, size int) []LineWrite {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.flushed = nil
+	b.stats.Stores++
+
+	lineSize := uint64(b.lineSize)
+	for size > 0 {
+		lineAddr := addr - addr%lineSize
+		offset := int(addr - lineAddr)
+		n := b.lineSize - offset
+		if n > size {
+			n = size
+		}
+
+		b.storeLine(lineAddr, offset, n)
+
+		addr += uint64(n)
+		size -= n
+	}
+
+	return b.flushed
+}
+
+// storeLine merges a write into the entry for lineAddr, allocating one if needed
+func (b *WriteCombiningBuffer) storeLine(lineAddr uint64, offset, n int) {
+	idx := b.find(lineAddr)
+	if idx >= 0 {
+		b.stats.CombinedWrites++
+	} else {
+		if len(b.entries) == b.capacity {
+			if b.policy == FlushOnFence {
+				// No room and no fence yet: drain everything
+				b.flushAll()
+			} else {
+				b.flushEntry(0)
+			}
+		}
+
+		b.entries = append(b.entries, &wcEntry{
+			lineAddr: lineAddr,
+			written:  make([]bool, b.lineSize),
+		})
+		idx = len(b.entries) - 1
+	}
+
+	entry := b.entries[idx]
+	for i := offset; i < offset+n; i++ {
+		if !entry.written[i] {
+			entry.written[i] = true
+			entry.filled++
+		}
+	}
+
+	if b.policy == FlushOnFullLine && entry.filled == b.lineSize {
+		b.flushEntry(idx)
+	}
+}
+
+// find returns the index of the entry holding lineAddr, or -1
+func (b *WriteCombiningBuffer) find(lineAddr uint64) int {
+	for i, entry := range b.entries {
+		if entry.lineAddr == lineAddr {
+			return i
+		}
+	}
+	return -1
+}
+
+// flushEntry writes the entry at idx to memory and removes it
+func (b *WriteCombiningBuffer) flushEntry(idx int) {
+	entry := b.entries[idx]
+
+	full := entry.filled == b.lineSize
+	b.stats.MemoryWrites++
+	if full {
+		b.stats.FullLineFlushes++
+	} else {
+		b.stats.PartialFlushes++
+	}
+	b.flushed = append(b.flushed, LineWrite{LineAddr: entry.lineAddr, Full: full})
+
+	b.entries = append(b.entries[:idx], b.entries[idx+1:]...)
+}
+
+// flushAll writes every buffered line to memory
+func (b *WriteCombiningBuffer) flushAll() {
+	for len(b.entries) > 0 {
+		b.flushEntry(0)
+	}
+}
+
+// Fence drains the buffer, writing every buffered line to memory, and
+// returns the lines written. The core fences on serializing events:
+// interrupts, full pipeline flushes and the end of a run.
+func (b *WriteCombiningBuffer) Fence() []LineWrite {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.flushed = nil
+	b.flushAll()
+	return b.flushed
+}
+
+// Occupancy returns the number of lines currently buffered
+func (b *WriteCombiningBuffer) Occupancy() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.entries)
+}
+
+// GetStats returns a copy of the buffer's counters
+func (b *WriteCombiningBuffer) GetStats() WriteCombiningStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stats
+}
+
+// Reset discards all buffered lines and zeroes the counters
+func (b *WriteCombiningBuffer) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.entries = b.entries[:0]
+	b.stats = WriteCombiningStats{}
+}
+
+// ResetStats zeroes the counters, leaving buffered lines in place
+func (b *WriteCombiningBuffer) ResetStats() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stats = WriteCombiningStats{}
+}
+
+// WriteCombiningLine is a copy of one buffered line, for checkpointing
+type WriteCombiningLine struct {
+	LineAddr uint64
+	Written  []bool
+}
+
+// WriteCombiningSnapshot is a copy of a write-combining buffer's lines and
+// counters, for checkpointing
+type WriteCombiningSnapshot struct {
+	Lines []WriteCombiningLine // oldest first
+	Stats WriteCombiningStats
+}
+
+// Snapshot returns a copy of the buffer's state
+func (b *WriteCombiningBuffer) Snapshot() WriteCombiningSnapshot {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	snap := WriteCombiningSnapshot{Stats: b.stats}
+	for _, entry := range b.entries {
+		snap.Lines = append(snap.Lines, WriteCombiningLine{
+			LineAddr: entry.lineAddr,
+			Written:  append([]bool(nil), entry.written...),
+		})
+	}
+	return snap
+}
+
+// Restore replaces the buffer's state with snap, which must come from a
+// buffer with the same line size and no more lines than this one holds
+func (b *WriteCombiningBuffer) Restore(snap WriteCombiningSnapshot) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(snap.Lines) > b.capacity {
+		return fmt.Errorf("snapshot holds %d lines, buffer has %d entries", len(snap.Lines), b.capacity)
+	}
+
+	entries := make([]*wcEntry, 0, b.capacity)
+	for _, line := range snap.Lines {
+		if len(line.Written) != b.lineSize {
+			return fmt.Errorf("snapshot line of %d bytes, buffer lines are %d", len(line.Written), b.lineSize)
+		}
+		entry := &wcEntry{lineAddr: line.LineAddr, written: append([]bool(nil), line.Written...)}
+		for _, w := range line.Written {
+			if w {
+				entry.filled++
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	b.entries = entries
+	b.stats = snap.Stats
+	return nil
+}
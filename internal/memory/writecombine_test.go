@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewWriteCombiningBuffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		lineSize int
+		policy   string
+		wantErr  bool
+	}{
+		{name: "Full-line policy", capacity: 4, lineSize: 64, policy: FlushOnFullLine, wantErr: false},
+		{name: "Fence policy", capacity: 4, lineSize: 64, policy: FlushOnFence, wantErr: false},
+		{name: "Eviction policy", capacity: 4, lineSize: 64, policy: FlushOnEviction, wantErr: false},
+		{name: "Zero capacity", capacity: 0, lineSize: 64, policy: FlushOnFullLine, wantErr: true},
+		{name: "Zero line size", capacity: 4, lineSize: 0, policy: FlushOnFullLine, wantErr: true},
+		{name: "Invalid policy", capacity: 4, lineSize: 64, policy: "Invalid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWriteCombiningBuffer(tt.capacity, tt.lineSize, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewWriteCombiningBuffer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteCombiningFullLine(t *testing.T) {
+	buf, err := NewWriteCombiningBuffer(4, 64, FlushOnFullLine)
+	if err != nil {
+		t.Fatalf("NewWriteCombiningBuffer() error = %v", err)
+	}
+
+	// Eight sequential 8-byte stores fill one 64-byte line
+	for i := 0; i < 8; i++ {
+		buf.Store(0x1000+uint64(i*8), 8)
+	}
+
+	stats := buf.GetStats()
+	if stats.MemoryWrites != 1 {
+		t.Errorf("MemoryWrites = %d, want 1", stats.MemoryWrites)
+	}
+
+	if stats.FullLineFlushes != 1 {
+		t.Errorf("FullLineFlushes = %d, want 1", stats.FullLineFlushes)
+	}
+
+	if stats.CombinedWrites != 7 {
+		t.Errorf("CombinedWrites = %d, want 7", stats.CombinedWrites)
+	}
+
+	if stats.PartialFlushes != 0 {
+		t.Errorf("PartialFlushes = %d, want 0", stats.PartialFlushes)
+	}
+
+	if buf.Occupancy() != 0 {
+		t.Errorf("Occupancy() = %d after full line flush, want 0", buf.Occupancy())
+	}
+}
+
+func TestWriteCombiningFence(t *testing.T) {
+	buf, _ := NewWriteCombiningBuffer(4, 64, FlushOnFence)
+
+	// A complete line and a partial line are both held until the fence
+	for i := 0; i < 8; i++ {
+		buf.Store(0x1000+uint64(i*8), 8)
+	}
+	buf.Store(0x2000, 8)
+
+	if buf.GetStats().MemoryWrites != 0 {
+		t.Fatalf("MemoryWrites = %d before fence, want 0", buf.GetStats().MemoryWrites)
+	}
+
+	written := buf.Fence()
+	want := []LineWrite{{LineAddr: 0x1000, Full: true}, {LineAddr: 0x2000, Full: false}}
+	if !reflect.DeepEqual(written, want) {
+		t.Errorf("Fence() = %+v, want %+v", written, want)
+	}
+
+	stats := buf.GetStats()
+	if stats.MemoryWrites != 2 {
+		t.Errorf("MemoryWrites = %d after fence, want 2", stats.MemoryWrites)
+	}
+
+	if stats.FullLineFlushes != 1 || stats.PartialFlushes != 1 {
+		t.Errorf("FullLineFlushes = %d, PartialFlushes = %d, want 1 and 1",
+			stats.FullLineFlushes, stats.PartialFlushes)
+	}
+}
+
+func TestWriteCombiningEviction(t *testing.T) {
+	buf, _ := NewWriteCombiningBuffer(2, 64, FlushOnEviction)
+
+	buf.Store(0x1000, 8)
+	buf.Store(0x2000, 8)
+
+	// A third line evicts the oldest entry as a partial flush
+	if written := buf.Store(0x3000, 8); !reflect.DeepEqual(written, []LineWrite{{LineAddr: 0x1000}}) {
+		t.Errorf("Store() = %+v, want the line at 0x1000 written partially", written)
+	}
+
+	stats := buf.GetStats()
+	if stats.MemoryWrites != 1 || stats.PartialFlushes != 1 {
+		t.Errorf("MemoryWrites = %d, PartialFlushes = %d, want 1 and 1",
+			stats.MemoryWrites, stats.PartialFlushes)
+	}
+
+	if buf.Occupancy() != 2 {
+		t.Errorf("Occupancy() = %d, want 2", buf.Occupancy())
+	}
+}
+
+func TestWriteCombiningLineCrossing(t *testing.T) {
+	buf, _ := NewWriteCombiningBuffer(4, 64, FlushOnEviction)
+
+	// A store straddling a line boundary occupies two entries
+	buf.Store(0x1000+60, 8)
+
+	if buf.Occupancy() != 2 {
+		t.Errorf("Occupancy() = %d after line-crossing store, want 2", buf.Occupancy())
+	}
+}
+
+func TestWriteCombiningSnapshot(t *testing.T) {
+	buf, _ := NewWriteCombiningBuffer(4, 64, FlushOnFullLine)
+	for i := 0; i < 7; i++ {
+		buf.Store(0x1000+uint64(i*8), 8)
+	}
+	buf.Store(0x2000, 8)
+
+	snap := buf.Snapshot()
+	restored, _ := NewWriteCombiningBuffer(4, 64, FlushOnFullLine)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !reflect.DeepEqual(restored.Snapshot(), snap) {
+		t.Errorf("Snapshot() after Restore() = %+v, want %+v", restored.Snapshot(), snap)
+	}
+
+	// The restored buffer completes the line the original had nearly filled
+	if written := restored.Store(0x1038, 8); !reflect.DeepEqual(written, []LineWrite{{LineAddr: 0x1000, Full: true}}) {
+		t.Errorf("Store() after Restore() = %+v, want a full line write of 0x1000", written)
+	}
+
+	smaller, _ := NewWriteCombiningBuffer(1, 64, FlushOnFullLine)
+	if err := smaller.Restore(snap); err == nil {
+		t.Errorf("Restore() into a smaller buffer should return error")
+	}
+	narrower, _ := NewWriteCombiningBuffer(4, 32, FlushOnFullLine)
+	if err := narrower.Restore(snap); err == nil {
+		t.Errorf("Restore() into a buffer with shorter lines should return error")
+	}
+
+	buf.ResetStats()
+	if buf.GetStats() != (WriteCombiningStats{}) || buf.Occupancy() != 2 {
+		t.Errorf("ResetStats() left %+v with %d lines, want zero counters and 2 lines", buf.GetStats(), buf.Occupancy())
+	}
+}
@@ -0,0 +1,237 @@
+package pipeline
+
+import "fmt"
+
+// robEntry is an instruction in the reorder buffer. It waits in a
+// reservation station until issued, passes through Execute and the stages
+// after it, then waits again until it reaches the head of the buffer.
+type robEntry struct {
+	inst     *Instruction
+	issued   bool // left its reservation station for Execute
+	complete bool // left the final stage, ready to retire
+}
+
+// SetOutOfOrder makes instructions issue out of order from a reorder buffer
+// of robSize entries, at most stations of which wait to issue at once. The
+// stages ahead of Execute stay in order; instructions leave the stage
+// before Execute for the buffer, issue to Execute as soon as their operands
+// are ready, and retire in order once through the final stage. A robSize
+// of 0 restores in-order issue.
+func (p *Pipeline) SetOutOfOrder(robSize, stations int) error {
+	if robSize < 0 {
+		return fmt.Errorf("reorder buffer size must not be negative")
+	}
+
+	if robSize > 0 {
+		if stations <= 0 {
+			return fmt.Errorf("reservation stations must be positive")
+		}
+		if p.executeIdx < 1 {
+			return fmt.Errorf("out-of-order issue needs a stage ahead of Execute")
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.robSize = robSize
+	p.stations = stations
+	p.rob = nil
+	return nil
+}
+
+// outOfOrder reports whether instructions issue from the reorder buffer
+func (p *Pipeline) outOfOrder() bool {
+	return p.robSize > 0
+}
+
+// ROBOccupancy returns the number of instructions in the reorder buffer
+func (p *Pipeline) ROBOccupancy() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return len(p.rob)
+}
+
+// enterWindow places inst in the reorder buffer and a reservation station,
+// returning false if either is full
+func (p *Pipeline) enterWindow(inst *Instruction) bool {
+	waiting := 0
+	for _, e := range p.rob {
+		if !e.issued {
+			waiting++
+		}
+	}
+
+	if len(p.rob) >= p.robSize || waiting >= p.stations {
+		return false
+	}
+
+	p.rob = append(p.rob, &robEntry{inst: inst})
+	return true
+}
+
+// issue moves waiting instructions whose operands are ready into Execute,
+// oldest first, and returns the number issued. An instruction that cannot
+// issue does not hold back younger ones.
+func (p *Pipeline) issue() int {
+	execute := p.Stages[p.executeIdx]
+
+	n := 0
+	for i, e := range p.rob {
+		if e.issued {
+			continue
+		}
+		if !execute.hasRoom(p.width) {
+			return n
+		}
+
+		stall, forwarded := p.checkWindowHazard(i)
+		if stall {
+			p.hazardStalls++
+			continue
+		}
+
+		if !p.moveTo(p.executeIdx, e.inst) {
+			continue
+		}
+
+		if forwarded {
+			p.forwarded++
+		}
+		e.issued = true
+		n++
+	}
+	return n
+}
+
+// checkWindowHazard reports whether the instruction in reorder buffer entry
+// i reads a register an older in-flight instruction has yet to produce.
+// Without forwarding, producers must retire first; with it, their result
+// is bypassed once ready, and forwarded is true.
+func (p *Pipeline) checkWindowHazard(i int) (stall, forwarded bool) {
+	inst := p.rob[i].inst
+
+	for _, src := range inst.SrcRegs {
+		producer := p.windowProducer(i, src)
+		if producer == nil {
+			continue
+		}
+
+		if !p.forwarding {
+			return true, false
+		}
+
+		if !producer.complete {
+			j := p.stageOf(producer.inst)
+			if j < 0 || !p.resultReady(j, producer.inst) {
+				return true, false
+			}
+		}
+		forwarded = true
+	}
+
+	return false, forwarded
+}
+
+// windowProducer returns the youngest entry older than entry i that writes
+// reg for the same thread, or nil if the register file holds the value
+func (p *Pipeline) windowProducer(i, reg int) *robEntry {
+	thread := p.rob[i].inst.Thread
+	for j := i - 1; j >= 0; j-- {
+		if inst := p.rob[j].inst; inst.Thread == thread && inst.DestReg == reg {
+			return p.rob[j]
+		}
+	}
+	return nil
+}
+
+// windowValue returns the result of the youngest instruction older than
+// inst that writes reg for inst's thread, skipping those that compute no
+// value
+func (p *Pipeline) windowValue(inst *Instruction, reg int) (uint64, bool) {
+	i := p.windowIndex(inst)
+	for j := i - 1; j >= 0; j-- {
+		producer := p.rob[j].inst
+		if producer.Thread == inst.Thread && producer.DestReg == reg && producer.HasResult {
+			return producer.Result, true
+		}
+	}
+	return 0, false
+}
+
+// windowIndex returns inst's position in the reorder buffer, or -1
+func (p *Pipeline) windowIndex(inst *Instruction) int {
+	for i, e := range p.rob {
+		if e.inst == inst {
+			return i
+		}
+	}
+	return -1
+}
+
+// stageOf returns the index of the stage at or past Execute holding inst,
+// or -1
+func (p *Pipeline) stageOf(inst *Instruction) int {
+	for j := p.executeIdx; j < len(p.Stages); j++ {
+		for _, other := range p.Stages[j].contents() {
+			if other == inst {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// complete marks inst, which has left the final stage, ready to retire
+func (p *Pipeline) complete(inst *Instruction) {
+	if i := p.windowIndex(inst); i >= 0 {
+		p.rob[i].complete = true
+	}
+}
+
+// retire commits completed instructions from the head of the reorder
+// buffer, in order and at most one issue width per cycle. It returns the
+// number retired.
+func (p *Pipeline) retire() int {
+	n := 0
+	for n < p.width && len(p.rob) > 0 && p.rob[0].complete {
+		if p.writeback != nil {
+			p.writeback(p.rob[0].inst)
+		}
+		p.retired++
+		p.rob = p.rob[1:]
+		n++
+	}
+	return n
+}
+
+// flushWindow discards every instruction of branch's thread younger than
+// branch from the reorder buffer and the stages past Execute
+func (p *Pipeline) flushWindow(branch *Instruction) {
+	i := p.windowIndex(branch)
+	if i < 0 {
+		return
+	}
+
+	flushed := make(map[*Instruction]bool)
+	kept := p.rob[:i+1]
+	for _, e := range p.rob[i+1:] {
+		if e.inst.Thread == branch.Thread {
+			flushed[e.inst] = true
+			continue
+		}
+		kept = append(kept, e)
+	}
+	p.rob = kept
+
+	for _, stage := range p.Stages[p.executeIdx:] {
+		var remaining []*Instruction
+		for _, inst := range stage.contents() {
+			if !flushed[inst] {
+				remaining = append(remaining, inst)
+			}
+		}
+		stage.setContents(remaining)
+	}
+}
@@ -2,6 +2,8 @@ package pipeline
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 )
 
@@ -10,15 +12,106 @@ type Stage struct {
 	Name        string
 	Instruction *Instruction // Currently processing instruction
 	Busy        bool
-	Latency     int // cycles needed to complete this stage
+	Latency     int   // cycles needed to complete this stage
+	Gated       bool  // stage is power-gated after sitting idle
+	GatedCycles int64 // cycles spent power-gated
+	Wakeups     int64 // times the stage was woken from power-gating
+	idleCycles  int   // consecutive cycles without an instruction
+	stat        StageStat
+
+	// Younger holds the instructions behind Instruction, oldest first, when
+	// the issue width lets a stage hold more than one
+	Younger []*Instruction
+}
+
+// StageStat counts how a stage spent each AdvanceStages call
+type StageStat struct {
+	Name        string `json:"name"`
+	BusyCycles  int64  `json:"busyCycles"`  // working on or passing on an instruction
+	StallCycles int64  `json:"stallCycles"` // holding a finished instruction the next stage could not take
+	EmptyCycles int64  `json:"emptyCycles"` // holding no instruction
+	GatedCycles int64  `json:"gatedCycles"` // power-gated after sitting idle, counted among the empty cycles
+	Wakeups     int64  `json:"wakeups"`     // times woken from power-gating
+}
+
+// Occupancy returns the fraction of cycles the stage held an instruction
+func (s StageStat) Occupancy() float64 {
+	total := s.BusyCycles + s.StallCycles + s.EmptyCycles
+	if total == 0 {
+		return 0
+	}
+	return float64(s.BusyCycles+s.StallCycles) / float64(total)
+}
+
+// contents returns the instructions in the stage, oldest first
+func (s *Stage) contents() []*Instruction {
+	if !s.Busy || s.Instruction == nil {
+		return nil
+	}
+	return append([]*Instruction{s.Instruction}, s.Younger...)
+}
+
+// setContents replaces the instructions in the stage
+func (s *Stage) setContents(insts []*Instruction) {
+	if len(insts) == 0 {
+		s.clear()
+		return
+	}
+
+	s.Instruction = insts[0]
+	s.Busy = true
+	s.Younger = append(s.Younger[:0], insts[1:]...)
+}
+
+// clear removes every instruction from the stage
+func (s *Stage) clear() {
+	s.Instruction = nil
+	s.Busy = false
+	s.Younger = nil
+}
+
+// hasRoom reports whether the stage can take another instruction
+func (s *Stage) hasRoom(width int) bool {
+	if !s.Busy {
+		return true
+	}
+	return 1+len(s.Younger) < width
 }
 
 // Pipeline represents the processor pipeline
 type Pipeline struct {
-	Stages []*Stage
-	mutex  sync.RWMutex
+	Stages        []*Stage
+	decodeIdx     int            // index of the first decode stage, -1 if there is none
+	executeIdx    int            // index of the Execute stage, -1 if there is none
+	memoryIdx     int            // index of the Memory stage, -1 if there is none
+	forwarding    bool           // results are bypassed to dependents once produced
+	hazardStalls  int64          // cycles an instruction was held back by a RAW hazard
+	wawStalls     int64          // cycles an instruction was held back by a WAW hazard
+	warStalls     int64          // cycles an instruction was held back by a WAR hazard
+	forwarded     int64          // RAW hazards resolved by forwarding instead of a stall
+	width         int            // instructions each stage can hold
+	resolving     []*Instruction // branches that entered Execute this cycle
+	progressed    bool           // an instruction changed stage, issued or retired this cycle
+	dispatch      func(*Instruction) (int, bool)
+	unitLatency   func(*Instruction) int
+	memAccess     func(*Instruction) (int, bool)
+	execute       func(inst *Instruction, forwarded func(reg int) (uint64, bool))
+	writeback     func(*Instruction)
+	structStalls  int64                  // cycles an instruction waited for a free execution unit
+	flushes       [numFlushReasons]int64 // flushes by reason
+	retired       int64                  // instructions that left the final stage or the reorder buffer
+	gateThreshold int                    // idle cycles before a stage is power-gated, 0 disables
+	wakeLatency   int                    // extra cycles to wake a gated stage
+	robSize       int                    // reorder buffer entries, 0 for in-order issue
+	stations      int                    // reservation stations, out-of-order only
+	rob           []*robEntry            // instructions past the front end, oldest first
+	nextSeq       uint64                 // sequence number of the next instruction fetched
+	mutex         sync.RWMutex
 }
 
+// NoReg marks an instruction that writes no register
+const NoReg = -1
+
 // Instruction represents an instruction in the pipeline
 type Instruction struct {
 	Address    uint64
@@ -26,6 +119,22 @@ type Instruction struct {
 	Operands   []uint8
 	Type       string // "Integer", "Float", "Memory", "Branch", "System"
 	CyclesLeft int    // Cycles remaining in current stage
+	SrcRegs    []int  // registers read
+	DestReg    int    // register written, NoReg if none
+	Predicted  bool   // branch predicted taken at fetch
+	Predicated bool   // branch executed as predication: fetch falls through and it never flushes
+	Guarded    bool   // fetched in the shadow of a predicated branch
+	Nullified  bool   // skipped by a taken predicated branch: flows through without effect
+	Target     uint64 // branch target address
+	Taken      bool   // branch direction, computed in Execute
+	Length     int    // encoding size in bytes
+	DecodeCost int    // extra cycles spent in the first decode stage
+	Result     uint64 // value computed in Execute, valid if HasResult
+	HasResult  bool
+	Thread     int    // hardware thread that fetched the instruction
+	Seq        uint64 // fetch order, assigned as the instruction enters the pipeline
+	LoadAddr   uint64 // physical address a load read, valid if Loaded
+	Loaded     bool
 }
 
 // NewPipeline creates a new pipeline with the specified depth
@@ -36,6 +145,7 @@ func NewPipeline(depth int, isa string) (*Pipeline, error) {
 
 	pipeline := &Pipeline{
 		Stages: make([]*Stage, 0, depth),
+		width:  1,
 	}
 
 	// Create stages based on ISA
@@ -117,6 +227,20 @@ func NewPipeline(depth int, isa string) (*Pipeline, error) {
 		}
 	}
 
+	pipeline.decodeIdx = -1
+	pipeline.executeIdx = -1
+	pipeline.memoryIdx = -1
+	for i, stage := range pipeline.Stages {
+		switch {
+		case strings.HasPrefix(stage.Name, "Decode") && pipeline.decodeIdx < 0:
+			pipeline.decodeIdx = i
+		case stage.Name == "Execute":
+			pipeline.executeIdx = i
+		case stage.Name == "Memory":
+			pipeline.memoryIdx = i
+		}
+	}
+
 	return pipeline, nil
 }
 
@@ -126,61 +250,611 @@ func (p *Pipeline) AdvanceStages() bool {
 	defer p.mutex.Unlock()
 
 	workDone := false
+	p.resolving = nil
+	p.progressed = false
+
+	if p.outOfOrder() {
+		retired := p.retire()
+		workDone = retired > 0 || len(p.rob) > 0
+		p.progressed = retired > 0
+	}
 
 	// Process stages in reverse order to avoid overwriting
 	for i := len(p.Stages) - 1; i >= 0; i-- {
+		// Waiting instructions issue once Execute has moved on, before the
+		// stage behind it can add to the window
+		if p.outOfOrder() && i == p.executeIdx-1 && p.issue() > 0 {
+			p.progressed = true
+		}
+
 		stage := p.Stages[i]
+		insts := stage.contents()
+		if len(insts) == 0 {
+			stage.stat.EmptyCycles++
+			continue
+		}
+		workDone = true
 
-		if stage.Busy && stage.Instruction != nil {
-			workDone = true
-
-			// Decrement cycles left in this stage
-			stage.Instruction.CyclesLeft--
-
-			// If instruction completed this stage
-			if stage.Instruction.CyclesLeft <= 0 {
-				// If this is the last stage, remove instruction from pipeline
-				if i == len(p.Stages)-1 {
-					stage.Instruction = nil
-					stage.Busy = false
-				} else {
-					// Otherwise, try to pass to next stage
-					nextStage := p.Stages[i+1]
-					if !nextStage.Busy {
-						// Move to next stage
-						nextStage.Instruction = stage.Instruction
-						nextStage.Busy = true
-						nextStage.Instruction.CyclesLeft = nextStage.Latency
-
-						// Clear current stage
-						stage.Instruction = nil
-						stage.Busy = false
-					}
-					// If next stage is busy, stall in current stage
-				}
+		// Decrement cycles left in this stage
+		for _, inst := range insts {
+			inst.CyclesLeft--
+		}
+
+		// Instructions leave in order, so one that cannot move holds back
+		// every younger instruction in the stage. Past Execute in an
+		// out-of-order pipeline each leaves as soon as it is done.
+		inOrder := !p.outOfOrder() || i < p.executeIdx
+		var stay []*Instruction
+		blocked, stalled := false, false
+		for _, inst := range insts {
+			if blocked || inst.CyclesLeft > 0 {
+				stay = append(stay, inst)
+				blocked = blocked || inOrder
+				continue
 			}
+
+			if !p.advance(i, inst) {
+				stay = append(stay, inst)
+				blocked = inOrder
+				stalled = true
+				continue
+			}
+			p.progressed = true
+		}
+
+		if stalled {
+			stage.stat.StallCycles++
+		} else {
+			stage.stat.BusyCycles++
 		}
+		stage.setContents(stay)
 	}
 
+	p.updatePowerGating()
+
 	return workDone
 }
 
+// advance moves inst, which has completed stage i, into the next stage or
+// retires it from the last one. It returns false if inst must stay put.
+func (p *Pipeline) advance(i int, inst *Instruction) bool {
+	// If this is the last stage, remove instruction from pipeline
+	if i == len(p.Stages)-1 {
+		if p.outOfOrder() {
+			// It retires from the reorder buffer in program order
+			p.complete(inst)
+			return true
+		}
+
+		if p.writeback != nil {
+			p.writeback(inst)
+		}
+		p.retired++
+		return true
+	}
+
+	toExecute := i+1 == p.executeIdx
+	if toExecute && p.outOfOrder() {
+		return p.enterWindow(inst)
+	}
+
+	if toExecute {
+		stall, forwarded := p.checkRAWHazard(inst)
+		if stall {
+			// Hold the instruction until its operands are available
+			p.hazardStalls++
+			return false
+		}
+
+		if waw, war := p.checkScoreboard(i, inst); waw || war {
+			// Hold the instruction until it cannot overtake an older one
+			if waw {
+				p.wawStalls++
+			} else {
+				p.warStalls++
+			}
+			return false
+		}
+
+		if forwarded && p.Stages[i+1].hasRoom(p.width) {
+			p.forwarded++
+		}
+	}
+
+	return p.moveTo(i+1, inst)
+}
+
+// moveTo places inst in stage next, claiming an execution unit on the way
+// into Execute and starting the data access on the way into the memory
+// access stage. It returns false if inst cannot move this cycle.
+func (p *Pipeline) moveTo(next int, inst *Instruction) bool {
+	nextStage := p.Stages[next]
+	toExecute := next == p.executeIdx
+
+	// If next stage is full, stall in current stage
+	if !nextStage.hasRoom(p.width) {
+		return false
+	}
+
+	latency, dispatched := 0, true
+	if toExecute && p.dispatch != nil {
+		latency, dispatched = p.dispatch(inst)
+	}
+
+	if !dispatched {
+		// No execution unit is free to take the instruction
+		p.structStalls++
+		return false
+	}
+
+	memLatency, accessed := 0, true
+	toMemory := next == p.memAccessIdx() && inst.Type == "Memory" && p.memAccess != nil
+	if toMemory {
+		memLatency, accessed = p.memAccess(inst)
+	}
+
+	if !accessed {
+		// The memory system could not take the access this cycle
+		return false
+	}
+
+	if toExecute && p.execute != nil {
+		p.execute(inst, func(reg int) (uint64, bool) {
+			if p.outOfOrder() {
+				return p.windowValue(inst, reg)
+			}
+			return p.forwardedValue(inst.Thread, reg)
+		})
+	}
+
+	// Move to next stage
+	p.enterStage(nextStage, inst)
+	if next == p.decodeIdx {
+		// Long encodings take extra cycles to decode
+		inst.CyclesLeft += inst.DecodeCost
+	}
+	if toMemory && memLatency > nextStage.Latency {
+		// The instruction waits in the stage for its data access
+		inst.CyclesLeft += memLatency - nextStage.Latency
+	}
+
+	if toExecute {
+		// The instruction occupies Execute until its unit finishes
+		if latency > nextStage.Latency {
+			inst.CyclesLeft += latency - nextStage.Latency
+		}
+
+		if inst.Type == "Branch" {
+			p.resolving = append(p.resolving, inst)
+		}
+	}
+
+	return true
+}
+
+// checkRAWHazard reports whether inst reads a register that an older
+// instruction at or past Execute has yet to write back. stall is true if
+// inst must wait; forwarded is true if every such dependency can instead be
+// bypassed from the producer's result.
+func (p *Pipeline) checkRAWHazard(inst *Instruction) (stall, forwarded bool) {
+	if len(inst.SrcRegs) == 0 {
+		return false, false
+	}
+
+	for j := p.executeIdx; j < len(p.Stages); j++ {
+		for _, producer := range p.Stages[j].contents() {
+			// Threads have their own register files
+			if producer.DestReg == NoReg || producer.Thread != inst.Thread {
+				continue
+			}
+
+			for _, src := range inst.SrcRegs {
+				if src != producer.DestReg {
+					continue
+				}
+
+				if !p.forwarding || !p.resultReady(j, producer) {
+					return true, false
+				}
+				forwarded = true
+			}
+		}
+	}
+
+	return false, forwarded
+}
+
+// checkScoreboard reports whether inst, about to leave stage i for Execute,
+// would clobber a register an older instruction of its thread still needs:
+// waw if one still executing writes inst's destination and would finish
+// after inst, as a slow unit does behind a fast one; war if one that has yet
+// to issue reads it. Instructions read their operands as they issue in
+// order, so in this pipeline the WAR check is a safeguard that never fires.
+func (p *Pipeline) checkScoreboard(i int, inst *Instruction) (waw, war bool) {
+	if inst.DestReg == NoReg {
+		return false, false
+	}
+
+	execute := p.Stages[p.executeIdx]
+	cycles := execute.Latency
+	if p.unitLatency != nil {
+		cycles = max(cycles, p.unitLatency(inst))
+	}
+	for _, older := range execute.contents() {
+		if older.Thread == inst.Thread && older.DestReg == inst.DestReg && older.CyclesLeft > cycles {
+			return true, false
+		}
+	}
+
+	for _, older := range p.Stages[i].contents() {
+		if older == inst {
+			break
+		}
+		if older.Thread == inst.Thread && slices.Contains(older.SrcRegs, inst.DestReg) {
+			return false, true
+		}
+	}
+
+	return false, false
+}
+
+// resultReady reports whether the result of producer, sitting in stage j,
+// can be forwarded. ALU results are available once Execute completes; loads
+// only once they have left the Memory stage.
+func (p *Pipeline) resultReady(j int, producer *Instruction) bool {
+	if producer.Type == "Memory" && p.memoryIdx > p.executeIdx {
+		return j > p.memoryIdx
+	}
+	return j > p.executeIdx
+}
+
+// GetHazardStalls returns the number of cycles instructions were stalled by
+// RAW data hazards
+func (p *Pipeline) GetHazardStalls() int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.hazardStalls
+}
+
+// GetScoreboardStalls returns the number of cycles instructions were held
+// back from Execute by WAW and by WAR hazards
+func (p *Pipeline) GetScoreboardStalls() (waw, war int64) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.wawStalls, p.warStalls
+}
+
+// GetForwardedHazards returns the number of RAW hazards resolved by
+// forwarding rather than a stall
+func (p *Pipeline) GetForwardedHazards() int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.forwarded
+}
+
+// SetForwarding enables or disables forwarding results to dependent
+// instructions ahead of Writeback
+func (p *Pipeline) SetForwarding(enabled bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.forwarding = enabled
+}
+
+// GetStructuralStalls returns the number of cycles instructions waited for a
+// free execution unit
+func (p *Pipeline) GetStructuralStalls() int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.structStalls
+}
+
+// SetDispatcher installs the function that assigns an instruction an
+// execution unit as it enters Execute. It returns the unit's latency, which
+// the instruction spends in Execute, or false if no unit is free, stalling
+// the instruction. A nil dispatcher never stalls.
+func (p *Pipeline) SetDispatcher(dispatch func(*Instruction) (int, bool)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.dispatch = dispatch
+}
+
+// SetUnitLatency installs the function that reports how many cycles an
+// instruction would spend in its execution unit, without claiming one, so
+// the scoreboard can tell whether it would finish before an older write to
+// the same register. Without one every instruction takes Execute's latency.
+func (p *Pipeline) SetUnitLatency(latency func(*Instruction) int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.unitLatency = latency
+}
+
+// SetExecutor installs the function that computes an instruction's result
+// as it enters Execute. forwarded returns the pending result for a register
+// when an older instruction still in flight produces it, and false if the
+// register file holds the current value.
+func (p *Pipeline) SetExecutor(execute func(inst *Instruction, forwarded func(reg int) (uint64, bool))) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.execute = execute
+}
+
+// SetWriteback installs the function called as each instruction retires
+// from the final stage, to commit its result
+func (p *Pipeline) SetWriteback(writeback func(*Instruction)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.writeback = writeback
+}
+
+// forwardedValue returns the result of the youngest instruction of thread
+// at or past Execute that writes reg, skipping those that compute no value
+func (p *Pipeline) forwardedValue(thread, reg int) (uint64, bool) {
+	if p.executeIdx < 0 {
+		return 0, false
+	}
+
+	for j := p.executeIdx; j < len(p.Stages); j++ {
+		insts := p.Stages[j].contents()
+		for k := len(insts) - 1; k >= 0; k-- {
+			if producer := insts[k]; producer.Thread == thread && producer.DestReg == reg && producer.HasResult {
+				return producer.Result, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// SetMemoryAccess installs the function that performs a Memory
+// instruction's data access as it enters the Memory stage (Execute if the
+// pipeline has none). It returns the access latency, which the instruction
+// spends in that stage, and false if the access cannot start this cycle, in
+// which case the instruction stays where it is and retries.
+func (p *Pipeline) SetMemoryAccess(access func(*Instruction) (int, bool)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.memAccess = access
+}
+
+// memAccessIdx returns the index of the stage where data accesses happen
+func (p *Pipeline) memAccessIdx() int {
+	if p.memoryIdx >= 0 {
+		return p.memoryIdx
+	}
+	return p.executeIdx
+}
+
+// SetPowerGating enables power-gating of stages idle for at least
+// idleThreshold cycles; waking a gated stage costs wakeLatency extra cycles.
+// An idleThreshold of 0 disables power-gating.
+func (p *Pipeline) SetPowerGating(idleThreshold, wakeLatency int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.gateThreshold = idleThreshold
+	p.wakeLatency = wakeLatency
+}
+
+// enterStage places inst behind any instructions already in stage, paying
+// the wake-up latency if the stage was power-gated
+func (p *Pipeline) enterStage(stage *Stage, inst *Instruction) {
+	if stage.Busy {
+		stage.Younger = append(stage.Younger, inst)
+	} else {
+		stage.Instruction = inst
+		stage.Busy = true
+	}
+	inst.CyclesLeft = stage.Latency
+
+	if stage.Gated {
+		stage.Gated = false
+		stage.Wakeups++
+		inst.CyclesLeft += p.wakeLatency
+	}
+	stage.idleCycles = 0
+}
+
+// updatePowerGating gates stages that have been idle long enough and counts
+// gated cycles
+func (p *Pipeline) updatePowerGating() {
+	if p.gateThreshold <= 0 {
+		return
+	}
+
+	for _, stage := range p.Stages {
+		if stage.Busy {
+			stage.idleCycles = 0
+			continue
+		}
+
+		stage.idleCycles++
+		if stage.idleCycles >= p.gateThreshold {
+			stage.Gated = true
+		}
+
+		if stage.Gated {
+			stage.GatedCycles++
+		}
+	}
+}
+
+// SkipIdle accounts for n cycles of an empty pipeline as if AdvanceStages
+// had run for each of them. The pipeline must hold no instructions.
+func (p *Pipeline) SkipIdle(n int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.resolving = nil
+	p.progressed = false
+	for _, stage := range p.Stages {
+		stage.stat.EmptyCycles += n
+		if p.gateThreshold <= 0 {
+			continue
+		}
+
+		// The stage gates on the cycle its idle count reaches the threshold
+		if !stage.Gated {
+			if wait := int64(p.gateThreshold - stage.idleCycles); wait <= n {
+				stage.Gated = true
+				stage.GatedCycles += n - max(wait, 1) + 1
+			}
+		} else {
+			stage.GatedCycles += n
+		}
+		stage.idleCycles += int(n)
+	}
+}
+
+// SetIssueWidth sets how many instructions each stage holds, and so how
+// many can be fetched and advanced per cycle
+func (p *Pipeline) SetIssueWidth(width int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if width < 1 {
+		width = 1
+	}
+	p.width = width
+}
+
+// SetStageLatencies overrides the latency of the stages named in latencies,
+// keeping the built-in latency of the others. Names this pipeline has no
+// stage for are ignored; latencies below 1 count as 1.
+func (p *Pipeline) SetStageLatencies(latencies map[string]int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, stage := range p.Stages {
+		if latency, ok := latencies[stage.Name]; ok {
+			stage.Latency = max(latency, 1)
+		}
+	}
+}
+
 // InsertInstruction inserts a new instruction into the first pipeline stage
 func (p *Pipeline) InsertInstruction(inst *Instruction) bool {
+	return p.InsertInstructions([]*Instruction{inst}) == 1
+}
+
+// InsertInstructions inserts instructions, in order, into the first pipeline
+// stage until it is full, returning how many were accepted
+func (p *Pipeline) InsertInstructions(insts []*Instruction) int {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	// Check if first stage is available
-	if p.Stages[0].Busy {
-		return false // Pipeline stalled
+	accepted := 0
+	for _, inst := range insts {
+		if !p.Stages[0].hasRoom(p.width) {
+			break // Pipeline stalled
+		}
+
+		inst.Seq = p.nextSeq
+		p.nextSeq++
+		p.enterStage(p.Stages[0], inst)
+		accepted++
 	}
 
-	// Insert instruction
-	p.Stages[0].Instruction = inst
-	p.Stages[0].Busy = true
-	inst.CyclesLeft = p.Stages[0].Latency
+	return accepted
+}
 
-	return true
+// FetchSlots returns how many more instructions the first stage can accept
+// this cycle
+func (p *Pipeline) FetchSlots() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.width - len(p.Stages[0].contents())
+}
+
+// ResolvingBranches returns the branches that entered the Execute stage
+// during the last AdvanceStages, oldest first
+func (p *Pipeline) ResolvingBranches() []*Instruction {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return append([]*Instruction(nil), p.resolving...)
+}
+
+// FlushReason is why the pipeline was flushed
+type FlushReason int
+
+const (
+	FlushMispredict FlushReason = iota // a branch resolved against its prediction
+	FlushException                     // an interrupt or memory fault
+	FlushCoherence                     // another core invalidated a line an in-flight load had read
+	numFlushReasons
+)
+
+// FlushReasons lists every flush reason
+var FlushReasons = []FlushReason{FlushMispredict, FlushException, FlushCoherence}
+
+func (r FlushReason) String() string {
+	switch r {
+	case FlushMispredict:
+		return "mispredict"
+	case FlushException:
+		return "exception"
+	case FlushCoherence:
+		return "coherence"
+	default:
+		return fmt.Sprintf("FlushReason(%d)", int(r))
+	}
+}
+
+// FlushAfter discards every instruction of branch's thread younger than
+// branch: those in the stages ahead of Execute and anything behind branch in
+// Execute itself, or when issuing out of order, anything younger in the
+// reorder buffer. Other threads' instructions stay in place. It counts as a
+// mispredict flush and returns the number of front-end stages flushed.
+func (p *Pipeline) FlushAfter(branch *Instruction) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.flushes[FlushMispredict]++
+	if p.executeIdx < 0 {
+		return 0
+	}
+
+	for _, stage := range p.Stages[:p.executeIdx] {
+		stage.setContents(otherThreads(stage.contents(), branch.Thread))
+	}
+
+	if p.outOfOrder() {
+		p.flushWindow(branch)
+		return p.executeIdx
+	}
+
+	execute := p.Stages[p.executeIdx]
+	insts := execute.contents()
+	for i, inst := range insts {
+		if inst == branch {
+			kept := append(insts[:i+1:i+1], otherThreads(insts[i+1:], branch.Thread)...)
+			execute.setContents(kept)
+			break
+		}
+	}
+
+	return p.executeIdx
+}
+
+// otherThreads returns the instructions in insts not fetched by thread
+func otherThreads(insts []*Instruction, thread int) []*Instruction {
+	var kept []*Instruction
+	for _, inst := range insts {
+		if inst.Thread != thread {
+			kept = append(kept, inst)
+		}
+	}
+	return kept
 }
 
 // IsFull checks if the pipeline is full (stalled)
@@ -188,7 +862,7 @@ func (p *Pipeline) IsFull() bool {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
-	return p.Stages[0].Busy
+	return !p.Stages[0].hasRoom(p.width)
 }
 
 // IsEmpty checks if the pipeline is empty
@@ -202,36 +876,390 @@ func (p *Pipeline) IsEmpty() bool {
 		}
 	}
 
+	return len(p.rob) == 0
+}
+
+// InFlight returns copies of every instruction in the pipeline, oldest
+// first
+func (p *Pipeline) InFlight() []*Instruction {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	insts := p.inFlight()
+	for i, inst := range insts {
+		c := copyInstruction(inst)
+		insts[i] = &c
+	}
+	return insts
+}
+
+// inFlight returns every instruction in the pipeline, oldest first
+func (p *Pipeline) inFlight() []*Instruction {
+	var insts []*Instruction
+	front := len(p.Stages)
+	if p.outOfOrder() {
+		for _, e := range p.rob {
+			insts = append(insts, e.inst)
+		}
+		front = p.executeIdx
+	}
+
+	for i := front - 1; i >= 0; i-- {
+		insts = append(insts, p.Stages[i].contents()...)
+	}
+	return insts
+}
+
+// Nullify marks the instructions of branch's thread that follow it in
+// program order, up to but not including end, as Nullified, discarding any
+// result they have computed. It returns false if it stopped at a younger
+// instruction outside that range, true if every younger one was inside it.
+func (p *Pipeline) Nullify(branch *Instruction, end uint64) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	start := branch.Address + uint64(branch.Length)
+	for _, inst := range p.inFlight() {
+		if inst.Thread != branch.Thread || inst.Seq <= branch.Seq {
+			continue
+		}
+		if inst.Address < start || inst.Address >= end {
+			return false
+		}
+		inst.Nullified, inst.HasResult = true, false
+	}
 	return true
 }
 
-// Flush clears all instructions from the pipeline
-func (p *Pipeline) Flush() {
+// Oldest returns a copy of the oldest instruction in flight and where it is
+// held: the name of its stage or, out of order, "reservation station" before
+// it issues and "reorder buffer" once it waits to retire. ok is false if the
+// pipeline is empty.
+func (p *Pipeline) Oldest() (inst *Instruction, where string, ok bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	var oldest *Instruction
+	switch {
+	case p.outOfOrder() && len(p.rob) > 0:
+		e := p.rob[0]
+		oldest, where = e.inst, "reorder buffer"
+		if !e.issued {
+			where = "reservation station"
+		}
+		if e.issued && !e.complete {
+			for _, stage := range p.Stages[p.executeIdx:] {
+				if slices.Contains(stage.contents(), oldest) {
+					where = stage.Name
+				}
+			}
+		}
+
+	default:
+		front := len(p.Stages)
+		if p.outOfOrder() {
+			front = p.executeIdx
+		}
+		for i := front - 1; i >= 0 && oldest == nil; i-- {
+			if p.Stages[i].Busy && p.Stages[i].Instruction != nil {
+				oldest, where = p.Stages[i].Instruction, p.Stages[i].Name
+			}
+		}
+	}
+
+	if oldest == nil {
+		return nil, "", false
+	}
+	c := copyInstruction(oldest)
+	return &c, where, true
+}
+
+// Progressed reports whether the last AdvanceStages moved any instruction
+// to another stage, issued it or retired it. A pipeline that holds
+// instructions but did not progress spent the cycle waiting on hazards,
+// execution units or memory.
+func (p *Pipeline) Progressed() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.progressed
+}
+
+// Flush clears all instructions from the pipeline, counting a flush for
+// reason
+func (p *Pipeline) Flush(reason FlushReason) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.flushes[reason]++
+	p.resolving = nil
+	p.progressed = false
+	p.rob = nil
+	for _, stage := range p.Stages {
+		stage.clear()
+	}
+}
+
+// Reset flushes the pipeline and zeroes its retirement, hazard and
+// power-gating counters
+func (p *Pipeline) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.hazardStalls = 0
+	p.wawStalls, p.warStalls = 0, 0
+	p.forwarded = 0
+	p.structStalls = 0
+	p.retired = 0
+	p.flushes = [numFlushReasons]int64{}
+	p.resolving = nil
+	p.progressed = false
+	p.rob = nil
+	p.nextSeq = 0
+
+	for _, stage := range p.Stages {
+		stage.clear()
+		stage.Gated = false
+		stage.GatedCycles = 0
+		stage.Wakeups = 0
+		stage.idleCycles = 0
+		stage.stat = StageStat{}
+	}
+}
+
+// ResetStats zeroes the counters, keeping the instructions in flight
+func (p *Pipeline) ResetStats() {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	p.hazardStalls = 0
+	p.wawStalls, p.warStalls = 0, 0
+	p.forwarded = 0
+	p.structStalls = 0
+	p.retired = 0
+	p.flushes = [numFlushReasons]int64{}
+
 	for _, stage := range p.Stages {
-		stage.Instruction = nil
-		stage.Busy = false
+		stage.GatedCycles = 0
+		stage.Wakeups = 0
+		stage.stat = StageStat{}
+	}
+}
+
+// StageStats returns each stage's busy, stall and empty cycle counts and
+// its power-gating counters
+func (p *Pipeline) StageStats() []StageStat {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	stats := make([]StageStat, len(p.Stages))
+	for i, stage := range p.Stages {
+		stats[i] = stage.stat
+		stats[i].Name = stage.Name
+		stats[i].GatedCycles = stage.GatedCycles
+		stats[i].Wakeups = stage.Wakeups
 	}
+	return stats
 }
 
-// GetStages returns a copy of the pipeline stages (for observation)
+// GetStages returns a copy of the pipeline stages (for observation). The
+// instructions are copied too, so the result shares nothing with the live
+// pipeline.
 func (p *Pipeline) GetStages() []*Stage {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
+	detach := func(inst *Instruction) *Instruction {
+		c := copyInstruction(inst)
+		return &c
+	}
+
 	stagesCopy := make([]*Stage, len(p.Stages))
 	for i, stage := range p.Stages {
 		stageCopy := *stage // Make a copy of the stage
+		if stage.Instruction != nil {
+			stageCopy.Instruction = detach(stage.Instruction)
+		}
+
+		stageCopy.Younger = nil
+		for _, inst := range stage.Younger {
+			stageCopy.Younger = append(stageCopy.Younger, detach(inst))
+		}
 		stagesCopy[i] = &stageCopy
 	}
 
 	return stagesCopy
 }
 
-// GetCompletedInstructions returns the number of instructions that have completed execution
+// Flushes returns how many times the pipeline was flushed for reason
+func (p *Pipeline) Flushes(reason FlushReason) int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.flushes[reason]
+}
+
+// FrontEndStages returns the number of stages ahead of Execute, which an
+// instruction crosses before doing useful work
+func (p *Pipeline) FrontEndStages() int {
+	return max(p.executeIdx, 0)
+}
+
+// GetCompletedInstructions returns the number of instructions that have
+// retired from the final stage, or the reorder buffer when issuing out of
+// order
 func (p *Pipeline) GetCompletedInstructions() int64 {
-	// Not implemented in this version - will be tracked by processor
-	return 0
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.retired
+}
+
+// Snapshot is a copy of a pipeline's in-flight instructions and counters,
+// for checkpointing
+type Snapshot struct {
+	Stages       []StageSnapshot
+	HazardStalls int64
+	WAWStalls    int64
+	WARStalls    int64
+	Forwarded    int64
+	StructStalls int64
+	Retired      int64
+	Flushes      [numFlushReasons]int64
+	ROB          []ROBEntrySnapshot // oldest first, out-of-order only
+	NextSeq      uint64
+}
+
+// ROBEntrySnapshot is a copy of one reorder buffer entry. Issued
+// instructions also appear in the stage they occupy, with the same Seq.
+type ROBEntrySnapshot struct {
+	Instruction Instruction
+	Issued      bool
+	Complete    bool
+}
+
+// StageSnapshot is a copy of one stage's contents and counters
+type StageSnapshot struct {
+	Name         string
+	Instructions []Instruction // oldest first
+	Gated        bool
+	GatedCycles  int64
+	Wakeups      int64
+	IdleCycles   int
+	Stat         StageStat
+}
+
+// copyInstruction returns a copy of inst that shares no slices with it
+func copyInstruction(inst *Instruction) Instruction {
+	c := *inst
+	c.Operands = append([]uint8(nil), inst.Operands...)
+	c.SrcRegs = append([]int(nil), inst.SrcRegs...)
+	return c
+}
+
+// Snapshot returns a copy of the pipeline's state
+func (p *Pipeline) Snapshot() Snapshot {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	snap := Snapshot{
+		Stages:       make([]StageSnapshot, len(p.Stages)),
+		HazardStalls: p.hazardStalls,
+		WAWStalls:    p.wawStalls,
+		WARStalls:    p.warStalls,
+		Forwarded:    p.forwarded,
+		StructStalls: p.structStalls,
+		Retired:      p.retired,
+		Flushes:      p.flushes,
+		NextSeq:      p.nextSeq,
+	}
+
+	for _, e := range p.rob {
+		snap.ROB = append(snap.ROB, ROBEntrySnapshot{
+			Instruction: copyInstruction(e.inst),
+			Issued:      e.issued,
+			Complete:    e.complete,
+		})
+	}
+
+	for i, stage := range p.Stages {
+		s := StageSnapshot{
+			Name:        stage.Name,
+			Gated:       stage.Gated,
+			GatedCycles: stage.GatedCycles,
+			Wakeups:     stage.Wakeups,
+			IdleCycles:  stage.idleCycles,
+			Stat:        stage.stat,
+		}
+		for _, inst := range stage.contents() {
+			s.Instructions = append(s.Instructions, copyInstruction(inst))
+		}
+		snap.Stages[i] = s
+	}
+
+	return snap
+}
+
+// Restore replaces the pipeline's state with snap, which must come from a
+// pipeline with the same stages
+func (p *Pipeline) Restore(snap Snapshot) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(snap.Stages) != len(p.Stages) {
+		return fmt.Errorf("snapshot has %d stages, pipeline has %d", len(snap.Stages), len(p.Stages))
+	}
+
+	for i, s := range snap.Stages {
+		if len(s.Instructions) > p.width {
+			return fmt.Errorf("snapshot stage %s holds %d instructions, issue width is %d", p.Stages[i].Name, len(s.Instructions), p.width)
+		}
+	}
+
+	if len(snap.ROB) > p.robSize {
+		return fmt.Errorf("snapshot reorder buffer holds %d instructions, size is %d", len(snap.ROB), p.robSize)
+	}
+
+	p.hazardStalls = snap.HazardStalls
+	p.wawStalls, p.warStalls = snap.WAWStalls, snap.WARStalls
+	p.forwarded = snap.Forwarded
+	p.structStalls = snap.StructStalls
+	p.retired = snap.Retired
+	p.flushes = snap.Flushes
+	p.nextSeq = snap.NextSeq
+	p.resolving = nil
+
+	// Issued instructions are shared between the reorder buffer and a stage
+	p.rob = nil
+	issued := make(map[uint64]*Instruction)
+	for _, e := range snap.ROB {
+		inst := copyInstruction(&e.Instruction)
+		p.rob = append(p.rob, &robEntry{inst: &inst, issued: e.Issued, complete: e.Complete})
+		if e.Issued {
+			issued[inst.Seq] = &inst
+		}
+	}
+
+	for i, s := range snap.Stages {
+		stage := p.Stages[i]
+
+		insts := make([]*Instruction, len(s.Instructions))
+		for j := range s.Instructions {
+			if shared, ok := issued[s.Instructions[j].Seq]; ok && i >= p.executeIdx {
+				insts[j] = shared
+				continue
+			}
+			inst := copyInstruction(&s.Instructions[j])
+			insts[j] = &inst
+		}
+		stage.setContents(insts)
+
+		stage.Gated = s.Gated
+		stage.GatedCycles = s.GatedCycles
+		stage.Wakeups = s.Wakeups
+		stage.idleCycles = s.IdleCycles
+		stage.stat = s.Stat
+	}
+
+	return nil
 }
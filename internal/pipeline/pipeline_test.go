@@ -1,6 +1,9 @@
 package pipeline
 
 import (
+	"fmt"
+	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -150,6 +153,10 @@ func TestPipelineMultiCycleStage(t *testing.T) {
 		t.Fatalf("Instruction should be in decode stage")
 	}
 
+	if !pipe.Progressed() {
+		t.Errorf("Progressed() = false after the instruction moved")
+	}
+
 	// After 1 more cycle, instruction should still be in decode
 	pipe.AdvanceStages()
 	if !pipe.Stages[1].Busy || pipe.Stages[1].Instruction == nil {
@@ -162,6 +169,11 @@ func TestPipelineMultiCycleStage(t *testing.T) {
 		t.Fatalf("Instruction should still be in decode stage")
 	}
 
+	// Waiting out a stage's latency is not progress
+	if pipe.Progressed() {
+		t.Errorf("Progressed() = true while the instruction waited in decode")
+	}
+
 	// After 1 more cycle, instruction should move to execute
 	pipe.AdvanceStages()
 	if !pipe.Stages[2].Busy || pipe.Stages[2].Instruction == nil {
@@ -169,6 +181,82 @@ func TestPipelineMultiCycleStage(t *testing.T) {
 	}
 }
 
+func TestPipelineDecodeCost(t *testing.T) {
+	tests := []struct {
+		name       string
+		depth      int
+		isa        string
+		decodeCost int
+		wantStage  string
+		wantCycles int // cycles spent in the first decode stage
+	}{
+		{name: "RISC-V", depth: 5, isa: "RISC-V", decodeCost: 0, wantStage: "Decode", wantCycles: 1},
+		{name: "x86, short encoding", depth: 6, isa: "x86", decodeCost: 0, wantStage: "Decode", wantCycles: 2},
+		{name: "x86, long encoding", depth: 6, isa: "x86", decodeCost: 3, wantStage: "Decode", wantCycles: 5},
+		{name: "Deep x86 charges Decode1 only", depth: 11, isa: "x86", decodeCost: 2, wantStage: "Decode1", wantCycles: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe, err := NewPipeline(tt.depth, tt.isa)
+			if err != nil {
+				t.Fatalf("NewPipeline() error = %v", err)
+			}
+
+			inst := &Instruction{Address: 0x1000, Type: "Integer", DestReg: NoReg, DecodeCost: tt.decodeCost}
+			pipe.InsertInstruction(inst)
+
+			decode := -1
+			for i, stage := range pipe.Stages {
+				if stage.Name == tt.wantStage {
+					decode = i
+				}
+			}
+
+			cycles := 0
+			for i := 0; i < 20; i++ {
+				pipe.AdvanceStages()
+				if pipe.Stages[decode].Instruction == inst {
+					cycles++
+				}
+			}
+
+			if cycles != tt.wantCycles {
+				t.Errorf("Instruction spent %d cycles in %s, want %d", cycles, tt.wantStage, tt.wantCycles)
+			}
+		})
+	}
+}
+
+func TestSetStageLatencies(t *testing.T) {
+	pipe, err := NewPipeline(5, "RISC-V")
+	if err != nil {
+		t.Fatalf("NewPipeline() error = %v", err)
+	}
+	pipe.SetStageLatencies(map[string]int{"Decode": 3, "Memory": 0, "Rename": 2})
+
+	// Rename is not a stage here, and Memory is clamped to a single cycle
+	want := map[string]int{"Fetch": 1, "Decode": 3, "Execute": 1, "Memory": 1, "Writeback": 1}
+	for _, stage := range pipe.Stages {
+		if stage.Latency != want[stage.Name] {
+			t.Errorf("%s latency = %d, want %d", stage.Name, stage.Latency, want[stage.Name])
+		}
+	}
+
+	inst := &Instruction{Address: 0x1000, Type: "Integer", DestReg: NoReg}
+	pipe.InsertInstruction(inst)
+	cycles := 0
+	for i := 0; i < 20; i++ {
+		pipe.AdvanceStages()
+		if pipe.Stages[1].Instruction == inst {
+			cycles++
+		}
+	}
+	if cycles != 3 {
+		t.Errorf("Instruction spent %d cycles in Decode, want 3", cycles)
+	}
+}
+
 func TestPipelineFlush(t *testing.T) {
 	pipe, err := NewPipeline(5, "RISC-V")
 	if err != nil {
@@ -195,13 +283,20 @@ func TestPipelineFlush(t *testing.T) {
 	}
 
 	// Flush pipeline
-	pipe.Flush()
+	pipe.Flush(FlushException)
 
 	// Check if all stages are empty
 	if !pipe.IsEmpty() {
 		t.Errorf("Pipeline not empty after flush")
 	}
 
+	if got := pipe.Flushes(FlushException); got != 1 {
+		t.Errorf("Flushes(FlushException) = %d, want 1", got)
+	}
+	if got := pipe.Flushes(FlushMispredict); got != 0 {
+		t.Errorf("Flushes(FlushMispredict) = %d, want 0", got)
+	}
+
 	for i, stage := range pipe.Stages {
 		if stage.Busy {
 			t.Errorf("Stage %d still busy after flush", i)
@@ -293,3 +388,983 @@ func TestPipelineStall(t *testing.T) {
 		t.Fatalf("Fetch should still have the second instruction")
 	}
 }
+
+func TestPipelinePowerGating(t *testing.T) {
+	// cyclesToDrain inserts one instruction and counts cycles until it retires
+	cyclesToDrain := func(pipe *Pipeline) int {
+		pipe.InsertInstruction(&Instruction{
+			Address:    0x1000,
+			Opcode:     0x01,
+			Operands:   []uint8{1, 2, 3},
+			Type:       "Integer",
+			CyclesLeft: 1,
+		})
+
+		cycles := 0
+		for !pipe.IsEmpty() && cycles < 100 {
+			pipe.AdvanceStages()
+			cycles++
+		}
+		return cycles
+	}
+
+	ungated, _ := NewPipeline(5, "RISC-V")
+	baseline := cyclesToDrain(ungated)
+
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetPowerGating(3, 2)
+
+	// A long idle spell leaves every stage idle
+	for i := 0; i < 10; i++ {
+		pipe.AdvanceStages()
+	}
+
+	for i, stage := range pipe.StageStats() {
+		if !pipe.Stages[i].Gated {
+			t.Errorf("Stage %d (%s) not gated after 10 idle cycles", i, stage.Name)
+		}
+
+		if stage.GatedCycles != 8 {
+			t.Errorf("Stage %d (%s) GatedCycles = %d, want 8", i, stage.Name, stage.GatedCycles)
+		}
+	}
+
+	// Waking each of the five stages costs two extra cycles
+	gated := cyclesToDrain(pipe)
+	if gated != baseline+5*2 {
+		t.Errorf("Drain after power-gating took %d cycles, want %d", gated, baseline+5*2)
+	}
+
+	for i, stage := range pipe.StageStats() {
+		if stage.Wakeups != 1 {
+			t.Errorf("Stage %d (%s) Wakeups = %d, want 1", i, stage.Name, stage.Wakeups)
+		}
+	}
+
+	// Reset clears the gating state and counters
+	pipe.Reset()
+	for i, stage := range pipe.Stages {
+		if stage.Gated || stage.GatedCycles != 0 || stage.Wakeups != 0 {
+			t.Errorf("Stage %d (%s) gating state not cleared by Reset()", i, stage.Name)
+		}
+	}
+}
+
+func TestPipelinePowerGatingFrontEndStall(t *testing.T) {
+	// A 12-cycle fetch holds the instruction in Fetch while the stages
+	// behind it sit idle
+	slowFetch := map[string]int{"Fetch": 12}
+
+	ungated, _ := NewPipeline(5, "RISC-V")
+	ungated.SetStageLatencies(slowFetch)
+	ungated.InsertInstruction(&Instruction{Address: 0x1000, Opcode: 0x01, Operands: []uint8{1, 2, 3}, Type: "Integer"})
+	baseline := 0
+	for !ungated.IsEmpty() && baseline < 100 {
+		ungated.AdvanceStages()
+		baseline++
+	}
+
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetStageLatencies(slowFetch)
+	pipe.SetPowerGating(3, 2)
+	pipe.InsertInstruction(&Instruction{Address: 0x1000, Opcode: 0x01, Operands: []uint8{1, 2, 3}, Type: "Integer"})
+	for i := 0; i < 11; i++ {
+		pipe.AdvanceStages()
+	}
+
+	// Fetch stays powered; the back end gates after 3 idle cycles
+	for i, stage := range pipe.StageStats() {
+		wantGated, wantCycles := i > 0, int64(0)
+		if wantGated {
+			wantCycles = 9
+		}
+		if pipe.Stages[i].Gated != wantGated || stage.GatedCycles != wantCycles {
+			t.Errorf("Stage %d (%s) gated = %v for %d cycles during the fetch stall, want %v for %d",
+				i, stage.Name, pipe.Stages[i].Gated, stage.GatedCycles, wantGated, wantCycles)
+		}
+	}
+
+	cycles := 11
+	for !pipe.IsEmpty() && cycles < 100 {
+		pipe.AdvanceStages()
+		cycles++
+	}
+
+	// Only the four back-end stages pay the wake-up latency
+	if cycles != baseline+4*2 {
+		t.Errorf("Run with a gated back end took %d cycles, want %d", cycles, baseline+4*2)
+	}
+
+	for i, stage := range pipe.StageStats() {
+		if want := int64(min(i, 1)); stage.Wakeups != want {
+			t.Errorf("Stage %d (%s) Wakeups = %d, want %d", i, stage.Name, stage.Wakeups, want)
+		}
+	}
+}
+
+// runPair inserts two back-to-back instructions, advances until the
+// pipeline drains and returns the cycles taken
+func runPair(t *testing.T, pipe *Pipeline, first, second *Instruction) int {
+	t.Helper()
+
+	if !pipe.InsertInstruction(first) {
+		t.Fatalf("Failed to insert first instruction")
+	}
+
+	cycles := 0
+	pending := second
+	for (pending != nil || !pipe.IsEmpty()) && cycles < 100 {
+		pipe.AdvanceStages()
+		if pending != nil && pipe.InsertInstruction(pending) {
+			pending = nil
+		}
+		cycles++
+	}
+	return cycles
+}
+
+func TestPipelineRAWHazard(t *testing.T) {
+	producer := func() *Instruction {
+		return &Instruction{Address: 0x1000, Type: "Integer", DestReg: 1, SrcRegs: []int{2, 3}}
+	}
+
+	independent, _ := NewPipeline(5, "RISC-V")
+	baseline := runPair(t, independent, producer(),
+		&Instruction{Address: 0x1004, Type: "Integer", DestReg: 4, SrcRegs: []int{5, 6}})
+
+	if independent.GetHazardStalls() != 0 {
+		t.Errorf("Independent pair stalled %d cycles, want 0", independent.GetHazardStalls())
+	}
+
+	dependent, _ := NewPipeline(5, "RISC-V")
+	cycles := runPair(t, dependent, producer(),
+		&Instruction{Address: 0x1004, Type: "Integer", DestReg: 4, SrcRegs: []int{1, 6}})
+
+	if dependent.GetHazardStalls() == 0 {
+		t.Errorf("Dependent pair did not stall on a RAW hazard")
+	}
+
+	if cycles <= baseline {
+		t.Errorf("Dependent pair took %d cycles, want more than independent pair's %d", cycles, baseline)
+	}
+
+	// An instruction without a destination creates no hazard
+	noDest, _ := NewPipeline(5, "RISC-V")
+	runPair(t, noDest,
+		&Instruction{Address: 0x1000, Type: "Branch", DestReg: NoReg, SrcRegs: []int{1, 2}},
+		&Instruction{Address: 0x1004, Type: "Integer", DestReg: 4, SrcRegs: []int{1, 2}})
+
+	if noDest.GetHazardStalls() != 0 {
+		t.Errorf("Instruction without a destination caused %d stall cycles", noDest.GetHazardStalls())
+	}
+
+	// Threads have separate register files, so the same register number
+	// in another thread is not a dependency
+	otherThread, _ := NewPipeline(5, "RISC-V")
+	runPair(t, otherThread, producer(),
+		&Instruction{Address: 0x1004, Type: "Integer", DestReg: 4, SrcRegs: []int{1, 6}, Thread: 1})
+
+	if otherThread.GetHazardStalls() != 0 {
+		t.Errorf("Instruction from another thread caused %d stall cycles", otherThread.GetHazardStalls())
+	}
+
+	dependent.Reset()
+	if dependent.GetHazardStalls() != 0 {
+		t.Errorf("Reset() did not clear hazard stalls")
+	}
+}
+
+func TestPipelineForwarding(t *testing.T) {
+	consumer := func() *Instruction {
+		return &Instruction{Address: 0x1004, Type: "Integer", DestReg: 4, SrcRegs: []int{1, 6}}
+	}
+
+	tests := []struct {
+		name          string
+		producerType  string
+		wantForwarded bool // dependency resolved without any stall
+	}{
+		{name: "ALU result is forwarded from Memory", producerType: "Integer", wantForwarded: true},
+		{name: "Load result stalls until after Memory", producerType: "Memory", wantForwarded: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := func() *Instruction {
+				return &Instruction{Address: 0x1000, Type: tt.producerType, DestReg: 1, SrcRegs: []int{2, 3}}
+			}
+
+			off, _ := NewPipeline(5, "RISC-V")
+			offCycles := runPair(t, off, producer(), consumer())
+
+			on, _ := NewPipeline(5, "RISC-V")
+			on.SetForwarding(true)
+			onCycles := runPair(t, on, producer(), consumer())
+
+			if onCycles >= offCycles {
+				t.Errorf("Forwarding took %d cycles, want fewer than %d without", onCycles, offCycles)
+			}
+
+			if on.GetForwardedHazards() != 1 {
+				t.Errorf("GetForwardedHazards() = %d, want 1", on.GetForwardedHazards())
+			}
+
+			if gotStall := on.GetHazardStalls() != 0; gotStall == tt.wantForwarded {
+				t.Errorf("GetHazardStalls() = %d with forwarding, want stall %v",
+					on.GetHazardStalls(), !tt.wantForwarded)
+			}
+
+			if off.GetForwardedHazards() != 0 {
+				t.Errorf("GetForwardedHazards() = %d without forwarding, want 0", off.GetForwardedHazards())
+			}
+		})
+	}
+}
+
+func TestPipelineDispatcher(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+
+	free := false
+	pipe.SetDispatcher(func(inst *Instruction) (int, bool) { return 1, free })
+
+	pipe.InsertInstruction(&Instruction{Address: 0x1000, Type: "Integer", DestReg: NoReg})
+	for i := 0; i < 5; i++ {
+		pipe.AdvanceStages()
+	}
+
+	if pipe.Stages[pipe.executeIdx].Busy {
+		t.Errorf("Instruction entered Execute without an execution unit")
+	}
+
+	if got := pipe.GetStructuralStalls(); got != 4 {
+		t.Errorf("GetStructuralStalls() = %d, want 4", got)
+	}
+
+	free = true
+	pipe.AdvanceStages()
+	if !pipe.Stages[pipe.executeIdx].Busy {
+		t.Errorf("Instruction did not enter Execute once a unit was free")
+	}
+
+	pipe.Reset()
+	if pipe.GetStructuralStalls() != 0 {
+		t.Errorf("Reset() did not clear structural stalls")
+	}
+}
+
+func TestPipelineUnitLatency(t *testing.T) {
+	drain := func(latency int) int {
+		pipe, _ := NewPipeline(5, "RISC-V")
+		pipe.SetDispatcher(func(inst *Instruction) (int, bool) { return latency, true })
+		return runPair(t, pipe, &Instruction{Address: 0x1000, Type: "Float", DestReg: NoReg}, nil)
+	}
+
+	single, triple := drain(1), drain(3)
+	if triple != single+2 {
+		t.Errorf("3-cycle unit drained in %d cycles, want %d", triple, single+2)
+	}
+}
+
+func TestPipelineRetirement(t *testing.T) {
+	const n = 10
+	pipe, _ := NewPipeline(5, "RISC-V")
+
+	inserted := 0
+	for cycles := 0; (inserted < n || !pipe.IsEmpty()) && cycles < 100; cycles++ {
+		pipe.AdvanceStages()
+		if inserted < n && pipe.InsertInstruction(&Instruction{
+			Address: uint64(0x1000 + 4*inserted),
+			Type:    "Integer",
+			DestReg: NoReg,
+		}) {
+			inserted++
+		}
+	}
+
+	if got := pipe.GetCompletedInstructions(); got != n {
+		t.Errorf("GetCompletedInstructions() = %d, want %d", got, n)
+	}
+
+	// Flushed instructions never retire
+	pipe.InsertInstruction(&Instruction{Address: 0x2000, Type: "Integer", DestReg: NoReg})
+	pipe.Flush(FlushException)
+	pipe.AdvanceStages()
+	if got := pipe.GetCompletedInstructions(); got != n {
+		t.Errorf("GetCompletedInstructions() after Flush() = %d, want %d", got, n)
+	}
+
+	pipe.Reset()
+	if got := pipe.GetCompletedInstructions(); got != 0 {
+		t.Errorf("GetCompletedInstructions() after Reset() = %d, want 0", got)
+	}
+}
+
+func TestPipelineIssueWidth(t *testing.T) {
+	// throughput feeds an independent stream for 100 cycles and returns
+	// instructions retired per cycle
+	throughput := func(width int) float64 {
+		pipe, _ := NewPipeline(5, "RISC-V")
+		pipe.SetIssueWidth(width)
+
+		addr := uint64(0x1000)
+		for cycle := 0; cycle < 100; cycle++ {
+			pipe.AdvanceStages()
+
+			group := make([]*Instruction, width+1) // one more than fits
+			for i := range group {
+				group[i] = &Instruction{Address: addr, Type: "Integer", DestReg: NoReg}
+				addr += 4
+			}
+
+			accepted := pipe.InsertInstructions(group)
+			if accepted > width {
+				t.Fatalf("InsertInstructions() accepted %d, want at most %d", accepted, width)
+			}
+			addr -= uint64(len(group)-accepted) * 4
+		}
+
+		return float64(pipe.GetCompletedInstructions()) / 100
+	}
+
+	if ipc := throughput(1); ipc > 1.0 {
+		t.Errorf("Scalar pipeline retired %.2f instructions per cycle, want at most 1", ipc)
+	}
+
+	if ipc := throughput(4); ipc <= 1.0 {
+		t.Errorf("4-wide pipeline retired %.2f instructions per cycle, want more than 1", ipc)
+	}
+}
+
+func TestPipelineIssueWidth_InOrderHazard(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetIssueWidth(2)
+
+	// The second instruction depends on the first; without forwarding it
+	// cannot enter Execute alongside its producer
+	accepted := pipe.InsertInstructions([]*Instruction{
+		{Address: 0x1000, Type: "Integer", DestReg: 1, SrcRegs: []int{2, 3}},
+		{Address: 0x1004, Type: "Integer", DestReg: 4, SrcRegs: []int{1, 5}},
+	})
+	if accepted != 2 {
+		t.Fatalf("InsertInstructions() = %d, want 2", accepted)
+	}
+
+	pipe.AdvanceStages() // Fetch -> Decode
+	pipe.AdvanceStages() // Decode -> Execute, consumer held back
+
+	stages := pipe.GetStages()
+	if got := stages[2].Instruction; got == nil || got.Address != 0x1000 || len(stages[2].Younger) != 0 {
+		t.Errorf("Execute should hold only the producer")
+	}
+
+	if got := stages[1].Instruction; got == nil || got.Address != 0x1004 {
+		t.Errorf("Decode should still hold the dependent instruction")
+	}
+
+	if pipe.GetHazardStalls() != 1 {
+		t.Errorf("GetHazardStalls() = %d, want 1", pipe.GetHazardStalls())
+	}
+}
+
+func TestPipelineScoreboard(t *testing.T) {
+	// Float instructions take 3 cycles in their unit, Integer ones 1
+	latency := func(inst *Instruction) int {
+		if inst.Type == "Float" {
+			return 3
+		}
+		return 1
+	}
+
+	tests := []struct {
+		name    string
+		older   *Instruction
+		younger *Instruction
+		wantWAW int64
+	}{
+		{
+			name:    "fast write behind slow write",
+			older:   &Instruction{Address: 0x1000, Type: "Float", DestReg: 1, SrcRegs: []int{2, 3}},
+			younger: &Instruction{Address: 0x1004, Type: "Integer", DestReg: 1, SrcRegs: []int{4, 5}},
+			wantWAW: 2,
+		},
+		{
+			name:    "different destinations",
+			older:   &Instruction{Address: 0x1000, Type: "Float", DestReg: 1, SrcRegs: []int{2, 3}},
+			younger: &Instruction{Address: 0x1004, Type: "Integer", DestReg: 6, SrcRegs: []int{4, 5}},
+		},
+		{
+			name:    "slow write behind fast write",
+			older:   &Instruction{Address: 0x1000, Type: "Integer", DestReg: 1, SrcRegs: []int{2, 3}},
+			younger: &Instruction{Address: 0x1004, Type: "Float", DestReg: 1, SrcRegs: []int{4, 5}},
+		},
+		{
+			name:    "equal latencies",
+			older:   &Instruction{Address: 0x1000, Type: "Float", DestReg: 1, SrcRegs: []int{2, 3}},
+			younger: &Instruction{Address: 0x1004, Type: "Float", DestReg: 1, SrcRegs: []int{4, 5}},
+		},
+		{
+			name:    "other thread",
+			older:   &Instruction{Address: 0x1000, Type: "Float", DestReg: 1, SrcRegs: []int{2, 3}},
+			younger: &Instruction{Address: 0x1004, Type: "Integer", DestReg: 1, SrcRegs: []int{4, 5}, Thread: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe, _ := NewPipeline(5, "RISC-V")
+			pipe.SetIssueWidth(2)
+			pipe.SetDispatcher(func(inst *Instruction) (int, bool) { return latency(inst), true })
+			pipe.SetUnitLatency(latency)
+
+			var retired []uint64
+			pipe.SetWriteback(func(inst *Instruction) { retired = append(retired, inst.Address) })
+
+			if accepted := pipe.InsertInstructions([]*Instruction{tt.older, tt.younger}); accepted != 2 {
+				t.Fatalf("InsertInstructions() = %d, want 2", accepted)
+			}
+			for cycles := 0; !pipe.IsEmpty() && cycles < 20; cycles++ {
+				pipe.AdvanceStages()
+			}
+
+			waw, war := pipe.GetScoreboardStalls()
+			if waw != tt.wantWAW || war != 0 {
+				t.Errorf("GetScoreboardStalls() = %d, %d, want %d, 0", waw, war, tt.wantWAW)
+			}
+			if !slices.Equal(retired, []uint64{0x1000, 0x1004}) {
+				t.Errorf("Retired %#x, want both instructions in program order", retired)
+			}
+		})
+	}
+
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetIssueWidth(2)
+	pipe.SetUnitLatency(latency)
+	pipe.InsertInstructions([]*Instruction{tests[0].older, tests[0].younger})
+	for !pipe.IsEmpty() {
+		pipe.AdvanceStages()
+	}
+	pipe.Reset()
+	if waw, war := pipe.GetScoreboardStalls(); waw != 0 || war != 0 {
+		t.Errorf("GetScoreboardStalls() after Reset() = %d, %d, want 0, 0", waw, war)
+	}
+}
+
+func TestPipelineScoreboard_WAR(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+
+	// An older instruction still waiting in Decode reads the register the
+	// younger one writes
+	reader := &Instruction{Address: 0x1000, Type: "Integer", DestReg: 2, SrcRegs: []int{1, 3}}
+	writer := &Instruction{Address: 0x1004, Type: "Integer", DestReg: 1, SrcRegs: []int{4, 5}}
+	pipe.Stages[1].setContents([]*Instruction{reader, writer})
+
+	if waw, war := pipe.checkScoreboard(1, writer); waw || !war {
+		t.Errorf("checkScoreboard() = %v, %v, want a WAR hazard", waw, war)
+	}
+	if waw, war := pipe.checkScoreboard(1, reader); waw || war {
+		t.Errorf("checkScoreboard() for the oldest instruction = %v, %v, want no hazard", waw, war)
+	}
+}
+
+func TestPipelineFlushAfter(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetIssueWidth(2)
+
+	branch := &Instruction{Address: 0x1000, Type: "Branch", DestReg: NoReg}
+	pipe.InsertInstructions([]*Instruction{
+		branch,
+		{Address: 0x1004, Type: "Integer", DestReg: NoReg},
+	})
+	pipe.AdvanceStages()
+	pipe.AdvanceStages()
+	pipe.InsertInstruction(&Instruction{Address: 0x1008, Type: "Integer", DestReg: NoReg})
+
+	if got := pipe.ResolvingBranches(); len(got) != 1 || got[0] != branch {
+		t.Fatalf("ResolvingBranches() = %v, want the branch", got)
+	}
+
+	if flushed := pipe.FlushAfter(branch); flushed != 2 {
+		t.Errorf("FlushAfter() = %d, want 2 front-end stages", flushed)
+	}
+
+	stages := pipe.GetStages()
+	if stages[0].Busy || stages[1].Busy {
+		t.Errorf("Front-end stages still busy after FlushAfter()")
+	}
+
+	if got := stages[2].Instruction; got == nil || got.Address != branch.Address || len(stages[2].Younger) != 0 {
+		t.Errorf("Execute should hold only the branch after FlushAfter()")
+	}
+}
+
+func TestPipelineMemoryAccess(t *testing.T) {
+	drain := func(instType string) int {
+		pipe, _ := NewPipeline(5, "RISC-V")
+		pipe.SetMemoryAccess(func(inst *Instruction) (int, bool) { return 10, true })
+		return runPair(t, pipe, &Instruction{Address: 0x1000, Type: instType, DestReg: NoReg}, nil)
+	}
+
+	alu, load := drain("Integer"), drain("Memory")
+	if load != alu+9 {
+		t.Errorf("10-cycle load drained in %d cycles, want %d", load, alu+9)
+	}
+
+	// A refused access holds the instruction and retries next cycle
+	refusals := 3
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetMemoryAccess(func(inst *Instruction) (int, bool) {
+		if refusals > 0 {
+			refusals--
+			return 0, false
+		}
+		return 10, true
+	})
+	if got := runPair(t, pipe, &Instruction{Address: 0x1000, Type: "Memory", DestReg: NoReg}, nil); got != load+3 {
+		t.Errorf("Load refused 3 times drained in %d cycles, want %d", got, load+3)
+	}
+}
+
+func TestPipelineOldest(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	if _, _, ok := pipe.Oldest(); ok {
+		t.Error("Oldest() of an empty pipeline should report nothing")
+	}
+
+	// A long load holds the oldest instruction in Memory behind a younger one
+	pipe.SetMemoryAccess(func(inst *Instruction) (int, bool) { return 50, true })
+	pipe.InsertInstruction(&Instruction{Address: 0x1000, Type: "Memory", DestReg: NoReg})
+	pipe.AdvanceStages()
+	pipe.InsertInstruction(&Instruction{Address: 0x1004, Type: "Integer", DestReg: NoReg})
+	for i := 0; i < 5; i++ {
+		pipe.AdvanceStages()
+	}
+
+	inst, where, ok := pipe.Oldest()
+	if !ok || inst.Address != 0x1000 || where != "Memory" {
+		t.Errorf("Oldest() = %+v in %q, want the load at 0x1000 in Memory", inst, where)
+	}
+}
+
+func TestPipelineExecutor(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetForwarding(true)
+
+	// The producer computes 42 for r1; the consumer records what it reads
+	var consumed uint64
+	var forwardedOK bool
+	pipe.SetExecutor(func(inst *Instruction, forwarded func(reg int) (uint64, bool)) {
+		if inst.DestReg == 1 {
+			inst.Result, inst.HasResult = 42, true
+			return
+		}
+		consumed, forwardedOK = forwarded(1)
+	})
+
+	var committed []uint64
+	pipe.SetWriteback(func(inst *Instruction) {
+		committed = append(committed, inst.Result)
+	})
+
+	runPair(t, pipe,
+		&Instruction{Address: 0x1000, Type: "Integer", DestReg: 1, SrcRegs: []int{2, 3}},
+		&Instruction{Address: 0x1004, Type: "Integer", DestReg: 4, SrcRegs: []int{1, 6}})
+
+	if !forwardedOK || consumed != 42 {
+		t.Errorf("Consumer read r1 = %d (forwarded %v), want 42 forwarded", consumed, forwardedOK)
+	}
+
+	if len(committed) != 2 || committed[0] != 42 {
+		t.Errorf("Writeback committed %v, want the producer's 42 first", committed)
+	}
+}
+
+func TestPipelineStageStats(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+
+	// No execution unit is free for the first two attempts, holding the
+	// instruction in Decode
+	refusals := 2
+	pipe.SetDispatcher(func(inst *Instruction) (int, bool) {
+		if refusals > 0 {
+			refusals--
+			return 0, false
+		}
+		return 1, true
+	})
+
+	cycles := runPair(t, pipe, &Instruction{Address: 0x1000, Type: "Integer", DestReg: NoReg}, nil)
+
+	stats := pipe.StageStats()
+	if len(stats) != 5 {
+		t.Fatalf("StageStats() has %d stages, want 5", len(stats))
+	}
+
+	for i, stat := range stats {
+		if stat.Name != pipe.Stages[i].Name {
+			t.Errorf("StageStats()[%d].Name = %q, want %q", i, stat.Name, pipe.Stages[i].Name)
+		}
+
+		if total := stat.BusyCycles + stat.StallCycles + stat.EmptyCycles; total != int64(cycles) {
+			t.Errorf("%s counted %d cycles, want %d", stat.Name, total, cycles)
+		}
+
+		wantStalls := int64(0)
+		if stat.Name == "Decode" {
+			wantStalls = 2
+		}
+		if stat.StallCycles != wantStalls {
+			t.Errorf("%s StallCycles = %d, want %d", stat.Name, stat.StallCycles, wantStalls)
+		}
+	}
+
+	if got := stats[1].Occupancy(); got != 3.0/float64(cycles) {
+		t.Errorf("Decode Occupancy() = %.3f, want %.3f", got, 3.0/float64(cycles))
+	}
+
+	pipe.Reset()
+	for _, stat := range pipe.StageStats() {
+		if stat.BusyCycles != 0 || stat.StallCycles != 0 || stat.EmptyCycles != 0 {
+			t.Errorf("Reset() left %s counters %+v", stat.Name, stat)
+		}
+	}
+}
+
+func TestPipelineSnapshot(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.InsertInstruction(&Instruction{Address: 0x1000, Type: "Integer", Operands: []uint8{1, 2, 3}, SrcRegs: []int{2, 3}, DestReg: 1})
+	pipe.AdvanceStages()
+	pipe.InsertInstruction(&Instruction{Address: 0x1004, Type: "Integer", SrcRegs: []int{1}, DestReg: 4})
+	pipe.AdvanceStages()
+
+	snap := pipe.Snapshot()
+	saved := fmt.Sprintf("%+v", snap)
+
+	restored, _ := NewPipeline(5, "RISC-V")
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	// Both pipelines retire the same instructions on the same cycles
+	for cycle := 0; cycle < 10; cycle++ {
+		pipe.AdvanceStages()
+		restored.AdvanceStages()
+		if got, want := restored.GetCompletedInstructions(), pipe.GetCompletedInstructions(); got != want {
+			t.Fatalf("Cycle %d: restored pipeline retired %d, want %d", cycle, got, want)
+		}
+	}
+
+	if !reflect.DeepEqual(restored.StageStats(), pipe.StageStats()) {
+		t.Errorf("Restored StageStats() = %+v, want %+v", restored.StageStats(), pipe.StageStats())
+	}
+
+	// The snapshot shares no instructions with the pipeline it came from
+	if got := fmt.Sprintf("%+v", snap); got != saved {
+		t.Errorf("Snapshot changed as the pipeline advanced:\n%s\n%s", got, saved)
+	}
+
+	shallow, _ := NewPipeline(6, "x86")
+	if err := shallow.Restore(snap); err == nil {
+		t.Errorf("Restore() into a pipeline with different stages should return error")
+	}
+}
+
+func TestPipelineFlushAfter_OtherThreads(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetIssueWidth(2)
+
+	branch := &Instruction{Address: 0x1000, Type: "Branch", DestReg: NoReg}
+	pipe.InsertInstructions([]*Instruction{
+		branch,
+		{Address: 0x2000, Type: "Integer", DestReg: NoReg, Thread: 1},
+	})
+	pipe.AdvanceStages()
+	pipe.AdvanceStages()
+	pipe.InsertInstructions([]*Instruction{
+		{Address: 0x1004, Type: "Integer", DestReg: NoReg},
+		{Address: 0x2004, Type: "Integer", DestReg: NoReg, Thread: 1},
+	})
+
+	pipe.FlushAfter(branch)
+
+	stages := pipe.GetStages()
+	if got := stages[0].contents(); len(got) != 1 || got[0].Address != 0x2004 {
+		t.Errorf("Fetch holds %v after FlushAfter(), want only thread 1's instruction", got)
+	}
+
+	if got := stages[2].contents(); len(got) != 2 || got[0].Address != 0x1000 || got[1].Address != 0x2000 {
+		t.Errorf("Execute holds %v after FlushAfter(), want the branch and thread 1's instruction", got)
+	}
+}
+
+func TestGetStages_Detached(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetIssueWidth(2)
+	pipe.InsertInstructions([]*Instruction{
+		{Address: 0x1000, Type: "Integer", Operands: []uint8{1, 2, 3}, SrcRegs: []int{2, 3}, DestReg: 1},
+		{Address: 0x1004, Type: "Integer", Operands: []uint8{4, 5, 6}, SrcRegs: []int{5, 6}, DestReg: 4},
+	})
+
+	observed := pipe.GetStages()
+	inst, younger := observed[0].Instruction, observed[0].Younger[0]
+	inst.Address = 0xdead
+	inst.CyclesLeft = 99
+	inst.Operands[0] = 9
+	inst.SrcRegs[0] = 9
+	younger.DestReg = 9
+
+	live := pipe.GetStages()[0]
+	if got := live.Instruction; got.Address != 0x1000 || got.CyclesLeft != 1 || got.Operands[0] != 1 || got.SrcRegs[0] != 2 {
+		t.Errorf("Mutating a returned instruction changed the pipeline: %+v", got)
+	}
+
+	if got := live.Younger[0]; got.DestReg != 4 {
+		t.Errorf("Mutating a returned younger instruction changed the pipeline: %+v", got)
+	}
+
+	// The pipeline advances normally afterwards
+	for i := 0; i < 5; i++ {
+		pipe.AdvanceStages()
+	}
+	if got := pipe.GetCompletedInstructions(); got != 2 {
+		t.Errorf("GetCompletedInstructions() = %d, want 2", got)
+	}
+}
+
+// runOutOfOrder feeds a slow load, an instruction that uses it and an
+// independent one through a pipeline, returning the order they executed and
+// retired in
+func runOutOfOrder(t *testing.T, pipe *Pipeline) (executed, retired []uint64) {
+	t.Helper()
+
+	pipe.SetForwarding(true)
+	pipe.SetDispatcher(func(inst *Instruction) (int, bool) {
+		if inst.Type == "Memory" {
+			return 20, true
+		}
+		return 1, true
+	})
+	pipe.SetExecutor(func(inst *Instruction, _ func(int) (uint64, bool)) {
+		executed = append(executed, inst.Address)
+	})
+	pipe.SetWriteback(func(inst *Instruction) {
+		retired = append(retired, inst.Address)
+	})
+
+	insts := []*Instruction{
+		{Address: 0x1000, Type: "Memory", SrcRegs: []int{2}, DestReg: 1},
+		{Address: 0x1004, Type: "Integer", SrcRegs: []int{1}, DestReg: 3},
+		{Address: 0x1008, Type: "Integer", SrcRegs: []int{4}, DestReg: 5},
+	}
+
+	for cycle := 0; (len(insts) > 0 || !pipe.IsEmpty()) && cycle < 100; cycle++ {
+		pipe.AdvanceStages()
+		if len(insts) > 0 && pipe.InsertInstruction(insts[0]) {
+			insts = insts[1:]
+		}
+	}
+
+	return executed, retired
+}
+
+func TestPipelineOutOfOrder(t *testing.T) {
+	inOrder, _ := NewPipeline(5, "RISC-V")
+	executed, retired := runOutOfOrder(t, inOrder)
+
+	want := []uint64{0x1000, 0x1004, 0x1008}
+	if !reflect.DeepEqual(executed, want) || !reflect.DeepEqual(retired, want) {
+		t.Errorf("In-order executed %x, retired %x, want both %x", executed, retired, want)
+	}
+
+	ooo, _ := NewPipeline(5, "RISC-V")
+	if err := ooo.SetOutOfOrder(8, 4); err != nil {
+		t.Fatalf("SetOutOfOrder() error = %v", err)
+	}
+	executed, retired = runOutOfOrder(t, ooo)
+
+	// The independent instruction overtakes the one waiting on the load but
+	// still retires last
+	if want := []uint64{0x1000, 0x1008, 0x1004}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("Out-of-order executed %x, want %x", executed, want)
+	}
+
+	if !reflect.DeepEqual(retired, want) {
+		t.Errorf("Out-of-order retired %x, want %x", retired, want)
+	}
+
+	if ooo.GetCompletedInstructions() != 3 || ooo.ROBOccupancy() != 0 {
+		t.Errorf("Completed %d with %d in the reorder buffer, want 3 and 0", ooo.GetCompletedInstructions(), ooo.ROBOccupancy())
+	}
+
+	if ooo.GetHazardStalls() == 0 {
+		t.Errorf("GetHazardStalls() = 0, want the dependent instruction counted while it waited")
+	}
+}
+
+func TestPipelineOutOfOrder_Forwarding(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetForwarding(true)
+	if err := pipe.SetOutOfOrder(8, 4); err != nil {
+		t.Fatalf("SetOutOfOrder() error = %v", err)
+	}
+
+	// r1 is written twice; the reader between them must see the first value
+	// even after the younger writer has executed
+	values := map[uint64]uint64{0x1000: 10, 0x1008: 30}
+	var seen uint64
+	pipe.SetDispatcher(func(inst *Instruction) (int, bool) {
+		if inst.Address == 0x1000 {
+			return 5, true
+		}
+		return 1, true
+	})
+	pipe.SetExecutor(func(inst *Instruction, forwarded func(int) (uint64, bool)) {
+		if v, ok := values[inst.Address]; ok {
+			inst.Result, inst.HasResult = v, true
+			return
+		}
+		seen, _ = forwarded(1)
+	})
+
+	pipe.SetIssueWidth(3)
+	pipe.InsertInstructions([]*Instruction{
+		{Address: 0x1000, Type: "Integer", DestReg: 1},
+		{Address: 0x1004, Type: "Integer", SrcRegs: []int{1}, DestReg: 2},
+		{Address: 0x1008, Type: "Integer", DestReg: 1},
+	})
+	for i := 0; i < 20; i++ {
+		pipe.AdvanceStages()
+	}
+
+	if seen != 10 {
+		t.Errorf("Reader saw r1 = %d, want 10 from the older writer", seen)
+	}
+}
+
+func TestPipelineOutOfOrder_FlushAfter(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	pipe.SetIssueWidth(4)
+	pipe.SetForwarding(true)
+	if err := pipe.SetOutOfOrder(8, 4); err != nil {
+		t.Fatalf("SetOutOfOrder() error = %v", err)
+	}
+
+	// The branch waits on a slow producer while younger work issues past it
+	pipe.SetDispatcher(func(inst *Instruction) (int, bool) {
+		if inst.Address == 0x1000 {
+			return 10, true
+		}
+		return 1, true
+	})
+	branch := &Instruction{Address: 0x1004, Type: "Branch", SrcRegs: []int{1}, DestReg: NoReg}
+	pipe.InsertInstructions([]*Instruction{
+		{Address: 0x1000, Type: "Integer", DestReg: 1},
+		branch,
+		{Address: 0x1008, Type: "Integer", DestReg: 2},
+		{Address: 0x2000, Type: "Integer", DestReg: 2, Thread: 1},
+	})
+
+	var resolving []*Instruction
+	for i := 0; i < 20 && len(resolving) == 0; i++ {
+		pipe.AdvanceStages()
+		resolving = pipe.ResolvingBranches()
+	}
+	if len(resolving) != 1 || resolving[0] != branch {
+		t.Fatalf("Branch did not resolve")
+	}
+
+	pipe.FlushAfter(branch)
+
+	var left []uint64
+	for _, inst := range pipe.InFlight() {
+		left = append(left, inst.Address)
+	}
+
+	// The younger instruction of the branch's thread is gone, even though
+	// it had already issued
+	if want := []uint64{0x1000, 0x1004, 0x2000}; !reflect.DeepEqual(left, want) {
+		t.Errorf("InFlight() after FlushAfter() = %x, want %x", left, want)
+	}
+
+	for i := 0; i < 20; i++ {
+		pipe.AdvanceStages()
+	}
+	if !pipe.IsEmpty() || pipe.GetCompletedInstructions() != 3 {
+		t.Errorf("Retired %d instructions, want the 3 that survived the flush", pipe.GetCompletedInstructions())
+	}
+}
+
+func TestPipelineOutOfOrder_Snapshot(t *testing.T) {
+	build := func() *Pipeline {
+		pipe, _ := NewPipeline(5, "RISC-V")
+		pipe.SetForwarding(true)
+		if err := pipe.SetOutOfOrder(8, 4); err != nil {
+			t.Fatalf("SetOutOfOrder() error = %v", err)
+		}
+		pipe.SetDispatcher(func(inst *Instruction) (int, bool) {
+			if inst.Type == "Memory" {
+				return 6, true
+			}
+			return 1, true
+		})
+		return pipe
+	}
+
+	pipe := build()
+	for _, inst := range []*Instruction{
+		{Address: 0x1000, Type: "Memory", DestReg: 1},
+		{Address: 0x1004, Type: "Integer", SrcRegs: []int{1}, DestReg: 2},
+		{Address: 0x1008, Type: "Integer", DestReg: 3},
+	} {
+		pipe.InsertInstruction(inst)
+		pipe.AdvanceStages()
+	}
+	pipe.AdvanceStages()
+
+	if pipe.ROBOccupancy() == 0 {
+		t.Fatalf("Reorder buffer is empty, the snapshot would not cover it")
+	}
+
+	restored := build()
+	if err := restored.Restore(pipe.Snapshot()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	var want, got []uint64
+	pipe.SetWriteback(func(inst *Instruction) { want = append(want, inst.Address) })
+	restored.SetWriteback(func(inst *Instruction) { got = append(got, inst.Address) })
+	for i := 0; i < 20; i++ {
+		pipe.AdvanceStages()
+		restored.AdvanceStages()
+	}
+
+	if len(want) != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Restored pipeline retired %x, want %x", got, want)
+	}
+
+	small := build()
+	if err := small.SetOutOfOrder(1, 1); err != nil {
+		t.Fatalf("SetOutOfOrder() error = %v", err)
+	}
+	if err := small.Restore(pipe.Snapshot()); err != nil {
+		t.Errorf("Restore() of an empty reorder buffer error = %v", err)
+	}
+}
+
+func TestSetOutOfOrder(t *testing.T) {
+	pipe, _ := NewPipeline(5, "RISC-V")
+	if err := pipe.SetOutOfOrder(-1, 4); err == nil {
+		t.Errorf("SetOutOfOrder() with a negative size should return error")
+	}
+	if err := pipe.SetOutOfOrder(8, 0); err == nil {
+		t.Errorf("SetOutOfOrder() without reservation stations should return error")
+	}
+	if err := pipe.SetOutOfOrder(0, 0); err != nil {
+		t.Errorf("SetOutOfOrder(0, 0) error = %v, want in-order issue", err)
+	}
+
+	// Nothing ahead of Execute can feed the reorder buffer
+	noExecute, _ := NewPipeline(2, "RISC-V")
+	if err := noExecute.SetOutOfOrder(8, 4); err == nil {
+		t.Errorf("SetOutOfOrder() on a pipeline without Execute should return error")
+	}
+}
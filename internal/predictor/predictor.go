@@ -0,0 +1,192 @@
+// Package predictor implements branch direction predictors.
+package predictor
+
+import "fmt"
+
+// Predictor types
+const (
+	Static  = "static"  // always predicts not-taken
+	Bimodal = "bimodal" // 2-bit saturating counters indexed by branch address
+	Gshare  = "gshare"  // 2-bit counters indexed by address XOR global history
+)
+
+// tableBits sizes the counter tables of the dynamic predictors
+const tableBits = 12
+
+// BranchPredictor predicts the direction of conditional branches
+type BranchPredictor interface {
+	// Predict returns true if the branch at addr is predicted taken
+	Predict(addr uint64) bool
+	// Update trains the predictor with the resolved direction of the branch at addr
+	Update(addr uint64, taken bool)
+	// Reset clears all learned state
+	Reset()
+	// Snapshot returns a copy of the learned state
+	Snapshot() Snapshot
+	// Restore replaces the learned state with a snapshot from a predictor
+	// of the same type
+	Restore(s Snapshot) error
+}
+
+// Snapshot is a copy of a predictor's learned state, for checkpointing
+type Snapshot struct {
+	Counters []uint8
+	History  uint64
+}
+
+// Stats counts predictions and mispredictions
+type Stats struct {
+	Predictions    int64 `json:"predictions"`
+	Mispredictions int64 `json:"mispredictions"`
+}
+
+// Accuracy returns the fraction of predictions that were correct
+func (s Stats) Accuracy() float64 {
+	if s.Predictions == 0 {
+		return 0.0
+	}
+	return float64(s.Predictions-s.Mispredictions) / float64(s.Predictions)
+}
+
+// New creates a predictor of the given type. An empty type selects the
+// static predictor.
+func New(kind string) (BranchPredictor, error) {
+	switch kind {
+	case Static, "":
+		return &staticPredictor{}, nil
+	case Bimodal:
+		return newBimodal(), nil
+	case Gshare:
+		return newGshare(), nil
+	default:
+		return nil, fmt.Errorf("unsupported branch predictor: %s", kind)
+	}
+}
+
+// staticPredictor predicts every branch not-taken
+type staticPredictor struct{}
+
+func (s *staticPredictor) Predict(addr uint64) bool       { return false }
+func (s *staticPredictor) Update(addr uint64, taken bool) {}
+func (s *staticPredictor) Reset()                         {}
+func (s *staticPredictor) Snapshot() Snapshot             { return Snapshot{} }
+func (s *staticPredictor) Restore(snap Snapshot) error    { return nil }
+
+// counterTable is a table of 2-bit saturating counters. Values 0-1 predict
+// not-taken and 2-3 predict taken.
+type counterTable []uint8
+
+func newCounterTable() counterTable {
+	t := make(counterTable, 1<<tableBits)
+	t.reset()
+	return t
+}
+
+func (t counterTable) taken(idx uint64) bool {
+	return t[idx] >= 2
+}
+
+func (t counterTable) update(idx uint64, taken bool) {
+	if taken && t[idx] < 3 {
+		t[idx]++
+	} else if !taken && t[idx] > 0 {
+		t[idx]--
+	}
+}
+
+// restore copies saved counters into the table
+func (t counterTable) restore(saved []uint8) error {
+	if len(saved) != len(t) {
+		return fmt.Errorf("snapshot has %d counters, predictor has %d", len(saved), len(t))
+	}
+	copy(t, saved)
+	return nil
+}
+
+// reset sets every counter to weakly not-taken
+func (t counterTable) reset() {
+	for i := range t {
+		t[i] = 1
+	}
+}
+
+// index maps a branch address to a table slot, dropping the byte offset
+// within the instruction word
+func index(addr uint64) uint64 {
+	return (addr >> 2) & (1<<tableBits - 1)
+}
+
+// bimodalPredictor indexes its counters by branch address alone
+type bimodalPredictor struct {
+	counters counterTable
+}
+
+func newBimodal() *bimodalPredictor {
+	return &bimodalPredictor{counters: newCounterTable()}
+}
+
+func (b *bimodalPredictor) Predict(addr uint64) bool {
+	return b.counters.taken(index(addr))
+}
+
+func (b *bimodalPredictor) Update(addr uint64, taken bool) {
+	b.counters.update(index(addr), taken)
+}
+
+func (b *bimodalPredictor) Reset() {
+	b.counters.reset()
+}
+
+func (b *bimodalPredictor) Snapshot() Snapshot {
+	return Snapshot{Counters: append([]uint8(nil), b.counters...)}
+}
+
+func (b *bimodalPredictor) Restore(snap Snapshot) error {
+	return b.counters.restore(snap.Counters)
+}
+
+// gsharePredictor indexes its counters by the branch address XORed with the
+// directions of the most recent branches
+type gsharePredictor struct {
+	counters counterTable
+	history  uint64
+}
+
+func newGshare() *gsharePredictor {
+	return &gsharePredictor{counters: newCounterTable()}
+}
+
+func (g *gsharePredictor) slot(addr uint64) uint64 {
+	return index(addr) ^ g.history
+}
+
+func (g *gsharePredictor) Predict(addr uint64) bool {
+	return g.counters.taken(g.slot(addr))
+}
+
+func (g *gsharePredictor) Update(addr uint64, taken bool) {
+	g.counters.update(g.slot(addr), taken)
+
+	g.history <<= 1
+	if taken {
+		g.history |= 1
+	}
+	g.history &= 1<<tableBits - 1
+}
+
+func (g *gsharePredictor) Reset() {
+	g.counters.reset()
+	g.history = 0
+}
+
+func (g *gsharePredictor) Snapshot() Snapshot {
+	return Snapshot{Counters: append([]uint8(nil), g.counters...), History: g.history}
+}
+
+func (g *gsharePredictor) Restore(snap Snapshot) error {
+	if err := g.counters.restore(snap.Counters); err != nil {
+		return err
+	}
+	g.history = snap.History & (1<<tableBits - 1)
+	return nil
+}
@@ -0,0 +1,110 @@
+package predictor
+
+import "testing"
+
+func TestNew(t *testing.T) {
+	for _, kind := range []string{Static, Bimodal, Gshare, ""} {
+		if _, err := New(kind); err != nil {
+			t.Errorf("New(%q) error = %v", kind, err)
+		}
+	}
+
+	if _, err := New("Invalid"); err == nil {
+		t.Errorf("New() with invalid type should return error")
+	}
+}
+
+// mispredictions runs the outcome pattern for a single branch and counts
+// how many predictions were wrong
+func mispredictions(p BranchPredictor, outcomes []bool) int {
+	wrong := 0
+	for _, taken := range outcomes {
+		if p.Predict(0x1000) != taken {
+			wrong++
+		}
+		p.Update(0x1000, taken)
+	}
+	return wrong
+}
+
+func repeat(pattern []bool, n int) []bool {
+	var outcomes []bool
+	for i := 0; i < n; i++ {
+		outcomes = append(outcomes, pattern...)
+	}
+	return outcomes
+}
+
+func TestPredictorAccuracy(t *testing.T) {
+	alwaysTaken := repeat([]bool{true}, 100)
+	alternating := repeat([]bool{true, false}, 50)
+
+	tests := []struct {
+		name     string
+		kind     string
+		outcomes []bool
+		maxWrong int
+		minWrong int
+	}{
+		{name: "Static misses every taken branch", kind: Static, outcomes: alwaysTaken, minWrong: 100, maxWrong: 100},
+		{name: "Bimodal learns a biased branch", kind: Bimodal, outcomes: alwaysTaken, maxWrong: 1},
+		{name: "Bimodal cannot learn alternation", kind: Bimodal, outcomes: alternating, minWrong: 40, maxWrong: 100},
+		{name: "Gshare learns alternation from history", kind: Gshare, outcomes: alternating, maxWrong: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := New(tt.kind)
+			wrong := mispredictions(p, tt.outcomes)
+			if wrong < tt.minWrong || wrong > tt.maxWrong {
+				t.Errorf("%s mispredicted %d of %d, want %d-%d",
+					tt.kind, wrong, len(tt.outcomes), tt.minWrong, tt.maxWrong)
+			}
+		})
+	}
+}
+
+func TestPredictorReset(t *testing.T) {
+	p, _ := New(Bimodal)
+	mispredictions(p, repeat([]bool{true}, 10))
+
+	p.Reset()
+	if p.Predict(0x1000) {
+		t.Errorf("Predict() after Reset() = taken, want not-taken")
+	}
+}
+
+func TestStatsAccuracy(t *testing.T) {
+	if got := (Stats{}).Accuracy(); got != 0.0 {
+		t.Errorf("Accuracy() with no predictions = %v, want 0", got)
+	}
+
+	if got := (Stats{Predictions: 4, Mispredictions: 1}).Accuracy(); got != 0.75 {
+		t.Errorf("Accuracy() = %v, want 0.75", got)
+	}
+}
+
+func TestPredictorSnapshot(t *testing.T) {
+	for _, kind := range []string{Static, Bimodal, Gshare} {
+		t.Run(kind, func(t *testing.T) {
+			p, _ := New(kind)
+			for i := 0; i < 8; i++ {
+				p.Update(0x100, true)
+			}
+
+			restored, _ := New(kind)
+			if err := restored.Restore(p.Snapshot()); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+
+			if restored.Predict(0x100) != p.Predict(0x100) {
+				t.Errorf("Restored prediction = %v, want %v", restored.Predict(0x100), p.Predict(0x100))
+			}
+		})
+	}
+
+	p, _ := New(Gshare)
+	if err := p.Restore(Snapshot{Counters: []uint8{1}}); err == nil {
+		t.Errorf("Restore() with a short counter table should return error")
+	}
+}
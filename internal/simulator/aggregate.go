@@ -0,0 +1,119 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// MetricSummary is the spread of one metric over several runs
+type MetricSummary struct {
+	Name    string // JSON name of the metric, dotted for nested ones
+	Mean    float64
+	Min     float64
+	Max     float64
+	StdDev  float64 // sample standard deviation, 0 for a single run
+	integer bool    // a count, rendered without decimals
+}
+
+// StatsSummary summarizes every scalar metric of several runs' statistics,
+// in the order the metrics appear in Statistics
+type StatsSummary struct {
+	Runs            int
+	Metrics         []MetricSummary
+	CoreUtilization []MetricSummary // per core, named core0, core1, ...
+}
+
+// AggregateStats returns the mean, minimum, maximum and standard deviation
+// of each metric over runs, such as repeated runs of one config with
+// different seeds. The metrics are those CompareStats compares, a map entry
+// missing from some runs counting as zero there. Per-core utilization is
+// summarized core by core, each core over the runs that had it.
+func AggregateStats(runs []Statistics) StatsSummary {
+	summary := StatsSummary{Runs: len(runs)}
+	if len(runs) == 0 {
+		return summary
+	}
+
+	values := make([]reflect.Value, len(runs))
+	cores := 0
+	for i, run := range runs {
+		values[i] = reflect.ValueOf(run)
+		cores = max(cores, len(run.CoreUtilization))
+	}
+	walkMetrics("", values, func(name string, values []float64, integer bool) {
+		summary.Metrics = append(summary.Metrics, summarize(name, values, integer))
+	})
+
+	for core := 0; core < cores; core++ {
+		var utilization []float64
+		for _, run := range runs {
+			if core < len(run.CoreUtilization) {
+				utilization = append(utilization, run.CoreUtilization[core])
+			}
+		}
+		summary.CoreUtilization = append(summary.CoreUtilization, summarize(fmt.Sprintf("core%d", core), utilization, false))
+	}
+
+	return summary
+}
+
+// summarize returns the spread of a metric's values, of which there is at
+// least one
+func summarize(name string, values []float64, integer bool) MetricSummary {
+	m := MetricSummary{Name: name, Min: values[0], Max: values[0], integer: integer}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+		m.Min = min(m.Min, v)
+		m.Max = max(m.Max, v)
+	}
+	m.Mean = sum / float64(len(values))
+
+	if len(values) > 1 {
+		squares := 0.0
+		for _, v := range values {
+			squares += (v - m.Mean) * (v - m.Mean)
+		}
+		m.StdDev = math.Sqrt(squares / float64(len(values)-1))
+	}
+
+	return m
+}
+
+// Metric returns the summary of the named metric, or false if there is none
+func (s StatsSummary) Metric(name string) (MetricSummary, bool) {
+	for _, m := range s.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return MetricSummary{}, false
+}
+
+// String renders the summary as a table of every metric, per-core
+// utilization last
+func (s StatsSummary) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Metric (%d runs)\tMean\tStdDev\tMin\tMax\n", s.Runs)
+	for _, m := range s.Metrics {
+		fmt.Fprintf(w, "%s\t%.4f\t%.4f\t%s\t%s\n", m.Name, m.Mean, m.StdDev, m.format(m.Min), m.format(m.Max))
+	}
+	for _, m := range s.CoreUtilization {
+		fmt.Fprintf(w, "coreUtilization.%s\t%.4f\t%.4f\t%s\t%s\n", m.Name, m.Mean, m.StdDev, m.format(m.Min), m.format(m.Max))
+	}
+	w.Flush()
+	return b.String()
+}
+
+// format renders a value the metric took
+func (m MetricSummary) format(v float64) string {
+	if m.integer {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.4f", v)
+}
@@ -0,0 +1,194 @@
+package simulator
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/jasonKoogler/cpu-sim/internal/cache"
+	"github.com/jasonKoogler/cpu-sim/internal/coherence"
+	"github.com/jasonKoogler/cpu-sim/internal/core"
+	"github.com/jasonKoogler/cpu-sim/internal/interconnect"
+	"github.com/jasonKoogler/cpu-sim/internal/memory"
+)
+
+// checkpointVersion is bumped whenever the checkpoint layout changes
+const checkpointVersion = 27
+
+// checkpoint is the gob-encoded simulator state. Shared components are nil
+// when the configuration leaves them out.
+type checkpoint struct {
+	Version    int
+	NumCores   int
+	Clock      int64
+	ClockPhase []int64 // nil when every core runs at clockFrequency
+	WarmedUp   bool    // restored runs skip a warmup already done
+	Stats      Statistics
+	Cores      []core.Snapshot
+	Coherence  *coherence.Snapshot
+	Network    *interconnect.Snapshot
+	Ports      *memory.PortsSnapshot
+	NUMA       *memory.NUMASnapshot
+	DRAM       *memory.DRAMSnapshot
+	Arbiter    *coherence.ArbiterSnapshot
+	L3         *cache.Snapshot // the shared L3, nil when each core has its own
+}
+
+// Checkpoint writes the complete simulator state to w. A simulator built
+// from the same configuration can Restore it and carry on running.
+func (s *simulator) Checkpoint(w io.Writer) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot checkpoint while the simulation is running")
+	}
+
+	cp := checkpoint{
+		Version:    checkpointVersion,
+		NumCores:   len(s.cores),
+		Clock:      atomic.LoadInt64(&s.clock),
+		ClockPhase: append([]int64(nil), s.clockPhase...),
+		WarmedUp:   s.warmedUp,
+		Stats:      s.GetStatistics(),
+		Cores:      make([]core.Snapshot, len(s.cores)),
+	}
+
+	for i, proc := range s.cores {
+		cp.Cores[i] = proc.Snapshot()
+	}
+
+	if s.coherence != nil {
+		snap := s.coherence.Snapshot()
+		cp.Coherence = &snap
+	}
+
+	if s.network != nil {
+		snap := s.network.Snapshot()
+		cp.Network = &snap
+	}
+
+	if s.ports != nil {
+		snap := s.ports.Snapshot()
+		cp.Ports = &snap
+	}
+
+	if s.numa != nil {
+		snap := s.numa.Snapshot()
+		cp.NUMA = &snap
+	}
+
+	if s.dram != nil {
+		snap := s.dram.Snapshot()
+		cp.DRAM = &snap
+	}
+
+	if s.arbiter != nil {
+		snap := s.arbiter.Snapshot()
+		cp.Arbiter = &snap
+	}
+
+	if s.l3 != nil {
+		snap := s.l3.Snapshot()
+		cp.L3 = &snap
+	}
+
+	if err := gob.NewEncoder(w).Encode(cp); err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replaces the simulator state with a checkpoint read from r. The
+// simulator must have been built from the configuration the checkpoint was
+// taken with.
+func (s *simulator) Restore(r io.Reader) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot restore while the simulation is running")
+	}
+
+	var cp checkpoint
+	if err := gob.NewDecoder(r).Decode(&cp); err != nil {
+		return fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	if cp.Version != checkpointVersion {
+		return fmt.Errorf("unsupported checkpoint version %d, want %d", cp.Version, checkpointVersion)
+	}
+
+	if cp.NumCores != len(s.cores) || len(cp.Cores) != len(s.cores) {
+		return fmt.Errorf("checkpoint has %d cores, simulator has %d", cp.NumCores, len(s.cores))
+	}
+
+	if (cp.Coherence != nil) != (s.coherence != nil) ||
+		(cp.Network != nil) != (s.network != nil) ||
+		(cp.Ports != nil) != (s.ports != nil) ||
+		(cp.NUMA != nil) != (s.numa != nil) ||
+		(cp.DRAM != nil) != (s.dram != nil) ||
+		(cp.Arbiter != nil) != (s.arbiter != nil) ||
+		(cp.L3 != nil) != (s.l3 != nil) ||
+		len(cp.ClockPhase) != len(s.clockPhase) {
+		return fmt.Errorf("checkpoint was taken with a different configuration")
+	}
+
+	for i, proc := range s.cores {
+		if err := proc.Restore(cp.Cores[i]); err != nil {
+			return fmt.Errorf("failed to restore core %d: %w", i, err)
+		}
+	}
+
+	if s.coherence != nil {
+		if err := s.coherence.Restore(*cp.Coherence); err != nil {
+			return fmt.Errorf("failed to restore coherence: %w", err)
+		}
+	}
+
+	if s.network != nil {
+		if err := s.network.Restore(*cp.Network); err != nil {
+			return fmt.Errorf("failed to restore interconnect: %w", err)
+		}
+	}
+
+	if s.ports != nil {
+		if err := s.ports.Restore(*cp.Ports); err != nil {
+			return fmt.Errorf("failed to restore memory ports: %w", err)
+		}
+	}
+
+	if s.numa != nil {
+		if err := s.numa.Restore(*cp.NUMA); err != nil {
+			return fmt.Errorf("failed to restore NUMA memory: %w", err)
+		}
+	}
+
+	if s.dram != nil {
+		if err := s.dram.Restore(*cp.DRAM); err != nil {
+			return fmt.Errorf("failed to restore DRAM: %w", err)
+		}
+	}
+
+	if s.arbiter != nil {
+		if err := s.arbiter.Restore(*cp.Arbiter); err != nil {
+			return fmt.Errorf("failed to restore bus arbiter: %w", err)
+		}
+	}
+
+	if s.l3 != nil {
+		if err := s.l3.Restore(*cp.L3); err != nil {
+			return fmt.Errorf("failed to restore shared L3 cache: %w", err)
+		}
+	}
+
+	s.statsMutex.Lock()
+	s.stats = cp.Stats
+	if len(s.stats.CoreUtilization) != len(s.cores) {
+		s.stats.CoreUtilization = make([]float64, len(s.cores))
+	}
+	s.statsMutex.Unlock()
+
+	atomic.StoreInt64(&s.clock, cp.Clock)
+	copy(s.clockPhase, cp.ClockPhase)
+	s.warmedUp = cp.WarmedUp
+	s.stuck = 0
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package simulator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// MetricDiff is the change in one metric from a baseline run to another
+type MetricDiff struct {
+	Name       string // JSON name of the metric, dotted for nested ones
+	Baseline   float64
+	Value      float64
+	Delta      float64 // Value - Baseline
+	Percent    float64 // Delta as a percentage of Baseline, valid if HasPercent
+	HasPercent bool    // false when Baseline is zero
+	integer    bool    // a count, rendered without decimals
+}
+
+// StatsDiff compares every scalar metric of two runs' statistics, in the
+// order the metrics appear in Statistics
+type StatsDiff struct {
+	Metrics []MetricDiff
+}
+
+// CompareStats returns the change in each metric from baseline a to b.
+// Scalar fields, the fields of nested structs such as BranchStats and the
+// entries of maps such as RetiredByType are compared; per-core and
+// per-stage slices are not.
+func CompareStats(a, b Statistics) StatsDiff {
+	var diff StatsDiff
+	walkMetrics("", []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b)}, func(name string, values []float64, integer bool) {
+		diff.add(name, values[0], values[1], integer)
+	})
+	return diff
+}
+
+// walkMetrics calls fn with the value each of runs, which share a type, has
+// for every scalar metric, naming the metrics under prefix. A map key some
+// runs lack counts as zero in those runs.
+func walkMetrics(prefix string, runs []reflect.Value, fn func(name string, values []float64, integer bool)) {
+	switch runs[0].Kind() {
+	case reflect.Int, reflect.Int64:
+		values := make([]float64, len(runs))
+		for i, v := range runs {
+			values[i] = float64(v.Int())
+		}
+		fn(prefix, values, true)
+
+	case reflect.Float64:
+		values := make([]float64, len(runs))
+		for i, v := range runs {
+			values[i] = v.Float()
+		}
+		fn(prefix, values, false)
+
+	case reflect.Struct:
+		t := runs[0].Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+
+			fields := make([]reflect.Value, len(runs))
+			for j, v := range runs {
+				fields[j] = v.Field(i)
+			}
+			walkMetrics(name, fields, fn)
+		}
+
+	case reflect.Map:
+		keys := make(map[string]bool)
+		for _, m := range runs {
+			for _, k := range m.MapKeys() {
+				keys[k.String()] = true
+			}
+		}
+		names := make([]string, 0, len(keys))
+		for k := range keys {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		zero := reflect.Zero(runs[0].Type().Elem())
+		for _, k := range names {
+			key := reflect.ValueOf(k).Convert(runs[0].Type().Key())
+			values := make([]reflect.Value, len(runs))
+			for i, m := range runs {
+				if values[i] = m.MapIndex(key); !values[i].IsValid() {
+					values[i] = zero
+				}
+			}
+			walkMetrics(prefix+"."+k, values, fn)
+		}
+	}
+}
+
+// add appends the diff of one metric
+func (d *StatsDiff) add(name string, baseline, value float64, integer bool) {
+	m := MetricDiff{
+		Name:     name,
+		Baseline: baseline,
+		Value:    value,
+		Delta:    value - baseline,
+		integer:  integer,
+	}
+	if baseline != 0 {
+		m.Percent, m.HasPercent = m.Delta/baseline*100, true
+	}
+	d.Metrics = append(d.Metrics, m)
+}
+
+// Metric returns the diff of the named metric, or false if there is none
+func (d StatsDiff) Metric(name string) (MetricDiff, bool) {
+	for _, m := range d.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return MetricDiff{}, false
+}
+
+// String renders the diff as a table of every metric. A metric whose
+// baseline is zero shows its delta with no percentage.
+func (d StatsDiff) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Metric\tBaseline\tValue\tDelta\tChange")
+	for _, m := range d.Metrics {
+		change := "-"
+		if m.HasPercent {
+			change = fmt.Sprintf("%+.2f%%", m.Percent)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Name, m.format(m.Baseline, false), m.format(m.Value, false),
+			m.format(m.Delta, true), change)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// format renders one of the metric's values, with a sign if signed
+func (m MetricDiff) format(v float64, signed bool) string {
+	verb := "%.4f"
+	if m.integer {
+		verb = "%.0f"
+	}
+	if signed {
+		verb = "%+" + verb[1:]
+	}
+	return fmt.Sprintf(verb, v)
+}
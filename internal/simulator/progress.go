@@ -0,0 +1,75 @@
+package simulator
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ProgressFunc receives the cycles completed so far and the cycles requested
+type ProgressFunc func(cycle, totalCycles int64)
+
+// progress reports run progress every interval cycles. In async mode cores
+// record their own cycle and the slowest core decides what is reported.
+type progress struct {
+	fn       ProgressFunc
+	interval int64
+	total    int64
+	cores    []int64 // cycles completed per core, async mode only
+
+	mu       sync.Mutex // serialises calls to fn
+	reported int64      // last cycle passed to fn
+}
+
+func newProgress(fn ProgressFunc, interval int64) (*progress, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("progress interval must be positive")
+	}
+
+	return &progress{fn: fn, interval: interval}, nil
+}
+
+// begin prepares for a run of total cycles across numCores cores
+func (p *progress) begin(total int64, numCores int) {
+	p.total = total
+	p.cores = make([]int64, numCores)
+	p.reported = 0
+}
+
+// due reports whether progress should be reported after cycle completes
+func (p *progress) due(cycle int64) bool {
+	return cycle%p.interval == 0
+}
+
+// report passes cycle to the callback
+func (p *progress) report(cycle int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cycle > p.reported {
+		p.reported = cycle
+		p.fn(cycle, p.total)
+	}
+}
+
+// coreDone records that core id completed cycle and, when the slowest core
+// has reached a reporting point, reports the minimum cycle across cores
+func (p *progress) coreDone(id int, cycle int64) {
+	atomic.StoreInt64(&p.cores[id], cycle)
+	if !p.due(cycle) {
+		return
+	}
+
+	slowest := cycle
+	for i := range p.cores {
+		if c := atomic.LoadInt64(&p.cores[i]); c < slowest {
+			slowest = c
+		}
+	}
+
+	// Another core is behind; it reports when it gets here
+	if slowest < cycle {
+		return
+	}
+	p.report(slowest)
+}
@@ -0,0 +1,169 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jasonKoogler/cpu-sim/internal/core"
+)
+
+// recordingHeader names the CSV columns of a recording, one row per
+// retired instruction, for example
+//
+//	core,thread,address,opcode,type,operands,target,length
+//	0,0,0x24,0x60,Memory,4 0 16,0x0,4
+//
+// Operands are space-separated; target is 0 for anything but a branch.
+var recordingHeader = []string{"core", "thread", "address", "opcode", "type", "operands", "target", "length"}
+
+// recorder writes every instruction the cores retire as a CSV row. Cores
+// retire concurrently in async mode, so rows are written under a mutex.
+type recorder struct {
+	mutex sync.Mutex
+	w     *csv.Writer
+	row   []string
+	err   error // first write error, later rows are dropped
+}
+
+func newRecorder(w io.Writer) (*recorder, error) {
+	r := &recorder{w: csv.NewWriter(w), row: make([]string, len(recordingHeader))}
+	r.write(recordingHeader)
+
+	return r, r.err
+}
+
+// retire records inst, retired by core id
+func (r *recorder) retire(id int, inst core.Instruction) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	operands := make([]string, len(inst.Operands))
+	for i, op := range inst.Operands {
+		operands[i] = strconv.Itoa(int(op))
+	}
+
+	r.row[0] = strconv.Itoa(id)
+	r.row[1] = strconv.Itoa(inst.Thread)
+	r.row[2] = "0x" + strconv.FormatUint(inst.Address, 16)
+	r.row[3] = "0x" + strconv.FormatUint(uint64(inst.Opcode), 16)
+	r.row[4] = inst.Type
+	r.row[5] = strings.Join(operands, " ")
+	r.row[6] = "0x" + strconv.FormatUint(inst.Target, 16)
+	r.row[7] = strconv.Itoa(inst.Length)
+	r.write(r.row)
+}
+
+func (r *recorder) write(row []string) {
+	if err := r.w.Write(row); err != nil {
+		r.err = fmt.Errorf("failed to write recording: %w", err)
+	}
+}
+
+// flush writes any buffered rows and returns the first error encountered
+func (r *recorder) flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err == nil {
+		r.w.Flush()
+		if err := r.w.Error(); err != nil {
+			r.err = fmt.Errorf("failed to write recording: %w", err)
+		}
+	}
+	return r.err
+}
+
+// ReadRecording parses a recording written by SetRecorder, returning the
+// instructions each core retired in order, indexed by core
+func ReadRecording(r io.Reader) ([][]core.Instruction, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(recordingHeader)
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("recording is empty")
+		}
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	if strings.Join(header, ",") != strings.Join(recordingHeader, ",") {
+		return nil, fmt.Errorf("recording header %q does not match %q", strings.Join(header, ","), strings.Join(recordingHeader, ","))
+	}
+
+	var cores [][]core.Instruction
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return cores, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording: %w", err)
+		}
+
+		id, inst, err := parseRecordingRow(row)
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+
+		for len(cores) <= id {
+			cores = append(cores, nil)
+		}
+		cores[id] = append(cores[id], inst)
+	}
+}
+
+// parseRecordingRow parses one row of a recording into the retiring core
+// and its instruction
+func parseRecordingRow(row []string) (int, core.Instruction, error) {
+	var inst core.Instruction
+
+	id, err := strconv.Atoi(row[0])
+	if err != nil || id < 0 {
+		return 0, inst, fmt.Errorf("invalid core %q", row[0])
+	}
+	if inst.Thread, err = strconv.Atoi(row[1]); err != nil || inst.Thread < 0 {
+		return 0, inst, fmt.Errorf("invalid thread %q", row[1])
+	}
+	if inst.Address, err = strconv.ParseUint(row[2], 0, 64); err != nil {
+		return 0, inst, fmt.Errorf("invalid address %q", row[2])
+	}
+	opcode, err := strconv.ParseUint(row[3], 0, 8)
+	if err != nil {
+		return 0, inst, fmt.Errorf("invalid opcode %q", row[3])
+	}
+	inst.Opcode = uint8(opcode)
+
+	inst.Type = row[4]
+	switch inst.Type {
+	case "Integer", "Float", "Memory", "Branch", "System":
+	default:
+		return 0, inst, fmt.Errorf("invalid type %q", row[4])
+	}
+
+	for _, field := range strings.Fields(row[5]) {
+		op, err := strconv.ParseUint(field, 10, 8)
+		if err != nil {
+			return 0, inst, fmt.Errorf("invalid operand %q", field)
+		}
+		inst.Operands = append(inst.Operands, uint8(op))
+	}
+
+	if inst.Target, err = strconv.ParseUint(row[6], 0, 64); err != nil {
+		return 0, inst, fmt.Errorf("invalid target %q", row[6])
+	}
+	if inst.Length, err = strconv.Atoi(row[7]); err != nil || inst.Length < 0 {
+		return 0, inst, fmt.Errorf("invalid length %q", row[7])
+	}
+
+	return id, inst, nil
+}
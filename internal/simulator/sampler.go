@@ -0,0 +1,110 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jasonKoogler/cpu-sim/internal/core"
+)
+
+// samplerHeader names the CSV columns written by the sampler
+var samplerHeader = []string{"cycle", "ipc", "busy_cores", "cache_hit_rate"}
+
+// sampler records time-series metrics every interval cycles as CSV rows.
+// IPC and cache hit rate cover the cycles since the previous sample.
+type sampler struct {
+	w             *csv.Writer
+	interval      int64
+	instructions  int64 // totals at the previous sample
+	cacheAccesses int64
+	cacheHits     int64
+	lastCycle     int64
+	err           error // first write error, later samples are dropped
+}
+
+func newSampler(w io.Writer, interval int64) (*sampler, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("sample interval must be positive")
+	}
+
+	s := &sampler{w: csv.NewWriter(w), interval: interval}
+	s.write(samplerHeader)
+
+	return s, s.err
+}
+
+// due reports whether a sample should be taken after cycle completes
+func (s *sampler) due(cycle int64) bool {
+	return cycle%s.interval == 0
+}
+
+// begin sets the baseline for the first sample of a run
+func (s *sampler) begin(cores []*core.Processor) {
+	s.instructions, s.cacheAccesses, s.cacheHits, _ = totals(cores)
+	s.lastCycle = 0
+}
+
+// totals sums the sampled counters across cores
+func totals(cores []*core.Processor) (instructions, accesses, hits int64, busy int) {
+	for _, proc := range cores {
+		instructions += proc.GetExecutedInstructions()
+
+		caches := proc.GetCacheHierarchy()
+		accesses += caches.Accesses()
+		hits += caches.CacheHits()
+
+		if proc.IsBusy() {
+			busy++
+		}
+	}
+	return instructions, accesses, hits, busy
+}
+
+// sample records a row for the state of cores after cycle. It only reads
+// counters, so sampling never changes simulated timing.
+func (s *sampler) sample(cycle int64, cores []*core.Processor) {
+	instructions, accesses, hits, busy := totals(cores)
+
+	ipc := 0.0
+	if elapsed := cycle - s.lastCycle; elapsed > 0 && len(cores) > 0 {
+		ipc = float64(instructions-s.instructions) / float64(elapsed*int64(len(cores)))
+	}
+
+	hitRate := 0.0
+	if window := accesses - s.cacheAccesses; window > 0 {
+		hitRate = float64(hits-s.cacheHits) / float64(window)
+	}
+
+	s.instructions, s.cacheAccesses, s.cacheHits = instructions, accesses, hits
+	s.lastCycle = cycle
+
+	s.write([]string{
+		strconv.FormatInt(cycle, 10),
+		strconv.FormatFloat(ipc, 'f', 4, 64),
+		strconv.Itoa(busy),
+		strconv.FormatFloat(hitRate, 'f', 4, 64),
+	})
+}
+
+func (s *sampler) write(row []string) {
+	if s.err != nil {
+		return
+	}
+
+	if err := s.w.Write(row); err != nil {
+		s.err = fmt.Errorf("failed to write sample: %w", err)
+	}
+}
+
+// flush writes any buffered rows and returns the first error encountered
+func (s *sampler) flush() error {
+	s.w.Flush()
+	if s.err == nil {
+		if err := s.w.Error(); err != nil {
+			s.err = fmt.Errorf("failed to write samples: %w", err)
+		}
+	}
+	return s.err
+}
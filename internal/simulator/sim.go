@@ -1,142 +1,1308 @@
 package simulator
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/jasonKoogler/cpu-sim/internal/cache"
+	"github.com/jasonKoogler/cpu-sim/internal/coherence"
 	"github.com/jasonKoogler/cpu-sim/internal/config"
 	"github.com/jasonKoogler/cpu-sim/internal/core"
+	"github.com/jasonKoogler/cpu-sim/internal/energy"
+	"github.com/jasonKoogler/cpu-sim/internal/interconnect"
+	"github.com/jasonKoogler/cpu-sim/internal/memory"
+	"github.com/jasonKoogler/cpu-sim/internal/pipeline"
+	"github.com/jasonKoogler/cpu-sim/internal/predictor"
+	"github.com/jasonKoogler/cpu-sim/internal/workload"
 )
 
-// Statistics contains various metrics about the simulation
+// Statistics contains various metrics about the simulation. The JSON field
+// names are stable for downstream tools.
 type Statistics struct {
-	TotalCycles             int64
-	InstructionsExecuted    int64
-	IPC                     float64 // Instructions Per Cycle
-	CacheHitRate            float64
-	CoreUtilization         []float64
-	MemoryAccessLatency     float64 // Average memory access latency
-	InterconnectUtilization float64
+	TotalCycles             int64                        `json:"totalCycles"`
+	InstructionsExecuted    int64                        `json:"instructionsExecuted"`
+	RetiredByType           map[string]int64             `json:"retiredByType"`          // retired instructions by type across all cores
+	IPC                     float64                      `json:"ipc"`                    // Instructions Per Cycle
+	ThreadIPC               [][]float64                  `json:"threadIPC"`              // instructions per cycle of each hardware thread, by core then thread
+	CacheHitRate            float64                      `json:"cacheHitRate"`           // fraction of memory accesses served by a cache level
+	L3HitRate               float64                      `json:"l3HitRate"`              // fraction of L3 lookups that hit, shared or private
+	TLBHitRate              float64                      `json:"tlbHitRate"`             // fraction of address translations that hit in the TLBs, 0 without translation
+	DirtyEvictions          int64                        `json:"dirtyEvictions"`         // dirty lines written to the level below on eviction across all cores
+	BackInvalidations       int64                        `json:"backInvalidations"`      // lines removed from upper levels to keep an inclusive hierarchy inclusive
+	Prefetches              int64                        `json:"prefetches"`             // lines prefetched into L1 across all cores
+	UsefulPrefetches        int64                        `json:"usefulPrefetches"`       // prefetched lines later hit by a demand access
+	PrefetchAccuracy        float64                      `json:"prefetchAccuracy"`       // useful prefetches / prefetches
+	PrefetchHitRateGain     float64                      `json:"prefetchHitRateGain"`    // fraction of memory accesses that hit L1 only thanks to a prefetch
+	CoreUtilization         []float64                    `json:"-"`                      // exported as a keyed object, see MarshalJSON
+	CoreStallCycles         []int64                      `json:"coreStallCycles"`        // per core cycles instructions were in flight but none changed stage
+	CoreBubbleCycles        []int64                      `json:"coreBubbleCycles"`       // per core cycles the pipeline was empty with nothing fetched
+	CoreBusWaitCycles       []int64                      `json:"coreBusWaitCycles"`      // per core cycles coherence transactions waited for another core's to win the bus, nil unless cores run in lockstep on a bus
+	CoreClockFrequencies    []int                        `json:"coreClockFrequencies"`   // clock frequency of each core in MHz
+	CoreEffectiveIPC        []float64                    `json:"coreEffectiveIPC"`       // instructions each core retired per cycle of the global clock
+	UnitUtilization         map[string]float64           `json:"unitUtilization"`        // mean busy fraction of each execution unit type across all cores
+	MemoryAccessLatency     float64                      `json:"memoryAccessLatency"`    // average latency of loads and stores, in cycles
+	MemoryLatencyHistogram  []BucketCount                `json:"memoryLatencyHistogram"` // fetches, loads and stores by latency across all cores, nil without latencyBuckets
+	InterconnectUtilization float64                      `json:"interconnectUtilization"`
+	AverageMessageLatency   float64                      `json:"averageMessageLatency"` // mean cycles from sending an interconnect message to its arrival
+	AverageHopCount         float64                      `json:"averageHopCount"`       // mean interconnect links crossed per message
+	LinkUtilization         []interconnect.LinkStat      `json:"linkUtilization"`       // busy fraction of each interconnect link
+	HazardStallCycles       int64                        `json:"hazardStallCycles"`     // cycles lost to RAW data hazards across all cores
+	ForwardedHazards        int64                        `json:"forwardedHazards"`      // RAW hazards resolved by forwarding across all cores
+	WAWStallCycles          int64                        `json:"wawStallCycles"`        // cycles instructions waited to issue behind a slower write to their destination across all cores
+	WARStallCycles          int64                        `json:"warStallCycles"`        // cycles instructions waited to issue behind an older unissued read of their destination across all cores
+	StructuralStallCycles   int64                        `json:"structuralStallCycles"` // cycles spent waiting for a free execution unit across all cores
+	MemoryPortStalls        int64                        `json:"memoryPortStalls"`      // cycles data accesses waited for a free memory port across all cores
+	HitsUnderMiss           int64                        `json:"hitsUnderMiss"`         // L1 data hits served while a miss was outstanding across all cores
+	HitUnderMissCycles      int64                        `json:"hitUnderMissCycles"`    // cycles memory port contention added to those hits
+	StoreBufferStalls       int64                        `json:"storeBufferStalls"`     // cycles stores waited for a free store buffer entry across all cores
+	StoreForwards           int64                        `json:"storeForwards"`         // loads served from the store buffer across all cores
+	CombinedStores          int64                        `json:"combinedStores"`        // stores merged into a line already in a write-combining buffer across all cores
+	FullLineWrites          int64                        `json:"fullLineWrites"`        // complete lines written combined to memory, bypassing the caches, across all cores
+	PartialLineWrites       int64                        `json:"partialLineWrites"`     // partly written lines pushed out of a write-combining buffer through the caches across all cores
+	MemoryFaults            int64                        `json:"memoryFaults"`          // fetches and data accesses outside physical memory across all cores
+	NUMALocalAccesses       int64                        `json:"numaLocalAccesses"`     // memory accesses served by the core's own NUMA node
+	NUMARemoteAccesses      int64                        `json:"numaRemoteAccesses"`    // memory accesses served by another NUMA node
+	NUMALocalRatio          float64                      `json:"numaLocalRatio"`        // fraction of NUMA memory accesses that were local
+	DRAMRowHits             int64                        `json:"dramRowHits"`           // memory accesses to the row already open in their DRAM bank
+	DRAMRowMisses           int64                        `json:"dramRowMisses"`         // memory accesses to a DRAM bank with no row open
+	DRAMRowConflicts        int64                        `json:"dramRowConflicts"`      // memory accesses that closed another row of their DRAM bank
+	DRAMRowHitRate          float64                      `json:"dramRowHitRate"`        // fraction of memory accesses served from an open row, 0 without dramBanks
+	StageStats              []pipeline.StageStat         `json:"stageStats"`            // per pipeline stage cycle counts summed across all cores
+	GatedCycles             int64                        `json:"gatedCycles"`           // cycles pipeline stages spent power-gated, summed over every stage of every core
+	Wakeups                 int64                        `json:"wakeups"`               // times pipeline stages were woken from power-gating across all cores
+	BranchStats             predictor.Stats              `json:"branchStats"`
+	BranchAccuracy          float64                      `json:"branchAccuracy"`         // fraction of branches predicted correctly
+	MispredictCycles        int64                        `json:"mispredictCycles"`       // fetch cycles lost to branch mispredicts across all cores
+	FlushCycles             int64                        `json:"flushCycles"`            // fetch cycles lost refilling after pipeline flushes of any kind across all cores
+	Flushes                 map[string]int64             `json:"flushes"`                // pipeline flushes by cause (mispredict, exception, coherence) across all cores
+	TakenBranches           int64                        `json:"takenBranches"`          // resolved branches that were taken across all cores
+	FetchRedirects          int64                        `json:"fetchRedirects"`         // times fetch left the sequential path across all cores
+	PredicatedInstructions  int64                        `json:"predicatedInstructions"` // instructions retired or skipped in predicated branches' shadows across all cores
+	AvoidedFlushes          int64                        `json:"avoidedFlushes"`         // mispredict flushes predication avoided across all cores
+	FetchQueueStalls        int64                        `json:"fetchQueueStalls"`       // fetch cycles held back by a full instruction queue across all cores
+	CoherenceStats          coherence.Stats              `json:"coherenceStats"`
+	PeerFetches             int64                        `json:"peerFetches"`         // instruction fetches served from another core's caches across all cores
+	FalseSharingLines       []coherence.FalseSharingLine `json:"falseSharingLines"`   // lines with the most false sharing invalidations, most first, nil without falseSharingLines
+	Interrupts              int64                        `json:"interrupts"`          // interrupts taken across all cores
+	InterruptCycles         int64                        `json:"interruptCycles"`     // cycles spent in interrupt handlers across all cores
+	HandlerInstructions     int64                        `json:"handlerInstructions"` // instructions interrupt handlers retired across all cores
+	TotalEnergy             float64                      `json:"totalEnergy"`         // estimated energy of the run in nanojoules, see the energy* config coefficients
+	AveragePower            float64                      `json:"averagePower"`        // TotalEnergy over the simulated time, in milliwatts
+
+	WallClockDuration        time.Duration `json:"wallClockDuration"`        // real time the latest run took, in nanoseconds
+	SimulatedCyclesPerSecond float64       `json:"simulatedCyclesPerSecond"` // cycles the latest run simulated per second of real time
+}
+
+// MarshalJSON encodes the statistics with per-core utilization as an object
+// keyed "core0", "core1", ...
+func (s Statistics) MarshalJSON() ([]byte, error) {
+	type plain Statistics
+
+	perCore := make(map[string]float64, len(s.CoreUtilization))
+	for i, util := range s.CoreUtilization {
+		perCore[fmt.Sprintf("core%d", i)] = util
+	}
+
+	return json.Marshal(struct {
+		plain
+		CoreUtilization map[string]float64 `json:"coreUtilization"`
+	}{plain(s), perCore})
+}
+
+// BucketCount is the number of memory accesses taking Min to Max cycles. The
+// last bucket of a histogram is open-ended, with a Max of 0.
+type BucketCount struct {
+	Min   int   `json:"min"`
+	Max   int   `json:"max"`
+	Count int64 `json:"count"`
+}
+
+// latencyHistogram labels counts, summed per bucket of bounds, with the
+// range of latencies each bucket covers
+func latencyHistogram(bounds []int, counts []int64) []BucketCount {
+	buckets := make([]BucketCount, len(counts))
+	for i := range buckets {
+		buckets[i].Count = counts[i]
+		if i > 0 {
+			buckets[i].Min = bounds[i-1] + 1
+		}
+		if i < len(bounds) {
+			buckets[i].Max = bounds[i]
+		}
+	}
+	return buckets
+}
+
+// CoreStatistics are the statistics of a single core
+type CoreStatistics struct {
+	Core                 int                  `json:"core"`
+	Cycles               int64                `json:"cycles"`         // cycles the core has run
+	ClockFrequency       int                  `json:"clockFrequency"` // MHz
+	InstructionsExecuted int64                `json:"instructionsExecuted"`
+	IPC                  float64              `json:"ipc"`
+	Utilization          float64              `json:"utilization"`
+	StallCycles          int64                `json:"stallCycles"`       // cycles instructions were in flight but none changed stage
+	BubbleCycles         int64                `json:"bubbleCycles"`      // cycles the pipeline was empty with nothing fetched
+	PipelineOccupancy    float64              `json:"pipelineOccupancy"` // mean fraction of cycles each stage held an instruction
+	GatedCycles          int64                `json:"gatedCycles"`       // cycles the pipeline stages spent power-gated, summed over stages
+	Wakeups              int64                `json:"wakeups"`           // times a pipeline stage was woken from power-gating
+	MemoryFaults         int64                `json:"memoryFaults"`      // fetches and data accesses outside physical memory
+	Halted               bool                 `json:"halted"`            // a memory fault stopped the core
+	BusWaitCycles        int64                `json:"busWaitCycles"`     // cycles coherence transactions waited for another core's to win the bus
+	CombinedStores       int64                `json:"combinedStores"`    // stores merged into a line already in the write-combining buffer
+	FullLineWrites       int64                `json:"fullLineWrites"`    // complete lines written combined to memory, bypassing the caches
+	PartialLineWrites    int64                `json:"partialLineWrites"` // partly written lines pushed out of the write-combining buffer through the caches
+	StageStats           []pipeline.StageStat `json:"stageStats"`
+}
+
+// RunResult bundles everything a run produced
+type RunResult struct {
+	Statistics Statistics
+	Warnings   []string      // non-fatal conditions observed during the run
+	Duration   time.Duration // wall-clock time spent simulating
+	Config     config.Config // effective configuration used for the run
+}
+
+// contextCheckInterval is how many cycles a core runs between checks for
+// cancellation, keeping the deadline check off the per-cycle hot path
+const contextCheckInterval = 256
+
+// ErrInstructionBudgetExceeded is wrapped by the error of a run stopped
+// because the cores retired the configured MaxInstructions
+var ErrInstructionBudgetExceeded = errors.New("instruction budget exceeded")
+
+// ErrDeadlock is wrapped by the error of a run stopped because no core
+// retired an instruction for the configured DeadlockCycles while some had
+// instructions in flight
+var ErrDeadlock = errors.New("deadlock detected")
+
+// Simulator runs a multi-core processor simulation. New returns the
+// implementation; callers can substitute their own for testing.
+type Simulator interface {
+	Run(cycles int64) (*RunResult, error)
+	RunContext(ctx context.Context, cycles int64) (*RunResult, error)
+	Step() error
+	Shutdown()
+	Pause()
+	Resume()
+	Reset()
+	GetStatistics() Statistics
+	CoreCount() int
+	CoreStats(i int) (CoreStatistics, error)
+	Validate() error
+	HotInstructions(topN int) []AddrCount
+	SetSampler(w io.Writer, interval int64) error
+	SetProgress(fn ProgressFunc, interval int64) error
+	SetTrace(w io.Writer) error
+	SetRecorder(w io.Writer) error
+	Replay(r io.Reader) error
+	Checkpoint(w io.Writer) error
+	Restore(r io.Reader) error
+	WriteStatsJSON(w io.Writer) error
 }
 
-// Simulator represents the multi-core processor simulator
+// simulator is the Simulator implementation
 type simulator struct {
 	config     *config.Config
 	cores      []*core.Processor
+	program    []workload.Instruction // run by every core, nil for the synthetic generator
+	coherence  *coherence.Controller  // nil when the protocol is "None"
+	ports      *memory.MemoryPorts    // nil when memory ports are unlimited
+	numa       *memory.NUMA           // nil when memory is uniform
+	dram       *memory.DRAM           // nil when memory has a flat latency
+	arbiter    *coherence.BusArbiter  // nil unless cores run in lockstep on a bus
+	network    *interconnect.Interconnect
+	l3         *cache.Cache // shared by every core, nil when each core has its own
+	sampler    *sampler     // nil unless sampling is enabled
+	progress   *progress    // nil unless progress reporting is enabled
+	tracer     *tracer      // nil unless tracing is enabled
+	recorder   *recorder    // nil unless recording is enabled
 	clock      int64
+	coreClocks []int   // clock frequency of each core in MHz, nil when every core runs at clockFrequency
+	clockPhase []int64 // each core's progress towards its next cycle, gaining its clock in MHz every global tick
+	warmedUp   bool    // the warmup cycles have run since construction or the last Reset
+	stuck      int64   // consecutive cycles cores had work in flight but retired nothing
+	retired    int64   // instructions the cores had retired as of the last cycle
 	running    atomic.Bool
-	wg         sync.WaitGroup
-	stopChan   chan struct{}
+	liveSince  atomic.Pointer[time.Time] // start of the measured run in progress, nil outside one
+	cancel     context.CancelFunc        // cancels the current run, nil when idle
+	done       chan struct{}             // closed when the current run returns
+	stopped    <-chan struct{}           // closed once the current run is cancelled, nil when idle or stepping
+	runMutex   sync.Mutex                // guards running, cancel, done and stopped transitions
+	cycleMutex sync.RWMutex              // held shared while cores run a cycle, exclusively while paused
+	pauseMutex sync.Mutex                // serializes pausing, resuming and the end of a run
+	paused     atomic.Bool
+	pausedAt   time.Time // when the current pause began, guarded by pauseMutex
 	stats      Statistics
 	statsMutex sync.RWMutex
 }
 
-func New(cfg *config.Config) (*simulator, error) {
+var _ Simulator = (*simulator)(nil)
+
+// New creates a simulator for cfg
+func New(cfg *config.Config) (Simulator, error) {
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sim, nil
+}
+
+// addStageStats adds one core's stage counts into the running total.
+// Stages are matched by name, since heterogeneous cores may have different
+// pipelines; stages seen for the first time are appended.
+func addStageStats(total, core []pipeline.StageStat) []pipeline.StageStat {
+	for _, stage := range core {
+		i := 0
+		for i < len(total) && total[i].Name != stage.Name {
+			i++
+		}
+
+		if i == len(total) {
+			total = append(total, stage)
+			continue
+		}
+
+		total[i].BusyCycles += stage.BusyCycles
+		total[i].StallCycles += stage.StallCycles
+		total[i].EmptyCycles += stage.EmptyCycles
+		total[i].GatedCycles += stage.GatedCycles
+		total[i].Wakeups += stage.Wakeups
+	}
+	return total
+}
+
+// newSimulator builds the simulator, its cores and the resources they share
+func newSimulator(cfg *config.Config) (*simulator, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("nil configuration provided")
 	}
 
 	sim := &simulator{
-		config:   cfg,
-		clock:    0,
-		stopChan: make(chan struct{}),
+		config: cfg,
+		clock:  0,
 		stats: Statistics{
 			CoreUtilization: make([]float64, cfg.NumCores),
 		},
 	}
 
-	// Initialize cores
-	sim.cores = make([]*core.Processor, cfg.NumCores)
-	for i := 0; i < cfg.NumCores; i++ {
-		proc, err := core.NewProcessor(i, cfg)
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize core %d: %v", i, err)
-		}
-		sim.cores[i] = proc
+	// Initialize cores
+	sim.cores = make([]*core.Processor, cfg.NumCores)
+	for i := 0; i < cfg.NumCores; i++ {
+		proc, err := core.NewProcessor(i, cfg.ForCore(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize core %d: %v", i, err)
+		}
+		sim.cores[i] = proc
+	}
+	sim.seedCores()
+
+	// Cores of a type with its own clock keep time against clockFrequency
+	for i := range sim.cores {
+		if cfg.ForCore(i).ClockFrequency != cfg.ClockFrequency {
+			sim.coreClocks = make([]int, cfg.NumCores)
+			for j := range sim.coreClocks {
+				sim.coreClocks[j] = cfg.ForCore(j).ClockFrequency
+			}
+			sim.clockPhase = make([]int64, cfg.NumCores)
+			break
+		}
+	}
+
+	// Every overridden stage must exist in some core's pipeline
+	for name := range cfg.StageLatencies {
+		if !hasStage(sim.cores, name) {
+			return nil, fmt.Errorf("no core's pipeline has a %s stage to override the latency of", name)
+		}
+	}
+
+	if cfg.L3Shared {
+		l3, err := cache.NewCache("L3", cfg.L3Size, cfg.L3Associativity, cfg.L3Latency, cfg.LineSize())
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize shared L3 cache: %w", err)
+		}
+		if cfg.ReplacementPolicy != "" {
+			if err := l3.SetReplacementPolicy(cache.ReplacementPolicy(cfg.ReplacementPolicy), uint64(cfg.RandSeed)); err != nil {
+				return nil, fmt.Errorf("failed to initialize shared L3 cache: %w", err)
+			}
+		}
+		sim.l3 = l3
+
+		for i, proc := range sim.cores {
+			if err := proc.SetSharedL3(l3); err != nil {
+				return nil, fmt.Errorf("failed to share L3 with core %d: %w", i, err)
+			}
+		}
+	}
+
+	// Every core runs the same program; without one they use the synthetic generator
+	if cfg.WorkloadPath != "" {
+		program, err := workload.LoadProgram(cfg.WorkloadPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load workload: %w", err)
+		}
+
+		for _, proc := range sim.cores {
+			proc.LoadProgram(program)
+		}
+		sim.program = program.Instructions
+	}
+
+	if cfg.CoherenceProtocol != "None" {
+		ctrl, err := coherence.NewController(cfg.CoherenceProtocol, cfg.NumCores, cfg.LineSize())
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize coherence: %w", err)
+		}
+		sim.coherence = ctrl
+		ctrl.SetFalseSharingDetection(cfg.FalseSharingLines > 0)
+
+		for _, proc := range sim.cores {
+			proc.SetCoherenceController(ctrl)
+		}
+
+		if cfg.CacheToCacheFetch {
+			peers := make([]*cache.Hierarchy, len(sim.cores))
+			for i, proc := range sim.cores {
+				peers[i] = proc.GetCacheHierarchy()
+			}
+			for _, proc := range sim.cores {
+				proc.SetPeerCaches(peers)
+			}
+		}
+	}
+
+	rows, cols := 1, cfg.NumCores
+	if cfg.InterconnectType == interconnect.Mesh || cfg.InterconnectType == interconnect.Torus {
+		var ok bool
+		if rows, cols, ok = cfg.GridDimensions(); !ok {
+			return nil, fmt.Errorf("%d cores cannot form a %s grid with %g columns per row", cfg.NumCores, cfg.InterconnectType, cfg.MeshAspectRatio)
+		}
+	}
+
+	network, err := interconnect.NewGrid(cfg.InterconnectType, rows, cols, cfg.InterconnectBandwidth, cfg.ClockFrequency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize interconnect: %w", err)
+	}
+	network.SetHopLatency(cfg.PerHopLatency)
+	sim.network = network
+
+	for _, proc := range sim.cores {
+		proc.SetInterconnect(network)
+	}
+
+	if cfg.InterconnectType == interconnect.Bus && (cfg.SyncMode || cfg.Engine == "event") {
+		var priorities []int
+		if len(cfg.BusPriorities) > 0 {
+			priorities = cfg.BusPriorities
+		}
+		arbiter, err := coherence.NewBusArbiter(cfg.BusArbitrationPolicy, cfg.NumCores, priorities)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize bus arbiter: %w", err)
+		}
+		sim.arbiter = arbiter
+
+		for _, proc := range sim.cores {
+			proc.SetBusArbiter(arbiter)
+		}
+	}
+
+	if cfg.MemoryPorts > 0 {
+		ports, err := memory.NewMemoryPorts(cfg.MemoryPorts, cfg.NumCores)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize memory ports: %w", err)
+		}
+		sim.ports = ports
+
+		for _, proc := range sim.cores {
+			proc.SetMemoryPorts(ports)
+		}
+	}
+
+	if cfg.NUMANodes > 1 {
+		coreNodes := make([]int, cfg.NumCores)
+		for i := range coreNodes {
+			coreNodes[i] = cfg.NUMANode(i)
+		}
+
+		numa, err := memory.NewNUMA(cfg.NUMANodes, cfg.NUMARemotePenalty, coreNodes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize NUMA memory: %w", err)
+		}
+		sim.numa = numa
+
+		for _, proc := range sim.cores {
+			proc.SetNUMA(numa)
+		}
+	}
+
+	if cfg.DRAMBanks > 0 {
+		dram, err := memory.NewDRAM(cfg.DRAMBanks, cfg.DRAMBankShift, cfg.DRAMRowShift,
+			cfg.DRAMActivateLatency, cfg.DRAMPrechargeLatency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize DRAM: %w", err)
+		}
+		sim.dram = dram
+
+		for _, proc := range sim.cores {
+			proc.SetDRAM(dram)
+		}
+	}
+
+	if err := sim.Validate(); err != nil {
+		return nil, err
+	}
+
+	return sim, nil
+}
+
+// Validate cross-checks the cores against the instructions they will run,
+// catching misconfigurations that would otherwise only show as a stalled
+// run: every core needs a pipeline that suits its ISA and an execution unit
+// for each instruction type in the workload or synthetic mix. New calls it.
+func (s *simulator) Validate() error {
+	types, source := s.instructionTypes()
+	for i, proc := range s.cores {
+		if err := proc.Validate(types); err != nil {
+			return fmt.Errorf("core %d cannot run the %s: %w", i, source, err)
+		}
+	}
+	return nil
+}
+
+// instructionTypes returns the instruction types the cores will be given,
+// in a fixed order, and where they come from
+func (s *simulator) instructionTypes() ([]string, string) {
+	present := make(map[string]bool)
+	source := "instruction mix"
+	if s.program != nil {
+		source = "workload"
+		for _, inst := range s.program {
+			present[inst.Type()] = true
+		}
+	} else {
+		cfg := s.config
+		present["Integer"] = cfg.MixInteger > 0 || cfg.MixInteger+cfg.MixFloat+cfg.MixMemory+cfg.MixBranch == 0
+		present["Float"] = cfg.MixFloat > 0
+		present["Memory"] = cfg.MixMemory > 0
+		present["Branch"] = cfg.MixBranch > 0
+	}
+
+	var types []string
+	for _, instType := range []string{"Integer", "Float", "Memory", "Branch", "System"} {
+		if present[instType] {
+			types = append(types, instType)
+		}
+	}
+	return types, source
+}
+
+// hasStage reports whether any of cores has a pipeline stage called name
+func hasStage(cores []*core.Processor, name string) bool {
+	for _, proc := range cores {
+		for _, stage := range proc.GetPipelineState() {
+			if stage.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *simulator) Run(cycles int64) (*RunResult, error) {
+	return s.RunContext(context.Background(), cycles)
+}
+
+// RunContext runs the simulation for the given number of cycles, stopping
+// early if ctx is cancelled, its deadline passes, Shutdown is called or the
+// cores retire the configured MaxInstructions. Statistics for the cycles
+// completed before the stop are returned alongside the error.
+func (s *simulator) RunContext(ctx context.Context, cycles int64) (*RunResult, error) {
+	if cycles <= 0 {
+		return nil, fmt.Errorf("cycle count must be greater than 0")
+	}
+
+	s.runMutex.Lock()
+	if s.running.Load() {
+		s.runMutex.Unlock()
+		return nil, fmt.Errorf("simulation is already running")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	s.cancel, s.done, s.stopped = cancel, done, ctx.Done()
+	s.running.Store(true)
+	s.runMutex.Unlock()
+
+	// A paused run still stops when ctx is cancelled or Shutdown is called
+	stopResume := context.AfterFunc(ctx, func() { s.resumeRun(done) })
+
+	defer func() {
+		stopResume()
+		s.endRun()
+		cancel()
+		close(done)
+	}()
+
+	if warmup := int64(s.config.WarmupCycles); warmup > 0 && !s.warmedUp {
+		warmStart := time.Now()
+		if err := s.warmUp(ctx, warmup); err != nil {
+			// Report what the warmup gathered before it stopped
+			duration := time.Since(warmStart)
+			s.calculateStatistics(atomic.LoadInt64(&s.clock), duration)
+			return s.result(duration), err
+		}
+	}
+
+	startTime := time.Now()
+	atomic.StoreInt64(&s.clock, 0)
+
+	if s.sampler != nil {
+		s.sampler.begin(s.cores)
+	}
+
+	if s.progress != nil {
+		s.progress.begin(cycles, len(s.cores))
+	}
+
+	s.liveSince.Store(&startTime)
+	s.run(ctx, cycles)
+
+	// Lines still waiting to combine are written out as the run ends
+	for _, proc := range s.cores {
+		proc.DrainWriteCombining()
+	}
+
+	// Resume moves the start on past any pauses
+	duration := time.Since(*s.liveSince.Swap(nil))
+
+	// The clock is the furthest cycle any core reached
+	ranCycles := atomic.LoadInt64(&s.clock)
+	outputErr := s.finish(ranCycles, duration)
+
+	result := s.result(duration)
+
+	if err := ctx.Err(); err != nil && ranCycles < cycles {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return result, fmt.Errorf("simulation exceeded its wall-clock deadline after %d of %d cycles: %w", ranCycles, cycles, err)
+		}
+		return result, fmt.Errorf("simulation cancelled after %d of %d cycles: %w", ranCycles, cycles, err)
+	}
+
+	if ranCycles < cycles && s.overBudget() {
+		return result, fmt.Errorf("simulation stopped after %d of %d cycles: %w", ranCycles, cycles, ErrInstructionBudgetExceeded)
+	}
+
+	if ranCycles < cycles && s.deadlocked() {
+		return result, fmt.Errorf("simulation stopped after %d of %d cycles: %w: %s", ranCycles, cycles, ErrDeadlock, s.stallReport())
+	}
+
+	return result, outputErr
+}
+
+// result bundles the current statistics and warnings of a run that took
+// duration
+func (s *simulator) result(duration time.Duration) *RunResult {
+	return &RunResult{
+		Statistics: s.GetStatistics(),
+		Warnings:   s.collectWarnings(),
+		Duration:   duration,
+		Config:     *s.config.Clone(),
+	}
+}
+
+// Step advances the simulation by exactly one cycle, then updates the
+// statistics and flushes any samples and trace, so callers can inspect the
+// state between cycles. The cycle carries on from the previous Step or Run,
+// running the warmup first if it has not run yet. Stepping needs syncMode
+// and errors while a Run is in progress.
+func (s *simulator) Step() error {
+	if !s.config.SyncMode {
+		return fmt.Errorf("stepping needs syncMode")
+	}
+
+	s.runMutex.Lock()
+	if s.running.Load() {
+		s.runMutex.Unlock()
+		return fmt.Errorf("cannot step while the simulation is running")
+	}
+	s.running.Store(true)
+	s.runMutex.Unlock()
+
+	defer s.endRun()
+
+	if warmup := int64(s.config.WarmupCycles); warmup > 0 && !s.warmedUp {
+		if err := s.warmUp(context.Background(), warmup); err != nil {
+			return err
+		}
+		atomic.StoreInt64(&s.clock, 0)
+	}
+
+	if s.overBudget() {
+		return fmt.Errorf("simulation stopped after %d cycles: %w", atomic.LoadInt64(&s.clock), ErrInstructionBudgetExceeded)
+	}
+
+	if s.deadlocked() {
+		return fmt.Errorf("simulation stopped after %d cycles: %w: %s", atomic.LoadInt64(&s.clock), ErrDeadlock, s.stallReport())
+	}
+
+	// A fresh clock starts a new run; otherwise this cycle extends the last
+	cycle := atomic.LoadInt64(&s.clock) + 1
+	var elapsed time.Duration
+	if cycle == 1 {
+		if s.sampler != nil {
+			s.sampler.begin(s.cores)
+		}
+	} else {
+		elapsed = s.GetStatistics().WallClockDuration
+	}
+
+	startTime := time.Now()
+	s.cycleMutex.RLock()
+	s.tick(cycle)
+	s.cycleMutex.RUnlock()
+	return s.finish(cycle, elapsed+time.Since(startTime))
+}
+
+// finish brings the statistics up to date after cycles of a run taking
+// duration, and flushes any samples and trace, returning the first error
+// writing them
+func (s *simulator) finish(cycles int64, duration time.Duration) error {
+	s.calculateStatistics(cycles, duration)
+
+	var samplerErr error
+	if s.sampler != nil {
+		samplerErr = s.sampler.flush()
+	}
+
+	var traceErr error
+	if s.tracer != nil {
+		traceErr = s.tracer.flush()
+	}
+
+	var recordErr error
+	if s.recorder != nil {
+		recordErr = s.recorder.flush()
+	}
+
+	return errors.Join(samplerErr, traceErr, recordErr)
+}
+
+// warmUp runs cycles with sampling, progress and tracing off, then zeroes
+// every counter while keeping the cache, predictor and architectural state,
+// so the measured run starts from a warm machine
+func (s *simulator) warmUp(ctx context.Context, cycles int64) error {
+	smp, prog, tr := s.sampler, s.progress, s.tracer
+	s.sampler, s.progress, s.tracer = nil, nil, nil
+	atomic.StoreInt64(&s.clock, 0)
+
+	s.run(ctx, cycles)
+	s.sampler, s.progress, s.tracer = smp, prog, tr
+
+	if ran := atomic.LoadInt64(&s.clock); ran < cycles {
+		if s.overBudget() {
+			return fmt.Errorf("simulation stopped during warmup after %d of %d cycles: %w", ran, cycles, ErrInstructionBudgetExceeded)
+		}
+		if s.deadlocked() {
+			return fmt.Errorf("simulation stopped during warmup after %d of %d cycles: %w: %s", ran, cycles, ErrDeadlock, s.stallReport())
+		}
+		return fmt.Errorf("simulation cancelled during warmup after %d of %d cycles: %w", ran, cycles, ctx.Err())
+	}
+
+	if s.coherence != nil {
+		s.coherence.ResetStats()
+	}
+
+	if s.network != nil {
+		s.network.ResetStats(cycles)
+	}
+
+	if s.ports != nil {
+		s.ports.ResetStats()
+	}
+
+	if s.numa != nil {
+		s.numa.Reset()
+	}
+
+	if s.dram != nil {
+		s.dram.ResetStats()
+	}
+
+	if s.arbiter != nil {
+		s.arbiter.ResetStats()
+	}
+
+	if s.l3 != nil {
+		s.l3.ResetStats()
+	}
+
+	for _, proc := range s.cores {
+		proc.ResetStats()
+	}
+	s.warmedUp = true
+
+	return nil
+}
+
+// run advances the cores for cycles with the configured engine
+func (s *simulator) run(ctx context.Context, cycles int64) {
+	switch {
+	case s.config.Engine == "event":
+		s.runEvents(ctx, cycles)
+	case s.config.SyncMode:
+		s.runSync(ctx, cycles)
+	default:
+		s.runAsync(ctx, cycles)
+	}
+}
+
+// runAsync runs each core on its own goroutine. Cores race ahead of one
+// another, so cross-core interactions are not cycle-accurate.
+func (s *simulator) runAsync(ctx context.Context, cycles int64) {
+	var wg sync.WaitGroup
+	for _, proc := range s.cores {
+		wg.Add(1)
+		go func(p *core.Processor) {
+			defer wg.Done()
+			for c := int64(0); c < cycles; c++ {
+				if (c%contextCheckInterval == 0 && ctx.Err() != nil) || s.overBudget() {
+					return
+				}
+				s.cycleMutex.RLock()
+				p.Cycle()
+				s.advanceClock(c + 1)
+				s.cycleMutex.RUnlock()
+
+				// Samples follow core 0's timeline
+				if s.sampler != nil && p.GetID() == 0 && s.sampler.due(c+1) {
+					s.sampler.sample(c+1, s.cores)
+				}
+
+				if s.progress != nil {
+					s.progress.coreDone(p.GetID(), c+1)
+				}
+			}
+		}(proc)
+	}
+
+	wg.Wait()
+}
+
+// runSync advances every core by one cycle, in core ID order, before the
+// global clock ticks, making multi-core runs deterministic
+func (s *simulator) runSync(ctx context.Context, cycles int64) {
+	for c := int64(0); c < cycles; c++ {
+		if (c%contextCheckInterval == 0 && ctx.Err() != nil) || s.overBudget() || s.deadlocked() {
+			return
+		}
+
+		s.cycleMutex.RLock()
+		s.tick(c + 1)
+		s.cycleMutex.RUnlock()
+
+		if s.progress != nil && s.progress.due(c+1) {
+			s.progress.report(c + 1)
+		}
+	}
+}
+
+// runEvents runs like runSync, except that whenever every core is idle it
+// jumps the clock to the next cycle at which a core, a sample or a progress
+// report has work, accounting for the skipped cycles without running them.
+// The statistics match those of stepping every cycle.
+func (s *simulator) runEvents(ctx context.Context, cycles int64) {
+	for c, i := int64(0), int64(0); c < cycles; i++ {
+		if (i%contextCheckInterval == 0 && ctx.Err() != nil) || s.overBudget() || s.deadlocked() {
+			return
+		}
+
+		s.cycleMutex.RLock()
+		if skip := s.idleCycles(c, cycles); skip > 0 {
+			s.skipIdle(skip)
+			c += skip
+			atomic.StoreInt64(&s.clock, c)
+			s.cycleMutex.RUnlock()
+			continue
+		}
+
+		c++
+		s.tick(c)
+		s.cycleMutex.RUnlock()
+
+		if s.progress != nil && s.progress.due(c) {
+			s.progress.report(c)
+		}
+	}
+}
+
+// idleCycles returns how many cycles after cycle c, up to the end of the
+// run, every core is certain to spend idle with no sample or progress
+// report due. A trace records every cycle, so nothing is skipped while
+// tracing, nor when cores keep their own clocks.
+func (s *simulator) idleCycles(c, cycles int64) int64 {
+	if s.tracer != nil || s.coreClocks != nil {
+		return 0
+	}
+
+	idle := cycles - c
+	if s.sampler != nil {
+		idle = min(idle, (c/s.sampler.interval+1)*s.sampler.interval-c-1)
+	}
+
+	if s.progress != nil {
+		idle = min(idle, (c/s.progress.interval+1)*s.progress.interval-c-1)
+	}
+
+	for _, proc := range s.cores {
+		if idle = proc.IdleCycles(idle); idle == 0 {
+			break
+		}
+	}
+	return idle
+}
+
+// skipIdle accounts for n cycles in which every core sits idle
+func (s *simulator) skipIdle(n int64) {
+	if s.ports != nil {
+		s.ports.BeginCycle()
+	}
+
+	if s.arbiter != nil {
+		s.arbiter.BeginCycle()
+	}
+
+	for _, proc := range s.cores {
+		proc.SkipIdle(n)
+	}
+	s.stuck = 0
+}
+
+// tick advances every core by one cycle, then moves the global clock on to
+// cycle, tracing and sampling it. A core on its own clock instead runs as
+// many cycles as its clock has completed by then, so a core at half
+// clockFrequency runs every other tick. Cores run in core ID order, or on a
+// bus in the order the arbiter would grant it, so that of the cores needing
+// the bus in the same cycle the one it favors gets it and the others wait.
+func (s *simulator) tick(cycle int64) {
+	if s.ports != nil {
+		s.ports.BeginCycle()
+	}
+
+	if s.arbiter == nil {
+		for i, proc := range s.cores {
+			for n := s.coreCycles(i); n > 0; n-- {
+				proc.Cycle()
+			}
+		}
+	} else {
+		s.arbiter.BeginCycle()
+		for _, i := range s.arbiter.Order() {
+			for n := s.coreCycles(i); n > 0; n-- {
+				s.cores[i].Cycle()
+			}
+		}
+	}
+	s.watchProgress()
+	atomic.StoreInt64(&s.clock, cycle)
+
+	if s.tracer != nil {
+		s.tracer.trace(cycle, s.cores)
+	}
+
+	if s.sampler != nil && s.sampler.due(cycle) {
+		s.sampler.sample(cycle, s.cores)
+	}
+}
+
+// coreCycles returns how many cycles core i runs in the next tick of the
+// global clock
+func (s *simulator) coreCycles(i int) int64 {
+	if s.coreClocks == nil {
+		return 1
+	}
+
+	base := int64(s.config.ClockFrequency)
+	s.clockPhase[i] += int64(s.coreClocks[i])
+	n := s.clockPhase[i] / base
+	s.clockPhase[i] -= n * base
+	return n
+}
+
+// coreClock returns the clock frequency of core i in MHz
+func (s *simulator) coreClock(i int) int {
+	if s.coreClocks == nil {
+		return s.config.ClockFrequency
+	}
+	return s.coreClocks[i]
+}
+
+// watchProgress counts the cycles in a row that cores had instructions in
+// flight or an interrupt handler running, yet none retired an instruction
+func (s *simulator) watchProgress() {
+	if s.config.DeadlockCycles <= 0 {
+		return
+	}
+
+	retired, busy := int64(0), false
+	for _, proc := range s.cores {
+		retired += proc.GetExecutedInstructions()
+		busy = busy || proc.IsBusy()
+	}
+
+	if retired != s.retired || !busy {
+		s.stuck = 0
+	} else {
+		s.stuck++
 	}
+	s.retired = retired
+}
 
-	return sim, nil
+// deadlocked reports whether the cores have gone DeadlockCycles without
+// retiring an instruction while there was work in flight
+func (s *simulator) deadlocked() bool {
+	return s.config.DeadlockCycles > 0 && s.stuck >= int64(s.config.DeadlockCycles)
 }
 
-func (s *simulator) Run(cycles int64) error {
-	if cycles <= 0 {
-		return fmt.Errorf("cycle count must be greater than 0")
+// stallReport describes what each core is stuck on and the transfers still
+// occupying the interconnect, for a deadlock error
+func (s *simulator) stallReport() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "no instruction retired in %d cycles", s.stuck)
+	for i, proc := range s.cores {
+		fmt.Fprintf(&b, "\n\tcore %d: %s", i, proc.StallReport())
 	}
 
-	// Atomically check and set running flag
-	if !s.running.CompareAndSwap(false, true) {
-		return fmt.Errorf("simulation is already running")
+	// Transfers are timed by the cores' cycles
+	if s.network != nil {
+		if links, freeAt := s.network.Backlog(s.cores[0].GetCycleCount()); links > 0 {
+			fmt.Fprintf(&b, "\n\tinterconnect: %d links carrying transfers until cycle %d", links, freeAt)
+		}
 	}
+	return b.String()
+}
 
-	startTime := time.Now()
-
-	// for i := int64(0); i < cycles; i++ {
-	// 	select {
-	// 	case <-s.stopChan:
-	// 		s.running.Store(false)
-	// 		return nil
-	// 	default:
-	// 		atomic.AddInt64(&s.clock, 1)
-	// 		s.simulateOneCycle()
-	// 	}
-	// }
+// overBudget reports whether the cores have retired the configured
+// instruction budget
+func (s *simulator) overBudget() bool {
+	if s.config.MaxInstructions <= 0 {
+		return false
+	}
 
+	retired := int64(0)
 	for _, proc := range s.cores {
-		s.wg.Add(1)
-		go func(p *core.Processor) {
-			defer s.wg.Done()
-			for i := int64(0); i < cycles; i++ {
-				select {
-				case <-s.stopChan:
-					return
-				default:
-					p.Cycle()
-				}
-			}
-		}(proc)
+		retired += proc.GetExecutedInstructions()
+	}
+	return retired >= s.config.MaxInstructions
+}
+
+// advanceClock raises the global clock to cycle if it is behind
+func (s *simulator) advanceClock(cycle int64) {
+	for {
+		current := atomic.LoadInt64(&s.clock)
+		if cycle <= current || atomic.CompareAndSwapInt64(&s.clock, current, cycle) {
+			return
+		}
 	}
+}
 
-	s.wg.Wait()
-	s.running.Store(false)
-	duration := time.Since(startTime)
+// collectWarnings reports non-fatal conditions seen in the latest statistics
+func (s *simulator) collectWarnings() []string {
+	s.statsMutex.RLock()
+	defer s.statsMutex.RUnlock()
+
+	var warnings []string
+	for i, proc := range s.cores {
+		if s.stats.TotalCycles > 0 && proc.GetExecutedInstructions() == 0 {
+			warnings = append(warnings, fmt.Sprintf("core %d retired no instructions", i))
+		}
 
-	// s.statsMutex.Lock()
-	// s.stats.TotalCycles = atomic.LoadInt64(&s.clock)
-	// s.statsMutex.Unlock()
+		if proc.IsHalted() {
+			warnings = append(warnings, fmt.Sprintf("core %d halted on a memory fault", i))
+		}
+	}
 
-	s.calculateStatistics(cycles)
+	if s.stats.MemoryFaults > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d accesses fell outside the %d bytes of memory", s.stats.MemoryFaults, s.config.MemorySize))
+	}
 
-	fmt.Printf("Simulated %d cycles in %v (%.2f cycles/second)\n)", cycles, duration, float64(cycles)/duration.Seconds())
-	fmt.Printf("\nSimulation Summary:\n")
-	fmt.Printf("Total Cycles: %d\n", s.stats.TotalCycles)
-	fmt.Printf("Instructions Executed: %d\n", s.stats.InstructionsExecuted)
-	fmt.Printf("IPC: %.2f\n", s.stats.IPC)
-	fmt.Printf("Cache Hit Rate: %.2f%%\n", s.stats.CacheHitRate*100)
-	fmt.Printf("Core Utilization: %.2f%%\n", s.stats.CoreUtilization[0]*100)
-	fmt.Printf("Memory Access Latency: %.2f cycles\n", s.stats.MemoryAccessLatency)
+	coreCycles := s.stats.TotalCycles * int64(len(s.cores))
+	if coreCycles > 0 && s.stats.InterruptCycles*2 > coreCycles {
+		warnings = append(warnings, fmt.Sprintf("interrupt handlers consumed %.0f%% of core cycles",
+			float64(s.stats.InterruptCycles)/float64(coreCycles)*100))
+	}
 
-	return nil
+	return warnings
 }
 
-func (s *simulator) calculateStatistics(cycles int64) {
+func (s *simulator) calculateStatistics(cycles int64, duration time.Duration) {
 	s.statsMutex.Lock()
 	defer s.statsMutex.Unlock()
 
 	s.stats.TotalCycles = cycles
 
+	s.stats.WallClockDuration = duration
+	s.stats.SimulatedCyclesPerSecond = 0.0
+	if secs := duration.Seconds(); secs > 0 {
+		s.stats.SimulatedCyclesPerSecond = float64(cycles) / secs
+	}
+
 	totalInstructions := int64(0)
+	cacheAccesses, cacheHits := int64(0), int64(0)
+	s.stats.DirtyEvictions = 0
+	s.stats.BackInvalidations = 0
+	s.stats.Prefetches, s.stats.UsefulPrefetches = 0, 0
+	s.stats.HazardStallCycles = 0
+	s.stats.ForwardedHazards = 0
+	s.stats.WAWStallCycles, s.stats.WARStallCycles = 0, 0
+	s.stats.StructuralStallCycles = 0
+	s.stats.MemoryPortStalls = 0
+	s.stats.HitsUnderMiss = 0
+	s.stats.HitUnderMissCycles = 0
+	s.stats.StoreBufferStalls, s.stats.StoreForwards = 0, 0
+	s.stats.CombinedStores, s.stats.FullLineWrites, s.stats.PartialLineWrites = 0, 0, 0
+	s.stats.BranchStats = predictor.Stats{}
+	s.stats.MispredictCycles = 0
+	s.stats.FlushCycles = 0
+	s.stats.Flushes = make(map[string]int64)
+	s.stats.TakenBranches = 0
+	s.stats.FetchRedirects = 0
+	s.stats.PredicatedInstructions = 0
+	s.stats.AvoidedFlushes = 0
+	s.stats.FetchQueueStalls = 0
+	s.stats.MemoryFaults = 0
+	s.stats.PeerFetches = 0
+	s.stats.Interrupts = 0
+	unitBusy, unitCount := make(map[string]float64), make(map[string]int)
+	dataAccesses, dataAccessCycles := int64(0), int64(0)
+	latencyCounts := make([]int64, len(s.config.LatencyBuckets)+1)
+	l3Hits, l3Lookups := int64(0), int64(0)
+	tlbHits, tlbLookups := int64(0), int64(0)
+	s.stats.StageStats = nil
+	s.stats.GatedCycles, s.stats.Wakeups = 0, 0
+	s.stats.InterruptCycles = 0
+	s.stats.HandlerInstructions = 0
+	s.stats.RetiredByType = make(map[string]int64)
+	s.stats.ThreadIPC = make([][]float64, len(s.cores))
+	s.stats.CoreStallCycles = make([]int64, len(s.cores))
+	s.stats.CoreBubbleCycles = make([]int64, len(s.cores))
+	s.stats.CoreClockFrequencies = make([]int, len(s.cores))
+	s.stats.CoreEffectiveIPC = make([]float64, len(s.cores))
+	activity := energy.Counters{Cycles: cycles, RetiredByType: s.stats.RetiredByType}
 	for i, proc := range s.cores {
 		instructions := proc.GetExecutedInstructions()
 		totalInstructions += instructions
 
+		for instType, n := range proc.GetRetiredByType() {
+			s.stats.RetiredByType[instType] += n
+		}
+
+		threadInstructions := proc.GetThreadInstructions()
+		s.stats.ThreadIPC[i] = make([]float64, len(threadInstructions))
+		if cycles > 0 {
+			for t, n := range threadInstructions {
+				s.stats.ThreadIPC[i][t] = float64(n) / float64(cycles)
+			}
+		}
+
+		caches := proc.GetCacheHierarchy()
+		cacheAccesses += caches.Accesses()
+		cacheHits += caches.CacheHits()
+		s.stats.DirtyEvictions += caches.DirtyEvictions()
+		s.stats.BackInvalidations += caches.BackInvalidations()
+		prefetches, useful := caches.Prefetches()
+		s.stats.Prefetches += prefetches
+		s.stats.UsefulPrefetches += useful
+		for level, c := range caches.Levels {
+			if c == s.l3 {
+				continue // counted once for every core below
+			}
+			stats := c.GetStats()
+			if level == len(caches.Levels)-1 {
+				l3Hits += stats.Hits
+				l3Lookups += stats.Hits + stats.Misses
+			} else {
+				activity.CacheAccesses[level] += stats.Hits + stats.Misses
+			}
+		}
+		activity.MemoryAccesses += caches.Accesses() - caches.CacheHits() + caches.PrefetchFills() + caches.MemoryWrites()
+
+		s.stats.HazardStallCycles += proc.GetHazardStalls()
+		s.stats.ForwardedHazards += proc.GetForwardedHazards()
+		waw, war := proc.GetScoreboardStalls()
+		s.stats.WAWStallCycles += waw
+		s.stats.WARStallCycles += war
+		s.stats.StructuralStallCycles += proc.GetStructuralStalls()
+
+		stages := proc.GetStageStats()
+		s.stats.StageStats = addStageStats(s.stats.StageStats, stages)
+		for _, stage := range stages {
+			s.stats.GatedCycles += stage.GatedCycles
+			s.stats.Wakeups += stage.Wakeups
+			activity.StageCycles += stage.BusyCycles + stage.StallCycles + stage.EmptyCycles
+			activity.GatedCycles += stage.GatedCycles
+		}
+
+		hits, misses := proc.GetTLBLookups()
+		tlbHits += hits
+		tlbLookups += hits + misses
+
+		storeBuffer := proc.GetStoreBufferStats()
+		s.stats.StoreBufferStalls += storeBuffer.FullStalls
+		s.stats.StoreForwards += storeBuffer.Forwards
+
+		writeCombining := proc.GetWriteCombiningStats()
+		s.stats.CombinedStores += writeCombining.CombinedWrites
+		s.stats.FullLineWrites += writeCombining.FullLineFlushes
+		s.stats.PartialLineWrites += writeCombining.PartialFlushes
+
+		accesses, latency := proc.GetDataAccesses()
+		dataAccesses += accesses
+		dataAccessCycles += latency
+
+		for bucket, n := range proc.GetLatencyHistogram() {
+			latencyCounts[bucket] += n
+		}
+
+		for unitType, units := range proc.GetUnitUtilization() {
+			for _, util := range units {
+				unitBusy[unitType] += util
+				unitCount[unitType]++
+			}
+		}
+
+		branches := proc.GetBranchStats()
+		s.stats.BranchStats.Predictions += branches.Predictions
+		s.stats.BranchStats.Mispredictions += branches.Mispredictions
+		s.stats.MispredictCycles += proc.GetMispredictCycles()
+		s.stats.FlushCycles += proc.GetFlushCycles()
+		for reason, n := range proc.GetFlushes() {
+			s.stats.Flushes[reason] += n
+		}
+		s.stats.TakenBranches += proc.GetTakenBranches()
+		s.stats.FetchRedirects += proc.GetFetchRedirects()
+		predicated, avoided := proc.GetPredication()
+		s.stats.PredicatedInstructions += predicated
+		s.stats.AvoidedFlushes += avoided
+		s.stats.FetchQueueStalls += proc.GetFetchQueueStalls()
+		s.stats.MemoryFaults += proc.GetMemoryFaults()
+		s.stats.PeerFetches += proc.GetPeerFetches()
+		hitsUnderMiss, hitUnderMissCycles := proc.GetHitUnderMiss()
+		s.stats.HitsUnderMiss += hitsUnderMiss
+		s.stats.HitUnderMissCycles += hitUnderMissCycles
+		s.stats.Interrupts += proc.GetInterrupts()
+		s.stats.InterruptCycles += proc.GetInterruptCycles()
+		s.stats.HandlerInstructions += proc.GetHandlerInstructions()
+
 		// Update per-core utilizaiton
 		s.stats.CoreUtilization[i] = proc.GetUtilization()
+		s.stats.CoreStallCycles[i] = proc.GetStallCycles()
+		s.stats.CoreBubbleCycles[i] = proc.GetBubbleCycles()
+		s.stats.CoreClockFrequencies[i] = s.coreClock(i)
+		if cycles > 0 {
+			s.stats.CoreEffectiveIPC[i] = float64(instructions) / float64(cycles)
+		}
 	}
 
 	s.stats.InstructionsExecuted = totalInstructions
 
+	s.stats.UnitUtilization = make(map[string]float64, len(unitBusy))
+	for unitType, busy := range unitBusy {
+		s.stats.UnitUtilization[unitType] = busy / float64(unitCount[unitType])
+	}
+	s.stats.BranchAccuracy = s.stats.BranchStats.Accuracy()
+
+	s.stats.InterconnectUtilization = 0.0
+	s.stats.AverageMessageLatency, s.stats.AverageHopCount = 0.0, 0.0
+	s.stats.LinkUtilization = nil
+	if s.network != nil {
+		s.stats.InterconnectUtilization = s.network.Utilization(cycles)
+		s.stats.AverageMessageLatency = s.network.AverageLatency()
+		s.stats.AverageHopCount = s.network.AverageHops()
+		s.stats.LinkUtilization = s.network.LinkUtilization(cycles)
+	}
+
+	if s.ports != nil {
+		for _, stalls := range s.ports.Stalls() {
+			s.stats.MemoryPortStalls += stalls
+		}
+	}
+
+	if s.numa != nil {
+		s.stats.NUMALocalAccesses, s.stats.NUMARemoteAccesses = s.numa.Accesses()
+		if total := s.stats.NUMALocalAccesses + s.stats.NUMARemoteAccesses; total > 0 {
+			s.stats.NUMALocalRatio = float64(s.stats.NUMALocalAccesses) / float64(total)
+		}
+	}
+
+	if s.dram != nil {
+		dram := s.dram.Stats()
+		s.stats.DRAMRowHits, s.stats.DRAMRowMisses, s.stats.DRAMRowConflicts = dram.RowHits, dram.RowMisses, dram.RowConflicts
+		s.stats.DRAMRowHitRate = dram.RowHitRate()
+	}
+
+	s.stats.CoreBusWaitCycles = nil
+	if s.arbiter != nil {
+		s.stats.CoreBusWaitCycles = s.arbiter.WaitCycles()
+	}
+
+	s.stats.MemoryAccessLatency = 0.0
+	if dataAccesses > 0 {
+		s.stats.MemoryAccessLatency = float64(dataAccessCycles) / float64(dataAccesses)
+	}
+
+	s.stats.MemoryLatencyHistogram = nil
+	if len(s.config.LatencyBuckets) > 0 {
+		s.stats.MemoryLatencyHistogram = latencyHistogram(s.config.LatencyBuckets, latencyCounts)
+	}
+
+	if s.l3 != nil {
+		stats := s.l3.GetStats()
+		l3Hits += stats.Hits
+		l3Lookups += stats.Hits + stats.Misses
+		s.stats.DirtyEvictions += stats.DirtyEvictions
+	}
+	activity.CacheAccesses[len(activity.CacheAccesses)-1] += l3Lookups
+
+	s.stats.L3HitRate = 0.0
+	if l3Lookups > 0 {
+		s.stats.L3HitRate = float64(l3Hits) / float64(l3Lookups)
+	}
+
+	s.stats.TLBHitRate = 0.0
+	if tlbLookups > 0 {
+		s.stats.TLBHitRate = float64(tlbHits) / float64(tlbLookups)
+	}
+
+	s.stats.CacheHitRate = 0.0
+	s.stats.PrefetchHitRateGain = 0.0
+	if cacheAccesses > 0 {
+		s.stats.CacheHitRate = float64(cacheHits) / float64(cacheAccesses)
+		s.stats.PrefetchHitRateGain = float64(s.stats.UsefulPrefetches) / float64(cacheAccesses)
+	}
+
+	s.stats.PrefetchAccuracy = 0.0
+	if s.stats.Prefetches > 0 {
+		s.stats.PrefetchAccuracy = float64(s.stats.UsefulPrefetches) / float64(s.stats.Prefetches)
+	}
+
+	if s.coherence != nil {
+		s.stats.CoherenceStats = s.coherence.GetStats()
+		s.stats.FalseSharingLines = s.coherence.FalseSharing(s.config.FalseSharingLines)
+	}
+
+	est := energy.Estimate(s.config, activity)
+	s.stats.TotalEnergy, s.stats.AveragePower = est.Total, est.AveragePower
+
 	// Calculate IPC (Instructions per Cycle per Core)
 	if cycles > 0 {
 		// Important! IPC is calculated by dividing the total instructions by the product of cycles and the number of cores
@@ -146,55 +1312,525 @@ func (s *simulator) calculateStatistics(cycles int64) {
 	// TODO: other stats in the future
 }
 
+// GetStatistics returns a copy of the statistics of the latest run. During a
+// run they are first recomputed from the cores' counters, so a snapshot
+// taken mid-run covers the cycles simulated so far; in async mode the cores
+// may be a few cycles apart.
 func (s *simulator) GetStatistics() Statistics {
+	// A paused run keeps the statistics taken as it paused
+	if start := s.liveSince.Load(); start != nil && !s.paused.Load() {
+		s.calculateStatistics(atomic.LoadInt64(&s.clock), time.Since(*start))
+	}
+
 	s.statsMutex.RLock()
 	defer s.statsMutex.RUnlock()
 
-	statsCopy := Statistics{
-		TotalCycles:             s.stats.TotalCycles,
-		InstructionsExecuted:    s.stats.InstructionsExecuted,
-		IPC:                     s.stats.IPC,
-		CacheHitRate:            s.stats.CacheHitRate,
-		CoreUtilization:         make([]float64, len(s.stats.CoreUtilization)),
-		MemoryAccessLatency:     s.stats.MemoryAccessLatency,
-		InterconnectUtilization: s.stats.InterconnectUtilization,
-	}
+	// Copy the slice and map so callers cannot race with the next run
+	statsCopy := s.stats
+	statsCopy.CoreUtilization = make([]float64, len(s.stats.CoreUtilization))
 	copy(statsCopy.CoreUtilization, s.stats.CoreUtilization)
+	statsCopy.StageStats = append([]pipeline.StageStat(nil), s.stats.StageStats...)
+	statsCopy.CoreStallCycles = append([]int64(nil), s.stats.CoreStallCycles...)
+	statsCopy.CoreBubbleCycles = append([]int64(nil), s.stats.CoreBubbleCycles...)
+	statsCopy.CoreBusWaitCycles = append([]int64(nil), s.stats.CoreBusWaitCycles...)
+	statsCopy.CoreClockFrequencies = append([]int(nil), s.stats.CoreClockFrequencies...)
+	statsCopy.CoreEffectiveIPC = append([]float64(nil), s.stats.CoreEffectiveIPC...)
+	statsCopy.MemoryLatencyHistogram = append([]BucketCount(nil), s.stats.MemoryLatencyHistogram...)
+	statsCopy.FalseSharingLines = append([]coherence.FalseSharingLine(nil), s.stats.FalseSharingLines...)
+
+	if s.stats.ThreadIPC != nil {
+		statsCopy.ThreadIPC = make([][]float64, len(s.stats.ThreadIPC))
+		for i, perThread := range s.stats.ThreadIPC {
+			statsCopy.ThreadIPC[i] = append([]float64(nil), perThread...)
+		}
+	}
+
+	if s.stats.RetiredByType != nil {
+		statsCopy.RetiredByType = make(map[string]int64, len(s.stats.RetiredByType))
+		for instType, n := range s.stats.RetiredByType {
+			statsCopy.RetiredByType[instType] = n
+		}
+	}
+
+	if s.stats.Flushes != nil {
+		statsCopy.Flushes = make(map[string]int64, len(s.stats.Flushes))
+		for reason, n := range s.stats.Flushes {
+			statsCopy.Flushes[reason] = n
+		}
+	}
+
+	if s.stats.UnitUtilization != nil {
+		statsCopy.UnitUtilization = make(map[string]float64, len(s.stats.UnitUtilization))
+		for unitType, util := range s.stats.UnitUtilization {
+			statsCopy.UnitUtilization[unitType] = util
+		}
+	}
 
 	return statsCopy
 }
 
+// CoreCount returns the number of simulated cores
+func (s *simulator) CoreCount() int {
+	return len(s.cores)
+}
+
+// CoreStats returns the current statistics of core i
+func (s *simulator) CoreStats(i int) (CoreStatistics, error) {
+	if i < 0 || i >= len(s.cores) {
+		return CoreStatistics{}, fmt.Errorf("core %d out of range, want 0 to %d", i, len(s.cores)-1)
+	}
+
+	proc := s.cores[i]
+	stats := CoreStatistics{
+		Core:                 i,
+		Cycles:               proc.GetCycleCount(),
+		ClockFrequency:       s.coreClock(i),
+		InstructionsExecuted: proc.GetExecutedInstructions(),
+		Utilization:          proc.GetUtilization(),
+		StallCycles:          proc.GetStallCycles(),
+		BubbleCycles:         proc.GetBubbleCycles(),
+		StageStats:           proc.GetStageStats(),
+		MemoryFaults:         proc.GetMemoryFaults(),
+		Halted:               proc.IsHalted(),
+	}
+
+	if s.arbiter != nil {
+		stats.BusWaitCycles = s.arbiter.WaitCycles()[i]
+	}
+
+	writeCombining := proc.GetWriteCombiningStats()
+	stats.CombinedStores = writeCombining.CombinedWrites
+	stats.FullLineWrites = writeCombining.FullLineFlushes
+	stats.PartialLineWrites = writeCombining.PartialFlushes
+
+	if stats.Cycles > 0 {
+		stats.IPC = float64(stats.InstructionsExecuted) / float64(stats.Cycles)
+	}
+
+	if len(stats.StageStats) > 0 {
+		for _, stage := range stats.StageStats {
+			stats.PipelineOccupancy += stage.Occupancy()
+			stats.GatedCycles += stage.GatedCycles
+			stats.Wakeups += stage.Wakeups
+		}
+		stats.PipelineOccupancy /= float64(len(stats.StageStats))
+	}
+
+	return stats, nil
+}
+
+// AddrCount is the number of times the instruction at an address retired
+type AddrCount struct {
+	Address uint64 `json:"address"`
+	Count   int64  `json:"count"`
+}
+
+// HotInstructions returns the topN instruction addresses retired most often
+// across all cores, most retired first and ties in address order. A topN of
+// 0 or less returns every address. It returns nil unless profileHotspots is
+// set.
+func (s *simulator) HotInstructions(topN int) []AddrCount {
+	if !s.config.ProfileHotspots {
+		return nil
+	}
+
+	counts := make(map[uint64]int64)
+	for _, proc := range s.cores {
+		for addr, n := range proc.GetRetiredByAddress() {
+			counts[addr] += n
+		}
+	}
+
+	hot := make([]AddrCount, 0, len(counts))
+	for addr, n := range counts {
+		hot = append(hot, AddrCount{Address: addr, Count: n})
+	}
+
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].Count != hot[j].Count {
+			return hot[i].Count > hot[j].Count
+		}
+		return hot[i].Address < hot[j].Address
+	})
+
+	if topN > 0 && topN < len(hot) {
+		hot = hot[:topN]
+	}
+	return hot
+}
+
+// SetSampler records IPC, busy core count and cache hit rate to w as CSV
+// every interval cycles of subsequent runs, starting with a header row. In
+// async mode samples are taken as core 0 reaches each interval, so other
+// cores may be slightly ahead or behind.
+func (s *simulator) SetSampler(w io.Writer, interval int64) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot change the sampler while the simulation is running")
+	}
+
+	smp, err := newSampler(w, interval)
+	if err != nil {
+		return err
+	}
+
+	s.sampler = smp
+	return nil
+}
+
+// SetProgress calls fn every interval cycles of subsequent runs with the
+// cycles completed and the cycles requested. In async mode the slowest core's
+// cycle is reported. fn runs on a simulation goroutine and is never called
+// after Run returns; a nil fn disables reporting.
+func (s *simulator) SetProgress(fn ProgressFunc, interval int64) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot change progress reporting while the simulation is running")
+	}
+
+	if fn == nil {
+		s.progress = nil
+		return nil
+	}
+
+	p, err := newProgress(fn, interval)
+	if err != nil {
+		return err
+	}
+
+	s.progress = p
+	return nil
+}
+
+// SetTrace writes a line per core per cycle of subsequent runs to w, naming
+// the instructions in each pipeline stage. Tracing needs sync mode so lines
+// follow a single clock; a nil w disables it.
+func (s *simulator) SetTrace(w io.Writer) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot change tracing while the simulation is running")
+	}
+
+	if w == nil {
+		s.tracer = nil
+		return nil
+	}
+
+	if !s.config.SyncMode {
+		return fmt.Errorf("tracing needs syncMode")
+	}
+
+	s.tracer = newTracer(w, s.config.OutOfOrder)
+	return nil
+}
+
+// SetRecorder writes every instruction the cores retire in subsequent runs,
+// warmup included, to w as CSV rows naming the core, thread, address,
+// opcode, type, operands, branch target and length, starting with a header
+// row. Replay plays such a recording back. A nil w disables recording.
+func (s *simulator) SetRecorder(w io.Writer) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot change recording while the simulation is running")
+	}
+
+	if w == nil {
+		s.recorder = nil
+		for _, proc := range s.cores {
+			proc.SetRetireHook(nil)
+		}
+		return nil
+	}
+
+	rec, err := newRecorder(w)
+	if err != nil {
+		return err
+	}
+
+	s.recorder = rec
+	for _, proc := range s.cores {
+		id := proc.GetID()
+		proc.SetRetireHook(func(inst core.Instruction) {
+			rec.retire(id, inst)
+		})
+	}
+	return nil
+}
+
+// Replay makes each core fetch the instructions it retired in a recording
+// read from r, by address, instead of its configured source. Cores the
+// recording has no instructions for go idle. Run from the same
+// configuration in sync mode, a replay retires the same instructions in the
+// same cycles as the recorded run, as long as cores issue in order and run
+// one hardware thread each. Out-of-order cores execute wrong-path
+// instructions the recording never saw, and threads share an address space,
+// so a recording of several can only replay one instruction per address.
+func (s *simulator) Replay(r io.Reader) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot replay a recording while the simulation is running")
+	}
+
+	recording, err := ReadRecording(r)
+	if err != nil {
+		return err
+	}
+	if len(recording) > len(s.cores) {
+		return fmt.Errorf("recording has instructions for %d cores, the simulator has %d", len(recording), len(s.cores))
+	}
+
+	for i, proc := range s.cores {
+		var trace []core.Instruction
+		if i < len(recording) {
+			trace = recording[i]
+		}
+		proc.SetInstructionSource(core.NewTraceSource(trace))
+	}
+	return nil
+}
+
+// WriteStatsJSON writes the latest statistics to w as indented JSON
+func (s *simulator) WriteStatsJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(s.GetStatistics()); err != nil {
+		return fmt.Errorf("failed to encode statistics: %w", err)
+	}
+
+	return nil
+}
+
+// Shutdown cancels a running simulation and waits for Run to return with
+// the cycles completed so far. It is a no-op when nothing is running.
 func (s *simulator) Shutdown() {
-	if !s.running.Load() {
+	s.runMutex.Lock()
+	cancel, done := s.cancel, s.done
+	s.runMutex.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+}
+
+// Pause freezes a running simulation, returning once every core has
+// stopped at a cycle boundary: between global cycles in sync mode, and
+// between each core's own cycles in async mode, where cores may stand at
+// different cycles. The statistics taken as it pauses stay put until Resume,
+// and the paused time does not count towards the run's wall-clock
+// duration. Pause is a no-op when nothing is running, when already paused
+// and once the run is cancelled; cancelling a paused run, or calling
+// Shutdown, resumes it so it can stop.
+func (s *simulator) Pause() {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+
+	if s.paused.Load() {
+		return
+	}
+
+	s.runMutex.Lock()
+	running, stopped := s.running.Load(), s.stopped
+	s.runMutex.Unlock()
+
+	if !running {
+		return
+	}
+	select {
+	case <-stopped:
+		return
+	default:
+	}
+
+	s.cycleMutex.Lock()
+	s.pausedAt = time.Now()
+	if start := s.liveSince.Load(); start != nil {
+		s.calculateStatistics(atomic.LoadInt64(&s.clock), s.pausedAt.Sub(*start))
+	}
+	s.paused.Store(true)
+}
+
+// Resume continues a paused simulation where it stopped, keeping its
+// statistics. It is a no-op when not paused.
+func (s *simulator) Resume() {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+
+	s.resume()
+}
+
+// resume lifts the pause, if any; the caller holds pauseMutex
+func (s *simulator) resume() {
+	if !s.paused.Load() {
 		return
 	}
 
-	close(s.stopChan)
-	s.wg.Wait()
+	if start := s.liveSince.Load(); start != nil {
+		resumed := start.Add(time.Since(s.pausedAt))
+		s.liveSince.Store(&resumed)
+	}
+	s.paused.Store(false)
+	s.cycleMutex.Unlock()
+}
+
+// resumeRun lifts a pause of the run that closes done when it returns,
+// leaving any later run alone
+func (s *simulator) resumeRun(done chan struct{}) {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+
+	s.runMutex.Lock()
+	current := s.done == done
+	s.runMutex.Unlock()
+
+	if current {
+		s.resume()
+	}
+}
+
+// endRun marks the current run or step over, lifting any pause so the next
+// one starts unpaused
+func (s *simulator) endRun() {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+
+	s.runMutex.Lock()
+	s.cancel, s.done, s.stopped = nil, nil, nil
 	s.running.Store(false)
+	s.runMutex.Unlock()
+
+	s.resume()
 }
 
+// Reset returns the simulator to its state after construction: the clock,
+// statistics, caches and cores start afresh, and the warmup runs again. A
+// run in progress is stopped first, as by Shutdown, and returns with the
+// cycles it completed before Reset clears them; Run and Step calls made
+// while Reset is under way error as if a run were in progress. Reset must
+// not be called from a progress callback, which runs on the simulation
+// goroutine Reset would wait for.
 func (s *simulator) Reset() {
+	// Claim the simulator as Step does, so no run can start mid-reset
+	for {
+		s.Shutdown()
+
+		s.runMutex.Lock()
+		if !s.running.Load() {
+			s.running.Store(true)
+			s.runMutex.Unlock()
+			break
+		}
+		s.runMutex.Unlock()
+
+		// A Step has no run to cancel; let it finish
+		runtime.Gosched()
+	}
+	defer s.endRun()
+
 	s.statsMutex.Lock()
 	defer s.statsMutex.Unlock()
 
-	s.clock = 0
-	s.running.Store(false)
-	s.stopChan = make(chan struct{})
+	atomic.StoreInt64(&s.clock, 0)
+	clear(s.clockPhase)
+	s.warmedUp = false
+	s.stuck, s.retired = 0, 0
 
 	// Reset Statistics
 	for i := range s.stats.CoreUtilization {
 		s.stats.CoreUtilization[i] = 0.0
 	}
+	s.stats.CoreStallCycles, s.stats.CoreBubbleCycles = nil, nil
+	s.stats.CoreClockFrequencies, s.stats.CoreEffectiveIPC = nil, nil
+	s.stats.UnitUtilization = nil
 	s.stats.TotalCycles = 0
 	s.stats.InstructionsExecuted = 0
+	s.stats.RetiredByType = nil
+	s.stats.ThreadIPC = nil
 	s.stats.IPC = 0.0
 	s.stats.CacheHitRate = 0.0
+	s.stats.L3HitRate, s.stats.TLBHitRate = 0.0, 0.0
+	s.stats.DirtyEvictions = 0
+	s.stats.BackInvalidations = 0
+	s.stats.Prefetches, s.stats.UsefulPrefetches = 0, 0
+	s.stats.PrefetchAccuracy, s.stats.PrefetchHitRateGain = 0.0, 0.0
+	s.stats.TotalEnergy, s.stats.AveragePower = 0.0, 0.0
+	s.stats.WallClockDuration, s.stats.SimulatedCyclesPerSecond = 0, 0.0
 	s.stats.MemoryAccessLatency = 0.0
-	s.stats.InterconnectUtilization = 0.0
+	s.stats.MemoryLatencyHistogram = nil
+	s.stats.InterconnectUtilization, s.stats.AverageMessageLatency = 0.0, 0.0
+	s.stats.AverageHopCount, s.stats.LinkUtilization = 0.0, nil
+	s.stats.HazardStallCycles = 0
+	s.stats.ForwardedHazards = 0
+	s.stats.WAWStallCycles, s.stats.WARStallCycles = 0, 0
+	s.stats.StructuralStallCycles = 0
+	s.stats.MemoryPortStalls = 0
+	s.stats.HitsUnderMiss = 0
+	s.stats.HitUnderMissCycles = 0
+	s.stats.StoreBufferStalls, s.stats.StoreForwards = 0, 0
+	s.stats.CombinedStores, s.stats.FullLineWrites, s.stats.PartialLineWrites = 0, 0, 0
+	s.stats.MemoryFaults = 0
+	s.stats.PeerFetches = 0
+	s.stats.NUMALocalAccesses, s.stats.NUMARemoteAccesses = 0, 0
+	s.stats.NUMALocalRatio = 0.0
+	s.stats.DRAMRowHits, s.stats.DRAMRowMisses, s.stats.DRAMRowConflicts = 0, 0, 0
+	s.stats.DRAMRowHitRate = 0.0
+	s.stats.CoreBusWaitCycles = nil
+	s.stats.StageStats = nil
+	s.stats.GatedCycles, s.stats.Wakeups = 0, 0
+	s.stats.BranchStats = predictor.Stats{}
+	s.stats.BranchAccuracy = 0.0
+	s.stats.MispredictCycles = 0
+	s.stats.FlushCycles = 0
+	s.stats.Flushes = nil
+	s.stats.TakenBranches = 0
+	s.stats.FetchRedirects = 0
+	s.stats.PredicatedInstructions = 0
+	s.stats.AvoidedFlushes = 0
+	s.stats.FetchQueueStalls = 0
+	s.stats.CoherenceStats = coherence.Stats{}
+	s.stats.FalseSharingLines = nil
+	s.stats.Interrupts = 0
+	s.stats.InterruptCycles = 0
+	s.stats.HandlerInstructions = 0
+
+	if s.coherence != nil {
+		s.coherence.Reset()
+	}
+
+	if s.network != nil {
+		s.network.Reset()
+	}
+
+	if s.ports != nil {
+		s.ports.Reset()
+	}
+
+	if s.numa != nil {
+		s.numa.Reset()
+	}
+
+	if s.dram != nil {
+		s.dram.Reset()
+	}
+
+	if s.arbiter != nil {
+		s.arbiter.Reset()
+	}
+
+	if s.l3 != nil {
+		s.l3.Reset()
+	}
 
 	// Reset Cores
 	for _, proc := range s.cores {
 		proc.Reset()
 	}
+	s.seedCores()
+}
+
+// seedCores gives every core its own random source, derived from RandSeed so
+// that runs with the same seed make the same decisions
+func (s *simulator) seedCores() {
+	seeds := rand.New(rand.NewSource(s.config.RandSeed))
+	for _, proc := range s.cores {
+		proc.SetSeed(seeds.Int63())
+	}
 }
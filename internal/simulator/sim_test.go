@@ -1,16 +1,41 @@
 package simulator
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/jasonKoogler/cpu-sim/internal/cache"
 	"github.com/jasonKoogler/cpu-sim/internal/config"
+	"github.com/jasonKoogler/cpu-sim/internal/predictor"
+	"github.com/jasonKoogler/cpu-sim/internal/workload"
 )
 
+// simulated returns stats without the wall-clock measurements, which differ
+// between otherwise identical runs
+func simulated(stats Statistics) Statistics {
+	stats.WallClockDuration, stats.SimulatedCyclesPerSecond = 0, 0.0
+	return stats
+}
+
 func TestNew(t *testing.T) {
 	cfg := config.DefaultConfig()
 
-	sim, err := New(cfg)
+	sim, err := newSimulator(cfg)
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -43,19 +68,247 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNew_UnimplementedProtocol(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.CoherenceProtocol = "MESIF"
+
+	if _, err := newSimulator(cfg); err == nil {
+		t.Fatal("New() with an unimplemented coherence protocol should return error")
+	}
+}
+
+func TestNew_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *config.Config)
+		wantErr string
+	}{
+		{name: "Default", modify: func(cfg *config.Config) {}},
+		{name: "Mix without floats needs no FPU", modify: func(cfg *config.Config) {
+			cfg.NumFPUs = 0
+			cfg.MixInteger, cfg.MixMemory, cfg.MixBranch = 60, 30, 10
+		}},
+		{name: "Mix with floats needs an FPU", modify: func(cfg *config.Config) {
+			cfg.NumFPUs = 0
+			cfg.MixInteger, cfg.MixFloat = 50, 50
+		}, wantErr: "core 0 cannot run the instruction mix: no FPU unit"},
+		{name: "Workload with memory instructions needs a LoadStore unit", modify: func(cfg *config.Config) {
+			cfg.NumLoadStore = 0
+			cfg.WorkloadPath = "../../workloads/sample.bin"
+		}, wantErr: "core 0 cannot run the workload: no LoadStore unit"},
+		{name: "Pipeline without Execute", modify: func(cfg *config.Config) {
+			cfg.PipelineDepth = 2
+		}, wantErr: "core 0 cannot run the instruction mix: a 2-stage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			tt.modify(cfg)
+
+			_, err := newSimulator(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want one starting %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRun_CoherenceProtocols(t *testing.T) {
+	run := func(protocol string) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.CoherenceProtocol = protocol
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() with %s error = %v", protocol, err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() with %s error = %v", protocol, err)
+		}
+		return result.Statistics
+	}
+
+	// Every core loads and stores the same 256-byte window
+	mesi, moesi, msi := run("MESI"), run("MOESI"), run("MSI")
+	for name, stats := range map[string]Statistics{"MESI": mesi, "MOESI": moesi, "MSI": msi} {
+		if stats.CoherenceStats.Writes == 0 || stats.CoherenceStats.BusTransactions == 0 {
+			t.Errorf("%s CoherenceStats = %+v, want stores and bus traffic", name, stats.CoherenceStats)
+		}
+	}
+
+	if moesi.CoherenceStats.WriteBacks >= mesi.CoherenceStats.WriteBacks {
+		t.Errorf("MOESI WriteBacks = %d, want fewer than MESI's %d",
+			moesi.CoherenceStats.WriteBacks, mesi.CoherenceStats.WriteBacks)
+	}
+}
+
+func TestNew_Workload(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.WorkloadPath = "../../workloads/sample.bin"
+
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() with sample workload error = %v", err)
+	}
+
+	if _, err := sim.Run(500); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Each core runs the 8-instruction sample once and then idles
+	stats := sim.GetStatistics()
+	if max := int64(8 * cfg.NumCores); stats.InstructionsExecuted > max {
+		t.Errorf("InstructionsExecuted = %d, want at most %d", stats.InstructionsExecuted, max)
+	}
+
+	cfg.WorkloadPath = "does-not-exist.bin"
+	if _, err := newSimulator(cfg); err == nil {
+		t.Errorf("New() with a missing workload should return error")
+	}
+}
+
+func TestNew_HeterogeneousCores(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.CoreTypes = []config.CoreType{
+		{Name: "big", ISA: "x86", PipelineDepth: 11, IssueWidth: 2},
+		{Name: "little"},
+	}
+	cfg.CoreAssignment = []string{"big", "little", "little", "little"}
+
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i, want := range []int{11, 5, 5, 5} {
+		if got := len(sim.cores[i].GetPipelineState()); got != want {
+			t.Errorf("Core %d has %d pipeline stages, want %d", i, got, want)
+		}
+	}
+
+	result, err := sim.Run(200)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Stages of both pipelines are reported, matched by name
+	names := make(map[string]bool)
+	for _, stage := range result.Statistics.StageStats {
+		if names[stage.Name] {
+			t.Errorf("Stage %s reported twice", stage.Name)
+		}
+		names[stage.Name] = true
+	}
+
+	if !names["Fetch1"] || !names["Decode"] {
+		t.Errorf("StageStats missing stages of one core type: %v", names)
+	}
+}
+
+func TestRun_CoreClocks(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.NumCores = 3
+	cfg.CoreTypes = []config.CoreType{
+		{Name: "base"},
+		{Name: "little", ClockFrequency: cfg.ClockFrequency / 2},
+		{Name: "fast", ClockFrequency: cfg.ClockFrequency * 3 / 2},
+	}
+
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	result, err := sim.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	stats := result.Statistics
+
+	// Each core runs cycles in proportion to its clock
+	for i, want := range []int64{1000, 500, 1500} {
+		core, _ := sim.CoreStats(i)
+		if core.Cycles != want {
+			t.Errorf("Core %d ran %d cycles, want %d", i, core.Cycles, want)
+		}
+
+		if core.ClockFrequency != stats.CoreClockFrequencies[i] {
+			t.Errorf("Core %d clock = %d MHz, statistics report %d", i, core.ClockFrequency, stats.CoreClockFrequencies[i])
+		}
+
+		if want := float64(core.InstructionsExecuted) / 1000; stats.CoreEffectiveIPC[i] != want {
+			t.Errorf("Core %d effective IPC = %.3f, want %.3f", i, stats.CoreEffectiveIPC[i], want)
+		}
+	}
+
+	if want := []int{3000, 1500, 4500}; !reflect.DeepEqual(stats.CoreClockFrequencies, want) {
+		t.Errorf("CoreClockFrequencies = %v, want %v", stats.CoreClockFrequencies, want)
+	}
+
+	if stats.CoreEffectiveIPC[1] >= stats.CoreEffectiveIPC[0] {
+		t.Errorf("Half-speed core effective IPC %.3f should trail the base core's %.3f",
+			stats.CoreEffectiveIPC[1], stats.CoreEffectiveIPC[0])
+	}
+}
+
+func TestNew_StageLatencies(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.CoreTypes = []config.CoreType{{Name: "big", ISA: "x86", PipelineDepth: 11}, {Name: "little"}}
+	cfg.CoreAssignment = []string{"big", "little", "little", "little"}
+	cfg.StageLatencies = map[string]int{"Decode": 3, "Rename": 2}
+
+	// Each core takes the overrides for the stages it has
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i, want := range map[int]map[string]int{0: {"Rename": 2}, 1: {"Decode": 3}} {
+		for _, stage := range sim.cores[i].GetPipelineState() {
+			if latency, ok := want[stage.Name]; ok && stage.Latency != latency {
+				t.Errorf("Core %d %s latency = %d, want %d", i, stage.Name, stage.Latency, latency)
+			}
+		}
+	}
+
+	// A stage no core has cannot be overridden
+	cfg = config.DefaultConfig()
+	cfg.StageLatencies = map[string]int{"Rename": 2}
+	if _, err := newSimulator(cfg); err == nil {
+		t.Error("New() overriding a stage missing from every pipeline should return error")
+	}
+}
+
 func TestNew_NilConfig(t *testing.T) {
-	_, err := New(nil)
+	sim, err := New(nil)
 	if err == nil {
 		t.Fatal("New() with nil config should return error")
 	}
+
+	// A typed nil would make the interface compare non-nil
+	if sim != nil {
+		t.Errorf("New() with nil config returned %v, want nil", sim)
+	}
 }
 
 func TestRun(t *testing.T) {
 	cfg := config.DefaultConfig()
-	sim, _ := New(cfg)
+	sim, _ := newSimulator(cfg)
 
 	cycles := int64(100)
-	err := sim.Run(cycles)
+	_, err := sim.Run(cycles)
 	if err != nil {
 		t.Fatalf("Run() error = %v", err)
 	}
@@ -65,20 +318,37 @@ func TestRun(t *testing.T) {
 		t.Errorf("Run() TotalCycles = %d, want %d", stats.TotalCycles, cycles)
 	}
 
-	// With the pipeline implementation, each core should execute about cycles/5 instructions
-	// (instructions are fetched every 5 cycles in the core's Cycle() method)
-	expectedInstructions := int64(cycles / 5 * int64(cfg.NumCores))
+	// Fetching every cycle, each core retires about one independent ADD per
+	// cycle once its pipeline fills
+	expectedInstructions := cycles * int64(cfg.NumCores)
 	minInstructions := int64(float64(expectedInstructions) * 0.8)
-	maxInstructions := int64(float64(expectedInstructions) * 1.2)
-	if stats.InstructionsExecuted < minInstructions || stats.InstructionsExecuted > maxInstructions {
+	if stats.InstructionsExecuted < minInstructions || stats.InstructionsExecuted > expectedInstructions {
 		t.Errorf("Run() InstructionsExecuted = %d, want approximately %d (between %d and %d)",
-			stats.InstructionsExecuted, expectedInstructions, minInstructions, maxInstructions)
+			stats.InstructionsExecuted, expectedInstructions, minInstructions, expectedInstructions)
+	}
+
+	if stats.IPC < 0.8 || stats.IPC > 1.0 {
+		t.Errorf("Run() IPC = %f, want approximately 1", stats.IPC)
+	}
+
+	// Sequential fetch misses once per 64-byte line, every other fetch hits
+	if stats.CacheHitRate <= 0.0 || stats.CacheHitRate >= 1.0 {
+		t.Errorf("Run() CacheHitRate = %f, want between 0 and 1", stats.CacheHitRate)
 	}
 
-	// IPC should be about 0.2 with the pipeline implementation (1 instruction every 5 cycles)
-	expectedIPC := float64(0.2)
-	if stats.IPC < expectedIPC*0.8 || stats.IPC > expectedIPC*1.2 {
-		t.Errorf("Run() IPC = %f, want approximately %f", stats.IPC, expectedIPC)
+	// Every fetch is checked against the coherence protocol
+	if stats.CoherenceStats.Reads == 0 {
+		t.Errorf("Run() CoherenceStats.Reads = 0, want > 0")
+	}
+
+	// Stage counters cover every cycle of every core
+	if len(stats.StageStats) != cfg.PipelineDepth {
+		t.Fatalf("Run() StageStats has %d stages, want %d", len(stats.StageStats), cfg.PipelineDepth)
+	}
+	for _, stage := range stats.StageStats {
+		if total := stage.BusyCycles + stage.StallCycles + stage.EmptyCycles; total != cycles*int64(cfg.NumCores) {
+			t.Errorf("Run() %s stage counted %d cycles, want %d", stage.Name, total, cycles*int64(cfg.NumCores))
+		}
 	}
 
 	// Each core should have higher utilization with the pipeline implementation
@@ -88,13 +358,104 @@ func TestRun(t *testing.T) {
 			t.Errorf("Run() CoreUtilization[%d] = %f, want between 0.5 and 1.0", i, util)
 		}
 	}
+
+	// The rest of each core's cycles are split between stalls and bubbles
+	if len(stats.CoreStallCycles) != cfg.NumCores || len(stats.CoreBubbleCycles) != cfg.NumCores {
+		t.Fatalf("Run() reported stalls for %d cores and bubbles for %d, want %d",
+			len(stats.CoreStallCycles), len(stats.CoreBubbleCycles), cfg.NumCores)
+	}
+	for i, util := range stats.CoreUtilization {
+		idle := float64(stats.CoreStallCycles[i]+stats.CoreBubbleCycles[i]) / float64(cycles)
+		if math.Abs(util+idle-1.0) > 1e-9 {
+			t.Errorf("Run() core %d is %.2f busy and %.2f stalled or bubbling, want a total of 1", i, util, idle)
+		}
+	}
+}
+
+func TestRunResult(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sim, _ := newSimulator(cfg)
+
+	// The library leaves reporting to its caller
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() error = %v", err)
+	}
+	os.Stdout = w
+	result, err := sim.Run(100)
+	os.Stdout = stdout
+	w.Close()
+	if out, _ := io.ReadAll(r); len(out) != 0 {
+		t.Errorf("Run() printed %q, want no output", out)
+	}
+
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if result == nil {
+		t.Fatal("Run() returned nil result")
+	}
+
+	if result.Statistics.TotalCycles != 100 {
+		t.Errorf("RunResult TotalCycles = %d, want 100", result.Statistics.TotalCycles)
+	}
+
+	if result.Statistics.InstructionsExecuted == 0 {
+		t.Errorf("RunResult InstructionsExecuted = 0, want > 0")
+	}
+
+	if len(result.Statistics.CoreUtilization) != cfg.NumCores {
+		t.Errorf("RunResult CoreUtilization length = %d, want %d",
+			len(result.Statistics.CoreUtilization), cfg.NumCores)
+	}
+
+	if result.Duration <= 0 {
+		t.Errorf("RunResult Duration = %v, want > 0", result.Duration)
+	}
+
+	if stats := result.Statistics; stats.WallClockDuration != result.Duration || stats.SimulatedCyclesPerSecond <= 0 {
+		t.Errorf("RunResult WallClockDuration = %v, SimulatedCyclesPerSecond = %f, want %v and > 0",
+			stats.WallClockDuration, stats.SimulatedCyclesPerSecond, result.Duration)
+	}
+
+	if !reflect.DeepEqual(result.Config, *cfg) {
+		t.Errorf("RunResult Config does not match the simulator configuration")
+	}
+
+	if len(result.Warnings) != 0 {
+		t.Errorf("RunResult Warnings = %v, want none", result.Warnings)
+	}
+
+	// Mutating the result must not affect the simulator
+	result.Statistics.CoreUtilization[0] = -1
+	if sim.GetStatistics().CoreUtilization[0] == -1 {
+		t.Errorf("RunResult Statistics shares CoreUtilization with the simulator")
+	}
+}
+
+func TestRunResult_Warnings(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 1
+	sim, _ := newSimulator(cfg)
+
+	// Too few cycles for any instruction to retire
+	result, err := sim.Run(1)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(result.Warnings) == 0 {
+		t.Errorf("RunResult Warnings empty, want a warning about no retired instructions")
+	}
 }
 
 func TestRun_NegativeCycles(t *testing.T) {
 	cfg := config.DefaultConfig()
-	sim, _ := New(cfg)
+	sim, _ := newSimulator(cfg)
 
-	err := sim.Run(-10)
+	_, err := sim.Run(-10)
 	if err == nil {
 		t.Fatal("Run() with negative cycles should return error")
 	}
@@ -102,13 +463,13 @@ func TestRun_NegativeCycles(t *testing.T) {
 
 func TestRun_AlreadyRunning(t *testing.T) {
 	cfg := config.DefaultConfig()
-	sim, _ := New(cfg)
+	sim, _ := newSimulator(cfg)
 
 	// Artificially set the running flag to true
 	sim.running.Store(true)
 
 	// Try to start a simulation while it's "running"
-	err := sim.Run(100)
+	_, err := sim.Run(100)
 	if err == nil {
 		t.Fatal("Run() while already running should return error")
 	}
@@ -117,9 +478,113 @@ func TestRun_AlreadyRunning(t *testing.T) {
 	sim.running.Store(false)
 }
 
+func TestStep(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 1
+	cfg.SyncMode = true
+	cfg.MixInteger, cfg.MixFloat, cfg.MixMemory, cfg.MixBranch = 100, 0, 0, 0
+
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// The first instruction fetched, at address 0, moves one stage a cycle
+	// through the classic five-stage pipeline
+	for cycle, want := range []string{"Fetch", "Decode", "Execute", "Memory", "Writeback"} {
+		if err := sim.Step(); err != nil {
+			t.Fatalf("Step() error = %v", err)
+		}
+
+		stage := ""
+		for _, st := range sim.cores[0].GetPipelineState() {
+			if st.Instruction != nil && st.Instruction.Seq == 0 {
+				stage = st.Name
+			}
+		}
+		if stage != want {
+			t.Errorf("After cycle %d the first instruction is in %q, want %q", cycle+1, stage, want)
+		}
+
+		if got := sim.GetStatistics().TotalCycles; got != int64(cycle+1) {
+			t.Errorf("TotalCycles after %d steps = %d, want %d", cycle+1, got, cycle+1)
+		}
+	}
+
+	// Stepping carries on from a run
+	if _, err := sim.Run(10); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if err := sim.Step(); err != nil {
+		t.Fatalf("Step() after Run() error = %v", err)
+	}
+	if stats := sim.GetStatistics(); stats.TotalCycles != 11 || stats.InstructionsExecuted == 0 {
+		t.Errorf("Step() after Run(10) gave %d cycles and %d instructions, want 11 cycles and some instructions",
+			stats.TotalCycles, stats.InstructionsExecuted)
+	}
+
+	sim.running.Store(true)
+	if err := sim.Step(); err == nil {
+		t.Error("Step() while running should return error")
+	}
+	sim.running.Store(false)
+
+	cfg.SyncMode = false
+	async, _ := newSimulator(cfg)
+	if err := async.Step(); err == nil {
+		t.Error("Step() without syncMode should return error")
+	}
+}
+
+func TestRunContext_Deadline(t *testing.T) {
+	for _, syncMode := range []bool{false, true} {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = syncMode
+		sim, _ := newSimulator(cfg)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+
+		// Far more cycles than can complete before the deadline
+		cycles := int64(1 << 40)
+		result, err := sim.RunContext(ctx, cycles)
+		cancel()
+		if err == nil {
+			t.Fatalf("SyncMode=%v: RunContext() past its deadline should return error", syncMode)
+		}
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("SyncMode=%v: RunContext() error = %v, want context.DeadlineExceeded", syncMode, err)
+		}
+
+		if sim.running.Load() {
+			t.Errorf("SyncMode=%v: Simulator should not be running after the deadline", syncMode)
+		}
+
+		if result == nil {
+			t.Fatalf("SyncMode=%v: RunContext() past its deadline should return a partial result", syncMode)
+		}
+
+		// Partial statistics should cover the cycles that did run
+		stats := sim.GetStatistics()
+		if result.Statistics.TotalCycles != stats.TotalCycles {
+			t.Errorf("SyncMode=%v: RunResult TotalCycles = %d, GetStatistics() TotalCycles = %d",
+				syncMode, result.Statistics.TotalCycles, stats.TotalCycles)
+		}
+
+		if stats.TotalCycles <= 0 || stats.TotalCycles >= cycles {
+			t.Errorf("SyncMode=%v: After deadline, TotalCycles = %d, want between 1 and %d",
+				syncMode, stats.TotalCycles, cycles)
+		}
+
+		if stats.InstructionsExecuted == 0 {
+			t.Errorf("SyncMode=%v: After deadline, InstructionsExecuted = 0, want partial count", syncMode)
+		}
+	}
+}
+
 func TestShutdown(t *testing.T) {
 	cfg := config.DefaultConfig()
-	sim, _ := New(cfg)
+	sim, _ := newSimulator(cfg)
 
 	// Create a channel to signal when the simulation has started
 	started := make(chan struct{})
@@ -165,82 +630,238 @@ func TestShutdown(t *testing.T) {
 	}
 }
 
-func TestReset(t *testing.T) {
+func TestShutdown_TotalCycles(t *testing.T) {
 	cfg := config.DefaultConfig()
-	sim, _ := New(cfg)
-
-	// Run a simulation
-	sim.Run(100)
-
-	// Verify that some stats were collected
-	beforeStats := sim.GetStatistics()
-	if beforeStats.TotalCycles == 0 || beforeStats.InstructionsExecuted == 0 {
-		t.Fatal("Simulation should have generated some statistics")
-	}
-
-	// Reset the simulator
-	sim.Reset()
+	sim, _ := newSimulator(cfg)
 
-	// Verify that stats were reset
-	afterStats := sim.GetStatistics()
-	if afterStats.TotalCycles != 0 {
-		t.Errorf("After Reset(), TotalCycles = %d, want 0", afterStats.TotalCycles)
-	}
+	cycles := int64(1 << 40)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sim.Run(cycles)
+	}()
 
-	if afterStats.InstructionsExecuted != 0 {
-		t.Errorf("After Reset(), InstructionsExecuted = %d, want 0", afterStats.InstructionsExecuted)
+	// Let the cores make some progress before stopping them
+	for atomic.LoadInt64(&sim.clock) < 1000 {
+		time.Sleep(time.Millisecond)
 	}
 
-	if afterStats.IPC != 0.0 {
-		t.Errorf("After Reset(), IPC = %f, want 0.0", afterStats.IPC)
-	}
+	sim.Shutdown()
 
-	for i, util := range afterStats.CoreUtilization {
-		if util != 0.0 {
-			t.Errorf("After Reset(), CoreUtilization[%d] = %f, want 0.0", i, util)
-		}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after Shutdown()")
 	}
 
-	// Verify that all core pipelines are empty
-	for i, core := range sim.cores {
-		pipelineState := core.GetPipelineState()
-		for j, stage := range pipelineState {
-			if stage.Busy {
-				t.Errorf("After Reset(), core[%d].pipeline.stage[%d].Busy = true, want false", i, j)
-			}
-			if stage.Instruction != nil {
-				t.Errorf("After Reset(), core[%d].pipeline.stage[%d].Instruction is not nil", i, j)
-			}
+	maxCycle := int64(0)
+	for _, core := range sim.cores {
+		if c := core.GetCycleCount(); c > maxCycle {
+			maxCycle = c
 		}
 	}
 
-	// Run another simulation to verify the simulator still works
-	err := sim.Run(50)
-	if err != nil {
-		t.Fatalf("Run() after Reset() error = %v", err)
+	stats := sim.GetStatistics()
+	if stats.TotalCycles >= cycles {
+		t.Errorf("After Shutdown(), TotalCycles = %d, want fewer than the %d requested", stats.TotalCycles, cycles)
 	}
 
-	// Verify that new stats were collected
-	finalStats := sim.GetStatistics()
-	if finalStats.TotalCycles != 50 {
-		t.Errorf("After Reset() and Run(50), TotalCycles = %d, want 50", finalStats.TotalCycles)
+	if stats.TotalCycles != maxCycle {
+		t.Errorf("After Shutdown(), TotalCycles = %d, want %d (furthest core cycle)", stats.TotalCycles, maxCycle)
 	}
 }
 
-func TestPipelineIntegration(t *testing.T) {
+func TestReset_MidRun(t *testing.T) {
 	cfg := config.DefaultConfig()
-	sim, _ := New(cfg)
+	sim, _ := newSimulator(cfg)
 
-	// Run a short simulation
-	cycles := int64(20)
-	err := sim.Run(cycles)
-	if err != nil {
-		t.Fatalf("Run() error = %v", err)
+	done := make(chan error, 1)
+	go func() {
+		_, err := sim.Run(1 << 40)
+		done <- err
+	}()
+
+	for atomic.LoadInt64(&sim.clock) < 1000 {
+		time.Sleep(time.Millisecond)
 	}
 
-	// Check that instructions have moved through the pipeline
-	for i, core := range sim.cores {
-		// Get the pipeline state
+	// Resets racing each other stop the run once and all return
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sim.Reset()
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() interrupted by Reset() error = %v, want it cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after Reset()")
+	}
+
+	if sim.running.Load() {
+		t.Error("Simulator should not be running after Reset()")
+	}
+	if stats := sim.GetStatistics(); stats.TotalCycles != 0 || stats.InstructionsExecuted != 0 {
+		t.Errorf("After Reset(), TotalCycles = %d and InstructionsExecuted = %d, want 0", stats.TotalCycles, stats.InstructionsExecuted)
+	}
+	for i, proc := range sim.cores {
+		if c := proc.GetCycleCount(); c != 0 {
+			t.Errorf("After Reset(), core %d cycle count = %d, want 0", i, c)
+		}
+	}
+
+	// A paused run is stopped too
+	go func() {
+		_, err := sim.Run(1 << 40)
+		done <- err
+	}()
+	for atomic.LoadInt64(&sim.clock) < 1000 {
+		time.Sleep(time.Millisecond)
+	}
+	sim.Pause()
+	sim.Reset()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Paused Run() interrupted by Reset() error = %v, want it cancelled", err)
+	}
+
+	result, err := sim.Run(100)
+	if err != nil {
+		t.Fatalf("Run() after Reset() error = %v", err)
+	}
+	if result.Statistics.TotalCycles != 100 {
+		t.Errorf("Run(100) after Reset() TotalCycles = %d, want 100", result.Statistics.TotalCycles)
+	}
+}
+
+func TestGetStatistics_MidRun(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sim, _ := newSimulator(cfg)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sim.Run(1 << 40)
+	}()
+
+	for atomic.LoadInt64(&sim.clock) < 1000 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Snapshots keep up with the run without stopping it
+	first := sim.GetStatistics()
+	if first.TotalCycles < 1000 || first.InstructionsExecuted == 0 || first.IPC == 0 {
+		t.Errorf("Mid-run GetStatistics() = %d cycles, %d instructions, IPC %.2f, want the run so far",
+			first.TotalCycles, first.InstructionsExecuted, first.IPC)
+	}
+
+	for atomic.LoadInt64(&sim.clock) < first.TotalCycles+1000 {
+		time.Sleep(time.Millisecond)
+	}
+
+	second := sim.GetStatistics()
+	if second.TotalCycles <= first.TotalCycles || second.InstructionsExecuted <= first.InstructionsExecuted {
+		t.Errorf("Later GetStatistics() = %d cycles, %d instructions, want more than %d and %d",
+			second.TotalCycles, second.InstructionsExecuted, first.TotalCycles, first.InstructionsExecuted)
+	}
+
+	if !sim.running.Load() {
+		t.Error("GetStatistics() stopped the run")
+	}
+
+	sim.Shutdown()
+	<-done
+
+	// Once the run is over the statistics stay put
+	final := sim.GetStatistics()
+	if again := sim.GetStatistics(); again.TotalCycles != final.TotalCycles || again.WallClockDuration != final.WallClockDuration {
+		t.Errorf("GetStatistics() after the run changed from %d cycles in %v to %d in %v",
+			final.TotalCycles, final.WallClockDuration, again.TotalCycles, again.WallClockDuration)
+	}
+}
+
+func TestReset(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sim, _ := newSimulator(cfg)
+
+	// Run a simulation
+	sim.Run(100)
+
+	// Verify that some stats were collected
+	beforeStats := sim.GetStatistics()
+	if beforeStats.TotalCycles == 0 || beforeStats.InstructionsExecuted == 0 {
+		t.Fatal("Simulation should have generated some statistics")
+	}
+
+	// Reset the simulator
+	sim.Reset()
+
+	// Verify that stats were reset
+	afterStats := sim.GetStatistics()
+	if afterStats.TotalCycles != 0 {
+		t.Errorf("After Reset(), TotalCycles = %d, want 0", afterStats.TotalCycles)
+	}
+
+	if afterStats.InstructionsExecuted != 0 {
+		t.Errorf("After Reset(), InstructionsExecuted = %d, want 0", afterStats.InstructionsExecuted)
+	}
+
+	if afterStats.IPC != 0.0 {
+		t.Errorf("After Reset(), IPC = %f, want 0.0", afterStats.IPC)
+	}
+
+	for i, util := range afterStats.CoreUtilization {
+		if util != 0.0 {
+			t.Errorf("After Reset(), CoreUtilization[%d] = %f, want 0.0", i, util)
+		}
+	}
+
+	// Verify that all core pipelines are empty
+	for i, core := range sim.cores {
+		pipelineState := core.GetPipelineState()
+		for j, stage := range pipelineState {
+			if stage.Busy {
+				t.Errorf("After Reset(), core[%d].pipeline.stage[%d].Busy = true, want false", i, j)
+			}
+			if stage.Instruction != nil {
+				t.Errorf("After Reset(), core[%d].pipeline.stage[%d].Instruction is not nil", i, j)
+			}
+		}
+	}
+
+	// Run another simulation to verify the simulator still works
+	_, err := sim.Run(50)
+	if err != nil {
+		t.Fatalf("Run() after Reset() error = %v", err)
+	}
+
+	// Verify that new stats were collected
+	finalStats := sim.GetStatistics()
+	if finalStats.TotalCycles != 50 {
+		t.Errorf("After Reset() and Run(50), TotalCycles = %d, want 50", finalStats.TotalCycles)
+	}
+}
+
+func TestPipelineIntegration(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sim, _ := newSimulator(cfg)
+
+	// Run a short simulation
+	cycles := int64(20)
+	_, err := sim.Run(cycles)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Check that instructions have moved through the pipeline
+	for i, core := range sim.cores {
+		// Get the pipeline state
 		pipelineState := core.GetPipelineState()
 
 		// Check that the pipeline has the expected number of stages
@@ -278,3 +899,2235 @@ func TestPipelineIntegration(t *testing.T) {
 		}
 	}
 }
+
+func TestRun_SyncMode(t *testing.T) {
+	run := func() Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.WorkloadPath = "../../workloads/sample.bin"
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(1000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		// Every core advanced exactly in step with the global clock
+		for i, proc := range sim.cores {
+			if got := proc.GetCycleCount(); got != 1000 {
+				t.Errorf("Core %d ran %d cycles, want 1000", i, got)
+			}
+		}
+
+		return result.Statistics
+	}
+
+	first, second := run(), run()
+	if first.TotalCycles != 1000 {
+		t.Errorf("TotalCycles = %d, want 1000", first.TotalCycles)
+	}
+
+	if !reflect.DeepEqual(simulated(first), simulated(second)) {
+		t.Errorf("Sync mode runs differ:\n%+v\n%+v", first, second)
+	}
+}
+
+func TestRun_EventEngine(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(cfg *config.Config)
+	}{
+		{
+			name:  "Finished workload",
+			setup: func(cfg *config.Config) { cfg.WorkloadPath = "../../workloads/sample.bin" },
+		},
+		{
+			name: "Interrupts and power-gating",
+			setup: func(cfg *config.Config) {
+				cfg.WorkloadPath = "../../workloads/sample.bin"
+				cfg.InterruptInterval = 150
+				cfg.InterruptEntryCycles, cfg.InterruptExitCycles = 5, 5
+				cfg.PowerGateIdleThreshold, cfg.PowerGateWakeLatency = 20, 3
+			},
+		},
+		{
+			name: "Sparse fetch",
+			setup: func(cfg *config.Config) {
+				cfg.FetchInterval = 40
+				cfg.MixInteger, cfg.MixFloat, cfg.MixMemory, cfg.MixBranch = 50, 15, 25, 10
+			},
+		},
+		{
+			name: "Out of order with memory ports",
+			setup: func(cfg *config.Config) {
+				cfg.WorkloadPath = "../../workloads/sample.bin"
+				cfg.OutOfOrder, cfg.ROBSize, cfg.ReservationStations = true, 16, 8
+				cfg.MemoryPorts = 1
+			},
+		},
+		{
+			name: "Store buffer",
+			setup: func(cfg *config.Config) {
+				cfg.WorkloadPath = "../../workloads/sample.bin"
+				cfg.StoreBufferEntries = 4
+			},
+		},
+		{
+			name: "Write combining",
+			setup: func(cfg *config.Config) {
+				cfg.WorkloadPath = "../../workloads/sample.bin"
+				cfg.StoreBufferEntries = 4
+				cfg.WriteCombiningEntries = 2
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := func(engine string) Statistics {
+				cfg := config.DefaultConfig()
+				cfg.SyncMode = true
+				cfg.Engine = engine
+				tt.setup(cfg)
+
+				sim, err := newSimulator(cfg)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				result, err := sim.Run(1000)
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+
+				for i, proc := range sim.cores {
+					if got := proc.GetCycleCount(); got != 1000 {
+						t.Errorf("%s engine: core %d ran %d cycles, want 1000", engine, i, got)
+					}
+				}
+				return result.Statistics
+			}
+
+			cycle, event := run("cycle"), run("event")
+			if !reflect.DeepEqual(simulated(cycle), simulated(event)) {
+				t.Errorf("Event engine statistics differ from the cycle engine:\n%+v\n%+v", cycle, event)
+			}
+		})
+	}
+}
+
+func TestRun_SameSeed(t *testing.T) {
+	newMixed := func(seed int64) *simulator {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.MixInteger, cfg.MixFloat, cfg.MixMemory, cfg.MixBranch = 50, 15, 25, 10
+		cfg.RandSeed = seed
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return sim
+	}
+
+	statsJSON := func(sim *simulator) string {
+		if _, err := sim.Run(2000); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		data, err := json.Marshal(simulated(sim.GetStatistics()))
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		return string(data)
+	}
+
+	sim := newMixed(42)
+	first := statsJSON(sim)
+	if second := statsJSON(newMixed(42)); second != first {
+		t.Errorf("Runs with the same seed differ:\n%s\n%s", first, second)
+	}
+
+	sim.Reset()
+	if again := statsJSON(sim); again != first {
+		t.Errorf("Run after Reset() differs from the first run:\n%s\n%s", first, again)
+	}
+
+	if other := statsJSON(newMixed(7)); other == first {
+		t.Errorf("Runs with different seeds produced identical statistics")
+	}
+}
+
+func TestRun_MemoryPorts(t *testing.T) {
+	run := func(ports int) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.MixInteger, cfg.MixMemory = 0, 100
+		cfg.MemoryPorts = ports
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(1000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	unlimited, single := run(0), run(1)
+	if unlimited.MemoryPortStalls != 0 {
+		t.Errorf("MemoryPortStalls = %d with unlimited ports, want 0", unlimited.MemoryPortStalls)
+	}
+
+	// Every core fetches a load or store in the same cycle, so they queue
+	// for the single port
+	if single.MemoryPortStalls == 0 {
+		t.Errorf("MemoryPortStalls = 0 with %d cores sharing one port", len(single.CoreUtilization))
+	}
+
+	if single.InstructionsExecuted > unlimited.InstructionsExecuted {
+		t.Errorf("One memory port executed %d instructions, more than unlimited ports (%d)",
+			single.InstructionsExecuted, unlimited.InstructionsExecuted)
+	}
+}
+
+func TestRun_NUMA(t *testing.T) {
+	run := func(coreNodes []int) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		// A single core, so coherence misses between cores sharing the
+		// data do not swamp the remote penalty
+		cfg.NumCores = 1
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+		cfg.NUMANodes = 2
+		cfg.NUMACoreNodes = coreNodes
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	// Data lives in the first page, homed on node 0
+	near, far := run([]int{0}), run([]int{1})
+	if near.NUMALocalAccesses+near.NUMARemoteAccesses == 0 {
+		t.Fatalf("No accesses reached NUMA memory")
+	}
+
+	if near.NUMALocalRatio <= far.NUMALocalRatio {
+		t.Errorf("NUMALocalRatio = %.2f on the data's home node, want more than %.2f elsewhere",
+			near.NUMALocalRatio, far.NUMALocalRatio)
+	}
+
+	if near.MemoryAccessLatency >= far.MemoryAccessLatency {
+		t.Errorf("MemoryAccessLatency = %.2f on the data's home node, want less than %.2f elsewhere",
+			near.MemoryAccessLatency, far.MemoryAccessLatency)
+	}
+}
+
+func TestRun_DRAM(t *testing.T) {
+	run := func(banks, bankShift, rowShift, activate, precharge int) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.NumCores = 1
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+		cfg.DRAMBanks, cfg.DRAMBankShift, cfg.DRAMRowShift = banks, bankShift, rowShift
+		cfg.DRAMActivateLatency, cfg.DRAMPrechargeLatency = activate, precharge
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	// The small synthetic footprint fits one 8 KB row, but spans many
+	// single-line rows alternating between two banks
+	flat := run(0, 13, 16, 40, 40)
+	wide := run(8, 13, 16, 40, 40)
+	narrow := run(2, 6, 7, 40, 40)
+	free := run(2, 6, 7, 0, 0)
+
+	if flat.DRAMRowHits+flat.DRAMRowMisses+flat.DRAMRowConflicts != 0 || flat.DRAMRowHitRate != 0 {
+		t.Errorf("Flat memory counted DRAM row accesses")
+	}
+
+	if wide.DRAMRowHits == 0 || wide.DRAMRowMisses == 0 {
+		t.Fatalf("DRAM rows: %d hits, %d misses, want some of each", wide.DRAMRowHits, wide.DRAMRowMisses)
+	}
+	want := float64(wide.DRAMRowHits) / float64(wide.DRAMRowHits+wide.DRAMRowMisses+wide.DRAMRowConflicts)
+	if math.Abs(wide.DRAMRowHitRate-want) > 1e-9 {
+		t.Errorf("DRAMRowHitRate = %v, want %v", wide.DRAMRowHitRate, want)
+	}
+
+	if wide.DRAMRowHitRate <= narrow.DRAMRowHitRate {
+		t.Errorf("DRAMRowHitRate = %.2f with 8 KB rows, want more than %.2f with single-line rows",
+			wide.DRAMRowHitRate, narrow.DRAMRowHitRate)
+	}
+	if wide.IPC <= narrow.IPC {
+		t.Errorf("IPC = %.3f with 8 KB rows, want more than %.3f with single-line rows", wide.IPC, narrow.IPC)
+	}
+
+	// Row buffer hits cost the flat memory latency
+	if free.IPC != flat.IPC {
+		t.Errorf("IPC with free row activation = %.3f, want the flat memory's %.3f", free.IPC, flat.IPC)
+	}
+}
+
+func TestCoreStats(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.CoreTypes = []config.CoreType{{Name: "big", PipelineDepth: 7}, {Name: "little"}}
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	result, err := sim.Run(100)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if sim.CoreCount() != cfg.NumCores {
+		t.Fatalf("CoreCount() = %d, want %d", sim.CoreCount(), cfg.NumCores)
+	}
+
+	total := int64(0)
+	for i := 0; i < sim.CoreCount(); i++ {
+		stats, err := sim.CoreStats(i)
+		if err != nil {
+			t.Fatalf("CoreStats(%d) error = %v", i, err)
+		}
+
+		if stats.Core != i || stats.Cycles != 100 {
+			t.Errorf("CoreStats(%d) Core = %d, Cycles = %d, want %d and 100", i, stats.Core, stats.Cycles, i)
+		}
+
+		if want := float64(stats.InstructionsExecuted) / 100; stats.IPC != want {
+			t.Errorf("CoreStats(%d) IPC = %f, want %f", i, stats.IPC, want)
+		}
+
+		if stats.Utilization != result.Statistics.CoreUtilization[i] {
+			t.Errorf("CoreStats(%d) Utilization = %f, want %f", i, stats.Utilization, result.Statistics.CoreUtilization[i])
+		}
+
+		// Big cores run the deeper pipeline
+		if want := map[bool]int{true: 7, false: 5}[i%2 == 0]; len(stats.StageStats) != want {
+			t.Errorf("CoreStats(%d) has %d stages, want %d", i, len(stats.StageStats), want)
+		}
+
+		if stats.PipelineOccupancy <= 0 || stats.PipelineOccupancy > 1 {
+			t.Errorf("CoreStats(%d) PipelineOccupancy = %f, want between 0 and 1", i, stats.PipelineOccupancy)
+		}
+
+		total += stats.InstructionsExecuted
+	}
+
+	if total != result.Statistics.InstructionsExecuted {
+		t.Errorf("Per-core instructions sum to %d, want %d", total, result.Statistics.InstructionsExecuted)
+	}
+
+	for _, i := range []int{-1, cfg.NumCores} {
+		if _, err := sim.CoreStats(i); err == nil {
+			t.Errorf("CoreStats(%d) error = nil, want out of range", i)
+		}
+	}
+}
+
+func TestRun_Energy(t *testing.T) {
+	run := func(modify func(cfg *config.Config)) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.EnergyInteger, cfg.EnergyFloat, cfg.EnergyMemory, cfg.EnergyBranch = 0, 0, 0, 0
+		cfg.EnergyL1, cfg.EnergyL2, cfg.EnergyL3, cfg.EnergyDRAM = 0, 0, 0, 0
+		cfg.LeakagePower = 0
+		modify(cfg)
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(1000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	// 4 cores leaking 100 mW for 1000 cycles at 3000 MHz
+	stats := run(func(cfg *config.Config) { cfg.LeakagePower = 100 })
+	if want := 100 * 4 * 1000 / 3000.0; math.Abs(stats.TotalEnergy-want) > 1e-9 {
+		t.Errorf("TotalEnergy with leakage only = %f nJ, want %f", stats.TotalEnergy, want)
+	}
+	if math.Abs(stats.AveragePower-400) > 1e-9 {
+		t.Errorf("AveragePower with leakage only = %f mW, want 400", stats.AveragePower)
+	}
+
+	// Power-gated stages stop leaking for the cycles they are gated
+	stats = run(func(cfg *config.Config) {
+		cfg.LeakagePower = 100
+		cfg.FetchInterval = 40
+		cfg.PowerGateIdleThreshold = 5
+	})
+	var stageCycles int64
+	for _, stage := range stats.StageStats {
+		stageCycles += stage.BusyCycles + stage.StallCycles + stage.EmptyCycles
+	}
+	ungated := 100 * 4 * 1000 / 3000.0
+	if want := ungated * (1 - float64(stats.GatedCycles)/float64(stageCycles)); stats.GatedCycles == 0 || math.Abs(stats.TotalEnergy-want) > 1e-9 {
+		t.Errorf("TotalEnergy with %d of %d stage cycles gated = %f nJ, want %f",
+			stats.GatedCycles, stageCycles, stats.TotalEnergy, want)
+	}
+
+	// The synthetic workload retires integer ADDs only
+	stats = run(func(cfg *config.Config) { cfg.EnergyInteger = 5 })
+	if want := 5 * float64(stats.InstructionsExecuted) / 1000; stats.InstructionsExecuted == 0 || math.Abs(stats.TotalEnergy-want) > 1e-9 {
+		t.Errorf("TotalEnergy for %d integer instructions = %f nJ, want %f",
+			stats.InstructionsExecuted, stats.TotalEnergy, want)
+	}
+
+	// Every instruction fetch reaches L1
+	stats = run(func(cfg *config.Config) { cfg.EnergyL1 = 10 })
+	if stats.TotalEnergy < 10*float64(stats.InstructionsExecuted)/1000 {
+		t.Errorf("TotalEnergy of L1 accesses = %f nJ, want at least one access per instruction", stats.TotalEnergy)
+	}
+}
+
+func TestRun_Prefetch(t *testing.T) {
+	run := func(policy string) (Statistics, *simulator) {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.PrefetchPolicy = policy
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics, sim
+	}
+
+	// Instructions are fetched sequentially, so next-line prefetching
+	// turns most instruction cache misses into hits
+	none, _ := run("none")
+	nextLine, sim := run("next-line")
+	if none.Prefetches != 0 {
+		t.Errorf("Prefetches = %d with prefetching disabled, want 0", none.Prefetches)
+	}
+
+	if nextLine.Prefetches == 0 || nextLine.PrefetchAccuracy < 0.5 {
+		t.Errorf("Next-line prefetching made %d prefetches at %.2f accuracy, want most useful",
+			nextLine.Prefetches, nextLine.PrefetchAccuracy)
+	}
+
+	if nextLine.CacheHitRate <= none.CacheHitRate || nextLine.PrefetchHitRateGain <= 0 {
+		t.Errorf("CacheHitRate = %.2f with next-line prefetching (gain %.2f), want more than %.2f without",
+			nextLine.CacheHitRate, nextLine.PrefetchHitRateGain, none.CacheHitRate)
+	}
+
+	// Prefetched lines cross the interconnect from memory like demand fills
+	fills := int64(0)
+	for _, proc := range sim.cores {
+		caches := proc.GetCacheHierarchy()
+		fills += caches.Accesses() - caches.CacheHits() + caches.PrefetchFills()
+	}
+	if _, bytes := sim.network.Transfers(); bytes < fills*cache.DefaultLineSize {
+		t.Errorf("Interconnect carried %d bytes, want at least %d for %d line fills",
+			bytes, fills*cache.DefaultLineSize, fills)
+	}
+}
+
+func TestRun_InterconnectUtilization(t *testing.T) {
+	run := func(topology string) *RunResult {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.InterconnectType = topology
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(1000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result
+	}
+
+	utilization := make(map[string]float64)
+	for _, topology := range []string{"bus", "ring", "crossbar", "mesh", "torus"} {
+		util := run(topology).Statistics.InterconnectUtilization
+		if util <= 0 || util > 1 {
+			t.Errorf("%s InterconnectUtilization = %.4f, want within (0, 1]", topology, util)
+		}
+		utilization[topology] = util
+	}
+
+	// The same traffic loads a single shared bus more than a crossbar's ports
+	if utilization["bus"] <= utilization["crossbar"] {
+		t.Errorf("bus utilization %.4f not above crossbar %.4f", utilization["bus"], utilization["crossbar"])
+	}
+}
+
+func TestRun_GridTopologies(t *testing.T) {
+	run := func(topology string, aspect float64) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.NumCores = 16
+		cfg.InterconnectType = topology
+		cfg.MeshAspectRatio = aspect
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(1000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	mesh, wide, torus := run("mesh", 0), run("mesh", 4), run("torus", 0)
+	if mesh.AverageHopCount <= 1 {
+		t.Fatalf("4x4 mesh AverageHopCount = %.2f, want more than one hop", mesh.AverageHopCount)
+	}
+
+	// Wrapping the edges shortens routes; stretching the grid lengthens them
+	if torus.AverageHopCount >= mesh.AverageHopCount {
+		t.Errorf("4x4 torus AverageHopCount = %.2f, want below the mesh's %.2f", torus.AverageHopCount, mesh.AverageHopCount)
+	}
+	if wide.AverageHopCount <= mesh.AverageHopCount {
+		t.Errorf("2x8 mesh AverageHopCount = %.2f, want above the 4x4 mesh's %.2f", wide.AverageHopCount, mesh.AverageHopCount)
+	}
+
+	// 48 links join the 4x4 mesh's neighbours and 2 join memory
+	if got := len(mesh.LinkUtilization); got != 50 {
+		t.Errorf("4x4 mesh reported %d links, want 50", got)
+	}
+	for _, link := range mesh.LinkUtilization {
+		if link.Utilization < 0 || link.Utilization > 1 {
+			t.Errorf("Link %d->%d utilization = %.4f, want within [0, 1]", link.From, link.To, link.Utilization)
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.InterconnectType = "mesh"
+	cfg.MeshAspectRatio = 3
+	if _, err := newSimulator(cfg); err == nil {
+		t.Error("New() with 4 cores on a grid 3 times as wide as tall should return error")
+	}
+}
+
+func TestRunContext_SyncModeCancel(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+
+	sim, _ := newSimulator(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := sim.RunContext(ctx, 1_000_000)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunContext() error = %v, want context.Canceled", err)
+	}
+
+	if result.Statistics.TotalCycles != 0 {
+		t.Errorf("TotalCycles = %d after cancelling before the first cycle, want 0", result.Statistics.TotalCycles)
+	}
+}
+
+func TestWriteStatsJSON(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sim, _ := newSimulator(cfg)
+
+	if _, err := sim.Run(500); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := sim.WriteStatsJSON(&buf); err != nil {
+		t.Fatalf("WriteStatsJSON() error = %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("WriteStatsJSON() wrote invalid JSON: %v", err)
+	}
+
+	for _, key := range []string{"totalCycles", "instructionsExecuted", "ipc", "cacheHitRate",
+		"unitUtilization", "hazardStallCycles", "branchStats", "coherenceStats", "coreUtilization"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("JSON statistics missing %q", key)
+		}
+	}
+
+	if got := decoded["totalCycles"]; got != float64(500) {
+		t.Errorf("totalCycles = %v, want 500", got)
+	}
+
+	perCore, ok := decoded["coreUtilization"].(map[string]any)
+	if !ok {
+		t.Fatalf("coreUtilization = %T, want an object", decoded["coreUtilization"])
+	}
+
+	for i := 0; i < cfg.NumCores; i++ {
+		if _, ok := perCore[fmt.Sprintf("core%d", i)]; !ok {
+			t.Errorf("coreUtilization missing core%d", i)
+		}
+	}
+}
+
+func TestSetSampler(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	sim, _ := newSimulator(cfg)
+
+	if err := sim.SetSampler(&bytes.Buffer{}, 0); err == nil {
+		t.Errorf("SetSampler() with a zero interval should return error")
+	}
+
+	var buf bytes.Buffer
+	if err := sim.SetSampler(&buf, 100); err != nil {
+		t.Fatalf("SetSampler() error = %v", err)
+	}
+
+	withSampler, err := sim.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Sampler wrote invalid CSV: %v", err)
+	}
+
+	if want := []string{"cycle", "ipc", "busy_cores", "cache_hit_rate"}; !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("Header = %v, want %v", rows[0], want)
+	}
+
+	if len(rows) != 11 {
+		t.Fatalf("Wrote %d rows, want a header and 10 samples", len(rows))
+	}
+
+	if rows[1][0] != "100" || rows[10][0] != "1000" {
+		t.Errorf("Sample cycles run from %s to %s, want 100 to 1000", rows[1][0], rows[10][0])
+	}
+
+	// Sampling only observes, so a sync run without it is identical
+	plain, _ := newSimulator(cfg)
+	without, _ := plain.Run(1000)
+	if !reflect.DeepEqual(simulated(withSampler.Statistics), simulated(without.Statistics)) {
+		t.Errorf("Sampling changed the simulation:\n%+v\n%+v", withSampler.Statistics, without.Statistics)
+	}
+}
+
+func TestSetProgress(t *testing.T) {
+	for _, syncMode := range []bool{true, false} {
+		t.Run(fmt.Sprintf("sync=%v", syncMode), func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.SyncMode = syncMode
+			sim, _ := newSimulator(cfg)
+
+			noop := func(cycle, total int64) {}
+			if err := sim.SetProgress(noop, 0); err == nil {
+				t.Errorf("SetProgress() with a zero interval should return error")
+			}
+
+			var mu sync.Mutex
+			var reported []int64
+			returned := false
+			err := sim.SetProgress(func(cycle, total int64) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if returned {
+					t.Errorf("Progress reported after Run returned")
+				}
+				if total != 1000 {
+					t.Errorf("Progress total = %d, want 1000", total)
+				}
+				reported = append(reported, cycle)
+			}, 250)
+			if err != nil {
+				t.Fatalf("SetProgress() error = %v", err)
+			}
+
+			if _, err := sim.Run(1000); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			mu.Lock()
+			returned = true
+			got := append([]int64(nil), reported...)
+			mu.Unlock()
+
+			if want := []int64{250, 500, 750, 1000}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Reported %v, want %v", got, want)
+			}
+
+			// A nil callback turns reporting off
+			if err := sim.SetProgress(nil, 0); err != nil {
+				t.Fatalf("SetProgress(nil) error = %v", err)
+			}
+
+			mu.Lock()
+			reported = nil
+			returned = false
+			mu.Unlock()
+
+			sim.Run(1000)
+			if len(reported) != 0 {
+				t.Errorf("Reported %v with progress disabled", reported)
+			}
+		})
+	}
+}
+
+func TestShutdown_NotRunning(t *testing.T) {
+	sim, _ := newSimulator(config.DefaultConfig())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sim.Shutdown()
+		sim.Shutdown()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown() blocked with no simulation running")
+	}
+
+	// The simulator is still usable afterwards
+	if _, err := sim.Run(100); err != nil {
+		t.Errorf("Run() after Shutdown() error = %v", err)
+	}
+}
+
+func TestShutdown_ReturnsPartialResult(t *testing.T) {
+	for _, syncMode := range []bool{false, true} {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = syncMode
+		sim, _ := newSimulator(cfg)
+
+		type outcome struct {
+			result *RunResult
+			err    error
+		}
+		finished := make(chan outcome, 1)
+		go func() {
+			result, err := sim.Run(1 << 40)
+			finished <- outcome{result, err}
+		}()
+
+		for atomic.LoadInt64(&sim.clock) < 1000 {
+			time.Sleep(time.Millisecond)
+		}
+		sim.Shutdown()
+
+		// Shutdown only returns once Run has stopped
+		select {
+		case out := <-finished:
+			if !errors.Is(out.err, context.Canceled) {
+				t.Errorf("SyncMode=%v: Run() error = %v, want context.Canceled", syncMode, out.err)
+			}
+
+			if out.result == nil || out.result.Statistics.TotalCycles < 1000 {
+				t.Errorf("SyncMode=%v: Run() did not return the completed cycles", syncMode)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("SyncMode=%v: Run() did not return after Shutdown()", syncMode)
+		}
+	}
+}
+
+func TestRun_BranchRedirects(t *testing.T) {
+	run := func(predictorType string) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.BranchPredictor = predictorType
+		cfg.MixInteger, cfg.MixBranch = 70, 30
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	// The static predictor never predicts taken, so fetch only leaves the
+	// sequential path to recover from a mispredict
+	static := run("static")
+	if static.TakenBranches == 0 {
+		t.Fatalf("No branches were taken")
+	}
+	if static.FetchRedirects != static.BranchStats.Mispredictions {
+		t.Errorf("FetchRedirects = %d, want one per mispredict (%d)",
+			static.FetchRedirects, static.BranchStats.Mispredictions)
+	}
+
+	// A dynamic predictor also redirects fetch for branches it predicts taken
+	gshare := run("gshare")
+	if gshare.FetchRedirects <= gshare.BranchStats.Mispredictions {
+		t.Errorf("FetchRedirects = %d, want more than the %d mispredicts",
+			gshare.FetchRedirects, gshare.BranchStats.Mispredictions)
+	}
+}
+
+func TestRun_InstructionBudget(t *testing.T) {
+	for _, syncMode := range []bool{true, false} {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = syncMode
+		cfg.MaxInstructions = 500
+
+		sim, _ := newSimulator(cfg)
+		result, err := sim.Run(10000)
+		if !errors.Is(err, ErrInstructionBudgetExceeded) {
+			t.Fatalf("Run() with syncMode %v error = %v, want ErrInstructionBudgetExceeded", syncMode, err)
+		}
+
+		// Statistics cover the cycles run before the budget stopped the cores
+		stats := result.Statistics
+		if stats.TotalCycles == 0 || stats.TotalCycles >= 10000 {
+			t.Errorf("TotalCycles with syncMode %v = %d, want between 0 and 10000", syncMode, stats.TotalCycles)
+		}
+		if stats.InstructionsExecuted < cfg.MaxInstructions {
+			t.Errorf("InstructionsExecuted with syncMode %v = %d, want at least %d", syncMode, stats.InstructionsExecuted, cfg.MaxInstructions)
+		}
+
+		// In lockstep every core stops on the same cycle
+		if syncMode && stats.InstructionsExecuted > cfg.MaxInstructions+int64(cfg.NumCores*cfg.IssueWidth) {
+			t.Errorf("InstructionsExecuted = %d, want at most one cycle past %d", stats.InstructionsExecuted, cfg.MaxInstructions)
+		}
+
+		if !reflect.DeepEqual(sim.GetStatistics(), stats) {
+			t.Errorf("GetStatistics() differs from the stopped run's statistics")
+		}
+	}
+
+	// Running out during warmup reports the warmup's statistics
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.MaxInstructions = 500
+	cfg.WarmupCycles = 10000
+	sim, _ := newSimulator(cfg)
+	result, err := sim.Run(10000)
+	if !errors.Is(err, ErrInstructionBudgetExceeded) {
+		t.Fatalf("Run() out of budget during warmup error = %v, want ErrInstructionBudgetExceeded", err)
+	}
+	if result == nil {
+		t.Fatal("Run() out of budget during warmup returned no result")
+	}
+	if stats := result.Statistics; stats.TotalCycles == 0 || stats.TotalCycles >= 10000 || stats.InstructionsExecuted < cfg.MaxInstructions {
+		t.Errorf("Statistics out of budget during warmup cover %d cycles and %d instructions, want under 10000 and at least %d",
+			stats.TotalCycles, stats.InstructionsExecuted, cfg.MaxInstructions)
+	}
+
+	// A run that finishes within the budget succeeds
+	cfg = config.DefaultConfig()
+	cfg.MaxInstructions = 1000000
+	sim, _ = newSimulator(cfg)
+	if _, err := sim.Run(100); err != nil {
+		t.Errorf("Run() within the budget error = %v", err)
+	}
+}
+
+func TestRun_Deadlock(t *testing.T) {
+	// Loads held in Memory far longer than the threshold look like a hang
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.MixInteger, cfg.MixFloat, cfg.MixMemory, cfg.MixBranch = 0, 0, 100, 0
+	cfg.MemoryLatency = 5000
+	cfg.DeadlockCycles = 200
+
+	sim, _ := newSimulator(cfg)
+	result, err := sim.Run(10000)
+	if !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("Run() error = %v, want ErrDeadlock", err)
+	}
+
+	if result == nil || result.Statistics.TotalCycles >= 10000 {
+		t.Fatalf("Run() should stop early with statistics, got %+v", result)
+	}
+
+	// The diagnostic names what every core is waiting on
+	for i := 0; i < cfg.NumCores; i++ {
+		if want := fmt.Sprintf("core %d: oldest instruction", i); !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() error = %v, want it to contain %q", err, want)
+		}
+	}
+	if !strings.Contains(err.Error(), "held in Memory") {
+		t.Errorf("Run() error = %v, want the loads held in Memory", err)
+	}
+
+	// Stepping a deadlocked simulator keeps failing until it is reset
+	if err := sim.Step(); !errors.Is(err, ErrDeadlock) {
+		t.Errorf("Step() after a deadlock error = %v, want ErrDeadlock", err)
+	}
+	sim.Reset()
+	if err := sim.Step(); err != nil {
+		t.Errorf("Step() after Reset() error = %v", err)
+	}
+
+	// A workload that runs out is idle, not deadlocked
+	cfg = config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.DeadlockCycles = 10
+	cfg.WorkloadPath = "../../workloads/sample.bin"
+	sim, _ = newSimulator(cfg)
+	if _, err := sim.Run(2000); err != nil {
+		t.Errorf("Run() of a finished workload error = %v", err)
+	}
+}
+
+func TestRun_PerHopLatency(t *testing.T) {
+	run := func(topology string, hopLatency int) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.InterconnectType = topology
+		cfg.PerHopLatency = hopLatency
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	flat, hops := run("ring", 0), run("ring", 4)
+	if flat.AverageMessageLatency <= 0 {
+		t.Fatalf("AverageMessageLatency = %.2f, want some interconnect traffic", flat.AverageMessageLatency)
+	}
+	if hops.AverageMessageLatency <= flat.AverageMessageLatency {
+		t.Errorf("AverageMessageLatency with 4-cycle hops = %.2f, want more than %.2f without", hops.AverageMessageLatency, flat.AverageMessageLatency)
+	}
+	if hops.MemoryAccessLatency <= flat.MemoryAccessLatency {
+		t.Errorf("MemoryAccessLatency with 4-cycle hops = %.2f, want more than %.2f without", hops.MemoryAccessLatency, flat.MemoryAccessLatency)
+	}
+
+	// A bus reaches every node in one hop
+	if bus := run("bus", 4); !reflect.DeepEqual(simulated(bus), simulated(run("bus", 0))) {
+		t.Error("PerHopLatency changed the statistics of a bus")
+	}
+}
+
+func TestRun_TLB(t *testing.T) {
+	run := func(tlbEntries, walkLatency int) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.TLBEntries, cfg.PageSize, cfg.PageWalkLatency = tlbEntries, 64, walkLatency
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	if got := run(0, 30).TLBHitRate; got != 0 {
+		t.Errorf("TLBHitRate without translation = %.2f, want 0", got)
+	}
+
+	free, slow := run(16, 0), run(16, 100)
+	if free.TLBHitRate <= 0 || free.TLBHitRate >= 1 {
+		t.Errorf("TLBHitRate = %.4f, want within (0, 1)", free.TLBHitRate)
+	}
+	if slow.MemoryAccessLatency <= free.MemoryAccessLatency {
+		t.Errorf("MemoryAccessLatency with 100-cycle page walks = %.2f, want more than %.2f with free ones",
+			slow.MemoryAccessLatency, free.MemoryAccessLatency)
+	}
+}
+
+func TestRun_StoreBuffer(t *testing.T) {
+	run := func(entries int) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.StoreBufferEntries = entries
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result.Statistics
+	}
+
+	direct := run(0)
+	if direct.StoreBufferStalls != 0 || direct.StoreForwards != 0 {
+		t.Errorf("Without a store buffer got %d stalls and %d forwards, want none",
+			direct.StoreBufferStalls, direct.StoreForwards)
+	}
+
+	// Loads hit a small window of addresses, so some find a buffered store
+	buffered := run(8)
+	if buffered.StoreForwards == 0 {
+		t.Error("StoreForwards = 0, want loads forwarded from the store buffer")
+	}
+	if buffered.MemoryAccessLatency >= direct.MemoryAccessLatency {
+		t.Errorf("MemoryAccessLatency with a store buffer = %.2f, want less than %.2f without",
+			buffered.MemoryAccessLatency, direct.MemoryAccessLatency)
+	}
+
+	if tiny := run(1); tiny.StoreBufferStalls == 0 {
+		t.Error("StoreBufferStalls = 0 with a 1-entry buffer, want stores waiting for it")
+	}
+}
+
+func TestRun_WriteCombining(t *testing.T) {
+	run := func(entries int, policy string) (Statistics, CoreStatistics) {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.WriteCombiningEntries = entries
+		cfg.WriteCombiningFlushPolicy = policy
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		core, err := sim.CoreStats(0)
+		if err != nil {
+			t.Fatalf("CoreStats() error = %v", err)
+		}
+		return result.Statistics, core
+	}
+
+	direct, _ := run(0, "full-line")
+	if direct.CombinedStores+direct.FullLineWrites+direct.PartialLineWrites != 0 {
+		t.Errorf("Without a write-combining buffer got %d combined stores, %d full and %d partial line writes, want none",
+			direct.CombinedStores, direct.FullLineWrites, direct.PartialLineWrites)
+	}
+
+	// Stores hit a small window of addresses, so many land on the line
+	// already buffered; held until the next line evicts it, it leaves part
+	// written
+	combined, core := run(1, "eviction")
+	if combined.CombinedStores == 0 || combined.PartialLineWrites == 0 {
+		t.Errorf("Got %d combined stores and %d partial line writes, want some of each",
+			combined.CombinedStores, combined.PartialLineWrites)
+	}
+	if core.CombinedStores == 0 || core.CombinedStores > combined.CombinedStores {
+		t.Errorf("Core 0 combined %d stores, want some and at most the total %d", core.CombinedStores, combined.CombinedStores)
+	}
+	if combined.MemoryAccessLatency == direct.MemoryAccessLatency {
+		t.Errorf("MemoryAccessLatency = %.2f with and without a write-combining buffer, want a change",
+			combined.MemoryAccessLatency)
+	}
+
+	// A buffer big enough for the whole window never overflows, so under
+	// the fence policy only the end of the run writes its lines out
+	fenced, _ := run(64, "fence")
+	lines := int64(4 * config.DefaultConfig().NumCores)
+	if writes := fenced.FullLineWrites + fenced.PartialLineWrites; writes == 0 || writes > lines {
+		t.Errorf("Got %d line writes under the fence policy, want each core's window of lines written once at the end, at most %d",
+			writes, lines)
+	}
+}
+
+func TestRun_BusArbitration(t *testing.T) {
+	run := func(interconnectType, policy string, priorities []int) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.NumCores = 2
+		cfg.InterconnectType = interconnectType
+		cfg.BusArbitrationPolicy = policy
+		cfg.BusPriorities = priorities
+		cfg.MixInteger, cfg.MixMemory = 20, 80
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(5000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		for i, want := range result.Statistics.CoreBusWaitCycles {
+			core, _ := sim.CoreStats(i)
+			if core.BusWaitCycles != want {
+				t.Errorf("Core %d BusWaitCycles = %d, want %d", i, core.BusWaitCycles, want)
+			}
+		}
+		return result.Statistics
+	}
+
+	if ring := run("ring", "round-robin", nil); ring.CoreBusWaitCycles != nil {
+		t.Errorf("CoreBusWaitCycles on a ring = %v, want nil", ring.CoreBusWaitCycles)
+	}
+
+	// Core 0 always wins a fixed bus; favoring core 1 turns the tables
+	fixed := run("bus", "fixed", nil)
+	if fixed.CoreBusWaitCycles[0] != 0 || fixed.CoreBusWaitCycles[1] == 0 {
+		t.Errorf("CoreBusWaitCycles with fixed arbitration = %v, want only core 1 waiting", fixed.CoreBusWaitCycles)
+	}
+	favored := run("bus", "priority", []int{0, 1})
+	if favored.CoreBusWaitCycles[0] == 0 || favored.CoreBusWaitCycles[1] != 0 {
+		t.Errorf("CoreBusWaitCycles favoring core 1 = %v, want only core 0 waiting", favored.CoreBusWaitCycles)
+	}
+}
+
+func TestRun_PowerGating(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.NumCores = 2
+	cfg.FetchInterval = 40
+	cfg.PowerGateIdleThreshold, cfg.PowerGateWakeLatency = 5, 2
+
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	result, err := sim.Run(2000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	stats := result.Statistics
+
+	// Sparse fetch leaves stages idle long enough to gate between
+	// instructions, each of which wakes them again
+	if stats.GatedCycles == 0 || stats.Wakeups == 0 {
+		t.Fatalf("GatedCycles = %d, Wakeups = %d, want both above 0", stats.GatedCycles, stats.Wakeups)
+	}
+
+	var stageGated, stageWakeups, coreGated, coreWakeups int64
+	for _, stage := range stats.StageStats {
+		stageGated += stage.GatedCycles
+		stageWakeups += stage.Wakeups
+	}
+	for i := 0; i < cfg.NumCores; i++ {
+		core, _ := sim.CoreStats(i)
+		coreGated += core.GatedCycles
+		coreWakeups += core.Wakeups
+	}
+	if stageGated != stats.GatedCycles || coreGated != stats.GatedCycles {
+		t.Errorf("GatedCycles = %d, stages sum to %d and cores to %d", stats.GatedCycles, stageGated, coreGated)
+	}
+	if stageWakeups != stats.Wakeups || coreWakeups != stats.Wakeups {
+		t.Errorf("Wakeups = %d, stages sum to %d and cores to %d", stats.Wakeups, stageWakeups, coreWakeups)
+	}
+}
+
+func TestRun_MemoryFaults(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.MemorySize = 256
+	cfg.HaltOnMemoryFault = true
+
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	result, err := sim.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Every core runs off the end of memory and halts there
+	if got := result.Statistics.MemoryFaults; got != int64(cfg.NumCores) {
+		t.Errorf("MemoryFaults = %d, want one per core (%d)", got, cfg.NumCores)
+	}
+
+	for i := 0; i < cfg.NumCores; i++ {
+		stats, _ := sim.CoreStats(i)
+		if !stats.Halted || stats.MemoryFaults != 1 {
+			t.Errorf("Core %d halted %v with %d faults, want halted on 1", i, stats.Halted, stats.MemoryFaults)
+		}
+	}
+
+	if !slices.ContainsFunc(result.Warnings, func(w string) bool { return strings.Contains(w, "halted on a memory fault") }) {
+		t.Errorf("Warnings = %q, want the halted cores reported", result.Warnings)
+	}
+}
+
+func TestRun_SharedL3(t *testing.T) {
+	run := func(shared bool) (*simulator, Statistics) {
+		cfg := config.DefaultConfig()
+		cfg.SyncMode = true
+		cfg.L3Shared = shared
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		result, err := sim.Run(2000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return sim, result.Statistics
+	}
+
+	// Every core loads and stores the same window. Lines invalidated in one
+	// core's private levels are refetched from the shared L3, not memory.
+	_, private := run(false)
+	sim, shared := run(true)
+	if shared.L3HitRate <= private.L3HitRate {
+		t.Errorf("Shared L3HitRate = %.3f, want above the private %.3f", shared.L3HitRate, private.L3HitRate)
+	}
+	if shared.CacheHitRate <= private.CacheHitRate {
+		t.Errorf("Shared CacheHitRate = %.3f, want above the private %.3f", shared.CacheHitRate, private.CacheHitRate)
+	}
+
+	// The shared L3 is checkpointed once and restored with the cores
+	var buf bytes.Buffer
+	if err := sim.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+	resumed, _ := newSimulator(sim.config)
+	if err := resumed.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !reflect.DeepEqual(resumed.l3.Snapshot(), sim.l3.Snapshot()) {
+		t.Errorf("Restored shared L3 differs from the checkpointed one")
+	}
+}
+
+func TestRun_Warmup(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.NumCores = 1
+	cfg.MixInteger, cfg.MixMemory = 50, 50
+
+	// Loads and stores reuse a small window, so only a cold run misses on it.
+	// One core keeps coherence invalidations out of the comparison.
+	cold, _ := newSimulator(cfg)
+	coldResult, err := cold.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	cfg.WarmupCycles = 2000
+	warm, _ := newSimulator(cfg)
+	first, err := warm.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Only the measured cycles are counted
+	if first.Statistics.TotalCycles != 1000 {
+		t.Errorf("TotalCycles = %d, want 1000", first.Statistics.TotalCycles)
+	}
+	for i := range warm.cores {
+		if got := warm.cores[i].GetCycleCount(); got != 1000 {
+			t.Errorf("Core %d counted %d cycles, want 1000", i, got)
+		}
+	}
+
+	if first.Statistics.CacheHitRate <= coldResult.Statistics.CacheHitRate {
+		t.Errorf("CacheHitRate after warmup = %.3f, want above the cold %.3f",
+			first.Statistics.CacheHitRate, coldResult.Statistics.CacheHitRate)
+	}
+
+	// A checkpoint taken after warming up resumes without warming up again
+	var buf bytes.Buffer
+	if err := warm.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+	resumed, _ := newSimulator(cfg)
+	if err := resumed.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	second, err := warm.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got, err := resumed.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !reflect.DeepEqual(simulated(got.Statistics), simulated(second.Statistics)) {
+		t.Errorf("Resumed run differs from an uninterrupted one:\n%+v\n%+v", got.Statistics, second.Statistics)
+	}
+
+	// Reset warms up again before the next measured run
+	warm.Reset()
+	again, err := warm.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !reflect.DeepEqual(simulated(again.Statistics), simulated(first.Statistics)) {
+		t.Errorf("Run after Reset differs from the first run:\n%+v\n%+v", again.Statistics, first.Statistics)
+	}
+
+	// Cancelling during warmup reports it and measures nothing
+	warm.Reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := warm.RunContext(ctx, 1000); err == nil {
+		t.Errorf("RunContext() cancelled during warmup error = nil, want error")
+	}
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.BranchPredictor = "gshare"
+	cfg.InterconnectType = "bus"
+	cfg.MemoryPorts = 1
+	cfg.NUMANodes = 2
+	cfg.DRAMBanks, cfg.DRAMBankShift, cfg.DRAMRowShift = 2, 6, 7
+	cfg.PrefetchPolicy = "stride"
+	cfg.MixInteger, cfg.MixFloat, cfg.MixMemory, cfg.MixBranch = 50, 10, 25, 15
+	cfg.InterruptInterval = 300
+	cfg.InterruptEntryCycles = 5
+
+	// An uninterrupted simulator runs two legs back to back
+	straight, _ := newSimulator(cfg)
+	if _, err := straight.Run(700); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want, err := straight.Run(700)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Another is checkpointed after the first leg and resumed in a fresh one
+	first, _ := newSimulator(cfg)
+	if _, err := first.Run(700); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := first.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+
+	resumed, _ := newSimulator(cfg)
+	if err := resumed.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(resumed.GetStatistics(), first.GetStatistics()) {
+		t.Errorf("Restored statistics differ from the checkpointed ones")
+	}
+
+	got, err := resumed.Run(700)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got.Statistics.InstructionsExecuted == 0 {
+		t.Fatalf("Resumed run executed no instructions")
+	}
+
+	if !reflect.DeepEqual(simulated(got.Statistics), simulated(want.Statistics)) {
+		t.Errorf("Resumed run differs from an uninterrupted one:\n%+v\n%+v", got.Statistics, want.Statistics)
+	}
+
+	for i := range straight.cores {
+		wantInt, wantFloat := straight.cores[i].DumpRegisters()
+		gotInt, gotFloat := resumed.cores[i].DumpRegisters()
+		if !reflect.DeepEqual(gotInt, wantInt) || !reflect.DeepEqual(gotFloat, wantFloat) {
+			t.Errorf("Core %d registers differ after resuming", i)
+		}
+
+		if !reflect.DeepEqual(resumed.cores[i].Snapshot(), straight.cores[i].Snapshot()) {
+			t.Errorf("Core %d state differs after resuming", i)
+		}
+	}
+}
+
+func TestRestore_Mismatch(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sim, _ := newSimulator(cfg)
+
+	var buf bytes.Buffer
+	if err := sim.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+
+	other := config.DefaultConfig()
+	other.NumCores = 2
+	smaller, _ := newSimulator(other)
+	if err := smaller.Restore(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Errorf("Restore() into a simulator with fewer cores should return error")
+	}
+
+	if err := sim.Restore(bytes.NewReader([]byte("not a checkpoint"))); err == nil {
+		t.Errorf("Restore() of garbage should return error")
+	}
+}
+
+func TestRun_RetiredByType(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.MixInteger, cfg.MixMemory, cfg.MixBranch = 60, 30, 10
+	sim, _ := newSimulator(cfg)
+
+	result, err := sim.Run(5000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	retired := result.Statistics.RetiredByType
+	total := int64(0)
+	for _, n := range retired {
+		total += n
+	}
+
+	if total != result.Statistics.InstructionsExecuted {
+		t.Errorf("RetiredByType sums to %d, want InstructionsExecuted %d", total, result.Statistics.InstructionsExecuted)
+	}
+
+	if retired["Float"] != 0 || retired["Integer"] == 0 || retired["Memory"] == 0 || retired["Branch"] == 0 {
+		t.Errorf("RetiredByType = %v, want Integer, Memory and Branch only", retired)
+	}
+}
+
+func TestHotInstructions(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 2
+	cfg.SyncMode = true
+	cfg.ProfileHotspots = true
+	sim, err := newSimulator(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// The ADD at 0 runs once, then the ADD at 4 and the BEQ at 8 loop
+	program := []workload.Instruction{
+		{Opcode: 0x01, Dest: 1, Src1: 2, Src2: 3},
+		{Opcode: 0x01, Dest: 1, Src1: 2, Src2: 3},
+		{Opcode: 0x70, Dest: 0xFF, Src1: 0, Src2: 0},
+	}
+	for _, proc := range sim.cores {
+		proc.LoadWorkload(program)
+	}
+
+	if _, err := sim.Run(500); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	hot := sim.HotInstructions(0)
+	if len(hot) != 3 {
+		t.Fatalf("HotInstructions(0) = %v, want all 3 addresses", hot)
+	}
+
+	if last := hot[2]; last != (AddrCount{Address: 0, Count: 2}) {
+		t.Errorf("Coldest instruction = %+v, want address 0 retired once per core", last)
+	}
+
+	total := int64(0)
+	for i, h := range hot {
+		total += h.Count
+		if i > 0 && (h.Count > hot[i-1].Count || h.Count == hot[i-1].Count && h.Address < hot[i-1].Address) {
+			t.Errorf("HotInstructions() not sorted by count then address: %v", hot)
+		}
+	}
+	if want := sim.GetStatistics().InstructionsExecuted; total != want {
+		t.Errorf("Counts sum to %d, want InstructionsExecuted %d", total, want)
+	}
+
+	if top := sim.HotInstructions(1); len(top) != 1 || top[0] != hot[0] {
+		t.Errorf("HotInstructions(1) = %v, want %v", top, hot[:1])
+	}
+
+	sim.Reset()
+	if got := sim.HotInstructions(0); len(got) != 0 {
+		t.Errorf("HotInstructions() after Reset() = %v, want none", got)
+	}
+
+	cfg.ProfileHotspots = false
+	unprofiled, _ := newSimulator(cfg)
+	if _, err := unprofiled.Run(100); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := unprofiled.HotInstructions(10); got != nil {
+		t.Errorf("HotInstructions() without profiling = %v, want nil", got)
+	}
+}
+
+func TestRun_SMT(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.ThreadsPerCore = 2
+	sim, _ := newSimulator(cfg)
+
+	result, err := sim.Run(5000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	stats := result.Statistics
+	if len(stats.ThreadIPC) != cfg.NumCores {
+		t.Fatalf("ThreadIPC has %d cores, want %d", len(stats.ThreadIPC), cfg.NumCores)
+	}
+
+	total := 0.0
+	for i, threads := range stats.ThreadIPC {
+		if len(threads) != 2 {
+			t.Fatalf("ThreadIPC[%d] has %d threads, want 2", i, len(threads))
+		}
+		for j, ipc := range threads {
+			if ipc <= 0 {
+				t.Errorf("ThreadIPC[%d][%d] = %f, want positive", i, j, ipc)
+			}
+			total += ipc
+		}
+	}
+
+	// Per-thread IPC adds up to the per-core average times the core count
+	if want := stats.IPC * float64(cfg.NumCores); math.Abs(total-want) > 1e-9 {
+		t.Errorf("ThreadIPC sums to %f, want %f", total, want)
+	}
+
+	// Per-thread state survives a checkpoint round trip
+	var buf bytes.Buffer
+	if err := sim.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+
+	restored, _ := newSimulator(cfg)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	for i := range cfg.NumCores {
+		want := sim.cores[i].GetThreadInstructions()
+		if got := restored.cores[i].GetThreadInstructions(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Core %d thread instructions after restore = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestRun_DirtyEvictions(t *testing.T) {
+	// Instruction fetches conflict with stored lines in a small direct-mapped L1
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.L1Size, cfg.L1Associativity = 1, 1
+	cfg.MixInteger, cfg.MixMemory = 50, 50
+
+	evictions := make(map[string]int64)
+	for _, policy := range []string{"write-back", "write-through"} {
+		cfg.L1WritePolicy = policy
+		sim, _ := newSimulator(cfg)
+
+		result, err := sim.Run(20000)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		evictions[policy] = result.Statistics.DirtyEvictions
+	}
+
+	if evictions["write-back"] == 0 {
+		t.Errorf("DirtyEvictions with a write-back L1 = 0, want some")
+	}
+
+	// Only the L1 evicts dirty lines here, so write-through removes them all
+	if evictions["write-through"] != 0 {
+		t.Errorf("DirtyEvictions with a write-through L1 = %d, want 0", evictions["write-through"])
+	}
+}
+
+func TestRun_OutOfOrder(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.OutOfOrder = true
+	cfg.MixInteger, cfg.MixMemory, cfg.MixBranch = 60, 30, 10
+	sim, _ := newSimulator(cfg)
+
+	result, err := sim.Run(5000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if result.Statistics.InstructionsExecuted == 0 {
+		t.Fatalf("Out-of-order run retired no instructions")
+	}
+
+	// The reorder buffer survives a checkpoint round trip
+	var buf bytes.Buffer
+	if err := sim.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+
+	restored, _ := newSimulator(cfg)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	want, err := sim.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got, err := restored.Run(1000)
+	if err != nil {
+		t.Fatalf("Run() after Restore() error = %v", err)
+	}
+
+	if got.Statistics.InstructionsExecuted != want.Statistics.InstructionsExecuted {
+		t.Errorf("Restored run retired %d instructions, want %d", got.Statistics.InstructionsExecuted, want.Statistics.InstructionsExecuted)
+	}
+}
+
+func TestSetTrace(t *testing.T) {
+	async, _ := newSimulator(config.DefaultConfig())
+	if err := async.SetTrace(&bytes.Buffer{}); err == nil {
+		t.Errorf("SetTrace() in async mode should return error")
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.NumCores = 2
+	sim, _ := newSimulator(cfg)
+
+	var buf bytes.Buffer
+	if err := sim.SetTrace(&buf); err != nil {
+		t.Fatalf("SetTrace() error = %v", err)
+	}
+
+	withTrace, err := sim.Run(50)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 100 {
+		t.Fatalf("Trace has %d lines, want one per core per cycle", len(lines))
+	}
+
+	stages := []string{"Fetch", "Decode", "Execute", "Memory", "Writeback"}
+	busy := false
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if want := fmt.Sprintf("cycle=%d", i/2+1); fields[0] != want {
+			t.Fatalf("Line %d starts %q, want %q", i, fields[0], want)
+		}
+		if want := fmt.Sprintf("core=%d", i%2); fields[1] != want {
+			t.Fatalf("Line %d core %q, want %q", i, fields[1], want)
+		}
+
+		for j, stage := range stages {
+			name, value, _ := strings.Cut(fields[2+j], "=")
+			if name != stage {
+				t.Fatalf("Line %d field %d is %q, want stage %s", i, 2+j, name, stage)
+			}
+			if value != "-" {
+				busy = true
+				if !strings.HasPrefix(value, "0x") {
+					t.Errorf("Line %d stage %s holds %q, want addresses", i, stage, value)
+				}
+			}
+		}
+	}
+
+	if !busy {
+		t.Errorf("Trace never shows an instruction in flight")
+	}
+
+	// Tracing only observes, so the run matches one without it
+	plain, _ := newSimulator(cfg)
+	without, _ := plain.Run(50)
+	if !reflect.DeepEqual(simulated(withTrace.Statistics), simulated(without.Statistics)) {
+		t.Errorf("Tracing changed the simulation:\n%+v\n%+v", withTrace.Statistics, without.Statistics)
+	}
+
+	// Disabling tracing stops further output
+	if err := sim.SetTrace(nil); err != nil {
+		t.Fatalf("SetTrace(nil) error = %v", err)
+	}
+	buf.Reset()
+	sim.Run(10)
+	if buf.Len() != 0 {
+		t.Errorf("SetTrace(nil) left tracing enabled")
+	}
+}
+
+func TestSetTrace_OutOfOrder(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	cfg.NumCores = 1
+	cfg.OutOfOrder = true
+	sim, _ := newSimulator(cfg)
+
+	var buf bytes.Buffer
+	sim.SetTrace(&buf)
+	if _, err := sim.Run(50); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if !strings.HasPrefix(fields[len(fields)-1], "ROB=") {
+			t.Fatalf("Line %d %q does not end with the reorder buffer", i, line)
+		}
+	}
+}
+
+func TestCompareStats(t *testing.T) {
+	baseline := Statistics{
+		TotalCycles:   1000,
+		IPC:           0.5,
+		RetiredByType: map[string]int64{"Integer": 400, "Memory": 100},
+		BranchStats:   predictor.Stats{Predictions: 80, Mispredictions: 8},
+	}
+	changed := Statistics{
+		TotalCycles:       1000,
+		IPC:               0.6,
+		RetiredByType:     map[string]int64{"Integer": 500, "Branch": 100},
+		BranchStats:       predictor.Stats{Predictions: 100, Mispredictions: 8},
+		HazardStallCycles: 25,
+	}
+
+	diff := CompareStats(baseline, changed)
+
+	tests := []struct {
+		name        string
+		wantDelta   float64
+		wantPercent float64
+		noPercent   bool
+	}{
+		{name: "totalCycles", wantDelta: 0, wantPercent: 0},
+		{name: "ipc", wantDelta: 0.1, wantPercent: 20},
+		{name: "retiredByType.Integer", wantDelta: 100, wantPercent: 25},
+		{name: "retiredByType.Memory", wantDelta: -100, wantPercent: -100},
+		{name: "retiredByType.Branch", wantDelta: 100, noPercent: true},
+		{name: "branchStats.predictions", wantDelta: 20, wantPercent: 25},
+		{name: "hazardStallCycles", wantDelta: 25, noPercent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := diff.Metric(tt.name)
+			if !ok {
+				t.Fatalf("Metric(%q) missing from the diff", tt.name)
+			}
+
+			if math.Abs(m.Delta-tt.wantDelta) > 1e-9 {
+				t.Errorf("Delta = %v, want %v", m.Delta, tt.wantDelta)
+			}
+
+			if m.HasPercent == tt.noPercent || (m.HasPercent && math.Abs(m.Percent-tt.wantPercent) > 1e-9) {
+				t.Errorf("Percent = %v (%v), want %v (%v)", m.Percent, m.HasPercent, tt.wantPercent, !tt.noPercent)
+			}
+		})
+	}
+
+	// Per-core slices are not compared
+	if _, ok := diff.Metric("coreStallCycles"); ok {
+		t.Error("CompareStats() should leave out per-core slices")
+	}
+
+	table := diff.String()
+	for _, want := range []string{"Metric", "ipc", "0.5000", "0.6000", "+0.1000", "+20.00%", "hazardStallCycles"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("String() missing %q:\n%s", want, table)
+		}
+	}
+
+	// A zero baseline shows the delta without a percentage
+	for _, line := range strings.Split(table, "\n") {
+		if fields := strings.Fields(line); len(fields) == 5 && fields[0] == "hazardStallCycles" {
+			if fields[3] != "+25" || fields[4] != "-" {
+				t.Errorf("hazardStallCycles row = %q, want delta +25 and no percentage", line)
+			}
+		}
+	}
+}
+
+func TestAggregateStats(t *testing.T) {
+	runs := []Statistics{
+		{TotalCycles: 100, IPC: 1, RetiredByType: map[string]int64{"Integer": 10}, CoreUtilization: []float64{0.5, 0.25}},
+		{TotalCycles: 200, IPC: 2, RetiredByType: map[string]int64{"Integer": 20, "Branch": 6}, CoreUtilization: []float64{0.7, 0.25}},
+		{TotalCycles: 300, IPC: 3, RetiredByType: map[string]int64{"Integer": 30}, CoreUtilization: []float64{0.6}},
+	}
+
+	summary := AggregateStats(runs)
+	if summary.Runs != 3 {
+		t.Errorf("Runs = %d, want 3", summary.Runs)
+	}
+
+	tests := []struct {
+		name                   string
+		mean, min, max, stdDev float64
+	}{
+		{name: "totalCycles", mean: 200, min: 100, max: 300, stdDev: 100},
+		{name: "ipc", mean: 2, min: 1, max: 3, stdDev: 1},
+		{name: "retiredByType.Integer", mean: 20, min: 10, max: 30, stdDev: 10},
+		// Missing from two runs, where it counts as zero
+		{name: "retiredByType.Branch", mean: 2, min: 0, max: 6, stdDev: math.Sqrt(12)},
+		{name: "hazardStallCycles"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := summary.Metric(tt.name)
+			if !ok {
+				t.Fatalf("Metric(%q) missing from the summary", tt.name)
+			}
+
+			got := []float64{m.Mean, m.Min, m.Max, m.StdDev}
+			want := []float64{tt.mean, tt.min, tt.max, tt.stdDev}
+			for i := range got {
+				if math.Abs(got[i]-want[i]) > 1e-9 {
+					t.Errorf("Mean, Min, Max, StdDev = %v, want %v", got, want)
+					break
+				}
+			}
+		})
+	}
+
+	// Utilization is summarized per core, over the runs that had the core
+	if len(summary.CoreUtilization) != 2 {
+		t.Fatalf("CoreUtilization has %d cores, want 2", len(summary.CoreUtilization))
+	}
+	if m := summary.CoreUtilization[0]; m.Name != "core0" || math.Abs(m.Mean-0.6) > 1e-9 || math.Abs(m.StdDev-0.1) > 1e-9 {
+		t.Errorf("CoreUtilization[0] = %+v, want core0 with mean 0.6 and deviation 0.1", m)
+	}
+	if m := summary.CoreUtilization[1]; m.Mean != 0.25 || m.StdDev != 0 {
+		t.Errorf("CoreUtilization[1] = %+v, want mean 0.25 and no deviation", m)
+	}
+
+	table := summary.String()
+	for _, want := range []string{"3 runs", "ipc", "2.0000", "coreUtilization.core1"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("String() missing %q:\n%s", want, table)
+		}
+	}
+
+	// A single run has no spread
+	if m, _ := AggregateStats(runs[:1]).Metric("ipc"); m.Mean != 1 || m.StdDev != 0 {
+		t.Errorf("AggregateStats() of one run: ipc = %+v, want mean 1 and no deviation", m)
+	}
+	if empty := AggregateStats(nil); empty.Runs != 0 || len(empty.Metrics) != 0 {
+		t.Errorf("AggregateStats(nil) = %+v, want an empty summary", empty)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		mix  [4]int // integer, float, memory, branch
+	}{
+		{"Default mix", [4]int{}},
+		{"Memory", [4]int{40, 10, 50, 0}},
+		{"Branches", [4]int{40, 10, 30, 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.SyncMode = true
+			cfg.NumCores = 2
+			cfg.MixInteger, cfg.MixFloat, cfg.MixMemory, cfg.MixBranch = tt.mix[0], tt.mix[1], tt.mix[2], tt.mix[3]
+
+			recorded, _ := newSimulator(cfg)
+			var buf bytes.Buffer
+			if err := recorded.SetRecorder(&buf); err != nil {
+				t.Fatalf("SetRecorder() error = %v", err)
+			}
+			if _, err := recorded.Run(500); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			want := recorded.GetStatistics()
+
+			rows := strings.Count(buf.String(), "\n") - 1
+			if int64(rows) != want.InstructionsExecuted {
+				t.Fatalf("Recording has %d rows, want one per retired instruction (%d)", rows, want.InstructionsExecuted)
+			}
+
+			replayed, _ := newSimulator(cfg)
+			if err := replayed.Replay(&buf); err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+			if _, err := replayed.Run(500); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			got := replayed.GetStatistics()
+
+			if got.InstructionsExecuted != want.InstructionsExecuted || got.IPC != want.IPC {
+				t.Errorf("Replay retired %d at IPC %.4f, recording %d at IPC %.4f",
+					got.InstructionsExecuted, got.IPC, want.InstructionsExecuted, want.IPC)
+			}
+			if !maps.Equal(got.RetiredByType, want.RetiredByType) {
+				t.Errorf("Replay RetiredByType = %v, want %v", got.RetiredByType, want.RetiredByType)
+			}
+		})
+	}
+}
+
+func TestReplay_Invalid(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 1
+
+	tests := []struct {
+		name      string
+		recording string
+	}{
+		{"Empty", ""},
+		{"Wrong header", "cycle,ipc\n"},
+		{"Bad address", "core,thread,address,opcode,type,operands,target,length\n0,0,zz,0x1,Integer,1 2 3,0x0,4\n"},
+		{"Bad type", "core,thread,address,opcode,type,operands,target,length\n0,0,0x0,0x1,Vector,1 2 3,0x0,4\n"},
+		{"Too many cores", "core,thread,address,opcode,type,operands,target,length\n1,0,0x0,0x1,Integer,1 2 3,0x0,4\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim, _ := newSimulator(cfg)
+			if err := sim.Replay(strings.NewReader(tt.recording)); err == nil {
+				t.Errorf("Replay() should return error")
+			}
+		})
+	}
+}
+
+func TestRun_MemoryLatencyHistogram(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 2
+	cfg.SyncMode = true
+	cfg.MixInteger, cfg.MixMemory = 50, 50
+	cfg.LatencyBuckets = []int{cfg.L1Latency, 2 * cfg.L1Latency, 64}
+
+	sim, _ := newSimulator(cfg)
+	if _, err := sim.Run(2000); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	stats := sim.GetStatistics()
+
+	want := []BucketCount{
+		{Min: 0, Max: cfg.L1Latency},
+		{Min: cfg.L1Latency + 1, Max: 2 * cfg.L1Latency},
+		{Min: 2*cfg.L1Latency + 1, Max: 64},
+		{Min: 65, Max: 0},
+	}
+	if len(stats.MemoryLatencyHistogram) != len(want) {
+		t.Fatalf("Histogram has %d buckets, want %d", len(stats.MemoryLatencyHistogram), len(want))
+	}
+
+	var counted, accesses int64
+	for i, bucket := range stats.MemoryLatencyHistogram {
+		if bucket.Min != want[i].Min || bucket.Max != want[i].Max {
+			t.Errorf("Bucket %d covers %d-%d, want %d-%d", i, bucket.Min, bucket.Max, want[i].Min, want[i].Max)
+		}
+		counted += bucket.Count
+	}
+	for _, proc := range sim.cores {
+		accesses += proc.GetCacheHierarchy().Accesses()
+	}
+	if counted != accesses {
+		t.Errorf("Histogram counts %d accesses, want every cache access (%d)", counted, accesses)
+	}
+
+	// L1 hits take exactly the L1 latency, memory well over 64 cycles
+	if stats.MemoryLatencyHistogram[0].Count == 0 {
+		t.Errorf("No accesses in the L1 hit bucket")
+	}
+	if stats.MemoryLatencyHistogram[3].Count == 0 {
+		t.Errorf("No accesses in the open-ended bucket")
+	}
+
+	cfg.LatencyBuckets = nil
+	sim, _ = newSimulator(cfg)
+	if _, err := sim.Run(100); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := sim.GetStatistics().MemoryLatencyHistogram; got != nil {
+		t.Errorf("MemoryLatencyHistogram without buckets = %v, want nil", got)
+	}
+}
+
+// waitForClock waits until sim's clock passes cycle
+func waitForClock(t *testing.T, sim *simulator, cycle int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&sim.clock) <= cycle {
+		if time.Now().After(deadline) {
+			t.Fatalf("Clock did not pass cycle %d", cycle)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	for _, syncMode := range []bool{true, false} {
+		t.Run(fmt.Sprintf("SyncMode=%v", syncMode), func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.NumCores = 2
+			cfg.SyncMode = syncMode
+			cfg.MixInteger, cfg.MixMemory, cfg.MixBranch = 60, 30, 10
+			cycles := int64(50000)
+
+			sim, _ := newSimulator(cfg)
+			sim.Pause() // nothing running
+			if sim.paused.Load() {
+				t.Fatalf("Pause() with nothing running should be a no-op")
+			}
+
+			type outcome struct {
+				result *RunResult
+				err    error
+			}
+			done := make(chan outcome)
+			go func() {
+				result, err := sim.Run(cycles)
+				done <- outcome{result, err}
+			}()
+
+			waitForClock(t, sim, 100)
+			sim.Pause()
+			sim.Pause() // already paused
+
+			paused := sim.GetStatistics()
+			clock := atomic.LoadInt64(&sim.clock)
+			time.Sleep(20 * time.Millisecond)
+			again := sim.GetStatistics()
+
+			if atomic.LoadInt64(&sim.clock) != clock {
+				t.Errorf("Clock moved from %d to %d while paused", clock, atomic.LoadInt64(&sim.clock))
+			}
+			if !reflect.DeepEqual(paused, again) {
+				t.Errorf("Statistics changed while paused")
+			}
+			if paused.TotalCycles == 0 || paused.TotalCycles >= cycles {
+				t.Errorf("Paused TotalCycles = %d, want part of the run", paused.TotalCycles)
+			}
+			if syncMode && paused.TotalCycles != clock {
+				t.Errorf("Paused TotalCycles = %d, want the clock (%d)", paused.TotalCycles, clock)
+			}
+
+			sim.Resume()
+			sim.Resume() // not paused
+
+			got := <-done
+			if got.err != nil {
+				t.Fatalf("Run() error = %v", got.err)
+			}
+			if got.result.Statistics.TotalCycles != cycles {
+				t.Errorf("TotalCycles = %d, want %d", got.result.Statistics.TotalCycles, cycles)
+			}
+
+			if syncMode {
+				// A pause leaves a lockstep run exactly as it would have been
+				unpaused, _ := newSimulator(cfg)
+				want, err := unpaused.Run(cycles)
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				if got.result.Statistics.InstructionsExecuted != want.Statistics.InstructionsExecuted {
+					t.Errorf("Paused run retired %d, unpaused %d",
+						got.result.Statistics.InstructionsExecuted, want.Statistics.InstructionsExecuted)
+				}
+			}
+		})
+	}
+}
+
+func TestPauseResume_Concurrent(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 2
+	sim, _ := newSimulator(cfg)
+
+	done := make(chan error)
+	go func() {
+		_, err := sim.Run(100000)
+		done <- err
+	}()
+	waitForClock(t, sim, 10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if (i+j)%2 == 0 {
+					sim.Pause()
+				} else {
+					sim.Resume()
+				}
+				sim.GetStatistics()
+			}
+		}(i)
+	}
+	wg.Wait()
+	sim.Resume()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestPause_Shutdown(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SyncMode = true
+	sim, _ := newSimulator(cfg)
+
+	done := make(chan error)
+	go func() {
+		_, err := sim.Run(1 << 40)
+		done <- err
+	}()
+	waitForClock(t, sim, 10)
+	sim.Pause()
+
+	sim.Shutdown()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown() did not stop a paused run")
+	}
+	if sim.paused.Load() {
+		t.Errorf("Simulator still paused after its run ended")
+	}
+
+	// A paused run also stops at its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	go func() {
+		_, err := sim.RunContext(ctx, 1<<40)
+		done <- err
+	}()
+	waitForClock(t, sim, 10)
+	sim.Pause()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("RunContext() error = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Deadline did not stop a paused run")
+	}
+}
+
+func TestRun_Flushes(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NumCores = 2
+	cfg.SyncMode = true
+	cfg.MixInteger, cfg.MixMemory, cfg.MixBranch = 50, 40, 10
+	cfg.FlushOnInvalidate = true
+	cfg.FlushPenalty = true
+
+	sim, _ := newSimulator(cfg)
+	if _, err := sim.Run(5000); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	stats := sim.GetStatistics()
+
+	if stats.Flushes["coherence"] == 0 {
+		t.Errorf("No coherence flushes with cores sharing lines: %v", stats.Flushes)
+	}
+	if stats.Flushes["mispredict"] == 0 {
+		t.Errorf("No mispredict flushes with branches: %v", stats.Flushes)
+	}
+	if stats.FlushCycles <= stats.MispredictCycles {
+		t.Errorf("FlushCycles = %d, want more than the %d mispredict cycles", stats.FlushCycles, stats.MispredictCycles)
+	}
+	if stats.InstructionsExecuted == 0 {
+		t.Errorf("Cores replaying stale loads should still retire instructions")
+	}
+
+	cfg.FlushOnInvalidate = false
+	sim, _ = newSimulator(cfg)
+	if _, err := sim.Run(5000); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := sim.GetStatistics().Flushes["coherence"]; got != 0 {
+		t.Errorf("Coherence flushes without flushOnInvalidate = %d, want 0", got)
+	}
+}
+
+func TestRun_FalseSharing(t *testing.T) {
+	run := func(lines int) Statistics {
+		cfg := config.DefaultConfig()
+		cfg.NumCores = 2
+		cfg.SyncMode = true
+		cfg.MixInteger, cfg.MixMemory = 50, 50
+		cfg.FalseSharingLines = lines
+
+		sim, _ := newSimulator(cfg)
+		if _, err := sim.Run(5000); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return sim.GetStatistics()
+	}
+
+	if got := run(0).FalseSharingLines; got != nil {
+		t.Errorf("FalseSharingLines without detection = %v, want nil", got)
+	}
+
+	stats := run(3)
+	if len(stats.FalseSharingLines) == 0 || len(stats.FalseSharingLines) > 3 {
+		t.Fatalf("Reported %d false sharing lines, want 1 to 3", len(stats.FalseSharingLines))
+	}
+
+	var total int64
+	for i, line := range stats.FalseSharingLines {
+		if line.Invalidations <= 0 {
+			t.Errorf("Line %#x reported with %d invalidations", line.Address, line.Invalidations)
+		}
+		if i > 0 && line.Invalidations > stats.FalseSharingLines[i-1].Invalidations {
+			t.Errorf("Lines not ordered by invalidations: %v", stats.FalseSharingLines)
+		}
+		total += line.Invalidations
+	}
+	if total > stats.CoherenceStats.Invalidations {
+		t.Errorf("%d false sharing invalidations, more than the %d in total", total, stats.CoherenceStats.Invalidations)
+	}
+}
@@ -0,0 +1,100 @@
+package simulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jasonKoogler/cpu-sim/internal/core"
+	"github.com/jasonKoogler/cpu-sim/internal/pipeline"
+)
+
+// tracer writes one line per core per cycle listing the instructions in
+// each pipeline stage, for example
+//
+//	cycle=12 core=0 Fetch=0x30 Decode=0x2c Execute=- Memory=0x24,0x28 Writeback=-
+//
+// Stages hold addresses oldest first, "-" when empty. Instructions of
+// threads other than 0 are prefixed with the thread, as in t1:0x24. An
+// out-of-order pipeline adds a ROB field listing its reorder buffer.
+type tracer struct {
+	w   *bufio.Writer
+	rob bool // cores issue out of order
+	buf []byte
+	err error // first write error, later lines are dropped
+}
+
+func newTracer(w io.Writer, outOfOrder bool) *tracer {
+	return &tracer{w: bufio.NewWriter(w), rob: outOfOrder}
+}
+
+// trace records the pipeline of every core after cycle
+func (t *tracer) trace(cycle int64, cores []*core.Processor) {
+	if t.err != nil {
+		return
+	}
+
+	for _, proc := range cores {
+		snap := proc.PipelineSnapshot()
+
+		t.buf = append(t.buf[:0], "cycle="...)
+		t.buf = strconv.AppendInt(t.buf, cycle, 10)
+		t.buf = append(t.buf, " core="...)
+		t.buf = strconv.AppendInt(t.buf, int64(proc.GetID()), 10)
+
+		for _, stage := range snap.Stages {
+			t.buf = append(t.buf, ' ')
+			t.buf = append(t.buf, stage.Name...)
+			t.buf = append(t.buf, '=')
+			t.buf = appendInstructions(t.buf, stage.Instructions)
+		}
+
+		if t.rob {
+			insts := make([]pipeline.Instruction, len(snap.ROB))
+			for i, e := range snap.ROB {
+				insts[i] = e.Instruction
+			}
+			t.buf = append(t.buf, " ROB="...)
+			t.buf = appendInstructions(t.buf, insts)
+		}
+
+		t.buf = append(t.buf, '\n')
+		if _, err := t.w.Write(t.buf); err != nil {
+			t.err = fmt.Errorf("failed to write trace: %w", err)
+			return
+		}
+	}
+}
+
+// appendInstructions appends the comma-separated addresses of insts, or
+// "-" if there are none
+func appendInstructions(buf []byte, insts []pipeline.Instruction) []byte {
+	if len(insts) == 0 {
+		return append(buf, '-')
+	}
+
+	for i, inst := range insts {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		if inst.Thread != 0 {
+			buf = append(buf, 't')
+			buf = strconv.AppendInt(buf, int64(inst.Thread), 10)
+			buf = append(buf, ':')
+		}
+		buf = append(buf, "0x"...)
+		buf = strconv.AppendUint(buf, inst.Address, 16)
+	}
+	return buf
+}
+
+// flush writes any buffered lines and returns the first error encountered
+func (t *tracer) flush() error {
+	if t.err == nil {
+		if err := t.w.Flush(); err != nil {
+			t.err = fmt.Errorf("failed to write trace: %w", err)
+		}
+	}
+	return t.err
+}
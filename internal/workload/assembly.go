@@ -0,0 +1,198 @@
+package workload
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Opcodes emitted by the assembler
+const (
+	OpcodeADD uint8 = 0x01
+	OpcodeSUB uint8 = 0x02
+	OpcodeLW  uint8 = 0x60
+	OpcodeSW  uint8 = 0x68
+	OpcodeBEQ uint8 = 0x70
+	OpcodeJAL uint8 = 0x7E
+)
+
+// operandCounts maps each supported mnemonic to its number of operands
+var operandCounts = map[string]int{"add": 3, "sub": 3, "lw": 2, "sw": 2, "beq": 3, "jal": 2}
+
+// LoadAssembly reads and assembles a workload source file
+func LoadAssembly(path string) ([]Instruction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workload: %w", err)
+	}
+	defer f.Close()
+
+	insts, err := ParseAssembly(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble workload %s: %w", path, err)
+	}
+
+	return insts, nil
+}
+
+// ParseAssembly assembles a small RISC-V subset into workload instructions.
+// One instruction is accepted per line; '#' starts a comment.
+//
+//	add rd, rs1, rs2   Dest=rd, Src1=rs1, Src2=rs2
+//	sub rd, rs1, rs2   Dest=rd, Src1=rs1, Src2=rs2
+//	lw  rd, imm(rs1)   Dest=rd, Src1=rs1, Src2=imm
+//	sw  rs2, imm(rs1)  Dest=rs2, Src1=rs1, Src2=imm
+//	beq rs1, rs2, imm  Dest=imm/4, Src1=rs1, Src2=rs2
+//	jal rd, imm        Dest=imm/4, Src1=rd, Src2=rd
+//
+// Load and store offsets are bytes from 0 to 255. Branch and jump offsets
+// are bytes relative to the instruction, a multiple of 4 from -512 to 508,
+// and are stored as a signed word count. jal compares its link register
+// with itself so the branch unit always takes it.
+func ParseAssembly(r io.Reader) ([]Instruction, error) {
+	var insts []Instruction
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		inst, err := assemble(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		insts = append(insts, inst)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read assembly: %w", err)
+	}
+
+	return insts, nil
+}
+
+// assemble encodes a single instruction with comments already stripped
+func assemble(text string) (Instruction, error) {
+	mnemonic, rest := text, ""
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		mnemonic, rest = text[:i], text[i:]
+	}
+	mnemonic = strings.ToLower(mnemonic)
+
+	var args []string
+	if rest = strings.TrimSpace(rest); rest != "" {
+		for _, arg := range strings.Split(rest, ",") {
+			args = append(args, strings.TrimSpace(arg))
+		}
+	}
+
+	n, ok := operandCounts[mnemonic]
+	if !ok {
+		return Instruction{}, fmt.Errorf("unknown instruction %q", mnemonic)
+	}
+	if len(args) != n {
+		return Instruction{}, fmt.Errorf("%s takes %d operands, got %d", mnemonic, n, len(args))
+	}
+
+	switch mnemonic {
+	case "add", "sub":
+		regs, err := parseRegisters(args...)
+		if err != nil {
+			return Instruction{}, err
+		}
+		opcode := OpcodeADD
+		if mnemonic == "sub" {
+			opcode = OpcodeSUB
+		}
+		return Instruction{Opcode: opcode, Src1: regs[1], Src2: regs[2], Dest: regs[0]}, nil
+
+	case "lw", "sw":
+		regs, err := parseRegisters(args[0])
+		if err != nil {
+			return Instruction{}, err
+		}
+		offset, base, err := parseMemoryOperand(args[1])
+		if err != nil {
+			return Instruction{}, err
+		}
+		opcode := OpcodeLW
+		if mnemonic == "sw" {
+			opcode = OpcodeSW
+		}
+		return Instruction{Opcode: opcode, Src1: base, Src2: offset, Dest: regs[0]}, nil
+
+	case "beq":
+		regs, err := parseRegisters(args[0], args[1])
+		if err != nil {
+			return Instruction{}, err
+		}
+		offset, err := parseBranchOffset(args[2])
+		if err != nil {
+			return Instruction{}, err
+		}
+		return Instruction{Opcode: OpcodeBEQ, Src1: regs[0], Src2: regs[1], Dest: offset}, nil
+
+	default: // jal
+		regs, err := parseRegisters(args[0])
+		if err != nil {
+			return Instruction{}, err
+		}
+		offset, err := parseBranchOffset(args[1])
+		if err != nil {
+			return Instruction{}, err
+		}
+		return Instruction{Opcode: OpcodeJAL, Src1: regs[0], Src2: regs[0], Dest: offset}, nil
+	}
+}
+
+// parseRegisters parses register names of the form x0 to x31
+func parseRegisters(names ...string) ([]uint8, error) {
+	regs := make([]uint8, len(names))
+	for i, name := range names {
+		num, ok := strings.CutPrefix(strings.ToLower(name), "x")
+		n, err := strconv.Atoi(num)
+		if !ok || err != nil || n < 0 || n > 31 {
+			return nil, fmt.Errorf("invalid register %q", name)
+		}
+		regs[i] = uint8(n)
+	}
+	return regs, nil
+}
+
+// parseMemoryOperand parses an imm(rs1) operand into its offset and base
+func parseMemoryOperand(arg string) (offset, base uint8, err error) {
+	imm, reg, ok := strings.Cut(arg, "(")
+	if !ok || !strings.HasSuffix(reg, ")") {
+		return 0, 0, fmt.Errorf("invalid memory operand %q, want imm(reg)", arg)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(imm))
+	if err != nil || n < 0 || n > 255 {
+		return 0, 0, fmt.Errorf("invalid memory offset %q, want 0 to 255", imm)
+	}
+
+	regs, err := parseRegisters(strings.TrimSpace(strings.TrimSuffix(reg, ")")))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uint8(n), regs[0], nil
+}
+
+// parseBranchOffset parses a byte offset into a signed word count
+func parseBranchOffset(arg string) (uint8, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n%4 != 0 || n < -512 || n > 508 {
+		return 0, fmt.Errorf("invalid branch offset %q, want a multiple of 4 from -512 to 508", arg)
+	}
+	return uint8(int8(n / 4)), nil
+}
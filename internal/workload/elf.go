@@ -0,0 +1,204 @@
+package workload
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Program is a workload laid out in memory, with the address its first
+// instruction sits at and the address execution starts from
+type Program struct {
+	Instructions []Instruction
+	TextAddr     uint64 // address of the first instruction
+	Entry        uint64 // address of the first instruction executed
+	Data         []byte // initial contents of the data segment, if any
+	DataAddr     uint64 // address of the data segment
+}
+
+// LoadProgram reads a workload from path, as an ELF executable if it starts
+// with the ELF magic and otherwise as LoadWorkload does, laid out and
+// entered at address 0
+func LoadProgram(path string) (*Program, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workload: %w", err)
+	}
+	magic := make([]byte, len(elf.ELFMAG))
+	_, err = io.ReadFull(f, magic)
+	f.Close()
+
+	if err == nil && string(magic) == elf.ELFMAG {
+		return LoadELF(path)
+	}
+
+	insts, err := LoadWorkload(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{Instructions: insts}, nil
+}
+
+// LoadELF reads a RISC-V ELF executable, decoding its .text section into
+// workload instructions and keeping its entry point and initial .data.
+// Only the RV32I/RV64I instructions the workload format can represent are
+// accepted; see decodeRISCV.
+func LoadELF(path string) (*Program, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ELF workload: %w", err)
+	}
+	defer f.Close()
+
+	if f.Machine != elf.EM_RISCV {
+		return nil, fmt.Errorf("ELF workload %s is built for %s, not RISC-V", path, f.Machine)
+	}
+
+	text := f.Section(".text")
+	if text == nil || text.Type == elf.SHT_NOBITS {
+		return nil, fmt.Errorf("ELF workload %s has no .text section", path)
+	}
+
+	code, err := text.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .text of %s: %w", path, err)
+	}
+
+	if len(code)%InstructionSize != 0 {
+		return nil, fmt.Errorf(".text of %s is %d bytes, not a whole number of %d-byte instructions",
+			path, len(code), InstructionSize)
+	}
+
+	prog := &Program{
+		Instructions: make([]Instruction, len(code)/InstructionSize),
+		TextAddr:     text.Addr,
+		Entry:        f.Entry,
+	}
+
+	if f.Entry < text.Addr || f.Entry >= text.Addr+uint64(len(code)) || (f.Entry-text.Addr)%InstructionSize != 0 {
+		return nil, fmt.Errorf("entry point %#x of %s is not an instruction in .text", f.Entry, path)
+	}
+
+	for i := range prog.Instructions {
+		addr := text.Addr + uint64(i*InstructionSize)
+		word := binary.LittleEndian.Uint32(code[i*InstructionSize:])
+		inst, err := decodeRISCV(word)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s at %#x: %w", path, addr, err)
+		}
+		prog.Instructions[i] = inst
+	}
+
+	if data := f.Section(".data"); data != nil && data.Type != elf.SHT_NOBITS {
+		contents, err := data.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .data of %s: %w", path, err)
+		}
+		prog.Data = bytes.Clone(contents)
+		prog.DataAddr = data.Addr
+	}
+
+	return prog, nil
+}
+
+// RISC-V major opcodes, the low 7 bits of an instruction word
+const (
+	rvLoad   = 0x03
+	rvOpImm  = 0x13
+	rvStore  = 0x23
+	rvOp     = 0x33
+	rvBranch = 0x63
+	rvJAL    = 0x6F
+)
+
+// rvALUOps maps an R-type instruction's funct7 and funct3 to its ALU
+// opcode, which matches the core's encoding
+var rvALUOps = map[[2]uint32]uint8{
+	{0x00, 0}: OpcodeADD,
+	{0x20, 0}: OpcodeSUB,
+	{0x00, 7}: 0x03, // and
+	{0x00, 6}: 0x04, // or
+	{0x00, 4}: 0x05, // xor
+	{0x00, 1}: 0x06, // sll
+	{0x00, 5}: 0x07, // srl
+	{0x20, 5}: 0x08, // sra
+}
+
+// decodeRISCV translates a 32-bit RISC-V encoding into a workload
+// instruction. It accepts the register-register ALU operations but the
+// comparisons, addi with a zero immediate (mv and nop), loads and stores of
+// any width with an offset from 0 to 255, beq, bne, and jal with offsets
+// from -512 to 508 bytes. Anything else is an error.
+func decodeRISCV(word uint32) (Instruction, error) {
+	rd := uint8(word >> 7 & 0x1F)
+	funct3 := word >> 12 & 0x7
+	rs1 := uint8(word >> 15 & 0x1F)
+	rs2 := uint8(word >> 20 & 0x1F)
+	funct7 := word >> 25
+
+	switch word & 0x7F {
+	case rvOp:
+		if opcode, ok := rvALUOps[[2]uint32{funct7, funct3}]; ok {
+			return Instruction{Opcode: opcode, Src1: rs1, Src2: rs2, Dest: rd}, nil
+		}
+
+	case rvOpImm:
+		if funct3 == 0 && word>>20 == 0 {
+			return Instruction{Opcode: OpcodeADD, Src1: rs1, Src2: 0, Dest: rd}, nil
+		}
+
+	case rvLoad:
+		if funct3 == 7 {
+			break
+		}
+		offset := int32(word) >> 20
+		if offset < 0 || offset > 255 {
+			return Instruction{}, fmt.Errorf("load offset %d is outside 0 to 255", offset)
+		}
+		return Instruction{Opcode: OpcodeLW, Src1: rs1, Src2: uint8(offset), Dest: rd}, nil
+
+	case rvStore:
+		if funct3 > 3 {
+			break
+		}
+		offset := int32(word)>>25<<5 | int32(rd)
+		if offset < 0 || offset > 255 {
+			return Instruction{}, fmt.Errorf("store offset %d is outside 0 to 255", offset)
+		}
+		return Instruction{Opcode: OpcodeSW, Src1: rs1, Src2: uint8(offset), Dest: rs2}, nil
+
+	case rvBranch:
+		if funct3 > 1 {
+			break
+		}
+		offset := int32(word)>>31<<12 | int32(word>>7&1)<<11 | int32(word>>25&0x3F)<<5 | int32(word>>8&0xF)<<1
+		dest, err := wordOffset(offset)
+		if err != nil {
+			return Instruction{}, err
+		}
+		// beq has an even opcode, bne the odd one after it
+		return Instruction{Opcode: OpcodeBEQ | uint8(funct3), Src1: rs1, Src2: rs2, Dest: dest}, nil
+
+	case rvJAL:
+		offset := int32(word)>>31<<20 | int32(word>>12&0xFF)<<12 | int32(word>>20&1)<<11 | int32(word>>21&0x3FF)<<1
+		dest, err := wordOffset(offset)
+		if err != nil {
+			return Instruction{}, err
+		}
+		return Instruction{Opcode: OpcodeJAL, Src1: rd, Src2: rd, Dest: dest}, nil
+	}
+
+	return Instruction{}, fmt.Errorf("unsupported instruction %#08x", word)
+}
+
+// wordOffset converts a branch or jump's byte offset into a signed word
+// count
+func wordOffset(offset int32) (uint8, error) {
+	if offset%InstructionSize != 0 || offset < -512 || offset > 508 {
+		return 0, fmt.Errorf("branch offset %d is not a multiple of 4 from -512 to 508", offset)
+	}
+	return uint8(int8(offset / InstructionSize)), nil
+}
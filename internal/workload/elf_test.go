@@ -0,0 +1,144 @@
+package workload
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeELF writes a minimal little-endian ELF32 executable for machine with
+// the given instruction words at textAddr, data at dataAddr and entry point,
+// returning its path
+func writeELF(t *testing.T, machine elf.Machine, entry, textAddr uint32, words []uint32, dataAddr uint32, data []byte) string {
+	t.Helper()
+
+	var text bytes.Buffer
+	binary.Write(&text, binary.LittleEndian, words)
+	shstrtab := []byte("\x00.text\x00.data\x00.shstrtab\x00")
+
+	const headerSize, sectionSize = 52, 40
+	textOff := uint32(headerSize)
+	dataOff := textOff + uint32(text.Len())
+	strOff := dataOff + uint32(len(data))
+	shOff := strOff + uint32(len(shstrtab))
+
+	var buf bytes.Buffer
+	header := elf.Header32{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     entry,
+		Shoff:     shOff,
+		Ehsize:    headerSize,
+		Shentsize: sectionSize,
+		Shnum:     4,
+		Shstrndx:  3,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(text.Bytes())
+	buf.Write(data)
+	buf.Write(shstrtab)
+
+	sections := []elf.Section32{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Flags: uint32(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+			Addr: textAddr, Off: textOff, Size: uint32(text.Len()), Addralign: 4},
+		{Name: 7, Type: uint32(elf.SHT_PROGBITS), Flags: uint32(elf.SHF_ALLOC | elf.SHF_WRITE),
+			Addr: dataAddr, Off: dataOff, Size: uint32(len(data)), Addralign: 1},
+		{Name: 13, Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint32(len(shstrtab)), Addralign: 1},
+	}
+	binary.Write(&buf, binary.LittleEndian, sections)
+
+	path := filepath.Join(t.TempDir(), "program.elf")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write ELF: %v", err)
+	}
+	return path
+}
+
+func TestLoadELF(t *testing.T) {
+	words := []uint32{
+		0x002081B3, // add x3, x1, x2
+		0x40118233, // sub x4, x3, x1
+		0x0020C333, // xor x6, x1, x2
+		0x00000013, // nop
+		0x00802283, // lw x5, 8(x0)
+		0x0E313FA3, // sd x3, 255(x2)
+		0xFE209CE3, // bne x1, x2, -8
+		0x010000EF, // jal x1, 16
+	}
+	path := writeELF(t, elf.EM_RISCV, 0x10004, 0x10000, words, 0x20000, []byte{1, 2, 3, 4})
+
+	got, err := LoadELF(path)
+	if err != nil {
+		t.Fatalf("LoadELF() error = %v", err)
+	}
+
+	want := &Program{
+		Instructions: []Instruction{
+			{Opcode: OpcodeADD, Src1: 1, Src2: 2, Dest: 3},
+			{Opcode: OpcodeSUB, Src1: 3, Src2: 1, Dest: 4},
+			{Opcode: 0x05, Src1: 1, Src2: 2, Dest: 6},
+			{Opcode: OpcodeADD, Src1: 0, Src2: 0, Dest: 0},
+			{Opcode: OpcodeLW, Src1: 0, Src2: 8, Dest: 5},
+			{Opcode: OpcodeSW, Src1: 2, Src2: 255, Dest: 3},
+			{Opcode: OpcodeBEQ + 1, Src1: 1, Src2: 2, Dest: 0xFE}, // -2 words
+			{Opcode: OpcodeJAL, Src1: 1, Src2: 1, Dest: 4},
+		},
+		TextAddr: 0x10000,
+		Entry:    0x10004,
+		Data:     []byte{1, 2, 3, 4},
+		DataAddr: 0x20000,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadELF() = %+v, want %+v", got, want)
+	}
+
+	// LoadProgram recognizes the ELF by its magic, whatever the file is called
+	renamed := filepath.Join(t.TempDir(), "program.bin")
+	if err := os.Rename(path, renamed); err != nil {
+		t.Fatalf("Failed to rename ELF: %v", err)
+	}
+	if prog, err := LoadProgram(renamed); err != nil || !reflect.DeepEqual(prog, want) {
+		t.Errorf("LoadProgram() = %+v, %v, want %+v", prog, err, want)
+	}
+}
+
+func TestLoadELF_Errors(t *testing.T) {
+	nop := []uint32{0x00000013}
+	tests := []struct {
+		name    string
+		machine elf.Machine
+		entry   uint32
+		words   []uint32
+		wantErr string
+	}{
+		{name: "Not RISC-V", machine: elf.EM_X86_64, entry: 0x1000, words: nop, wantErr: "is built for EM_X86_64, not RISC-V"},
+		{name: "Entry outside .text", machine: elf.EM_RISCV, entry: 0x2000, words: nop, wantErr: "entry point 0x2000"},
+		{name: "Unsupported instruction", machine: elf.EM_RISCV, entry: 0x1000, words: []uint32{0x022081B3}, wantErr: "at 0x1000: unsupported instruction 0x022081b3"},
+		{name: "Nonzero immediate", machine: elf.EM_RISCV, entry: 0x1000, words: []uint32{0x00508093}, wantErr: "unsupported instruction"},
+		{name: "Ordered branch", machine: elf.EM_RISCV, entry: 0x1000, words: []uint32{0x0020C463}, wantErr: "unsupported instruction"},
+		{name: "Indirect jump", machine: elf.EM_RISCV, entry: 0x1000, words: []uint32{0x00008067}, wantErr: "unsupported instruction"},
+		{name: "Negative load offset", machine: elf.EM_RISCV, entry: 0x1000, words: []uint32{0xFFC12083}, wantErr: "load offset -4 is outside 0 to 255"},
+		{name: "Branch out of range", machine: elf.EM_RISCV, entry: 0x1000, words: []uint32{0x20208063}, wantErr: "branch offset 512"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeELF(t, tt.machine, tt.entry, 0x1000, tt.words, 0x2000, nil)
+			_, err := LoadELF(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadELF() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
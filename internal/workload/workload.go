@@ -0,0 +1,115 @@
+// Package workload loads instruction streams for the simulated cores.
+//
+// A workload binary is a sequence of 4-byte little-endian instruction words.
+// From the least significant byte up, each word holds the opcode, the first
+// source register, the second source register and the destination register.
+// The opcode range selects the instruction type:
+//
+//	0x00-0x3F  Integer
+//	0x40-0x5F  Float
+//	0x60-0x6F  Memory
+//	0x70-0x7F  Branch
+//	0x80-0xFF  System
+//
+// A Memory instruction loads from the address in its first source register
+// plus its second source byte, or stores there if bit 3 of its opcode is
+// set. With bits 2 and 3 both set it is an atomic read-modify-write, which
+// loads and stores the address as one transaction.
+//
+// A branch compares its two source registers, taken if equal for even
+// opcodes and not equal for odd ones, and holds its target in the
+// destination byte as a signed word offset from the branch itself.
+//
+// Workloads can also be written in a small RISC-V assembly subset; see
+// ParseAssembly. RISC-V ELF executables are decoded into the same form;
+// see LoadELF.
+package workload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InstructionSize is the encoded size of an instruction in bytes
+const InstructionSize = 4
+
+// OpcodeAMO is an atomic read-modify-write, as is any Memory opcode with
+// bits 2 and 3 set
+const OpcodeAMO uint8 = 0x6C
+
+// Instruction is a single decoded workload instruction
+type Instruction struct {
+	Opcode uint8
+	Src1   uint8
+	Src2   uint8
+	Dest   uint8
+}
+
+// Type returns the instruction type implied by the opcode
+func (i Instruction) Type() string {
+	switch {
+	case i.Opcode < 0x40:
+		return "Integer"
+	case i.Opcode < 0x60:
+		return "Float"
+	case i.Opcode < 0x70:
+		return "Memory"
+	case i.Opcode < 0x80:
+		return "Branch"
+	default:
+		return "System"
+	}
+}
+
+// LoadWorkload reads and decodes a workload binary, or assembles it if path
+// ends in .s or .asm
+func LoadWorkload(path string) ([]Instruction, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".s", ".asm":
+		return LoadAssembly(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workload: %w", err)
+	}
+
+	insts, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode workload %s: %w", path, err)
+	}
+
+	return insts, nil
+}
+
+// Decode decodes a workload binary image
+func Decode(data []byte) ([]Instruction, error) {
+	if len(data)%InstructionSize != 0 {
+		return nil, fmt.Errorf("length %d is not a multiple of the %d-byte instruction size",
+			len(data), InstructionSize)
+	}
+
+	insts := make([]Instruction, len(data)/InstructionSize)
+	for i := range insts {
+		word := data[i*InstructionSize : (i+1)*InstructionSize]
+		insts[i] = Instruction{
+			Opcode: word[0],
+			Src1:   word[1],
+			Src2:   word[2],
+			Dest:   word[3],
+		}
+	}
+
+	return insts, nil
+}
+
+// Encode encodes instructions into the workload binary format
+func Encode(insts []Instruction) []byte {
+	data := make([]byte, 0, len(insts)*InstructionSize)
+	for _, inst := range insts {
+		data = append(data, inst.Opcode, inst.Src1, inst.Src2, inst.Dest)
+	}
+	return data
+}
@@ -0,0 +1,176 @@
+package workload
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadWorkload(t *testing.T) {
+	want := []Instruction{
+		{Opcode: 0x01, Src1: 2, Src2: 3, Dest: 1},
+		{Opcode: 0x40, Src1: 4, Src2: 5, Dest: 6},
+		{Opcode: 0x70, Src1: 1, Src2: 6, Dest: 0},
+	}
+
+	tmpfile, err := os.CreateTemp("", "workload-*.bin")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write(Encode(want)); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatalf("Failed to close temp file: %v", err)
+	}
+
+	got, err := LoadWorkload(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("LoadWorkload() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadWorkload() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadWorkload_Sample(t *testing.T) {
+	insts, err := LoadWorkload("../../workloads/sample.bin")
+	if err != nil {
+		t.Fatalf("LoadWorkload(sample.bin) error = %v", err)
+	}
+
+	if len(insts) == 0 {
+		t.Errorf("Sample workload is empty")
+	}
+}
+
+func TestLoadWorkload_Missing(t *testing.T) {
+	if _, err := LoadWorkload("does-not-exist.bin"); err == nil {
+		t.Fatal("LoadWorkload() of a missing file should return error")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	// Bytes are opcode, src1, src2, dest from the least significant byte up
+	got, err := Decode([]byte{0x02, 0x05, 0x06, 0x07})
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	want := []Instruction{{Opcode: 0x02, Src1: 5, Src2: 6, Dest: 7}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+
+	if _, err := Decode([]byte{0x01, 0x02, 0x03}); err == nil {
+		t.Errorf("Decode() of a truncated instruction should return error")
+	}
+}
+
+func TestInstructionType(t *testing.T) {
+	tests := []struct {
+		opcode uint8
+		want   string
+	}{
+		{0x00, "Integer"},
+		{0x3F, "Integer"},
+		{0x40, "Float"},
+		{0x60, "Memory"},
+		{0x70, "Branch"},
+		{0x80, "System"},
+		{0xFF, "System"},
+	}
+
+	for _, tt := range tests {
+		if got := (Instruction{Opcode: tt.opcode}).Type(); got != tt.want {
+			t.Errorf("Instruction{Opcode: %#x}.Type() = %s, want %s", tt.opcode, got, tt.want)
+		}
+	}
+}
+
+func TestParseAssembly(t *testing.T) {
+	src := `
+# Sum two registers and store the result
+add x3, x1, x2
+SUB x4,x3,x1   # mnemonics are case-insensitive
+lw x5, 8(x0)
+sw x3, 255(x2)
+beq x1, x2, -8
+jal x1, 16
+`
+	want := []Instruction{
+		{Opcode: OpcodeADD, Src1: 1, Src2: 2, Dest: 3},
+		{Opcode: OpcodeSUB, Src1: 3, Src2: 1, Dest: 4},
+		{Opcode: OpcodeLW, Src1: 0, Src2: 8, Dest: 5},
+		{Opcode: OpcodeSW, Src1: 2, Src2: 255, Dest: 3},
+		{Opcode: OpcodeBEQ, Src1: 1, Src2: 2, Dest: 0xFE}, // -2 words
+		{Opcode: OpcodeJAL, Src1: 1, Src2: 1, Dest: 4},
+	}
+
+	got, err := ParseAssembly(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseAssembly() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAssembly() = %+v, want %+v", got, want)
+	}
+
+	types := []string{"Integer", "Integer", "Memory", "Memory", "Branch", "Branch"}
+	for i, inst := range got {
+		if inst.Type() != types[i] {
+			t.Errorf("Instruction %d type = %s, want %s", i, inst.Type(), types[i])
+		}
+	}
+}
+
+func TestParseAssembly_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{name: "Unknown mnemonic", src: "add x1, x2, x3\n\nmul x1, x2, x3\n", wantErr: `line 3: unknown instruction "mul"`},
+		{name: "Operand count", src: "add x1, x2\n", wantErr: "line 1: add takes 3 operands, got 2"},
+		{name: "Register out of range", src: "add x1, x2, x32\n", wantErr: `line 1: invalid register "x32"`},
+		{name: "ABI register name", src: "add a0, x2, x3\n", wantErr: `line 1: invalid register "a0"`},
+		{name: "Missing base register", src: "lw x1, 8\n", wantErr: "line 1: invalid memory operand"},
+		{name: "Negative memory offset", src: "sw x1, -4(x2)\n", wantErr: "line 1: invalid memory offset"},
+		{name: "Unaligned branch offset", src: "beq x1, x2, 6\n", wantErr: "line 1: invalid branch offset"},
+		{name: "Branch offset out of range", src: "jal x0, 512\n", wantErr: "line 1: invalid branch offset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAssembly(strings.NewReader(tt.src))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("ParseAssembly() error = %v, want prefix %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadWorkload_Assembly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "program.s")
+	if err := os.WriteFile(path, []byte("add x1, x2, x3\nsub x4, x1, x2\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write assembly: %v", err)
+	}
+
+	got, err := LoadWorkload(path)
+	if err != nil {
+		t.Fatalf("LoadWorkload() error = %v", err)
+	}
+
+	want := []Instruction{
+		{Opcode: OpcodeADD, Src1: 2, Src2: 3, Dest: 1},
+		{Opcode: OpcodeSUB, Src1: 1, Src2: 2, Dest: 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadWorkload() = %+v, want %+v", got, want)
+	}
+}